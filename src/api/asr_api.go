@@ -0,0 +1,180 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"ai-server-go/src/core/pool"
+	"ai-server-go/src/core/providers"
+	"ai-server-go/src/core/utils"
+	"ai-server-go/src/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultTranscribeMaxFileMB 批量转写上传文件默认大小上限(MB)，可通过系统配置 asr_transcribe/max_file_mb 调整
+	defaultTranscribeMaxFileMB = 10
+	// defaultTranscribeTimeout 批量转写默认超时，可通过系统配置 asr_transcribe/timeout_seconds 调整
+	defaultTranscribeTimeout = 60 * time.Second
+	// defaultTranscribeMaxDuration 上传音频默认时长上限，解码前按头部信息检查，可通过系统配置 asr_transcribe/max_duration_seconds 调整
+	defaultTranscribeMaxDuration = 10 * time.Minute
+	// transcribeSampleRate ASR提供者期望的PCM采样率（16位单声道）
+	transcribeSampleRate = 16000
+)
+
+// transcribeMaxDuration 上传音频的时长上限
+func (userApi *UserAPI) transcribeMaxDuration() time.Duration {
+	if value, err := userApi.configService.GetSystemConfigInt("asr_transcribe", "max_duration_seconds"); err == nil && value > 0 {
+		return time.Duration(value) * time.Second
+	}
+	return defaultTranscribeMaxDuration
+}
+
+// TranscribeAudio 批量转写上传的音频文件
+// POST /api/asr/transcribe  multipart: file(必填), provider(可选，ASR提供商名称), device_id(可选，用于使用统计)
+func (userApi *UserAPI) TranscribeAudio(c *gin.Context) {
+	maxBytes := int64(defaultTranscribeMaxFileMB) << 20
+	timeout := defaultTranscribeTimeout
+	if value, err := userApi.configService.GetSystemConfigInt("asr_transcribe", "max_file_mb"); err == nil && value > 0 {
+		maxBytes = int64(value) << 20
+	}
+	if value, err := userApi.configService.GetSystemConfigInt("asr_transcribe", "timeout_seconds"); err == nil && value > 0 {
+		timeout = time.Duration(value) * time.Second
+	}
+
+	// 限制请求体大小，额外预留表单字段的空间
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+1<<20)
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("缺少音频文件或文件超过限制: %v", err)})
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("音频文件大小超过限制，最大允许%dMB", maxBytes>>20)})
+		return
+	}
+
+	audioData, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("读取音频文件失败: %v", err)})
+		return
+	}
+	if int64(len(audioData)) > maxBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("音频文件大小超过限制，最大允许%dMB", maxBytes>>20)})
+		return
+	}
+
+	var userID *uint
+	if value, exists := c.Get("user_id"); exists {
+		if id, ok := value.(uint); ok {
+			userID = &id
+		}
+	}
+	var deviceID uint
+	if value := c.Request.FormValue("device_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的设备ID"})
+			return
+		}
+		deviceID = uint(id)
+	}
+
+	providerConfig, err := userApi.resolveRequestProvider("ASR", c.Request.FormValue("provider"), deviceID, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	format := utils.DetectAudioFormat(audioData, header.Filename)
+	pcmData, duration, err := utils.DecodeAudioToPCM(audioData, format, transcribeSampleRate, userApi.transcribeMaxDuration())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("音频格式转换失败: %v", err)})
+		return
+	}
+
+	factory := pool.NewASRFactory(providerConfig.Name, userApi.configService, userApi.logger, true, nil)
+	if factory == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建ASR提供者失败"})
+		return
+	}
+	instance, err := factory.Create()
+	if err != nil {
+		userApi.logger.Error("创建ASR提供者失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建ASR提供者失败"})
+		return
+	}
+	defer factory.Destroy(instance)
+
+	asrProvider, ok := instance.(providers.ASRProvider)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "实例不是有效的ASR提供者"})
+		return
+	}
+
+	withDeviceInfo(c, deviceID)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	text, err := asrProvider.Transcribe(ctx, pcmData)
+	elapsed := time.Since(start)
+
+	usage := database.UsageAmount{ASRSeconds: duration}
+	cost := database.EstimateCost(providerConfig, usage)
+	if recordErr := userApi.deviceService.RecordUsage(userID, deviceID, "asr", usage, cost, err == nil, elapsed); recordErr != nil {
+		userApi.logger.Error("记录转写使用统计失败: %v", recordErr)
+	}
+	c.Header(database.EstimatedCostHeader, database.FormatCost(cost))
+
+	if err != nil {
+		userApi.logger.Error("音频转写失败(provider=%s): %v", providerConfig.Name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("音频转写失败: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"text":       text,
+			"provider":   providerConfig.Name,
+			"format":     format,
+			"duration":   duration,
+			"elapsed_ms": elapsed.Milliseconds(),
+		},
+	})
+}
+
+// resolveRequestProvider 确定接口调用使用的提供商：指定名称 > 设备/用户绑定 > 系统默认
+func (userApi *UserAPI) resolveRequestProvider(category, name string, deviceID uint, userID *uint) (*database.ProviderConfig, error) {
+	if name != "" {
+		config, err := userApi.configService.GetProviderConfigByCategoryAndName(category, name)
+		if err != nil {
+			return nil, err
+		}
+		if config == nil {
+			return nil, fmt.Errorf("%s提供商不存在或未启用: %s", category, name)
+		}
+		return config, nil
+	}
+
+	var devicePtr *uint
+	if deviceID > 0 {
+		devicePtr = &deviceID
+	}
+	config, err := userApi.configService.GetEffectiveProvider(category, devicePtr, userID)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, fmt.Errorf("未配置默认%s提供商", category)
+	}
+	return config, nil
+}
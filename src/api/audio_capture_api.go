@@ -0,0 +1,98 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"ai-server-go/src/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetAudioCaptureStore 设置调试音频采集的存储，未设置时音频采集接口返回503
+func (userApi *UserAPI) SetAudioCaptureStore(store *database.AudioCaptureStore) {
+	userApi.audioCaptureStore = store
+}
+
+// audioCaptureDeviceID 解析路径中的设备ID，并检查音频采集存储和全局隐私开关
+func (userApi *UserAPI) audioCaptureDeviceID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的设备ID"})
+		return 0, false
+	}
+	if userApi.audioCaptureStore == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "音频采集存储未启用"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// ListAudioCaptures 列出设备未过期的采集音频，只返回元数据，内容通过 GET /api/devices/:id/audio-captures/:key 获取
+func (userApi *UserAPI) ListAudioCaptures(c *gin.Context) {
+	deviceID, ok := userApi.audioCaptureDeviceID(c)
+	if !ok {
+		return
+	}
+	if userApi.configService.AudioRetentionDisabled() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "全局隐私开关已禁止保留音频"})
+		return
+	}
+	page, ok := bindPagination(c, RecordPagination)
+	if !ok {
+		return
+	}
+	captures, err := userApi.audioCaptureStore.ListDeviceCaptures(deviceID, page.Limit)
+	if err != nil {
+		userApi.logger.Error("获取采集音频列表失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取采集音频列表失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"captures": captures,
+			"total":    len(captures),
+		},
+	})
+}
+
+// GetAudioCapture 下载单段采集音频（WAV），每次读取记录日志
+func (userApi *UserAPI) GetAudioCapture(c *gin.Context) {
+	deviceID, ok := userApi.audioCaptureDeviceID(c)
+	if !ok {
+		return
+	}
+	if userApi.configService.AudioRetentionDisabled() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "全局隐私开关已禁止保留音频"})
+		return
+	}
+	capture, data, err := userApi.audioCaptureStore.GetCapture(deviceID, c.Param("key"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "音频不存在或已过期"})
+		return
+	}
+	if currentUser, exists := c.Get("user"); exists {
+		userApi.logger.Info("用户 %s 读取设备 %d 的采集音频 %s", currentUser.(*database.User).Username, deviceID, capture.Key)
+	}
+	c.Header("Cache-Control", "private, no-store")
+	c.Data(http.StatusOK, "audio/wav", data)
+}
+
+// PurgeAudioCaptures 删除设备采集的全部音频
+func (userApi *UserAPI) PurgeAudioCaptures(c *gin.Context) {
+	deviceID, ok := userApi.audioCaptureDeviceID(c)
+	if !ok {
+		return
+	}
+	count, err := userApi.audioCaptureStore.PurgeDeviceCaptures(deviceID)
+	if err != nil {
+		userApi.logger.Error("清除采集音频失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "清除采集音频失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "采集音频已清除",
+		"deleted": count,
+	})
+}
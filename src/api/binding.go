@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+func init() {
+	// 校验错误中的字段名使用json标签，与客户端提交的字段一致
+	if engine, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		engine.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return field.Name
+			}
+			return name
+		})
+	}
+}
+
+// respondBindError 请求参数绑定失败时返回400，fields 给出每个出错字段的原因，如 {"email": "必须是有效的邮箱地址 (email)"}
+func respondBindError(c *gin.Context, err error) {
+	body := gin.H{"error": "请求参数错误"}
+	if fields := bindErrorFields(err); len(fields) > 0 {
+		body["fields"] = fields
+	} else {
+		body["error"] = "请求参数错误: " + err.Error()
+	}
+	c.JSON(http.StatusBadRequest, body)
+}
+
+// bindErrorFields 将绑定错误转换为 字段 -> 原因，非字段错误（如JSON格式错误）返回nil
+func bindErrorFields(err error) map[string]string {
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		fields := make(map[string]string, len(validationErrors))
+		for _, fieldErr := range validationErrors {
+			fields[bindFieldName(fieldErr)] = validationReason(fieldErr)
+		}
+		return fields
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return map[string]string{typeErr.Field: fmt.Sprintf("类型错误，应为%s", typeErr.Type.String())}
+	}
+	return nil
+}
+
+// bindFieldName 出错字段的路径，去掉顶层结构体名，如 RegisterRequest.email -> email
+func bindFieldName(fieldErr validator.FieldError) string {
+	namespace := fieldErr.Namespace()
+	if index := strings.Index(namespace, "."); index >= 0 {
+		return namespace[index+1:]
+	}
+	return fieldErr.Field()
+}
+
+// validationReason 校验规则对应的中文原因，附带规则本身便于客户端识别
+func validationReason(fieldErr validator.FieldError) string {
+	rule := fieldErr.Tag()
+	if fieldErr.Param() != "" {
+		rule += "=" + fieldErr.Param()
+	}
+	subject := ""
+	switch fieldErr.Kind() {
+	case reflect.String:
+		subject = "长度"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		subject = "数量"
+	}
+	var reason string
+	switch fieldErr.Tag() {
+	case "required":
+		reason = "不能为空"
+	case "email":
+		reason = "必须是有效的邮箱地址"
+	case "min":
+		if subject != "" {
+			reason = fmt.Sprintf("%s不能少于%s", subject, fieldErr.Param())
+		} else {
+			reason = fmt.Sprintf("不能小于%s", fieldErr.Param())
+		}
+	case "max":
+		if subject != "" {
+			reason = fmt.Sprintf("%s不能超过%s", subject, fieldErr.Param())
+		} else {
+			reason = fmt.Sprintf("不能大于%s", fieldErr.Param())
+		}
+	case "oneof":
+		reason = fmt.Sprintf("必须是以下之一: %s", fieldErr.Param())
+	default:
+		reason = "格式不正确"
+	}
+	return fmt.Sprintf("%s (%s)", reason, rule)
+}
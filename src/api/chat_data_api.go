@@ -0,0 +1,91 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"ai-server-go/src/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetChatDataPurger 设置聊天数据清除服务，未设置时清除接口返回503
+func (userApi *UserAPI) SetChatDataPurger(purger *database.ChatDataPurger) {
+	userApi.chatDataPurger = purger
+}
+
+// PurgeUserChatData 清除用户的全部聊天数据：本人或管理员，mode=anonymize 时保留会话和消息的行但清空内容
+func (userApi *UserAPI) PurgeUserChatData(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+	currentUser, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	user := currentUser.(*database.User)
+	if user.ID != uint(userID) && user.Role != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权限清除他人的聊天数据"})
+		return
+	}
+	if userApi.chatDataPurger == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "聊天数据清除未启用"})
+		return
+	}
+	mode := c.DefaultQuery("mode", database.ChatPurgeModeDelete)
+	if mode != database.ChatPurgeModeDelete && mode != database.ChatPurgeModeAnonymize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的mode参数，可选 delete、anonymize"})
+		return
+	}
+
+	// 模拟登录时审计记录实际操作的管理员
+	operatorID := user.ID
+	if c.GetBool("impersonating") {
+		operatorID = c.GetUint("impersonator_id")
+	}
+	result, err := userApi.chatDataPurger.PurgeUserChatData(c.Request.Context(), uint(userID), &operatorID, mode)
+	if err != nil {
+		userApi.logger.Error("清除用户聊天数据失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "清除用户聊天数据失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "聊天数据已清除",
+		"data":    result,
+	})
+}
+
+// ListChatDataPurgeAudits 查询聊天数据清除审计记录
+func (userApi *UserAPI) ListChatDataPurgeAudits(c *gin.Context) {
+	if userApi.chatDataPurger == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "聊天数据清除未启用"})
+		return
+	}
+	page, ok := bindPagination(c, RecordPagination)
+	if !ok {
+		return
+	}
+	userID, _ := strconv.ParseUint(c.Query("user_id"), 10, 32)
+
+	audits, total, err := userApi.chatDataPurger.ListChatDataPurgeAudits(uint(userID), page.Offset, page.Limit)
+	if err != nil {
+		userApi.logger.Error("查询聊天数据清除审计记录失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询聊天数据清除审计记录失败"})
+		return
+	}
+	if audits == nil {
+		audits = []*database.ChatDataPurgeAudit{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data": audits,
+		"pagination": gin.H{
+			"offset": page.Offset,
+			"limit":  page.Limit,
+			"total":  total,
+		},
+	})
+}
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"net/http"
+
+	"ai-server-go/src/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DatabaseGuard 数据库熔断期间直接返回503，避免每个请求都等待数据库超时；冷却时间过后请求正常放行
+func DatabaseGuard(db *database.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if db == nil || db.Available() {
+			c.Next()
+			return
+		}
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":                database.ErrDatabaseUnavailable.Error(),
+			"database_unavailable": true,
+		})
+		c.Abort()
+	}
+}
@@ -0,0 +1,371 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"ai-server-go/src/core/pool"
+	"ai-server-go/src/core/providers"
+	"ai-server-go/src/core/providers/tts"
+	"ai-server-go/src/core/types"
+	"ai-server-go/src/core/utils"
+	"ai-server-go/src/database"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+/*
+* 设备流水线测试：上传一段示例音频，按设备生效的配置依次执行 ASR -> LLM -> TTS，
+* 返回识别文本、LLM回复、合成音频的下载地址和各阶段耗时，无需真实设备即可验证整条链路。
+* provider按 设备 > 用户（设备所有者）> 系统默认 解析，提示词、音色和语速按设备的人设和默认提示词确定。
+ */
+
+const (
+	// defaultPipelineTestTimeout 流水线测试默认超时，可通过系统配置 pipeline_test/timeout_seconds 调整
+	defaultPipelineTestTimeout = 120 * time.Second
+	// pipelineTestAudioTTL 合成音频保留时长，过期文件在下次测试时清理
+	pipelineTestAudioTTL = time.Hour
+)
+
+// PipelineTestResult 流水线测试结果
+type PipelineTestResult struct {
+	Transcription string                 `json:"transcription"`
+	Response      string                 `json:"response"`
+	AudioURL      string                 `json:"audio_url"`
+	Providers     map[string]string      `json:"providers"` // 各阶段使用的provider名称
+	Persona       string                 `json:"persona"`   // 生效的人设名称，未分配时为空
+	Timings       PipelineTestTimings    `json:"timings"`
+	FailedStage   string                 `json:"failed_stage"`    // 失败的阶段（asr/llm/tts），成功时为空
+	Extra         map[string]interface{} `json:"extra,omitempty"` // 音频格式、时长等附加信息
+}
+
+// PipelineTestTimings 流水线各阶段耗时（毫秒）
+type PipelineTestTimings struct {
+	ASRMs           int64 `json:"asr_ms"`
+	LLMFirstTokenMs int64 `json:"llm_first_token_ms"`
+	LLMMs           int64 `json:"llm_ms"`
+	TTSMs           int64 `json:"tts_ms"`
+	TotalMs         int64 `json:"total_ms"`
+}
+
+// pipelineTestAudioDir 流水线测试合成音频的存放目录
+func pipelineTestAudioDir() string {
+	return filepath.Join(os.TempDir(), "pipeline-test")
+}
+
+// TestDevicePipeline 使用示例音频测试设备生效的 ASR -> LLM -> TTS 链路
+// POST /api/devices/:id/pipeline-test  multipart: file(必填)
+func (userApi *UserAPI) TestDevicePipeline(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的设备ID"})
+		return
+	}
+	deviceID := uint(id)
+	if _, err := userApi.deviceService.GetDeviceByID(deviceID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "设备不存在"})
+		return
+	}
+
+	maxBytes := int64(defaultTranscribeMaxFileMB) << 20
+	if value, err := userApi.configService.GetSystemConfigInt("asr_transcribe", "max_file_mb"); err == nil && value > 0 {
+		maxBytes = int64(value) << 20
+	}
+	timeout := defaultPipelineTestTimeout
+	if value, err := userApi.configService.GetSystemConfigInt("pipeline_test", "timeout_seconds"); err == nil && value > 0 {
+		timeout = time.Duration(value) * time.Second
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+1<<20)
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("缺少音频文件或文件超过限制: %v", err)})
+		return
+	}
+	defer file.Close()
+	audioData, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("读取音频文件失败: %v", err)})
+		return
+	}
+	if int64(len(audioData)) > maxBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("音频文件大小超过限制，最大允许%dMB", maxBytes>>20)})
+		return
+	}
+
+	// 按设备所有者解析用户级配置，与设备连接时一致
+	ownerID := userApi.configService.DeviceOwnerID(deviceID)
+	result := &PipelineTestResult{Providers: map[string]string{}, Extra: map[string]interface{}{}}
+	configs := map[string]*database.ProviderConfig{}
+	for _, category := range []string{"ASR", "LLM", "TTS"} {
+		config, err := userApi.resolveRequestProvider(category, "", deviceID, ownerID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		configs[category] = config
+		result.Providers[strings.ToLower(category)] = config.Name
+	}
+	persona, err := userApi.configService.ResolvePersona(deviceID, ownerID)
+	if err != nil {
+		userApi.logger.Error("解析设备人设失败: %v", err)
+	}
+	if persona != nil {
+		result.Persona = persona.Name
+	}
+
+	withDeviceInfo(c, deviceID)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+	start := time.Now()
+	fail := func(stage string, status int, err error) {
+		result.FailedStage = stage
+		result.Timings.TotalMs = time.Since(start).Milliseconds()
+		userApi.logger.Error("设备 %d 流水线测试%s阶段失败: %v", deviceID, stage, err)
+		c.JSON(status, gin.H{"error": fmt.Sprintf("%s阶段失败: %v", stage, err), "data": result})
+	}
+
+	// 1. ASR
+	text, status, err := userApi.pipelineTestASR(ctx, configs["ASR"], audioData, header.Filename, deviceID, ownerID, result)
+	if err != nil {
+		fail("asr", status, err)
+		return
+	}
+	result.Transcription = text
+	if strings.TrimSpace(text) == "" {
+		fail("asr", http.StatusUnprocessableEntity, fmt.Errorf("未识别到语音"))
+		return
+	}
+
+	// 2. LLM
+	reply, err := userApi.pipelineTestLLM(ctx, configs["LLM"], persona, text, deviceID, ownerID, result)
+	if err != nil {
+		fail("llm", http.StatusInternalServerError, err)
+		return
+	}
+	result.Response = reply
+
+	// 3. TTS
+	audioName, err := userApi.pipelineTestTTS(ctx, configs["TTS"], persona, reply, deviceID, ownerID, result)
+	if err != nil {
+		fail("tts", http.StatusInternalServerError, err)
+		return
+	}
+	result.AudioURL = fmt.Sprintf("/api/devices/pipeline-test/audio/%s", audioName)
+	result.Timings.TotalMs = time.Since(start).Milliseconds()
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": result})
+}
+
+// pipelineTestASR 按ASR provider所需采样率解码示例音频并识别
+func (userApi *UserAPI) pipelineTestASR(ctx context.Context, config *database.ProviderConfig, audioData []byte, filename string, deviceID uint, userID *uint, result *PipelineTestResult) (string, int, error) {
+	factory := pool.NewASRFactory(config.Name, userApi.configService, userApi.logger, true, nil)
+	if factory == nil {
+		return "", http.StatusInternalServerError, fmt.Errorf("创建ASR提供者失败")
+	}
+	instance, err := factory.Create()
+	if err != nil {
+		return "", http.StatusInternalServerError, fmt.Errorf("创建ASR提供者失败: %v", err)
+	}
+	defer factory.Destroy(instance)
+	asrProvider, ok := instance.(providers.ASRProvider)
+	if !ok {
+		return "", http.StatusInternalServerError, fmt.Errorf("实例不是有效的ASR提供者")
+	}
+
+	sampleRate := transcribeSampleRate
+	if reporter, ok := instance.(providers.InputSampleRateReporter); ok && reporter.InputSampleRate() > 0 {
+		sampleRate = reporter.InputSampleRate()
+	}
+	format := utils.DetectAudioFormat(audioData, filename)
+	pcmData, duration, err := utils.DecodeAudioToPCM(audioData, format, sampleRate, userApi.transcribeMaxDuration())
+	if err != nil {
+		return "", http.StatusBadRequest, fmt.Errorf("音频格式转换失败: %v", err)
+	}
+	result.Extra["format"] = format
+	result.Extra["duration"] = duration
+
+	start := time.Now()
+	text, err := asrProvider.Transcribe(ctx, pcmData)
+	elapsed := time.Since(start)
+	result.Timings.ASRMs = elapsed.Milliseconds()
+	userApi.recordPipelineTestUsage(config, userID, deviceID, "asr", database.UsageAmount{ASRSeconds: duration}, err == nil, elapsed)
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	return text, http.StatusOK, nil
+}
+
+// pipelineTestLLM 使用设备的提示词（人设优先，其次默认提示词）生成回复，记录首个输出和完整回复的耗时
+func (userApi *UserAPI) pipelineTestLLM(ctx context.Context, config *database.ProviderConfig, persona *database.Persona, text string, deviceID uint, userID *uint, result *PipelineTestResult) (string, error) {
+	factory := pool.NewLLMFactory(config.Name, userApi.configService, userApi.logger, nil)
+	if factory == nil {
+		return "", fmt.Errorf("创建LLM提供者失败")
+	}
+	instance, err := factory.Create()
+	if err != nil {
+		return "", fmt.Errorf("创建LLM提供者失败: %v", err)
+	}
+	defer factory.Destroy(instance)
+	llmProvider, ok := instance.(types.LLMProvider)
+	if !ok {
+		return "", fmt.Errorf("实例不是有效的LLM提供者")
+	}
+
+	prompt, err := userApi.configService.GetSystemConfigValue("prompt", "default_prompt")
+	if err != nil || prompt == "" {
+		prompt = "你是一个友好的AI助手"
+	}
+	if persona != nil && persona.Prompt != "" {
+		prompt = persona.Prompt
+	}
+	messages := []types.Message{
+		{Role: "system", Content: prompt},
+		{Role: "user", Content: text},
+	}
+
+	start := time.Now()
+	responses, err := llmProvider.Response(ctx, "pipeline-test-"+uuid.New().String(), messages)
+	if err != nil {
+		return "", err
+	}
+	var reply strings.Builder
+	for content := range responses {
+		if reply.Len() == 0 && content != "" {
+			result.Timings.LLMFirstTokenMs = time.Since(start).Milliseconds()
+		}
+		reply.WriteString(content)
+	}
+	elapsed := time.Since(start)
+	result.Timings.LLMMs = elapsed.Milliseconds()
+
+	usage := database.UsageAmount{
+		InputTokens:  utils.EstimateTokens(prompt) + utils.EstimateTokens(text),
+		OutputTokens: utils.EstimateTokens(reply.String()),
+	}
+	if err := ctx.Err(); err != nil {
+		userApi.recordPipelineTestUsage(config, userID, deviceID, "llm", usage, false, elapsed)
+		return "", fmt.Errorf("LLM生成回复超时: %v", err)
+	}
+	content := strings.TrimSpace(utils.RemoveAllEmoji(reply.String()))
+	if content == "" || strings.Contains(content, "服务响应异常") {
+		userApi.recordPipelineTestUsage(config, userID, deviceID, "llm", usage, false, elapsed)
+		return "", fmt.Errorf("LLM未返回有效回复: %s", reply.String())
+	}
+	userApi.recordPipelineTestUsage(config, userID, deviceID, "llm", usage, true, elapsed)
+	return content, nil
+}
+
+// pipelineTestTTS 按设备的人设音色和语速合成回复，音频移入测试目录后返回文件名
+func (userApi *UserAPI) pipelineTestTTS(ctx context.Context, config *database.ProviderConfig, persona *database.Persona, text string, deviceID uint, userID *uint, result *PipelineTestResult) (string, error) {
+	voice := ""
+	if persona != nil {
+		voice = persona.Voice
+	}
+	ttsConfig, err := newSynthesizeConfig(config, voice)
+	if err != nil {
+		return "", err
+	}
+	if persona != nil && persona.SpeechRate > 0 {
+		ttsConfig.SpeechRate = persona.SpeechRate
+	}
+	provider, err := tts.Create(ttsConfig.Type, ttsConfig, false, userApi.logger)
+	if err != nil {
+		return "", fmt.Errorf("创建TTS提供者失败: %v", err)
+	}
+	defer provider.Cleanup()
+
+	start := time.Now()
+	audioFile, err := provider.ToTTS(ctx, utils.RemoveMarkdownSyntax(text))
+	elapsed := time.Since(start)
+	result.Timings.TTSMs = elapsed.Milliseconds()
+	userApi.recordPipelineTestUsage(config, userID, deviceID, "tts", database.UsageAmount{TTSChars: utf8.RuneCountInString(text)}, err == nil, elapsed)
+	if err != nil {
+		return "", err
+	}
+
+	dir := pipelineTestAudioDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("创建测试音频目录失败: %v", err)
+	}
+	cleanupPipelineTestAudio(dir, userApi.logger)
+	name := fmt.Sprintf("%d_%s%s", deviceID, uuid.New().String(), filepath.Ext(audioFile))
+	if err := moveFile(audioFile, filepath.Join(dir, name)); err != nil {
+		return "", fmt.Errorf("保存合成音频失败: %v", err)
+	}
+	return name, nil
+}
+
+// recordPipelineTestUsage 记录流水线测试各阶段的使用统计
+func (userApi *UserAPI) recordPipelineTestUsage(config *database.ProviderConfig, userID *uint, deviceID uint, capability string, usage database.UsageAmount, success bool, elapsed time.Duration) {
+	cost := database.EstimateCost(config, usage)
+	if err := userApi.deviceService.RecordUsage(userID, deviceID, capability, usage, cost, success, elapsed); err != nil {
+		userApi.logger.Error("记录流水线测试使用统计失败: %v", err)
+	}
+}
+
+// GetPipelineTestAudio 下载流水线测试合成的音频
+// GET /api/devices/pipeline-test/audio/:name
+func (userApi *UserAPI) GetPipelineTestAudio(c *gin.Context) {
+	name := filepath.Base(c.Param("name"))
+	if name == "." || name == "/" || strings.HasPrefix(name, ".") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的文件名"})
+		return
+	}
+	path := filepath.Join(pipelineTestAudioDir(), name)
+	if _, err := os.Stat(path); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "音频不存在或已过期"})
+		return
+	}
+	userApi.sendSynthesizedAudio(c, path)
+}
+
+// cleanupPipelineTestAudio 删除超过保留时长的测试音频
+func cleanupPipelineTestAudio(dir string, logger *utils.Logger) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || time.Since(info.ModTime()) < pipelineTestAudioTTL {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+			logger.Warn("删除过期测试音频失败: %v", err)
+		}
+	}
+}
+
+// moveFile 移动文件，跨文件系统时复制后删除源文件
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"ai-server-go/src/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetImageStore 设置设备上传图片的存储，未设置时图片接口返回503
+func (userApi *UserAPI) SetImageStore(imageStore *database.ImageStore) {
+	userApi.imageStore = imageStore
+}
+
+// imageOwnerID 校验路径中的用户ID：本人或管理员
+func (userApi *UserAPI) imageOwnerID(c *gin.Context) (uint, bool) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return 0, false
+	}
+	currentUser, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return 0, false
+	}
+	user := currentUser.(*database.User)
+	if user.ID != uint(userID) && user.Role != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权限操作他人的图片"})
+		return 0, false
+	}
+	if userApi.imageStore == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "图片存储未启用"})
+		return 0, false
+	}
+	return uint(userID), true
+}
+
+// ListUserImages 列出用户存储的图片，只返回元数据，内容通过 GET /api/images/:key 获取
+func (userApi *UserAPI) ListUserImages(c *gin.Context) {
+	userID, ok := userApi.imageOwnerID(c)
+	if !ok {
+		return
+	}
+	page, ok := bindPagination(c, RecordPagination)
+	if !ok {
+		return
+	}
+	images, err := userApi.imageStore.ListUserImages(userID, page.Limit)
+	if err != nil {
+		userApi.logger.Error("获取图片列表失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取图片列表失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"images": images,
+			"total":  len(images),
+		},
+	})
+}
+
+// PurgeUserImages 删除用户存储的全部图片
+func (userApi *UserAPI) PurgeUserImages(c *gin.Context) {
+	userID, ok := userApi.imageOwnerID(c)
+	if !ok {
+		return
+	}
+	count, err := userApi.imageStore.PurgeUserImages(userID)
+	if err != nil {
+		userApi.logger.Error("清除用户图片失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "清除用户图片失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "图片已清除",
+		"deleted": count,
+	})
+}
+
+// GetStoredImage 读取单张存储的图片内容：图片所属用户、设备绑定用户或管理员
+func (userApi *UserAPI) GetStoredImage(c *gin.Context) {
+	if userApi.imageStore == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "图片存储未启用"})
+		return
+	}
+	currentUser, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	user := currentUser.(*database.User)
+
+	image, data, err := userApi.imageStore.GetImage(c.Param("key"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "图片不存在或已过期"})
+		return
+	}
+	if user.Role != "admin" && !(image.UserID != nil && *image.UserID == user.ID) {
+		ownerID := userApi.configService.DeviceOwnerID(image.DeviceID)
+		if ownerID == nil || *ownerID != user.ID {
+			// 与不存在的图片返回相同结果，不暴露图片是否存在
+			c.JSON(http.StatusNotFound, gin.H{"error": "图片不存在或已过期"})
+			return
+		}
+	}
+	// 只按允许的图片类型返回，其他类型（早期写入的数据）作为二进制下载，禁止浏览器嗅探内容类型
+	mimeType := image.MimeType
+	ext, ok := database.ImageFileExtension(mimeType)
+	if !ok {
+		mimeType, ext = "application/octet-stream", "bin"
+	}
+	c.Header("Cache-Control", "private, no-store")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=\"%s.%s\"", image.Key, ext))
+	c.Data(http.StatusOK, mimeType, data)
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"ai-server-go/src/core/utils"
+	"ai-server-go/src/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultLogStreamMaxSeconds = 600
+	defaultLogStreamMaxStreams = 5
+	logStreamBuffer            = 256
+	logStreamHeartbeat         = 15 * time.Second
+)
+
+// StreamLogs 以SSE实时推送指定设备/会话的日志，必须指定 device 或 session，
+// 只推送带有匹配标识的日志；到达最长时长后服务端结束推送
+func (userApi *UserAPI) StreamLogs(c *gin.Context) {
+	deviceID := strings.TrimSpace(c.Query("device"))
+	sessionID := strings.TrimSpace(c.Query("session"))
+	if deviceID == "" && sessionID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "必须指定 device 或 session"})
+		return
+	}
+	if deviceID != "" {
+		id, err := strconv.ParseUint(deviceID, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的设备ID"})
+			return
+		}
+		if device, err := userApi.deviceService.GetDeviceByID(uint(id)); err != nil || device == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "设备不存在"})
+			return
+		}
+	}
+	level, ok := utils.ParseLogLevel(c.Query("level"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的日志级别，可选值: debug、info、warn、error"})
+		return
+	}
+
+	maxSeconds := defaultLogStreamMaxSeconds
+	if value, err := userApi.configService.GetSystemConfigInt("log_stream", "max_seconds"); err == nil && value > 0 {
+		maxSeconds = value
+	}
+	duration := time.Duration(maxSeconds) * time.Second
+	if value := c.Query("duration"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的推送时长"})
+			return
+		}
+		duration = min(duration, time.Duration(seconds)*time.Second)
+	}
+	maxStreams := defaultLogStreamMaxStreams
+	if value, err := userApi.configService.GetSystemConfigInt("log_stream", "max_streams"); err == nil && value > 0 {
+		maxStreams = value
+	}
+	if userApi.logger.LogSubscriberCount() >= maxStreams {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "日志推送连接数已达上限，请稍后再试"})
+		return
+	}
+
+	operator := ""
+	if currentUser, exists := c.Get("user"); exists {
+		operator = currentUser.(*database.User).Username
+	}
+	userApi.logger.Info("用户 %s 开始订阅日志: device=%s session=%s level=%s，最长 %v", operator, deviceID, sessionID, level, duration)
+
+	sub := userApi.logger.Subscribe(utils.LogFilter{DeviceID: deviceID, SessionID: sessionID, MinLevel: level}, logStreamBuffer)
+	defer userApi.logger.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	deadline := time.NewTimer(duration)
+	defer deadline.Stop()
+	heartbeat := time.NewTicker(logStreamHeartbeat)
+	defer heartbeat.Stop()
+
+	reason := "client_closed"
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case entry := <-sub.C:
+			c.SSEvent("log", entry)
+			return true
+		case <-heartbeat.C:
+			c.SSEvent("ping", gin.H{"dropped": sub.Dropped()})
+			return true
+		case <-deadline.C:
+			reason = "max_duration"
+			c.SSEvent("end", gin.H{"reason": reason, "dropped": sub.Dropped()})
+			return false
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+	userApi.logger.Info("用户 %s 的日志订阅结束（%s）: device=%s session=%s，丢弃 %d 条", operator, reason, deviceID, sessionID, sub.Dropped())
+}
@@ -65,8 +65,10 @@ func (api *MemoryAPI) GetMemoryStats(c *gin.Context) {
 func (api *MemoryAPI) GetSessions(c *gin.Context) {
 	userID := api.getUserID(c)
 	deviceID := api.getDeviceID(c)
-	limit := api.getIntParam(c, "limit", 20)
-	offset := api.getIntParam(c, "offset", 0)
+	page, ok := bindPagination(c, ListPagination)
+	if !ok {
+		return
+	}
 
 	if deviceID == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "设备ID不能为空"})
@@ -76,7 +78,6 @@ func (api *MemoryAPI) GetSessions(c *gin.Context) {
 	// 这里需要实现获取会话列表的方法
 	// 暂时返回空列表，使用参数避免编译警告
 	_ = userID
-	_ = offset
 
 	sessions := []gin.H{}
 
@@ -85,8 +86,8 @@ func (api *MemoryAPI) GetSessions(c *gin.Context) {
 		"data": gin.H{
 			"sessions": sessions,
 			"total":    len(sessions),
-			"limit":    limit,
-			"offset":   offset,
+			"limit":    page.Limit,
+			"offset":   page.Offset,
 		},
 	})
 }
@@ -115,19 +116,25 @@ func (api *MemoryAPI) GetSession(c *gin.Context) {
 // GetSessionMessages 获取会话消息
 func (api *MemoryAPI) GetSessionMessages(c *gin.Context) {
 	sessionID := c.Param("sessionID")
-	limit := api.getIntParam(c, "limit", 50)
+	page, ok := bindPagination(c, RecordPagination)
+	if !ok {
+		return
+	}
 
 	if sessionID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "会话ID不能为空"})
 		return
 	}
 
-	messages, err := api.memoryService.GetSessionMessages(sessionID, limit)
+	messages, err := api.memoryService.GetSessionMessages(sessionID, page.Limit)
 	if err != nil {
 		api.logger.Error("获取会话消息失败: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话消息失败"})
 		return
 	}
+	for i := range messages {
+		messages[i].RedactAttachments()
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -142,7 +149,10 @@ func (api *MemoryAPI) GetSessionMessages(c *gin.Context) {
 func (api *MemoryAPI) GetSessionMemories(c *gin.Context) {
 	sessionID := c.Param("sessionID")
 	memoryType := c.Query("type")
-	limit := api.getIntParam(c, "limit", 10)
+	page, ok := bindPagination(c, PaginationLimits{Default: 10, Max: ListPagination.Max})
+	if !ok {
+		return
+	}
 
 	if sessionID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "会话ID不能为空"})
@@ -152,7 +162,7 @@ func (api *MemoryAPI) GetSessionMemories(c *gin.Context) {
 	// 这里需要实现获取会话记忆的方法
 	// 暂时返回空列表，使用参数避免编译警告
 	_ = memoryType
-	_ = limit
+	_ = page
 
 	memories := []gin.H{}
 
@@ -240,18 +250,3 @@ func (api *MemoryAPI) getDeviceID(c *gin.Context) uint {
 
 	return uint(deviceID)
 }
-
-// getIntParam 获取整数参数
-func (api *MemoryAPI) getIntParam(c *gin.Context, key string, defaultValue int) int {
-	valueStr := c.Query(key)
-	if valueStr == "" {
-		return defaultValue
-	}
-
-	value, err := strconv.Atoi(valueStr)
-	if err != nil {
-		return defaultValue
-	}
-
-	return value
-}
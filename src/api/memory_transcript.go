@@ -0,0 +1,257 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"ai-server-go/src/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+/*
+* 对话记录导出：GET /api/memory/sessions/:sessionID/transcript?format=txt|md|json&memories=true
+* 按时间顺序输出会话的全部消息（角色、时间、内容、附件引用），memories=true 时在生成记忆的位置插入记忆标注。
+* 消息分批读取、边读边写，大会话不会整体加载到内存。附件只输出引用，内嵌的二进制数据（data URL）不输出。
+* 仅会话所属用户、绑定了该设备的用户或管理员可以导出。
+ */
+
+// transcriptTimeLayout 对话记录中的时间格式
+const transcriptTimeLayout = "2006-01-02 15:04:05"
+
+// transcriptContentTypes 各导出格式（同时作为文件扩展名）的Content-Type
+var transcriptContentTypes = map[string]string{
+	"txt":  "text/plain; charset=utf-8",
+	"md":   "text/markdown; charset=utf-8",
+	"json": "application/json; charset=utf-8",
+}
+
+// transcriptRoleNames 文本格式中的角色名称
+var transcriptRoleNames = map[string]string{
+	"user":      "用户",
+	"assistant": "助手",
+	"system":    "系统",
+	"tool":      "工具",
+}
+
+// transcriptRenderer 对话记录的输出格式
+type transcriptRenderer interface {
+	header(session *database.ChatSession)
+	message(msg *database.ChatMessage)
+	memory(memory *database.ChatMemory)
+	footer()
+}
+
+// GetSessionTranscript 导出会话的对话记录
+func (userApi *UserAPI) GetSessionTranscript(c *gin.Context) {
+	format := c.DefaultQuery("format", "txt")
+	contentType, ok := transcriptContentTypes[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的导出格式，可选 txt、md、json"})
+		return
+	}
+	session, ok := userApi.authorizeSession(c)
+	if !ok {
+		return
+	}
+	sessionID := session.SessionID
+
+	var (
+		memories []database.ChatMemory
+		err      error
+	)
+	if c.Query("memories") == "true" {
+		if memories, err = userApi.memoryService.ListSessionMemories(sessionID); err != nil {
+			userApi.logger.Error("获取会话记忆失败: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话记忆失败"})
+			return
+		}
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"transcript-%s.%s\"", sessionID, format))
+	c.Status(http.StatusOK)
+
+	out := bufio.NewWriter(c.Writer)
+	renderer := newTranscriptRenderer(format, out)
+	renderer.header(session)
+	err = userApi.memoryService.StreamSessionMessages(sessionID, func(messages []database.ChatMessage) error {
+		for i := range messages {
+			// 记忆插在生成时间之前的最后一条消息之后
+			for len(memories) > 0 && memories[0].CreatedAt.Before(messages[i].Timestamp) {
+				renderer.memory(&memories[0])
+				memories = memories[1:]
+			}
+			renderer.message(&messages[i])
+		}
+		if err := out.Flush(); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if err != nil {
+		// 响应已开始输出，只能记录日志并截断
+		userApi.logger.Error("导出会话 %s 的对话记录失败: %v", sessionID, err)
+		return
+	}
+	for i := range memories {
+		renderer.memory(&memories[i])
+	}
+	renderer.footer()
+	if err := out.Flush(); err != nil {
+		userApi.logger.Error("导出会话 %s 的对话记录失败: %v", sessionID, err)
+	}
+}
+
+// newTranscriptRenderer 按格式创建对话记录输出
+func newTranscriptRenderer(format string, w *bufio.Writer) transcriptRenderer {
+	switch format {
+	case "md":
+		return &markdownTranscript{w: w}
+	case "json":
+		return &jsonTranscript{w: w}
+	default:
+		return &textTranscript{w: w}
+	}
+}
+
+// transcriptRole 角色的显示名称
+func transcriptRole(role string) string {
+	if name, ok := transcriptRoleNames[role]; ok {
+		return name
+	}
+	return role
+}
+
+// transcriptAttachments 消息附件的引用列表
+func transcriptAttachments(msg *database.ChatMessage) []string {
+	attachments := msg.GetAttachments()
+	refs := make([]string, 0, len(attachments))
+	for _, attachment := range attachments {
+		refs = append(refs, fmt.Sprintf("[%s] %s", attachment.Type, database.AttachmentReference(attachment)))
+	}
+	return refs
+}
+
+// textTranscript 纯文本格式
+type textTranscript struct {
+	w *bufio.Writer
+}
+
+func (t *textTranscript) header(session *database.ChatSession) {
+	fmt.Fprintf(t.w, "会话: %s\n标题: %s\n开始时间: %s\n\n", session.SessionID, session.Title,
+		session.StartTime.Format(transcriptTimeLayout))
+}
+
+func (t *textTranscript) message(msg *database.ChatMessage) {
+	fmt.Fprintf(t.w, "[%s] %s: %s\n", msg.Timestamp.Format(transcriptTimeLayout), transcriptRole(msg.Role), msg.Content)
+	for _, ref := range transcriptAttachments(msg) {
+		fmt.Fprintf(t.w, "    附件: %s\n", ref)
+	}
+}
+
+func (t *textTranscript) memory(memory *database.ChatMemory) {
+	fmt.Fprintf(t.w, "    （记忆/%s）%s\n", memory.MemoryType, memory.Content)
+}
+
+func (t *textTranscript) footer() {}
+
+// markdownTranscript Markdown格式
+type markdownTranscript struct {
+	w *bufio.Writer
+}
+
+func (t *markdownTranscript) header(session *database.ChatSession) {
+	title := session.Title
+	if title == "" {
+		title = session.SessionID
+	}
+	fmt.Fprintf(t.w, "# %s\n\n- 会话: `%s`\n- 开始时间: %s\n\n", title, session.SessionID,
+		session.StartTime.Format(transcriptTimeLayout))
+}
+
+func (t *markdownTranscript) message(msg *database.ChatMessage) {
+	fmt.Fprintf(t.w, "**%s** _%s_\n\n%s\n\n", transcriptRole(msg.Role), msg.Timestamp.Format(transcriptTimeLayout), msg.Content)
+	for _, ref := range transcriptAttachments(msg) {
+		fmt.Fprintf(t.w, "- 附件: `%s`\n", ref)
+	}
+	if len(msg.GetAttachments()) > 0 {
+		t.w.WriteString("\n")
+	}
+}
+
+func (t *markdownTranscript) memory(memory *database.ChatMemory) {
+	content := strings.ReplaceAll(memory.Content, "\n", "\n> ")
+	fmt.Fprintf(t.w, "> 记忆（%s）: %s\n\n", memory.MemoryType, content)
+}
+
+func (t *markdownTranscript) footer() {}
+
+// jsonTranscript JSON格式：{"session":{...},"entries":[...]}，记忆以 type=memory 的条目插入
+type jsonTranscript struct {
+	w     *bufio.Writer
+	count int
+}
+
+// transcriptEntry JSON格式中的一条记录
+type transcriptEntry struct {
+	Type        string    `json:"type"` // message 或 memory
+	Role        string    `json:"role,omitempty"`
+	Content     string    `json:"content"`
+	Timestamp   time.Time `json:"timestamp"`
+	MessageType string    `json:"message_type,omitempty"`
+	MemoryType  string    `json:"memory_type,omitempty"`
+	Attachments []string  `json:"attachments,omitempty"`
+}
+
+func (t *jsonTranscript) header(session *database.ChatSession) {
+	data, _ := json.Marshal(gin.H{
+		"session_id": session.SessionID,
+		"device_id":  session.DeviceID,
+		"title":      session.Title,
+		"start_time": session.StartTime,
+		"end_time":   session.EndTime,
+	})
+	fmt.Fprintf(t.w, "{\"session\":%s,\"entries\":[", data)
+}
+
+func (t *jsonTranscript) message(msg *database.ChatMessage) {
+	t.write(transcriptEntry{
+		Type:        "message",
+		Role:        msg.Role,
+		Content:     msg.Content,
+		Timestamp:   msg.Timestamp,
+		MessageType: msg.MessageType,
+		Attachments: transcriptAttachments(msg),
+	})
+}
+
+func (t *jsonTranscript) memory(memory *database.ChatMemory) {
+	t.write(transcriptEntry{
+		Type:       "memory",
+		Content:    memory.Content,
+		Timestamp:  memory.CreatedAt,
+		MemoryType: memory.MemoryType,
+	})
+}
+
+func (t *jsonTranscript) write(entry transcriptEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if t.count > 0 {
+		t.w.WriteString(",")
+	}
+	t.count++
+	t.w.Write(data)
+}
+
+func (t *jsonTranscript) footer() {
+	t.w.WriteString("]}\n")
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"ai-server-go/src/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PaginationLimits 分页默认条数和最大条数
+type PaginationLimits struct {
+	Default int
+	Max     int
+}
+
+var (
+	// ListPagination 用户、设备等列表接口的分页限制，可通过系统配置 pagination 分类调整
+	ListPagination = PaginationLimits{Default: 20, Max: 100}
+	// RecordPagination 消息、事件等记录类接口的分页限制
+	RecordPagination = PaginationLimits{Default: 50, Max: 500}
+)
+
+// Pagination 解析后的分页参数
+type Pagination struct {
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
+
+// ParsePagination 统一解析offset/limit参数：非数字或负数返回错误，limit为0时使用默认值，超过上限时截断
+func ParsePagination(c *gin.Context, limits PaginationLimits) (Pagination, error) {
+	page := Pagination{Offset: 0, Limit: limits.Default}
+
+	if value := c.Query("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return page, fmt.Errorf("无效的offset参数: %s", value)
+		}
+		page.Offset = offset
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return page, fmt.Errorf("无效的limit参数: %s", value)
+		}
+		if limit > 0 {
+			page.Limit = limit
+		}
+	}
+
+	if limits.Max > 0 && page.Limit > limits.Max {
+		page.Limit = limits.Max
+	}
+	return page, nil
+}
+
+// bindPagination 解析分页参数，失败时直接返回400
+func bindPagination(c *gin.Context, limits PaginationLimits) (Pagination, bool) {
+	page, err := ParsePagination(c, limits)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return page, false
+	}
+	return page, true
+}
+
+// loadListPagination 读取系统配置中的列表分页限制，未配置时使用默认值
+func loadListPagination(configService *database.ConfigService) PaginationLimits {
+	limits := ListPagination
+	if configService == nil {
+		return limits
+	}
+	if value, err := configService.GetSystemConfigInt("pagination", "default_limit"); err == nil && value > 0 {
+		limits.Default = value
+	}
+	if value, err := configService.GetSystemConfigInt("pagination", "max_limit"); err == nil && value > 0 {
+		limits.Max = value
+	}
+	if limits.Default > limits.Max {
+		limits.Default = limits.Max
+	}
+	return limits
+}
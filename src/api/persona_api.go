@@ -0,0 +1,149 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"ai-server-go/src/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PersonaAssignRequest 人设分配请求
+type PersonaAssignRequest struct {
+	TargetType string `json:"target_type" binding:"required"` // device、user 或 global
+	TargetID   uint   `json:"target_id"`                      // 设备ID或用户ID，global时忽略
+	PersonaID  uint   `json:"persona_id" binding:"required"`
+}
+
+// ListPersonas 获取人设列表
+func (userApi *UserAPI) ListPersonas(c *gin.Context) {
+	personas, err := userApi.configService.ListPersonas()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取人设失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": personas})
+}
+
+// CreatePersona 创建人设
+func (userApi *UserAPI) CreatePersona(c *gin.Context) {
+	var req database.Persona
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	req.ID = 0
+	if err := userApi.configService.SavePersona(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "创建人设失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": req})
+}
+
+// UpdatePersona 更新人设
+func (userApi *UserAPI) UpdatePersona(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID格式错误"})
+		return
+	}
+	existing, err := userApi.configService.GetPersona(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	var req database.Persona
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	req.Model = existing.Model
+	if err := userApi.configService.SavePersona(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "更新人设失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": req})
+}
+
+// DeletePersona 删除人设，同时删除其分配
+func (userApi *UserAPI) DeletePersona(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID格式错误"})
+		return
+	}
+	if err := userApi.configService.DeletePersona(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "删除成功"})
+}
+
+// ListPersonaAssignments 获取人设分配列表，可按 target_type 过滤
+func (userApi *UserAPI) ListPersonaAssignments(c *gin.Context) {
+	assignments, err := userApi.configService.ListPersonaAssignments(c.Query("target_type"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取人设分配失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": assignments})
+}
+
+// AssignPersona 为设备、用户或全局分配人设：管理员可分配任意对象，普通用户只能分配给自己或自己拥有的设备
+func (userApi *UserAPI) AssignPersona(c *gin.Context) {
+	var req PersonaAssignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if !userApi.canAssignPersona(c, req.TargetType, req.TargetID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权限为该对象分配人设"})
+		return
+	}
+	assignment, err := userApi.configService.AssignPersona(req.TargetType, req.TargetID, req.PersonaID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "分配人设失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": assignment})
+}
+
+// UnassignPersona 取消人设分配，权限同 AssignPersona
+func (userApi *UserAPI) UnassignPersona(c *gin.Context) {
+	targetType := c.Param("targetType")
+	targetID, err := strconv.ParseUint(c.Param("targetID"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID格式错误"})
+		return
+	}
+	if !userApi.canAssignPersona(c, targetType, uint(targetID)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权限取消该对象的人设"})
+		return
+	}
+	if err := userApi.configService.UnassignPersona(targetType, uint(targetID)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "已取消人设分配"})
+}
+
+// canAssignPersona 检查当前用户能否修改对象的人设分配
+func (userApi *UserAPI) canAssignPersona(c *gin.Context, targetType string, targetID uint) bool {
+	currentUser, exists := c.Get("user")
+	if !exists {
+		return false
+	}
+	user := currentUser.(*database.User)
+	if user.Role == "admin" {
+		return true
+	}
+	switch targetType {
+	case database.PersonaTargetUser:
+		return targetID == user.ID
+	case database.PersonaTargetDevice:
+		ownerID := userApi.configService.DeviceOwnerID(targetID)
+		return ownerID != nil && *ownerID == user.ID
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+
+	"ai-server-go/src/core/providers/schema"
+	"ai-server-go/src/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetProviderTypeSchema 获取provider类型的Props参数说明，供管理端渲染配置表单
+func (userApi *UserAPI) GetProviderTypeSchema(c *gin.Context) {
+	category := c.Param("category")
+	providerType := c.Param("type")
+
+	s, ok := schema.Get(category, providerType)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "不支持的provider类型: " + category + "/" + providerType})
+		return
+	}
+
+	// 未在结构体上标注的密钥参数按参数名识别
+	fields := make([]schema.Field, len(s.Fields))
+	for i, field := range s.Fields {
+		field.Secret = field.Secret || database.IsSecretKey(field.Name)
+		fields[i] = field
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"category": s.Category,
+			"type":     s.Type,
+			"fields":   fields,
+		},
+	})
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"net/http"
+
+	"ai-server-go/src/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetMemoryService 设置会话记忆服务，未设置时会话接口返回503
+func (userApi *UserAPI) SetMemoryService(memoryService *database.ChatMemoryService) {
+	userApi.memoryService = memoryService
+}
+
+// registerSessionRoutes 注册会话相关路由：需要登录，只能访问本人的会话、绑定设备的会话，管理员不受限制
+func (userApi *UserAPI) registerSessionRoutes(r gin.IRouter) {
+	sessions := r.Group("/memory/sessions")
+	sessions.Use(userApi.authMiddleware.AuthRequired())
+	{
+		sessions.GET("/:sessionID/transcript", userApi.GetSessionTranscript)
+		sessions.PUT("/:sessionID/title", userApi.RenameSession)
+	}
+}
+
+// authorizeSession 查询路径中的会话并检查当前用户的访问权限，失败时已写入响应
+func (userApi *UserAPI) authorizeSession(c *gin.Context) (*database.ChatSession, bool) {
+	sessionID := c.Param("sessionID")
+	if sessionID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "会话ID不能为空"})
+		return nil, false
+	}
+	currentUser, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return nil, false
+	}
+	if userApi.memoryService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "会话服务未启用"})
+		return nil, false
+	}
+
+	session, err := userApi.memoryService.GetSession(sessionID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "会话不存在"})
+		return nil, false
+	}
+	user := currentUser.(*database.User)
+	if user.Role != "admin" && !userApi.memoryService.CanAccessSession(session, user.ID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权限访问该会话"})
+		return nil, false
+	}
+	return session, true
+}
+
+// RenameSession 手动命名会话，之后不再自动生成标题
+func (userApi *UserAPI) RenameSession(c *gin.Context) {
+	var req struct {
+		Title string `json:"title" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	session, ok := userApi.authorizeSession(c)
+	if !ok {
+		return
+	}
+
+	if err := userApi.memoryService.RenameSession(session.SessionID, req.Title); err != nil {
+		userApi.logger.Error("会话命名失败: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "会话命名成功",
+	})
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ai-server-go/src/configs"
+	"ai-server-go/src/core/auth"
+	"ai-server-go/src/core/utils"
+	"ai-server-go/src/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sessionRouteTest 会话路由测试环境：会话属于 owner，other 与会话无关
+type sessionRouteTest struct {
+	router     *gin.Engine
+	db         *database.Database
+	ownerToken string
+	otherToken string
+	adminToken string
+}
+
+// newSessionRouteTest 创建使用内存SQLite的会话路由
+func newSessionRouteTest(t *testing.T) *sessionRouteTest {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	config := &configs.Config{}
+	config.Log.LogDir = t.TempDir()
+	config.Log.LogFile = "test.log"
+	config.Log.LogLevel = "ERROR"
+	config.Database.Type = "sqlite"
+	config.Database.Name = fmt.Sprintf("file:%s_%d?mode=memory&cache=shared", t.Name(), time.Now().UnixNano())
+
+	logger, err := utils.NewLogger(config)
+	if err != nil {
+		t.Fatalf("创建日志失败: %v", err)
+	}
+	db, err := database.NewDatabase(&config.Database, logger)
+	if err != nil {
+		t.Fatalf("初始化内存数据库失败: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.AutoMigrate(); err != nil {
+		t.Fatalf("数据库迁移失败: %v", err)
+	}
+
+	userService := database.NewUserService(db, logger)
+	env := &sessionRouteTest{db: db}
+	tokens := map[string]*string{"owner": &env.ownerToken, "other": &env.otherToken, "admin": &env.adminToken}
+	userIDs := map[string]uint{}
+	for _, name := range []string{"owner", "other", "admin"} {
+		user := &database.User{Username: name, Email: name + "@example.com", PasswordHash: "-", Role: "user"}
+		if name == "admin" {
+			user.Role = "admin"
+		}
+		if err := db.GetDB().Create(user).Error; err != nil {
+			t.Fatalf("创建用户失败: %v", err)
+		}
+		userAuth, err := userService.CreateUserAuth(user.ID, nil)
+		if err != nil {
+			t.Fatalf("创建令牌失败: %v", err)
+		}
+		*tokens[name] = userAuth.AuthKey
+		userIDs[name] = user.ID
+	}
+
+	ownerID := userIDs["owner"]
+	session := &database.ChatSession{UserID: &ownerID, DeviceID: 1, SessionID: "s-1", Title: "默认标题", StartTime: time.Now(), Status: "active"}
+	if err := db.GetDB().Create(session).Error; err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+
+	userApi := NewUserAPI(userService, nil, nil, auth.NewAuthMiddleware(userService, logger), logger, nil)
+	userApi.SetMemoryService(database.NewChatMemoryService(db.GetDB(), logger))
+	env.router = gin.New()
+	userApi.registerSessionRoutes(env.router.Group("/api"))
+	return env
+}
+
+// do 发送请求，token为空时不带认证信息
+func (env *sessionRouteTest) do(method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestSessionTranscriptRoute(t *testing.T) {
+	env := newSessionRouteTest(t)
+	const path = "/api/memory/sessions/s-1/transcript"
+
+	if w := env.do(http.MethodGet, path, "", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("未登录时状态码为 %d，期望 401", w.Code)
+	}
+	if w := env.do(http.MethodGet, path, env.otherToken, ""); w.Code != http.StatusForbidden {
+		t.Fatalf("其他用户导出时状态码为 %d，期望 403", w.Code)
+	}
+	for name, token := range map[string]string{"owner": env.ownerToken, "admin": env.adminToken} {
+		w := env.do(http.MethodGet, path, token, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s 导出时状态码为 %d，期望 200", name, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), "会话: s-1") {
+			t.Fatalf("%s 导出的对话记录不正确: %s", name, w.Body.String())
+		}
+	}
+	if w := env.do(http.MethodGet, "/api/memory/sessions/missing/transcript", env.ownerToken, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("会话不存在时状态码为 %d，期望 404", w.Code)
+	}
+}
+
+func TestRenameSessionRoute(t *testing.T) {
+	env := newSessionRouteTest(t)
+	const path = "/api/memory/sessions/s-1/title"
+
+	if w := env.do(http.MethodPut, path, "", `{"title":"新标题"}`); w.Code != http.StatusUnauthorized {
+		t.Fatalf("未登录时状态码为 %d，期望 401", w.Code)
+	}
+	if w := env.do(http.MethodPut, path, env.otherToken, `{"title":"他人的标题"}`); w.Code != http.StatusForbidden {
+		t.Fatalf("其他用户命名时状态码为 %d，期望 403", w.Code)
+	}
+	if w := env.do(http.MethodPut, path, env.ownerToken, `{"title":"周末出游计划"}`); w.Code != http.StatusOK {
+		t.Fatalf("会话所属用户命名时状态码为 %d，期望 200: %s", w.Code, w.Body.String())
+	}
+	var session database.ChatSession
+	if err := env.db.GetDB().Where("session_id = ?", "s-1").First(&session).Error; err != nil {
+		t.Fatalf("查询会话失败: %v", err)
+	}
+	if session.Title != "周末出游计划" || session.TitleSource != "manual" {
+		t.Fatalf("命名后标题为 %q（%s），期望 周末出游计划（manual）", session.Title, session.TitleSource)
+	}
+	if w := env.do(http.MethodPut, path, env.adminToken, `{"title":"管理员命名"}`); w.Code != http.StatusOK {
+		t.Fatalf("管理员命名时状态码为 %d，期望 200", w.Code)
+	}
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"ai-server-go/src/core"
+	"ai-server-go/src/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SessionOverrider 管理活跃会话的会话级provider覆盖，由WebSocket服务实现
+type SessionOverrider interface {
+	SetSessionProviderOverride(sessionID, category, name string) error
+	ClearSessionProviderOverride(sessionID, category string) error
+	GetSessionProviderOverrides(sessionID string) (map[string]string, error)
+}
+
+// SetSessionOverrider 设置会话级provider覆盖的实现，未设置时相关接口返回503
+func (userApi *UserAPI) SetSessionOverrider(overrider SessionOverrider) {
+	userApi.sessionOverrider = overrider
+}
+
+// SessionProviderOverrideRequest 设置会话级provider覆盖的请求
+type SessionProviderOverrideRequest struct {
+	Category string `json:"category" binding:"required"` // ASR、LLM、TTS、VLLLM
+	Name     string `json:"name" binding:"required"`     // provider名称
+}
+
+// respondSessionOverrides 返回会话当前的provider覆盖
+func (userApi *UserAPI) respondSessionOverrides(c *gin.Context, sessionID string) {
+	overrides, err := userApi.sessionOverrider.GetSessionProviderOverrides(sessionID)
+	if err != nil {
+		userApi.respondSessionOverrideError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"session_id": sessionID,
+			"overrides":  overrides,
+		},
+	})
+}
+
+// respondSessionOverrideError 会话不存在返回404，其余错误返回400
+func (userApi *UserAPI) respondSessionOverrideError(c *gin.Context, err error) {
+	if errors.Is(err, core.ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "会话不存在或已结束"})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+// sessionOverriderReady 检查会话级provider覆盖是否可用
+func (userApi *UserAPI) sessionOverriderReady(c *gin.Context) bool {
+	if userApi.sessionOverrider == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "会话级provider覆盖不可用"})
+		return false
+	}
+	return true
+}
+
+// GetSessionProviderOverrides 获取会话当前的provider覆盖
+func (userApi *UserAPI) GetSessionProviderOverrides(c *gin.Context) {
+	if !userApi.sessionOverriderReady(c) {
+		return
+	}
+	userApi.respondSessionOverrides(c, c.Param("sessionID"))
+}
+
+// SetSessionProviderOverride 为活跃会话固定使用指定provider，下一轮对话开始时生效
+func (userApi *UserAPI) SetSessionProviderOverride(c *gin.Context) {
+	if !userApi.sessionOverriderReady(c) {
+		return
+	}
+	var req SessionProviderOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	sessionID := c.Param("sessionID")
+	if err := userApi.sessionOverrider.SetSessionProviderOverride(sessionID, req.Category, req.Name); err != nil {
+		userApi.respondSessionOverrideError(c, err)
+		return
+	}
+	if currentUser, exists := c.Get("user"); exists {
+		userApi.logger.Info("管理员 %s 为会话 %s 设置provider覆盖: %s -> %s",
+			currentUser.(*database.User).Username, sessionID, req.Category, req.Name)
+	}
+	userApi.respondSessionOverrides(c, sessionID)
+}
+
+// ClearSessionProviderOverride 清除会话的provider覆盖，未指定category时清除全部
+func (userApi *UserAPI) ClearSessionProviderOverride(c *gin.Context) {
+	if !userApi.sessionOverriderReady(c) {
+		return
+	}
+	sessionID := c.Param("sessionID")
+	if err := userApi.sessionOverrider.ClearSessionProviderOverride(sessionID, c.Param("category")); err != nil {
+		userApi.respondSessionOverrideError(c, err)
+		return
+	}
+	userApi.respondSessionOverrides(c, sessionID)
+}
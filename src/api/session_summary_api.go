@@ -0,0 +1,86 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"ai-server-go/src/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetSessionSummary 获取会话结束时记录的会话摘要
+func (userApi *UserAPI) GetSessionSummary(c *gin.Context) {
+	summary, err := userApi.deviceService.GetSessionSummary(c.Param("sessionID"))
+	if err != nil {
+		userApi.logger.Error("查询会话摘要失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询会话摘要失败"})
+		return
+	}
+	if summary == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "会话摘要不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    summary,
+	})
+}
+
+// ListSessionSummaries 按结束时间倒序查询会话摘要，可按设备、用户和时间范围过滤
+func (userApi *UserAPI) ListSessionSummaries(c *gin.Context) {
+	page, ok := bindPagination(c, RecordPagination)
+	if !ok {
+		return
+	}
+	query := database.SessionSummaryQuery{Limit: page.Limit, Offset: page.Offset}
+
+	if value := c.Query("device_id"); value != "" {
+		deviceID, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的device_id参数"})
+			return
+		}
+		query.DeviceID = uint(deviceID)
+	}
+	if value := c.Query("user_id"); value != "" {
+		userID, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的user_id参数"})
+			return
+		}
+		id := uint(userID)
+		query.UserID = &id
+	}
+	for param, target := range map[string]**time.Time{"since": &query.Since, "until": &query.Until} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的" + param + "参数，需为RFC3339格式"})
+			return
+		}
+		*target = &t
+	}
+
+	summaries, total, err := userApi.deviceService.ListSessionSummaries(query)
+	if err != nil {
+		userApi.logger.Error("查询会话摘要失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询会话摘要失败"})
+		return
+	}
+	if summaries == nil {
+		summaries = []*database.SessionSummary{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data": summaries,
+		"pagination": gin.H{
+			"offset": page.Offset,
+			"limit":  page.Limit,
+			"total":  total,
+		},
+	})
+}
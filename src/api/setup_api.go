@@ -0,0 +1,57 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"ai-server-go/src/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetSetupStatus 获取首次部署引导状态：各必需类别是否有可用的provider，以及仍需配置的参数
+func (userApi *UserAPI) GetSetupStatus(c *gin.Context) {
+	status, err := userApi.configService.GetSetupStatus()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取初始化状态失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": status})
+}
+
+// CompleteSetup 校验并启用LLM、ASR、TTS的最小可用配置，标记引导完成
+func (userApi *UserAPI) CompleteSetup(c *gin.Context) {
+	var req database.SetupCompleteRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondBindError(c, err)
+			return
+		}
+	}
+
+	var updatedBy *uint
+	operator := ""
+	if currentUser, exists := c.Get("user"); exists {
+		if user, ok := currentUser.(*database.User); ok {
+			updatedBy = &user.ID
+			operator = user.Username
+		}
+	}
+
+	status, err := userApi.configService.CompleteSetup(req, updatedBy)
+	if err != nil {
+		var setupErr *database.SetupError
+		if errors.As(err, &setupErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "categories": setupErr.Categories})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "完成初始化失败: " + err.Error()})
+		return
+	}
+	userApi.logger.Info("管理员 %s 完成首次部署引导", operator)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "初始化配置已完成，默认provider的变更在服务重启后生效",
+		"data":    status,
+	})
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"ai-server-go/src/core"
+	"ai-server-go/src/core/llmcache"
+	"ai-server-go/src/core/pool"
+	"ai-server-go/src/database"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+/*
+* 管理端实时状态推送：管理员通过 WebSocket 连接 /api/admin/status/stream 后，服务端按系统配置 status_stream.interval_seconds
+* 定期推送状态快照（会话数、各provider版本的健康状况和错误率、资源池使用情况、LLM缓存统计和新的设备事件），无需轮询。
+* 鉴权在升级前的HTTP握手中完成；浏览器无法设置 Authorization 头时可通过子协议 "bearer, <token>" 传递令牌。
+* 客户端断开或服务关闭时推送结束。
+ */
+
+const (
+	defaultStatusStreamInterval = 5 * time.Second
+	minStatusStreamInterval     = time.Second
+	defaultStatusStreamEvents   = 20
+	statusStreamWriteTimeout    = 10 * time.Second
+	statusStreamProtocol        = "bearer" // 携带令牌的子协议名称
+)
+
+// StatusSource 实时状态中的会话统计来源，由WebSocket服务实现
+type StatusSource interface {
+	GetSessionStats() core.SessionStats
+}
+
+// StatusSnapshot 推送给管理端的状态快照
+type StatusSnapshot struct {
+	Time      time.Time                 `json:"time"`
+	Sessions  core.SessionStats         `json:"sessions"`  // 会话数和下行拥塞统计
+	Providers []pool.ProviderHealth     `json:"providers"` // 各provider版本的请求数、错误率和健康状况
+	Pools     map[string]map[string]int `json:"pools"`     // 各资源池的可用数、总数和并发限制的在途/排队数
+	LLMCache  llmcache.Stats            `json:"llm_cache"` // LLM回复缓存统计
+	Events    []*database.DeviceEvent   `json:"events"`    // 上次推送以来的设备事件，按时间倒序
+}
+
+// statusStreamUpgrader 状态推送的WebSocket升级器，接受携带令牌的子协议
+var statusStreamUpgrader = websocket.Upgrader{
+	CheckOrigin:  func(r *http.Request) bool { return true },
+	Subprotocols: []string{statusStreamProtocol},
+}
+
+// SetStatusStream 设置实时状态推送的会话统计来源，ctx取消（服务关闭）时结束全部推送连接
+func (userApi *UserAPI) SetStatusStream(ctx context.Context, source StatusSource) {
+	userApi.statusCtx = ctx
+	userApi.statusSource = source
+}
+
+// StatusStreamToken 从子协议 "bearer, <token>" 中取出令牌写入 Authorization 头，供之后的认证中间件校验
+func StatusStreamToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			protocols := websocket.Subprotocols(c.Request)
+			if len(protocols) == 2 && protocols[0] == statusStreamProtocol {
+				c.Request.Header.Set("Authorization", "Bearer "+strings.TrimSpace(protocols[1]))
+			}
+		}
+		c.Next()
+	}
+}
+
+// statusStreamSettings 读取推送间隔和每次推送的设备事件上限
+func (userApi *UserAPI) statusStreamSettings() (time.Duration, int) {
+	interval, events := defaultStatusStreamInterval, defaultStatusStreamEvents
+	if value, err := userApi.configService.GetSystemConfigInt("status_stream", "interval_seconds"); err == nil && value > 0 {
+		interval = max(time.Duration(value)*time.Second, minStatusStreamInterval)
+	}
+	if value, err := userApi.configService.GetSystemConfigInt("status_stream", "event_limit"); err == nil && value >= 0 {
+		events = value
+	}
+	return interval, events
+}
+
+// StreamStatus 升级为WebSocket并定期推送状态快照，直到客户端断开或服务关闭
+func (userApi *UserAPI) StreamStatus(c *gin.Context) {
+	if userApi.statusSource == nil || userApi.statusCtx == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "实时状态推送未启用"})
+		return
+	}
+	conn, err := statusStreamUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// 升级失败时升级器已返回错误响应
+		userApi.logger.Warn("状态推送WebSocket升级失败: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(userApi.statusCtx)
+	defer cancel()
+
+	// 读取客户端消息以处理关闭帧和ping，读取失败即客户端已断开
+	go func() {
+		defer cancel()
+		conn.SetReadLimit(512)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	interval, eventLimit := userApi.statusStreamSettings()
+	userApi.logger.Info("管理端状态推送已连接: %s，间隔%s", c.ClientIP(), interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var lastEvent *database.DeviceEvent
+	for {
+		var snapshot StatusSnapshot
+		snapshot, lastEvent = userApi.statusSnapshot(lastEvent, eventLimit)
+		conn.SetWriteDeadline(time.Now().Add(statusStreamWriteTimeout))
+		if err := conn.WriteJSON(gin.H{"type": "status", "data": snapshot}); err != nil {
+			userApi.logger.Info("管理端状态推送已断开: %s", c.ClientIP())
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			if userApi.statusCtx.Err() != nil {
+				conn.SetWriteDeadline(time.Now().Add(statusStreamWriteTimeout))
+				_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutdown"))
+			}
+			userApi.logger.Info("管理端状态推送已结束: %s", c.ClientIP())
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// statusSnapshot 采集当前状态，返回快照和已推送的最新设备事件；首次推送时带上最近的设备事件
+func (userApi *UserAPI) statusSnapshot(lastEvent *database.DeviceEvent, eventLimit int) (StatusSnapshot, *database.DeviceEvent) {
+	snapshot := StatusSnapshot{
+		Time:     time.Now(),
+		Sessions: userApi.statusSource.GetSessionStats(),
+		Pools:    map[string]map[string]int{},
+		LLMCache: core.LLMCacheStats(),
+		Events:   []*database.DeviceEvent{},
+	}
+	if userApi.poolManager != nil {
+		snapshot.Pools = userApi.poolManager.GetDetailedStats()
+		snapshot.Providers = userApi.poolManager.ProviderHealth()
+	}
+	if snapshot.Providers == nil {
+		snapshot.Providers = []pool.ProviderHealth{}
+	}
+	if eventLimit == 0 {
+		return snapshot, lastEvent
+	}
+
+	query := database.DeviceEventQuery{Limit: eventLimit}
+	if lastEvent != nil {
+		query.Since = &lastEvent.ReportedAt
+	}
+	events, err := userApi.deviceService.ListDeviceEvents(query)
+	if err != nil {
+		userApi.logger.Warn("状态推送查询设备事件失败: %v", err)
+		return snapshot, lastEvent
+	}
+	for _, event := range events {
+		// 与上次推送时间相同的事件按ID去重
+		if lastEvent != nil && event.ID <= lastEvent.ID {
+			continue
+		}
+		snapshot.Events = append(snapshot.Events, event)
+	}
+	if len(snapshot.Events) > 0 {
+		lastEvent = snapshot.Events[0]
+	}
+	return snapshot, lastEvent
+}
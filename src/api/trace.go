@@ -0,0 +1,37 @@
+package api
+
+import (
+	"strconv"
+
+	"ai-server-go/src/core/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TraceIDHeader 链路追踪ID请求/响应头
+const TraceIDHeader = "X-Trace-Id"
+
+// TraceMiddleware 为每个HTTP请求确定链路追踪ID：沿用请求头中的X-Trace-Id，没有时生成新的，
+// 写入响应头并放入请求context，随context传给ASR/TTS等提供者
+func TraceMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		traceID := c.GetHeader(TraceIDHeader)
+		if traceID == "" || len(traceID) > 64 {
+			traceID = utils.NewTraceID()
+		}
+		c.Set("trace_id", traceID)
+		c.Header(TraceIDHeader, traceID)
+		c.Request = c.Request.WithContext(utils.WithRequestInfo(c.Request.Context(), utils.RequestInfo{TraceID: traceID}))
+		c.Next()
+	}
+}
+
+// withDeviceInfo 在请求context中补充设备ID，未指定设备时原样返回
+func withDeviceInfo(c *gin.Context, deviceID uint) {
+	if deviceID == 0 {
+		return
+	}
+	c.Request = c.Request.WithContext(utils.WithRequestInfo(c.Request.Context(), utils.RequestInfo{
+		DeviceID: strconv.FormatUint(uint64(deviceID), 10),
+	}))
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"ai-server-go/src/core/providers/tts"
+	"ai-server-go/src/core/utils"
+	"ai-server-go/src/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultSynthesizeMaxTextLength 语音合成接口默认最大文本长度（字符），可通过系统配置 tts_synthesize/max_text_length 调整
+const defaultSynthesizeMaxTextLength = 500
+
+// SynthesizeRequest 语音合成请求
+type SynthesizeRequest struct {
+	Text     string `json:"text" binding:"required"`
+	Provider string `json:"provider"`  // TTS提供商名称，为空时按设备/用户绑定和系统默认选择
+	Voice    string `json:"voice"`     // 音色，为空时使用提供商配置
+	DeviceID uint   `json:"device_id"` // 可选，用于选择设备绑定的提供商和记录使用统计
+}
+
+// SynthesizeSpeech 合成语音并直接返回音频文件，用于试听音色和验证TTS配置
+// POST /api/tts/synthesize
+func (userApi *UserAPI) SynthesizeSpeech(c *gin.Context) {
+	var req SynthesizeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	text := strings.TrimSpace(utils.RemoveAllEmoji(req.Text))
+	if text == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "合成文本不能为空"})
+		return
+	}
+	maxLength := defaultSynthesizeMaxTextLength
+	if value, err := userApi.configService.GetSystemConfigInt("tts_synthesize", "max_text_length"); err == nil && value > 0 {
+		maxLength = value
+	}
+	textLength := utf8.RuneCountInString(text)
+	if textLength > maxLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("文本长度超过限制，最多%d个字符", maxLength)})
+		return
+	}
+
+	var userID *uint
+	if value, exists := c.Get("user_id"); exists {
+		if id, ok := value.(uint); ok {
+			userID = &id
+		}
+	}
+
+	providerConfig, err := userApi.resolveRequestProvider("TTS", req.Provider, req.DeviceID, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	config, err := newSynthesizeConfig(providerConfig, req.Voice)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 与设备对话使用相同的快速回复缓存，命中时不再调用提供商
+	cache := utils.NewQuickReplyCache(config.Type, config.Voice)
+	if cachedFile := cache.FindCachedAudio(text); cachedFile != "" {
+		userApi.logger.Info("语音合成命中缓存: %s", cachedFile)
+		c.Header("X-TTS-Cache", "hit")
+		userApi.sendSynthesizedAudio(c, cachedFile)
+		return
+	}
+
+	deleteAudio, err := userApi.configService.GetSystemConfigBool("audio", "delete_audio")
+	if err != nil {
+		deleteAudio = true
+	}
+	provider, err := tts.Create(config.Type, config, deleteAudio, userApi.logger)
+	if err != nil {
+		userApi.logger.Error("创建TTS提供者失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建TTS提供者失败"})
+		return
+	}
+	defer provider.Cleanup()
+
+	start := time.Now()
+	withDeviceInfo(c, req.DeviceID)
+	audioFile, err := provider.ToTTS(c.Request.Context(), text)
+	elapsed := time.Since(start)
+
+	usage := database.UsageAmount{TTSChars: textLength}
+	cost := database.EstimateCost(providerConfig, usage)
+	if recordErr := userApi.deviceService.RecordUsage(userID, req.DeviceID, "tts", usage, cost, err == nil, elapsed); recordErr != nil {
+		userApi.logger.Error("记录语音合成使用统计失败: %v", recordErr)
+	}
+	c.Header(database.EstimatedCostHeader, database.FormatCost(cost))
+
+	if err != nil {
+		userApi.logger.Error("语音合成失败(provider=%s): %v", providerConfig.Name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("语音合成失败: %v", err)})
+		return
+	}
+
+	quickReplyWords, _ := userApi.configService.GetSystemConfigArray("audio", "quick_reply_words")
+	if utils.IsQuickReplyHit(text, quickReplyWords) {
+		if err := cache.SaveCachedAudio(text, audioFile); err != nil {
+			userApi.logger.Error("保存快速回复音频失败: %v", err)
+		}
+	}
+
+	c.Header("X-TTS-Cache", "miss")
+	userApi.sendSynthesizedAudio(c, audioFile)
+
+	// 返回后按 audio/delete_audio 配置删除生成的临时文件
+	if deleteAudio {
+		if err := os.Remove(audioFile); err != nil {
+			userApi.logger.Error("删除合成音频文件失败: %v", err)
+		}
+	}
+}
+
+// newSynthesizeConfig 根据提供商配置构造TTS配置，voice不为空时覆盖提供商的音色
+func newSynthesizeConfig(providerConfig *database.ProviderConfig, voice string) (*tts.Config, error) {
+	props, err := providerConfig.PropsMap()
+	if err != nil {
+		return nil, err
+	}
+	if voice != "" {
+		props["voice"] = voice
+	}
+	config := &tts.Config{
+		Type:  providerConfig.Type,
+		Props: props,
+	}
+	if value, ok := props["voice"].(string); ok {
+		config.Voice = value
+	}
+	return config, nil
+}
+
+// sendSynthesizedAudio 以附件形式返回合成的音频文件
+func (userApi *UserAPI) sendSynthesizedAudio(c *gin.Context, audioFile string) {
+	contentType := mime.TypeByExtension(filepath.Ext(audioFile))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Type", contentType)
+	c.FileAttachment(audioFile, filepath.Base(audioFile))
+}
@@ -1,10 +1,14 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"ai-server-go/src/core/auth"
 	"ai-server-go/src/core/pool"
@@ -22,6 +26,15 @@ type UserAPI struct {
 	authMiddleware *auth.AuthMiddleware
 	logger         *utils.Logger
 	poolManager    *pool.PoolManager
+	imageStore     *database.ImageStore // 设备上传图片的存储
+
+	audioCaptureStore *database.AudioCaptureStore // 调试音频采集的存储
+	chatDataPurger    *database.ChatDataPurger    // 用户聊天数据清除
+	memoryService     *database.ChatMemoryService // 会话导出和命名
+	sessionOverrider  SessionOverrider            // 活跃会话的provider覆盖
+
+	statusCtx    context.Context // 服务生命周期，取消时结束实时状态推送
+	statusSource StatusSource    // 实时状态推送的会话统计来源
 }
 
 // NewUserAPI 创建用户管理API
@@ -43,6 +56,34 @@ func NewUserAPI(
 	}
 }
 
+// MaintenanceGuard 维护模式中间件：非管理员的写操作返回503，只读接口和登录/登出不受影响
+func (userApi *UserAPI) MaintenanceGuard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+
+		status := userApi.configService.GetMaintenanceStatus()
+		if !status.Enabled || strings.HasSuffix(c.FullPath(), "/auth/login") || strings.HasSuffix(c.FullPath(), "/auth/logout") {
+			c.Next()
+			return
+		}
+
+		if userApi.authMiddleware.IsAdminRequest(c) {
+			c.Next()
+			return
+		}
+
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":       status.Message,
+			"maintenance": true,
+		})
+		c.Abort()
+	}
+}
+
 // RegisterRoutes 注册路由
 func (userApi *UserAPI) RegisterRoutes(r gin.IRouter) {
 	// 认证相关路由
@@ -73,12 +114,28 @@ func (userApi *UserAPI) RegisterRoutes(r gin.IRouter) {
 		users.GET("/:id/devices", userApi.GetUserDevices)
 		users.POST("/:id/devices", userApi.BindUserDevice)
 		users.DELETE("/:id/devices/:deviceUUID", userApi.UnbindUserDevice)
+		users.PUT("/:id/device-limit", userApi.authMiddleware.AdminRequired(), userApi.SetUserDeviceLimit)
 
 		// 用户AI能力管理
 		users.GET("/:id/capabilities", userApi.GetUserCapabilities)
 		users.POST("/:id/capabilities", userApi.SetUserCapability)
 		users.DELETE("/:id/capabilities/:capabilityName/:capabilityType", userApi.RemoveUserCapability)
 
+		// 用户自带的provider凭证（本人或管理员）
+		users.GET("/:id/provider-credentials", userApi.ListProviderCredentials)
+		users.PUT("/:id/provider-credentials/:category/:name", userApi.SaveProviderCredential)
+		users.DELETE("/:id/provider-credentials/:category/:name", userApi.DeleteProviderCredential)
+
+		// 一次设置用户各类别的默认provider（本人或管理员）
+		users.PUT("/:id/providers", userApi.SetUserProviders)
+
+		// 用户存储的图片：列表只返回元数据，可一次清除全部（本人或管理员）
+		users.GET("/:id/images", userApi.ListUserImages)
+		users.DELETE("/:id/images", userApi.PurgeUserImages)
+
+		// 清除用户的全部聊天数据（会话、消息、记忆、图片和采集的音频），本人或管理员
+		users.DELETE("/:id/chat-data", userApi.PurgeUserChatData)
+
 		// Provider绑定API
 		users.POST("/provider/bind", userApi.authMiddleware.AuthRequired(), userApi.BindUserProvider)
 		users.POST("/provider/unbind", userApi.authMiddleware.AuthRequired(), userApi.UnbindUserProvider)
@@ -89,6 +146,9 @@ func (userApi *UserAPI) RegisterRoutes(r gin.IRouter) {
 		})
 	}
 
+	// 会话导出和命名（会话所属用户、绑定设备的用户或管理员）
+	userApi.registerSessionRoutes(r)
+
 	// 设备管理路由
 	devices := r.Group("/devices")
 	devices.Use(userApi.authMiddleware.AuthRequired(), userApi.authMiddleware.AdminRequired())
@@ -108,6 +168,26 @@ func (userApi *UserAPI) RegisterRoutes(r gin.IRouter) {
 		// 设备AI能力配置（带回退逻辑）
 		devices.GET("/:id/capabilities/with-fallback", userApi.GetDeviceCapabilitiesWithFallback)
 
+		// 设备上报的遥测/错误事件
+		devices.GET("/events", userApi.ListDeviceEvents)
+		devices.GET("/:id/events", userApi.GetDeviceEvents)
+
+		// 设备配置导出/导入
+		devices.GET("/:id/export", userApi.ExportDeviceConfig)
+		devices.POST("/:id/import", userApi.ImportDeviceConfig)
+
+		// 合并重复设备
+		devices.POST("/merge", userApi.MergeDevices)
+
+		// 调试音频采集（需在设备audio_capture能力中开启并确认同意）
+		devices.GET("/:id/audio-captures", userApi.ListAudioCaptures)
+		devices.GET("/:id/audio-captures/:key", userApi.GetAudioCapture)
+		devices.DELETE("/:id/audio-captures", userApi.PurgeAudioCaptures)
+
+		// 使用示例音频测试设备生效的ASR→LLM→TTS链路
+		devices.POST("/:id/pipeline-test", userApi.TestDevicePipeline)
+		devices.GET("/pipeline-test/audio/:name", userApi.GetPipelineTestAudio)
+
 		// Provider绑定API
 		devices.POST("/provider/bind", userApi.authMiddleware.AuthRequired(), userApi.BindDeviceProvider)
 		devices.POST("/provider/unbind", userApi.authMiddleware.AuthRequired(), userApi.UnbindDeviceProvider)
@@ -127,6 +207,12 @@ func (userApi *UserAPI) RegisterRoutes(r gin.IRouter) {
 		capabilities.GET("/defaults", userApi.GetDefaultCapabilities)
 		capabilities.POST("/defaults", userApi.SetDefaultCapability)
 		capabilities.DELETE("/defaults/:capabilityName", userApi.RemoveDefaultCapability)
+
+		// 能力兼容性规则管理
+		capabilities.GET("/compatibility", userApi.ListCapabilityCompatibility)
+		capabilities.POST("/compatibility", userApi.CreateCapabilityCompatibility)
+		capabilities.PUT("/compatibility/:id", userApi.UpdateCapabilityCompatibility)
+		capabilities.DELETE("/compatibility/:id", userApi.DeleteCapabilityCompatibility)
 	}
 
 	// 系统配置管理路由（仅管理员）
@@ -142,17 +228,120 @@ func (userApi *UserAPI) RegisterRoutes(r gin.IRouter) {
 
 		// Provider配置管理API
 		configs.GET("/provider", userApi.ListProviderConfigs)
+		configs.GET("/provider/needs-configuration", userApi.ListUnconfiguredProviders)
 		configs.GET("/provider/:category/:name", userApi.GetProviderConfig)
 		configs.POST("/provider", userApi.CreateProviderConfig)
 		configs.PUT("/provider/:category/:name", userApi.UpdateProviderConfig)
+		configs.PATCH("/provider/:id", userApi.PatchProviderConfig)
 		configs.DELETE("/provider/:category/:name", userApi.DeleteProviderConfig)
 
 		// 灰度发布管理API
 		configs.GET("/provider/:category/:name/versions", userApi.ListProviderVersions)
 		configs.GET("/provider/:category/:name/grayscale", userApi.GetGrayscaleStatus)
 		configs.PUT("/provider/:category/:name/weight", userApi.UpdateProviderWeight)
+		configs.POST("/provider/:category/:name/ramp", userApi.RampProviderVersion)
+		configs.POST("/provider/:category/:name/reenable", userApi.ReenableProviderVersion)
+		configs.GET("/provider/:category/:name/audits", userApi.ListProviderAudits)
 		configs.PUT("/provider/:category/:name/default", userApi.SetDefaultProviderVersion)
 		configs.POST("/provider/:category/:name/refresh", userApi.RefreshGrayscaleConfig)
+		configs.POST("/provider/refresh-all", userApi.RefreshAllGrayscaleConfigs)
+
+		// 功能开关
+		configs.GET("/feature-flags", userApi.ListFeatureFlags)
+		configs.PUT("/feature-flags/:name", userApi.UpdateFeatureFlag)
+
+		// LLM模型允许/禁止策略
+		configs.GET("/model-policies", userApi.ListModelPolicies)
+		configs.POST("/model-policies", userApi.CreateModelPolicy)
+		configs.PUT("/model-policies/:id", userApi.UpdateModelPolicy)
+		configs.DELETE("/model-policies/:id", userApi.DeleteModelPolicy)
+	}
+
+	// Provider类型的Props参数说明（仅管理员）
+	providers := r.Group("/providers")
+	providers.Use(userApi.authMiddleware.AuthRequired(), userApi.authMiddleware.AdminRequired())
+	{
+		providers.GET("/types/:category/:type/schema", userApi.GetProviderTypeSchema)
+	}
+
+	// 首次部署引导（仅管理员）
+	setup := r.Group("/setup")
+	setup.Use(userApi.authMiddleware.AuthRequired(), userApi.authMiddleware.AdminRequired())
+	{
+		setup.GET("/status", userApi.GetSetupStatus)
+		setup.POST("/complete", userApi.CompleteSetup)
+	}
+
+	// 远程调试：按设备/会话实时推送日志（仅管理员）
+	debug := r.Group("/debug")
+	debug.Use(userApi.authMiddleware.AuthRequired(), userApi.authMiddleware.AdminRequired())
+	{
+		debug.GET("/logs/stream", userApi.StreamLogs)
+	}
+
+	// 人设管理路由：人设的增删改仅管理员，分配对普通用户开放（限自己和自己拥有的设备）
+	personas := r.Group("/personas")
+	personas.Use(userApi.authMiddleware.AuthRequired())
+	{
+		personas.GET("", userApi.ListPersonas)
+		personas.POST("", userApi.authMiddleware.AdminRequired(), userApi.CreatePersona)
+		personas.PUT("/:id", userApi.authMiddleware.AdminRequired(), userApi.UpdatePersona)
+		personas.DELETE("/:id", userApi.authMiddleware.AdminRequired(), userApi.DeletePersona)
+		personas.GET("/assignments", userApi.authMiddleware.AdminRequired(), userApi.ListPersonaAssignments)
+		personas.PUT("/assignments", userApi.AssignPersona)
+		personas.DELETE("/assignments/:targetType/:targetID", userApi.UnassignPersona)
+	}
+
+	// 图片内容读取：图片所属用户、设备绑定用户或管理员
+	images := r.Group("/images")
+	images.Use(userApi.authMiddleware.AuthRequired())
+	{
+		images.GET("/:key", userApi.GetStoredImage)
+	}
+
+	// 语音识别路由
+	asrGroup := r.Group("/asr")
+	asrGroup.Use(userApi.authMiddleware.AuthRequired())
+	{
+		asrGroup.POST("/transcribe", userApi.TranscribeAudio)
+	}
+
+	// 语音合成路由
+	ttsGroup := r.Group("/tts")
+	ttsGroup.Use(userApi.authMiddleware.AuthRequired())
+	{
+		ttsGroup.POST("/synthesize", userApi.SynthesizeSpeech)
+	}
+
+	// 模拟登录路由：签发需要管理员权限，退出使用模拟登录令牌本身
+	admin := r.Group("/admin")
+	admin.Use(userApi.authMiddleware.AuthRequired())
+	{
+		admin.POST("/impersonate/:userID", userApi.authMiddleware.AdminRequired(), userApi.authMiddleware.Impersonate)
+		admin.DELETE("/impersonate", userApi.authMiddleware.ExitImpersonation)
+		admin.GET("/impersonation/audits", userApi.authMiddleware.AdminRequired(), userApi.ListImpersonationAudits)
+		admin.GET("/chat-data-purges", userApi.authMiddleware.AdminRequired(), userApi.ListChatDataPurgeAudits)
+
+		// 会话级provider覆盖：只作用于正在进行的会话，会话结束时自动清除
+		admin.GET("/sessions/:sessionID/provider-overrides", userApi.authMiddleware.AdminRequired(), userApi.GetSessionProviderOverrides)
+		admin.PUT("/sessions/:sessionID/provider-overrides", userApi.authMiddleware.AdminRequired(), userApi.SetSessionProviderOverride)
+		admin.DELETE("/sessions/:sessionID/provider-overrides", userApi.authMiddleware.AdminRequired(), userApi.ClearSessionProviderOverride)
+		admin.DELETE("/sessions/:sessionID/provider-overrides/:category", userApi.authMiddleware.AdminRequired(), userApi.ClearSessionProviderOverride)
+
+		// 会话摘要：会话结束时记录的轮次、各阶段耗时、provider、错误数和估算费用
+		admin.GET("/sessions/:sessionID/summary", userApi.authMiddleware.AdminRequired(), userApi.GetSessionSummary)
+		admin.GET("/session-summaries", userApi.authMiddleware.AdminRequired(), userApi.ListSessionSummaries)
+	}
+
+	// 管理端实时状态推送（WebSocket），鉴权在升级前的握手中完成
+	r.GET("/admin/status/stream", StatusStreamToken(), userApi.authMiddleware.AuthRequired(), userApi.authMiddleware.AdminRequired(), userApi.StreamStatus)
+
+	// 资源池管理路由（仅管理员）
+	pools := r.Group("/pool")
+	pools.Use(userApi.authMiddleware.AuthRequired(), userApi.authMiddleware.AdminRequired())
+	{
+		pools.GET("/status", userApi.GetPoolStatus)
+		pools.POST("/evict", userApi.EvictPoolProvider)
 	}
 
 	// Provider列表只读接口，普通用户可访问
@@ -165,16 +354,14 @@ func (userApi *UserAPI) RegisterRoutes(r gin.IRouter) {
 // ListUsers 获取用户列表
 func (userApi *UserAPI) ListUsers(c *gin.Context) {
 	// 获取查询参数
-	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	page, ok := bindPagination(c, loadListPagination(userApi.configService))
+	if !ok {
+		return
+	}
 	status := c.Query("status")
 	role := c.Query("role")
 
-	if limit > 100 {
-		limit = 100
-	}
-
-	users, err := userApi.userService.ListUsers(offset, limit, status, role)
+	users, err := userApi.userService.ListUsers(page.Offset, page.Limit, status, role)
 	if err != nil {
 		userApi.logger.Error("获取用户列表失败: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -189,8 +376,8 @@ func (userApi *UserAPI) ListUsers(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"data": users,
 		"pagination": gin.H{
-			"offset": offset,
-			"limit":  limit,
+			"offset": page.Offset,
+			"limit":  page.Limit,
 			"total":  len(users),
 		},
 	})
@@ -200,9 +387,7 @@ func (userApi *UserAPI) ListUsers(c *gin.Context) {
 func (userApi *UserAPI) CreateUser(c *gin.Context) {
 	var req database.RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "请求参数错误",
-		})
+		respondBindError(c, err)
 		return
 	}
 
@@ -290,9 +475,7 @@ func (userApi *UserAPI) UpdateUser(c *gin.Context) {
 
 	var req database.User
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "请求参数错误",
-		})
+		respondBindError(c, err)
 		return
 	}
 
@@ -363,9 +546,7 @@ func (userApi *UserAPI) UpdatePassword(c *gin.Context) {
 		NewPassword string `json:"new_password" binding:"required,min=6"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "请求参数错误",
-		})
+		respondBindError(c, err)
 		return
 	}
 
@@ -504,13 +685,20 @@ func (userApi *UserAPI) BindUserDevice(c *gin.Context) {
 
 	var req database.UserDeviceRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "请求参数错误",
-		})
+		respondBindError(c, err)
 		return
 	}
 
 	err := userApi.userService.BindUserDevice(uint(userID), req.DeviceUUID, req.DeviceAlias, req.IsOwner, req.Permissions)
+	var limitErr *database.DeviceLimitError
+	if errors.As(err, &limitErr) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": limitErr.Error(),
+			"limit": limitErr.Limit,
+			"bound": limitErr.Bound,
+		})
+		return
+	}
 	if err != nil {
 		userApi.logger.Error("绑定用户设备失败: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -524,6 +712,47 @@ func (userApi *UserAPI) BindUserDevice(c *gin.Context) {
 	})
 }
 
+// SetUserDeviceLimit 管理员设置用户的绑定设备上限，max_devices 为null时恢复按角色和系统配置
+func (userApi *UserAPI) SetUserDeviceLimit(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	var req struct {
+		MaxDevices *int `json:"max_devices"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if req.MaxDevices != nil && *req.MaxDevices < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "绑定设备上限不能为负数"})
+		return
+	}
+
+	if err := userApi.userService.SetUserDeviceLimit(uint(userID), req.MaxDevices); err != nil {
+		userApi.logger.Error("设置绑定设备上限失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "设置绑定设备上限失败: " + err.Error()})
+		return
+	}
+	user, err := userApi.userService.GetUserByID(uint(userID))
+	if err != nil || user == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户信息失败"})
+		return
+	}
+	bound, _ := userApi.userService.CountActiveUserDevices(user.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"max_devices":     user.MaxDevices,
+			"effective_limit": userApi.userService.DeviceLimit(user),
+			"bound":           bound,
+		},
+	})
+}
+
 // UnbindUserDevice 解绑用户设备
 func (userApi *UserAPI) UnbindUserDevice(c *gin.Context) {
 	userID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
@@ -579,9 +808,7 @@ func (userApi *UserAPI) SetUserCapability(c *gin.Context) {
 
 	var req database.UserCapabilityRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "请求参数错误",
-		})
+		respondBindError(c, err)
 		return
 	}
 
@@ -640,6 +867,7 @@ func (userApi *UserAPI) RemoveUserCapability(c *gin.Context) {
 		})
 		return
 	}
+	database.InvalidateUserCapabilityCache(uint(userID))
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "AI能力移除成功",
@@ -648,16 +876,14 @@ func (userApi *UserAPI) RemoveUserCapability(c *gin.Context) {
 
 // ListDevices 获取设备列表
 func (userApi *UserAPI) ListDevices(c *gin.Context) {
-	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	page, ok := bindPagination(c, loadListPagination(userApi.configService))
+	if !ok {
+		return
+	}
 	status := c.Query("status")
 	oui := c.Query("oui")
 
-	if limit > 100 {
-		limit = 100
-	}
-
-	devices, err := userApi.deviceService.ListDevices(offset, limit, status, oui)
+	devices, err := userApi.deviceService.ListDevices(page.Offset, page.Limit, status, oui)
 	if err != nil {
 		userApi.logger.Error("获取设备列表失败: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -669,8 +895,8 @@ func (userApi *UserAPI) ListDevices(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"data": devices,
 		"pagination": gin.H{
-			"offset": offset,
-			"limit":  limit,
+			"offset": page.Offset,
+			"limit":  page.Limit,
 			"total":  len(devices),
 		},
 	})
@@ -680,9 +906,7 @@ func (userApi *UserAPI) ListDevices(c *gin.Context) {
 func (userApi *UserAPI) CreateDevice(c *gin.Context) {
 	var req database.CreateDeviceRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "请求参数错误",
-		})
+		respondBindError(c, err)
 		return
 	}
 
@@ -787,9 +1011,7 @@ func (userApi *UserAPI) UpdateDevice(c *gin.Context) {
 
 	var req database.UpdateDeviceRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "请求参数错误",
-		})
+		respondBindError(c, err)
 		return
 	}
 
@@ -922,9 +1144,7 @@ func (userApi *UserAPI) SetDeviceCapability(c *gin.Context) {
 
 	var req database.DeviceCapabilityRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "请求参数错误",
-		})
+		respondBindError(c, err)
 		return
 	}
 
@@ -1032,9 +1252,209 @@ func (userApi *UserAPI) RemoveDeviceCapability(c *gin.Context) {
 	})
 }
 
+// ExportDeviceConfig 导出设备配置包
+func (userApi *UserAPI) ExportDeviceConfig(c *gin.Context) {
+	deviceUUID := c.Param("id")
+
+	bundle, err := userApi.deviceService.ExportDeviceConfig(deviceUUID)
+	if err != nil {
+		userApi.logger.Error("导出设备配置失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "导出设备配置失败",
+		})
+		return
+	}
+
+	if bundle == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "设备不存在",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": bundle,
+	})
+}
+
+// ImportDeviceConfig 将配置包导入到目标设备
+func (userApi *UserAPI) ImportDeviceConfig(c *gin.Context) {
+	deviceUUID := c.Param("id")
+
+	var bundle database.DeviceConfigBundle
+	if err := c.ShouldBindJSON(&bundle); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	result, err := userApi.deviceService.ImportDeviceConfig(deviceUUID, &bundle)
+	if err != nil {
+		userApi.logger.Error("导入设备配置失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "导入设备配置失败",
+		})
+		return
+	}
+
+	if result == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "设备不存在",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "设备配置导入成功",
+		"data":    result,
+	})
+}
+
+// MergeDevices 将重复的源设备合并到目标设备，返回各表改指向的记录数
+func (userApi *UserAPI) MergeDevices(c *gin.Context) {
+	var req database.MergeDevicesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	source, err := userApi.deviceService.GetDeviceByUUID(req.SourceUUID)
+	if err != nil {
+		userApi.logger.Error("获取设备信息失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "获取设备信息失败",
+		})
+		return
+	}
+	if source == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "源设备不存在",
+		})
+		return
+	}
+
+	target, err := userApi.deviceService.GetDeviceByUUID(req.TargetUUID)
+	if err != nil {
+		userApi.logger.Error("获取设备信息失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "获取设备信息失败",
+		})
+		return
+	}
+	if target == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "目标设备不存在",
+		})
+		return
+	}
+
+	if source.ID == target.ID {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "源设备和目标设备不能相同",
+		})
+		return
+	}
+
+	result, err := userApi.deviceService.MergeDevices(source.ID, target.ID)
+	if err != nil {
+		userApi.logger.Error("合并设备失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "合并设备失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "设备合并成功",
+		"data":    result,
+	})
+}
+
+// ListDeviceEvents 查询最近的设备上报事件（可按设备、会话、级别、类别过滤）
+func (userApi *UserAPI) ListDeviceEvents(c *gin.Context) {
+	query, ok := parseDeviceEventQuery(c)
+	if !ok {
+		return
+	}
+	query.DeviceKey = c.Query("device_key")
+	query.SessionID = c.Query("session_id")
+
+	userApi.respondDeviceEvents(c, query)
+}
+
+// GetDeviceEvents 查询指定设备最近的上报事件
+func (userApi *UserAPI) GetDeviceEvents(c *gin.Context) {
+	deviceUUID := c.Param("id")
+
+	device, err := userApi.deviceService.GetDeviceByUUID(deviceUUID)
+	if err != nil {
+		userApi.logger.Error("获取设备信息失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "获取设备信息失败",
+		})
+		return
+	}
+	if device == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "设备不存在",
+		})
+		return
+	}
+
+	query, ok := parseDeviceEventQuery(c)
+	if !ok {
+		return
+	}
+	query.DeviceID = device.ID
+	query.DeviceKey = device.DeviceUUID
+	query.SessionID = c.Query("session_id")
+
+	userApi.respondDeviceEvents(c, query)
+}
+
+// parseDeviceEventQuery 解析设备事件查询的公共参数
+func parseDeviceEventQuery(c *gin.Context) (database.DeviceEventQuery, bool) {
+	query := database.DeviceEventQuery{
+		Level:    c.Query("level"),
+		Category: c.Query("category"),
+	}
+
+	page, ok := bindPagination(c, RecordPagination)
+	if !ok {
+		return query, false
+	}
+	query.Limit = page.Limit
+
+	if since := c.Query("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的since参数，需为RFC3339格式"})
+			return query, false
+		}
+		query.Since = &t
+	}
+	return query, true
+}
+
+// respondDeviceEvents 查询并返回设备事件
+func (userApi *UserAPI) respondDeviceEvents(c *gin.Context, query database.DeviceEventQuery) {
+	events, err := userApi.deviceService.ListDeviceEvents(query)
+	if err != nil {
+		userApi.logger.Error("查询设备事件失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "查询设备事件失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  events,
+		"total": len(events),
+	})
+}
+
 // GetDeviceCapabilitiesWithFallback 获取设备AI能力配置（带回退逻辑）
 func (userApi *UserAPI) GetDeviceCapabilitiesWithFallback(c *gin.Context) {
-	deviceIDStr := c.Param("deviceID")
+	deviceIDStr := c.Param("id")
 	user, exists := c.Get("user")
 	var userID *uint
 	if exists {
@@ -1113,9 +1533,7 @@ func (userApi *UserAPI) GetCapability(c *gin.Context) {
 func (userApi *UserAPI) CreateCapability(c *gin.Context) {
 	var req database.AICapabilityRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "请求参数错误",
-		})
+		respondBindError(c, err)
 		return
 	}
 
@@ -1162,9 +1580,7 @@ func (userApi *UserAPI) UpdateCapability(c *gin.Context) {
 
 	var req database.AICapabilityRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "请求参数错误",
-		})
+		respondBindError(c, err)
 		return
 	}
 
@@ -1269,7 +1685,7 @@ func (userApi *UserAPI) GetDefaultCapabilities(c *gin.Context) {
 func (userApi *UserAPI) SetDefaultCapability(c *gin.Context) {
 	var req database.DefaultAICapabilityRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		respondBindError(c, err)
 		return
 	}
 	cap, err := userApi.configService.GetAICapability(req.CapabilityName, req.CapabilityType)
@@ -1302,27 +1718,230 @@ func (userApi *UserAPI) RemoveDefaultCapability(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "移除成功"})
 }
 
-// GetUserStats 获取用户统计信息
-func (api *UserAPI) GetUserStats(c *gin.Context) {
-	stats, err := api.userService.GetUserStats()
+// ListCapabilityCompatibility 获取能力兼容性规则列表
+func (userApi *UserAPI) ListCapabilityCompatibility(c *gin.Context) {
+	rules, err := userApi.configService.ListCapabilityCompatibility()
 	if err != nil {
-		api.logger.Error("获取用户统计失败: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "获取用户统计失败",
-		})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取兼容性规则失败: " + err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{
-		"data": stats,
-	})
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": rules})
 }
 
-// ==================== 系统配置管理API ====================
-
-// GetSystemConfigs 获取系统配置列表
-func (api *UserAPI) GetSystemConfigs(c *gin.Context) {
-	// 检查管理员权限
-	if !api.isAdmin(c) {
+// CreateCapabilityCompatibility 创建能力兼容性规则
+func (userApi *UserAPI) CreateCapabilityCompatibility(c *gin.Context) {
+	var req database.CapabilityCompatibility
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	req.ID = 0
+	if err := userApi.configService.SaveCapabilityCompatibility(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "创建兼容性规则失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": req})
+}
+
+// UpdateCapabilityCompatibility 更新能力兼容性规则
+func (userApi *UserAPI) UpdateCapabilityCompatibility(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID格式错误"})
+		return
+	}
+	var req database.CapabilityCompatibility
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	req.ID = uint(id)
+	if err := userApi.configService.SaveCapabilityCompatibility(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "更新兼容性规则失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": req})
+}
+
+// DeleteCapabilityCompatibility 删除能力兼容性规则
+func (userApi *UserAPI) DeleteCapabilityCompatibility(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID格式错误"})
+		return
+	}
+	if err := userApi.configService.DeleteCapabilityCompatibility(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "删除成功"})
+}
+
+// ListFeatureFlags 获取功能开关列表
+func (userApi *UserAPI) ListFeatureFlags(c *gin.Context) {
+	flags, err := userApi.configService.ListFeatureFlags()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取功能开关失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": flags})
+}
+
+// UpdateFeatureFlag 创建或更新功能开关，未传的字段保持原值
+func (userApi *UserAPI) UpdateFeatureFlag(c *gin.Context) {
+	var req struct {
+		Enabled        *bool     `json:"enabled"`
+		RolloutPercent *int      `json:"rollout_percent"`
+		AllowDevices   *[]string `json:"allow_devices"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	name := c.Param("name")
+	flag, err := userApi.configService.GetFeatureFlag(name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取功能开关失败: " + err.Error()})
+		return
+	}
+	if flag == nil {
+		flag = &database.FeatureFlag{Name: name}
+	}
+	if req.Enabled != nil {
+		flag.Enabled = *req.Enabled
+	}
+	if req.RolloutPercent != nil {
+		flag.RolloutPercent = *req.RolloutPercent
+	}
+	if req.AllowDevices != nil {
+		flag.AllowDevices = *req.AllowDevices
+	}
+
+	var operatorID *uint
+	if userID, exists := c.Get("user_id"); exists {
+		if id, ok := userID.(uint); ok {
+			operatorID = &id
+		}
+	}
+	if err := userApi.configService.SetFeatureFlag(*flag, operatorID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "更新功能开关失败: " + err.Error()})
+		return
+	}
+	userApi.logger.Info("功能开关已更新: %s enabled=%t rollout=%d%%", name, flag.Enabled, flag.RolloutPercent)
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": flag})
+}
+
+// ListModelPolicies 获取模型策略列表
+func (userApi *UserAPI) ListModelPolicies(c *gin.Context) {
+	policies, err := userApi.configService.ListModelPolicies()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取模型策略失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": policies})
+}
+
+// CreateModelPolicy 创建模型策略
+func (userApi *UserAPI) CreateModelPolicy(c *gin.Context) {
+	var req database.ModelPolicy
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	req.ID = 0
+	if err := userApi.configService.SaveModelPolicy(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "创建模型策略失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": req})
+}
+
+// UpdateModelPolicy 更新模型策略
+func (userApi *UserAPI) UpdateModelPolicy(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID格式错误"})
+		return
+	}
+	var req database.ModelPolicy
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	req.ID = uint(id)
+	if err := userApi.configService.SaveModelPolicy(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "更新模型策略失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": req})
+}
+
+// DeleteModelPolicy 删除模型策略
+func (userApi *UserAPI) DeleteModelPolicy(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID格式错误"})
+		return
+	}
+	if err := userApi.configService.DeleteModelPolicy(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "删除成功"})
+}
+
+// ListImpersonationAudits 查询模拟登录审计记录
+func (userApi *UserAPI) ListImpersonationAudits(c *gin.Context) {
+	page, ok := bindPagination(c, RecordPagination)
+	if !ok {
+		return
+	}
+	adminID, _ := strconv.ParseUint(c.Query("admin_id"), 10, 32)
+	userID, _ := strconv.ParseUint(c.Query("user_id"), 10, 32)
+
+	audits, total, err := userApi.userService.ListImpersonationAudits(uint(adminID), uint(userID), page.Offset, page.Limit)
+	if err != nil {
+		userApi.logger.Error("查询模拟登录审计记录失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "查询模拟登录审计记录失败",
+		})
+		return
+	}
+	if audits == nil {
+		audits = []*database.ImpersonationAudit{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data": audits,
+		"pagination": gin.H{
+			"offset": page.Offset,
+			"limit":  page.Limit,
+			"total":  total,
+		},
+	})
+}
+
+// GetUserStats 获取用户统计信息
+func (api *UserAPI) GetUserStats(c *gin.Context) {
+	stats, err := api.userService.GetUserStats()
+	if err != nil {
+		api.logger.Error("获取用户统计失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "获取用户统计失败",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data": stats,
+	})
+}
+
+// ==================== 系统配置管理API ====================
+
+// GetSystemConfigs 获取系统配置列表
+func (api *UserAPI) GetSystemConfigs(c *gin.Context) {
+	// 检查管理员权限
+	if !api.isAdmin(c) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "需要管理员权限"})
 		return
 	}
@@ -1387,13 +2006,25 @@ func (api *UserAPI) SetSystemConfig(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("请求参数错误: %v", err)})
+		respondBindError(c, err)
+		return
+	}
+
+	var operatorID *uint
+	if userID, exists := c.Get("user_id"); exists {
+		if id, ok := userID.(uint); ok {
+			operatorID = &id
+		}
+	}
+
+	if err := api.configService.SetSystemConfig(req.Category, req.Key, req.Value, req.ConfigType, req.Description, req.IsDefault, operatorID, operatorID); err != nil {
+		api.logger.Error("设置系统配置失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "设置系统配置失败"})
 		return
 	}
 
-	// TODO: 实现SetSystemConfig
-	c.JSON(http.StatusNotImplemented, gin.H{
-		"error": "功能暂未实现",
+	c.JSON(http.StatusOK, gin.H{
+		"message": "系统配置设置成功",
 	})
 }
 
@@ -1493,6 +2124,16 @@ func (userApi *UserAPI) ListProviderConfigs(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": configs})
 }
 
+// ListUnconfiguredProviders 获取仍需配置（参数为占位符或密钥为空）的提供商列表
+func (userApi *UserAPI) ListUnconfiguredProviders(c *gin.Context) {
+	issues, err := userApi.configService.ListUnconfiguredProviders()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取待配置提供商失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": issues})
+}
+
 // GetProviderConfig 获取单个提供商配置
 func (userApi *UserAPI) GetProviderConfig(c *gin.Context) {
 	idStr := c.Param("id")
@@ -1513,7 +2154,11 @@ func (userApi *UserAPI) GetProviderConfig(c *gin.Context) {
 func (userApi *UserAPI) CreateProviderConfig(c *gin.Context) {
 	var req database.ProviderConfig
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		respondBindError(c, err)
+		return
+	}
+	if err := database.ValidateProviderType(req.Category, req.Type); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 	if err := userApi.configService.CreateProviderConfig(&req); err != nil {
@@ -1533,10 +2178,14 @@ func (userApi *UserAPI) UpdateProviderConfig(c *gin.Context) {
 	}
 	var req database.ProviderConfig
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		respondBindError(c, err)
 		return
 	}
 	req.ID = uint(id)
+	if err := database.ValidateProviderType(req.Category, req.Type); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err := userApi.configService.UpdateProviderConfig(&req); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败: " + err.Error()})
 		return
@@ -1544,6 +2193,30 @@ func (userApi *UserAPI) UpdateProviderConfig(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": req})
 }
 
+// PatchProviderConfig 部分更新提供商配置：只更新请求中出现的字段，props深度合并
+func (userApi *UserAPI) PatchProviderConfig(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID格式错误"})
+		return
+	}
+	var patch map[string]json.RawMessage
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if len(patch) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "没有需要更新的字段"})
+		return
+	}
+	config, err := userApi.configService.PatchProviderConfig(uint(id), patch)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "更新失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": config})
+}
+
 // DeleteProviderConfig 删除提供商配置
 func (userApi *UserAPI) DeleteProviderConfig(c *gin.Context) {
 	idStr := c.Param("id")
@@ -1571,36 +2244,24 @@ func (userApi *UserAPI) ListProviderVersions(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": versions})
 }
 
-// SetDefaultProviderVersion 设置默认提供商版本
+// SetDefaultProviderVersion 设置默认提供商版本，同类别的其他配置取消默认
 func (userApi *UserAPI) SetDefaultProviderVersion(c *gin.Context) {
+	category := c.Param("category")
+	name := c.Param("name")
 	var req struct {
-		Category string `json:"category" binding:"required"`
-		Name     string `json:"name" binding:"required"`
-		Version  string `json:"version" binding:"required"`
+		Version string `json:"version" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		respondBindError(c, err)
 		return
 	}
-	// 先将所有同类置为非默认
-	err := userApi.configService.UpdateProviderConfig(&database.ProviderConfig{
-		Category:  req.Category,
-		Name:      req.Name,
-		IsDefault: false,
-	})
+	found, err := userApi.configService.SetDefaultProviderVersion(category, name, req.Version)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "重置默认失败: " + err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "设置默认失败: " + err.Error()})
 		return
 	}
-	// 再将目标版本置为默认
-	err = userApi.configService.UpdateProviderConfig(&database.ProviderConfig{
-		Category:  req.Category,
-		Name:      req.Name,
-		Version:   req.Version,
-		IsDefault: true,
-	})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "设置默认失败: " + err.Error()})
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "提供商版本不存在"})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "设置成功"})
@@ -1643,7 +2304,7 @@ func (userApi *UserAPI) UpdateProviderWeight(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
@@ -1668,6 +2329,111 @@ func (userApi *UserAPI) UpdateProviderWeight(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "provider权重更新成功"})
 }
 
+// RampProviderVersion 灰度放量：将目标版本调整到指定流量百分比，其余版本按比例分配剩余流量
+func (userApi *UserAPI) RampProviderVersion(c *gin.Context) {
+	category := c.Param("category")
+	name := c.Param("name")
+
+	var req struct {
+		Version string `json:"version" binding:"required"`
+		Percent *int   `json:"percent" binding:"required,min=0,max=100"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	if userApi.poolManager == nil || userApi.poolManager.GetGrayscaleManager() == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "灰度发布管理器未初始化"})
+		return
+	}
+
+	result, err := userApi.poolManager.GetGrayscaleManager().RampVersion(category, name, req.Version, *req.Percent)
+	if err != nil && result == nil {
+		userApi.logger.Error("灰度放量失败: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "灰度放量失败: " + err.Error()})
+		return
+	}
+	if err != nil {
+		userApi.logger.Error("灰度放量后刷新缓存失败: %v", err)
+	}
+
+	var operatorID *uint
+	if userID, exists := c.Get("user_id"); exists {
+		if id, ok := userID.(uint); ok {
+			operatorID = &id
+		}
+	}
+	if err := userApi.configService.RecordProviderAudit(category, name, req.Version, "ramp", operatorID, result); err != nil {
+		userApi.logger.Error("记录灰度放量审计失败: %v", err)
+	}
+	userApi.logger.Info("灰度放量 %s/%s@%s 至 %d%%: %v -> %v", category, name, req.Version, *req.Percent, result.Before, result.After)
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": result})
+}
+
+// ReenableProviderVersion 重新启用被自动回滚的版本，之后可通过放量接口重新分配流量
+func (userApi *UserAPI) ReenableProviderVersion(c *gin.Context) {
+	category := c.Param("category")
+	name := c.Param("name")
+
+	var req struct {
+		Version string `json:"version" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	if userApi.poolManager == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "资源池管理器未初始化"})
+		return
+	}
+	if err := userApi.poolManager.ReenableProviderVersion(category, name, req.Version); err != nil {
+		userApi.logger.Error("重新启用provider版本失败: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "重新启用provider版本失败: " + err.Error()})
+		return
+	}
+
+	var operatorID *uint
+	if userID, exists := c.Get("user_id"); exists {
+		if id, ok := userID.(uint); ok {
+			operatorID = &id
+		}
+	}
+	if err := userApi.configService.RecordProviderAudit(category, name, req.Version, "reenable", operatorID, gin.H{"version": req.Version}); err != nil {
+		userApi.logger.Error("记录重新启用审计失败: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "版本已重新启用，请通过放量接口分配流量"})
+}
+
+// ListProviderAudits 查询Provider的灰度发布审计记录
+func (userApi *UserAPI) ListProviderAudits(c *gin.Context) {
+	page, ok := bindPagination(c, RecordPagination)
+	if !ok {
+		return
+	}
+
+	audits, total, err := userApi.configService.ListProviderAudits(c.Param("category"), c.Param("name"), page.Offset, page.Limit)
+	if err != nil {
+		userApi.logger.Error("查询Provider审计记录失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询Provider审计记录失败"})
+		return
+	}
+	if audits == nil {
+		audits = []*database.ProviderAudit{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data": audits,
+		"pagination": gin.H{
+			"offset": page.Offset,
+			"limit":  page.Limit,
+			"total":  total,
+		},
+	})
+}
+
 // RefreshGrayscaleConfig 刷新灰度配置
 func (userApi *UserAPI) RefreshGrayscaleConfig(c *gin.Context) {
 	category := c.Param("category")
@@ -1694,6 +2460,83 @@ func (userApi *UserAPI) RefreshGrayscaleConfig(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "灰度配置刷新成功"})
 }
 
+// RefreshAllGrayscaleConfigs 重新加载全部灰度配置缓存，用于批量修改数据库或多实例修改配置之后
+func (userApi *UserAPI) RefreshAllGrayscaleConfigs(c *gin.Context) {
+	if userApi.poolManager == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "灰度发布管理器未初始化"})
+		return
+	}
+
+	grayscaleManager := userApi.poolManager.GetGrayscaleManager()
+	if grayscaleManager == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "灰度发布管理器未初始化"})
+		return
+	}
+
+	operator := ""
+	if currentUser, exists := c.Get("user"); exists {
+		operator = currentUser.(*database.User).Username
+	}
+	refreshed, err := grayscaleManager.RefreshAll()
+	if err != nil {
+		userApi.logger.Error("管理员 %s 刷新全部灰度配置，%d 个provider成功，部分失败: %v", operator, refreshed, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "部分灰度配置刷新失败", "refreshed": refreshed})
+		return
+	}
+	userApi.logger.Info("管理员 %s 刷新全部灰度配置，共 %d 个provider", operator, refreshed)
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "灰度配置刷新成功", "data": gin.H{"refreshed": refreshed}})
+}
+
+// GetPoolStatus 获取资源池状态（含并发限制的在途/排队数）
+func (userApi *UserAPI) GetPoolStatus(c *gin.Context) {
+	if userApi.poolManager == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "资源池管理器未初始化"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": userApi.poolManager.GetDetailedStats()})
+}
+
+// EvictPoolProvider 驱逐指定provider在资源池中的实例，下次请求时重新创建；进行中的请求不受影响
+func (userApi *UserAPI) EvictPoolProvider(c *gin.Context) {
+	var req struct {
+		Category string `json:"category" binding:"required"`
+		Name     string `json:"name" binding:"required"`
+		Version  string `json:"version"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	if userApi.poolManager == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "资源池管理器未初始化"})
+		return
+	}
+
+	result, err := userApi.poolManager.EvictProvider(req.Category, req.Name, req.Version)
+	if err != nil {
+		userApi.logger.Error("驱逐资源池实例失败: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "驱逐资源池实例失败: " + err.Error()})
+		return
+	}
+
+	var operatorID *uint
+	if userID, exists := c.Get("user_id"); exists {
+		if id, ok := userID.(uint); ok {
+			operatorID = &id
+		}
+	}
+	if err := userApi.configService.RecordProviderAudit(result.Category, result.Name, result.Version, "evict", operatorID, result); err != nil {
+		userApi.logger.Error("记录资源池驱逐审计失败: %v", err)
+	}
+	userApi.logger.Info("管理员驱逐资源池实例 %s/%s@%s: 空闲实例 %d 个，租户资源池 %d 个",
+		result.Category, result.Name, result.Version, result.Idle, result.TenantPools)
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": result})
+}
+
 // UpdateProfile 更新用户个人资料
 func (userApi *UserAPI) UpdateProfile(c *gin.Context) {
 	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
@@ -1706,9 +2549,7 @@ func (userApi *UserAPI) UpdateProfile(c *gin.Context) {
 
 	var req database.User
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "请求参数错误",
-		})
+		respondBindError(c, err)
 		return
 	}
 
@@ -1766,7 +2607,7 @@ func (userApi *UserAPI) BindUserProvider(c *gin.Context) {
 		Category   string `json:"category" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 	currentUser, exists := c.Get("user")
@@ -1789,7 +2630,7 @@ func (userApi *UserAPI) UnbindUserProvider(c *gin.Context) {
 		Category string `json:"category" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 	currentUser, exists := c.Get("user")
@@ -1805,6 +2646,43 @@ func (userApi *UserAPI) UnbindUserProvider(c *gin.Context) {
 	userApi.configService.UnbindUserProvider(c)
 }
 
+// SetUserProviders 一次设置用户的ASR/TTS/LLM/VLLLM默认provider（仅本人或管理员）
+func (userApi *UserAPI) SetUserProviders(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+	currentUser, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return
+	}
+	user := currentUser.(*database.User)
+	if user.ID != uint(userID) && user.Role != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权限操作他人绑定"})
+		return
+	}
+	var req struct {
+		Providers map[string]string `json:"providers" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if _, err := userApi.userService.GetUserByID(uint(userID)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	bindings, err := userApi.configService.SetUserProviders(uint(userID), req.Providers)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "设置默认provider失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": bindings})
+}
+
 // 设备绑定Provider（仅设备所有者或管理员）
 func (userApi *UserAPI) BindDeviceProvider(c *gin.Context) {
 	var req struct {
@@ -1813,7 +2691,7 @@ func (userApi *UserAPI) BindDeviceProvider(c *gin.Context) {
 		Category   string `json:"category" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 	currentUser, exists := c.Get("user")
@@ -1846,7 +2724,7 @@ func (userApi *UserAPI) UnbindDeviceProvider(c *gin.Context) {
 		Category string `json:"category" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 	currentUser, exists := c.Get("user")
@@ -1871,3 +2749,83 @@ func (userApi *UserAPI) UnbindDeviceProvider(c *gin.Context) {
 	}
 	userApi.configService.UnbindDeviceProvider(c)
 }
+
+// credentialOwnerID 解析凭证所属用户ID，仅本人或管理员可操作
+func (userApi *UserAPI) credentialOwnerID(c *gin.Context) (uint, bool) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return 0, false
+	}
+	currentUser, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
+		return 0, false
+	}
+	user := currentUser.(*database.User)
+	if user.ID != uint(userID) && user.Role != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权限操作他人的凭证"})
+		return 0, false
+	}
+	return uint(userID), true
+}
+
+// ListProviderCredentials 查询用户自带的provider凭证，密钥脱敏返回
+func (userApi *UserAPI) ListProviderCredentials(c *gin.Context) {
+	userID, ok := userApi.credentialOwnerID(c)
+	if !ok {
+		return
+	}
+	credentials, err := userApi.configService.ListProviderCredentials(userID)
+	if err != nil {
+		userApi.logger.Error("查询provider凭证失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询provider凭证失败"})
+		return
+	}
+	redacted := make([]*database.ProviderCredential, 0, len(credentials))
+	for _, credential := range credentials {
+		redacted = append(redacted, credential.Redacted())
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": redacted})
+}
+
+// SaveProviderCredential 保存用户自带的provider凭证，之后该用户设备的新连接使用此凭证
+func (userApi *UserAPI) SaveProviderCredential(c *gin.Context) {
+	userID, ok := userApi.credentialOwnerID(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Props map[string]interface{} `json:"props" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	credential, err := userApi.configService.SaveProviderCredential(userID, c.Param("category"), c.Param("name"), req.Props)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "保存provider凭证失败: " + err.Error()})
+		return
+	}
+	if userApi.poolManager != nil {
+		userApi.poolManager.InvalidateTenantPools(userID)
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": credential.Redacted()})
+}
+
+// DeleteProviderCredential 删除用户自带的provider凭证，之后该用户设备的新连接改用平台凭证
+func (userApi *UserAPI) DeleteProviderCredential(c *gin.Context) {
+	userID, ok := userApi.credentialOwnerID(c)
+	if !ok {
+		return
+	}
+	if err := userApi.configService.DeleteProviderCredential(userID, c.Param("category"), c.Param("name")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "删除provider凭证失败: " + err.Error()})
+		return
+	}
+	if userApi.poolManager != nil {
+		userApi.poolManager.InvalidateTenantPools(userID)
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "provider凭证已删除"})
+}
@@ -12,16 +12,28 @@ type TokenConfig struct {
 	Token string `yaml:"token"`
 }
 
+// WriteBufferConfig 连接的下行写缓冲配置，设备网络慢、消费不过来时用于丢弃低优先级帧或断开连接
+type WriteBufferConfig struct {
+	Size          int      `yaml:"size"`           // 缓冲帧数，默认256
+	HighWatermark int      `yaml:"high_watermark"` // 积压达到该帧数后丢弃低优先级帧，默认为size的3/4
+	StallTimeout  int      `yaml:"stall_timeout"`  // 缓冲已满时等待的秒数，超时则断开连接，默认10
+	LowPriority   []string `yaml:"low_priority"`   // 低优先级的文本消息，格式 type 或 type:state
+}
+
 // Config 主配置结构
 type Config struct {
 	Server struct {
-		IP    string `yaml:"ip"`
-		Port  int    `yaml:"port"`
-		Token string
-		Auth  struct {
+		IP          string `yaml:"ip"`
+		Port        int    `yaml:"port"`
+		Token       string
+		MaxSessions int               `yaml:"max_sessions"` // 单实例最大并发会话数，0表示不限制
+		WriteBuffer WriteBufferConfig `yaml:"write_buffer"` // 每个连接的下行写缓冲
+		Auth        struct {
 			Enabled        bool          `yaml:"enabled"`
 			AllowedDevices []string      `yaml:"allowed_devices"`
 			Tokens         []TokenConfig `yaml:"tokens"`
+			Challenge      string        `yaml:"challenge"`     // 挑战-应答认证: off(默认，仅token), optional(两者均可), required(仅挑战-应答)
+			ChallengeTTL   int           `yaml:"challenge_ttl"` // nonce有效期（秒），默认60
 		} `yaml:"auth"`
 	} `yaml:"server"`
 
@@ -40,8 +52,11 @@ type Config struct {
 		VisionURL string `yaml:"vision"`
 	} `yaml:"web"`
 
-	VAD      map[string]VADConfig `yaml:"VAD"`
-	Database DatabaseConfig       `yaml:"database"`
+	VAD       map[string]VADConfig `yaml:"VAD"`
+	Database  DatabaseConfig       `yaml:"database"`
+	Memory    MemoryConfig         `yaml:"memory"`
+	BlobStore BlobStoreConfig      `yaml:"blob_store"`
+	Providers ProvidersConfig      `yaml:"providers"`
 }
 
 // VADConfig VAD配置结构
@@ -74,11 +89,56 @@ type DatabaseConfig struct {
 	MaxIdleConns    int           `yaml:"max_idle_conns"`    // 最大空闲连接数
 	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"` // 连接最大生命周期
 
+	// 临时故障重试和熔断配置
+	Retry DatabaseRetryConfig `yaml:"retry"`
+
 	// 其他配置
 	ParseTime bool   `yaml:"parse_time"` // 是否解析时间（MySQL专用）
 	Loc       string `yaml:"loc"`        // 时区（MySQL专用）
 }
 
+// DatabaseRetryConfig 数据库临时故障（连接被拒绝、死锁等）的重试和熔断配置，未配置（0）的字段使用默认值
+type DatabaseRetryConfig struct {
+	MaxAttempts      int `yaml:"max_attempts"`      // 遇到临时错误时的最大尝试次数，默认3，1表示不重试
+	BackoffMs        int `yaml:"backoff_ms"`        // 首次重试等待时间（毫秒），之后每次翻倍，默认100
+	BreakerThreshold int `yaml:"breaker_threshold"` // 连续多少次临时错误后熔断，默认5，小于0不熔断
+	BreakerCooldown  int `yaml:"breaker_cooldown"`  // 熔断后多久（秒）再次尝试访问数据库，默认10
+}
+
+// MemoryConfig 长期记忆存储配置
+type MemoryConfig struct {
+	Store   string                 `yaml:"store"`   // 记忆存储后端，默认 sql
+	Options map[string]interface{} `yaml:"options"` // 传给存储后端的参数（如Redis地址）
+	Retry   MemoryRetryConfig      `yaml:"retry"`   // 记忆生成失败的重试配置
+	Cap     MemoryCapConfig        `yaml:"cap"`     // 每台设备的记忆数量上限
+}
+
+// MemoryCapConfig 记忆数量上限配置，未配置（0）的字段使用默认值
+type MemoryCapConfig struct {
+	MaxPerDevice  int `yaml:"max_per_device"` // 每台设备保留的有效记忆数上限，默认500，小于0不限制
+	PinImportance int `yaml:"pin_importance"` // 重要性不低于该值的记忆不会被淘汰，默认8
+	Interval      int `yaml:"interval"`       // 后台整理记忆的间隔（秒），默认600
+}
+
+// MemoryRetryConfig 记忆生成重试配置，未配置（0）的字段使用默认值
+type MemoryRetryConfig struct {
+	MaxAttempts       int `yaml:"max_attempts"`        // 生成记忆时的最大尝试次数，默认3
+	BackoffMs         int `yaml:"backoff_ms"`          // 首次重试等待时间（毫秒），之后每次翻倍，默认500
+	DeadLetterRetries int `yaml:"dead_letter_retries"` // 死信记录由后台任务重新处理的最大次数，超过后标记为failed，默认5
+	WorkerInterval    int `yaml:"worker_interval"`     // 后台任务扫描死信记录的间隔（秒），默认60
+}
+
+// BlobStoreConfig 二进制对象存储配置（设备上传的图片等）
+type BlobStoreConfig struct {
+	Type    string                 `yaml:"type"`    // 存储后端，默认 local（本地文件系统）
+	Options map[string]interface{} `yaml:"options"` // 传给存储后端的参数（如 local 的 dir）
+}
+
+// ProvidersConfig 提供者启动配置
+type ProvidersConfig struct {
+	DefaultFallback string `yaml:"default_fallback"` // ASR/LLM/TTS缺少默认provider时的处理：fail（默认，启动失败）或 auto（选用权重最高的启用provider）
+}
+
 // LoadConfig 从文件加载配置
 func LoadConfig() (*Config, string, error) {
 	path := ".config.yaml"
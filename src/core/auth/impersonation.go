@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"ai-server-go/src/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// impersonationTTL 模拟登录令牌有效期，到期后不能续期，需要管理员重新签发
+const impersonationTTL = 15 * time.Minute
+
+// setAuthContext 将认证信息写入上下文，模拟登录令牌额外标记 impersonating 和 impersonator_id
+func (m *AuthMiddleware) setAuthContext(c *gin.Context, user *database.User, userAuth *database.UserAuth) {
+	c.Set("user", user)
+	c.Set("user_id", user.ID)
+	c.Set("user_role", user.Role)
+	c.Set("userAuth", userAuth)
+	if userAuth.ImpersonatorID != nil {
+		c.Set("impersonating", true)
+		c.Set("impersonator_id", *userAuth.ImpersonatorID)
+	}
+}
+
+// IsImpersonating 当前请求是否使用模拟登录令牌
+func IsImpersonating(c *gin.Context) bool {
+	return c.GetBool("impersonating")
+}
+
+// auditImpersonation 请求处理完成后记录模拟登录期间的操作
+func (m *AuthMiddleware) auditImpersonation(c *gin.Context, userAuth *database.UserAuth) {
+	if userAuth.ImpersonatorID == nil || c.GetBool("impersonation_audited") {
+		return
+	}
+	m.recordImpersonation(c, userAuth, *userAuth.ImpersonatorID, userAuth.UserID, "request")
+}
+
+// recordImpersonation 写入模拟登录审计记录和日志
+func (m *AuthMiddleware) recordImpersonation(c *gin.Context, userAuth *database.UserAuth, adminID, userID uint, action string) {
+	status := c.Writer.Status()
+	m.logger.Info("[模拟登录] 管理员 %d 以用户 %d 身份 %s: %s %s -> %d", adminID, userID, action, c.Request.Method, c.Request.URL.Path, status)
+
+	audit := &database.ImpersonationAudit{
+		AdminID:  adminID,
+		UserID:   userID,
+		AuthID:   userAuth.ID,
+		Action:   action,
+		Method:   c.Request.Method,
+		Path:     c.Request.URL.Path,
+		Status:   status,
+		ClientIP: c.ClientIP(),
+	}
+	if err := m.userService.RecordImpersonationAudit(audit); err != nil {
+		m.logger.Error("%v", err)
+	}
+}
+
+// Impersonate 管理员签发模拟指定用户的短期令牌
+func (m *AuthMiddleware) Impersonate(c *gin.Context) {
+	if IsImpersonating(c) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "模拟登录期间不能再次模拟其他用户",
+		})
+		return
+	}
+	admin, ok := c.MustGet("user").(*database.User)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "用户信息格式错误",
+		})
+		return
+	}
+
+	userID, err := strconv.ParseUint(c.Param("userID"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "用户ID格式错误",
+		})
+		return
+	}
+	target, err := m.userService.GetUserByID(uint(userID))
+	if err != nil {
+		m.logger.Error("获取用户信息失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "获取用户信息失败",
+		})
+		return
+	}
+	if target == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "用户不存在",
+		})
+		return
+	}
+	if target.ID == admin.ID || target.Role == "admin" {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "不能模拟管理员账号",
+		})
+		return
+	}
+
+	userAuth, err := m.userService.CreateImpersonationAuth(admin.ID, target.ID, impersonationTTL)
+	if err != nil {
+		m.logger.Error("签发模拟登录令牌失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "签发模拟登录令牌失败",
+		})
+		return
+	}
+	c.Set("impersonation_audited", true)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "模拟登录成功",
+		"data": gin.H{
+			"token": userAuth.AuthKey,
+			"user": gin.H{
+				"id":       target.ID,
+				"username": target.Username,
+				"nickname": target.Nickname,
+				"role":     target.Role,
+			},
+			"impersonator_id": admin.ID,
+			"expires_at":      userAuth.ExpiresAt,
+			"refreshable":     false,
+		},
+	})
+	m.recordImpersonation(c, userAuth, admin.ID, target.ID, "start")
+}
+
+// ExitImpersonation 退出模拟登录，立即作废当前模拟登录令牌
+func (m *AuthMiddleware) ExitImpersonation(c *gin.Context) {
+	userAuth, ok := c.MustGet("userAuth").(*database.UserAuth)
+	if !ok || userAuth.ImpersonatorID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "当前令牌不是模拟登录令牌",
+		})
+		return
+	}
+
+	if err := m.userService.GetDB().DB.Model(&database.UserAuth{}).Where("id = ?", userAuth.ID).Update("is_active", false).Error; err != nil {
+		m.logger.Error("作废模拟登录令牌失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "退出模拟登录失败",
+		})
+		return
+	}
+	c.Set("impersonation_audited", true)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "已退出模拟登录",
+	})
+	m.recordImpersonation(c, userAuth, *userAuth.ImpersonatorID, userAuth.UserID, "exit")
+}
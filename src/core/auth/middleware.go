@@ -104,11 +104,9 @@ func (m *AuthMiddleware) AuthRequired() gin.HandlerFunc {
 		}
 
 		// 将用户信息存储到上下文中
-		c.Set("user", user)
-		c.Set("user_id", user.ID)
-		c.Set("user_role", user.Role)
-		c.Set("userAuth", userAuth)
+		m.setAuthContext(c, user, userAuth)
 		c.Next()
+		m.auditImpersonation(c, userAuth)
 	}
 }
 
@@ -210,14 +208,34 @@ func (m *AuthMiddleware) OptionalAuth() gin.HandlerFunc {
 		}
 
 		// 将用户信息存储到上下文中
-		c.Set("user", user)
-		c.Set("user_id", user.ID)
-		c.Set("user_role", user.Role)
-		c.Set("userAuth", userAuth)
+		m.setAuthContext(c, user, userAuth)
 		c.Next()
+		m.auditImpersonation(c, userAuth)
 	}
 }
 
+// IsAdminRequest 根据请求中的Token判断调用方是否为管理员（不中断请求）
+func (m *AuthMiddleware) IsAdminRequest(c *gin.Context) bool {
+	if role, exists := c.Get("user_role"); exists {
+		return role == "admin"
+	}
+
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if token == "" {
+		return false
+	}
+
+	userAuth, err := m.userService.GetUserAuthByKey(token)
+	if err != nil || userAuth == nil {
+		return false
+	}
+	user, err := m.userService.GetUserByID(userAuth.UserID)
+	if err != nil || user == nil {
+		return false
+	}
+	return user.Role == "admin"
+}
+
 // Login 用户登录
 func (m *AuthMiddleware) Login(c *gin.Context) {
 	var loginReq database.LoginRequest
@@ -326,17 +344,26 @@ func (m *AuthMiddleware) GetCurrentUser(c *gin.Context) {
 	}
 
 	userObj := user.(*database.User)
+	data := gin.H{
+		"id":         userObj.ID,
+		"username":   userObj.Username,
+		"email":      userObj.Email,
+		"phone":      userObj.Phone,
+		"nickname":   userObj.Nickname,
+		"avatar":     userObj.Avatar,
+		"status":     userObj.Status,
+		"role":       userObj.Role,
+		"created_at": userObj.CreatedAt,
+	}
+	// 模拟登录时标明实际操作的管理员
+	if IsImpersonating(c) {
+		userAuth := c.MustGet("userAuth").(*database.UserAuth)
+		data["impersonation"] = gin.H{
+			"impersonator_id": c.GetUint("impersonator_id"),
+			"expires_at":      userAuth.ExpiresAt,
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{
-		"data": gin.H{
-			"id":         userObj.ID,
-			"username":   userObj.Username,
-			"email":      userObj.Email,
-			"phone":      userObj.Phone,
-			"nickname":   userObj.Nickname,
-			"avatar":     userObj.Avatar,
-			"status":     userObj.Status,
-			"role":       userObj.Role,
-			"created_at": userObj.CreatedAt,
-		},
+		"data": data,
 	})
 }
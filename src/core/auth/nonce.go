@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNonceUnknown nonce不是服务端签发的
+	ErrNonceUnknown = errors.New("未知的nonce")
+	// ErrNonceExpired nonce已过期
+	ErrNonceExpired = errors.New("nonce已过期")
+	// ErrNonceReused nonce在有效期内被重复使用
+	ErrNonceReused = errors.New("nonce已被使用")
+	// ErrDeviceMismatch 认证Key绑定的设备与连接声明的设备不一致
+	ErrDeviceMismatch = errors.New("认证Key不属于当前设备")
+	// ErrSignatureInvalid 签名校验失败
+	ErrSignatureInvalid = errors.New("签名校验失败")
+)
+
+// NonceStore 设备挑战-应答认证的nonce存储：每个nonce只能使用一次，过期或重复使用均被拒绝
+type NonceStore struct {
+	mu     sync.Mutex
+	ttl    time.Duration
+	issued map[string]time.Time // 已签发未使用的nonce -> 过期时间
+	used   map[string]time.Time // 已使用的nonce -> 过期时间（过期后清理）
+}
+
+// NewNonceStore 创建nonce存储
+func NewNonceStore(ttl time.Duration) *NonceStore {
+	return &NonceStore{
+		ttl:    ttl,
+		issued: make(map[string]time.Time),
+		used:   make(map[string]time.Time),
+	}
+}
+
+// TTL nonce有效期
+func (s *NonceStore) TTL() time.Duration {
+	return s.ttl
+}
+
+// Issue 签发一个随机nonce
+func (s *NonceStore) Issue() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	nonce := hex.EncodeToString(buf)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cleanupLocked(time.Now())
+	s.issued[nonce] = time.Now().Add(s.ttl)
+	return nonce, nil
+}
+
+// Consume 校验并消费nonce
+func (s *NonceStore) Consume(nonce string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if _, ok := s.used[nonce]; ok {
+		return ErrNonceReused
+	}
+	expiresAt, ok := s.issued[nonce]
+	if !ok {
+		return ErrNonceUnknown
+	}
+	delete(s.issued, nonce)
+	s.used[nonce] = expiresAt
+	if now.After(expiresAt) {
+		return ErrNonceExpired
+	}
+	return nil
+}
+
+// cleanupLocked 清理过期的nonce
+func (s *NonceStore) cleanupLocked(now time.Time) {
+	for nonce, expiresAt := range s.issued {
+		if now.After(expiresAt) {
+			delete(s.issued, nonce)
+		}
+	}
+	for nonce, expiresAt := range s.used {
+		if now.After(expiresAt) {
+			delete(s.used, nonce)
+		}
+	}
+}
+
+// SignNonce 计算设备对nonce的签名：hex(HMAC-SHA256(secret, nonce + ":" + deviceID))
+func SignNonce(secret, nonce, deviceID string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(nonce + ":" + deviceID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyNonceSignature 常量时间比较签名
+func VerifyNonceSignature(secret, nonce, deviceID, signature string) bool {
+	expected := SignNonce(secret, nonce, deviceID)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// VerifyDeviceChallenge 校验认证Key绑定的设备就是连接声明的设备，再校验对nonce的签名；
+// 否则持有某台设备密钥的人可以冒充任意设备ID
+func VerifyDeviceChallenge(secret string, keyDeviceID uint, deviceID, nonce, signature string) error {
+	claimed, err := strconv.ParseUint(deviceID, 10, 64)
+	if err != nil || keyDeviceID == 0 || uint64(keyDeviceID) != claimed {
+		return ErrDeviceMismatch
+	}
+	if !VerifyNonceSignature(secret, nonce, deviceID, signature) {
+		return ErrSignatureInvalid
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNonceStoreConsumeOnce(t *testing.T) {
+	store := NewNonceStore(time.Minute)
+	nonce, err := store.Issue()
+	if err != nil {
+		t.Fatalf("签发nonce失败: %v", err)
+	}
+	if err := store.Consume(nonce); err != nil {
+		t.Fatalf("首次使用应成功: %v", err)
+	}
+	if err := store.Consume(nonce); !errors.Is(err, ErrNonceReused) {
+		t.Fatalf("重复使用应返回 ErrNonceReused，实际: %v", err)
+	}
+}
+
+func TestNonceStoreUnknown(t *testing.T) {
+	store := NewNonceStore(time.Minute)
+	if err := store.Consume("not-issued"); !errors.Is(err, ErrNonceUnknown) {
+		t.Fatalf("未签发的nonce应返回 ErrNonceUnknown，实际: %v", err)
+	}
+}
+
+func TestNonceStoreExpired(t *testing.T) {
+	store := NewNonceStore(time.Millisecond)
+	nonce, err := store.Issue()
+	if err != nil {
+		t.Fatalf("签发nonce失败: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err := store.Consume(nonce); !errors.Is(err, ErrNonceExpired) {
+		t.Fatalf("过期的nonce应返回 ErrNonceExpired，实际: %v", err)
+	}
+	if err := store.Consume(nonce); !errors.Is(err, ErrNonceReused) {
+		t.Fatalf("过期后再次使用应返回 ErrNonceReused，实际: %v", err)
+	}
+}
+
+func TestVerifyDeviceChallenge(t *testing.T) {
+	const secret, nonce = "device-secret", "abc123"
+	signature := SignNonce(secret, nonce, "42")
+	if err := VerifyDeviceChallenge(secret, 42, "42", nonce, signature); err != nil {
+		t.Fatalf("认证Key属于当前设备且签名正确时应通过: %v", err)
+	}
+	if err := VerifyDeviceChallenge(secret, 42, "42", nonce, "bad"); !errors.Is(err, ErrSignatureInvalid) {
+		t.Fatalf("签名错误应返回 ErrSignatureInvalid，实际: %v", err)
+	}
+}
+
+func TestVerifyDeviceChallengeRejectsOtherDevice(t *testing.T) {
+	// 持有设备42的密钥，为设备7签名
+	const secret, nonce = "device-secret", "abc123"
+	signature := SignNonce(secret, nonce, "7")
+	if err := VerifyDeviceChallenge(secret, 42, "7", nonce, signature); !errors.Is(err, ErrDeviceMismatch) {
+		t.Fatalf("认证Key不属于声明的设备时应返回 ErrDeviceMismatch，实际: %v", err)
+	}
+	if err := VerifyDeviceChallenge(secret, 42, "", nonce, SignNonce(secret, nonce, "")); !errors.Is(err, ErrDeviceMismatch) {
+		t.Fatalf("未声明设备时应返回 ErrDeviceMismatch，实际: %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package chat
+
+import (
+	"ai-server-go/src/core/utils"
+)
+
+// messageOverheadTokens 每条消息的角色/格式开销（估算）
+const messageOverheadTokens = 4
+
+// EstimateMessageTokens 估算一条消息占用的token数
+func EstimateMessageTokens(msg Message) int {
+	tokens := messageOverheadTokens + utils.EstimateTokens(msg.Content)
+	for _, call := range msg.ToolCalls {
+		tokens += utils.EstimateTokens(call.Function.Name) + utils.EstimateTokens(call.Function.Arguments)
+	}
+	return tokens
+}
+
+// EstimateDialogueTokens 估算整段对话占用的token数
+func EstimateDialogueTokens(messages []Message) int {
+	total := 0
+	for _, msg := range messages {
+		total += EstimateMessageTokens(msg)
+	}
+	return total
+}
+
+// TrimToTokenBudget 从最早的非system消息开始裁剪，使对话不超过budget个token。
+// system消息（提示词、记忆）和最后一条消息始终保留；带工具调用的助手消息与其后的tool结果一并裁剪，
+// 避免留下没有对应调用的tool消息。返回裁剪后的对话和被丢弃的消息。
+func TrimToTokenBudget(messages []Message, budget int) ([]Message, []Message) {
+	if budget <= 0 || EstimateDialogueTokens(messages) <= budget {
+		return messages, nil
+	}
+
+	total := EstimateDialogueTokens(messages)
+	drop := make([]bool, len(messages))
+	var dropped []Message
+	for i := 0; i < len(messages)-1 && total > budget; i++ {
+		if messages[i].Role == "system" {
+			continue
+		}
+		drop[i] = true
+		total -= EstimateMessageTokens(messages[i])
+		dropped = append(dropped, messages[i])
+		// 连带丢弃紧随其后的tool结果
+		for i+1 < len(messages)-1 && messages[i+1].Role == "tool" {
+			i++
+			drop[i] = true
+			total -= EstimateMessageTokens(messages[i])
+			dropped = append(dropped, messages[i])
+		}
+	}
+
+	trimmed := make([]Message, 0, len(messages)-len(dropped))
+	for i, msg := range messages {
+		if !drop[i] {
+			trimmed = append(trimmed, msg)
+		}
+	}
+	return trimmed, dropped
+}
+
+// SetContextWindow 设置模型上下文窗口（token数）和为回复预留的token数，window<=0时不裁剪
+func (dm *DialogueManager) SetContextWindow(window, reserve int) {
+	dm.contextWindow = window
+	dm.replyReserve = reserve
+}
+
+// FitContextWindow 发送前检查token预算，超出时裁剪最早的对话轮次并记录被丢弃的内容
+func (dm *DialogueManager) FitContextWindow(messages []Message) []Message {
+	if dm.contextWindow <= 0 {
+		return messages
+	}
+	budget := dm.contextWindow - dm.replyReserve
+	if budget <= 0 {
+		budget = dm.contextWindow
+	}
+
+	before := EstimateDialogueTokens(messages)
+	trimmed, dropped := TrimToTokenBudget(messages, budget)
+	if len(dropped) == 0 {
+		return messages
+	}
+
+	for _, msg := range dropped {
+		dm.logger.Debug("上下文超出预算，丢弃消息 [%s]: %s", msg.Role, msg.Content)
+	}
+	after := EstimateDialogueTokens(trimmed)
+	dm.logger.Warn("对话上下文约 %d tokens 超出预算 %d，已丢弃最早的 %d 条消息，剩余约 %d tokens",
+		before, budget, len(dropped), after)
+	if after > budget {
+		dm.logger.Warn("裁剪后仍超出预算（system消息或最后一条消息过长），继续发送")
+	}
+	return trimmed
+}
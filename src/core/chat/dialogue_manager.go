@@ -20,6 +20,13 @@ type DialogueManager struct {
 	// 记忆相关配置
 	memoryEnabled bool
 	memoryLimit   int
+	// 上下文窗口配置（token数），发送前按预算裁剪
+	contextWindow int
+	replyReserve  int
+	// 消息持久化回调，用于断线重连后恢复上下文
+	recorder func(Message)
+	// 记忆由调用方在每轮对话持久化后生成，Put时不再逐条生成
+	memoryPerTurn bool
 }
 
 // NewDialogueManager 创建对话管理器实例
@@ -65,9 +72,12 @@ func (dm *DialogueManager) SetSystemMessage(systemMessage string) {
 // Put 添加新消息到对话
 func (dm *DialogueManager) Put(message Message) {
 	dm.dialogue = append(dm.dialogue, message)
+	if dm.recorder != nil {
+		dm.recorder(message)
+	}
 	
 	// 如果启用了记忆功能，异步保存记忆
-	if dm.memoryEnabled && dm.memory != nil {
+	if dm.memoryEnabled && dm.memory != nil && !dm.memoryPerTurn {
 		go func() {
 			if err := dm.memory.SaveMemory(dm.dialogue); err != nil {
 				dm.logger.Warn("保存对话记忆失败: %v", err)
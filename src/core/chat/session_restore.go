@@ -0,0 +1,41 @@
+package chat
+
+// SetRecorder 设置消息持久化回调，每次Put新消息时调用
+func (dm *DialogueManager) SetRecorder(recorder func(Message)) {
+	dm.recorder = recorder
+}
+
+// SetMemoryPerTurn 设置记忆是否由调用方按轮次生成，开启后Put新消息时不再触发记忆生成
+func (dm *DialogueManager) SetMemoryPerTurn(enabled bool) {
+	dm.memoryPerTurn = enabled
+}
+
+// MemoryEnabled 是否启用记忆功能
+func (dm *DialogueManager) MemoryEnabled() bool {
+	return dm.memoryEnabled && dm.memory != nil
+}
+
+// Restore 将恢复的历史消息接在当前对话（提示词）之后，按上下文预算丢弃最早的消息，返回保留的历史条数。
+// 恢复的消息不会再次触发持久化和记忆生成。
+func (dm *DialogueManager) Restore(history []Message) int {
+	if len(history) == 0 {
+		return 0
+	}
+	base := len(dm.dialogue)
+	dialogue := append(append(make([]Message, 0, base+len(history)), dm.dialogue...), history...)
+
+	if dm.contextWindow > 0 {
+		budget := dm.contextWindow - dm.replyReserve
+		if budget <= 0 {
+			budget = dm.contextWindow
+		}
+		var dropped []Message
+		dialogue, dropped = TrimToTokenBudget(dialogue, budget)
+		if len(dropped) > 0 {
+			dm.logger.Info("恢复会话历史超出上下文预算，丢弃最早的 %d 条消息", len(dropped))
+		}
+	}
+
+	dm.dialogue = dialogue
+	return len(dialogue) - base
+}
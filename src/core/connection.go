@@ -7,17 +7,21 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"ai-server-go/src/configs"
 	"ai-server-go/src/core/chat"
 	"ai-server-go/src/core/function"
 	"ai-server-go/src/core/image"
+	"ai-server-go/src/core/llmcache"
 	"ai-server-go/src/core/mcp"
+	"ai-server-go/src/core/moderation"
 	"ai-server-go/src/core/pool"
 	"ai-server-go/src/core/providers"
 	"ai-server-go/src/core/providers/asr"
@@ -57,6 +61,16 @@ type configGetter interface {
 	Config() *tts.Config
 }
 
+// llmConfigGetter 获取LLM提供者配置的接口
+type llmConfigGetter interface {
+	Config() *llm.Config
+}
+
+const (
+	defaultContextWindow = 32000 // 未配置context_window时的默认上下文窗口（token）
+	defaultReplyReserve  = 1024  // 未配置max_tokens时为回复预留的token
+)
+
 // ConnectionHandler 连接处理器结构
 type ConnectionHandler struct {
 	// 确保实现 AsrEventListener 接口
@@ -68,18 +82,22 @@ type ConnectionHandler struct {
 	taskMgr          *task.TaskManager
 	safeCallbackFunc func(func(*ConnectionHandler)) func()
 	providers        struct {
+		mu    sync.RWMutex // 会话级覆盖在轮次边界替换provider，读写都需加锁，通过 asrProvider() 等方法读取
 		asr   providers.ASRProvider
 		llm   providers.LLMProvider
 		tts   providers.TTSProvider
 		vlllm *vlllm.Provider // VLLLM提供者，可选
 	}
+	providerSet *pool.ProviderSet // 取自资源池的provider集合，会话覆盖的TTS按其降级链包装，可能为nil
 
 	// 数据库服务
-	dbService     *database.Database
-	configService *database.ConfigService
-	deviceService *database.DeviceService
-	userService   *database.UserService
-	memoryService *database.ChatMemoryService // 添加记忆服务
+	dbService         *database.Database
+	configService     *database.ConfigService
+	deviceService     *database.DeviceService
+	userService       *database.UserService
+	memoryService     *database.ChatMemoryService // 添加记忆服务
+	imageStore        *database.ImageStore        // 设备上传图片的存储，创建失败时为nil
+	audioCaptureStore *database.AudioCaptureStore // 调试音频采集的存储，创建失败时为nil
 
 	// 会话相关
 	sessionID string
@@ -99,26 +117,139 @@ type ConnectionHandler struct {
 	serverAudioChannels      int
 	serverAudioFrameDuration int
 
-	clientListenMode string
+	clientListenMode atomic.Pointer[string] // 客户端拾音模式（auto/manual/realtime），文本消息协程写入，音频协程读取
 	isDeviceVerified bool
+	authNonce        string // 本连接签发的挑战-应答nonce
 	closeAfterChat   bool
 
 	// 语音处理相关
 	clientVoiceStop bool  // true客户端语音停止, 不再上传语音数据
 	serverVoiceStop int32 // 1表示true服务端语音停止, 不再下发语音数据
 
-	opusDecoder *utils.OpusDecoder // Opus解码器
+	opusDecoder atomic.Pointer[utils.OpusDecoder] // Opus解码器，hello消息时创建，音频协程解码，关闭连接时释放
+
+	asrResampler atomic.Pointer[utils.Resampler] // 送入ASR前的重采样器，采样率一致时为nil
+
+	bargeInDetector *BargeInDetector // 播放期间的打断检测器
+	preRollBuffer   *PreRollBuffer   // 语音起点前的音频缓冲，未启用时为nil
+
+	// 内容审核
+	moderationConfig moderation.Config
+	moderator        moderation.Moderator
+	replyModeration  *responseModeration // 正在写入对话历史的回复的审核状态，由 recordDialogueMessage 取用
+
+	imageModerationConfig moderation.ImageConfig    // 图片内容审核配置
+	imageModerator        moderation.ImageModerator // 图片审核器，未启用时为nil
+
+	asrCorrectionConfig ASRCorrectionConfig // ASR纠错配置
+	asrHotwordsConfig   ASRHotwordsConfig   // ASR热词配置
+	asrConfidenceConfig ASRConfidenceConfig // ASR置信度检查配置
+	asrEngineConfig     ASREngineConfig     // 按语言选择ASR引擎的配置
+	asrLanguage         string              // 当前识别语言，用于选择ASR引擎
+
+	llmCacheConfig     llmcache.Config  // LLM回复缓存配置
+	llmCache           *llmcache.Cache  // 进程内共享的LLM回复缓存，未启用时为nil
+	llmCacheBypass     []*regexp.Regexp // 不使用缓存的问题规则
+	pendingLLMCacheKey string           // 本轮未命中的缓存键，回复生成后写入
+
+	proactiveConfig ProactiveConfig // 主动对话配置
+	lastActivity    int64           // 最近一次交互时间（UnixNano），用于主动对话的空闲判断
+
+	greetingConfig GreetingConfig // 开场问候配置
+	greeted        int32          // 是否已安排开场问候，每个连接最多一次
+	sessionResumed bool           // 是否为断线重连恢复的会话
+
+	playbackConfig PlaybackConfig // 播放提示配置（音量、淡入淡出）
+
+	audioQualityConfig AudioQualityConfig      // 输出音频质量配置
+	opusOptions        utils.OpusEncodeOptions // 下发音频的Opus编码参数
+
+	earconConfig EarconConfig // 提示音配置
+	earconRound  int          // 最近一次播放提示音（或快速回复）的对话轮次
+	earconAudio  [][]byte     // 已编码的提示音帧缓存
+	earconFormat string       // earconAudio 对应的音频格式
+
+	audioAckConfig AudioAckConfig   // 音频确认配置
+	audioAck       *audioAckTracker // 音频确认记录，客户端声明支持且配置启用时创建
+
+	textStreamConfig  TextStreamConfig // 流式文本配置
+	textStreamEnabled bool             // 客户端声明支持且配置启用时下发流式文本
+
+	loopbackConfig LoopbackConfig    // 回环测试配置
+	loopbackMode   string            // 当前回环测试模式（echo/tts），为空表示正常对话
+	loopback       *loopbackRecorder // echo 模式的录音状态
+
+	modelPolicyError string // 模型策略拒绝当前模型且没有替代时的原因
+
+	sessionTitleConfig SessionTitleConfig // 会话自动命名配置
+	sessionTitled      int32              // 本连接是否已处理过会话命名（原子操作）
+
+	persona *database.Persona // 会话开始时解析的人设，未分配时为nil
+
+	pipelineTimeoutConfig PipelineTimeoutConfig // 流水线各阶段超时配置
+	asrDeadline           asrDeadlineState      // 等待识别结果的超时状态
+	timeoutApologyRound   int                   // 播报超时致歉语的轮次，该轮次不计算TTS超时
+
+	failureSpeechConfig FailureSpeechConfig // provider失败时的提示语配置
+	failureSpeech       failureSpeechState  // 各类失败提示语的播报记录
+
+	ttsTextFallbackConfig TTSTextFallbackConfig // TTS不可用时降级为纯文本的配置
+	ttsTextOnlyRound      int                   // 已降级为纯文本的对话轮次，仅在TTS任务协程中访问
+
+	intentRoutingConfig IntentRoutingConfig // 设备指令路由配置
+	intents             []compiledIntent    // 预处理后的设备指令规则
+
+	keywordTriggerConfig KeywordTriggerConfig     // 关键词触发配置
+	keywordTriggers      []compiledKeywordTrigger // 预处理后的关键词触发规则
+
+	forgetCommandConfig ForgetCommandConfig // 遗忘指令配置
+	forgetPendingUntil  time.Time           // 遗忘指令等待确认的截止时间，零值表示没有待确认的指令
+
+	imageStorageConfig ImageStorageConfig // 上传图片的存储配置
+
+	audioCaptureConfig AudioCaptureConfig    // 调试音频采集配置
+	audioCapture       *audioCaptureRecorder // 采集缓冲，本连接启用采集时创建
+
+	conversationModeConfig ConversationModeConfig // 对话模式配置
+	conversationMode       atomic.Pointer[string] // 当前对话模式（assistant/translator/dictation）
+
+	providerOverrides providerOverrideState // 管理员设置的会话级provider覆盖
+
+	traceMu    sync.Mutex // 保护 traceRound/traceID
+	traceRound int        // traceID 对应的对话轮次
+	traceID    string     // 当前对话轮次的链路追踪ID
+
+	usage          *usageMeter     // 用量与估算费用累计
+	sessionMetrics *sessionMetrics // 会话摘要的指标累计
+
+	capabilityRoutingConfig CapabilityRoutingConfig // 能力路由配置
+	capabilityRouter        *capabilityRouter       // 能力路由状态，未启用时为空
+
+	verbosityConfig VerbosityConfig // 回复详略配置
+	verbosity       VerbosityLevel  // 当前详略档位的参数
+
+	setupPendingMessage string // 首次部署引导未完成时拒绝对话的提示语，为空表示不拒绝
+
+	promptSampleConfig PromptSampleConfig // 提示词采样配置
+	promptSampleMu     sync.Mutex         // 保护 promptSampleRound/promptSampled
+	promptSampleRound  int                // promptSampled 对应的对话轮次
+	promptSampled      bool               // 该轮次是否被抽中采样
+
+	turnMu sync.Mutex   // 保护 turn
+	turn   *pendingTurn // 尚未结算的本轮消息
 
 	// 对话相关
 	dialogueManager     *chat.DialogueManager
-	tts_last_text_index int
-	client_asr_text     string // 客户端ASR文本
+	tts_last_text_index atomic.Int32 // 最后一段TTS文本的索引，-1表示服务端未在讲话；LLM回复协程写入，音频发送协程读取并清除
+	client_asr_text     string       // 客户端ASR文本
 	quickReplyCache     *utils.QuickReplyCache
 
 	// 并发控制
 	stopChan         chan struct{}
+	coroutines       sync.WaitGroup // Handle 启动的消息处理协程
 	clientAudioQueue chan []byte
 	clientTextQueue  chan string
+	proactiveQueue   chan struct{} // 主动对话请求，与客户端文本消息在同一协程中处理
 
 	// TTS任务队列
 	ttsQueue chan struct {
@@ -138,6 +269,7 @@ type ConnectionHandler struct {
 	roundStartTime time.Time // 轮次开始时间
 	// functions
 	functionRegister *function.FunctionRegistry
+	toolFilter       function.ToolFilter // 按设备能力过滤提供给LLM的工具
 	mcpManager       *mcp.Manager
 
 	mcpResultHandlers map[string]func(interface{}) // MCP处理器映射
@@ -163,18 +295,32 @@ func NewConnectionHandler(
 	var deviceService *database.DeviceService
 	var userService *database.UserService
 	var memoryService *database.ChatMemoryService
+	var imageStore *database.ImageStore
+	var audioCaptureStore *database.AudioCaptureStore
 
 	if dbService != nil {
 		configService = database.NewConfigService(dbService, logger)
 		deviceService = database.NewDeviceService(dbService, logger)
 		userService = database.NewUserService(dbService, logger)
-		memoryService = database.NewChatMemoryService(dbService.GetDB(), logger) // 使用GetDB()获取gorm.DB实例
+		// 按配置文件 memory.store 选择记忆存储后端，创建失败时回退到默认的SQL存储
+		memoryService, err = database.NewChatMemoryServiceWithConfig(dbService.GetDB(), config.Memory, logger)
+		if err != nil {
+			logger.Error("初始化记忆存储失败，使用SQL存储: %v", err)
+			memoryService = database.NewChatMemoryService(dbService.GetDB(), logger)
+		}
+		if imageStore, err = database.NewImageStoreWithConfig(dbService.GetDB(), config.BlobStore, logger); err != nil {
+			logger.Error("初始化图片存储失败，图片不写入对话历史: %v", err)
+		}
+		if audioCaptureStore, err = database.NewAudioCaptureStoreWithConfig(dbService.GetDB(), config.BlobStore, logger); err != nil {
+			logger.Error("初始化音频采集存储失败: %v", err)
+		}
 	}
 
 	// 从请求中提取设备信息
 	deviceID := extractDeviceID(req)
 	clientId := extractClientID(req)
-	sessionID := uuid.New().String()
+	// 断线重连时沿用设备原来的会话
+	sessionID, resumedSession := resolveSession(req, parseUint(deviceID), loadSessionResumeConfig(configService), memoryService, logger)
 
 	// 尝试从请求中提取用户ID（如果有认证）
 	var userID *uint
@@ -185,34 +331,34 @@ func NewConnectionHandler(
 	}
 
 	handler := &ConnectionHandler{
-		config:              config,
-		logger:              logger,
-		conn:                nil,
-		taskMgr:             nil, // 稍后设置
-		safeCallbackFunc:    nil, // 稍后设置
-		dbService:           dbService,
-		configService:       configService,
-		deviceService:       deviceService,
-		userService:         userService,
-		memoryService:       memoryService, // 设置记忆服务
-		sessionID:           sessionID,
-		deviceID:            deviceID,
-		clientId:            clientId,
-		userID:              userID, // 设置用户ID
-		headers:             extractHeaders(req),
-		clientListenMode:    "auto",
-		isDeviceVerified:    false,
-		closeAfterChat:      false,
-		clientVoiceStop:     false,
-		serverVoiceStop:     0,
-		opusDecoder:         nil,
-		dialogueManager:     nil,
-		tts_last_text_index: -1,
-		client_asr_text:     "",
-		quickReplyCache:     nil,
-		stopChan:            make(chan struct{}),
-		clientAudioQueue:    make(chan []byte, 100),
-		clientTextQueue:     make(chan string, 100),
+		config:            config,
+		logger:            logger,
+		conn:              nil,
+		taskMgr:           nil, // 稍后设置
+		safeCallbackFunc:  nil, // 稍后设置
+		dbService:         dbService,
+		configService:     configService,
+		deviceService:     deviceService,
+		userService:       userService,
+		memoryService:     memoryService, // 设置记忆服务
+		imageStore:        imageStore,
+		audioCaptureStore: audioCaptureStore,
+		sessionID:         sessionID,
+		deviceID:          deviceID,
+		clientId:          clientId,
+		userID:            userID, // 设置用户ID
+		headers:           extractHeaders(req),
+		isDeviceVerified:  false,
+		closeAfterChat:    false,
+		clientVoiceStop:   false,
+		serverVoiceStop:   0,
+		dialogueManager:   nil,
+		client_asr_text:   "",
+		quickReplyCache:   nil,
+		stopChan:          make(chan struct{}),
+		clientAudioQueue:  make(chan []byte, 100),
+		clientTextQueue:   make(chan string, 100),
+		proactiveQueue:    make(chan struct{}, 1),
 		ttsQueue: make(chan struct {
 			text      string
 			round     int
@@ -225,6 +371,7 @@ func NewConnectionHandler(
 			textIndex int
 		}, 10),
 		talkRound:         0,
+		ttsTextOnlyRound:  -1,
 		roundStartTime:    time.Now(),
 		functionRegister:  function.NewFunctionRegistry(),
 		mcpManager:        nil,
@@ -232,29 +379,164 @@ func NewConnectionHandler(
 		ctx:               ctx,
 	}
 
+	handler.setLastTextIndex(-1)
+
+	// 设备hello未声明pcm时，服务端下发24kHz单声道、60ms帧的opus音频
+	handler.serverAudioFormat = "opus"
+	handler.serverAudioSampleRate = 24000
+	handler.serverAudioChannels = 1
+	handler.serverAudioFrameDuration = 60
+
+	// 迁移期间兼容静态token认证
+	handler.isDeviceVerified = handler.verifyPlainToken()
+
 	// 尝试根据设备ID获取自定义能力配置
 	if deviceID != "" && configService != nil {
 		handler.initializeDeviceCapabilities(deviceID)
 	}
 
+	// 一次读取系统配置和设备能力配置，供各功能的配置加载共用
+	layered := handler.newLayeredConfigSource()
+
+	// 初始化播放期间的打断检测
+	handler.bargeInDetector = handler.newBargeInDetector(layered)
+
+	// 初始化语音起点前置缓冲（默认关闭）
+	if preRollConfig := handler.loadAudioPreRollConfig(layered); preRollConfig.Enabled {
+		handler.preRollBuffer = NewPreRollBuffer(preRollConfig)
+	}
+
+	// 初始化LLM回复内容审核（默认关闭）
+	handler.initModeration(layered)
+
+	// 初始化图片内容审核（默认关闭）
+	handler.initImageModeration()
+
+	// 初始化LLM回复缓存（默认关闭）
+	handler.initLLMCache(layered)
+
+	// 加载ASR纠错配置（默认关闭）
+	handler.asrCorrectionConfig = handler.loadASRCorrectionConfig(layered)
+
+	// 加载ASR热词配置
+	handler.asrHotwordsConfig = handler.loadASRHotwordsConfig()
+
+	// 加载ASR置信度检查配置（默认关闭）
+	handler.asrConfidenceConfig = handler.loadASRConfidenceConfig(layered)
+
+	// 加载按语言选择ASR引擎的配置（未配置 language_engines 时不切换）
+	handler.asrEngineConfig = handler.loadASREngineConfig()
+	handler.asrLanguage = handler.asrEngineConfig.Language
+
+	// 加载主动对话配置（默认关闭）
+	handler.proactiveConfig = handler.loadProactiveConfig(layered)
+
+	// 加载开场问候配置（默认关闭），恢复的会话不再问候
+	handler.greetingConfig = handler.loadGreetingConfig(layered)
+	handler.sessionResumed = resumedSession != nil
+
+	// 加载播放提示配置（默认关闭）
+	handler.playbackConfig = handler.loadPlaybackConfig(layered)
+
+	// 加载输出音频质量配置（码率、编码复杂度）
+	handler.audioQualityConfig = handler.loadAudioQualityConfig(layered)
+	handler.initAudioQuality()
+
+	// 加载回复详略配置（默认 normal 档位，不改变提示词和回复长度）
+	handler.verbosityConfig = handler.loadVerbosityConfig(layered)
+	handler.initVerbosity()
+
+	// 加载提示词采样配置（默认不采样）
+	handler.promptSampleConfig = handler.loadPromptSampleConfig(layered)
+
+	// 首次部署引导未完成时按配置拒绝对话（在建立连接时检查，完成引导后新连接生效）
+	if handler.configService != nil {
+		handler.setupPendingMessage = handler.configService.SetupPendingMessage()
+	}
+
+	// 加载提示音配置（默认关闭）
+	handler.earconConfig = handler.loadEarconConfig(layered)
+
+	// 加载音频确认配置（默认关闭，客户端hello声明支持后生效）
+	handler.audioAckConfig = handler.loadAudioAckConfig(layered)
+
+	// 加载流式文本配置（客户端hello声明支持后生效）
+	handler.textStreamConfig = handler.loadTextStreamConfig(layered)
+
+	// 加载回环测试配置（设备能力启用或客户端hello声明后生效）
+	handler.loopbackConfig = handler.loadLoopbackConfig(layered)
+
+	// 加载会话自动命名配置
+	handler.sessionTitleConfig = handler.loadSessionTitleConfig(layered)
+
+	// 加载流水线各阶段超时配置
+	handler.pipelineTimeoutConfig = handler.loadPipelineTimeoutConfig(layered)
+
+	// 加载provider失败时的提示语配置
+	handler.failureSpeechConfig = handler.loadFailureSpeechConfig(layered)
+
+	// 加载TTS不可用时降级为纯文本的配置（设备能力启用后生效）
+	handler.ttsTextFallbackConfig = handler.loadTTSTextFallbackConfig(layered)
+
+	// 加载设备指令路由配置（默认关闭）
+	handler.intentRoutingConfig = handler.loadIntentRoutingConfig(layered)
+	handler.intents = handler.compileIntents(handler.intentRoutingConfig.Intents)
+
+	// 加载关键词触发配置（默认关闭）
+	handler.keywordTriggerConfig = handler.loadKeywordTriggerConfig(layered)
+	handler.keywordTriggers = handler.compileKeywordTriggers(handler.keywordTriggerConfig)
+
+	// 加载遗忘指令配置（默认关闭）
+	handler.forgetCommandConfig = handler.loadForgetCommandConfig(layered)
+
+	handler.sessionMetrics = newSessionMetrics()
+
+	// 加载上传图片的存储配置（设备可在image_storage能力中关闭）
+	handler.imageStorageConfig = handler.loadImageStorageConfig(layered)
+
+	// 加载调试音频采集配置，只有管理员在设备能力中开启并确认同意时才采集
+	handler.audioCaptureConfig = handler.loadAudioCaptureConfig(layered)
+	handler.initAudioCapture()
+
+	// 加载对话模式配置，恢复的会话沿用原来的模式
+	handler.conversationModeConfig = handler.loadConversationModeConfig(layered)
+	handler.initConversationMode(resumedSession)
+
+	// 读取各能力的provider单价，用于费用估算
+	handler.initUsageMeter()
+
 	// 如果数据库配置失败或没有设备配置，使用默认的提供者集合
 	if providerSet != nil {
-		handler.providers.asr = providerSet.ASR
-		handler.providers.llm = providerSet.LLM
-		handler.providers.tts = providerSet.TTS
-		handler.providers.vlllm = providerSet.VLLLM
+		handler.providerSet = providerSet
+		handler.storeProvider("ASR", providerSet.ASR)
+		handler.storeProvider("LLM", providerSet.LLM)
+		handler.storeProvider("TTS", providerSet.TTS)
+		handler.storeProvider("VLLLM", providerSet.VLLLM)
 		handler.mcpManager = providerSet.MCP
 	}
 
+	// 按模型策略检查LLM模型，不允许时改用替代模型
+	handler.enforceModelPolicy()
+
+	// 加载能力路由配置（默认关闭），同一类别启用多个能力时按规则逐轮选择
+	handler.capabilityRoutingConfig = handler.loadCapabilityRoutingConfig(layered)
+	handler.initCapabilityRouting()
+
+	// 解析人设并应用其音色和语速（需在创建快速回复缓存之前）
+	handler.loadPersona()
+
 	ttsProvider := "default" // 默认TTS提供者名称
 	voiceName := "default"
-	if getter, ok := handler.providers.tts.(configGetter); ok {
+	if getter, ok := handler.ttsProvider().(configGetter); ok {
 		ttsProvider = getter.Config().Type
 		voiceName = getter.Config().Voice
 	}
 	logger.Info("使用TTS提供者: %s, 语音名称: %s", ttsProvider, voiceName)
 	handler.quickReplyCache = utils.NewQuickReplyCache(ttsProvider, voiceName)
 
+	// 预先合成失败提示语，TTS出错时仍能播报
+	handler.prewarmFailureSpeech()
+
 	// 初始化对话管理器，集成记忆功能
 	var memory chat.MemoryInterface
 	if memoryService != nil {
@@ -266,11 +548,14 @@ func NewConnectionHandler(
 			}
 		}
 
+		// 记忆检索使用独立的EMBEDDING提供者，未配置时保持关键词查询
+		initMemoryEmbedder(configService, memoryService, deviceIDUint, userID, logger)
+
 		// 创建数据库记忆实例
 		memory = chat.NewDatabaseMemory(userID, deviceIDUint, sessionID, memoryService, logger)
 
-		// 创建或获取会话
-		if deviceIDUint > 0 {
+		// 创建会话（恢复的会话已存在）
+		if deviceIDUint > 0 && resumedSession == nil {
 			title := fmt.Sprintf("设备 %s 的对话", deviceID)
 			if _, err := memoryService.CreateSession(userID, deviceIDUint, sessionID, title); err != nil {
 				logger.Warn("创建聊天会话失败: %v", err)
@@ -282,6 +567,7 @@ func NewConnectionHandler(
 	}
 
 	handler.dialogueManager = chat.NewDialogueManager(handler.logger, memory)
+	handler.initContextWindow()
 
 	// 从数据库获取默认提示词
 	defaultPrompt, err := handler.configService.GetSystemConfigValue("prompt", "default_prompt")
@@ -290,10 +576,26 @@ func NewConnectionHandler(
 		defaultPrompt = "你是一个友好的AI助手"
 	}
 	handler.dialogueManager.SetSystemMessage(defaultPrompt)
+	handler.applyPersonaPrompt()
+	handler.applyVerbosityPrompt()
+
+	// 恢复会话的历史上下文，之后的新消息持久化供下次重连恢复
+	handler.restoreSessionHistory(resumedSession)
+	handler.dialogueManager.SetRecorder(handler.recordDialogueMessage)
+	if memoryService != nil && deviceID != "" {
+		// 记忆在每轮消息提交后生成
+		handler.dialogueManager.SetMemoryPerTurn(true)
+	}
 
 	handler.functionRegister = function.NewFunctionRegistry()
+	handler.initTools(layered)
 	handler.initMCPResultHandlers()
 
+	// 按上下文词表初始化ASR热词，按初始语言选择ASR引擎
+	handler.refreshASRHotwords()
+	handler.refreshASREngine()
+	handler.refreshASRRequestContext()
+
 	return handler
 }
 
@@ -331,14 +633,16 @@ func (h *ConnectionHandler) handleTaskComplete(task *task.Task, id string, resul
 func (h *ConnectionHandler) LogInfo(msg string) {
 	if h.logger != nil {
 		h.logger.Info(msg, map[string]interface{}{
-			"device": h.deviceID,
+			"device":  h.deviceID,
+			"session": h.sessionID,
 		})
 	}
 }
 func (h *ConnectionHandler) LogError(msg string) {
 	if h.logger != nil {
 		h.logger.Error(msg, map[string]interface{}{
-			"device": h.deviceID,
+			"device":  h.deviceID,
+			"session": h.sessionID,
 		})
 	}
 }
@@ -360,10 +664,12 @@ func (h *ConnectionHandler) Handle(conn Connection) {
 	h.conn = conn
 
 	// 启动消息处理协程
-	go h.processClientAudioMessagesCoroutine() // 添加客户端音频消息处理协程
-	go h.processClientTextMessagesCoroutine()  // 添加客户端文本消息处理协程
-	go h.processTTSQueueCoroutine()            // 添加TTS队列处理协程
-	go h.sendAudioMessageCoroutine()           // 添加音频消息发送协程
+	h.goCoroutine(h.processClientAudioMessagesCoroutine) // 添加客户端音频消息处理协程
+	h.goCoroutine(h.processClientTextMessagesCoroutine)  // 添加客户端文本消息处理协程
+	h.goCoroutine(h.processTTSQueueCoroutine)            // 添加TTS队列处理协程
+	h.goCoroutine(h.sendAudioMessageCoroutine)           // 添加音频消息发送协程
+	h.goCoroutine(h.proactiveSchedulerCoroutine)         // 主动对话调度协程（未启用时直接退出）
+	h.touchActivity()
 
 	// 优化后的MCP管理器处理
 	if h.mcpManager == nil {
@@ -424,6 +730,20 @@ func (h *ConnectionHandler) Handle(conn Connection) {
 	}
 }
 
+// goCoroutine 启动一个消息处理协程，协程在 stopChan 关闭后退出
+func (h *ConnectionHandler) goCoroutine(coroutine func()) {
+	h.coroutines.Add(1)
+	go func() {
+		defer h.coroutines.Done()
+		coroutine()
+	}()
+}
+
+// WaitCoroutines 等待 Handle 启动的消息处理协程全部退出，应在 Close 之后调用
+func (h *ConnectionHandler) WaitCoroutines() {
+	h.coroutines.Wait()
+}
+
 // processClientTextMessagesCoroutine 处理文本消息队列
 func (h *ConnectionHandler) processClientTextMessagesCoroutine() {
 	defer func() {
@@ -441,6 +761,10 @@ func (h *ConnectionHandler) processClientTextMessagesCoroutine() {
 			if err := h.processClientTextMessage(context.Background(), text); err != nil {
 				h.logger.Error(fmt.Sprintf("处理文本数据失败: %v", err))
 			}
+		case <-h.proactiveQueue:
+			if err := h.startProactiveTurn(); err != nil {
+				h.LogError(fmt.Sprintf("主动对话失败: %v", err))
+			}
 		}
 	}
 }
@@ -459,9 +783,35 @@ func (h *ConnectionHandler) processClientAudioMessagesCoroutine() {
 		case <-h.stopChan:
 			return
 		case audioData := <-h.clientAudioQueue:
-			if err := h.providers.asr.AddAudio(audioData); err != nil {
+			// echo 回环测试不经过ASR，直接录音回放
+			if h.loopbackMode == loopbackModeEcho {
+				if h.clientAudioFormat == "pcm" || h.opusDecoder.Load() != nil {
+					h.captureLoopback(audioData)
+				}
+				continue
+			}
+			// opus未解码时无法计算能量，不参与静音检测
+			if h.clientAudioFormat == "pcm" || h.opusDecoder.Load() != nil {
+				h.asrProvider().ObserveAudio(audioData)
+				var forward bool
+				if audioData, forward = h.gatePreRoll(audioData); !forward {
+					// 语音起点前的音频只进入前置缓冲，不送入ASR
+					h.checkAsrIdle()
+					continue
+				}
+				h.recordASRUsage(audioData)
+				audioData = h.resampleForASR(audioData)
+				h.captureAudio(audioData)
+			}
+			if err := h.asrProvider().AddAudio(audioData); err != nil {
 				h.logger.Error(fmt.Sprintf("处理音频数据失败: %v", err))
+				h.recordStageError(pipelineStageASR)
+				if h.lastTextIndex() == -1 {
+					h.speakFailure(failureASR, h.talkRound)
+				}
 			}
+			h.checkAsrIdle()
+			h.armASRDeadlineOnSpeechEnd()
 		}
 	}
 }
@@ -480,49 +830,119 @@ func (h *ConnectionHandler) sendAudioMessageCoroutine() {
 			return
 		case task := <-h.audioMessagesQueue:
 			h.sendAudioMessage(task.filepath, task.text, task.textIndex, task.round)
+			h.touchActivity()
 		}
 	}
 }
 
+// asrIdlePrompt 收听超时未检测到语音时提交给对话流程的提示
+const asrIdlePrompt = "你没有听清我说话"
+
+// checkAsrIdle 统一的轮次边界判断：自动拾音且服务端未播报时，无语音超时则按静音计数推进对话
+func (h *ConnectionHandler) checkAsrIdle() {
+	if h.listenMode() == "manual" || h.lastTextIndex() != -1 || h.closeAfterChat {
+		return
+	}
+	if !h.asrProvider().CheckIdle() {
+		return
+	}
+
+	count := h.asrProvider().GetSilenceCount()
+	h.LogInfo(fmt.Sprintf("收听超时未检测到语音，连续静音次数: %d", count))
+	if count >= 2 {
+		// OnAsrResult 会根据静音计数结束对话
+		go h.OnAsrResult("")
+		return
+	}
+	go h.OnAsrResult(asrIdlePrompt)
+}
+
 // OnAsrResult 实现 AsrEventListener 接口
 // 返回true则停止语音识别，返回false会继续语音识别
 func (h *ConnectionHandler) OnAsrResult(result string) bool {
-	//h.LogInfo(fmt.Sprintf("[%s] ASR识别结果: %s", h.clientListenMode, result))
-	if h.providers.asr.GetSilenceCount() >= 2 {
+	//h.LogInfo(fmt.Sprintf("[%s] ASR识别结果: %s", h.listenMode(), result))
+	if result != "" && !h.stopASRDeadline() {
+		h.LogInfo(fmt.Sprintf("识别结果在超时后到达，丢弃: %s", result))
+		return false
+	}
+	if h.asrProvider().GetSilenceCount() >= 2 {
 		h.LogInfo("检测到连续两次静音，结束对话")
 		h.closeAfterChat = true // 如果连续两次静音，则结束对话
 		result = "长时间未检测到用户说话，请礼貌的结束对话"
 	}
-	if h.clientListenMode == "auto" {
+	if result != "" && result != asrIdlePrompt {
+		h.asrProvider().ResetSilenceCount()
+	}
+	mode := h.listenMode()
+	if mode == "auto" {
 		if result == "" {
 			return false
 		}
-		h.LogInfo(fmt.Sprintf("[%s] ASR识别结果: %s", h.clientListenMode, result))
-		h.handleChatMessage(context.Background(), result)
+		h.LogInfo(fmt.Sprintf("[%s] ASR识别结果: %s", mode, result))
+		h.handleASRText(result)
 		return true
-	} else if h.clientListenMode == "manual" {
+	} else if mode == "manual" {
 		h.client_asr_text += result
 		if result != "" {
-			h.LogInfo(fmt.Sprintf("[%s] ASR识别结果: %s", h.clientListenMode, h.client_asr_text))
+			h.LogInfo(fmt.Sprintf("[%s] ASR识别结果: %s", mode, h.client_asr_text))
 		}
 		if h.clientVoiceStop {
-			h.handleChatMessage(context.Background(), h.client_asr_text)
+			h.handleASRText(h.client_asr_text)
 			return true
 		}
 		return false
-	} else if h.clientListenMode == "realtime" {
+	} else if mode == "realtime" {
 		if result == "" {
 			return false
 		}
 		h.stopServerSpeak()
-		h.providers.asr.Reset() // 重置ASR状态，准备下一次识别
-		h.LogInfo(fmt.Sprintf("[%s] ASR识别结果: %s", h.clientListenMode, result))
-		h.handleChatMessage(context.Background(), result)
+		h.asrProvider().Reset() // 重置ASR状态，准备下一次识别
+		h.LogInfo(fmt.Sprintf("[%s] ASR识别结果: %s", mode, result))
+		h.handleASRText(result)
 		return true
 	}
 	return false
 }
 
+// OnAsrPartialResult 流式识别的中间结果：用户仍在说话，刷新活动时间，最终结果仍由 OnAsrResult 处理
+func (h *ConnectionHandler) OnAsrPartialResult(result string) {
+	h.touchActivity()
+	h.logger.Debug("[%s] ASR中间结果: %s", h.listenMode(), result)
+}
+
+// handleASRText 对识别结果纠错后进入对话流程，结束后按最新对话刷新热词
+func (h *ConnectionHandler) handleASRText(text string) {
+	h.touchActivity()
+	h.rearmPreRoll()
+	// 采集的音频附带原始识别结果（纠错前），静音提示语不对应用户语音
+	if text != asrIdlePrompt && !h.closeAfterChat {
+		h.flushAudioCapture(text)
+	} else {
+		h.flushAudioCapture("")
+	}
+	// 识别置信度过低时要求用户重说，不进入对话流程
+	if h.repromptOnLowConfidence(text) {
+		h.refreshASRRequestContext()
+		return
+	}
+	if text != asrIdlePrompt && !h.closeAfterChat {
+		h.observeASRLanguage(text)
+	}
+	// 静音结束对话时的提示语不是用户原话，无需纠错
+	if !h.closeAfterChat {
+		text = h.correctASRResult(text)
+		// 遗忘指令及其确认优先处理，其次是关键词触发规则，已处理的不再进入对话流程
+		if text != asrIdlePrompt && (h.handleForgetCommand(text) || h.fireKeywordTrigger(text)) {
+			h.refreshASRRequestContext()
+			return
+		}
+	}
+	h.handleChatMessage(context.Background(), text)
+	h.refreshASRHotwords()
+	h.refreshASREngine()
+	h.refreshASRRequestContext()
+}
+
 // clientAbortChat 处理中止消息
 func (h *ConnectionHandler) clientAbortChat() error {
 	h.LogInfo("收到客户端中止消息，停止语音识别")
@@ -580,14 +1000,16 @@ func (h *ConnectionHandler) quickReplyWakeUpWords(text string) bool {
 	}
 
 	// 从数据库获取快速回复词汇
-	quickReplyWords, err := h.configService.GetSystemConfigArray("audio", "quick_reply_words")
+	quickReplyWords, err := h.quickReplyWords()
 	if err != nil {
 		h.logger.Error("获取快速回复词汇失败: %v", err)
 		return false
 	}
 
 	reply_text := utils.RandomSelectFromArray(quickReplyWords)
-	h.tts_last_text_index = 1 // 重置文本索引
+	h.setLastTextIndex(1) // 重置文本索引
+	// 快速回复本身就是应答提示，本轮不再播放提示音
+	h.markEarconPlayed(h.talkRound)
 	h.SpeakAndPlay(reply_text, 1, h.talkRound)
 
 	return true
@@ -605,6 +1027,20 @@ func (h *ConnectionHandler) handleChatMessage(ctx context.Context, text string)
 		return fmt.Errorf("用户请求退出对话")
 	}
 
+	// 回环测试不调用LLM，直接朗读
+	if h.loopbackMode != "" {
+		return h.replyLoopback(text)
+	}
+
+	// 结算上一轮的消息和用量
+	h.finishTurn()
+
+	// 切换管理员设置的会话级provider覆盖
+	h.applyProviderOverrides(false)
+
+	// 按能力路由规则选择本轮的LLM
+	h.routeTurnLLM(text)
+
 	// 增加对话轮次
 	h.talkRound++
 	h.roundStartTime = time.Now()
@@ -621,6 +1057,36 @@ func (h *ConnectionHandler) handleChatMessage(ctx context.Context, text string)
 		return nil
 	}
 
+	// 维护模式下拒绝新的对话轮次
+	if h.rejectForMaintenance() {
+		return nil
+	}
+
+	// 听写模式不调用LLM
+	mode := h.currentConversationMode()
+	if mode == conversationModeDictation {
+		return h.replyDictation(text)
+	}
+
+	// 助手模式下命中设备指令时直接下发，不调用LLM
+	if mode == conversationModeAssistant && h.routeIntent(text) {
+		return nil
+	}
+
+	// 模型策略不允许当前模型时拒绝
+	if h.rejectForModelPolicy() {
+		return nil
+	}
+
+	// 首次部署引导未完成且配置为拒绝对话时拒绝
+	if h.rejectForSetup() {
+		return nil
+	}
+
+	if mode == conversationModeTranslator {
+		return h.replyTranslation(ctx, text, currentRound)
+	}
+
 	// 普通文本消息处理流程
 	// 立即发送 stt 消息
 	err := h.sendSTTMessage(text)
@@ -653,8 +1119,15 @@ func (h *ConnectionHandler) handleChatMessage(ctx context.Context, text string)
 		Content: text,
 	})
 
-	// 使用带记忆的对话生成回复
-	return h.genResponseByLLM(ctx, h.dialogueManager.GetLLMDialogueWithAutoMemory(text), currentRound)
+	// 使用带记忆的对话生成回复，命中回复缓存时直接播放缓存内容
+	messages := h.dialogueManager.GetLLMDialogueWithAutoMemory(text)
+	if h.replyFromLLMCache(ctx, text, messages, currentRound) {
+		h.maybeTitleSession()
+		return nil
+	}
+	err = h.genResponseByLLM(ctx, messages, currentRound)
+	h.maybeTitleSession()
+	return err
 }
 
 func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []providers.Message, round int) error {
@@ -662,31 +1135,57 @@ func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []pro
 		if r := recover(); r != nil {
 			h.logger.Error(fmt.Sprintf("genResponseByLLM发生panic: %v", r))
 			errorMsg := "抱歉，处理您的请求时发生了错误"
-			h.tts_last_text_index = 1 // 重置文本索引
+			h.setLastTextIndex(1) // 重置文本索引
 			h.SpeakAndPlay(errorMsg, 1, round)
 		}
 	}()
 
+	ctx, cancel := context.WithCancel(h.verbosityContext(h.requestContext(ctx, round)))
+	defer cancel()
+
+	// 取出本轮的回复缓存键，工具调用后的再次生成不写入缓存
+	cacheKey := h.pendingLLMCacheKey
+	h.pendingLLMCacheKey = ""
+
+	// 发送前检查上下文token预算，超出时裁剪最早的对话轮次
+	messages = h.dialogueManager.FitContextWindow(messages)
+	sampler := h.samplePrompt(messages, round)
+
 	llmStartTime := time.Now()
 	//h.logger.Info("开始生成LLM回复, round:%d ", round)
 	for _, msg := range messages {
 		_ = msg
 		//msg.Print()
 	}
-	// 使用LLM生成回复
-	tools := h.functionRegister.GetAllFunctions()
-	responses, err := h.providers.llm.ResponseWithFunctions(ctx, h.sessionID, messages, tools)
+	// 使用LLM生成回复，首个输出超时后取消请求
+	deadline := h.startStageDeadline(pipelineStageLLM, round, cancel)
+	responses, err := h.functionRegister.ResponseWithTools(ctx, h.turnLLM(), h.sessionID, messages, h.toolFilter)
 	if err != nil {
+		// 超时已由超时处理播报致歉语，被打断时不再播报
+		if deadline.stop() && ctx.Err() == nil {
+			h.endRoundWithFailure(failureLLM, round)
+		}
 		return fmt.Errorf("LLM生成回复失败: %v", err)
 	}
 
 	// 处理回复
 	var responseMessage []string
+	var spokenSegments []string // 已播放的分段，用于写入回复缓存
 	processedChars := 0
 	textIndex := 0
 
 	atomic.StoreInt32(&h.serverVoiceStop, 0)
 
+	// 回复内容审核状态
+	moderationState := &responseModeration{}
+
+	// 详略档位的句数、字数限制，达到限制后丢弃剩余文本并取消生成
+	limiter := h.newReplyLimiter()
+	limited := false
+
+	// 向声明支持的设备下发流式文本
+	stream := h.newTextStream(round)
+
 	// 处理流式响应
 	toolCallFlag := false
 	functionName := ""
@@ -694,15 +1193,17 @@ func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []pro
 	functionArguments := ""
 	contentArguments := ""
 
-	for response := range responses {
+	for {
+		response, ok := nextLLMResponse(responses, deadline)
+		if !ok {
+			break
+		}
 		content := response.Content
 		toolCall := response.ToolCalls
 
 		if response.Error != "" {
 			h.logger.Error(fmt.Sprintf("LLM响应错误: %s", response.Error))
-			errorMsg := "抱歉，服务暂时不可用，请稍后再试"
-			h.tts_last_text_index = 1 // 重置文本索引
-			h.SpeakAndPlay(errorMsg, 1, round)
+			stream.end(h.endRoundWithFailure(failureLLM, round), false)
 			return fmt.Errorf("LLM响应错误: %s", response.Error)
 		}
 
@@ -731,9 +1232,11 @@ func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []pro
 		if content != "" {
 			if strings.Contains(content, "服务响应异常") {
 				h.logger.Error(fmt.Sprintf("检测到LLM服务异常: %s", content))
+				h.recordStageError(pipelineStageLLM)
 				errorMsg := "抱歉，服务暂时不可用，请稍后再试"
-				h.tts_last_text_index = 1 // 重置文本索引
+				h.setLastTextIndex(1) // 重置文本索引
 				h.SpeakAndPlay(errorMsg, 1, round)
+				stream.end(errorMsg, false)
 				return fmt.Errorf("LLM服务异常")
 			}
 
@@ -747,27 +1250,63 @@ func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []pro
 				continue
 			}
 			currentText := fullText[processedChars:]
+			stream.delta(fullText, textIndex+1, false)
 
 			// 按标点符号分割
 			if segment, chars := utils.SplitAtLastPunctuation(currentText); chars > 0 {
+				if notice, allowed := h.moderateSegment(ctx, moderationState, segment); !allowed {
+					if notice != "" {
+						textIndex++
+						h.setLastTextIndex(textIndex)
+						h.SpeakAndPlay(notice, textIndex, round)
+					}
+					processedChars += chars
+					continue
+				}
+				segment, limited = limiter.take(segment)
+				if segment == "" {
+					processedChars += chars
+					if limited {
+						break
+					}
+					continue
+				}
 				textIndex++
+				stream.segment(segment, textIndex)
 				if textIndex == 1 {
 					now := time.Now()
 					llmSpentTime := now.Sub(llmStartTime)
+					h.recordStageLatency(pipelineStageLLM, llmSpentTime)
 					h.LogInfo(fmt.Sprintf("LLM回复耗时 %s 生成第一句话【%s】, round: %d", llmSpentTime, segment, round))
 				} else {
 					h.LogInfo(fmt.Sprintf("LLM回复分段: %s, index: %d, round:%d", segment, textIndex, round))
 				}
-				h.tts_last_text_index = textIndex
+				h.setLastTextIndex(textIndex)
 				err := h.SpeakAndPlay(segment, textIndex, round)
 				if err != nil {
 					h.logger.Error(fmt.Sprintf("播放LLM回复分段失败: %v", err))
 				}
+				spokenSegments = append(spokenSegments, segment)
 				processedChars += chars
+				if limited {
+					break
+				}
 			}
 		}
 	}
 
+	if limited {
+		// 超出限制的文本不播放也不写入对话历史
+		cancel()
+		h.LogInfo(fmt.Sprintf("回复达到 %s 档位的长度限制，已截断, round: %d", h.verbosityConfig.Level, round))
+		responseMessage = append([]string(nil), spokenSegments...)
+		processedChars = len(utils.JoinStrings(responseMessage))
+	}
+
+	if deadline.hasExpired() {
+		return errStageTimeout
+	}
+
 	if toolCallFlag {
 		bHasError := false
 		if functionID == "" {
@@ -796,7 +1335,7 @@ func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []pro
 				"arguments": functionArguments,
 			}
 			h.LogInfo(fmt.Sprintf("函数调用: %v", arguments))
-			if h.mcpManager.IsMCPTool(functionName) {
+			if h.mcpManager != nil && h.mcpManager.IsMCPTool(functionName) {
 				// 处理MCP函数调用
 				result, err := h.mcpManager.ExecuteTool(ctx, functionName, arguments)
 				if err != nil {
@@ -805,21 +1344,16 @@ func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []pro
 						result = "MCP工具调用失败"
 					}
 				}
-				// 判断result 是否是types.ActionResponse类型
-				if actionResult, ok := result.(types.ActionResponse); ok {
-					h.handleFunctionResult(actionResult, functionCallData, textIndex)
-				} else {
-					h.LogInfo(fmt.Sprintf("MCP函数调用结果: %v", result))
-					actionResult := types.ActionResponse{
-						Action: types.ActionTypeReqLLM, // 动作类型
-						Result: result,                 // 动作产生的结果
-					}
-					h.handleFunctionResult(actionResult, functionCallData, textIndex)
-				}
-
+				h.handleToolResult(result, functionCallData, textIndex)
 			} else {
-				// 处理普通函数调用
-				//h.functionRegister.CallFunction(functionName, functionCallData)
+				// 处理内置工具调用
+				result, err := h.functionRegister.CallFunction(ctx, functionName, arguments)
+				if err != nil {
+					h.logger.Error(fmt.Sprintf("内置工具调用失败: %v", err))
+				}
+				if result != nil {
+					h.handleToolResult(result, functionCallData, textIndex)
+				}
 			}
 		}
 	}
@@ -828,26 +1362,54 @@ func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []pro
 	fullResponse := utils.JoinStrings(responseMessage)
 	if len(fullResponse) > processedChars {
 		remainingText := fullResponse[processedChars:]
-		if remainingText != "" {
+		if notice, allowed := h.moderateSegment(ctx, moderationState, remainingText); !allowed {
+			if notice != "" {
+				textIndex++
+				h.setLastTextIndex(textIndex)
+				h.SpeakAndPlay(notice, textIndex, round)
+			}
+		} else if remainingText, limited = limiter.take(remainingText); remainingText != "" {
 			textIndex++
 			h.LogInfo(fmt.Sprintf("LLM回复分段[剩余文本]: %s, index: %d, round:%d", remainingText, textIndex, round))
-			h.tts_last_text_index = textIndex
+			h.setLastTextIndex(textIndex)
 			h.SpeakAndPlay(remainingText, textIndex, round)
+			spokenSegments = append(spokenSegments, remainingText)
+			stream.segment(remainingText, textIndex)
 		}
 	} else {
 		h.logger.Debug(fmt.Sprintf("无剩余文本需要处理: fullResponse长度=%d, processedChars=%d", len(fullResponse), processedChars))
 	}
+	if limited {
+		responseMessage = append([]string(nil), spokenSegments...)
+		fullResponse = utils.JoinStrings(responseMessage)
+	}
+
+	if !toolCallFlag {
+		stream.delta(fullResponse, textIndex, true)
+	}
 
 	// 分析回复并发送相应的情绪
 	content := utils.JoinStrings(responseMessage)
+	sampler.finish(h, content, functionName, functionArguments)
+
+	inputs := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		inputs = append(inputs, msg.Content)
+	}
+	h.recordLLMUsage(inputs, content)
 
 	// 添加助手回复到对话历史
 	if !toolCallFlag {
-		h.dialogueManager.Put(chat.Message{
-			Role:    "assistant",
-			Content: content,
-		})
+		if moderationState.blocked {
+			// 被拦截的内容不进入对话上下文，原文随审核结果保存
+			moderationState.original = content
+			content = h.moderationConfig.BlockedMessage
+		} else {
+			h.storeLLMCache(cacheKey, content, spokenSegments)
+		}
+		h.putAssistantReply(moderationState, content)
 	}
+	stream.end(content, moderationState.blocked)
 
 	return nil
 }
@@ -921,12 +1483,41 @@ func (h *ConnectionHandler) SystemSpeak(text string) error {
 	index := 0
 	for _, item := range texts {
 		index++
-		h.tts_last_text_index = index // 重置文本索引
+		h.setLastTextIndex(index) // 重置文本索引
 		h.SpeakAndPlay(item, index, h.talkRound)
 	}
 	return nil
 }
 
+// rejectForMaintenance 维护模式下拒绝新的对话轮次，下发并播报维护提示后结束会话
+func (h *ConnectionHandler) rejectForMaintenance() bool {
+	if h.configService == nil {
+		return false
+	}
+	status := h.configService.GetMaintenanceStatus()
+	if !status.Enabled {
+		return false
+	}
+
+	h.LogInfo("系统维护中，拒绝新的对话轮次")
+	if err := h.sendMaintenanceMessage(status.Message); err != nil {
+		h.LogError(fmt.Sprintf("发送维护提示失败: %v", err))
+	}
+	h.closeAfterChat = true
+	h.SystemSpeak(status.Message)
+	return true
+}
+
+// rejectForSetup 首次部署引导未完成且配置为拒绝对话时，拒绝新的对话轮次并播报提示
+func (h *ConnectionHandler) rejectForSetup() bool {
+	if h.setupPendingMessage == "" {
+		return false
+	}
+	h.LogInfo("首次部署引导未完成，拒绝新的对话轮次")
+	h.SystemSpeak(h.setupPendingMessage)
+	return true
+}
+
 // isNeedAuth 判断是否需要验证
 func (h *ConnectionHandler) isNeedAuth() bool {
 	if !h.config.Server.Auth.Enabled {
@@ -985,6 +1576,11 @@ func (h *ConnectionHandler) deleteAudioFileIfNeeded(filepath string, reason stri
 		return
 	}
 
+	// 配置的失败提示语音频不删除
+	if h.isFailureSpeechFile(filepath) {
+		return
+	}
+
 	// 检查是否为快速回复缓存文件，如果是则不删除
 	if h.quickReplyCache != nil && h.quickReplyCache.IsCachedFile(filepath) {
 		h.LogInfo(fmt.Sprintf(reason+" 跳过删除缓存音频文件: %s", filepath))
@@ -1012,7 +1608,7 @@ func (h *ConnectionHandler) processTTSTask(text string, textIndex int, round int
 	}()
 
 	// 从数据库获取快速回复词汇
-	quickReplyWords, err := h.configService.GetSystemConfigArray("audio", "quick_reply_words")
+	quickReplyWords, err := h.quickReplyWords()
 	if err != nil {
 		h.logger.Error("获取快速回复词汇失败: %v", err)
 	} else if utils.IsQuickReplyHit(text, quickReplyWords) {
@@ -1033,13 +1629,44 @@ func (h *ConnectionHandler) processTTSTask(text string, textIndex int, round int
 		return
 	}
 
+	// 本轮TTS已不可用，直接以文本下发
+	if h.ttsTextOnly(round) {
+		text, filepath, _ = h.fallbackToText(text, textIndex, round)
+		return
+	}
+
 	// 生成语音文件
-	filepath, err = h.providers.tts.ToTTS(text)
+	ttsChars := utf8.RuneCountInString(text)
+	filepath, ttsSource, err := h.synthesizeWithDeadline(h.requestContext(h.ctx, round), text, textIndex, round)
+	if errors.Is(err, errStageTimeout) {
+		return
+	}
+	if err == nil {
+		// 空文件或文件不存在按合成失败处理，不向设备下发静音
+		if validateErr := tts.ValidateAudioFile(filepath); validateErr != nil {
+			if filepath != "" {
+				os.Remove(filepath)
+			}
+			filepath, err = "", validateErr
+		}
+	}
 	if err != nil {
 		h.logger.Error(fmt.Sprintf("TTS转换失败:text(%s) %v", text, err))
+		h.recordStageError(pipelineStageTTS)
+		// 能显示文字的设备降级为文本下发
+		if noticeText, clip, ok := h.fallbackToText(text, textIndex, round); ok {
+			text, filepath = noticeText, clip
+			return
+		}
+		// 使用预备的失败提示语音频代替，设备不至于没有声音
+		if failureText, clip := h.failureClipForTTS(round); clip != "" {
+			text, filepath = failureText, clip
+		}
 		return
 	} else {
 		h.logger.Debug(fmt.Sprintf("TTS转换成功: text(%s), index(%d) %s", text, textIndex, filepath))
+		h.recordStageLatency(pipelineStageTTS, time.Since(ttsStartTime))
+		h.recordTTSUsage(ttsChars, ttsSource)
 		// 如果是快速回复词，保存到缓存
 		if utils.IsQuickReplyHit(text, quickReplyWords) {
 			if err := h.quickReplyCache.SaveCachedAudio(text, filepath); err != nil {
@@ -1097,18 +1724,29 @@ func (h *ConnectionHandler) SpeakAndPlay(text string, textIndex int, round int)
 	return nil
 }
 
+// lastTextIndex 返回最后一段TTS文本的索引，-1表示服务端未在讲话
+func (h *ConnectionHandler) lastTextIndex() int {
+	return int(h.tts_last_text_index.Load())
+}
+
+// setLastTextIndex 记录最后一段TTS文本的索引
+func (h *ConnectionHandler) setLastTextIndex(index int) {
+	h.tts_last_text_index.Store(int32(index))
+}
+
 func (h *ConnectionHandler) clearSpeakStatus() {
 	h.LogInfo("清除服务端讲话状态 ")
-	h.tts_last_text_index = -1
-	h.providers.asr.Reset() // 重置ASR状态
+	h.setLastTextIndex(-1)
+	h.asrProvider().Reset() // 重置ASR状态
+	h.rearmPreRoll()
+	h.resetASRDeadline()
 }
 
 func (h *ConnectionHandler) closeOpusDecoder() {
-	if h.opusDecoder != nil {
-		if err := h.opusDecoder.Close(); err != nil {
+	if decoder := h.opusDecoder.Swap(nil); decoder != nil {
+		if err := decoder.Close(); err != nil {
 			h.logger.Error(fmt.Sprintf("关闭Opus解码器失败: %v", err))
 		}
-		h.opusDecoder = nil
 	}
 }
 
@@ -1161,19 +1799,27 @@ func (h *ConnectionHandler) Close() {
 	h.closeOnce.Do(func() {
 		close(h.stopChan)
 
+		h.finishTurn()
+		h.emitSessionSummary()
+
 		h.closeOpusDecoder()
+		if h.bargeInDetector != nil {
+			h.bargeInDetector.Close()
+		}
 
-		if h.providers.asr != nil {
-			if err := h.providers.asr.Reset(); err != nil {
+		if h.asrProvider() != nil {
+			if err := h.asrProvider().Reset(); err != nil {
 				h.logger.Error(fmt.Sprintf("重置ASR状态失败: %v", err))
 			}
 		}
 		h.cleanTTSAndAudioQueue(true)
+		h.releaseProviderOverrides()
 	})
 }
 
 // genResponseByVLLM 使用VLLLM处理包含图片的消息
 func (h *ConnectionHandler) genResponseByVLLM(ctx context.Context, messages []providers.Message, imageData image.ImageData, text string, round int) error {
+	ctx = h.requestContext(ctx, round)
 	h.logger.Info("开始生成VLLLM回复 %v", map[string]interface{}{
 		"text":          text,
 		"has_url":       imageData.URL != "",
@@ -1183,8 +1829,12 @@ func (h *ConnectionHandler) genResponseByVLLM(ctx context.Context, messages []pr
 	})
 
 	// 使用VLLLM处理图片和文本
-	responses, err := h.providers.vlllm.ResponseWithImage(ctx, h.sessionID, messages, imageData, text)
+	responses, err := h.vlllmProvider().ResponseWithImage(ctx, h.sessionID, messages, imageData, text)
 	if err != nil {
+		if errors.Is(err, image.ErrImageRejected) {
+			h.rejectImage()
+			return nil
+		}
 		h.logger.Error(fmt.Sprintf("VLLLM生成回复失败，尝试降级到普通LLM: %v", err))
 		// 降级策略：只使用文本部分调用普通LLM
 		fallbackText := fmt.Sprintf("用户发送了一张图片并询问：%s（注：当前无法处理图片，只能根据文字回答）", text)
@@ -1215,7 +1865,7 @@ func (h *ConnectionHandler) genResponseByVLLM(ctx context.Context, messages []pr
 		// 按标点符号分割
 		if segment, chars := utils.SplitAtLastPunctuation(currentText); chars > 0 {
 			textIndex++
-			h.tts_last_text_index = textIndex
+			h.setLastTextIndex(textIndex)
 			h.SpeakAndPlay(segment, textIndex, round)
 			processedChars += chars
 		}
@@ -1225,7 +1875,7 @@ func (h *ConnectionHandler) genResponseByVLLM(ctx context.Context, messages []pr
 	remainingText := utils.JoinStrings(responseMessage)[processedChars:]
 	if remainingText != "" {
 		textIndex++
-		h.tts_last_text_index = textIndex
+		h.setLastTextIndex(textIndex)
 		h.SpeakAndPlay(remainingText, textIndex, round)
 	}
 
@@ -1233,10 +1883,7 @@ func (h *ConnectionHandler) genResponseByVLLM(ctx context.Context, messages []pr
 	content := utils.JoinStrings(responseMessage)
 
 	// 添加VLLLM回复到对话历史
-	h.dialogueManager.Put(chat.Message{
-		Role:    "assistant",
-		Content: content,
-	})
+	h.putAssistantReply(nil, content)
 
 	h.LogInfo(fmt.Sprintf("VLLLM回复处理完成 …%v", map[string]interface{}{
 		"content_length": len(content),
@@ -1269,6 +1916,24 @@ func (h *ConnectionHandler) initializeDeviceCapabilities(deviceID string) {
 	h.createProvidersFromConfig(config)
 }
 
+// initContextWindow 根据LLM提供者配置（props中的context_window/max_tokens）设置对话的token预算
+func (h *ConnectionHandler) initContextWindow() {
+	window := defaultContextWindow
+	reserve := defaultReplyReserve
+	if getter, ok := h.llmProvider().(llmConfigGetter); ok && getter.Config() != nil {
+		config := getter.Config()
+		if value := getIntFromConfig(config.Extra, "context_window"); value != 0 {
+			window = value
+		}
+		if config.MaxTokens > 0 {
+			reserve = config.MaxTokens
+		} else if value := getIntFromConfig(config.Extra, "max_tokens"); value > 0 {
+			reserve = value
+		}
+	}
+	h.dialogueManager.SetContextWindow(window, reserve)
+}
+
 // parseUint 辅助函数
 func parseUint(s string) uint {
 	u, _ := strconv.ParseUint(s, 10, 32)
@@ -1311,13 +1976,26 @@ func (h *ConnectionHandler) createASRProvider(capability database.CapabilityConf
 		return
 	}
 
-	h.providers.asr = provider
+	h.storeProvider("ASR", provider)
 	h.logger.Info("使用设备自定义ASR提供者: %s/%s (优先级: %d)",
 		capability.CapabilityName, capability.CapabilityType, capability.Priority)
 }
 
 // createLLMProvider 创建LLM提供者
 func (h *ConnectionHandler) createLLMProvider(capability database.CapabilityConfig) {
+	provider, err := newLLMProvider(capability)
+	if err != nil {
+		h.logger.Error("创建LLM提供者失败: %v", err)
+		return
+	}
+
+	h.storeProvider("LLM", provider)
+	h.logger.Info("使用设备自定义LLM提供者: %s/%s (优先级: %d)",
+		capability.CapabilityName, capability.CapabilityType, capability.Priority)
+}
+
+// newLLMProvider 按能力配置创建LLM提供者
+func newLLMProvider(capability database.CapabilityConfig) (providers.LLMProvider, error) {
 	llmConfig := &llm.Config{
 		Type:        capability.CapabilityType,
 		ModelName:   getStringFromConfig(capability.Config, "model_name"),
@@ -1329,19 +2007,24 @@ func (h *ConnectionHandler) createLLMProvider(capability database.CapabilityConf
 		Extra:       capability.Config,
 	}
 
-	provider, err := llm.Create(capability.CapabilityType, llmConfig)
+	return llm.Create(capability.CapabilityType, llmConfig)
+}
+
+// createTTSProvider 创建TTS提供者
+func (h *ConnectionHandler) createTTSProvider(capability database.CapabilityConfig) {
+	provider, err := h.newTTSProvider(capability)
 	if err != nil {
-		h.logger.Error("创建LLM提供者失败: %v", err)
+		h.logger.Error("创建TTS提供者失败: %v", err)
 		return
 	}
 
-	h.providers.llm = provider
-	h.logger.Info("使用设备自定义LLM提供者: %s/%s (优先级: %d)",
+	h.storeProvider("TTS", provider)
+	h.logger.Info("使用设备自定义TTS提供者: %s/%s (优先级: %d)",
 		capability.CapabilityName, capability.CapabilityType, capability.Priority)
 }
 
-// createTTSProvider 创建TTS提供者
-func (h *ConnectionHandler) createTTSProvider(capability database.CapabilityConfig) {
+// newTTSProvider 按能力配置创建TTS提供者
+func (h *ConnectionHandler) newTTSProvider(capability database.CapabilityConfig) (providers.TTSProvider, error) {
 	ttsConfig := &tts.Config{
 		Type:      capability.CapabilityType,
 		Voice:     getStringFromConfig(capability.Config, "voice"),
@@ -1359,15 +2042,7 @@ func (h *ConnectionHandler) createTTSProvider(capability database.CapabilityConf
 		deleteAudio = true // 默认删除
 	}
 
-	provider, err := tts.Create(capability.CapabilityType, ttsConfig, deleteAudio)
-	if err != nil {
-		h.logger.Error("创建TTS提供者失败: %v", err)
-		return
-	}
-
-	h.providers.tts = provider
-	h.logger.Info("使用设备自定义TTS提供者: %s/%s (优先级: %d)",
-		capability.CapabilityName, capability.CapabilityType, capability.Priority)
+	return tts.Create(capability.CapabilityType, ttsConfig, deleteAudio, h.logger)
 }
 
 // createVLLLMProvider 创建VLLLM提供者
@@ -1397,7 +2072,7 @@ func (h *ConnectionHandler) createVLLLMProvider(capability database.CapabilityCo
 		return
 	}
 
-	h.providers.vlllm = provider
+	h.storeProvider("VLLLM", provider)
 	h.logger.Info("使用设备自定义VLLLM提供者: %s/%s (优先级: %d)",
 		capability.CapabilityName, capability.CapabilityType, capability.Priority)
 }
@@ -0,0 +1,312 @@
+package core
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+* 音频确认（ack）：设备在 hello 的 features 中声明 "ack": true，且系统/设备 audio_ack 配置启用时生效。
+* 生效后服务端下发的每个音频帧前加 4 字节大端序号（从1开始，连接内递增），sentence_end 消息附带 last_seq；
+* 设备回复 {"type":"ack","seq":N,"missing":[...]} 累计确认，missing 中的帧立即重发。
+* 未确认帧数达到 window 时暂停发送，timeout_ms 内没有新的确认则按 on_timeout 重发未确认帧或中止本轮播放。
+* 未声明或未启用时保持原有无确认模式，音频帧不带序号头。
+ */
+
+// AudioAckConfig 音频确认配置
+type AudioAckConfig struct {
+	Enabled    bool   `json:"enabled"`     // 是否对声明支持ack的设备启用确认模式
+	Window     int    `json:"window"`      // 最多允许未确认的音频帧数
+	TimeoutMs  int    `json:"timeout_ms"`  // 窗口已满时等待确认的超时时间（毫秒）
+	OnTimeout  string `json:"on_timeout"`  // 超时处理：resend（重发未确认帧）或 abort（中止本轮播放）
+	MaxResends int    `json:"max_resends"` // 每次等待最多重发的次数，超过后中止播放
+}
+
+// DefaultAudioAckConfig 默认音频确认配置
+func DefaultAudioAckConfig() AudioAckConfig {
+	return AudioAckConfig{
+		Enabled:    false,
+		Window:     20,
+		TimeoutMs:  1000,
+		OnTimeout:  "resend",
+		MaxResends: 2,
+	}
+}
+
+// applyMap 使用配置map覆盖音频确认配置
+func (c *AudioAckConfig) applyMap(config map[string]interface{}) {
+	if config == nil {
+		return
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, c)
+}
+
+// loadAudioAckConfig 加载音频确认配置：系统配置 audio_ack 分类 < 设备 audio_ack 能力配置
+func (h *ConnectionHandler) loadAudioAckConfig(layered *layeredConfigSource) AudioAckConfig {
+	config := DefaultAudioAckConfig()
+	layered.load("audio_ack", "audio_ack", "", config.applyMap)
+
+	defaults := DefaultAudioAckConfig()
+	if config.Window <= 0 {
+		config.Window = defaults.Window
+	}
+	if config.TimeoutMs <= 0 {
+		config.TimeoutMs = defaults.TimeoutMs
+	}
+	if config.OnTimeout != "resend" && config.OnTimeout != "abort" {
+		config.OnTimeout = defaults.OnTimeout
+	}
+	config.MaxResends = max(config.MaxResends, 0)
+	return config
+}
+
+// audioAckTracker 记录已发送未确认的音频帧
+type audioAckTracker struct {
+	mu      sync.Mutex
+	nextSeq uint32            // 下一帧的序号
+	acked   uint32            // 设备已累计确认的序号
+	round   int               // 未确认帧所属的对话轮次
+	pending map[uint32][]byte // 已发送未确认的帧（含序号头）
+	ackCh   chan struct{}     // 收到确认时通知发送方
+}
+
+// newAudioAckTracker 创建音频确认记录
+func newAudioAckTracker() *audioAckTracker {
+	return &audioAckTracker{
+		nextSeq: 1,
+		pending: make(map[uint32][]byte),
+		ackCh:   make(chan struct{}, 1),
+	}
+}
+
+// frame 为音频帧分配序号并加上序号头，记录为未确认；轮次变化时丢弃上一轮的未确认帧
+func (t *audioAckTracker) frame(payload []byte, round int) []byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if round != t.round {
+		t.round = round
+		clear(t.pending)
+	}
+	seq := t.nextSeq
+	t.nextSeq++
+	packet := make([]byte, 4+len(payload))
+	binary.BigEndian.PutUint32(packet, seq)
+	copy(packet[4:], payload)
+	t.pending[seq] = packet
+	return packet
+}
+
+// lastSeq 最近一次分配的序号
+func (t *audioAckTracker) lastSeq() uint32 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.nextSeq - 1
+}
+
+// outstanding 未确认的帧数
+func (t *audioAckTracker) outstanding() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.pending)
+}
+
+// ack 处理设备确认：seq 为连续收到的最大序号，missing 为设备发现缺失的序号。
+// 返回需要重发的帧；seq 小于已确认序号的过期确认只处理 missing。
+func (t *audioAckTracker) ack(seq uint32, missing []uint32) ([][]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if seq >= t.nextSeq {
+		return nil, fmt.Errorf("确认序号 %d 超出已发送的最大序号 %d", seq, t.nextSeq-1)
+	}
+	if seq > t.acked {
+		for pendingSeq := range t.pending {
+			if pendingSeq <= seq {
+				delete(t.pending, pendingSeq)
+			}
+		}
+		t.acked = seq
+	}
+
+	var resend [][]byte
+	for _, missingSeq := range missing {
+		if packet, ok := t.pending[missingSeq]; ok {
+			resend = append(resend, packet)
+		}
+	}
+
+	select {
+	case t.ackCh <- struct{}{}:
+	default:
+	}
+	return resend, nil
+}
+
+// unacked 按序号顺序返回所有未确认的帧
+func (t *audioAckTracker) unacked() [][]byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	seqs := make([]uint32, 0, len(t.pending))
+	for seq := range t.pending {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	frames := make([][]byte, 0, len(seqs))
+	for _, seq := range seqs {
+		frames = append(frames, t.pending[seq])
+	}
+	return frames
+}
+
+// reset 丢弃所有未确认的帧，序号继续递增
+func (t *audioAckTracker) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	clear(t.pending)
+}
+
+// negotiateAudioAck 根据客户端hello声明的能力和配置决定是否启用音频确认
+func (h *ConnectionHandler) negotiateAudioAck(msgMap map[string]interface{}) {
+	h.audioAck = nil
+	features, _ := msgMap["features"].(map[string]interface{})
+	if supported, _ := features["ack"].(bool); !supported {
+		return
+	}
+	if !h.audioAckConfig.Enabled {
+		h.LogInfo("客户端支持音频确认，但未启用audio_ack配置，使用无确认模式")
+		return
+	}
+	h.audioAck = newAudioAckTracker()
+	h.LogInfo(fmt.Sprintf("启用音频确认: 窗口=%d帧, 超时=%dms, 超时处理=%s",
+		h.audioAckConfig.Window, h.audioAckConfig.TimeoutMs, h.audioAckConfig.OnTimeout))
+}
+
+// audioAckHello hello消息中下发的确认参数，未启用时返回nil
+func (h *ConnectionHandler) audioAckHello() map[string]interface{} {
+	if h.audioAck == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"window":     h.audioAckConfig.Window,
+		"timeout_ms": h.audioAckConfig.TimeoutMs,
+	}
+}
+
+// handleAckMessage 处理设备的音频确认，重发设备报告缺失的帧
+func (h *ConnectionHandler) handleAckMessage(msgMap map[string]interface{}) error {
+	if h.audioAck == nil {
+		h.logger.Debug("未启用音频确认，忽略ack消息")
+		return nil
+	}
+	seq, ok := msgMap["seq"].(float64)
+	if !ok || seq < 0 {
+		return fmt.Errorf("ack消息缺少seq参数")
+	}
+	var missing []uint32
+	if items, ok := msgMap["missing"].([]interface{}); ok {
+		for _, item := range items {
+			if value, ok := item.(float64); ok && value > 0 {
+				missing = append(missing, uint32(value))
+			}
+		}
+	}
+
+	resend, err := h.audioAck.ack(uint32(seq), missing)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		h.LogInfo(fmt.Sprintf("设备报告缺失%d个音频帧，重发%d帧", len(missing), len(resend)))
+	}
+	for _, packet := range resend {
+		if err := h.conn.WriteMessage(2, packet); err != nil {
+			return fmt.Errorf("重发音频帧失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// writeAudioFrame 发送一个音频帧；启用确认时先等待窗口有空位并加上序号头
+func (h *ConnectionHandler) writeAudioFrame(frame []byte, round int) error {
+	if h.audioAck == nil {
+		return h.conn.WriteMessage(2, frame)
+	}
+	if err := h.awaitAudioAcks(h.audioAckConfig.Window-1, round); err != nil {
+		h.abortAudioPlayback(err)
+		return err
+	}
+	if h.audioPlaybackInterrupted(round) {
+		return nil
+	}
+	return h.conn.WriteMessage(2, h.audioAck.frame(frame, round))
+}
+
+// flushAudioAcks 一句音频发送完成后等待设备确认全部帧
+func (h *ConnectionHandler) flushAudioAcks(round int) error {
+	if h.audioAck == nil {
+		return nil
+	}
+	if err := h.awaitAudioAcks(0, round); err != nil {
+		h.abortAudioPlayback(err)
+		return err
+	}
+	return nil
+}
+
+// awaitAudioAcks 等待未确认帧数降到limit以内；超时按配置重发未确认帧，超过重发次数或配置为abort时返回错误
+func (h *ConnectionHandler) awaitAudioAcks(limit int, round int) error {
+	timeout := time.Duration(h.audioAckConfig.TimeoutMs) * time.Millisecond
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	resends := 0
+	for h.audioAck.outstanding() > limit {
+		if h.audioPlaybackInterrupted(round) {
+			return nil
+		}
+		select {
+		case <-h.audioAck.ackCh:
+		case <-h.stopChan:
+			return nil
+		case <-timer.C:
+			if h.audioPlaybackInterrupted(round) {
+				return nil
+			}
+			if h.audioAckConfig.OnTimeout != "resend" || resends >= h.audioAckConfig.MaxResends {
+				return fmt.Errorf("等待音频确认超时，未确认帧数: %d", h.audioAck.outstanding())
+			}
+			resends++
+			frames := h.audioAck.unacked()
+			h.LogInfo(fmt.Sprintf("等待音频确认超时，第%d次重发%d个未确认帧", resends, len(frames)))
+			for _, packet := range frames {
+				if err := h.conn.WriteMessage(2, packet); err != nil {
+					return fmt.Errorf("重发音频帧失败: %v", err)
+				}
+			}
+			timer.Reset(timeout)
+		}
+	}
+	return nil
+}
+
+// audioPlaybackInterrupted 本轮播放是否已被打断或轮次已变化
+func (h *ConnectionHandler) audioPlaybackInterrupted(round int) bool {
+	return atomic.LoadInt32(&h.serverVoiceStop) == 1 || round != h.talkRound
+}
+
+// abortAudioPlayback 音频确认超时后中止本轮播放并通知设备停止
+func (h *ConnectionHandler) abortAudioPlayback(cause error) {
+	h.LogError(fmt.Sprintf("中止本轮音频播放: %v", cause))
+	h.audioAck.reset()
+	h.stopServerSpeak()
+	h.sendTTSMessage("stop", "", 0)
+	h.clearSpeakStatus()
+}
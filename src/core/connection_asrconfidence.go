@@ -0,0 +1,84 @@
+package core
+
+import (
+	"ai-server-go/src/core/providers"
+	"ai-server-go/src/core/utils"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+* ASR置信度检查：识别结果置信度低于阈值时不调用LLM，直接播报重说提示（"抱歉，我没有听清，请再说一遍"）。
+* 提供者返回置信度时（实现 providers.ConfidenceReporter，如豆包返回 confidence 时）按阈值判断；
+* 未返回置信度的提供者按启发式判断：去掉标点后为空或字数少于 min_chars 视为低置信度。
+* 配置：系统配置 asr_confidence 分类 < 设备 asr 能力中的 confidence 配置。
+ */
+
+// ASRConfidenceConfig ASR置信度检查配置
+type ASRConfidenceConfig struct {
+	Enabled      bool    `json:"enabled"`       // 是否启用置信度检查
+	Threshold    float64 `json:"threshold"`     // 置信度阈值(0-1)，低于该值时要求用户重说
+	MinChars     int     `json:"min_chars"`     // 无置信度时的最少有效字数
+	RepromptText string  `json:"reprompt_text"` // 要求用户重说的提示语
+}
+
+// DefaultASRConfidenceConfig 默认ASR置信度检查配置
+func DefaultASRConfidenceConfig() ASRConfidenceConfig {
+	return ASRConfidenceConfig{
+		Enabled:      false,
+		Threshold:    0.5,
+		MinChars:     1,
+		RepromptText: "抱歉，我没有听清，请再说一遍",
+	}
+}
+
+// applyMap 使用配置map覆盖置信度检查配置
+func (c *ASRConfidenceConfig) applyMap(config map[string]interface{}) {
+	if config == nil {
+		return
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, c)
+}
+
+// loadASRConfidenceConfig 加载ASR置信度检查配置：系统配置 asr_confidence 分类 < 设备 asr 能力中的 confidence 配置
+func (h *ConnectionHandler) loadASRConfidenceConfig(layered *layeredConfigSource) ASRConfidenceConfig {
+	config := DefaultASRConfidenceConfig()
+	layered.load("asr_confidence", "asr", "confidence", config.applyMap)
+
+	if strings.TrimSpace(config.RepromptText) == "" {
+		config.RepromptText = DefaultASRConfidenceConfig().RepromptText
+	}
+	return config
+}
+
+// isLowConfidence 判断识别结果是否置信度过低，返回判断依据用于日志
+func (h *ConnectionHandler) isLowConfidence(text string) (bool, string) {
+	config := h.asrConfidenceConfig
+	if reporter, ok := h.asrProvider().(providers.ConfidenceReporter); ok {
+		if confidence, ok := reporter.LastConfidence(); ok {
+			return confidence < config.Threshold, fmt.Sprintf("置信度 %.2f，阈值 %.2f", confidence, config.Threshold)
+		}
+	}
+	chars := utf8.RuneCountInString(strings.TrimSpace(utils.RemoveAllPunctuation(text)))
+	return chars == 0 || chars < config.MinChars, fmt.Sprintf("有效字数 %d，最少 %d", chars, config.MinChars)
+}
+
+// repromptOnLowConfidence 识别结果置信度过低时播报重说提示并返回true，调用方不再进入对话流程
+func (h *ConnectionHandler) repromptOnLowConfidence(text string) bool {
+	if !h.asrConfidenceConfig.Enabled || h.closeAfterChat || text == asrIdlePrompt {
+		return false
+	}
+	low, reason := h.isLowConfidence(text)
+	if !low {
+		return false
+	}
+	h.LogInfo(fmt.Sprintf("ASR识别结果置信度过低(%s)，要求用户重说: %s", reason, text))
+	h.SystemSpeak(h.asrConfidenceConfig.RepromptText)
+	return true
+}
@@ -0,0 +1,227 @@
+package core
+
+import (
+	"ai-server-go/src/core/types"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+/*
+* ASR纠错：根据上下文词表（记忆、设备信息、最近对话、自定义词）修正识别结果。
+* hotwords模式下将词表作为热词下发给支持的ASR提供者（豆包、腾讯）；
+* llm模式下识别完成后调用LLM按词表修正同音/近音错误，超时或结果异常时保留原文。
+ */
+
+// ASRCorrectionConfig ASR纠错配置
+type ASRCorrectionConfig struct {
+	Enabled     bool     `json:"enabled"`      // 是否启用纠错
+	Mode        string   `json:"mode"`         // hotwords, llm, both
+	Sources     []string `json:"sources"`      // 词表来源: memory, device, recent_turns, custom
+	Terms       []string `json:"terms"`        // 自定义词（custom来源）
+	MaxTerms    int      `json:"max_terms"`    // 词表最大词数
+	RecentTurns int      `json:"recent_turns"` // 参考的最近对话消息数
+	TimeoutMs   int      `json:"timeout_ms"`   // LLM纠错超时（毫秒）
+}
+
+// DefaultASRCorrectionConfig 默认ASR纠错配置
+func DefaultASRCorrectionConfig() ASRCorrectionConfig {
+	return ASRCorrectionConfig{
+		Enabled:     false,
+		Mode:        "hotwords",
+		Sources:     []string{"memory", "device", "recent_turns", "custom"},
+		MaxTerms:    50,
+		RecentTurns: 6,
+		TimeoutMs:   1500,
+	}
+}
+
+// applyMap 使用配置map覆盖纠错配置
+func (c *ASRCorrectionConfig) applyMap(config map[string]interface{}) {
+	if config == nil {
+		return
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, c)
+}
+
+// useHotwords 是否向ASR提供者下发热词
+func (c ASRCorrectionConfig) useHotwords() bool {
+	return c.Mode == "hotwords" || c.Mode == "both"
+}
+
+// useLLM 是否使用LLM纠错
+func (c ASRCorrectionConfig) useLLM() bool {
+	return c.Mode == "llm" || c.Mode == "both"
+}
+
+// hasSource 是否启用指定的词表来源
+func (c ASRCorrectionConfig) hasSource(source string) bool {
+	for _, s := range c.Sources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	latinTermPattern  = regexp.MustCompile(`[A-Za-z][A-Za-z0-9_\-]{2,}`)
+	quotedTermPattern = regexp.MustCompile(`[“"「『《]([^”"」』》]{2,12})[”"」』》]`)
+)
+
+// extractVocabularyTerms 从文本中提取候选专有名词：英文/拼写词和引号书名号中的词
+func extractVocabularyTerms(text string) []string {
+	terms := latinTermPattern.FindAllString(text, -1)
+	for _, match := range quotedTermPattern.FindAllStringSubmatch(text, -1) {
+		terms = append(terms, match[1])
+	}
+	return terms
+}
+
+// loadASRCorrectionConfig 加载ASR纠错配置：系统配置 asr_correction 分类 < 设备 asr 能力中的 correction 配置
+func (h *ConnectionHandler) loadASRCorrectionConfig(layered *layeredConfigSource) ASRCorrectionConfig {
+	config := DefaultASRCorrectionConfig()
+	layered.load("asr_correction", "asr", "correction", config.applyMap)
+	return config
+}
+
+// buildASRVocabulary 按配置的来源汇总上下文词表（去重并限制数量）
+func (h *ConnectionHandler) buildASRVocabulary() []string {
+	config := h.asrCorrectionConfig
+	seen := make(map[string]bool)
+	vocabulary := make([]string, 0, config.MaxTerms)
+	add := func(terms ...string) {
+		for _, term := range terms {
+			term = strings.TrimSpace(term)
+			if term == "" || seen[term] || (config.MaxTerms > 0 && len(vocabulary) >= config.MaxTerms) {
+				continue
+			}
+			seen[term] = true
+			vocabulary = append(vocabulary, term)
+		}
+	}
+
+	if config.hasSource("custom") {
+		add(config.Terms...)
+	}
+
+	deviceID := parseUint(h.deviceID)
+	if config.hasSource("device") && deviceID > 0 {
+		if h.deviceService != nil {
+			if device, err := h.deviceService.GetDeviceByID(deviceID); err == nil && device != nil {
+				add(device.DeviceName)
+			}
+		}
+		if h.configService != nil {
+			deviceConfig, err := h.configService.GetDeviceCapabilityConfigWithFallback(deviceID, h.userID)
+			if err == nil && deviceConfig != nil {
+				for _, capability := range deviceConfig.Capabilities {
+					add(getStringFromConfig(capability.Config, "wake_word"))
+					if words, ok := capability.Config["wake_words"].([]interface{}); ok {
+						for _, word := range words {
+							if str, ok := word.(string); ok {
+								add(str)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	if config.hasSource("memory") {
+		add(h.memoryVocabulary()...)
+	}
+
+	if config.hasSource("recent_turns") && h.dialogueManager != nil {
+		for _, msg := range h.recentDialogue(config.RecentTurns) {
+			add(extractVocabularyTerms(msg.Content)...)
+		}
+	}
+
+	return vocabulary
+}
+
+// recentDialogue 获取最近的用户/助手消息
+func (h *ConnectionHandler) recentDialogue(limit int) []types.Message {
+	dialogue := h.dialogueManager.GetLLMDialogue()
+	recent := make([]types.Message, 0, limit)
+	for i := len(dialogue) - 1; i >= 0 && len(recent) < limit; i-- {
+		if dialogue[i].Role == "user" || dialogue[i].Role == "assistant" {
+			recent = append([]types.Message{dialogue[i]}, recent...)
+		}
+	}
+	return recent
+}
+
+// correctASRResult 使用LLM按上下文词表修正识别结果，失败时返回原文
+func (h *ConnectionHandler) correctASRResult(text string) string {
+	config := h.asrCorrectionConfig
+	if !config.Enabled || !config.useLLM() || text == "" || h.llmProvider() == nil {
+		return text
+	}
+
+	vocabulary := h.buildASRVocabulary()
+	if len(vocabulary) == 0 {
+		return text
+	}
+
+	var history strings.Builder
+	for _, msg := range h.recentDialogue(config.RecentTurns) {
+		history.WriteString(fmt.Sprintf("%s: %s\n", msg.Role, msg.Content))
+	}
+
+	prompt := fmt.Sprintf("下面是一段语音识别结果，可能把专有名词识别成了同音或近音的错别字。"+
+		"请参考词表和最近的对话，只修正识别错误的词，不要改写句子、不要回答问题、不要添加标点以外的内容。"+
+		"如果没有错误，原样输出。只输出修正后的文本。\n\n词表：%s\n\n最近对话：\n%s\n识别结果：%s",
+		strings.Join(vocabulary, "、"), history.String(), text)
+
+	// 纠错发生在新一轮对话开始之前，使用下一轮的链路追踪ID
+	ctx, cancel := context.WithTimeout(h.requestContext(context.Background(), h.talkRound+1), time.Duration(config.TimeoutMs)*time.Millisecond)
+	defer cancel()
+
+	responses, err := h.llmProvider().Response(ctx, h.sessionID+"-asr-correction", []types.Message{
+		{Role: "user", Content: prompt},
+	})
+	if err != nil {
+		h.LogError(fmt.Sprintf("ASR纠错调用LLM失败: %v", err))
+		return text
+	}
+
+	var corrected strings.Builder
+	for {
+		select {
+		case content, ok := <-responses:
+			if !ok {
+				return h.acceptCorrection(text, strings.TrimSpace(corrected.String()))
+			}
+			corrected.WriteString(content)
+		case <-ctx.Done():
+			h.LogError(fmt.Sprintf("ASR纠错超时(%dms)，使用原始识别结果", config.TimeoutMs))
+			return text
+		}
+	}
+}
+
+// acceptCorrection 校验LLM纠错结果，长度变化过大视为改写，保留原文
+func (h *ConnectionHandler) acceptCorrection(original, corrected string) string {
+	if corrected == "" || corrected == original {
+		return original
+	}
+	originalLen := utf8.RuneCountInString(original)
+	correctedLen := utf8.RuneCountInString(corrected)
+	if correctedLen > originalLen*3/2+2 || correctedLen < originalLen/2 {
+		h.LogInfo(fmt.Sprintf("ASR纠错结果与原文差异过大，忽略: %s -> %s", original, corrected))
+		return original
+	}
+	h.LogInfo(fmt.Sprintf("ASR纠错: %s -> %s", original, corrected))
+	return corrected
+}
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"ai-server-go/src/core/providers"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+/*
+* 按语言选择ASR引擎：设备 asr 能力的 language_engines 把语言映射到识别引擎/模型（如腾讯 16k_en、豆包 bigmodel），
+* 每次开始收听前按当前语言下发给支持切换的提供者（实现 providers.EngineSelector），同一个provider配置即可服务多种语言。
+* 当前语言优先取设备在 listen 消息中声明的 language，其次按上一句识别结果的文字判断，初始为能力配置的 language。
+* 引擎不受提供者支持或语言没有映射时恢复提供者配置的默认引擎。
+ */
+
+// ASREngineConfig 按语言选择ASR引擎的配置
+type ASREngineConfig struct {
+	Language        string            // 初始语言，如 zh、en-US
+	LanguageEngines map[string]string // 语言 -> 引擎，"default" 为其他语言使用的引擎
+}
+
+// loadASREngineConfig 加载设备 asr 能力中的 language 和 language_engines
+func (h *ConnectionHandler) loadASREngineConfig() ASREngineConfig {
+	config := ASREngineConfig{LanguageEngines: make(map[string]string)}
+	if h.configService == nil || h.deviceID == "" {
+		return config
+	}
+	deviceConfig, err := h.configService.GetDeviceCapabilityConfigWithFallback(parseUint(h.deviceID), h.userID)
+	if err != nil || deviceConfig == nil {
+		return config
+	}
+	for _, capability := range deviceConfig.Capabilities {
+		if capability.CapabilityName != "asr" {
+			continue
+		}
+		if language, ok := capability.Config["language"].(string); ok {
+			config.Language = strings.TrimSpace(language)
+		}
+		if engines, ok := capability.Config["language_engines"].(map[string]interface{}); ok {
+			for language, engine := range engines {
+				if str, ok := engine.(string); ok && strings.TrimSpace(str) != "" {
+					config.LanguageEngines[strings.ToLower(strings.TrimSpace(language))] = strings.TrimSpace(str)
+				}
+			}
+		}
+	}
+	return config
+}
+
+// engineFor 语言对应的引擎：先精确匹配（如 en-us），再匹配主语言（en），最后使用 default
+func (c ASREngineConfig) engineFor(language string) string {
+	language = strings.ToLower(language)
+	if engine, ok := c.LanguageEngines[language]; ok {
+		return engine
+	}
+	if base, _, found := strings.Cut(language, "-"); found {
+		if engine, ok := c.LanguageEngines[base]; ok {
+			return engine
+		}
+	}
+	return c.LanguageEngines["default"]
+}
+
+// detectTextLanguage 按文字判断识别结果的语言，无法判断时返回空
+func detectTextLanguage(text string) string {
+	counts := make(map[string]int)
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			counts["ja"]++
+		case unicode.Is(unicode.Hangul, r):
+			counts["ko"]++
+		case unicode.Is(unicode.Han, r):
+			counts["zh"]++
+		case unicode.Is(unicode.Thai, r):
+			counts["th"]++
+		case unicode.Is(unicode.Cyrillic, r):
+			counts["ru"]++
+		case unicode.Is(unicode.Arabic, r):
+			counts["ar"]++
+		case unicode.Is(unicode.Latin, r):
+			counts["en"]++
+		}
+	}
+	// 日文夹杂汉字，出现假名即视为日文
+	if counts["ja"] > 0 {
+		return "ja"
+	}
+	language, best := "", 0
+	for _, candidate := range []string{"zh", "ko", "th", "ru", "ar", "en"} {
+		// 拉丁字母按单词粗略折算，避免中文夹杂英文单词时误判
+		count := counts[candidate]
+		if candidate == "en" {
+			count /= 3
+		}
+		if count > best {
+			language, best = candidate, count
+		}
+	}
+	return language
+}
+
+// setASRLanguage 更新当前语言，下一次开始收听时切换引擎
+func (h *ConnectionHandler) setASRLanguage(language, source string) {
+	language = strings.TrimSpace(language)
+	if language == "" || len(h.asrEngineConfig.LanguageEngines) == 0 || strings.EqualFold(language, h.asrLanguage) {
+		return
+	}
+	h.LogInfo(fmt.Sprintf("ASR语言切换为 %s（%s）", language, source))
+	h.asrLanguage = language
+}
+
+// observeASRLanguage 按识别结果判断用户使用的语言
+func (h *ConnectionHandler) observeASRLanguage(text string) {
+	if len(h.asrEngineConfig.LanguageEngines) == 0 {
+		return
+	}
+	h.setASRLanguage(detectTextLanguage(text), "识别结果")
+}
+
+// refreshASREngine 向支持切换引擎的ASR提供者下发当前语言对应的引擎，不支持的引擎恢复提供者默认值
+func (h *ConnectionHandler) refreshASREngine() {
+	if len(h.asrEngineConfig.LanguageEngines) == 0 {
+		return
+	}
+	selector, ok := h.asrProvider().(providers.EngineSelector)
+	if !ok {
+		return
+	}
+	language := h.asrLanguage
+	engine := h.asrEngineConfig.engineFor(language)
+	if err := selector.SelectEngine(language, engine); err != nil {
+		h.LogError(fmt.Sprintf("ASR引擎 %s（语言 %s）不可用，使用提供者默认引擎: %v，支持的引擎: %s",
+			engine, language, err, strings.Join(selector.SupportedEngines(), ", ")))
+		if err := selector.SelectEngine("", ""); err != nil {
+			h.LogError(fmt.Sprintf("恢复ASR默认引擎失败: %v", err))
+		}
+		return
+	}
+	h.logger.Debug("ASR引擎: %s，语言: %s", engine, language)
+}
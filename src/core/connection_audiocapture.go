@@ -0,0 +1,160 @@
+package core
+
+import (
+	"ai-server-go/src/core/utils"
+	"ai-server-go/src/database"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+/*
+* 调试用的音频采集：技术支持排查识别问题时，需要设备实际发送的音频。
+* 只有管理员在设备专属的 audio_capture 能力中同时设置 enabled=true 和 consent=true（已取得用户同意）时才采集，
+* 用户级和系统默认能力配置不能开启采集。采集的是送入ASR的PCM（重采样后），每段识别结果保存一段WAV，
+* 保留 retention_minutes 分钟后自动删除。系统配置 privacy.disable_audio_retention 开启时一律不采集。
+ */
+
+// audioCaptureMaxRetention 采集音频的最长保留时间
+const audioCaptureMaxRetention = 24 * time.Hour
+
+// AudioCaptureConfig 音频采集配置
+type AudioCaptureConfig struct {
+	Enabled          bool `json:"enabled"`           // 是否采集，只认设备专属能力配置
+	Consent          bool `json:"consent"`           // 是否已取得用户同意，未同意时不采集
+	RetentionMinutes int  `json:"retention_minutes"` // 采集音频的保留时长（分钟），最长24小时
+	MaxSeconds       int  `json:"max_seconds"`       // 单段音频最长秒数，超出时只保留末尾
+}
+
+// DefaultAudioCaptureConfig 默认音频采集配置
+func DefaultAudioCaptureConfig() AudioCaptureConfig {
+	return AudioCaptureConfig{
+		Enabled:          false,
+		Consent:          false,
+		RetentionMinutes: 30,
+		MaxSeconds:       30,
+	}
+}
+
+// applyMap 使用配置map覆盖音频采集配置
+func (c *AudioCaptureConfig) applyMap(config map[string]interface{}) {
+	if config == nil {
+		return
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, c)
+}
+
+// retention 采集音频的保留时长
+func (c AudioCaptureConfig) retention() time.Duration {
+	return min(time.Duration(max(c.RetentionMinutes, 1))*time.Minute, audioCaptureMaxRetention)
+}
+
+// loadAudioCaptureConfig 加载音频采集配置：系统配置 audio_capture 分类提供保留时长等默认值，
+// 开关只取设备专属的 audio_capture 能力配置
+func (h *ConnectionHandler) loadAudioCaptureConfig(layered *layeredConfigSource) AudioCaptureConfig {
+	config := DefaultAudioCaptureConfig()
+	layered.applySystem("audio_capture", config.applyMap)
+	config.Enabled, config.Consent = false, false
+	layered.applyCapability("audio_capture", "", func(capabilityConfig map[string]interface{}) {
+		if capabilityConfig["priority_source"] == "device" {
+			config.applyMap(capabilityConfig)
+		}
+	})
+	config.MaxSeconds = max(config.MaxSeconds, 1)
+	return config
+}
+
+// audioCaptureRecorder 当前一段语音的采集缓冲
+type audioCaptureRecorder struct {
+	mu  sync.Mutex
+	pcm []byte
+}
+
+// initAudioCapture 按配置决定本连接是否采集音频，开启时明确记录日志
+func (h *ConnectionHandler) initAudioCapture() {
+	config := h.audioCaptureConfig
+	if !config.Enabled {
+		return
+	}
+	if !config.Consent {
+		h.logger.Warn("设备 %s 的audio_capture已启用但未确认用户同意(consent)，不采集音频", h.deviceID)
+		return
+	}
+	if h.audioCaptureStore == nil {
+		h.logger.Warn("设备 %s 的audio_capture已启用，但音频存储不可用，不采集音频", h.deviceID)
+		return
+	}
+	if h.configService.AudioRetentionDisabled() {
+		h.logger.Warn("设备 %s 的audio_capture已启用，但全局隐私开关禁止保留音频，不采集音频", h.deviceID)
+		return
+	}
+	h.audioCapture = &audioCaptureRecorder{}
+	h.logger.Warn("设备 %s 已启用调试音频采集：会话 %s 的识别音频将保存 %d 分钟",
+		h.deviceID, h.sessionID, int(config.retention()/time.Minute))
+}
+
+// captureAudio 将送入ASR的PCM追加到采集缓冲，超过单段最长时长时丢弃开头
+func (h *ConnectionHandler) captureAudio(pcm []byte) {
+	recorder := h.audioCapture
+	if recorder == nil || len(pcm) == 0 {
+		return
+	}
+	limit := h.audioCaptureSampleRate() * 2 * h.audioCaptureConfig.MaxSeconds
+	recorder.mu.Lock()
+	recorder.pcm = append(recorder.pcm, pcm...)
+	if len(recorder.pcm) > limit {
+		recorder.pcm = recorder.pcm[len(recorder.pcm)-limit:]
+	}
+	recorder.mu.Unlock()
+}
+
+// flushAudioCapture 一段语音识别结束：有识别文本时保存采集的音频，并清空缓冲
+func (h *ConnectionHandler) flushAudioCapture(text string) {
+	recorder := h.audioCapture
+	if recorder == nil {
+		return
+	}
+	recorder.mu.Lock()
+	pcm := recorder.pcm
+	recorder.pcm = nil
+	recorder.mu.Unlock()
+	if text == "" || len(pcm) < 2 {
+		return
+	}
+
+	sampleRate := h.audioCaptureSampleRate()
+	go func() {
+		// 隐私开关可能在连接期间开启，每次保存前重新检查
+		if h.configService.AudioRetentionDisabled() {
+			return
+		}
+		capture := &database.AudioCapture{
+			DeviceID:   parseUint(h.deviceID),
+			UserID:     h.userID,
+			SessionID:  h.sessionID,
+			Text:       text,
+			SampleRate: sampleRate,
+			DurationMs: len(pcm) * 1000 / (sampleRate * 2),
+		}
+		wav := utils.EncodeWav(pcm, sampleRate, 1, 16)
+		if err := h.audioCaptureStore.SaveCapture(capture, wav, h.audioCaptureConfig.retention()); err != nil {
+			h.LogError(fmt.Sprintf("保存采集音频失败: %v", err))
+		}
+	}()
+}
+
+// audioCaptureSampleRate 采集音频的采样率，即送入ASR的采样率
+func (h *ConnectionHandler) audioCaptureSampleRate() int {
+	if h.asrResampler.Load() != nil {
+		return h.asrInputSampleRate()
+	}
+	if h.clientAudioSampleRate > 0 {
+		return h.clientAudioSampleRate
+	}
+	return defaultASRSampleRate
+}
@@ -0,0 +1,107 @@
+package core
+
+import (
+	"ai-server-go/src/core/utils"
+	"encoding/json"
+	"fmt"
+)
+
+/*
+* 输出音频质量：TTS合成的音频在下发前由服务端转码为Opus，码率和编码复杂度决定下发的流量和音质。
+* 按设备能力配置选择：走蜂窝网络的设备可以使用 low 档位节省流量，Wi-Fi 设备使用 high 档位。
+* 配置来自系统配置 audio_quality 分类，设备 audio_quality 能力配置可以覆盖；
+* profile 提供各档位的默认值，opus_bitrate/opus_complexity 显式配置时优先，超出范围时回退到档位默认值。
+* PCM格式不压缩，不受这些配置影响。
+ */
+
+// 输出音频质量档位
+const (
+	audioQualityLow      = "low"
+	audioQualityStandard = "standard"
+	audioQualityHigh     = "high"
+)
+
+// Opus编码参数的有效范围
+const (
+	minOpusBitrate    = 6000
+	maxOpusBitrate    = 510000
+	minOpusComplexity = 1
+	maxOpusComplexity = 10
+)
+
+// audioQualityProfiles 各档位的Opus编码参数，零值表示使用编码器默认值
+var audioQualityProfiles = map[string]utils.OpusEncodeOptions{
+	audioQualityLow:      {Bitrate: 12000, Complexity: 5},
+	audioQualityStandard: {},
+	audioQualityHigh:     {Bitrate: 32000, Complexity: 10},
+}
+
+// AudioQualityConfig 输出音频质量配置
+type AudioQualityConfig struct {
+	Profile        string `json:"profile"`         // 质量档位：low、standard、high
+	OpusBitrate    int    `json:"opus_bitrate"`    // Opus码率（bps），6000-510000，0表示使用档位默认值
+	OpusComplexity int    `json:"opus_complexity"` // Opus编码复杂度，1-10，0表示使用档位默认值
+}
+
+// DefaultAudioQualityConfig 默认输出音频质量配置
+func DefaultAudioQualityConfig() AudioQualityConfig {
+	return AudioQualityConfig{
+		Profile: audioQualityStandard,
+	}
+}
+
+// applyMap 使用配置map覆盖输出音频质量配置
+func (c *AudioQualityConfig) applyMap(config map[string]interface{}) {
+	if config == nil {
+		return
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, c)
+}
+
+// opusOptions 校验配置并解析出Opus编码参数，无效的档位和超出范围的值回退到默认值
+func (c AudioQualityConfig) opusOptions() (utils.OpusEncodeOptions, []string) {
+	var warnings []string
+	options, ok := audioQualityProfiles[c.Profile]
+	if !ok {
+		warnings = append(warnings, fmt.Sprintf("未知的音频质量档位 %q，使用 %s", c.Profile, audioQualityStandard))
+		options = audioQualityProfiles[audioQualityStandard]
+	}
+	if c.OpusBitrate != 0 {
+		if c.OpusBitrate >= minOpusBitrate && c.OpusBitrate <= maxOpusBitrate {
+			options.Bitrate = c.OpusBitrate
+		} else {
+			warnings = append(warnings, fmt.Sprintf("Opus码率 %d 超出范围（%d-%d），使用档位默认值", c.OpusBitrate, minOpusBitrate, maxOpusBitrate))
+		}
+	}
+	if c.OpusComplexity != 0 {
+		if c.OpusComplexity >= minOpusComplexity && c.OpusComplexity <= maxOpusComplexity {
+			options.Complexity = c.OpusComplexity
+		} else {
+			warnings = append(warnings, fmt.Sprintf("Opus编码复杂度 %d 超出范围（%d-%d），使用档位默认值", c.OpusComplexity, minOpusComplexity, maxOpusComplexity))
+		}
+	}
+	return options, warnings
+}
+
+// loadAudioQualityConfig 加载输出音频质量配置：系统配置 audio_quality 分类 < 设备 audio_quality 能力配置
+func (h *ConnectionHandler) loadAudioQualityConfig(layered *layeredConfigSource) AudioQualityConfig {
+	config := DefaultAudioQualityConfig()
+	layered.load("audio_quality", "audio_quality", "", config.applyMap)
+	return config
+}
+
+// initAudioQuality 解析本连接使用的Opus编码参数
+func (h *ConnectionHandler) initAudioQuality() {
+	options, warnings := h.audioQualityConfig.opusOptions()
+	for _, warning := range warnings {
+		h.LogError(warning)
+	}
+	h.opusOptions = options
+	if options != (utils.OpusEncodeOptions{}) {
+		h.LogInfo(fmt.Sprintf("输出音频质量: %s，Opus码率 %d，复杂度 %d", h.audioQualityConfig.Profile, options.Bitrate, options.Complexity))
+	}
+}
@@ -0,0 +1,251 @@
+package core
+
+import (
+	"ai-server-go/src/core/providers/vad"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+/*
+* 打断（barge-in）检测：在服务端播放TTS期间继续监听客户端音频，
+* 能量超过阈值的声音持续达到最短语音时长后，再由会话的VAD模型判断这段声音的语音概率，达到概率阈值才触发打断；
+* 设备未配置 vad 能力（或VAD模型创建失败）时不启用打断，避免仅凭能量把回声和背景噪声当作插话。
+* 回声抑制：播放开始后的保护期内不检测，并跟踪播放期间的回声能量基线，
+* 只有明显高于回声基线的声音才被视为插话，避免被设备自身播放的声音打断。
+ */
+
+const bargeInPlaybackTail = 600 * time.Millisecond // 最后一帧发出后仍视为播放中的时长
+
+// BargeInConfig 打断检测配置
+type BargeInConfig struct {
+	Enabled              bool    `json:"enabled"`               // 是否启用播放期间打断
+	EnergyThreshold      float64 `json:"energy_threshold"`      // 归一化RMS能量阈值（0-1）
+	ProbabilityThreshold float64 `json:"probability_threshold"` // VAD语音概率阈值（0-1）
+	MinSpeechMs          int     `json:"min_speech_ms"`         // 触发打断的最短连续语音时长（毫秒）
+	EchoGuardMs          int     `json:"echo_guard_ms"`         // 播放开始后的回声保护期（毫秒）
+	EchoMargin           float64 `json:"echo_margin"`           // 语音能量需高于回声基线的倍数
+}
+
+// DefaultBargeInConfig 默认打断检测配置
+func DefaultBargeInConfig() BargeInConfig {
+	return BargeInConfig{
+		Enabled:              false,
+		EnergyThreshold:      0.05,
+		ProbabilityThreshold: 0.6,
+		MinSpeechMs:          300,
+		EchoGuardMs:          300,
+		EchoMargin:           2.0,
+	}
+}
+
+// applyMap 使用配置map覆盖打断检测配置
+func (c *BargeInConfig) applyMap(config map[string]interface{}) {
+	if config == nil {
+		return
+	}
+	if v, ok := config["enabled"].(bool); ok {
+		c.Enabled = v
+	}
+	if v := getFloatFromConfig(config, "energy_threshold"); v > 0 {
+		c.EnergyThreshold = v
+	}
+	if v := getFloatFromConfig(config, "probability_threshold"); v > 0 {
+		c.ProbabilityThreshold = v
+	}
+	if v := getIntFromConfig(config, "min_speech_ms"); v > 0 {
+		c.MinSpeechMs = v
+	}
+	if v := getIntFromConfig(config, "echo_guard_ms"); v > 0 {
+		c.EchoGuardMs = v
+	}
+	if v := getFloatFromConfig(config, "echo_margin"); v > 0 {
+		c.EchoMargin = v
+	}
+}
+
+// BargeInDetector 播放期间的打断检测器
+type BargeInDetector struct {
+	config   BargeInConfig
+	vadModel vad.VadModel // 判断候选语音的语音概率，为nil时不触发打断
+
+	mu             sync.Mutex
+	playbackStart  time.Time // 本段播放开始时间
+	lastPlayback   time.Time // 最后一次下发音频帧的时间
+	echoFloor      float64   // 播放期间的回声能量基线
+	speechDuration time.Duration
+	speech         []float32 // 本次超过能量阈值的连续音频，达到最短语音时长后交给VAD判断
+}
+
+// NewBargeInDetector 创建打断检测器，vadModel 为nil时不触发打断
+func NewBargeInDetector(config BargeInConfig, vadModel vad.VadModel) *BargeInDetector {
+	return &BargeInDetector{config: config, vadModel: vadModel}
+}
+
+// MarkPlayback 记录服务端下发了一帧音频
+func (d *BargeInDetector) MarkPlayback() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	if now.Sub(d.lastPlayback) > bargeInPlaybackTail {
+		// 新一段播放开始，重置回声基线和语音计时
+		d.playbackStart = now
+		d.echoFloor = 0
+		d.speechDuration = 0
+		d.speech = nil
+	}
+	d.lastPlayback = now
+}
+
+// Close 释放VAD模型
+func (d *BargeInDetector) Close() error {
+	if d.vadModel == nil {
+		return nil
+	}
+	return d.vadModel.Close()
+}
+
+// isPlaying 是否处于播放期间（需持有锁）
+func (d *BargeInDetector) isPlaying(now time.Time) bool {
+	return !d.lastPlayback.IsZero() && now.Sub(d.lastPlayback) <= bargeInPlaybackTail
+}
+
+// Process 处理一段客户端PCM音频（16bit小端），返回是否应触发打断
+func (d *BargeInDetector) Process(pcm []byte, sampleRate int) bool {
+	if !d.config.Enabled || d.vadModel == nil || len(pcm) < 2 || sampleRate <= 0 {
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	if !d.isPlaying(now) {
+		d.speechDuration = 0
+		d.speech = nil
+		return false
+	}
+	// 回声保护期：设备回声消除尚未收敛，不做判断
+	if now.Sub(d.playbackStart) < time.Duration(d.config.EchoGuardMs)*time.Millisecond {
+		return false
+	}
+
+	samples := pcmToFloat32(pcm)
+	frameDuration := time.Duration(len(samples)) * time.Second / time.Duration(sampleRate)
+	energy := rmsEnergy(samples)
+
+	threshold := d.config.EnergyThreshold
+	if echoThreshold := d.echoFloor * d.config.EchoMargin; echoThreshold > threshold {
+		threshold = echoThreshold
+	}
+
+	if energy < threshold {
+		// 非语音帧视为回声/背景，更新回声基线
+		if d.echoFloor == 0 {
+			d.echoFloor = energy
+		} else {
+			d.echoFloor = d.echoFloor*0.95 + energy*0.05
+		}
+		d.speechDuration = 0
+		d.speech = nil
+		return false
+	}
+
+	d.speechDuration += frameDuration
+	d.speech = append(d.speech, samples...)
+	if d.speechDuration < time.Duration(d.config.MinSpeechMs)*time.Millisecond {
+		return false
+	}
+
+	// 能量足够且持续够久，再由VAD判断是否为人声，回声和背景噪声不触发打断
+	speech := d.speech
+	d.speechDuration = 0
+	d.speech = nil
+	prob, err := d.vadModel.GetSpeechProbability(speech)
+	if err != nil || float64(prob) < d.config.ProbabilityThreshold {
+		return false
+	}
+	d.lastPlayback = time.Time{}
+	return true
+}
+
+// pcmToFloat32 将16bit小端PCM转换为[-1,1]的浮点采样
+func pcmToFloat32(pcm []byte) []float32 {
+	samples := make([]float32, len(pcm)/2)
+	for i := range samples {
+		samples[i] = float32(int16(binary.LittleEndian.Uint16(pcm[i*2:]))) / 32768.0
+	}
+	return samples
+}
+
+// rmsEnergy 计算归一化RMS能量
+func rmsEnergy(samples []float32) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, s := range samples {
+		sum += float64(s) * float64(s)
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
+
+// loadBargeInConfig 加载打断检测配置：系统配置 barge_in 分类 < 设备 vad 能力中的 barge_in 配置
+func (h *ConnectionHandler) loadBargeInConfig(layered *layeredConfigSource) BargeInConfig {
+	config := DefaultBargeInConfig()
+	layered.load("barge_in", "vad", "barge_in", config.applyMap)
+
+	// 通过功能开关按设备灰度放量
+	if config.Enabled && h.configService != nil && !h.configService.IsFeatureEnabled("barge_in", h.deviceID) {
+		h.LogInfo("设备未命中barge_in功能开关，关闭播放期间打断")
+		config.Enabled = false
+	}
+	return config
+}
+
+// newBargeInDetector 按配置创建打断检测器，使用设备 vad 能力配置的VAD模型判断语音概率；
+// 没有可用的VAD模型时关闭打断
+func (h *ConnectionHandler) newBargeInDetector(layered *layeredConfigSource) *BargeInDetector {
+	config := h.loadBargeInConfig(layered)
+	if !config.Enabled {
+		return NewBargeInDetector(config, nil)
+	}
+	model, err := h.newVadModel(layered)
+	if err != nil {
+		h.LogError(fmt.Sprintf("播放期间打断需要VAD模型，已关闭打断: %v", err))
+		config.Enabled = false
+	}
+	return NewBargeInDetector(config, model)
+}
+
+// newVadModel 按设备 vad 能力配置创建VAD模型
+func (h *ConnectionHandler) newVadModel(layered *layeredConfigSource) (vad.VadModel, error) {
+	for _, capability := range layered.capabilities {
+		if capability.CapabilityName != "vad" || !capability.IsEnabled {
+			continue
+		}
+		return vad.CreateModel(capability.CapabilityType, &vad.Config{
+			Type:      capability.CapabilityType,
+			ModelDir:  getStringFromConfig(capability.Config, "model_dir"),
+			Threshold: getFloatFromConfig(capability.Config, "threshold"),
+			Extra:     capability.Config,
+		}, h.logger)
+	}
+	return nil, fmt.Errorf("设备未配置vad能力")
+}
+
+// checkBargeIn 检测播放期间的用户插话，确认后打断当前播放
+func (h *ConnectionHandler) checkBargeIn(pcm []byte) {
+	if h.bargeInDetector == nil || h.listenMode() == "manual" {
+		return
+	}
+	if !h.bargeInDetector.Process(pcm, h.clientAudioSampleRate) {
+		return
+	}
+	h.LogInfo(fmt.Sprintf("检测到用户在播放期间插话，打断当前播放，轮次: %d", h.talkRound))
+	if err := h.clientAbortChat(); err != nil {
+		h.LogError(fmt.Sprintf("打断播放失败: %v", err))
+	}
+}
@@ -0,0 +1,161 @@
+package core
+
+import (
+	"ai-server-go/src/core/auth"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+* 设备认证：启用 server.auth 后，设备需要认证才能对话。
+* 挑战-应答模式下，服务端在hello回复中下发一次性nonce，设备用auth_secret计算
+* HMAC-SHA256(nonce + ":" + device_id) 并通过 {"type":"auth"} 消息返回，服务端校验签名，
+* nonce只能使用一次，防止截获的握手被重放。迁移期间可通过 server.auth.challenge
+* 继续接受静态token（Authorization: Bearer <token>）。
+ */
+
+const (
+	challengeOff      = "off"      // 仅静态token（兼容旧设备）
+	challengeOptional = "optional" // 静态token和挑战-应答均可
+	challengeRequired = "required" // 仅挑战-应答
+
+	defaultChallengeTTL = 60 * time.Second
+)
+
+var (
+	deviceNonceStore     *auth.NonceStore
+	deviceNonceStoreOnce sync.Once
+)
+
+// getDeviceNonceStore 进程内共享的nonce存储，有效期取自首次使用时的配置
+func (h *ConnectionHandler) getDeviceNonceStore() *auth.NonceStore {
+	deviceNonceStoreOnce.Do(func() {
+		ttl := defaultChallengeTTL
+		if h.config.Server.Auth.ChallengeTTL > 0 {
+			ttl = time.Duration(h.config.Server.Auth.ChallengeTTL) * time.Second
+		}
+		deviceNonceStore = auth.NewNonceStore(ttl)
+	})
+	return deviceNonceStore
+}
+
+// challengeMode 当前挑战-应答模式
+func (h *ConnectionHandler) challengeMode() string {
+	switch strings.ToLower(h.config.Server.Auth.Challenge) {
+	case challengeOptional:
+		return challengeOptional
+	case challengeRequired:
+		return challengeRequired
+	default:
+		return challengeOff
+	}
+}
+
+// verifyPlainToken 校验连接头中的静态token（挑战-应答为required时不接受）
+func (h *ConnectionHandler) verifyPlainToken() bool {
+	if !h.config.Server.Auth.Enabled || h.challengeMode() == challengeRequired {
+		return false
+	}
+	token := strings.TrimSpace(strings.TrimPrefix(h.headers["Authorization"], "Bearer "))
+	if token == "" {
+		return false
+	}
+	for _, allowed := range h.config.Server.Auth.Tokens {
+		if allowed.Token != "" && allowed.Token == token {
+			return true
+		}
+	}
+	return false
+}
+
+// issueAuthChallenge 需要挑战-应答认证时签发nonce，返回放入hello回复的auth字段
+func (h *ConnectionHandler) issueAuthChallenge() map[string]interface{} {
+	if !h.isNeedAuth() || h.challengeMode() == challengeOff {
+		return nil
+	}
+	store := h.getDeviceNonceStore()
+	nonce, err := store.Issue()
+	if err != nil {
+		h.LogError(fmt.Sprintf("生成认证nonce失败: %v", err))
+		return nil
+	}
+	h.authNonce = nonce
+	return map[string]interface{}{
+		"nonce":      nonce,
+		"algorithm":  "hmac-sha256",
+		"expires_in": int(store.TTL().Seconds()),
+	}
+}
+
+// handleAuthMessage 校验设备对nonce的签名
+func (h *ConnectionHandler) handleAuthMessage(msgMap map[string]interface{}) error {
+	if !h.isNeedAuth() {
+		return h.sendAuthResult(true, "")
+	}
+	if h.challengeMode() == challengeOff {
+		return h.sendAuthResult(false, "未启用挑战-应答认证")
+	}
+
+	nonce := getStringFromConfig(msgMap, "nonce")
+	authKey := getStringFromConfig(msgMap, "auth_key")
+	signature := getStringFromConfig(msgMap, "signature")
+	if nonce == "" || authKey == "" || signature == "" {
+		return h.rejectAuth("认证消息缺少nonce、auth_key或signature")
+	}
+	if nonce != h.authNonce {
+		return h.rejectAuth("nonce与本连接签发的不一致")
+	}
+	h.authNonce = ""
+	if err := h.getDeviceNonceStore().Consume(nonce); err != nil {
+		return h.rejectAuth(err.Error())
+	}
+
+	if h.deviceService == nil {
+		return h.rejectAuth("设备认证服务不可用")
+	}
+	deviceAuth, err := h.deviceService.GetActiveDeviceAuth(authKey)
+	if err != nil {
+		return h.rejectAuth(err.Error())
+	}
+	if deviceAuth == nil || deviceAuth.AuthSecret == "" {
+		return h.rejectAuth("认证Key无效或已过期")
+	}
+	if err := auth.VerifyDeviceChallenge(deviceAuth.AuthSecret, deviceAuth.DeviceID, h.deviceID, nonce, signature); err != nil {
+		return h.rejectAuth(err.Error())
+	}
+
+	h.isDeviceVerified = true
+	h.LogInfo(fmt.Sprintf("设备挑战-应答认证成功, auth_key: %s", authKey))
+	return h.sendAuthResult(true, "")
+}
+
+// rejectAuth 认证失败：通知设备后关闭连接，避免在同一连接上反复尝试
+func (h *ConnectionHandler) rejectAuth(reason string) error {
+	h.LogError(fmt.Sprintf("设备挑战-应答认证失败: %s", reason))
+	if err := h.sendAuthResult(false, reason); err != nil {
+		h.LogError(fmt.Sprintf("发送认证结果失败: %v", err))
+	}
+	h.conn.Close()
+	return fmt.Errorf("设备认证失败: %s", reason)
+}
+
+// sendAuthResult 发送认证结果
+func (h *ConnectionHandler) sendAuthResult(success bool, message string) error {
+	state := "success"
+	if !success {
+		state = "failed"
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"type":       "auth",
+		"state":      state,
+		"session_id": h.sessionID,
+		"message":    message,
+	})
+	if err != nil {
+		return fmt.Errorf("序列化认证结果失败: %v", err)
+	}
+	return h.conn.WriteMessage(1, data)
+}
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"ai-server-go/src/core/utils"
+	"encoding/json"
+	"fmt"
+)
+
+/*
+* 提示音（earcon）：助手开口前播放一段短提示音。两种方式：
+*   audio   - 服务端把提示音音频拼接在每轮回复第一句的音频流前面；
+*   message - 服务端在第一句前下发 {"type":"tts","state":"earcon"} 消息，由设备播放内置提示音。
+* 配置来自系统配置 earcon 分类，设备 earcon 能力配置可以覆盖；本轮已播放快速回复（唤醒应答）时跳过。
+ */
+
+// EarconConfig 提示音配置
+type EarconConfig struct {
+	Enabled bool   `json:"enabled"` // 是否播放提示音
+	Mode    string `json:"mode"`    // audio（服务端拼接音频）或 message（设备播放内置提示音）
+	File    string `json:"file"`    // audio 模式使用的提示音文件路径（wav/mp3）
+	Name    string `json:"name"`    // message 模式下发给设备的提示音名称
+}
+
+// DefaultEarconConfig 默认提示音配置
+func DefaultEarconConfig() EarconConfig {
+	return EarconConfig{
+		Enabled: false,
+		Mode:    "audio",
+		Name:    "default",
+	}
+}
+
+// applyMap 使用配置map覆盖提示音配置
+func (c *EarconConfig) applyMap(config map[string]interface{}) {
+	if config == nil {
+		return
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, c)
+}
+
+// loadEarconConfig 加载提示音配置：系统配置 earcon 分类 < 设备 earcon 能力配置
+func (h *ConnectionHandler) loadEarconConfig(layered *layeredConfigSource) EarconConfig {
+	config := DefaultEarconConfig()
+	layered.load("earcon", "earcon", "", config.applyMap)
+
+	if config.Enabled && config.Mode == "audio" && config.File == "" {
+		h.LogError("提示音为audio模式但未配置file，已关闭提示音")
+		config.Enabled = false
+	}
+	return config
+}
+
+// markEarconPlayed 标记本轮已播放提示音或快速回复，后续分段不再播放提示音
+func (h *ConnectionHandler) markEarconPlayed(round int) {
+	h.earconRound = round
+}
+
+// takeEarcon 本轮首句播放前调用，需要播放提示音时返回true并标记本轮已播放
+func (h *ConnectionHandler) takeEarcon(textIndex int, round int) bool {
+	if !h.earconConfig.Enabled || textIndex != 1 || h.earconRound == round {
+		return false
+	}
+	h.markEarconPlayed(round)
+	return true
+}
+
+// earconFrames 获取按当前音频格式编码的提示音帧，按格式缓存
+func (h *ConnectionHandler) earconFrames() ([][]byte, error) {
+	if h.earconAudio != nil && h.earconFormat == h.serverAudioFormat {
+		return h.earconAudio, nil
+	}
+
+	var frames [][]byte
+	var err error
+	if h.serverAudioFormat == "pcm" {
+		frames, _, err = utils.AudioToPCMData(h.earconConfig.File)
+	} else {
+		frames, _, err = utils.AudioToOpusDataWithOptions(h.earconConfig.File, h.opusOptions)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("加载提示音 %s 失败: %v", h.earconConfig.File, err)
+	}
+	h.earconAudio = frames
+	h.earconFormat = h.serverAudioFormat
+	return frames, nil
+}
+
+// sendEarconMessage 通知设备播放内置提示音
+func (h *ConnectionHandler) sendEarconMessage() error {
+	msg := map[string]interface{}{
+		"type":       "tts",
+		"state":      "earcon",
+		"session_id": h.sessionID,
+		"earcon":     h.earconConfig.Name,
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("序列化提示音消息失败: %v", err)
+	}
+	if err := h.conn.WriteMessage(1, data); err != nil {
+		return fmt.Errorf("发送提示音消息失败: %v", err)
+	}
+	return nil
+}
+
+// prependEarcon 本轮首句前播放提示音：message 模式下发控制消息，audio 模式把提示音帧拼接在音频前
+func (h *ConnectionHandler) prependEarcon(audioData [][]byte, textIndex int, round int) [][]byte {
+	if !h.takeEarcon(textIndex, round) {
+		return audioData
+	}
+
+	if h.earconConfig.Mode == "message" {
+		if err := h.sendEarconMessage(); err != nil {
+			h.LogError(err.Error())
+		}
+		return audioData
+	}
+
+	frames, err := h.earconFrames()
+	if err != nil {
+		h.LogError(err.Error())
+		return audioData
+	}
+	combined := make([][]byte, 0, len(frames)+len(audioData))
+	combined = append(combined, frames...)
+	return append(combined, audioData...)
+}
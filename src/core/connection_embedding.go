@@ -0,0 +1,56 @@
+package core
+
+import (
+	"ai-server-go/src/core/providers/embedding"
+	"ai-server-go/src/core/utils"
+	"ai-server-go/src/database"
+)
+
+/*
+* 记忆向量化：记忆服务通过 EMBEDDING 类别的 provider 配置（设备 > 用户 > 系统默认）
+* 独立解析向量化模型，不复用对话LLM，便于使用低成本的专用embedding模型。
+* 未配置时记忆服务保持原有的关键词/重要性查询。
+ */
+
+// embeddingCategory 向量化提供者的配置类别
+const embeddingCategory = "EMBEDDING"
+
+// initMemoryEmbedder 为记忆服务解析并设置向量化提供者
+func initMemoryEmbedder(configService *database.ConfigService, memoryService *database.ChatMemoryService, deviceID uint, userID *uint, logger *utils.Logger) {
+	if configService == nil || memoryService == nil {
+		return
+	}
+
+	var devicePtr *uint
+	if deviceID > 0 {
+		devicePtr = &deviceID
+	}
+	providerConfig, err := configService.GetEffectiveProvider(embeddingCategory, devicePtr, userID)
+	if err != nil {
+		logger.Warn("查询Embedding提供者配置失败，记忆使用关键词查询: %v", err)
+		return
+	}
+	if providerConfig == nil {
+		return
+	}
+
+	provider, err := newEmbeddingProvider(providerConfig)
+	if err != nil {
+		logger.Warn("创建Embedding提供者失败，记忆使用关键词查询: %v", err)
+		return
+	}
+	memoryService.SetEmbedder(provider)
+	logger.Info("记忆向量检索已启用: %s/%s", providerConfig.Name, providerConfig.Type)
+}
+
+// newEmbeddingProvider 根据provider配置创建向量化提供者
+func newEmbeddingProvider(providerConfig *database.ProviderConfig) (embedding.Provider, error) {
+	extra, err := providerConfig.PropsMap()
+	if err != nil {
+		return nil, err
+	}
+	return embedding.Create(providerConfig.Type, &embedding.Config{
+		Type:  providerConfig.Type,
+		Extra: extra,
+	})
+}
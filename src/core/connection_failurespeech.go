@@ -0,0 +1,209 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+* 失败提示语：ASR、LLM、TTS 出错时，向设备播报一句可配置的提示语（如“抱歉，我现在无法回答”），
+* 避免设备没有任何反馈。提示语来自系统配置 failure_speech 分类，设备 failure_speech 能力配置可以覆盖
+* （按设备配置不同语言的提示语）。TTS 本身可能正是出错的环节，所以提示语优先使用预先准备好的音频：
+*   1. 配置的音频文件（asr_file/llm_file/tts_file）；
+*   2. 连接建立时用当前TTS预先合成并保存在快速回复缓存目录中的音频；
+*   3. 都没有时，ASR/LLM失败改为实时合成，TTS失败则无法播报。
+* 每种失败在同一轮对话中只播报一次。
+ */
+
+// 失败类型
+const (
+	failureASR = "asr"
+	failureLLM = "llm"
+	failureTTS = "tts"
+)
+
+// FailureSpeechConfig 失败提示语配置
+type FailureSpeechConfig struct {
+	Enabled bool   `json:"enabled"`  // 是否在provider失败时播报提示语
+	Prewarm bool   `json:"prewarm"`  // 连接建立时是否预先合成没有预录音频的提示语
+	ASR     string `json:"asr"`      // 语音识别失败时的提示语
+	LLM     string `json:"llm"`      // 生成回复失败时的提示语
+	TTS     string `json:"tts"`      // 语音合成失败时的提示语
+	ASRFile string `json:"asr_file"` // 语音识别失败提示语的预录音频（wav/mp3），为空时使用预合成缓存
+	LLMFile string `json:"llm_file"` // 生成回复失败提示语的预录音频
+	TTSFile string `json:"tts_file"` // 语音合成失败提示语的预录音频
+}
+
+// DefaultFailureSpeechConfig 默认失败提示语配置
+func DefaultFailureSpeechConfig() FailureSpeechConfig {
+	return FailureSpeechConfig{
+		Enabled: true,
+		Prewarm: true,
+		ASR:     "抱歉，我没有听清，请再说一遍",
+		LLM:     "抱歉，我现在无法回答",
+		TTS:     "抱歉，我现在无法回答",
+	}
+}
+
+// applyMap 使用配置map覆盖失败提示语配置
+func (c *FailureSpeechConfig) applyMap(config map[string]interface{}) {
+	if config == nil {
+		return
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, c)
+}
+
+// message 失败类型对应的提示语和预录音频
+func (c FailureSpeechConfig) message(kind string) (string, string) {
+	switch kind {
+	case failureASR:
+		return c.ASR, c.ASRFile
+	case failureLLM:
+		return c.LLM, c.LLMFile
+	case failureTTS:
+		return c.TTS, c.TTSFile
+	}
+	return "", ""
+}
+
+// loadFailureSpeechConfig 加载失败提示语配置：系统配置 failure_speech 分类 < 设备 failure_speech 能力配置
+func (h *ConnectionHandler) loadFailureSpeechConfig(layered *layeredConfigSource) FailureSpeechConfig {
+	config := DefaultFailureSpeechConfig()
+	layered.load("failure_speech", "failure_speech", "", config.applyMap)
+	return config
+}
+
+// failureSpeechState 各失败类型最近一次播报提示语的对话轮次
+type failureSpeechState struct {
+	mu     sync.Mutex
+	spoken map[string]int
+}
+
+// take 本轮尚未播报过该类失败时返回true并记录
+func (s *failureSpeechState) take(kind string, round int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.spoken == nil {
+		s.spoken = make(map[string]int)
+	}
+	if last, ok := s.spoken[kind]; ok && last == round {
+		return false
+	}
+	s.spoken[kind] = round
+	return true
+}
+
+// prewarmFailureSpeech 后台用当前TTS预先合成没有预录音频的提示语，保存到快速回复缓存目录
+func (h *ConnectionHandler) prewarmFailureSpeech() {
+	config := h.failureSpeechConfig
+	if !config.Enabled || !config.Prewarm || h.ttsProvider() == nil || h.quickReplyCache == nil {
+		return
+	}
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				h.LogError(fmt.Sprintf("预合成失败提示语发生panic: %v", r))
+			}
+		}()
+		for _, kind := range []string{failureASR, failureLLM, failureTTS} {
+			text, file := config.message(kind)
+			if text == "" || file != "" || h.quickReplyCache.FindCachedAudio(text) != "" {
+				continue
+			}
+			filepath, err := h.ttsProvider().ToTTS(h.ctx, text)
+			if err != nil {
+				h.logger.Warn("预合成失败提示语失败: %s %v", text, err)
+				continue
+			}
+			if err := h.quickReplyCache.SaveCachedAudio(text, filepath); err != nil {
+				h.logger.Warn("缓存失败提示语音频失败: %v", err)
+			}
+			h.deleteAudioFileIfNeeded(filepath, "缓存失败提示语后")
+		}
+	}()
+}
+
+// failureClip 失败提示语的预备音频：优先使用预录音频文件，其次使用预合成缓存，没有时返回空
+func (h *ConnectionHandler) failureClip(kind string) (string, string) {
+	text, file := h.failureSpeechConfig.message(kind)
+	if file != "" {
+		if _, err := os.Stat(file); err == nil {
+			return text, file
+		}
+		h.LogError(fmt.Sprintf("失败提示语音频 %s 不存在", file))
+	}
+	if h.quickReplyCache != nil && text != "" {
+		return text, h.quickReplyCache.FindCachedAudio(text)
+	}
+	return text, ""
+}
+
+// isFailureSpeechFile 是否为配置的预录提示语音频，播放后不能删除
+func (h *ConnectionHandler) isFailureSpeechFile(filepath string) bool {
+	config := h.failureSpeechConfig
+	return filepath != "" && (filepath == config.ASRFile || filepath == config.LLMFile || filepath == config.TTSFile)
+}
+
+// speakFailure ASR或LLM失败时播报提示语，返回播报的文本；未启用或本轮已播报时返回空
+func (h *ConnectionHandler) speakFailure(kind string, round int) string {
+	if !h.failureSpeechConfig.Enabled || !h.failureSpeech.take(kind, round) {
+		return ""
+	}
+	text, clip := h.failureClip(kind)
+	if text == "" {
+		return ""
+	}
+	h.LogInfo(fmt.Sprintf("%s失败，播报提示语: %s", kind, text))
+
+	if kind == failureASR {
+		h.sendTTSMessage("start", "", 0)
+	}
+	atomic.StoreInt32(&h.serverVoiceStop, 0)
+	if clip == "" {
+		// 没有预备音频，尝试实时合成
+		h.setLastTextIndex(1)
+		h.SpeakAndPlay(text, 1, round)
+		return text
+	}
+	h.setLastTextIndex(1)
+	h.audioMessagesQueue <- struct {
+		filepath  string
+		text      string
+		round     int
+		textIndex int
+	}{clip, text, round, 1}
+	return text
+}
+
+// failureClipForTTS TTS合成失败时替代的提示语音频，只使用预备音频，每轮只替代一次
+func (h *ConnectionHandler) failureClipForTTS(round int) (string, string) {
+	if !h.failureSpeechConfig.Enabled {
+		return "", ""
+	}
+	text, clip := h.failureClip(failureTTS)
+	if clip == "" || !h.failureSpeech.take(failureTTS, round) {
+		return "", ""
+	}
+	h.LogInfo(fmt.Sprintf("TTS失败，播报预备的提示语: %s", text))
+	return text, clip
+}
+
+// endRoundWithFailure 生成回复失败时播报提示语；不播报时直接结束本轮播报状态，返回播报的文本
+func (h *ConnectionHandler) endRoundWithFailure(kind string, round int) string {
+	h.recordStageError(kind)
+	if text := h.speakFailure(kind, round); text != "" {
+		return text
+	}
+	if round == h.talkRound {
+		h.sendTTSMessage("stop", "", 0)
+		h.clearSpeakStatus()
+	}
+	return ""
+}
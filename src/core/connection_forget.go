@@ -0,0 +1,169 @@
+package core
+
+import (
+	"ai-server-go/src/database"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+/*
+* 遗忘指令：用户说出配置的遗忘短语（如“忘记所有事情”）时，清空当前会话的对话上下文，
+* 删除该设备和该用户的全部长期记忆（含待重试生成的记忆），并播报确认语。
+* 为避免误删，识别结果去掉标点、空格并忽略大小写后必须与短语完全一致才会命中，不做包含匹配；
+* confirm 开启时先播报确认提问，只有下一句在 confirm_seconds 内与确认短语完全一致才执行，
+* 说出取消短语时播报取消回复，其他内容视为放弃并照常进入对话流程。
+* 配置来自系统配置 forget_command 分类，设备 forget_command 能力配置可以覆盖。每次清除都写入设备事件。
+ */
+
+// ForgetCommandConfig 遗忘指令配置
+type ForgetCommandConfig struct {
+	Enabled        bool     `json:"enabled"`         // 是否启用遗忘指令
+	Phrases        []string `json:"phrases"`         // 触发短语，需与识别结果完全一致
+	Confirm        bool     `json:"confirm"`         // 是否需要用户再次确认
+	ConfirmPrompt  string   `json:"confirm_prompt"`  // 确认提问
+	ConfirmPhrases []string `json:"confirm_phrases"` // 确认短语
+	CancelPhrases  []string `json:"cancel_phrases"`  // 取消短语
+	ConfirmSeconds int      `json:"confirm_seconds"` // 等待确认的时长（秒）
+	Reply          string   `json:"reply"`           // 清除完成后的回复语
+	CancelReply    string   `json:"cancel_reply"`    // 取消后的回复语
+}
+
+// DefaultForgetCommandConfig 默认遗忘指令配置
+func DefaultForgetCommandConfig() ForgetCommandConfig {
+	return ForgetCommandConfig{
+		Enabled:        false,
+		Phrases:        []string{"忘记所有事情", "忘掉所有事情", "忘记关于我的一切"},
+		Confirm:        true,
+		ConfirmPrompt:  "确定要让我忘记关于你的所有记忆吗？请说“确定”或“取消”。",
+		ConfirmPhrases: []string{"确定", "确认", "是的"},
+		CancelPhrases:  []string{"取消", "不要", "算了"},
+		ConfirmSeconds: 30,
+		Reply:          "好的，我已经忘记了之前的所有内容。",
+		CancelReply:    "好的，已取消。",
+	}
+}
+
+// applyMap 使用配置map覆盖遗忘指令配置
+func (c *ForgetCommandConfig) applyMap(config map[string]interface{}) {
+	if config == nil {
+		return
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, c)
+}
+
+// loadForgetCommandConfig 加载遗忘指令配置：系统配置 forget_command 分类 < 设备 forget_command 能力配置
+func (h *ConnectionHandler) loadForgetCommandConfig(layered *layeredConfigSource) ForgetCommandConfig {
+	config := DefaultForgetCommandConfig()
+	layered.load("forget_command", "forget_command", "", config.applyMap)
+	config.ConfirmSeconds = max(config.ConfirmSeconds, 1)
+	return config
+}
+
+// matchExactPhrase 识别结果规范化后是否与任一短语完全一致
+func matchExactPhrase(text string, phrases []string) bool {
+	normalized := normalizeIntentText(text)
+	if normalized == "" {
+		return false
+	}
+	for _, phrase := range phrases {
+		if normalizeIntentText(phrase) == normalized {
+			return true
+		}
+	}
+	return false
+}
+
+// handleForgetCommand 识别结果为遗忘指令或对确认提问的回答时处理；返回是否已处理，未处理时照常进入对话流程
+func (h *ConnectionHandler) handleForgetCommand(text string) bool {
+	config := h.forgetCommandConfig
+	if !config.Enabled {
+		return false
+	}
+
+	if !h.forgetPendingUntil.IsZero() {
+		pending := time.Now().Before(h.forgetPendingUntil)
+		h.forgetPendingUntil = time.Time{}
+		if pending {
+			switch {
+			case matchExactPhrase(text, config.ConfirmPhrases):
+				h.forgetEverything(text)
+				return true
+			case matchExactPhrase(text, config.CancelPhrases):
+				h.LogInfo("用户取消遗忘指令")
+				h.speakFixedReply(text, config.CancelReply)
+				return true
+			}
+			h.LogInfo("遗忘指令未得到确认，已放弃")
+		}
+	}
+
+	if !matchExactPhrase(text, config.Phrases) {
+		return false
+	}
+	if !config.Confirm {
+		h.forgetEverything(text)
+		return true
+	}
+	h.LogInfo(fmt.Sprintf("收到遗忘指令: \"%s\"，等待用户确认", text))
+	h.forgetPendingUntil = time.Now().Add(time.Duration(config.ConfirmSeconds) * time.Second)
+	h.speakFixedReply(text, config.ConfirmPrompt)
+	return true
+}
+
+// forgetEverything 清空对话上下文，删除设备和用户的长期记忆，并播报确认语
+func (h *ConnectionHandler) forgetEverything(text string) {
+	// 先清空上下文再结算上一轮，结算时不会再从旧对话生成记忆
+	if h.dialogueManager != nil {
+		var systemMessage string
+		if dialogue := h.dialogueManager.GetLLMDialogue(); len(dialogue) > 0 && dialogue[0].Role == "system" {
+			systemMessage = dialogue[0].Content
+		}
+		h.dialogueManager.Clear()
+		h.dialogueManager.SetSystemMessage(systemMessage)
+	}
+	h.finishTurn()
+
+	var forgotten int64
+	if h.memoryService != nil && h.deviceID != "" {
+		var err error
+		forgotten, err = h.memoryService.ForgetMemories(h.userID, parseUint(h.deviceID))
+		if err != nil {
+			h.LogError(fmt.Sprintf("遗忘指令删除记忆失败: %v", err))
+		}
+	}
+	h.LogInfo(fmt.Sprintf("遗忘指令: 已清空对话上下文，删除记忆 %d 条", forgotten))
+	h.recordForget(text, forgotten)
+	h.speakFixedReply(text, h.forgetCommandConfig.Reply)
+}
+
+// recordForget 将清除记录写入设备事件
+func (h *ConnectionHandler) recordForget(text string, forgotten int64) {
+	if h.deviceService == nil {
+		return
+	}
+	details, _ := json.Marshal(map[string]interface{}{
+		"text":     text,
+		"memories": forgotten,
+		"user_id":  h.userID,
+	})
+	event := &database.DeviceEvent{
+		DeviceID:  parseUint(h.deviceID),
+		DeviceKey: h.deviceID,
+		SessionID: h.sessionID,
+		Level:     "info",
+		Category:  "forget_command",
+		Code:      "memory_cleared",
+		Message:   fmt.Sprintf("用户通过语音指令清除了对话上下文和%d条记忆", forgotten),
+		Details:   string(details),
+	}
+	go func() {
+		if err := h.deviceService.SaveDeviceEvent(event); err != nil {
+			h.LogError(fmt.Sprintf("保存遗忘指令记录失败: %v", err))
+		}
+	}()
+}
@@ -0,0 +1,174 @@
+package core
+
+import (
+	"ai-server-go/src/core/providers"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/*
+* 开场问候：玩具类设备在会话开始时主动和用户打招呼。收到设备的hello消息后，
+* 在用户开口之前合成并下发一句问候：static 模式从配置的问候语中随机选一句，
+* llm 模式按人设提示词由LLM生成。默认关闭，通过系统配置 greeting 分类或设备 greeting 能力开启；
+* 免打扰时段按设备时区计算，期间不问候；恢复的会话（断线重连）不再重复问候。
+ */
+
+// 开场问候模式
+const (
+	greetingModeStatic = "static"
+	greetingModeLLM    = "llm"
+)
+
+// GreetingConfig 开场问候配置
+type GreetingConfig struct {
+	Enabled         bool     `json:"enabled"`           // 是否启用
+	Mode            string   `json:"mode"`              // static：使用配置的问候语；llm：由LLM按人设生成
+	Texts           []string `json:"texts"`             // static 模式的问候语，随机选择一句
+	Prompt          string   `json:"prompt"`            // llm 模式发给LLM的问候指令
+	DelayMs         int      `json:"delay_ms"`          // 收到hello后等待多久再问候（毫秒），留给设备准备播放
+	QuietHoursStart string   `json:"quiet_hours_start"` // 免打扰开始时间 HH:MM，为空表示不限制
+	QuietHoursEnd   string   `json:"quiet_hours_end"`   // 免打扰结束时间 HH:MM
+	Timezone        string   `json:"timezone"`          // 设备时区（IANA名称），为空时使用服务器时区
+}
+
+// DefaultGreetingConfig 默认开场问候配置
+func DefaultGreetingConfig() GreetingConfig {
+	return GreetingConfig{
+		Enabled: false,
+		Mode:    greetingModeStatic,
+		Texts:   []string{"你好呀，我在呢，想聊点什么？"},
+		Prompt:  "用户刚刚打开设备，还没有说话。请按照你的人设，用一句简短、自然、友好的话和用户打招呼。",
+		DelayMs: 500,
+	}
+}
+
+// applyMap 使用配置map覆盖开场问候配置
+func (c *GreetingConfig) applyMap(config map[string]interface{}) {
+	if config == nil {
+		return
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, c)
+}
+
+// text static 模式随机选择一句问候语，没有可用的问候语时返回空
+func (c GreetingConfig) text() string {
+	var texts []string
+	for _, text := range c.Texts {
+		if text = strings.TrimSpace(text); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	if len(texts) == 0 {
+		return ""
+	}
+	return texts[rand.Intn(len(texts))]
+}
+
+// loadGreetingConfig 加载开场问候配置：系统配置 greeting 分类 < 设备 greeting 能力配置
+func (h *ConnectionHandler) loadGreetingConfig(layered *layeredConfigSource) GreetingConfig {
+	config := DefaultGreetingConfig()
+	layered.load("greeting", "greeting", "", config.applyMap)
+	return config
+}
+
+// scheduleGreeting 收到hello后安排开场问候，每个连接最多问候一次
+func (h *ConnectionHandler) scheduleGreeting() {
+	config := h.greetingConfig
+	if !config.Enabled {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&h.greeted, 0, 1) {
+		return
+	}
+	if h.sessionResumed {
+		h.LogInfo("恢复的会话，跳过开场问候")
+		return
+	}
+	go h.greet(config)
+}
+
+// greet 等待设备就绪后播放问候，用户已经开口或当前不适合问候时跳过
+func (h *ConnectionHandler) greet(config GreetingConfig) {
+	defer func() {
+		if r := recover(); r != nil {
+			h.LogError(fmt.Sprintf("开场问候发生panic: %v", r))
+		}
+	}()
+
+	select {
+	case <-time.After(time.Duration(max(config.DelayMs, 0)) * time.Millisecond):
+	case <-h.stopChan:
+		return
+	case <-h.ctx.Done():
+		return
+	}
+
+	if h.talkRound > 0 {
+		return
+	}
+	// 回环测试、翻译和听写模式下不问候
+	if h.loopbackMode != "" || h.currentConversationMode() != conversationModeAssistant {
+		return
+	}
+	if h.isNeedAuth() || h.setupPendingMessage != "" || (h.configService != nil && h.configService.GetMaintenanceStatus().Enabled) {
+		return
+	}
+	if inQuietHours(time.Now(), config.QuietHoursStart, config.QuietHoursEnd, config.Timezone) {
+		h.LogInfo("免打扰时段，跳过开场问候")
+		return
+	}
+
+	if err := h.startGreetingTurn(config); err != nil {
+		h.LogError(fmt.Sprintf("开场问候失败: %v", err))
+	}
+}
+
+// startGreetingTurn 播放开场问候：static 模式审核后合成问候语并写入对话历史，
+// llm 模式以问候指令运行一轮LLM→TTS，指令本身不写入对话历史
+func (h *ConnectionHandler) startGreetingTurn(config GreetingConfig) error {
+	h.touchActivity()
+	h.talkRound++
+	h.roundStartTime = time.Now()
+	currentRound := h.talkRound
+
+	if config.Mode == greetingModeLLM {
+		h.LogInfo(fmt.Sprintf("由LLM生成开场问候, 轮次: %d", currentRound))
+		if err := h.sendTTSMessage("start", "", 0); err != nil {
+			return fmt.Errorf("发送TTS开始状态失败: %v", err)
+		}
+		messages := append(h.dialogueManager.GetLLMDialogue(), providers.Message{
+			Role:    "system",
+			Content: config.Prompt,
+		})
+		return h.genResponseByLLM(context.Background(), messages, currentRound)
+	}
+
+	text := config.text()
+	if text == "" {
+		return fmt.Errorf("没有配置问候语")
+	}
+	h.LogInfo(fmt.Sprintf("开场问候: %s, 轮次: %d", text, currentRound))
+	if err := h.sendTTSMessage("start", "", 0); err != nil {
+		return fmt.Errorf("发送TTS开始状态失败: %v", err)
+	}
+	// 问候语可由设备能力配置，与LLM回复一样经过审核并由同一路径保存
+	moderationState := &responseModeration{}
+	if notice, allowed := h.moderateSegment(h.requestContext(context.Background(), currentRound), moderationState, text); !allowed {
+		moderationState.original = text
+		text = notice
+	}
+	if text == "" {
+		return nil
+	}
+	h.putAssistantReply(moderationState, text)
+	return h.SystemSpeak(text)
+}
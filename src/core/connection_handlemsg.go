@@ -4,6 +4,7 @@ import (
 	"ai-server-go/src/core/chat"
 	"ai-server-go/src/core/image"
 	"ai-server-go/src/core/providers"
+	"ai-server-go/src/core/types"
 	"ai-server-go/src/core/utils"
 	"context"
 	"encoding/json"
@@ -16,17 +17,19 @@ import (
 func (h *ConnectionHandler) handleMessage(messageType int, message []byte) error {
 	switch messageType {
 	case 1: // 文本消息
+		h.touchActivity()
 		h.clientTextQueue <- string(message)
 		return nil
 	case 2: // 二进制消息（音频数据）
 		if h.clientAudioFormat == "pcm" {
 			// 直接将PCM数据放入队列
+			h.checkBargeIn(message)
 			h.clientAudioQueue <- message
 		} else if h.clientAudioFormat == "opus" {
 			// 检查是否初始化了opus解码器
-			if h.opusDecoder != nil {
+			if decoder := h.opusDecoder.Load(); decoder != nil {
 				// 解码opus数据为PCM
-				decodedData, err := h.opusDecoder.Decode(message)
+				decodedData, err := decoder.Decode(message)
 				if err != nil {
 					h.logger.Error(fmt.Sprintf("解码Opus音频失败: %v", err))
 					// 即使解码失败，也尝试将原始数据传递给ASR处理
@@ -35,6 +38,7 @@ func (h *ConnectionHandler) handleMessage(messageType int, message []byte) error
 					// 解码成功，将PCM数据放入队列
 					h.logger.Debug(fmt.Sprintf("Opus解码成功: %d bytes -> %d bytes", len(message), len(decodedData)))
 					if len(decodedData) > 0 {
+						h.checkBargeIn(decodedData)
 						h.clientAudioQueue <- decodedData
 					}
 				}
@@ -92,6 +96,14 @@ func (h *ConnectionHandler) processClientTextMessage(ctx context.Context, text s
 		return h.handleImageMessage(ctx, msgMap)
 	case "mcp":
 		return h.mcpManager.HandleXiaoZhiMCPMessage(msgMap)
+	case "telemetry":
+		return h.handleTelemetryMessage(msgMap)
+	case "auth":
+		return h.handleAuthMessage(msgMap)
+	case "ack":
+		return h.handleAckMessage(msgMap)
+	case "mode":
+		return h.handleModeMessage(msgMap)
 	default:
 		return fmt.Errorf("未知的消息类型: %s", msgType)
 	}
@@ -134,6 +146,10 @@ func (h *ConnectionHandler) handleHelloMessage(msgMap map[string]interface{}) er
 			h.clientAudioFrameDuration = int(frameDuration)
 		}
 	}
+	h.negotiateAudioAck(msgMap)
+	h.negotiateTextStream(msgMap)
+	h.negotiateLoopback(msgMap)
+	h.setupASRResampler()
 	h.sendHelloMessage()
 	h.closeOpusDecoder()
 	// 初始化opus解码器
@@ -144,13 +160,22 @@ func (h *ConnectionHandler) handleHelloMessage(msgMap map[string]interface{}) er
 	if err != nil {
 		h.logger.Error(fmt.Sprintf("初始化Opus解码器失败: %v", err))
 	} else {
-		h.opusDecoder = opusDecoder
+		h.opusDecoder.Store(opusDecoder)
 		h.LogInfo("Opus解码器初始化成功")
 	}
+	h.scheduleGreeting()
 
 	return nil
 }
 
+// listenMode 客户端拾音模式，设备未声明时为auto
+func (h *ConnectionHandler) listenMode() string {
+	if mode := h.clientListenMode.Load(); mode != nil {
+		return *mode
+	}
+	return "auto"
+}
+
 // handleListenMessage 处理语音相关消息
 func (h *ConnectionHandler) handleListenMessage(msgMap map[string]interface{}) error {
 
@@ -162,21 +187,38 @@ func (h *ConnectionHandler) handleListenMessage(msgMap map[string]interface{}) e
 
 	// 处理mode参数
 	if mode, ok := msgMap["mode"].(string); ok {
-		h.clientListenMode = mode
-		h.LogInfo(fmt.Sprintf("客户端拾音模式：%s， %s", h.clientListenMode, state))
-		h.providers.asr.SetListener(h)
+		h.clientListenMode.Store(&mode)
+		h.LogInfo(fmt.Sprintf("客户端拾音模式：%s， %s", h.listenMode(), state))
+		h.asrProvider().SetListener(h)
 	}
 
 	switch state {
 	case "start":
-		if h.client_asr_text != "" && h.clientListenMode == "manual" {
+		if h.client_asr_text != "" && h.listenMode() == "manual" {
 			h.clientAbortChat()
 		}
 		h.clientVoiceStop = false
 		h.client_asr_text = ""
+		h.applyProviderOverrides(true)
+		h.resetASRDeadline()
+		h.refreshASRHotwords()
+		// 设备可在listen消息中声明本次说话的语言（如设备端已做语种识别）
+		if language, ok := msgMap["language"].(string); ok {
+			h.setASRLanguage(language, "设备声明")
+		}
+		h.refreshASREngine()
+		h.refreshASRRequestContext()
+		if h.loopbackMode == loopbackModeEcho {
+			h.loopback.take()
+		}
 	case "stop":
 		h.clientVoiceStop = true
 		h.LogInfo("客户端停止语音识别")
+		if h.loopbackMode == loopbackModeEcho {
+			go h.playLoopback()
+		} else if h.listenMode() == "manual" {
+			h.armASRDeadline()
+		}
 	case "detect":
 		// 检查是否包含图片数据
 		imageBase64, hasImage := msgMap["image"].(string)
@@ -236,12 +278,23 @@ func (h *ConnectionHandler) handleImageWithText(ctx context.Context, imageData i
 		return nil
 	}
 
+	// 维护模式下拒绝新的对话轮次
+	if h.rejectForMaintenance() {
+		return nil
+	}
+
 	// 检查是否有VLLLM Provider
-	if h.providers.vlllm == nil {
+	if h.vlllmProvider() == nil {
 		h.logger.Warn("未配置VLLLM服务，图片消息将降级为文本处理")
 		return h.handleChatMessage(ctx, text+" (注：无法处理图片，仅处理文本)")
 	}
 
+	// 图片内容审核（默认关闭）
+	ctx, imageData, allowed := h.screenImage(ctx, imageData)
+	if !allowed {
+		return nil
+	}
+
 	h.LogInfo(fmt.Sprint("开始处理图片+文本消息 %v", map[string]interface{}{
 		"text":        text,
 		"has_data":    imageData.Data != "",
@@ -281,25 +334,16 @@ func (h *ConnectionHandler) handleImageWithText(ctx context.Context, imageData i
 		return fmt.Errorf("发送情绪消息失败: %v", err)
 	}
 
-	// 添加用户消息到对话历史（包含图片信息的描述）
-	userMessage := fmt.Sprintf("%s [用户发送了一张图片]", text)
+	// 获取对话历史（当前图片消息由VLLLM单独构造，历史图片通过附件还原）
+	messages := h.getVisionHistory()
+
+	// 添加用户消息到对话历史（携带图片附件）
 	h.dialogueManager.Put(chat.Message{
-		Role:    "user",
-		Content: userMessage,
+		Role:        "user",
+		Content:     text,
+		Attachments: h.imageHistoryAttachments(imageData),
 	})
 
-	// 获取对话历史（排除当前图片消息）
-	messages := make([]providers.Message, 0)
-	for _, msg := range h.dialogueManager.GetLLMDialogue() {
-		if msg.Role == "user" && strings.Contains(msg.Content, "[用户发送了一张图片]") {
-			continue
-		}
-		messages = append(messages, providers.Message{
-			Role:    msg.Role,
-			Content: msg.Content,
-		})
-	}
-
 	// 使用VLLLM处理图片消息
 	return h.genResponseByVLLM(ctx, messages, imageData, text, currentRound)
 }
@@ -336,8 +380,13 @@ func (h *ConnectionHandler) handleImageMessage(ctx context.Context, msgMap map[s
 		return nil
 	}
 
+	// 维护模式下拒绝新的对话轮次
+	if h.rejectForMaintenance() {
+		return nil
+	}
+
 	// 检查是否有VLLLM Provider
-	if h.providers.vlllm == nil {
+	if h.vlllmProvider() == nil {
 		h.logger.Warn("未配置VLLLM服务，图片消息将被忽略")
 		return h.conn.WriteMessage(1, []byte("系统暂不支持图片处理功能"))
 	}
@@ -370,6 +419,12 @@ func (h *ConnectionHandler) handleImageMessage(ctx context.Context, msgMap map[s
 		return fmt.Errorf("图片数据为空")
 	}
 
+	// 图片内容审核（默认关闭）
+	ctx, imageData, allowed := h.screenImage(ctx, imageData)
+	if !allowed {
+		return nil
+	}
+
 	h.LogInfo(fmt.Sprintf("收到图片消息 %v", map[string]interface{}{
 		"text":        text,
 		"has_url":     imageData.URL != "",
@@ -397,25 +452,55 @@ func (h *ConnectionHandler) handleImageMessage(ctx context.Context, msgMap map[s
 		return fmt.Errorf("发送情绪消息失败: %v", err)
 	}
 
-	// 添加用户消息到对话历史（包含图片信息的描述）
-	userMessage := fmt.Sprintf("%s [用户发送了一张%s格式的图片]", text, imageData.Format)
+	// 获取对话历史（当前图片消息由VLLLM单独构造，历史图片通过附件还原）
+	messages := h.getVisionHistory()
+
+	// 添加用户消息到对话历史（携带图片附件）
 	h.dialogueManager.Put(chat.Message{
-		Role:    "user",
-		Content: userMessage,
+		Role:        "user",
+		Content:     text,
+		Attachments: h.imageHistoryAttachments(imageData),
 	})
 
-	// 获取对话历史
-	messages := make([]providers.Message, 0)
-	for _, msg := range h.dialogueManager.GetLLMDialogue() {
-		// 排除包含图片信息的最后一条消息，因为我们要用VLLLM处理
-		if msg.Role == "user" && strings.Contains(msg.Content, "[用户发送了一张") {
-			continue
-		}
+	return h.genResponseByVLLM(ctx, messages, imageData, text, currentRound)
+}
+
+// getVisionHistory 获取发送给VLLLM的对话历史，保留历史消息中的图片附件
+func (h *ConnectionHandler) getVisionHistory() []providers.Message {
+	dialogue := h.dialogueManager.GetLLMDialogue()
+	messages := make([]providers.Message, 0, len(dialogue))
+	for _, msg := range dialogue {
 		messages = append(messages, providers.Message{
-			Role:    msg.Role,
-			Content: msg.Content,
+			Role:        msg.Role,
+			Content:     msg.Content,
+			Attachments: msg.Attachments,
 		})
 	}
+	return messages
+}
 
-	return h.genResponseByVLLM(ctx, messages, imageData, text, currentRound)
+// imageAttachments 将图片数据转换为消息附件
+func imageAttachments(imageData image.ImageData) []types.Attachment {
+	format := strings.ToLower(imageData.Format)
+	if format == "" || format == "jpg" {
+		format = "jpeg"
+	}
+	mimeType := "image/" + format
+
+	ref := imageData.URL
+	if ref == "" && imageData.Data != "" {
+		if strings.HasPrefix(imageData.Data, "data:") {
+			ref = imageData.Data
+		} else {
+			ref = fmt.Sprintf("data:%s;base64,%s", mimeType, imageData.Data)
+		}
+	}
+	if ref == "" {
+		return nil
+	}
+	return []types.Attachment{{
+		Type:     "image",
+		Ref:      ref,
+		MimeType: mimeType,
+	}}
 }
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"ai-server-go/src/core/providers"
+	"strings"
+)
+
+/*
+* ASR热词：向支持热词偏置的ASR提供者（豆包、腾讯、讯飞）下发设备相关词汇（产品名、联系人等），
+* 不支持的提供者忽略。词表由系统配置 asr_hotwords 分类和设备 asr 能力中的 hotwords 静态列表、
+* 可选的用户记忆词汇以及 ASR 纠错词表（hotwords/both 模式）组成，按提供者上限截断。
+ */
+
+// memoryVocabularyLimit 提取记忆词汇时参考的记忆条数
+const memoryVocabularyLimit = 20
+
+// ASRHotwordsConfig ASR热词配置
+type ASRHotwordsConfig struct {
+	Words      []string // 静态热词
+	FromMemory bool     // 是否加入用户记忆中的词汇
+}
+
+// loadASRHotwordsConfig 加载ASR热词配置：系统配置 asr_hotwords 分类 + 设备 asr 能力中的 hotwords/hotwords_from_memory
+func (h *ConnectionHandler) loadASRHotwordsConfig() ASRHotwordsConfig {
+	config := ASRHotwordsConfig{}
+	if h.configService == nil {
+		return config
+	}
+
+	if words, err := h.configService.GetSystemConfigArray("asr_hotwords", "words"); err == nil {
+		config.Words = append(config.Words, words...)
+	}
+	if fromMemory, err := h.configService.GetSystemConfigBool("asr_hotwords", "from_memory"); err == nil {
+		config.FromMemory = fromMemory
+	}
+
+	if h.deviceID != "" {
+		deviceConfig, err := h.configService.GetDeviceCapabilityConfigWithFallback(parseUint(h.deviceID), h.userID)
+		if err == nil && deviceConfig != nil {
+			for _, capability := range deviceConfig.Capabilities {
+				if capability.CapabilityName != "asr" {
+					continue
+				}
+				if words, ok := capability.Config["hotwords"].([]interface{}); ok {
+					for _, word := range words {
+						if str, ok := word.(string); ok {
+							config.Words = append(config.Words, str)
+						}
+					}
+				}
+				if fromMemory, ok := capability.Config["hotwords_from_memory"].(bool); ok {
+					config.FromMemory = fromMemory
+				}
+			}
+		}
+	}
+	return config
+}
+
+// memoryVocabulary 从用户/设备的有效记忆中提取词汇（标签和专有名词）
+func (h *ConnectionHandler) memoryVocabulary() []string {
+	deviceID := parseUint(h.deviceID)
+	if h.memoryService == nil || deviceID == 0 {
+		return nil
+	}
+	memories, err := h.memoryService.ListActiveMemories(h.userID, deviceID, memoryVocabularyLimit)
+	if err != nil {
+		return nil
+	}
+	var terms []string
+	for _, memory := range memories {
+		terms = append(terms, strings.Split(memory.Tags, ",")...)
+		terms = append(terms, extractVocabularyTerms(memory.Content)...)
+	}
+	return terms
+}
+
+// buildASRHotwords 汇总热词（静态词优先），去重后截断到limit个，limit<=0表示不限制
+func (h *ConnectionHandler) buildASRHotwords(limit int) []string {
+	config := h.asrHotwordsConfig
+	seen := make(map[string]bool)
+	var hotwords []string
+	add := func(terms ...string) {
+		for _, term := range terms {
+			term = strings.TrimSpace(term)
+			if term == "" || seen[term] || (limit > 0 && len(hotwords) >= limit) {
+				continue
+			}
+			seen[term] = true
+			hotwords = append(hotwords, term)
+		}
+	}
+
+	add(config.Words...)
+	if config.FromMemory {
+		add(h.memoryVocabulary()...)
+	}
+	if h.asrCorrectionConfig.Enabled && h.asrCorrectionConfig.useHotwords() {
+		add(h.buildASRVocabulary()...)
+	}
+	return hotwords
+}
+
+// refreshASRHotwords 向支持热词的ASR提供者下发最新词表；未启用或词表为空时清空提供者上已有的热词
+func (h *ConnectionHandler) refreshASRHotwords() {
+	setter, ok := h.asrProvider().(providers.HotwordSetter)
+	if !ok {
+		return
+	}
+	config := h.asrHotwordsConfig
+	correction := h.asrCorrectionConfig.Enabled && h.asrCorrectionConfig.useHotwords()
+	if len(config.Words) == 0 && !config.FromMemory && !correction {
+		setter.SetHotwords(nil)
+		return
+	}
+
+	limit := 0
+	if limiter, ok := h.asrProvider().(providers.HotwordLimiter); ok {
+		limit = limiter.MaxHotwords()
+	}
+	hotwords := h.buildASRHotwords(limit)
+	setter.SetHotwords(hotwords)
+	h.logger.Debug("已更新ASR热词 %d 个", len(hotwords))
+}
@@ -0,0 +1,113 @@
+package core
+
+import (
+	"ai-server-go/src/core/image"
+	"ai-server-go/src/core/moderation"
+	"ai-server-go/src/core/types"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+/*
+* 图片内容审核：默认关闭。启用后设备发送的base64图片在写入对话历史和发送给VLLLM之前审核，
+* 超过阈值时拒绝（播报提示语，不调用视觉模型）或马赛克处理后继续；URL图片通过context把审核钩子
+* 交给图片处理器，在下载和安全验证之后审核，且不写入历史附件，避免后续轮次绕过审核直接发送给视觉模型。
+* 审核服务失败时记录日志并放行，严格模式(strict)下视为拒绝。
+ */
+
+// initImageModeration 加载图片审核配置：系统配置 image_moderation 分类 < 用户/设备的 image_moderation 能力配置
+func (h *ConnectionHandler) initImageModeration() {
+	config := moderation.LoadImageConfig(h.configService, parseUint(h.deviceID), h.userID)
+	h.imageModerationConfig = config
+	if !config.Enabled {
+		return
+	}
+
+	moderator, err := moderation.NewImageModerator(config)
+	if err != nil {
+		h.logger.Error("创建图片审核器失败，图片审核不可用: %v", err)
+		return
+	}
+	h.imageModerator = moderator
+	h.LogInfo(fmt.Sprintf("图片内容审核已启用: provider=%s, threshold=%.2f, action=%s, strict=%t",
+		config.Provider, config.Threshold, config.Action, config.Strict))
+}
+
+// imageScreener 以连接的图片审核配置实现 image.Screener
+type imageScreener struct {
+	h *ConnectionHandler
+}
+
+// Screen 实现 image.Screener
+func (s imageScreener) Screen(ctx context.Context, imageData image.ImageData) (image.ImageData, error) {
+	return s.h.screenImageData(ctx, imageData)
+}
+
+// screenImageData 审核图片并按结论拒绝或替换为马赛克处理后的图片
+func (h *ConnectionHandler) screenImageData(ctx context.Context, imageData image.ImageData) (image.ImageData, error) {
+	if h.imageModerator == nil {
+		return imageData, nil
+	}
+	encoded := imageData.Data
+	if i := strings.Index(encoded, ";base64,"); strings.HasPrefix(encoded, "data:") && i >= 0 {
+		encoded = encoded[i+len(";base64,"):]
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return imageData, fmt.Errorf("解码图片失败: %v", err)
+	}
+
+	decision, err := moderation.CheckImage(ctx, h.imageModerator, h.imageModerationConfig, data, imageData.Format)
+	if err != nil {
+		h.LogError(fmt.Sprintf("图片内容审核失败(strict=%t): %v", h.imageModerationConfig.Strict, err))
+	}
+	switch decision.Action {
+	case moderation.ImageActionReject:
+		h.LogInfo(fmt.Sprintf("图片被内容审核拒绝: score=%.2f, flags=%v", decision.Result.Score, decision.Result.Flags))
+		return imageData, image.ErrImageRejected
+	case moderation.ImageActionBlur:
+		h.LogInfo(fmt.Sprintf("图片经内容审核做马赛克处理: score=%.2f, flags=%v", decision.Result.Score, decision.Result.Flags))
+		return image.ImageData{
+			Data:   base64.StdEncoding.EncodeToString(decision.Data),
+			Format: decision.Format,
+		}, nil
+	}
+	return imageData, nil
+}
+
+// screenImage 图片写入对话历史前的审核：base64图片直接审核，URL图片把审核钩子放入context交给图片处理器。
+// 图片被拒绝时播报提示语并返回false，调用方不再处理该图片
+func (h *ConnectionHandler) screenImage(ctx context.Context, imageData image.ImageData) (context.Context, image.ImageData, bool) {
+	if h.imageModerator == nil {
+		return ctx, imageData, true
+	}
+	if imageData.Data == "" {
+		return image.WithScreener(ctx, imageScreener{h: h}), imageData, true
+	}
+
+	screened, err := h.screenImageData(ctx, imageData)
+	if errors.Is(err, image.ErrImageRejected) {
+		h.rejectImage()
+		return ctx, imageData, false
+	}
+	if err != nil {
+		h.LogError(fmt.Sprintf("图片审核前处理失败，交由图片处理器验证: %v", err))
+	}
+	return ctx, screened, true
+}
+
+// rejectImage 播报图片被拒绝的提示语
+func (h *ConnectionHandler) rejectImage() {
+	h.SystemSpeak(h.imageModerationConfig.RejectedMessage)
+}
+
+// imageHistoryAttachments 写入对话历史的图片附件；启用审核时URL图片未经审核，不写入历史
+func (h *ConnectionHandler) imageHistoryAttachments(imageData image.ImageData) []types.Attachment {
+	if h.imageModerator != nil && imageData.Data == "" {
+		return nil
+	}
+	return imageAttachments(imageData)
+}
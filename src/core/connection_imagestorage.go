@@ -0,0 +1,107 @@
+package core
+
+import (
+	"ai-server-go/src/core/chat"
+	"ai-server-go/src/core/types"
+	"ai-server-go/src/database"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+/*
+* 上传图片的存储：写入对话历史的图片先保存到 BlobStore，消息附件只保存 blob:<key> 引用，
+* 图片按 retention_hours 过期后由后台任务删除。设备可在 image_storage 能力中设置 enabled=false 关闭存储，
+* 关闭后图片只用于当前对话，不写入对话历史。URL图片不下载，原样保存URL。
+ */
+
+// ImageStorageConfig 上传图片的存储配置
+type ImageStorageConfig struct {
+	Enabled        bool `json:"enabled"`         // 是否保存图片，关闭后图片不写入对话历史
+	RetentionHours int  `json:"retention_hours"` // 图片保留时长（小时），0表示不过期
+}
+
+// DefaultImageStorageConfig 默认图片存储配置
+func DefaultImageStorageConfig() ImageStorageConfig {
+	return ImageStorageConfig{
+		Enabled:        true,
+		RetentionHours: 168,
+	}
+}
+
+// applyMap 使用配置map覆盖图片存储配置
+func (c *ImageStorageConfig) applyMap(config map[string]interface{}) {
+	if config == nil {
+		return
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, c)
+}
+
+// retention 图片保留时长，0表示不过期
+func (c ImageStorageConfig) retention() time.Duration {
+	if c.RetentionHours <= 0 {
+		return 0
+	}
+	return time.Duration(c.RetentionHours) * time.Hour
+}
+
+// loadImageStorageConfig 加载图片存储配置：系统配置 image_storage 分类 < 设备 image_storage 能力配置
+func (h *ConnectionHandler) loadImageStorageConfig(layered *layeredConfigSource) ImageStorageConfig {
+	config := DefaultImageStorageConfig()
+	layered.load("image_storage", "image_storage", "", config.applyMap)
+	return config
+}
+
+// storeHistoryAttachments 将消息附件转换为落库的附件：内嵌图片保存到 BlobStore 后以引用代替，
+// 未启用存储或保存失败的内嵌图片不写入历史
+func (h *ConnectionHandler) storeHistoryAttachments(attachments []types.Attachment) []database.ChatAttachment {
+	stored := make([]database.ChatAttachment, 0, len(attachments))
+	for _, att := range attachments {
+		ref := att.Ref
+		if strings.HasPrefix(ref, "data:") {
+			if !h.imageStorageConfig.Enabled || h.imageStore == nil {
+				continue
+			}
+			blobRef, err := h.imageStore.SaveDataURL(h.userID, parseUint(h.deviceID), h.sessionID, ref, h.imageStorageConfig.retention())
+			if err != nil {
+				h.LogError(fmt.Sprintf("保存图片失败，不写入对话历史: %v", err))
+				continue
+			}
+			ref = blobRef
+		}
+		stored = append(stored, database.ChatAttachment{
+			Type:     att.Type,
+			Ref:      ref,
+			MimeType: att.MimeType,
+		})
+	}
+	return stored
+}
+
+// resolveStoredImages 恢复会话时将存储图片的引用还原为data URL，已过期或已清除的图片被丢弃
+func (h *ConnectionHandler) resolveStoredImages(msg chat.Message) chat.Message {
+	if len(msg.Attachments) == 0 {
+		return msg
+	}
+	attachments := make([]types.Attachment, 0, len(msg.Attachments))
+	for _, att := range msg.Attachments {
+		if key, ok := database.BlobRefKey(att.Ref); ok {
+			if h.imageStore == nil {
+				continue
+			}
+			dataURL, err := h.imageStore.DataURL(key)
+			if err != nil {
+				continue
+			}
+			att.Ref = dataURL
+		}
+		attachments = append(attachments, att)
+	}
+	msg.Attachments = attachments
+	return msg
+}
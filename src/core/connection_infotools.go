@@ -0,0 +1,109 @@
+package core
+
+import (
+	"ai-server-go/src/core/function"
+	"ai-server-go/src/core/providers/weather"
+	"ai-server-go/src/database"
+	"encoding/json"
+)
+
+/*
+* 时间和天气工具：get_time 为内置工具，get_weather 按连接解析天气提供者后注册到工具注册表，
+* 通过函数调用流程回答“现在几点”“今天天气怎么样”。天气提供者来自 WEATHER 类别的provider配置
+* （设备 > 用户 > 系统默认，API Key 保存在 Props 中），未配置时使用无需Key的 wttr.in。
+* 两个工具可在系统配置 info_tools 分类中关闭，设备 info_tools 能力配置可以覆盖（如设置设备所在城市）。
+* 天气服务失败时直接播报 weather_fallback 提示语，不再请求LLM。
+ */
+
+// weatherCategory 天气提供者的配置类别
+const weatherCategory = "WEATHER"
+
+// defaultWeatherProvider 未配置天气提供者时使用的类型
+const defaultWeatherProvider = "wttr"
+
+// InfoToolsConfig 时间和天气工具配置
+type InfoToolsConfig struct {
+	TimeEnabled     bool   `json:"time_enabled"`     // 是否提供时间工具
+	WeatherEnabled  bool   `json:"weather_enabled"`  // 是否提供天气工具
+	DefaultCity     string `json:"default_city"`     // 用户没有说明城市时查询的城市
+	WeatherFallback string `json:"weather_fallback"` // 天气服务失败时播报的提示语，为空时交给LLM回复
+}
+
+// DefaultInfoToolsConfig 默认时间和天气工具配置
+func DefaultInfoToolsConfig() InfoToolsConfig {
+	return InfoToolsConfig{
+		TimeEnabled:     true,
+		WeatherEnabled:  true,
+		WeatherFallback: "抱歉，暂时查不到天气信息，请稍后再试",
+	}
+}
+
+// applyMap 使用配置map覆盖时间和天气工具配置
+func (c *InfoToolsConfig) applyMap(config map[string]interface{}) {
+	if config == nil {
+		return
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, c)
+}
+
+// loadInfoToolsConfig 加载时间和天气工具配置：系统配置 info_tools 分类 < 设备 info_tools 能力配置
+func (h *ConnectionHandler) loadInfoToolsConfig(layered *layeredConfigSource) InfoToolsConfig {
+	config := DefaultInfoToolsConfig()
+	layered.load("info_tools", "info_tools", "", config.applyMap)
+	return config
+}
+
+// initInfoTools 按配置注册天气工具，关闭时间工具时从注册表移除
+func (h *ConnectionHandler) initInfoTools(layered *layeredConfigSource) {
+	config := h.loadInfoToolsConfig(layered)
+	if !config.TimeEnabled && h.functionRegister.FunctionExists(function.TimeToolName) {
+		if err := h.functionRegister.UnregisterFunction(function.TimeToolName); err != nil {
+			h.logger.Warn("移除时间工具失败: %v", err)
+		}
+	}
+	if !config.WeatherEnabled {
+		return
+	}
+
+	provider, name, err := h.newWeatherProvider()
+	if err != nil {
+		h.logger.Warn("创建天气提供者失败，不提供天气工具: %v", err)
+		return
+	}
+	if err := h.functionRegister.RegisterTool(function.NewWeatherTool(provider, config.DefaultCity, config.WeatherFallback)); err != nil {
+		h.logger.Error("注册天气工具失败: %v", err)
+		return
+	}
+	h.logger.Debug("天气工具已启用: %s，默认城市: %s", name, config.DefaultCity)
+}
+
+// newWeatherProvider 解析本连接的天气提供者，未配置时使用 wttr.in
+func (h *ConnectionHandler) newWeatherProvider() (weather.Provider, string, error) {
+	var providerConfig *database.ProviderConfig
+	if h.configService != nil {
+		var deviceID *uint
+		if id := parseUint(h.deviceID); id > 0 {
+			deviceID = &id
+		}
+		config, err := h.configService.GetEffectiveProvider(weatherCategory, deviceID, h.userID)
+		if err != nil {
+			h.logger.Warn("查询天气提供者配置失败，使用默认天气服务: %v", err)
+		}
+		providerConfig = config
+	}
+	if providerConfig == nil {
+		provider, err := weather.Create(defaultWeatherProvider, &weather.Config{Type: defaultWeatherProvider})
+		return provider, defaultWeatherProvider, err
+	}
+
+	extra, err := providerConfig.PropsMap()
+	if err != nil {
+		return nil, "", err
+	}
+	provider, err := weather.Create(providerConfig.Type, &weather.Config{Type: providerConfig.Type, Extra: extra})
+	return provider, providerConfig.Name + "/" + providerConfig.Type, err
+}
@@ -0,0 +1,216 @@
+package core
+
+import (
+	"ai-server-go/src/core/chat"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+* 设备指令路由：在调用LLM之前，用关键词或正则匹配识别结果，命中的话直接向设备下发结构化的IOT指令，
+* 例如“关灯”下发 {"type":"iot","commands":[{"name":"Lamp","method":"TurnOff","parameters":{}}]}，
+* 不经过LLM；可选播报一句简短的确认语。未命中的话照常进入对话流程。
+* 指令表来自系统配置 intent_routing 分类，设备 intent_routing 能力配置可以整体替换。
+ */
+
+// DeviceIntent 一条设备指令规则
+type DeviceIntent struct {
+	Name       string                 `json:"name"`       // 规则名称，用于日志
+	Keywords   []string               `json:"keywords"`   // 包含任一关键词即命中（忽略标点、空格和大小写）
+	Patterns   []string               `json:"patterns"`   // 正则表达式，命名分组作为指令参数
+	Device     string                 `json:"device"`     // 指令的设备（IOT thing）名称
+	Method     string                 `json:"method"`     // 指令的方法名称
+	Parameters map[string]interface{} `json:"parameters"` // 固定的指令参数
+	Reply      string                 `json:"reply"`      // 命中后播报的确认语，为空时不播报
+}
+
+// IntentRoutingConfig 设备指令路由配置
+type IntentRoutingConfig struct {
+	Enabled  bool           `json:"enabled"`   // 是否启用指令路由
+	MaxChars int            `json:"max_chars"` // 超过该长度的句子不做匹配，避免长句误命中，0表示不限制
+	Intents  []DeviceIntent `json:"intents"`   // 指令规则，按顺序匹配第一条
+}
+
+// DefaultIntentRoutingConfig 默认设备指令路由配置
+func DefaultIntentRoutingConfig() IntentRoutingConfig {
+	return IntentRoutingConfig{
+		Enabled:  false,
+		MaxChars: 20,
+	}
+}
+
+// applyMap 使用配置map覆盖指令路由配置
+func (c *IntentRoutingConfig) applyMap(config map[string]interface{}) {
+	if config == nil {
+		return
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, c)
+}
+
+// intentNormalizePattern 匹配前去除的标点和空白
+var intentNormalizePattern = regexp.MustCompile(`[\p{P}\p{S}\s]+`)
+
+// normalizeIntentText 去除标点和空白并转为小写
+func normalizeIntentText(text string) string {
+	return strings.ToLower(intentNormalizePattern.ReplaceAllString(text, ""))
+}
+
+// compiledIntent 预处理后的指令规则
+type compiledIntent struct {
+	DeviceIntent
+	keywords []string
+	patterns []*regexp.Regexp
+}
+
+// loadIntentRoutingConfig 加载指令路由配置：系统配置 intent_routing 分类 < 设备 intent_routing 能力配置
+func (h *ConnectionHandler) loadIntentRoutingConfig(layered *layeredConfigSource) IntentRoutingConfig {
+	config := DefaultIntentRoutingConfig()
+	layered.load("intent_routing", "intent_routing", "", config.applyMap)
+	return config
+}
+
+// compileIntents 预处理指令规则，无效的正则和缺少设备/方法的规则记录日志后跳过
+func (h *ConnectionHandler) compileIntents(intents []DeviceIntent) []compiledIntent {
+	compiled := make([]compiledIntent, 0, len(intents))
+	for _, intent := range intents {
+		if intent.Device == "" || intent.Method == "" {
+			h.LogError(fmt.Sprintf("设备指令规则 %s 缺少device或method，已忽略", intent.Name))
+			continue
+		}
+		rule := compiledIntent{DeviceIntent: intent}
+		for _, keyword := range intent.Keywords {
+			if keyword = normalizeIntentText(keyword); keyword != "" {
+				rule.keywords = append(rule.keywords, keyword)
+			}
+		}
+		for _, pattern := range intent.Patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				h.LogError(fmt.Sprintf("设备指令规则 %s 的正则无效: %s %v", intent.Name, pattern, err))
+				continue
+			}
+			rule.patterns = append(rule.patterns, re)
+		}
+		if len(rule.keywords) == 0 && len(rule.patterns) == 0 {
+			h.LogError(fmt.Sprintf("设备指令规则 %s 没有有效的关键词或正则，已忽略", intent.Name))
+			continue
+		}
+		compiled = append(compiled, rule)
+	}
+	return compiled
+}
+
+// match 规则是否命中，命中时返回合并了正则命名分组的指令参数
+func (r compiledIntent) match(normalized string) (map[string]interface{}, bool) {
+	for _, keyword := range r.keywords {
+		if strings.Contains(normalized, keyword) {
+			return r.parameters(nil, nil), true
+		}
+	}
+	for _, re := range r.patterns {
+		if groups := re.FindStringSubmatch(normalized); groups != nil {
+			return r.parameters(re, groups), true
+		}
+	}
+	return nil, false
+}
+
+// parameters 固定参数加上正则命名分组的值
+func (r compiledIntent) parameters(re *regexp.Regexp, groups []string) map[string]interface{} {
+	params := make(map[string]interface{}, len(r.Parameters))
+	for key, value := range r.Parameters {
+		params[key] = value
+	}
+	if re != nil {
+		for i, name := range re.SubexpNames() {
+			if name != "" && i < len(groups) {
+				params[name] = groups[i]
+			}
+		}
+	}
+	return params
+}
+
+// matchIntent 按顺序匹配指令规则
+func (h *ConnectionHandler) matchIntent(text string) (*compiledIntent, map[string]interface{}) {
+	if !h.intentRoutingConfig.Enabled || len(h.intents) == 0 {
+		return nil, nil
+	}
+	normalized := normalizeIntentText(text)
+	if normalized == "" {
+		return nil, nil
+	}
+	if limit := h.intentRoutingConfig.MaxChars; limit > 0 && utf8.RuneCountInString(normalized) > limit {
+		h.logger.Debug("指令路由: 句子超过%d字，不做匹配: %s", limit, text)
+		return nil, nil
+	}
+	for i := range h.intents {
+		if params, ok := h.intents[i].match(normalized); ok {
+			return &h.intents[i], params
+		}
+	}
+	return nil, nil
+}
+
+// sendIotCommand 向设备下发IOT指令
+func (h *ConnectionHandler) sendIotCommand(intent *compiledIntent, params map[string]interface{}, text string) error {
+	msg := map[string]interface{}{
+		"type":       "iot",
+		"session_id": h.sessionID,
+		"intent":     intent.Name,
+		"text":       text,
+		"commands": []map[string]interface{}{
+			{
+				"name":       intent.Device,
+				"method":     intent.Method,
+				"parameters": params,
+			},
+		},
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("序列化IOT指令失败: %v", err)
+	}
+	if err := h.conn.WriteMessage(1, data); err != nil {
+		return fmt.Errorf("发送IOT指令失败: %v", err)
+	}
+	return nil
+}
+
+// routeIntent 识别结果命中设备指令时直接下发指令并结束本轮，不调用LLM；返回是否已处理
+func (h *ConnectionHandler) routeIntent(text string) bool {
+	intent, params := h.matchIntent(text)
+	if intent == nil {
+		if h.intentRoutingConfig.Enabled {
+			h.logger.Debug("指令路由: 未命中，进入对话流程: %s", text)
+		}
+		return false
+	}
+	h.LogInfo(fmt.Sprintf("指令路由: \"%s\" 命中规则 %s -> %s.%s %v", text, intent.Name, intent.Device, intent.Method, params))
+
+	if err := h.sendSTTMessage(text); err != nil {
+		h.LogError(fmt.Sprintf("发送STT消息失败: %v", err))
+	}
+	if err := h.sendIotCommand(intent, params, text); err != nil {
+		h.LogError(err.Error())
+	}
+	h.recordDialogueMessage(chat.Message{Role: "user", Content: text})
+
+	if intent.Reply == "" {
+		h.clearSpeakStatus()
+		return true
+	}
+	h.recordDialogueMessage(chat.Message{Role: "assistant", Content: intent.Reply})
+	if err := h.sendTTSMessage("start", "", 0); err != nil {
+		h.LogError(fmt.Sprintf("发送TTS开始状态失败: %v", err))
+	}
+	h.SystemSpeak(intent.Reply)
+	return true
+}
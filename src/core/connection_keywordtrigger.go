@@ -0,0 +1,265 @@
+package core
+
+import (
+	"ai-server-go/src/core/chat"
+	"ai-server-go/src/database"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+/*
+* 关键词触发：识别结果包含配置的关键词时执行特殊处理，例如说出安全词结束会话、说“救命”时通知监护人。
+* 只匹配语音识别的最终结果（纠错后），在进入对话流程之前判断，按顺序命中第一条规则。
+* 动作：end_session 结束会话；webhook 向配置的地址推送通知；switch_mode 切换对话模式；reply 播报固定回复。
+* 配置了回复语的规则命中后先播报回复语；webhook 规则没有回复语时推送通知后照常进入对话流程，其余动作不再调用LLM。
+* 每次触发都会记录日志并写入设备事件（category=keyword_trigger）。
+* 规则来自系统配置 keyword_trigger 分类，设备 keyword_trigger 能力配置可以整体替换。
+ */
+
+// 关键词触发动作
+const (
+	keywordActionEndSession = "end_session"
+	keywordActionWebhook    = "webhook"
+	keywordActionSwitchMode = "switch_mode"
+	keywordActionReply      = "reply"
+)
+
+// keywordTriggerWebhookTimeout 触发通知webhook的请求超时
+const keywordTriggerWebhookTimeout = 5 * time.Second
+
+// KeywordTrigger 一条关键词触发规则
+type KeywordTrigger struct {
+	Name       string   `json:"name"`        // 规则名称，用于日志和设备事件
+	Keywords   []string `json:"keywords"`    // 包含任一关键词即命中（忽略标点、空格和大小写）
+	Action     string   `json:"action"`      // 动作：end_session、webhook、switch_mode、reply
+	Reply      string   `json:"reply"`       // 命中后播报的回复语，reply 动作必填
+	Mode       string   `json:"mode"`        // switch_mode 动作切换到的对话模式
+	WebhookURL string   `json:"webhook_url"` // webhook 动作的通知地址，为空时使用全局地址
+}
+
+// KeywordTriggerConfig 关键词触发配置
+type KeywordTriggerConfig struct {
+	Enabled    bool             `json:"enabled"`     // 是否启用
+	WebhookURL string           `json:"webhook_url"` // webhook 动作的默认通知地址
+	Triggers   []KeywordTrigger `json:"triggers"`    // 触发规则，按顺序匹配第一条
+}
+
+// DefaultKeywordTriggerConfig 默认关键词触发配置
+func DefaultKeywordTriggerConfig() KeywordTriggerConfig {
+	return KeywordTriggerConfig{Enabled: false}
+}
+
+// applyMap 使用配置map覆盖关键词触发配置
+func (c *KeywordTriggerConfig) applyMap(config map[string]interface{}) {
+	if config == nil {
+		return
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, c)
+}
+
+// compiledKeywordTrigger 预处理后的触发规则
+type compiledKeywordTrigger struct {
+	KeywordTrigger
+	keywords []string
+}
+
+// loadKeywordTriggerConfig 加载关键词触发配置：系统配置 keyword_trigger 分类 < 设备 keyword_trigger 能力配置
+func (h *ConnectionHandler) loadKeywordTriggerConfig(layered *layeredConfigSource) KeywordTriggerConfig {
+	config := DefaultKeywordTriggerConfig()
+	layered.load("keyword_trigger", "keyword_trigger", "", config.applyMap)
+	return config
+}
+
+// compileKeywordTriggers 预处理触发规则，动作无效或缺少必要参数的规则记录日志后跳过
+func (h *ConnectionHandler) compileKeywordTriggers(config KeywordTriggerConfig) []compiledKeywordTrigger {
+	compiled := make([]compiledKeywordTrigger, 0, len(config.Triggers))
+	for _, trigger := range config.Triggers {
+		trigger.Action = strings.ToLower(strings.TrimSpace(trigger.Action))
+		switch trigger.Action {
+		case keywordActionEndSession:
+		case keywordActionWebhook:
+			if trigger.WebhookURL == "" && config.WebhookURL == "" {
+				h.LogError(fmt.Sprintf("关键词触发规则 %s 没有配置webhook地址，已忽略", trigger.Name))
+				continue
+			}
+		case keywordActionSwitchMode:
+			if trigger.Mode == "" {
+				h.LogError(fmt.Sprintf("关键词触发规则 %s 没有配置要切换的模式，已忽略", trigger.Name))
+				continue
+			}
+		case keywordActionReply:
+			if strings.TrimSpace(trigger.Reply) == "" {
+				h.LogError(fmt.Sprintf("关键词触发规则 %s 没有配置回复语，已忽略", trigger.Name))
+				continue
+			}
+		default:
+			h.LogError(fmt.Sprintf("关键词触发规则 %s 的动作无效: %s，已忽略", trigger.Name, trigger.Action))
+			continue
+		}
+
+		rule := compiledKeywordTrigger{KeywordTrigger: trigger}
+		for _, keyword := range trigger.Keywords {
+			if keyword = normalizeIntentText(keyword); keyword != "" {
+				rule.keywords = append(rule.keywords, keyword)
+			}
+		}
+		if len(rule.keywords) == 0 {
+			h.LogError(fmt.Sprintf("关键词触发规则 %s 没有有效的关键词，已忽略", trigger.Name))
+			continue
+		}
+		compiled = append(compiled, rule)
+	}
+	return compiled
+}
+
+// matchKeywordTrigger 按顺序匹配触发规则，返回命中的规则和关键词
+func (h *ConnectionHandler) matchKeywordTrigger(text string) (*compiledKeywordTrigger, string) {
+	if !h.keywordTriggerConfig.Enabled || len(h.keywordTriggers) == 0 {
+		return nil, ""
+	}
+	normalized := normalizeIntentText(text)
+	if normalized == "" {
+		return nil, ""
+	}
+	for i := range h.keywordTriggers {
+		for _, keyword := range h.keywordTriggers[i].keywords {
+			if strings.Contains(normalized, keyword) {
+				return &h.keywordTriggers[i], keyword
+			}
+		}
+	}
+	return nil, ""
+}
+
+// fireKeywordTrigger 识别结果命中触发规则时执行对应动作；返回是否已处理，未处理时照常进入对话流程
+func (h *ConnectionHandler) fireKeywordTrigger(text string) bool {
+	trigger, keyword := h.matchKeywordTrigger(text)
+	if trigger == nil {
+		return false
+	}
+	h.LogInfo(fmt.Sprintf("关键词触发: \"%s\" 命中规则 %s（关键词 %s），动作: %s", text, trigger.Name, keyword, trigger.Action))
+	h.recordKeywordTrigger(trigger, keyword, text)
+
+	switch trigger.Action {
+	case keywordActionWebhook:
+		go h.notifyKeywordTrigger(trigger, keyword, text)
+		if trigger.Reply == "" {
+			return false
+		}
+	case keywordActionSwitchMode:
+		if err := h.handleModeMessage(map[string]interface{}{"mode": trigger.Mode}); err != nil {
+			h.LogError(fmt.Sprintf("关键词触发切换对话模式失败: %v", err))
+		}
+	case keywordActionEndSession:
+		if trigger.Reply == "" {
+			if err := h.sendSTTMessage(text); err != nil {
+				h.LogError(fmt.Sprintf("发送STT消息失败: %v", err))
+			}
+			h.recordDialogueMessage(chat.Message{Role: "user", Content: text})
+			h.Close()
+			return true
+		}
+		h.closeAfterChat = true
+	}
+
+	h.replyKeywordTrigger(trigger, text)
+	return true
+}
+
+// replyKeywordTrigger 以新的对话轮次播报触发规则的回复语，没有回复语时结束本轮
+func (h *ConnectionHandler) replyKeywordTrigger(trigger *compiledKeywordTrigger, text string) {
+	h.speakFixedReply(text, trigger.Reply)
+}
+
+// speakFixedReply 不经过LLM，以新的对话轮次播报固定回复，没有回复时结束本轮；
+// 用户原话和回复只写入会话记录，不进入LLM上下文
+func (h *ConnectionHandler) speakFixedReply(text, reply string) {
+	h.finishTurn()
+	h.talkRound++
+	h.roundStartTime = time.Now()
+
+	if err := h.sendSTTMessage(text); err != nil {
+		h.LogError(fmt.Sprintf("发送STT消息失败: %v", err))
+	}
+	h.recordDialogueMessage(chat.Message{Role: "user", Content: text})
+
+	if reply == "" {
+		h.clearSpeakStatus()
+		return
+	}
+	h.recordDialogueMessage(chat.Message{Role: "assistant", Content: reply})
+	if err := h.sendTTSMessage("start", "", 0); err != nil {
+		h.LogError(fmt.Sprintf("发送TTS开始状态失败: %v", err))
+	}
+	h.SystemSpeak(reply)
+}
+
+// recordKeywordTrigger 将触发记录写入设备事件
+func (h *ConnectionHandler) recordKeywordTrigger(trigger *compiledKeywordTrigger, keyword, text string) {
+	if h.deviceService == nil {
+		return
+	}
+	details, _ := json.Marshal(map[string]interface{}{
+		"trigger": trigger.Name,
+		"keyword": keyword,
+		"action":  trigger.Action,
+		"text":    text,
+	})
+	event := &database.DeviceEvent{
+		DeviceID:  parseUint(h.deviceID),
+		DeviceKey: h.deviceID,
+		SessionID: h.sessionID,
+		Level:     "info",
+		Category:  "keyword_trigger",
+		Code:      trigger.Action,
+		Message:   fmt.Sprintf("命中关键词触发规则 %s", trigger.Name),
+		Details:   string(details),
+	}
+	go func() {
+		if err := h.deviceService.SaveDeviceEvent(event); err != nil {
+			h.LogError(fmt.Sprintf("保存关键词触发记录失败: %v", err))
+		}
+	}()
+}
+
+// notifyKeywordTrigger 以JSON POST推送触发通知
+func (h *ConnectionHandler) notifyKeywordTrigger(trigger *compiledKeywordTrigger, keyword, text string) {
+	url := trigger.WebhookURL
+	if url == "" {
+		url = h.keywordTriggerConfig.WebhookURL
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"event":      "keyword_trigger",
+		"trigger":    trigger.Name,
+		"keyword":    keyword,
+		"text":       text,
+		"device_id":  h.deviceID,
+		"user_id":    h.userID,
+		"session_id": h.sessionID,
+		"time":       time.Now().Format(time.RFC3339),
+	})
+	if err != nil {
+		h.LogError(fmt.Sprintf("序列化关键词触发通知失败: %v", err))
+		return
+	}
+	client := &http.Client{Timeout: keywordTriggerWebhookTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		h.LogError(fmt.Sprintf("推送关键词触发通知失败: %v", err))
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		h.LogError(fmt.Sprintf("关键词触发通知webhook返回状态码: %d", resp.StatusCode))
+		return
+	}
+	h.LogInfo(fmt.Sprintf("关键词触发通知已推送: 规则 %s", trigger.Name))
+}
@@ -0,0 +1,64 @@
+package core
+
+import "ai-server-go/src/database"
+
+/*
+* 分层配置加载：会话级功能配置按 默认值 < 系统配置分类 < 设备能力配置 的顺序逐层覆盖，
+* 每一层都交给配置自身的 applyMap 处理，未出现的字段保持上一层的值。
+* 设备能力配置按用户/设备的回退规则取得，可以是整个能力配置，也可以是能力配置中的某个对象（如 vad 能力的 barge_in）。
+* 建立连接时一次读取全部系统配置和设备能力配置，各功能的加载函数共用这一份数据，不再分别查询数据库。
+ */
+
+// layeredConfigSource 建立连接时读取的系统配置和设备能力配置
+type layeredConfigSource struct {
+	system       map[string]map[string]interface{} // 系统配置，按分类
+	capabilities []database.CapabilityConfig       // 设备能力配置（已按用户/设备回退）
+}
+
+// newLayeredConfigSource 读取全部系统配置和设备能力配置，数据库未初始化或读取失败时对应层为空
+func (h *ConnectionHandler) newLayeredConfigSource() *layeredConfigSource {
+	source := &layeredConfigSource{}
+	if h.configService == nil {
+		return source
+	}
+	if system, err := h.configService.GetSystemConfigCategories(); err == nil {
+		source.system = system
+	} else {
+		h.logger.Warn("读取系统配置失败，会话功能使用默认配置: %v", err)
+	}
+	if h.deviceID == "" {
+		return source
+	}
+	if deviceConfig, err := h.configService.GetDeviceCapabilityConfigWithFallback(parseUint(h.deviceID), h.userID); err == nil && deviceConfig != nil {
+		source.capabilities = deviceConfig.Capabilities
+	}
+	return source
+}
+
+// load 用系统配置 category 分类和设备 capability 能力配置依次覆盖配置，apply 为配置的 applyMap。
+// key 为空时使用整个能力配置，否则使用能力配置中 key 对应的对象
+func (s *layeredConfigSource) load(category, capability, key string, apply func(map[string]interface{})) {
+	s.applySystem(category, apply)
+	s.applyCapability(capability, key, apply)
+}
+
+// applySystem 用系统配置 category 分类覆盖配置，分类不存在时不做覆盖
+func (s *layeredConfigSource) applySystem(category string, apply func(map[string]interface{})) {
+	if systemConfig, ok := s.system[category]; ok {
+		apply(systemConfig)
+	}
+}
+
+// applyCapability 用设备 capability 能力配置覆盖配置，key 不为空时只取能力配置中 key 对应的对象
+func (s *layeredConfigSource) applyCapability(capability, key string, apply func(map[string]interface{})) {
+	for _, c := range s.capabilities {
+		if c.CapabilityName != capability {
+			continue
+		}
+		if key == "" {
+			apply(c.Config)
+		} else if nested, ok := c.Config[key].(map[string]interface{}); ok {
+			apply(nested)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package core
+
+import (
+	"ai-server-go/src/core/llmcache"
+	"ai-server-go/src/core/providers"
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+* LLM回复缓存：默认关闭，按设备/用户的 llm_cache 能力开启。相同的对话（归一化后）在有效期内直接复用缓存的回复，
+* 逐段重新合成语音播放，不再调用LLM、不计LLM用量。问题命中绕过规则或本轮注入了记忆时不使用缓存；
+* 调用工具或被内容审核拦截的回复不写入缓存，命中的回复播放前按本连接的审核配置重新审核。缓存在进程内所有连接间共享，容量取首次使用时的配置。
+ */
+
+var (
+	llmResponseCache     atomic.Pointer[llmcache.Cache]
+	llmResponseCacheOnce sync.Once
+)
+
+// getLLMResponseCache 进程内共享的LLM回复缓存，容量取自首次使用时的配置
+func getLLMResponseCache(maxEntries int) *llmcache.Cache {
+	llmResponseCacheOnce.Do(func() {
+		llmResponseCache.Store(llmcache.New(maxEntries))
+	})
+	return llmResponseCache.Load()
+}
+
+// LLMCacheStats LLM回复缓存统计（用于 /metrics），尚未有连接启用缓存时为零值
+func LLMCacheStats() llmcache.Stats {
+	if cache := llmResponseCache.Load(); cache != nil {
+		return cache.Stats()
+	}
+	return llmcache.Stats{}
+}
+
+// initLLMCache 加载LLM回复缓存配置：系统配置 llm_cache 分类 < 用户/设备的 llm_cache 能力配置
+func (h *ConnectionHandler) initLLMCache(layered *layeredConfigSource) {
+	config := llmcache.DefaultConfig()
+	layered.load("llm_cache", "llm_cache", "", config.ApplyMap)
+
+	h.llmCacheConfig = config
+	if !config.Enabled {
+		return
+	}
+	patterns, invalid := config.CompileBypass()
+	if len(invalid) > 0 {
+		h.logger.Warn("LLM回复缓存的绕过规则无效，已忽略: %v", invalid)
+	}
+	h.llmCacheBypass = patterns
+	h.llmCache = getLLMResponseCache(config.MaxEntries)
+	h.LogInfo(fmt.Sprintf("LLM回复缓存已启用: ttl=%ds, 绕过规则%d条", config.TTLSeconds, len(patterns)))
+}
+
+// llmCacheKey 由归一化后的完整对话和LLM模型参数计算缓存键
+func (h *ConnectionHandler) llmCacheKey(messages []providers.Message) string {
+	parts := make([]string, 0, len(messages)+7)
+	if getter, ok := h.llmProvider().(llmConfigGetter); ok && getter.Config() != nil {
+		config := getter.Config()
+		parts = append(parts,
+			config.Type,
+			config.ModelName,
+			strconv.FormatFloat(config.Temperature, 'f', -1, 64),
+			strconv.FormatFloat(config.TopP, 'f', -1, 64),
+			strconv.Itoa(config.MaxTokens),
+			// 停止序列和系统提示词模板同样影响回复
+			fmt.Sprint(config.Extra["stop"]),
+			fmt.Sprint(config.Extra["system_prompt_template"]),
+		)
+	}
+	for _, msg := range messages {
+		parts = append(parts, msg.Role+":"+llmcache.Normalize(msg.Content))
+	}
+	return llmcache.Key(parts...)
+}
+
+// bypassLLMCache 问题命中绕过规则，或本轮对话注入了记忆（消息比对话历史多）时不使用缓存
+func (h *ConnectionHandler) bypassLLMCache(text string, messages []providers.Message) bool {
+	if len(messages) > len(h.dialogueManager.GetLLMDialogue()) {
+		return true
+	}
+	return matchAny(h.llmCacheBypass, text)
+}
+
+// matchAny 文本是否匹配任一正则
+func matchAny(patterns []*regexp.Regexp, text string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// replyFromLLMCache 命中缓存时逐段合成语音播放缓存的回复并写入对话历史，返回是否命中；
+// 未命中时记下缓存键，由 genResponseByLLM 在生成完成后写入。
+// 缓存在连接间共享，缓存的回复与新生成的回复一样逐段审核，并经同一路径保存
+func (h *ConnectionHandler) replyFromLLMCache(ctx context.Context, text string, messages []providers.Message, round int) bool {
+	h.pendingLLMCacheKey = ""
+	if h.llmCache == nil {
+		return false
+	}
+	if h.bypassLLMCache(text, messages) {
+		h.llmCache.RecordBypass()
+		return false
+	}
+
+	key := h.llmCacheKey(messages)
+	entry, ok := h.llmCache.Get(key)
+	if !ok {
+		h.pendingLLMCacheKey = key
+		return false
+	}
+
+	h.LogInfo(fmt.Sprintf("LLM回复缓存命中: %s, round: %d", entry.Content, round))
+	ctx = h.requestContext(ctx, round)
+	atomic.StoreInt32(&h.serverVoiceStop, 0)
+	stream := h.newTextStream(round)
+	moderationState := &responseModeration{}
+	textIndex := 0
+	for _, segment := range entry.Segments {
+		if notice, allowed := h.moderateSegment(ctx, moderationState, segment); !allowed {
+			if notice != "" {
+				textIndex++
+				h.setLastTextIndex(textIndex)
+				if err := h.SpeakAndPlay(notice, textIndex, round); err != nil {
+					h.logger.Error("播放审核提示语失败: %v", err)
+				}
+			}
+			continue
+		}
+		textIndex++
+		h.setLastTextIndex(textIndex)
+		stream.send(segment, textIndex)
+		if err := h.SpeakAndPlay(segment, textIndex, round); err != nil {
+			h.logger.Error("播放缓存回复分段失败: %v", err)
+		}
+	}
+
+	content := entry.Content
+	if moderationState.blocked {
+		// 被拦截的内容不进入对话上下文，原文随审核结果保存
+		moderationState.original = content
+		content = h.moderationConfig.BlockedMessage
+	}
+	stream.end(content, moderationState.blocked)
+	h.putAssistantReply(moderationState, content)
+	return true
+}
+
+// storeLLMCache 写入本轮生成的回复
+func (h *ConnectionHandler) storeLLMCache(key string, content string, segments []string) {
+	if h.llmCache == nil || key == "" || content == "" || len(segments) == 0 {
+		return
+	}
+	h.llmCache.Set(key, llmcache.Entry{Content: content, Segments: segments}, h.llmCacheConfig.TTL())
+}
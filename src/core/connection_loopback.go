@@ -0,0 +1,253 @@
+package core
+
+import (
+	"ai-server-go/src/core/utils"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+* 回环测试模式：用于装机时端到端验证麦克风和扬声器接线。
+* echo 模式跳过ASR/LLM，录下用户说的一段话后原样播放回设备；tts 模式正常识别，但不调用LLM，直接用TTS朗读识别结果。
+* 进入方式：设备的 loopback 能力配置 enabled=true（该设备的连接始终进入回环模式），
+* 或设备在 hello 的 features 中声明 "loopback": "echo"|"tts"|true（需系统配置允许）。
+* 回环模式下不计用量，不写入对话历史和记忆，会话标记为 loopback 并归档，不会被当作真实对话恢复。
+ */
+
+const (
+	loopbackModeEcho = "echo"
+	loopbackModeTTS  = "tts"
+)
+
+// LoopbackConfig 回环测试配置
+type LoopbackConfig struct {
+	Enabled         bool    `json:"enabled"`          // 设备能力开关：启用后该设备的连接直接进入回环模式
+	AllowHandshake  bool    `json:"allow_handshake"`  // 是否允许设备在hello中声明进入回环模式
+	Mode            string  `json:"mode"`             // echo（原样回放）或 tts（识别后朗读）
+	MaxSeconds      int     `json:"max_seconds"`      // echo 模式单次录音的最长秒数
+	SilenceMs       int     `json:"silence_ms"`       // echo 模式自动拾音时，说话后静音多久结束录音（毫秒）
+	EnergyThreshold float64 `json:"energy_threshold"` // 判断为说话的归一化RMS能量阈值（0-1）
+}
+
+// DefaultLoopbackConfig 默认回环测试配置
+func DefaultLoopbackConfig() LoopbackConfig {
+	return LoopbackConfig{
+		Enabled:         false,
+		AllowHandshake:  true,
+		Mode:            loopbackModeEcho,
+		MaxSeconds:      10,
+		SilenceMs:       800,
+		EnergyThreshold: 0.02,
+	}
+}
+
+// applyMap 使用配置map覆盖回环测试配置
+func (c *LoopbackConfig) applyMap(config map[string]interface{}) {
+	if config == nil {
+		return
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, c)
+}
+
+// loadLoopbackConfig 加载回环测试配置：系统配置 loopback 分类 < 设备 loopback 能力配置
+func (h *ConnectionHandler) loadLoopbackConfig(layered *layeredConfigSource) LoopbackConfig {
+	config := DefaultLoopbackConfig()
+	layered.load("loopback", "loopback", "", config.applyMap)
+	if config.Mode != loopbackModeTTS {
+		config.Mode = loopbackModeEcho
+	}
+	config.MaxSeconds = max(config.MaxSeconds, 1)
+	config.SilenceMs = max(config.SilenceMs, 100)
+	return config
+}
+
+// negotiateLoopback 根据设备能力配置或hello声明决定是否进入回环模式
+func (h *ConnectionHandler) negotiateLoopback(msgMap map[string]interface{}) {
+	mode := ""
+	if h.loopbackConfig.Enabled {
+		mode = h.loopbackConfig.Mode
+	} else {
+		features, _ := msgMap["features"].(map[string]interface{})
+		switch requested := features["loopback"].(type) {
+		case bool:
+			if requested {
+				mode = h.loopbackConfig.Mode
+			}
+		case string:
+			mode = strings.ToLower(requested)
+		}
+		if mode != "" && !h.loopbackConfig.AllowHandshake {
+			h.LogInfo("客户端请求回环测试模式，但loopback配置不允许通过hello进入")
+			return
+		}
+	}
+	if mode == "" {
+		return
+	}
+	if mode != loopbackModeEcho && mode != loopbackModeTTS {
+		h.logger.Warn("不支持的回环测试模式: %s", mode)
+		return
+	}
+
+	h.loopbackMode = mode
+	h.loopback = &loopbackRecorder{}
+	h.LogInfo(fmt.Sprintf("进入回环测试模式: %s", mode))
+	h.markLoopbackSession()
+}
+
+// markLoopbackSession 将会话标记为回环测试并归档，不参与会话恢复
+func (h *ConnectionHandler) markLoopbackSession() {
+	if h.memoryService == nil || h.deviceID == "" {
+		return
+	}
+	if err := h.memoryService.UpdateSession(h.sessionID, map[string]interface{}{
+		"status": "archived",
+		"tags":   "loopback",
+	}); err != nil {
+		h.LogError(fmt.Sprintf("标记回环测试会话失败: %v", err))
+	}
+}
+
+// loopbackRecorder echo 模式的录音状态
+type loopbackRecorder struct {
+	mu       sync.Mutex
+	pcm      []byte
+	spoke    bool          // 本段录音是否已检测到说话
+	silence  time.Duration // 说话后的连续静音时长
+	playing  int32         // 是否正在回放（原子操作），回放期间不录音
+	duration time.Duration // 本段录音时长
+}
+
+// captureLoopback echo 模式下录制客户端PCM音频，满足结束条件时回放
+func (h *ConnectionHandler) captureLoopback(pcm []byte) {
+	recorder := h.loopback
+	if atomic.LoadInt32(&recorder.playing) == 1 || len(pcm) < 2 {
+		return
+	}
+	sampleRate, channels := h.loopbackAudioParams()
+	frameDuration := time.Duration(len(pcm)) * time.Second / time.Duration(sampleRate*2*channels)
+
+	recorder.mu.Lock()
+	recorder.pcm = append(recorder.pcm, pcm...)
+	recorder.duration += frameDuration
+	if rmsEnergy(pcmToFloat32(pcm)) >= h.loopbackConfig.EnergyThreshold {
+		recorder.spoke = true
+		recorder.silence = 0
+	} else if recorder.spoke {
+		recorder.silence += frameDuration
+	} else if recorder.duration > time.Second {
+		// 尚未说话时只保留最近1秒，作为开头的前导音
+		if keep := sampleRate * 2 * channels; len(recorder.pcm) > keep {
+			recorder.pcm = recorder.pcm[len(recorder.pcm)-keep:]
+		}
+		recorder.duration = time.Second
+	}
+	finished := recorder.duration >= time.Duration(h.loopbackConfig.MaxSeconds)*time.Second ||
+		(h.listenMode() != "manual" && recorder.spoke &&
+			recorder.silence >= time.Duration(h.loopbackConfig.SilenceMs)*time.Millisecond)
+	recorder.mu.Unlock()
+
+	if finished {
+		go h.playLoopback()
+	}
+}
+
+// take 取出已录制的音频并重置录音状态，没有检测到说话时返回nil
+func (r *loopbackRecorder) take() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pcm := r.pcm
+	spoke := r.spoke
+	r.pcm = nil
+	r.spoke = false
+	r.silence = 0
+	r.duration = 0
+	if !spoke {
+		return nil
+	}
+	return pcm
+}
+
+// playLoopback 将录制的音频编码后回放给设备
+func (h *ConnectionHandler) playLoopback() {
+	recorder := h.loopback
+	if recorder == nil || !atomic.CompareAndSwapInt32(&recorder.playing, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&recorder.playing, 0)
+
+	pcm := recorder.take()
+	if len(pcm) == 0 {
+		h.LogInfo("回环测试未检测到说话，跳过回放")
+		return
+	}
+	sampleRate, channels := h.loopbackAudioParams()
+	var frames [][]byte
+	if h.serverAudioFormat == "pcm" {
+		frameBytes := sampleRate * 2 * channels * h.serverAudioFrameDuration / 1000
+		for start := 0; start < len(pcm); start += frameBytes {
+			frames = append(frames, pcm[start:min(start+frameBytes, len(pcm))])
+		}
+	} else {
+		// Opus解码端与编码采样率无关，按客户端采样率编码即可在设备上播放
+		var err error
+		frames, err = utils.PCMSlicesToOpusDataWithOptions([][]byte{pcm}, sampleRate, channels, h.opusOptions)
+		if err != nil {
+			h.LogError(fmt.Sprintf("回环测试音频编码失败: %v", err))
+			return
+		}
+	}
+
+	h.talkRound++
+	round := h.talkRound
+	atomic.StoreInt32(&h.serverVoiceStop, 0)
+	text := "回环测试"
+	h.LogInfo(fmt.Sprintf("回环测试回放: %.1f秒, %d帧", float64(len(pcm))/float64(sampleRate*2*channels), len(frames)))
+	if err := h.sendTTSMessage("start", "", 0); err != nil {
+		h.LogError(fmt.Sprintf("发送TTS开始状态失败: %v", err))
+		return
+	}
+	h.sendTTSMessage("sentence_start", text, 1)
+	if err := h.sendAudioFrames(frames, text, round); err != nil {
+		h.LogError(fmt.Sprintf("回环测试回放失败: %v", err))
+	}
+	h.sendTTSMessage("sentence_end", text, 1)
+	h.sendTTSMessage("stop", "", 1)
+}
+
+// replyLoopback tts 模式：不调用LLM，直接朗读识别结果，不写入对话历史
+func (h *ConnectionHandler) replyLoopback(text string) error {
+	h.talkRound++
+	round := h.talkRound
+	h.LogInfo(fmt.Sprintf("回环测试朗读识别结果: %s", text))
+	if err := h.sendSTTMessage(text); err != nil {
+		return fmt.Errorf("发送STT消息失败: %v", err)
+	}
+	if err := h.sendTTSMessage("start", "", 0); err != nil {
+		return fmt.Errorf("发送TTS开始状态失败: %v", err)
+	}
+	atomic.StoreInt32(&h.serverVoiceStop, 0)
+	h.setLastTextIndex(1)
+	return h.SpeakAndPlay(text, 1, round)
+}
+
+// loopbackAudioParams 客户端PCM的采样率和声道数
+func (h *ConnectionHandler) loopbackAudioParams() (int, int) {
+	sampleRate := h.clientAudioSampleRate
+	if sampleRate <= 0 {
+		sampleRate = 16000
+	}
+	channels := h.clientAudioChannels
+	if channels <= 0 {
+		channels = 1
+	}
+	return sampleRate, channels
+}
@@ -0,0 +1,252 @@
+package core
+
+import (
+	"ai-server-go/src/core/chat"
+	"ai-server-go/src/core/types"
+	"ai-server-go/src/database"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+/*
+* 对话模式：同一台设备可以在运行时切换对话方式。
+* assistant 为正常对话；translator 为双语翻译，识别结果翻译成另一种语言后朗读，不进入对话上下文；
+* dictation 为听写，只下发识别结果并写入会话记录，不调用LLM和TTS。
+* 设备发送 {"type":"mode","mode":"translator"} 切换，服务端回复 {"type":"mode","state":"changed"|"rejected",...}。
+* 可用模式由系统配置 conversation_mode 分类和设备 conversation_mode 能力配置决定，当前模式保存在会话上，重连恢复会话时沿用。
+ */
+
+// 对话模式
+const (
+	conversationModeAssistant  = "assistant"
+	conversationModeTranslator = "translator"
+	conversationModeDictation  = "dictation"
+)
+
+// knownConversationModes 支持的全部对话模式
+var knownConversationModes = []string{conversationModeAssistant, conversationModeTranslator, conversationModeDictation}
+
+// ConversationModeConfig 对话模式配置
+type ConversationModeConfig struct {
+	Default          string   `json:"default"`           // 新会话的默认模式
+	Available        []string `json:"available"`         // 设备可切换的模式
+	SourceLanguage   string   `json:"source_language"`   // 翻译模式的源语言
+	TargetLanguage   string   `json:"target_language"`   // 翻译模式的目标语言
+	TranslatorPrompt string   `json:"translator_prompt"` // 翻译提示词，{source}/{target} 替换为两种语言
+}
+
+// DefaultConversationModeConfig 默认对话模式配置
+func DefaultConversationModeConfig() ConversationModeConfig {
+	return ConversationModeConfig{
+		Default:        conversationModeAssistant,
+		Available:      append([]string(nil), knownConversationModes...),
+		SourceLanguage: "中文",
+		TargetLanguage: "英文",
+		TranslatorPrompt: "你是一名同声传译。用户说{source}时翻译成{target}，说{target}时翻译成{source}。" +
+			"只输出译文，不要解释，不要回答问题内容。",
+	}
+}
+
+// applyMap 使用配置map覆盖对话模式配置
+func (c *ConversationModeConfig) applyMap(config map[string]interface{}) {
+	if config == nil {
+		return
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, c)
+}
+
+// isAvailable 模式是否可用
+func (c ConversationModeConfig) isAvailable(mode string) bool {
+	return slices.Contains(c.Available, mode)
+}
+
+// loadConversationModeConfig 加载对话模式配置：系统配置 conversation_mode 分类 < 设备 conversation_mode 能力配置
+func (h *ConnectionHandler) loadConversationModeConfig(layered *layeredConfigSource) ConversationModeConfig {
+	config := DefaultConversationModeConfig()
+	layered.load("conversation_mode", "conversation_mode", "", config.applyMap)
+
+	// 未知模式忽略；正常对话始终可用，保证设备能切换回来
+	available := []string{conversationModeAssistant}
+	for _, mode := range config.Available {
+		if slices.Contains(knownConversationModes, mode) && !slices.Contains(available, mode) {
+			available = append(available, mode)
+		}
+	}
+	config.Available = available
+	if !config.isAvailable(config.Default) {
+		config.Default = conversationModeAssistant
+	}
+	return config
+}
+
+// initConversationMode 确定连接的初始模式：恢复的会话沿用原模式（仍可用时），否则使用默认模式
+func (h *ConnectionHandler) initConversationMode(session *database.ChatSession) {
+	mode := h.conversationModeConfig.Default
+	if session != nil && session.Mode != "" && h.conversationModeConfig.isAvailable(session.Mode) {
+		mode = session.Mode
+	}
+	h.conversationMode.Store(&mode)
+}
+
+// currentConversationMode 当前对话模式
+func (h *ConnectionHandler) currentConversationMode() string {
+	if mode := h.conversationMode.Load(); mode != nil {
+		return *mode
+	}
+	return conversationModeAssistant
+}
+
+// validateModeTransition 检查能否从当前模式切换到目标模式，不能切换时返回原因
+func (h *ConnectionHandler) validateModeTransition(from, to string) error {
+	if from == to {
+		return nil
+	}
+	if !slices.Contains(knownConversationModes, to) {
+		return fmt.Errorf("未知的对话模式: %s", to)
+	}
+	if !h.conversationModeConfig.isAvailable(to) {
+		return fmt.Errorf("设备未启用%s模式", to)
+	}
+	if h.loopbackMode != "" {
+		return fmt.Errorf("回环测试期间不能切换对话模式")
+	}
+	if to == conversationModeTranslator && h.llmProvider() == nil {
+		return fmt.Errorf("翻译模式需要LLM")
+	}
+	return nil
+}
+
+// handleModeMessage 处理设备的模式切换请求
+func (h *ConnectionHandler) handleModeMessage(msgMap map[string]interface{}) error {
+	requested, _ := msgMap["mode"].(string)
+	requested = strings.ToLower(strings.TrimSpace(requested))
+	previous := h.currentConversationMode()
+
+	if err := h.validateModeTransition(previous, requested); err != nil {
+		h.LogInfo(fmt.Sprintf("拒绝切换对话模式 %s -> %s: %v", previous, requested, err))
+		return h.sendModeMessage(map[string]interface{}{
+			"state":  "rejected",
+			"mode":   previous,
+			"reason": err.Error(),
+		})
+	}
+
+	if requested != previous {
+		// 旧模式下尚未完成的回复不再播放
+		if h.lastTextIndex() != -1 {
+			h.stopServerSpeak()
+			h.sendTTSMessage("stop", "", 0)
+			h.clearSpeakStatus()
+		}
+		h.conversationMode.Store(&requested)
+		h.persistConversationMode(requested)
+		h.LogInfo(fmt.Sprintf("切换对话模式: %s -> %s", previous, requested))
+	}
+	return h.sendModeMessage(map[string]interface{}{
+		"state":    "changed",
+		"mode":     requested,
+		"previous": previous,
+	})
+}
+
+// sendModeMessage 下发模式消息，附带当前可用模式
+func (h *ConnectionHandler) sendModeMessage(fields map[string]interface{}) error {
+	message := map[string]interface{}{
+		"type":       "mode",
+		"session_id": h.sessionID,
+		"available":  h.conversationModeConfig.Available,
+	}
+	for key, value := range fields {
+		message[key] = value
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("序列化模式消息失败: %v", err)
+	}
+	return h.conn.WriteMessage(1, data)
+}
+
+// persistConversationMode 将当前模式保存到会话
+func (h *ConnectionHandler) persistConversationMode(mode string) {
+	if h.memoryService == nil || h.deviceID == "" {
+		return
+	}
+	if err := h.memoryService.UpdateSession(h.sessionID, map[string]interface{}{"mode": mode}); err != nil {
+		h.LogError(fmt.Sprintf("保存对话模式失败: %v", err))
+	}
+}
+
+// replyDictation 听写模式：只下发识别结果并写入会话记录，不调用LLM
+func (h *ConnectionHandler) replyDictation(text string) error {
+	if err := h.sendSTTMessage(text); err != nil {
+		return fmt.Errorf("发送STT消息失败: %v", err)
+	}
+	h.recordDialogueMessage(chat.Message{Role: "user", Content: text})
+	h.clearSpeakStatus()
+	return nil
+}
+
+// replyTranslation 翻译模式：将识别结果翻译后朗读，译文不进入对话上下文
+func (h *ConnectionHandler) replyTranslation(ctx context.Context, text string, round int) error {
+	if err := h.sendSTTMessage(text); err != nil {
+		return fmt.Errorf("发送STT消息失败: %v", err)
+	}
+	if err := h.sendTTSMessage("start", "", 0); err != nil {
+		return fmt.Errorf("发送TTS开始状态失败: %v", err)
+	}
+
+	config := h.conversationModeConfig
+	prompt := strings.NewReplacer("{source}", config.SourceLanguage, "{target}", config.TargetLanguage).
+		Replace(config.TranslatorPrompt)
+	messages := []types.Message{
+		{Role: "system", Content: prompt},
+		{Role: "user", Content: text},
+	}
+
+	ctx, cancel := context.WithCancel(h.requestContext(ctx, round))
+	defer cancel()
+	deadline := h.startStageDeadline(pipelineStageLLM, round, cancel)
+	responses, err := h.llmProvider().Response(ctx, h.sessionID+"-translate", messages)
+	if err != nil {
+		deadline.stop()
+		return fmt.Errorf("翻译失败: %v", err)
+	}
+
+	var builder strings.Builder
+	for first := true; ; first = false {
+		var chunk string
+		var ok bool
+		select {
+		case chunk, ok = <-responses:
+		case <-deadline.done():
+			return errStageTimeout
+		}
+		if !ok {
+			break
+		}
+		if first && !deadline.stop() {
+			return errStageTimeout
+		}
+		builder.WriteString(chunk)
+	}
+	deadline.stop()
+
+	translation := strings.TrimSpace(builder.String())
+	h.recordLLMUsage([]string{prompt, text}, translation)
+	if translation == "" || round != h.talkRound {
+		h.sendTTSMessage("stop", "", 0)
+		h.clearSpeakStatus()
+		return nil
+	}
+	atomic.StoreInt32(&h.serverVoiceStop, 0)
+	h.setLastTextIndex(1)
+	return h.SpeakAndPlay(translation, 1, round)
+}
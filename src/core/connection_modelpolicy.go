@@ -0,0 +1,63 @@
+package core
+
+import (
+	"ai-server-go/src/core/providers/llm"
+	"fmt"
+)
+
+/*
+* 模型策略：连接建立时检查本连接使用的LLM模型是否被系统/用户（设备所有者）的模型策略允许。
+* 不允许时改用策略允许的替代provider；没有可用的替代时拒绝本连接的对话轮次并提示原因。
+ */
+
+// enforceModelPolicy 按模型策略检查并替换本连接的LLM提供者
+func (h *ConnectionHandler) enforceModelPolicy() {
+	if h.configService == nil {
+		return
+	}
+	getter, ok := h.llmProvider().(llmConfigGetter)
+	if !ok || getter.Config() == nil {
+		return
+	}
+	modelName := getter.Config().ModelName
+
+	var devicePtr *uint
+	if h.deviceID != "" {
+		deviceID := parseUint(h.deviceID)
+		devicePtr = &deviceID
+	}
+	fallback, err := h.configService.CheckModelPolicy(modelName, devicePtr, h.userID)
+	if err != nil {
+		h.modelPolicyError = err.Error()
+		h.LogError(fmt.Sprintf("模型策略检查失败: %v", err))
+		return
+	}
+	if fallback == nil {
+		return
+	}
+
+	extra, err := fallback.PropsMap()
+	if err != nil {
+		h.modelPolicyError = fmt.Sprintf("解析替代模型配置失败: %v", err)
+		h.LogError(h.modelPolicyError)
+		return
+	}
+	provider, err := llm.Create(fallback.Type, &llm.Config{Type: fallback.Type, Extra: extra})
+	if err != nil {
+		h.modelPolicyError = fmt.Sprintf("创建替代LLM提供者失败: %v", err)
+		h.LogError(h.modelPolicyError)
+		return
+	}
+	h.storeProvider("LLM", provider)
+	h.LogInfo(fmt.Sprintf("模型策略覆盖: 模型 %s 不被允许，本连接改用 %s", modelName, fallback.Name))
+}
+
+// rejectForModelPolicy 模型策略不允许且没有替代模型时拒绝新的对话轮次
+func (h *ConnectionHandler) rejectForModelPolicy() bool {
+	if h.modelPolicyError == "" {
+		return false
+	}
+	h.LogInfo("模型策略不允许当前模型，拒绝新的对话轮次")
+	h.SystemSpeak("当前使用的模型不在允许范围内，请联系管理员")
+	return true
+}
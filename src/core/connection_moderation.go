@@ -0,0 +1,123 @@
+package core
+
+import (
+	"ai-server-go/src/core/chat"
+	"ai-server-go/src/core/moderation"
+	"ai-server-go/src/database"
+	"context"
+	"fmt"
+	"time"
+)
+
+/*
+* LLM回复内容审核：默认关闭。启用后对每轮最终回复评分并记录到ChatMessage，
+* 开启拦截(block)时逐句审核，超过阈值则停止下发后续内容并播报提示语。
+* 审核服务失败时记录日志并放行，严格模式(strict)下视为拦截。
+* 所有助手回复（LLM生成、缓存命中、开场问候等）写入对话历史时都经 recordAssistantMessage 保存，
+* 评分失败时消息照常保存，只是不带审核结果；被拦截的回复保存原文并标记拦截，恢复会话时替换为提示语。
+ */
+
+// responseModeration 单轮回复的审核状态
+type responseModeration struct {
+	blocked  bool
+	result   *moderation.Result
+	original string // 被拦截时的回复原文，对话上下文中只保留提示语
+}
+
+// initModeration 加载审核配置：系统配置 moderation 分类 < 用户/设备的 moderation 能力配置
+func (h *ConnectionHandler) initModeration(layered *layeredConfigSource) {
+	config := moderation.DefaultConfig()
+	layered.load("moderation", "moderation", "", config.ApplyMap)
+
+	h.moderationConfig = config
+	if !config.Enabled {
+		return
+	}
+
+	moderator, err := moderation.New(config)
+	if err != nil {
+		h.logger.Error("创建内容审核器失败，审核功能不可用: %v", err)
+		return
+	}
+	h.moderator = moderator
+	h.LogInfo(fmt.Sprintf("内容审核已启用: provider=%s, threshold=%.2f, block=%t, strict=%t",
+		config.Provider, config.Threshold, config.Block, config.Strict))
+}
+
+// moderateSegment 拦截模式下审核待播放的分段，返回是否允许播放；首次拦截时返回需要播报的提示语
+func (h *ConnectionHandler) moderateSegment(ctx context.Context, state *responseModeration, segment string) (notice string, allowed bool) {
+	if state.blocked {
+		return "", false
+	}
+	if h.moderator == nil || !h.moderationConfig.Block {
+		return "", true
+	}
+
+	result, err := moderation.Check(ctx, h.moderator, h.moderationConfig, segment)
+	if err != nil {
+		h.LogError(fmt.Sprintf("内容审核失败(strict=%t): %v", h.moderationConfig.Strict, err))
+	}
+	if result == nil || !result.Blocked {
+		return "", true
+	}
+
+	state.blocked = true
+	state.result = result
+	h.LogInfo(fmt.Sprintf("LLM回复被内容审核拦截: score=%.2f, flags=%v, 分段: %s", result.Score, result.Flags, segment))
+	return h.moderationConfig.BlockedMessage, false
+}
+
+// putAssistantReply 将助手回复写入对话历史，state 为本轮回复的审核状态，未逐句审核时为nil
+func (h *ConnectionHandler) putAssistantReply(state *responseModeration, content string) {
+	h.replyModeration = state
+	h.dialogueManager.Put(chat.Message{
+		Role:    "assistant",
+		Content: content,
+	})
+	h.replyModeration = nil
+}
+
+// recordAssistantMessage 保存助手回复；启用内容审核时先对最终回复评分，审核结果随消息一起保存
+func (h *ConnectionHandler) recordAssistantMessage(state *responseModeration, content string) {
+	if h.moderator == nil {
+		h.addTurnMessage(chat.Message{Role: "assistant", Content: content}, "text")
+		return
+	}
+	if state == nil {
+		state = &responseModeration{}
+	}
+	if state.blocked && state.original != "" {
+		content = state.original
+	}
+
+	// 评分完成后加入本轮消息，本轮结算时等待评分结束
+	turn := h.currentTurn()
+	turn.inflight.Add(1)
+	timestamp := time.Now()
+	go func() {
+		defer turn.inflight.Done()
+		message := database.TurnMessage{
+			Role:        "assistant",
+			Content:     content,
+			MessageType: "text",
+			Timestamp:   timestamp,
+		}
+		result := state.result
+		if result == nil {
+			var err error
+			result, err = moderation.Check(context.Background(), h.moderator, h.moderationConfig, content)
+			if err != nil {
+				h.LogError(fmt.Sprintf("内容审核失败(strict=%t): %v", h.moderationConfig.Strict, err))
+			}
+		}
+		// 评分失败时照常保存回复，只是不带审核结果；未逐句拦截时最终评分只做记录
+		if result != nil {
+			message.Moderation = &database.MessageModeration{
+				Score:   result.Score,
+				Flags:   result.Flags,
+				Blocked: state.blocked,
+			}
+		}
+		turn.add(turnMessage{message: message})
+	}()
+}
@@ -0,0 +1,272 @@
+package core
+
+import (
+	"ai-server-go/src/core/pool"
+	"ai-server-go/src/core/providers"
+	"ai-server-go/src/core/providers/vlllm"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*
+* 会话级provider覆盖：管理员调试时可以为某个正在进行的会话固定使用指定的provider，
+* 优先于设备绑定、灰度选择和模型策略，只保存在连接状态中，不写入配置，会话结束时自动清除。
+* 设置时立即创建provider实例以校验配置，在下一轮对话开始时切换（ASR在设备下一次开始拾音时切换），
+* 避免替换正在使用的实例；被替换下来的覆盖实例在连接关闭时统一清理。
+* 替换在锁内进行，其他协程通过 asrProvider() 等方法读取；覆盖的TTS与资源池取出的TTS一样做结果校验并接入降级链。
+ */
+
+// overridableCategories 支持会话级覆盖的provider类别
+var overridableCategories = []string{"ASR", "LLM", "TTS", "VLLLM"}
+
+// ErrSessionNotFound 会话不在本实例的活跃连接中
+var ErrSessionNotFound = errors.New("会话不存在或已结束")
+
+// overrideInstance 覆盖创建的provider实例及其工厂
+type overrideInstance struct {
+	factory  pool.ResourceFactory
+	instance interface{}
+}
+
+// providerOverrideState 会话级provider覆盖状态
+type providerOverrideState struct {
+	mu        sync.Mutex
+	names     map[string]string           // 类别 -> 覆盖的provider名称
+	pending   map[string]interface{}      // 等待切换的provider实例，为原始实例时表示恢复
+	originals map[string]interface{}      // 首次覆盖前的原始provider
+	created   map[string]overrideInstance // 覆盖创建的全部实例，连接关闭时清理
+}
+
+// SetProviderOverride 为本会话固定使用指定provider，在下一轮对话开始时生效
+func (h *ConnectionHandler) SetProviderOverride(category, name string) error {
+	category = strings.ToUpper(category)
+	if !slices.Contains(overridableCategories, category) {
+		return fmt.Errorf("不支持覆盖的provider类别: %s", category)
+	}
+	if h.configService == nil {
+		return fmt.Errorf("数据库未初始化，不能覆盖provider")
+	}
+
+	factory := h.newOverrideFactory(category, name)
+	if factory == nil {
+		return fmt.Errorf("%s提供者不存在或配置无效: %s", category, name)
+	}
+	instance, err := factory.Create()
+	if err != nil {
+		return fmt.Errorf("创建%s提供者失败: %v", category, err)
+	}
+	if !isProviderOf(category, instance) {
+		factory.Destroy(instance)
+		return fmt.Errorf("%s不是有效的%s提供者", name, category)
+	}
+
+	state := &h.providerOverrides
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if state.names == nil {
+		state.names = make(map[string]string)
+		state.pending = make(map[string]interface{})
+		state.originals = make(map[string]interface{})
+		state.created = make(map[string]overrideInstance)
+	}
+	state.names[category] = name
+	state.pending[category] = instance
+	if category == "TTS" {
+		// 与资源池取出的TTS一致：校验合成结果，失败时走降级链
+		state.pending[category] = h.providerSet.WrapTTS(instance.(providers.TTSProvider))
+	}
+	state.created[fmt.Sprintf("%s/%p", category, instance)] = overrideInstance{factory: factory, instance: instance}
+	h.logger.Warn("会话 %s 设置provider覆盖: %s -> %s，下一轮对话开始时生效", h.sessionID, category, name)
+	return nil
+}
+
+// ClearProviderOverride 清除本会话的provider覆盖，category为空时清除全部，下一轮对话开始时恢复原provider
+func (h *ConnectionHandler) ClearProviderOverride(category string) {
+	category = strings.ToUpper(category)
+	state := &h.providerOverrides
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	for name := range state.names {
+		if category != "" && name != category {
+			continue
+		}
+		delete(state.names, name)
+		if original, ok := state.originals[name]; ok {
+			state.pending[name] = original
+		} else {
+			// 尚未切换过，直接取消等待中的覆盖
+			delete(state.pending, name)
+		}
+		h.logger.Warn("会话 %s 清除provider覆盖: %s", h.sessionID, name)
+	}
+}
+
+// ProviderOverrides 本会话当前的provider覆盖（类别 -> provider名称）
+func (h *ConnectionHandler) ProviderOverrides() map[string]string {
+	state := &h.providerOverrides
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return maps.Clone(state.names)
+}
+
+// applyProviderOverrides 在轮次边界切换等待中的provider，includeASR为false时ASR留到下一次开始拾音
+func (h *ConnectionHandler) applyProviderOverrides(includeASR bool) {
+	state := &h.providerOverrides
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	for category, instance := range state.pending {
+		if category == "ASR" && !includeASR {
+			continue
+		}
+		if _, ok := state.originals[category]; !ok {
+			state.originals[category] = h.currentProvider(category)
+		}
+		h.setProvider(category, instance)
+		delete(state.pending, category)
+		if name, ok := state.names[category]; ok {
+			h.LogInfo(fmt.Sprintf("会话级provider覆盖生效: %s -> %s", category, name))
+		} else {
+			h.LogInfo(fmt.Sprintf("会话级provider覆盖已清除，恢复原%s提供者", category))
+		}
+	}
+
+	if len(state.names) > 0 {
+		active := make([]string, 0, len(state.names))
+		for category, name := range state.names {
+			active = append(active, category+"="+name)
+		}
+		sort.Strings(active)
+		h.LogInfo(fmt.Sprintf("会话级provider覆盖中: %s", strings.Join(active, ", ")))
+	}
+}
+
+// releaseProviderOverrides 连接关闭时恢复原provider并清理覆盖创建的实例，原provider由连接上下文归还资源池
+func (h *ConnectionHandler) releaseProviderOverrides() {
+	state := &h.providerOverrides
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	for category, original := range state.originals {
+		h.setProvider(category, original)
+	}
+	for _, created := range state.created {
+		if err := created.factory.Destroy(created.instance); err != nil {
+			h.logger.Warn("清理会话覆盖的provider失败: %v", err)
+		}
+	}
+	state.names, state.pending, state.originals, state.created = nil, nil, nil, nil
+}
+
+// newOverrideFactory 按provider名称创建工厂，不经过灰度选择
+func (h *ConnectionHandler) newOverrideFactory(category, name string) pool.ResourceFactory {
+	deleteAudio, err := h.configService.GetSystemConfigBool("audio", "delete_audio")
+	if err != nil {
+		deleteAudio = true
+	}
+	switch category {
+	case "ASR":
+		return pool.NewASRFactory(name, h.configService, h.logger, deleteAudio, nil)
+	case "LLM":
+		return pool.NewLLMFactory(name, h.configService, h.logger, nil)
+	case "TTS":
+		return pool.NewTTSFactory(name, h.configService, h.logger, deleteAudio, nil)
+	case "VLLLM":
+		return pool.NewVLLLMFactory(name, h.configService, h.logger, nil)
+	}
+	return nil
+}
+
+// isProviderOf 实例是否为对应类别的provider
+func isProviderOf(category string, instance interface{}) bool {
+	switch category {
+	case "ASR":
+		_, ok := instance.(providers.ASRProvider)
+		return ok
+	case "LLM":
+		_, ok := instance.(providers.LLMProvider)
+		return ok
+	case "TTS":
+		_, ok := instance.(providers.TTSProvider)
+		return ok
+	case "VLLLM":
+		_, ok := instance.(*vlllm.Provider)
+		return ok
+	}
+	return false
+}
+
+// currentProvider 连接当前使用的provider
+func (h *ConnectionHandler) currentProvider(category string) interface{} {
+	switch category {
+	case "ASR":
+		return h.asrProvider()
+	case "LLM":
+		return h.llmProvider()
+	case "TTS":
+		return h.ttsProvider()
+	case "VLLLM":
+		return h.vlllmProvider()
+	}
+	return nil
+}
+
+// setProvider 在轮次边界替换连接使用的provider，ASR切换后重新设置监听和重采样
+func (h *ConnectionHandler) setProvider(category string, instance interface{}) {
+	h.storeProvider(category, instance)
+	if category != "ASR" {
+		return
+	}
+	if provider := h.asrProvider(); provider != nil {
+		provider.SetListener(h)
+		h.setupASRResampler()
+	}
+}
+
+// storeProvider 加锁替换provider，正在处理的协程继续使用已取得的旧实例
+func (h *ConnectionHandler) storeProvider(category string, instance interface{}) {
+	h.providers.mu.Lock()
+	defer h.providers.mu.Unlock()
+	switch category {
+	case "ASR":
+		h.providers.asr, _ = instance.(providers.ASRProvider)
+	case "LLM":
+		h.providers.llm, _ = instance.(providers.LLMProvider)
+	case "TTS":
+		h.providers.tts, _ = instance.(providers.TTSProvider)
+	case "VLLLM":
+		h.providers.vlllm, _ = instance.(*vlllm.Provider)
+	}
+}
+
+// asrProvider 连接当前使用的ASR提供者
+func (h *ConnectionHandler) asrProvider() providers.ASRProvider {
+	h.providers.mu.RLock()
+	defer h.providers.mu.RUnlock()
+	return h.providers.asr
+}
+
+// llmProvider 连接当前使用的LLM提供者
+func (h *ConnectionHandler) llmProvider() providers.LLMProvider {
+	h.providers.mu.RLock()
+	defer h.providers.mu.RUnlock()
+	return h.providers.llm
+}
+
+// ttsProvider 连接当前使用的TTS提供者
+func (h *ConnectionHandler) ttsProvider() providers.TTSProvider {
+	h.providers.mu.RLock()
+	defer h.providers.mu.RUnlock()
+	return h.providers.tts
+}
+
+// vlllmProvider 连接当前使用的VLLLM提供者，未配置时为nil
+func (h *ConnectionHandler) vlllmProvider() *vlllm.Provider {
+	h.providers.mu.RLock()
+	defer h.providers.mu.RUnlock()
+	return h.providers.vlllm
+}
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"ai-server-go/src/core/providers/tts"
+	"fmt"
+)
+
+/*
+* 人设：会话开始时按 设备 > 用户 > 全局 分配解析人设，应用其提示词、TTS音色、语速和快速回复词。
+* 设备专属的TTS能力配置优先于人设的音色和语速；人设优先于用户和系统默认配置。
+ */
+
+// loadPersona 解析当前设备会话的人设，并按人设的音色和语速创建本连接专用的TTS提供者
+func (h *ConnectionHandler) loadPersona() {
+	if h.configService == nil {
+		return
+	}
+	persona, err := h.configService.ResolvePersona(parseUint(h.deviceID), h.userID)
+	if err != nil {
+		h.logger.Error("解析人设失败: %v", err)
+		return
+	}
+	if persona == nil {
+		return
+	}
+	h.persona = persona
+	h.LogInfo(fmt.Sprintf("使用人设: %s", persona.Name))
+	h.applyPersonaVoice()
+}
+
+// applyPersonaVoice 按人设的音色和语速替换TTS提供者，设备配置了专属TTS能力时保持设备配置
+func (h *ConnectionHandler) applyPersonaVoice() {
+	if h.persona.Voice == "" && h.persona.SpeechRate <= 0 {
+		return
+	}
+	if h.hasDeviceTTSCapability() {
+		h.LogInfo("设备配置了专属TTS能力，不应用人设的音色和语速")
+		return
+	}
+	getter, ok := h.ttsProvider().(configGetter)
+	if !ok || getter.Config() == nil {
+		return
+	}
+
+	ttsConfig := *getter.Config()
+	if h.persona.Voice != "" {
+		ttsConfig.Voice = h.persona.Voice
+	}
+	if h.persona.SpeechRate > 0 {
+		ttsConfig.SpeechRate = h.persona.SpeechRate
+	}
+
+	deleteAudio, err := h.configService.GetSystemConfigBool("audio", "delete_audio")
+	if err != nil {
+		h.logger.Error("获取删除音频配置失败: %v", err)
+		deleteAudio = true // 默认删除
+	}
+	provider, err := tts.Create(ttsConfig.Type, &ttsConfig, deleteAudio, h.logger)
+	if err != nil {
+		h.logger.Error("按人设创建TTS提供者失败: %v", err)
+		return
+	}
+	h.storeProvider("TTS", provider)
+}
+
+// hasDeviceTTSCapability 设备是否配置了专属TTS能力
+func (h *ConnectionHandler) hasDeviceTTSCapability() bool {
+	config, err := h.configService.GetDeviceCapabilityConfigWithFallback(parseUint(h.deviceID), h.userID)
+	if err != nil || config == nil {
+		return false
+	}
+	for _, capability := range config.Capabilities {
+		if capability.CapabilityName == "tts" && capability.Config["priority_source"] == "device" {
+			return true
+		}
+	}
+	return false
+}
+
+// applyPersonaPrompt 人设配置了提示词时替换默认提示词
+func (h *ConnectionHandler) applyPersonaPrompt() {
+	if h.persona == nil || h.persona.Prompt == "" {
+		return
+	}
+	h.dialogueManager.SetSystemMessage(h.persona.Prompt)
+}
+
+// quickReplyWords 快速回复词，人设配置了时优先使用，否则使用系统配置 audio.quick_reply_words
+func (h *ConnectionHandler) quickReplyWords() ([]string, error) {
+	if h.persona != nil {
+		if words := h.persona.QuickReplies(); len(words) > 0 {
+			return words, nil
+		}
+	}
+	return h.configService.GetSystemConfigArray("audio", "quick_reply_words")
+}
@@ -0,0 +1,89 @@
+package core
+
+import (
+	"encoding/json"
+	"time"
+)
+
+/*
+* 播放提示：服务端在 tts start/sentence_start 消息中附带 playback 字段，
+* 提示设备本次播放使用的音量和淡入淡出时长（如夜间自动降低音量）。
+* 配置来自系统配置 playback 分类，设备 playback 能力配置可以覆盖；免打扰时段按设备时区计算。
+* 不识别该字段的设备忽略即可，播放行为不受影响。
+ */
+
+// PlaybackConfig 播放提示配置
+type PlaybackConfig struct {
+	Enabled         bool   `json:"enabled"`           // 是否下发播放提示
+	Volume          int    `json:"volume"`            // 正常播放音量（0-100）
+	FadeInMs        int    `json:"fade_in_ms"`        // 淡入时长（毫秒）
+	FadeOutMs       int    `json:"fade_out_ms"`       // 淡出时长（毫秒）
+	QuietHoursStart string `json:"quiet_hours_start"` // 降低音量的开始时间 HH:MM，为空表示不限制
+	QuietHoursEnd   string `json:"quiet_hours_end"`   // 降低音量的结束时间 HH:MM
+	QuietVolume     int    `json:"quiet_volume"`      // 免打扰时段的播放音量（0-100）
+	Timezone        string `json:"timezone"`          // 设备时区（IANA名称），为空时使用服务器时区
+}
+
+// PlaybackHints 下发给设备的播放提示
+type PlaybackHints struct {
+	Volume     int  `json:"volume"`      // 播放音量（0-100）
+	FadeInMs   int  `json:"fade_in_ms"`  // 淡入时长（毫秒）
+	FadeOutMs  int  `json:"fade_out_ms"` // 淡出时长（毫秒）
+	QuietHours bool `json:"quiet_hours"` // 当前是否处于免打扰时段
+}
+
+// DefaultPlaybackConfig 默认播放提示配置
+func DefaultPlaybackConfig() PlaybackConfig {
+	return PlaybackConfig{
+		Enabled:     false,
+		Volume:      80,
+		QuietVolume: 30,
+	}
+}
+
+// applyMap 使用配置map覆盖播放提示配置
+func (c *PlaybackConfig) applyMap(config map[string]interface{}) {
+	if config == nil {
+		return
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, c)
+}
+
+// Resolve 计算指定时间的播放提示，免打扰时段使用 quiet_volume（不高于正常音量）
+func (c PlaybackConfig) Resolve(now time.Time) PlaybackHints {
+	hints := PlaybackHints{
+		Volume:    clampVolume(c.Volume),
+		FadeInMs:  max(c.FadeInMs, 0),
+		FadeOutMs: max(c.FadeOutMs, 0),
+	}
+	if inQuietHours(now, c.QuietHoursStart, c.QuietHoursEnd, c.Timezone) {
+		hints.QuietHours = true
+		hints.Volume = min(hints.Volume, clampVolume(c.QuietVolume))
+	}
+	return hints
+}
+
+// clampVolume 将音量限制在 0-100
+func clampVolume(volume int) int {
+	return min(max(volume, 0), 100)
+}
+
+// loadPlaybackConfig 加载播放提示配置：系统配置 playback 分类 < 设备 playback 能力配置
+func (h *ConnectionHandler) loadPlaybackConfig(layered *layeredConfigSource) PlaybackConfig {
+	config := DefaultPlaybackConfig()
+	layered.load("playback", "playback", "", config.applyMap)
+	return config
+}
+
+// playbackHints 当前的播放提示，未启用时返回nil
+func (h *ConnectionHandler) playbackHints() *PlaybackHints {
+	if !h.playbackConfig.Enabled {
+		return nil
+	}
+	hints := h.playbackConfig.Resolve(time.Now())
+	return &hints
+}
@@ -0,0 +1,156 @@
+package core
+
+import (
+	"sync"
+)
+
+/*
+* 语音起点前置缓冲（pre-roll）：开启后服务端在检测到语音起点之前不向ASR转发音频，只在会话内保留最近 pre_roll_ms 毫秒的音频；
+* 某一帧能量超过 energy_threshold 时视为语音起点，先补发缓冲中的音频再转发该帧和后续音频，
+* 避免起点检测的延迟截掉第一个音素（“你好”被识别成“好”）。得到识别结果、ASR阶段超时或本轮播报结束后重新等待语音起点。
+* 缓冲按会话独立，按时长封顶（最长 maxPreRollMs），超出时丢弃最早的音频。手动拾音模式由设备控制收听，不做门控。
+* 配置来自系统配置 audio_preroll 分类，设备 vad 能力配置中的 pre_roll 对象可以覆盖，默认关闭。
+ */
+
+const maxPreRollMs = 2000 // 前置缓冲时长上限（毫秒）
+
+// AudioPreRollConfig 语音起点前置缓冲配置
+type AudioPreRollConfig struct {
+	Enabled         bool    `json:"enabled"`          // 是否在语音起点前缓冲音频，起点后再转发给ASR
+	PreRollMs       int     `json:"pre_roll_ms"`      // 语音起点前保留的音频时长（毫秒）
+	EnergyThreshold float64 `json:"energy_threshold"` // 语音起点的能量阈值（归一化RMS，0-1）
+}
+
+// DefaultAudioPreRollConfig 默认前置缓冲配置：关闭
+func DefaultAudioPreRollConfig() AudioPreRollConfig {
+	return AudioPreRollConfig{
+		Enabled:         false,
+		PreRollMs:       300,
+		EnergyThreshold: 0.01,
+	}
+}
+
+// applyMap 使用配置map覆盖前置缓冲配置
+func (c *AudioPreRollConfig) applyMap(config map[string]interface{}) {
+	if config == nil {
+		return
+	}
+	if v, ok := config["enabled"].(bool); ok {
+		c.Enabled = v
+	}
+	if _, ok := config["pre_roll_ms"]; ok {
+		c.PreRollMs = getIntFromConfig(config, "pre_roll_ms")
+	}
+	if v := getFloatFromConfig(config, "energy_threshold"); v > 0 {
+		c.EnergyThreshold = v
+	}
+}
+
+// PreRollBuffer 语音起点前的音频门控和前置缓冲，每个会话一个
+type PreRollBuffer struct {
+	config AudioPreRollConfig
+
+	mu      sync.Mutex
+	open    bool     // 已检测到语音起点，音频直接转发
+	waiting bool     // 已开始等待语音起点
+	frames  [][]byte // 语音起点前保留的音频帧
+	size    int      // frames 的总字节数
+}
+
+// NewPreRollBuffer 创建前置缓冲，缓冲时长限制在 [0, maxPreRollMs]
+func NewPreRollBuffer(config AudioPreRollConfig) *PreRollBuffer {
+	config.PreRollMs = min(max(config.PreRollMs, 0), maxPreRollMs)
+	return &PreRollBuffer{config: config}
+}
+
+// Process 处理一帧PCM音频（16bit小端），bytesPerSecond 为该音频每秒的字节数。
+// 返回应转发给ASR的音频（语音起点时包含缓冲的音频）、是否转发，以及是否刚开始等待语音起点
+func (b *PreRollBuffer) Process(pcm []byte, bytesPerSecond int) ([]byte, bool, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.open {
+		return pcm, true, false
+	}
+	started := !b.waiting
+	b.waiting = true
+
+	if rmsEnergy(pcmToFloat32(pcm)) >= b.config.EnergyThreshold {
+		out := make([]byte, 0, b.size+len(pcm))
+		for _, frame := range b.frames {
+			out = append(out, frame...)
+		}
+		out = append(out, pcm...)
+		b.open = true
+		b.frames = nil
+		b.size = 0
+		return out, true, started
+	}
+
+	// 调用方可能复用音频缓冲区，保留副本
+	b.frames = append(b.frames, append([]byte(nil), pcm...))
+	b.size += len(pcm)
+	limit := bytesPerSecond * b.config.PreRollMs / 1000
+	for len(b.frames) > 0 && b.size > limit {
+		b.size -= len(b.frames[0])
+		b.frames[0] = nil
+		b.frames = b.frames[1:]
+	}
+	return nil, false, started
+}
+
+// IsOpen 是否已检测到语音起点
+func (b *PreRollBuffer) IsOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open
+}
+
+// Rearm 一次识别结束，清空缓冲并重新等待语音起点
+func (b *PreRollBuffer) Rearm() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.open = false
+	b.waiting = false
+	b.frames = nil
+	b.size = 0
+}
+
+// loadAudioPreRollConfig 加载前置缓冲配置：系统配置 audio_preroll 分类 < 设备 vad 能力中的 pre_roll 配置
+func (h *ConnectionHandler) loadAudioPreRollConfig(layered *layeredConfigSource) AudioPreRollConfig {
+	config := DefaultAudioPreRollConfig()
+	layered.load("audio_preroll", "vad", "pre_roll", config.applyMap)
+	return config
+}
+
+// gatePreRoll 语音起点前缓冲客户端音频，返回应转发给ASR的音频和是否转发；未启用或手动拾音时原样转发
+func (h *ConnectionHandler) gatePreRoll(pcm []byte) ([]byte, bool) {
+	if h.preRollBuffer == nil || h.listenMode() == "manual" {
+		return pcm, true
+	}
+	sampleRate := h.clientAudioSampleRate
+	if sampleRate <= 0 {
+		sampleRate = 16000
+	}
+	channels := max(h.clientAudioChannels, 1)
+	out, forward, started := h.preRollBuffer.Process(pcm, sampleRate*2*channels)
+	if started {
+		// ASR流式识别要到语音起点才开始，无语音超时从开始等待时计时
+		h.asrProvider().ResetStartListenTime()
+	}
+	if forward && len(out) > len(pcm) {
+		h.logger.Debug("检测到语音起点，补发前置缓冲音频 %d 字节", len(out)-len(pcm))
+	}
+	return out, forward
+}
+
+// preRollWaiting 是否仍在等待语音起点，此时尚未向ASR转发音频
+func (h *ConnectionHandler) preRollWaiting() bool {
+	return h.preRollBuffer != nil && h.listenMode() != "manual" && !h.preRollBuffer.IsOpen()
+}
+
+// rearmPreRoll 一次识别结束，重新等待语音起点
+func (h *ConnectionHandler) rearmPreRoll() {
+	if h.preRollBuffer != nil {
+		h.preRollBuffer.Rearm()
+	}
+}
@@ -0,0 +1,187 @@
+package core
+
+import (
+	"ai-server-go/src/core/providers"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/*
+* 主动发起对话：设备空闲一段时间后，由服务端主动发起一轮对话
+* （如"好久没说话了，要不要聊聊？"）。走正常的LLM→TTS流程，通过当前连接下发音频。
+* 完全可选（默认关闭），通过系统配置 proactive 分类或设备 proactive 能力开启；
+* 免打扰时段按设备时区计算，期间不会主动发起。
+ */
+
+// ProactiveConfig 主动对话配置
+type ProactiveConfig struct {
+	Enabled         bool   `json:"enabled"`           // 是否启用
+	IdleSeconds     int    `json:"idle_seconds"`      // 空闲多久后主动发起（秒）
+	Prompt          string `json:"prompt"`            // 发给LLM的主动对话指令
+	MaxPerSession   int    `json:"max_per_session"`   // 单个会话最多主动发起次数，0表示不限制
+	QuietHoursStart string `json:"quiet_hours_start"` // 免打扰开始时间 HH:MM，为空表示不限制
+	QuietHoursEnd   string `json:"quiet_hours_end"`   // 免打扰结束时间 HH:MM
+	Timezone        string `json:"timezone"`          // 设备时区（IANA名称），为空时使用服务器时区
+}
+
+// proactiveCheckInterval 空闲检查间隔
+const proactiveCheckInterval = 10 * time.Second
+
+// DefaultProactiveConfig 默认主动对话配置
+func DefaultProactiveConfig() ProactiveConfig {
+	return ProactiveConfig{
+		Enabled:       false,
+		IdleSeconds:   600,
+		Prompt:        "用户已经有一段时间没有说话了。请根据之前的对话，用一两句简短、自然、友好的话主动和用户打招呼，问问对方要不要继续聊天。",
+		MaxPerSession: 3,
+	}
+}
+
+// applyMap 使用配置map覆盖主动对话配置
+func (c *ProactiveConfig) applyMap(config map[string]interface{}) {
+	if config == nil {
+		return
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, c)
+}
+
+// parseClock 解析 HH:MM 为当天分钟数
+func parseClock(value string) (int, bool) {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) != 2 {
+		return 0, false
+	}
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, false
+	}
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 {
+		return 0, false
+	}
+	return hour*60 + minute, true
+}
+
+// inQuietHours 判断指定时间是否处于免打扰时段
+func (c ProactiveConfig) inQuietHours(now time.Time) bool {
+	return inQuietHours(now, c.QuietHoursStart, c.QuietHoursEnd, c.Timezone)
+}
+
+// inQuietHours 判断指定时间在timezone时区下是否处于 start-end 时段（HH:MM，支持跨午夜，如 22:00-07:00）
+func inQuietHours(now time.Time, startClock, endClock, timezone string) bool {
+	start, ok := parseClock(startClock)
+	if !ok {
+		return false
+	}
+	end, ok := parseClock(endClock)
+	if !ok || start == end {
+		return false
+	}
+
+	if timezone != "" {
+		if location, err := time.LoadLocation(timezone); err == nil {
+			now = now.In(location)
+		}
+	}
+	current := now.Hour()*60 + now.Minute()
+	if start < end {
+		return current >= start && current < end
+	}
+	return current >= start || current < end
+}
+
+// loadProactiveConfig 加载主动对话配置：系统配置 proactive 分类 < 设备 proactive 能力配置
+func (h *ConnectionHandler) loadProactiveConfig(layered *layeredConfigSource) ProactiveConfig {
+	config := DefaultProactiveConfig()
+	layered.load("proactive", "proactive", "", config.applyMap)
+	return config
+}
+
+// touchActivity 记录最近一次交互时间（收到客户端消息或下发音频）
+func (h *ConnectionHandler) touchActivity() {
+	atomic.StoreInt64(&h.lastActivity, time.Now().UnixNano())
+}
+
+// idleDuration 距离最近一次交互的时长
+func (h *ConnectionHandler) idleDuration() time.Duration {
+	last := atomic.LoadInt64(&h.lastActivity)
+	if last == 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, last))
+}
+
+// proactiveSchedulerCoroutine 定期检查空闲时长，满足条件时主动发起一轮对话
+func (h *ConnectionHandler) proactiveSchedulerCoroutine() {
+	defer func() {
+		if r := recover(); r != nil {
+			h.LogError(fmt.Sprintf("主动对话协程发生panic: %v", r))
+		}
+	}()
+
+	config := h.proactiveConfig
+	if !config.Enabled || config.IdleSeconds <= 0 {
+		return
+	}
+	idleThreshold := time.Duration(config.IdleSeconds) * time.Second
+	h.LogInfo(fmt.Sprintf("主动对话已启用: 空闲 %v 后发起, 免打扰 %s-%s (%s)",
+		idleThreshold, config.QuietHoursStart, config.QuietHoursEnd, config.Timezone))
+
+	ticker := time.NewTicker(proactiveCheckInterval)
+	defer ticker.Stop()
+
+	triggered := 0
+	for {
+		select {
+		case <-h.stopChan:
+			return
+		case <-h.ctx.Done():
+			return
+		case <-ticker.C:
+			if config.MaxPerSession > 0 && triggered >= config.MaxPerSession {
+				return
+			}
+			// 回环测试、翻译和听写模式下不主动发起对话
+			if h.loopbackMode != "" || h.currentConversationMode() != conversationModeAssistant || h.idleDuration() < idleThreshold || config.inQuietHours(time.Now()) {
+				continue
+			}
+			if h.isNeedAuth() || (h.configService != nil && h.configService.GetMaintenanceStatus().Enabled) {
+				continue
+			}
+			// 轮次状态由文本消息协程维护，主动对话交给该协程执行
+			select {
+			case h.proactiveQueue <- struct{}{}:
+				triggered++
+			default:
+			}
+		}
+	}
+}
+
+// startProactiveTurn 以主动对话指令运行一轮LLM→TTS，指令本身不写入对话历史；在文本消息协程中调用
+func (h *ConnectionHandler) startProactiveTurn() error {
+	h.touchActivity()
+	h.talkRound++
+	h.roundStartTime = time.Now()
+	currentRound := h.talkRound
+	h.LogInfo(fmt.Sprintf("设备空闲，主动发起对话轮次: %d", currentRound))
+
+	if err := h.sendTTSMessage("start", "", 0); err != nil {
+		return fmt.Errorf("发送TTS开始状态失败: %v", err)
+	}
+
+	messages := append(h.dialogueManager.GetLLMDialogue(), providers.Message{
+		Role:    "system",
+		Content: h.proactiveConfig.Prompt,
+	})
+	return h.genResponseByLLM(context.Background(), messages, currentRound)
+}
@@ -0,0 +1,284 @@
+package core
+
+import (
+	"ai-server-go/src/core/providers"
+	"ai-server-go/src/core/utils"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+* 提示词采样：排查回复质量问题时需要看到实际发送给LLM的完整提示词和LLM的回复。
+* 按采样率抽取对话轮次，被抽中的轮次把组装后的消息列表和回复写入独立的调试文件
+* （日志目录下按天生成的 prompt_samples-YYYY-MM-DD.jsonl，保留天数与日志相同），不写入普通日志。
+* 默认关闭；采样率可按LLM provider类型单独设置。写入前总是对密钥、令牌做脱敏，
+* redact_pii 开启时同时脱敏手机号、邮箱、身份证号和银行卡号；图片等附件只记录类型，从不记录音频。
+* 配置来自系统配置 prompt_sampling 分类，在建立连接时读取。
+ */
+
+// promptSampleFilePrefix 采样文件名前缀
+const promptSampleFilePrefix = "prompt_samples-"
+
+// PromptSampleConfig 提示词采样配置
+type PromptSampleConfig struct {
+	Rate          float64            `json:"rate"`           // 默认采样率（0-1），0表示关闭
+	ProviderRates map[string]float64 `json:"provider_rates"` // 按LLM provider类型覆盖采样率
+	RedactPII     bool               `json:"redact_pii"`     // 是否脱敏手机号、邮箱等个人信息
+	MaxChars      int                `json:"max_chars"`      // 单条消息记录的最大字数，0表示不截断
+}
+
+// DefaultPromptSampleConfig 默认提示词采样配置，默认不采样
+func DefaultPromptSampleConfig() PromptSampleConfig {
+	return PromptSampleConfig{
+		RedactPII: true,
+		MaxChars:  4000,
+	}
+}
+
+// applyMap 使用配置map覆盖提示词采样配置
+func (c *PromptSampleConfig) applyMap(config map[string]interface{}) {
+	if config == nil {
+		return
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, c)
+}
+
+// rateFor 指定provider类型的采样率
+func (c PromptSampleConfig) rateFor(providerType string) float64 {
+	if rate, ok := c.ProviderRates[providerType]; ok {
+		return rate
+	}
+	return c.Rate
+}
+
+// loadPromptSampleConfig 加载系统配置 prompt_sampling 分类中的提示词采样配置
+func (h *ConnectionHandler) loadPromptSampleConfig(layered *layeredConfigSource) PromptSampleConfig {
+	config := DefaultPromptSampleConfig()
+	layered.applySystem("prompt_sampling", config.applyMap)
+	return config
+}
+
+// promptSampleMessage 采样记录中的一条消息
+type promptSampleMessage struct {
+	Role        string   `json:"role"`
+	Content     string   `json:"content"`
+	ToolCalls   []string `json:"tool_calls,omitempty"`   // 工具调用，格式为 name(arguments)
+	ToolCallID  string   `json:"tool_call_id,omitempty"` // 工具结果对应的调用ID
+	Attachments []string `json:"attachments,omitempty"`  // 附件只记录类型
+}
+
+// promptSample 一次LLM请求的采样记录
+type promptSample struct {
+	Time         string                `json:"time"`
+	SessionID    string                `json:"session_id"`
+	DeviceID     string                `json:"device_id"`
+	TraceID      string                `json:"trace_id"`
+	Round        int                   `json:"round"`
+	ProviderType string                `json:"provider_type"`
+	Model        string                `json:"model,omitempty"`
+	Messages     []promptSampleMessage `json:"messages"`
+	Response     string                `json:"response"`
+	ToolCall     string                `json:"tool_call,omitempty"`
+}
+
+// promptSampler 一次LLM请求的采样状态，本轮未被抽中时为nil
+type promptSampler struct {
+	sample   promptSample
+	redact   func(string) string
+	maxChars int
+}
+
+// llmProviderInfo 当前轮次LLM的provider类型和模型名称
+func (h *ConnectionHandler) llmProviderInfo() (string, string) {
+	if getter, ok := h.turnLLM().(llmConfigGetter); ok && getter.Config() != nil {
+		config := getter.Config()
+		return config.Type, config.ModelName
+	}
+	return "", ""
+}
+
+// samplePrompt 按采样率决定本轮是否采样，同一轮中工具调用后的再次请求沿用同一决定
+func (h *ConnectionHandler) samplePrompt(messages []providers.Message, round int) *promptSampler {
+	config := h.promptSampleConfig
+	providerType, model := h.llmProviderInfo()
+	rate := config.rateFor(providerType)
+	if rate <= 0 {
+		return nil
+	}
+
+	h.promptSampleMu.Lock()
+	if h.promptSampleRound != round {
+		h.promptSampleRound = round
+		h.promptSampled = rand.Float64() < rate
+	}
+	sampled := h.promptSampled
+	h.promptSampleMu.Unlock()
+	if !sampled {
+		return nil
+	}
+
+	sampler := &promptSampler{
+		redact:   promptRedactor(config.RedactPII),
+		maxChars: config.MaxChars,
+	}
+	sampler.sample = promptSample{
+		SessionID:    h.sessionID,
+		DeviceID:     h.deviceID,
+		TraceID:      h.roundTraceID(round),
+		Round:        round,
+		ProviderType: providerType,
+		Model:        model,
+	}
+	for _, msg := range messages {
+		entry := promptSampleMessage{
+			Role:       msg.Role,
+			Content:    sampler.text(msg.Content),
+			ToolCallID: msg.ToolCallID,
+		}
+		for _, call := range msg.ToolCalls {
+			entry.ToolCalls = append(entry.ToolCalls, sampler.text(fmt.Sprintf("%s(%s)", call.Function.Name, call.Function.Arguments)))
+		}
+		for _, attachment := range msg.Attachments {
+			entry.Attachments = append(entry.Attachments, attachment.Type)
+		}
+		sampler.sample.Messages = append(sampler.sample.Messages, entry)
+	}
+	return sampler
+}
+
+// text 脱敏并截断一段采样文本
+func (s *promptSampler) text(text string) string {
+	text = s.redact(text)
+	if s.maxChars > 0 {
+		if runes := []rune(text); len(runes) > s.maxChars {
+			return string(runes[:s.maxChars]) + "...(已截断)"
+		}
+	}
+	return text
+}
+
+// finish 记录LLM回复并写入采样文件
+func (s *promptSampler) finish(h *ConnectionHandler, response, toolName, toolArguments string) {
+	if s == nil {
+		return
+	}
+	s.sample.Time = time.Now().Format(time.RFC3339)
+	s.sample.Response = s.text(response)
+	if toolName != "" {
+		s.sample.ToolCall = s.text(fmt.Sprintf("%s(%s)", toolName, toolArguments))
+	}
+	if h.config == nil {
+		return
+	}
+	sample := s.sample
+	dir := h.config.Log.LogDir
+	go func() {
+		if err := promptSamples.write(dir, sample); err != nil {
+			h.logger.Warn("写入提示词采样失败: %v", err)
+		}
+	}()
+}
+
+var (
+	// promptSecretPatterns 总是脱敏的密钥和令牌
+	promptSecretPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/=-]+`),
+		regexp.MustCompile(`\b(?:sk|ak|pk)-[A-Za-z0-9_-]{16,}`),
+		regexp.MustCompile(`(?i)\b(api[_-]?key|access[_-]?key|secret|token|password)(\s*["']?\s*[:=]\s*["']?)[^\s"',}]+`),
+	}
+	// promptPIIPatterns redact_pii 开启时脱敏的个人信息，身份证号需在银行卡号之前匹配
+	promptPIIPatterns = []struct {
+		pattern     *regexp.Regexp
+		replacement string
+	}{
+		{regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), "[邮箱]"},
+		{regexp.MustCompile(`\b\d{17}[\dXx]\b`), "[身份证号]"},
+		{regexp.MustCompile(`\b\d{12,19}\b`), "[卡号]"},
+		{regexp.MustCompile(`(?:\+?86[\s-]?)?\b1[3-9]\d{9}\b`), "[手机号]"},
+	}
+)
+
+// promptRedactor 返回采样文本的脱敏函数
+func promptRedactor(redactPII bool) func(string) string {
+	return func(text string) string {
+		for _, pattern := range promptSecretPatterns {
+			text = pattern.ReplaceAllStringFunc(text, func(match string) string {
+				if sub := pattern.FindStringSubmatch(match); len(sub) == 3 {
+					return sub[1] + sub[2] + "[已脱敏]"
+				}
+				return "[已脱敏]"
+			})
+		}
+		if redactPII {
+			for _, pii := range promptPIIPatterns {
+				text = pii.pattern.ReplaceAllString(text, pii.replacement)
+			}
+		}
+		return text
+	}
+}
+
+// promptSampleSink 采样文件，所有连接共用，按天切换文件并清理过期文件
+type promptSampleSink struct {
+	mu   sync.Mutex
+	file *os.File
+	path string
+}
+
+var promptSamples = &promptSampleSink{}
+
+// write 追加一条采样记录
+func (s *promptSampleSink) write(dir string, sample promptSample) error {
+	data, err := json.Marshal(sample)
+	if err != nil {
+		return fmt.Errorf("序列化采样记录失败: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := filepath.Join(dir, promptSampleFilePrefix+time.Now().Format("2006-01-02")+".jsonl")
+	if s.file == nil || s.path != path {
+		if s.file != nil {
+			s.file.Close()
+			s.file = nil
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("创建采样目录失败: %v", err)
+		}
+		// 采样内容是对话原文，只允许服务进程读取
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return fmt.Errorf("打开采样文件失败: %v", err)
+		}
+		s.file, s.path = file, path
+		removeExpiredPromptSamples(dir)
+	}
+	_, err = s.file.Write(append(data, '\n'))
+	return err
+}
+
+// removeExpiredPromptSamples 删除超过日志保留天数的采样文件
+func removeExpiredPromptSamples(dir string) {
+	matches, err := filepath.Glob(filepath.Join(dir, promptSampleFilePrefix+"*.jsonl"))
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().AddDate(0, 0, -utils.LogRetentionDays).Format("2006-01-02")
+	for _, path := range matches {
+		date := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), promptSampleFilePrefix), ".jsonl")
+		if date < cutoff {
+			os.Remove(path)
+		}
+	}
+}
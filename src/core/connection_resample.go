@@ -0,0 +1,60 @@
+package core
+
+import (
+	"ai-server-go/src/core/providers"
+	"ai-server-go/src/core/utils"
+	"fmt"
+)
+
+/*
+* 识别前的重采样：设备在hello中声明上行采样率（如8k、24k、48k），ASR提供者声明所需采样率（如豆包16k），
+* 二者不一致时在送入ASR之前重采样，一致时直接透传。重采样质量由系统配置 audio.resample_quality 设置（fast/medium/high）。
+* 只作用于送往ASR的音频；静音检测、打断检测、用量统计和回环测试仍使用设备原始采样率。
+ */
+
+// defaultASRSampleRate ASR提供者未声明采样率时使用的采样率
+const defaultASRSampleRate = 16000
+
+// asrInputSampleRate 当前ASR提供者所需的输入采样率
+func (h *ConnectionHandler) asrInputSampleRate() int {
+	if reporter, ok := h.asrProvider().(providers.InputSampleRateReporter); ok {
+		if rate := reporter.InputSampleRate(); rate > 0 {
+			return rate
+		}
+	}
+	return defaultASRSampleRate
+}
+
+// setupASRResampler 按设备声明的采样率和ASR所需采样率创建重采样器，采样率一致时不重采样
+func (h *ConnectionHandler) setupASRResampler() {
+	if h.asrProvider() == nil {
+		return
+	}
+	fromRate := h.clientAudioSampleRate
+	if fromRate <= 0 {
+		fromRate = defaultASRSampleRate
+	}
+	toRate := h.asrInputSampleRate()
+	if fromRate == toRate {
+		h.asrResampler.Store(nil)
+		return
+	}
+
+	quality := utils.ResampleQualityMedium
+	if h.configService != nil {
+		if value, err := h.configService.GetSystemConfigValue("audio", "resample_quality"); err == nil && value != "" {
+			quality = value
+		}
+	}
+	h.asrResampler.Store(utils.NewResampler(fromRate, toRate, quality))
+	h.LogInfo(fmt.Sprintf("上行音频重采样: %dHz -> %dHz (%s)", fromRate, toRate, quality))
+}
+
+// resampleForASR 将设备PCM转换为ASR所需的采样率
+func (h *ConnectionHandler) resampleForASR(pcm []byte) []byte {
+	resampler := h.asrResampler.Load()
+	if resampler == nil {
+		return pcm
+	}
+	return resampler.Process(pcm)
+}
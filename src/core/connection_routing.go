@@ -0,0 +1,227 @@
+package core
+
+import (
+	"ai-server-go/src/core/providers"
+	"ai-server-go/src/database"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+/*
+* 能力路由：设备可以同时启用同一类别的多个能力配置（例如一个快速TTS和一个高音质TTS），
+* 按路由规则在每轮对话中选择使用哪一个：
+*   - LLM 在每轮开始时按用户输入的长度选择；
+*   - TTS 按本轮每段待合成文本的长度选择，first_segment 规则只匹配本轮首句（对首字节延迟最敏感）。
+* 规则按顺序匹配第一条，未命中或未配置规则时使用按优先级选出的默认provider，行为与不启用路由时一致。
+* 规则来自系统配置 capability_routing 分类，设备 capability_routing 能力配置可以整体替换；
+* 会话级provider覆盖优先于路由规则。路由到的provider在首次命中时创建，之后在本连接内复用。
+ */
+
+// routableCapabilities 支持路由的能力及对应的provider类别
+var routableCapabilities = map[string]string{
+	"llm": "LLM",
+	"tts": "TTS",
+}
+
+// CapabilityRoute 一条能力路由规则
+type CapabilityRoute struct {
+	Name           string `json:"name"`            // 规则名称，用于日志
+	Capability     string `json:"capability"`      // 能力类别：llm、tts
+	CapabilityType string `json:"capability_type"` // 命中时使用的能力配置类型，需为设备已启用的能力
+	MinChars       int    `json:"min_chars"`       // 文本长度下限（含），0表示不限制
+	MaxChars       int    `json:"max_chars"`       // 文本长度上限（含），0表示不限制
+	FirstSegment   *bool  `json:"first_segment"`   // 仅TTS：true只匹配本轮首句，false只匹配后续句子，为空时不限制
+}
+
+// CapabilityRoutingConfig 能力路由配置
+type CapabilityRoutingConfig struct {
+	Enabled bool              `json:"enabled"` // 是否启用能力路由
+	Rules   []CapabilityRoute `json:"rules"`   // 路由规则，按顺序匹配第一条
+}
+
+// DefaultCapabilityRoutingConfig 默认能力路由配置
+func DefaultCapabilityRoutingConfig() CapabilityRoutingConfig {
+	return CapabilityRoutingConfig{
+		Enabled: false,
+	}
+}
+
+// applyMap 使用配置map覆盖能力路由配置
+func (c *CapabilityRoutingConfig) applyMap(config map[string]interface{}) {
+	if config == nil {
+		return
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, c)
+}
+
+// match 文本是否满足规则的长度和首句条件
+func (r CapabilityRoute) match(text string, firstSegment bool) bool {
+	length := utf8.RuneCountInString(strings.TrimSpace(text))
+	if r.MinChars > 0 && length < r.MinChars {
+		return false
+	}
+	if r.MaxChars > 0 && length > r.MaxChars {
+		return false
+	}
+	if r.FirstSegment != nil && *r.FirstSegment != firstSegment {
+		return false
+	}
+	return true
+}
+
+// capabilityRouter 连接级能力路由状态
+type capabilityRouter struct {
+	rules      []CapabilityRoute
+	candidates map[string]database.CapabilityConfig // 能力/类型 -> 设备启用的能力配置
+
+	mu        sync.Mutex
+	instances map[string]interface{} // 已创建的provider，能力/类型 -> 实例
+	turnLLM   providers.LLMProvider  // 本轮路由选中的LLM，为空时使用默认LLM
+}
+
+// loadCapabilityRoutingConfig 加载能力路由配置：系统配置 capability_routing 分类 < 设备 capability_routing 能力配置
+func (h *ConnectionHandler) loadCapabilityRoutingConfig(layered *layeredConfigSource) CapabilityRoutingConfig {
+	config := DefaultCapabilityRoutingConfig()
+	layered.load("capability_routing", "capability_routing", "", config.applyMap)
+	return config
+}
+
+// initCapabilityRouting 收集设备启用的可路由能力配置并校验规则，无有效规则时不启用路由
+func (h *ConnectionHandler) initCapabilityRouting() {
+	config := h.capabilityRoutingConfig
+	if !config.Enabled || len(config.Rules) == 0 || h.configService == nil || h.deviceID == "" {
+		return
+	}
+	deviceConfig, err := h.configService.GetDeviceCapabilityConfigWithFallback(parseUint(h.deviceID), h.userID)
+	if err != nil || deviceConfig == nil {
+		h.LogError(fmt.Sprintf("能力路由: 获取设备能力配置失败: %v", err))
+		return
+	}
+
+	candidates := make(map[string]database.CapabilityConfig)
+	for _, capability := range deviceConfig.Capabilities {
+		if _, ok := routableCapabilities[capability.CapabilityName]; !ok || !capability.IsEnabled {
+			continue
+		}
+		key := capability.CapabilityName + "/" + capability.CapabilityType
+		if _, exists := candidates[key]; !exists {
+			candidates[key] = capability
+		}
+	}
+
+	rules := make([]CapabilityRoute, 0, len(config.Rules))
+	for _, rule := range config.Rules {
+		rule.Capability = strings.ToLower(rule.Capability)
+		if _, ok := routableCapabilities[rule.Capability]; !ok {
+			h.LogError(fmt.Sprintf("能力路由规则 %s 的能力 %q 不支持路由，已忽略", rule.Name, rule.Capability))
+			continue
+		}
+		if _, ok := candidates[rule.Capability+"/"+rule.CapabilityType]; !ok {
+			h.LogError(fmt.Sprintf("能力路由规则 %s 指定的 %s/%s 未在设备上启用，已忽略", rule.Name, rule.Capability, rule.CapabilityType))
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	if len(rules) == 0 {
+		return
+	}
+
+	h.capabilityRouter = &capabilityRouter{
+		rules:      rules,
+		candidates: candidates,
+		instances:  make(map[string]interface{}),
+	}
+	h.LogInfo(fmt.Sprintf("能力路由已启用，共 %d 条规则", len(rules)))
+}
+
+// routeProvider 按规则为文本选择provider，未命中、被会话覆盖或创建失败时返回nil
+func (h *ConnectionHandler) routeProvider(capability, text string, firstSegment bool) interface{} {
+	router := h.capabilityRouter
+	if router == nil {
+		return nil
+	}
+	if _, overridden := h.ProviderOverrides()[routableCapabilities[capability]]; overridden {
+		return nil
+	}
+	for _, rule := range router.rules {
+		if rule.Capability != capability || !rule.match(text, firstSegment) {
+			continue
+		}
+		instance, err := h.routedInstance(rule.Capability + "/" + rule.CapabilityType)
+		if err != nil {
+			h.LogError(fmt.Sprintf("能力路由规则 %s 创建provider失败，使用默认provider: %v", rule.Name, err))
+			return nil
+		}
+		h.logger.Debug("能力路由: %s 命中规则 %s -> %s", capability, rule.Name, rule.CapabilityType)
+		return instance
+	}
+	return nil
+}
+
+// routedInstance 获取路由目标的provider实例，首次使用时创建
+func (h *ConnectionHandler) routedInstance(key string) (interface{}, error) {
+	router := h.capabilityRouter
+	router.mu.Lock()
+	defer router.mu.Unlock()
+	if instance, ok := router.instances[key]; ok {
+		return instance, nil
+	}
+
+	capability := router.candidates[key]
+	var instance interface{}
+	var err error
+	switch capability.CapabilityName {
+	case "llm":
+		instance, err = newLLMProvider(capability)
+	case "tts":
+		instance, err = h.newTTSProvider(capability)
+	default:
+		err = fmt.Errorf("不支持路由的能力: %s", key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	router.instances[key] = instance
+	h.LogInfo(fmt.Sprintf("能力路由: 创建provider %s", key))
+	return instance, nil
+}
+
+// routeTurnLLM 每轮开始时按用户输入选择本轮使用的LLM
+func (h *ConnectionHandler) routeTurnLLM(text string) {
+	router := h.capabilityRouter
+	if router == nil {
+		return
+	}
+	provider, _ := h.routeProvider("llm", text, true).(providers.LLMProvider)
+	router.mu.Lock()
+	router.turnLLM = provider
+	router.mu.Unlock()
+}
+
+// turnLLM 本轮回复使用的LLM：路由选中的LLM，没有时为默认LLM
+func (h *ConnectionHandler) turnLLM() providers.LLMProvider {
+	if router := h.capabilityRouter; router != nil {
+		router.mu.Lock()
+		provider := router.turnLLM
+		router.mu.Unlock()
+		if provider != nil {
+			return provider
+		}
+	}
+	return h.llmProvider()
+}
+
+// ttsFor 为待合成文本选择TTS：路由选中的TTS，没有时为默认TTS
+func (h *ConnectionHandler) ttsFor(text string, textIndex int) providers.TTSProvider {
+	if provider, ok := h.routeProvider("tts", text, textIndex == 1).(providers.TTSProvider); ok {
+		return provider
+	}
+	return h.ttsProvider()
+}
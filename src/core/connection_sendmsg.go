@@ -31,6 +31,23 @@ func (h *ConnectionHandler) sendHelloMessage() error {
 		"channels":       h.serverAudioChannels,
 		"frame_duration": h.serverAudioFrameDuration,
 	}
+	// 需要挑战-应答认证时下发一次性nonce
+	if challenge := h.issueAuthChallenge(); challenge != nil {
+		hello["auth"] = challenge
+	}
+	if ack := h.audioAckHello(); ack != nil {
+		hello["ack"] = ack
+	}
+	if h.textStreamEnabled {
+		hello["text_stream"] = map[string]interface{}{"min_chars": h.textStreamConfig.MinChars}
+	}
+	if h.loopbackMode != "" {
+		hello["loopback"] = map[string]interface{}{"mode": h.loopbackMode}
+	}
+	hello["mode"] = map[string]interface{}{
+		"current":   h.currentConversationMode(),
+		"available": h.conversationModeConfig.Available,
+	}
 	data, err := json.Marshal(hello)
 	if err != nil {
 		return fmt.Errorf("序列化欢迎消息失败: %v", err)
@@ -39,6 +56,11 @@ func (h *ConnectionHandler) sendHelloMessage() error {
 	return h.conn.WriteMessage(1, data)
 }
 
+// sendMaintenanceMessage 发送维护模式提示消息
+func (h *ConnectionHandler) sendMaintenanceMessage(message string) error {
+	return writeMaintenanceNotice(h.conn, h.sessionID, message)
+}
+
 func (h *ConnectionHandler) sendTTSMessage(state string, text string, textIndex int) error {
 	// 发送TTS状态结束通知
 	stateMsg := map[string]interface{}{
@@ -49,6 +71,14 @@ func (h *ConnectionHandler) sendTTSMessage(state string, text string, textIndex
 		"index":       textIndex,
 		"audio_codec": "opus", // 标识使用Opus编码
 	}
+	if state == "start" || state == "sentence_start" {
+		if hints := h.playbackHints(); hints != nil {
+			stateMsg["playback"] = hints
+		}
+	}
+	if state == "sentence_end" && h.audioAck != nil {
+		stateMsg["last_seq"] = h.audioAck.lastSeq()
+	}
 	data, err := json.Marshal(stateMsg)
 	if err != nil {
 		return fmt.Errorf("序列化%s状态失败: %v", state, err)
@@ -97,9 +127,10 @@ func (h *ConnectionHandler) sendAudioMessage(filepath string, text string, textI
 		// 音频发送完成后，根据配置决定是否删除文件
 		h.deleteAudioFileIfNeeded(filepath, "音频发送完成")
 
-		h.LogInfo(fmt.Sprintf("TTS音频发送任务结束(%t): %s, 索引: %d/%d", bFinishSuccess, text, textIndex, h.tts_last_text_index))
-		h.providers.asr.ResetStartListenTime()
-		if textIndex == h.tts_last_text_index {
+		h.LogInfo(fmt.Sprintf("TTS音频发送任务结束(%t): %s, 索引: %d/%d", bFinishSuccess, text, textIndex, h.lastTextIndex()))
+		h.asrProvider().ResetStartListenTime()
+		// 过期轮次（被打断或超时）的最后一句不结束当前轮次的播报
+		if textIndex == h.lastTextIndex() && round == h.talkRound {
 			h.sendTTSMessage("stop", "", textIndex)
 			if h.closeAfterChat {
 				h.Close()
@@ -141,13 +172,16 @@ func (h *ConnectionHandler) sendAudioMessage(filepath string, text string, textI
 			return
 		}
 	} else if h.serverAudioFormat == "opus" {
-		audioData, duration, err = utils.AudioToOpusData(filepath)
+		audioData, duration, err = utils.AudioToOpusDataWithOptions(filepath, h.opusOptions)
 		if err != nil {
 			h.LogError(fmt.Sprintf("音频转Opus失败: %v", err))
 			return
 		}
 	}
 
+	// 本轮首句前播放提示音
+	audioData = h.prependEarcon(audioData, textIndex, round)
+
 	// 发送TTS状态开始通知
 	if err := h.sendTTSMessage("sentence_start", text, textIndex); err != nil {
 		h.LogError(fmt.Sprintf("发送TTS开始状态失败: %v", err))
@@ -159,7 +193,7 @@ func (h *ConnectionHandler) sendAudioMessage(filepath string, text string, textI
 		spentTime := now.Sub(h.roundStartTime)
 		h.logger.Debug("回复首句耗时 %s 第一句话【%s】, round: %d", spentTime, text, round)
 	}
-	h.logger.Debug("TTS发送(%s): \"%s\" (索引:%d/%d，时长:%f，帧数:%d)", h.serverAudioFormat, text, textIndex, h.tts_last_text_index, duration, len(audioData))
+	h.logger.Debug("TTS发送(%s): \"%s\" (索引:%d/%d，时长:%f，帧数:%d)", h.serverAudioFormat, text, textIndex, h.lastTextIndex(), duration, len(audioData))
 
 	// 分时发送音频数据
 	if err := h.sendAudioFrames(audioData, text, round); err != nil {
@@ -200,9 +234,10 @@ func (h *ConnectionHandler) sendAudioFrames(audioData [][]byte, text string, rou
 			return nil
 		}
 
-		if err := h.conn.WriteMessage(2, audioData[i]); err != nil {
+		if err := h.writeAudioFrame(audioData[i], round); err != nil {
 			return fmt.Errorf("发送预缓冲音频帧失败: %v", err)
 		}
+		h.bargeInDetector.MarkPlayback()
 		playPosition += h.serverAudioFrameDuration
 	}
 
@@ -249,12 +284,16 @@ func (h *ConnectionHandler) sendAudioFrames(audioData [][]byte, text string, rou
 		}
 
 		// 发送音频帧
-		if err := h.conn.WriteMessage(2, chunk); err != nil {
+		if err := h.writeAudioFrame(chunk, round); err != nil {
 			return fmt.Errorf("发送音频帧失败: %v", err)
 		}
+		h.bargeInDetector.MarkPlayback()
 
 		playPosition += h.serverAudioFrameDuration
 	}
+	if err := h.flushAudioAcks(round); err != nil {
+		return err
+	}
 	time.Sleep(preBufferTime) // 确保预缓冲时间已过
 	spentTime := time.Since(startTime).Milliseconds()
 	h.LogInfo(fmt.Sprintf("音频帧发送完成: 总帧数=%d, 总时长=%dms, 总耗时:%dms 文本=%s", len(audioData), playPosition, spentTime, text))
@@ -0,0 +1,171 @@
+package core
+
+import (
+	"ai-server-go/src/core/chat"
+	"ai-server-go/src/core/utils"
+	"ai-server-go/src/database"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+/*
+* 会话恢复：设备断线重连时沿用原会话，并从持久化的ChatMessage恢复对话上下文。
+* 设备可通过 Session-Id 头或 session_id 参数指定要恢复的会话；未指定时恢复该设备在
+* window_seconds 内仍有消息往来的活跃会话。消息较多的会话只恢复摘要和最近几轮原始消息。
+ */
+
+// SessionResumeConfig 会话恢复配置（系统配置 session_resume 分类）
+type SessionResumeConfig struct {
+	Enabled        bool // 是否启用会话恢复
+	WindowSeconds  int  // 未指定会话时，自动恢复多久内有消息的会话（秒），0表示只恢复显式指定的会话
+	MaxMessages    int  // 直接恢复原始消息的最大条数，超过时改为恢复摘要
+	RecentMessages int  // 恢复摘要时附带的最近原始消息条数
+}
+
+// loadSessionResumeConfig 加载会话恢复配置
+func loadSessionResumeConfig(configService *database.ConfigService) SessionResumeConfig {
+	config := SessionResumeConfig{
+		Enabled:        true,
+		WindowSeconds:  300,
+		MaxMessages:    40,
+		RecentMessages: 6,
+	}
+	if configService == nil {
+		return config
+	}
+	if value, err := configService.GetSystemConfigBool("session_resume", "enabled"); err == nil {
+		config.Enabled = value
+	}
+	if value, err := configService.GetSystemConfigInt("session_resume", "window_seconds"); err == nil && value >= 0 {
+		config.WindowSeconds = value
+	}
+	if value, err := configService.GetSystemConfigInt("session_resume", "max_messages"); err == nil && value > 0 {
+		config.MaxMessages = value
+	}
+	if value, err := configService.GetSystemConfigInt("session_resume", "recent_messages"); err == nil && value >= 0 {
+		config.RecentMessages = value
+	}
+	return config
+}
+
+// extractSessionID 从请求中提取设备要恢复的会话ID
+func extractSessionID(req *http.Request) string {
+	if req == nil {
+		return ""
+	}
+	if sessionID := req.Header.Get("Session-Id"); sessionID != "" {
+		return sessionID
+	}
+	return req.URL.Query().Get("session_id")
+}
+
+// resolveSession 确定连接使用的会话：可恢复时返回原会话，否则生成新的会话ID
+func resolveSession(req *http.Request, deviceID uint, config SessionResumeConfig, memoryService *database.ChatMemoryService, logger *utils.Logger) (string, *database.ChatSession) {
+	newSessionID := uuid.New().String()
+	if !config.Enabled || memoryService == nil || deviceID == 0 {
+		return newSessionID, nil
+	}
+
+	if requested := extractSessionID(req); requested != "" {
+		session, err := memoryService.GetSession(requested)
+		if err != nil || session.DeviceID != deviceID || session.Status != "active" {
+			logger.Info("设备 %d 请求恢复的会话 %s 不存在或不可用，创建新会话", deviceID, requested)
+			return newSessionID, nil
+		}
+		return session.SessionID, session
+	}
+
+	if config.WindowSeconds <= 0 {
+		return newSessionID, nil
+	}
+	session, err := memoryService.FindResumableSession(deviceID, time.Duration(config.WindowSeconds)*time.Second)
+	if err != nil {
+		logger.Warn("查找可恢复会话失败: %v", err)
+		return newSessionID, nil
+	}
+	if session == nil {
+		return newSessionID, nil
+	}
+	return session.SessionID, session
+}
+
+// restoreSessionHistory 从持久化消息恢复对话上下文，长会话恢复摘要+最近消息
+func (h *ConnectionHandler) restoreSessionHistory(session *database.ChatSession) {
+	if session == nil || h.memoryService == nil {
+		return
+	}
+	config := loadSessionResumeConfig(h.configService)
+
+	limit := config.MaxMessages
+	summary := ""
+	if session.MessageCount > config.MaxMessages {
+		if summary = h.memoryService.GetSessionSummary(session); summary != "" {
+			limit = config.RecentMessages
+		}
+	}
+
+	var history []chat.Message
+	if summary != "" {
+		history = append(history, chat.Message{
+			Role:    "system",
+			Content: "以下是本次会话之前内容的摘要：" + summary,
+		})
+	}
+	if limit > 0 {
+		messages, err := h.memoryService.GetRecentSessionMessages(session.SessionID, limit)
+		if err != nil {
+			h.LogError(fmt.Sprintf("加载会话历史失败: %v", err))
+			return
+		}
+		for _, msg := range database.ToDialogueMessages(h.replaceBlockedReplies(messages)) {
+			if msg.Role == "user" || msg.Role == "assistant" {
+				history = append(history, h.resolveStoredImages(msg))
+			}
+		}
+	}
+
+	restored := h.dialogueManager.Restore(history)
+	h.LogInfo(fmt.Sprintf("恢复会话 %s：共 %d 条消息，恢复 %d 条（摘要: %t）",
+		session.SessionID, session.MessageCount, restored, summary != ""))
+}
+
+// replaceBlockedReplies 将被内容审核拦截的助手回复替换为提示语（未配置提示语时跳过），拦截的原文不恢复到对话上下文
+func (h *ConnectionHandler) replaceBlockedReplies(messages []database.ChatMessage) []database.ChatMessage {
+	result := make([]database.ChatMessage, 0, len(messages))
+	for _, msg := range messages {
+		if msg.Role == "assistant" && msg.ModerationBlocked {
+			if h.moderationConfig.BlockedMessage == "" {
+				continue
+			}
+			msg.Content = h.moderationConfig.BlockedMessage
+		}
+		result = append(result, msg)
+	}
+	return result
+}
+
+// recordDialogueMessage 持久化用户/助手的文本消息，供重连后恢复上下文
+func (h *ConnectionHandler) recordDialogueMessage(msg chat.Message) {
+	if h.memoryService == nil || h.deviceID == "" {
+		return
+	}
+	// 工具调用和结果不落库，恢复时只还原文本对话
+	if (msg.Role != "user" && msg.Role != "assistant") || len(msg.ToolCalls) > 0 || msg.Content == "" {
+		return
+	}
+	if msg.Role == "assistant" {
+		h.recordAssistantMessage(h.replyModeration, msg.Content)
+		return
+	}
+
+	messageType := "text"
+	if len(msg.Attachments) > 0 {
+		messageType = "image"
+	}
+
+	// 本轮结算时与用量统计一起保存
+	h.addTurnMessage(msg, messageType)
+}
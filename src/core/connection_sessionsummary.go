@@ -0,0 +1,160 @@
+package core
+
+import (
+	"ai-server-go/src/database"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+* 会话摘要：连接关闭时汇总本次会话的轮次数、ASR/LLM/TTS 耗时、使用的provider、错误数和估算费用，
+* 输出一行日志并写入 session_summaries 表，会话分析不必再从原始统计中重新聚合。
+* ASR耗时为说话结束（或手动停止收音）到识别结果的时间，LLM耗时为请求到生成第一句的时间，TTS耗时为每句合成的时间。
+* 断线重连恢复的会话写入同一条摘要，各项数值累加。
+ */
+
+// sessionMetrics 连接级的会话指标累计
+type sessionMetrics struct {
+	mu        sync.Mutex
+	start     time.Time
+	latency   map[string]time.Duration // 各阶段累计耗时
+	counts    map[string]int           // 各阶段计入耗时的次数
+	errors    map[string]int           // 各阶段的错误数
+	providers map[string][]string      // 能力 -> 使用过的provider
+}
+
+// newSessionMetrics 创建会话指标累计
+func newSessionMetrics() *sessionMetrics {
+	return &sessionMetrics{
+		start:     time.Now(),
+		latency:   make(map[string]time.Duration),
+		counts:    make(map[string]int),
+		errors:    make(map[string]int),
+		providers: make(map[string][]string),
+	}
+}
+
+// recordStageLatency 累计一次阶段耗时
+func (h *ConnectionHandler) recordStageLatency(stage string, d time.Duration) {
+	m := h.sessionMetrics
+	if m == nil || d < 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.latency[stage] += d
+	m.counts[stage]++
+}
+
+// recordStageError 累计一次阶段错误（失败或超时）
+func (h *ConnectionHandler) recordStageError(stage string) {
+	m := h.sessionMetrics
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errors[stage]++
+}
+
+// recordProviderUsed 记录使用过的provider，重复的忽略
+func (h *ConnectionHandler) recordProviderUsed(capability, name string) {
+	m := h.sessionMetrics
+	if m == nil || name == "" {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !slices.Contains(m.providers[capability], name) {
+		m.providers[capability] = append(m.providers[capability], name)
+	}
+}
+
+// buildSessionSummary 汇总本连接的会话指标
+func (h *ConnectionHandler) buildSessionSummary() *database.SessionSummary {
+	// 生效的provider和会话级覆盖的provider都计为使用过
+	if h.usage != nil {
+		for capability, provider := range h.usage.prices {
+			h.recordProviderUsed(capability, provider.Name)
+		}
+	}
+	h.providerOverrides.mu.Lock()
+	for category, name := range h.providerOverrides.names {
+		h.recordProviderUsed(strings.ToLower(category), name)
+	}
+	h.providerOverrides.mu.Unlock()
+
+	m := h.sessionMetrics
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	summary := &database.SessionSummary{
+		SessionID:    h.sessionID,
+		DeviceID:     parseUint(h.deviceID),
+		UserID:       h.userID,
+		StartTime:    m.start,
+		EndTime:      now,
+		DurationMs:   now.Sub(m.start).Milliseconds(),
+		Connections:  1,
+		Turns:        h.talkRound,
+		ASRCount:     m.counts[pipelineStageASR],
+		ASRLatencyMs: m.latency[pipelineStageASR].Milliseconds(),
+		LLMCount:     m.counts[pipelineStageLLM],
+		LLMLatencyMs: m.latency[pipelineStageLLM].Milliseconds(),
+		TTSCount:     m.counts[pipelineStageTTS],
+		TTSLatencyMs: m.latency[pipelineStageTTS].Milliseconds(),
+	}
+	errors := make(map[string]int, len(m.errors))
+	for stage, count := range m.errors {
+		errors[stage] = count
+		summary.ErrorCount += count
+	}
+	providers := make(map[string][]string, len(m.providers))
+	for capability, names := range m.providers {
+		providers[capability] = append([]string(nil), names...)
+	}
+	summary.SetErrors(errors)
+	summary.SetProviders(providers)
+	if h.usage != nil {
+		h.usage.mu.Lock()
+		summary.EstimatedCost = h.usage.total
+		h.usage.mu.Unlock()
+	}
+	return summary
+}
+
+// emitSessionSummary 连接关闭时输出会话摘要并保存，需在结算最后一轮用量之后调用
+func (h *ConnectionHandler) emitSessionSummary() {
+	if h.sessionMetrics == nil || h.sessionID == "" {
+		return
+	}
+	summary := h.buildSessionSummary()
+
+	used := summary.ProvidersMap()
+	capabilities := make([]string, 0, len(used))
+	for capability := range used {
+		capabilities = append(capabilities, capability)
+	}
+	sort.Strings(capabilities)
+	providers := make([]string, 0, len(capabilities))
+	for _, capability := range capabilities {
+		providers = append(providers, fmt.Sprintf("%s=%s", capability, strings.Join(used[capability], "|")))
+	}
+	h.LogInfo(fmt.Sprintf("会话结束: 时长 %s, 轮次 %d, ASR %d次/%dms, LLM %d次/%dms, TTS %d次/%dms, 错误 %d, provider [%s], 估算费用 %s",
+		time.Duration(summary.DurationMs)*time.Millisecond, summary.Turns,
+		summary.ASRCount, summary.ASRLatencyMs, summary.LLMCount, summary.LLMLatencyMs, summary.TTSCount, summary.TTSLatencyMs,
+		summary.ErrorCount, strings.Join(providers, " "), database.FormatCost(summary.EstimatedCost)))
+
+	if h.deviceService == nil || summary.DeviceID == 0 {
+		return
+	}
+	go func() {
+		if err := h.deviceService.SaveSessionSummary(summary); err != nil {
+			h.LogError(fmt.Sprintf("保存会话摘要失败: %v", err))
+		}
+	}()
+}
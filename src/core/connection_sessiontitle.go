@@ -0,0 +1,170 @@
+package core
+
+import (
+	"ai-server-go/src/core/types"
+	"ai-server-go/src/database"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/*
+* 会话自动命名：会话创建时只有"设备 xx 的对话"这样的默认标题。对话满 after_turns 轮后，
+* 在后台调用LLM根据对话内容生成简短标题并更新会话；LLM不可用、超时或结果为空时取第一条用户消息作为标题。
+* 每个会话只自动命名一次，管理员手动命名过的会话不再覆盖。配置来自系统配置 session_title 分类。
+ */
+
+// SessionTitleConfig 会话自动命名配置
+type SessionTitleConfig struct {
+	Enabled    bool `json:"enabled"`     // 是否自动生成会话标题
+	AfterTurns int  `json:"after_turns"` // 对话满多少轮后生成
+	MaxLength  int  `json:"max_length"`  // 标题最大字符数
+	UseLLM     bool `json:"use_llm"`     // 是否使用LLM生成，关闭时直接取第一条用户消息
+	TimeoutMs  int  `json:"timeout_ms"`  // LLM生成超时（毫秒）
+}
+
+// DefaultSessionTitleConfig 默认会话自动命名配置
+func DefaultSessionTitleConfig() SessionTitleConfig {
+	return SessionTitleConfig{
+		Enabled:    true,
+		AfterTurns: 3,
+		MaxLength:  20,
+		UseLLM:     true,
+		TimeoutMs:  5000,
+	}
+}
+
+// applyMap 使用配置map覆盖会话自动命名配置
+func (c *SessionTitleConfig) applyMap(config map[string]interface{}) {
+	if config == nil {
+		return
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, c)
+}
+
+// loadSessionTitleConfig 加载会话自动命名配置（系统配置 session_title 分类）
+func (h *ConnectionHandler) loadSessionTitleConfig(layered *layeredConfigSource) SessionTitleConfig {
+	config := DefaultSessionTitleConfig()
+	layered.applySystem("session_title", config.applyMap)
+	if config.AfterTurns <= 0 {
+		config.AfterTurns = 1
+	}
+	if config.MaxLength <= 0 || config.MaxLength > 200 {
+		config.MaxLength = 20
+	}
+	return config
+}
+
+// maybeTitleSession 每轮对话结束后调用，对话轮数达到要求时在后台生成会话标题
+func (h *ConnectionHandler) maybeTitleSession() {
+	config := h.sessionTitleConfig
+	if !config.Enabled || h.memoryService == nil || h.deviceID == "" || atomic.LoadInt32(&h.sessionTitled) == 1 {
+		return
+	}
+
+	dialogue := h.recentDialogue(config.AfterTurns * 2)
+	userTurns := 0
+	for _, msg := range dialogue {
+		if msg.Role == "user" {
+			userTurns++
+		}
+	}
+	if userTurns < config.AfterTurns {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&h.sessionTitled, 0, 1) {
+		return
+	}
+	go h.generateSessionTitle(config, dialogue)
+}
+
+// generateSessionTitle 生成并保存会话标题
+func (h *ConnectionHandler) generateSessionTitle(config SessionTitleConfig, dialogue []types.Message) {
+	defer func() {
+		if r := recover(); r != nil {
+			h.LogError(fmt.Sprintf("生成会话标题发生panic: %v", r))
+		}
+	}()
+
+	needed, err := h.memoryService.NeedsAutoTitle(h.sessionID)
+	if err != nil {
+		h.LogError(fmt.Sprintf("检查会话标题失败: %v", err))
+		return
+	}
+	if !needed {
+		return
+	}
+
+	title := ""
+	if config.UseLLM && h.llmProvider() != nil {
+		title = h.llmSessionTitle(config, dialogue)
+	}
+	if title == "" {
+		var userMessages []string
+		for _, msg := range dialogue {
+			if msg.Role == "user" {
+				userMessages = append(userMessages, msg.Content)
+			}
+		}
+		title = database.HeuristicSessionTitle(userMessages, config.MaxLength)
+	}
+	if title == "" {
+		return
+	}
+
+	updated, err := h.memoryService.SetAutoSessionTitle(h.sessionID, title)
+	if err != nil {
+		h.LogError(fmt.Sprintf("更新会话标题失败: %v", err))
+		return
+	}
+	if updated {
+		h.LogInfo(fmt.Sprintf("会话 %s 自动命名为: %s", h.sessionID, title))
+	}
+}
+
+// llmSessionTitle 调用LLM根据对话生成标题，失败或超时返回空字符串
+func (h *ConnectionHandler) llmSessionTitle(config SessionTitleConfig, dialogue []types.Message) string {
+	var history strings.Builder
+	for _, msg := range dialogue {
+		history.WriteString(fmt.Sprintf("%s: %s\n", msg.Role, msg.Content))
+	}
+	prompt := fmt.Sprintf("请为下面的对话起一个简短的标题，概括对话主题，不超过%d个字。"+
+		"只输出标题本身，不要加引号、标点或任何解释。\n\n%s", config.MaxLength, history.String())
+
+	ctx, cancel := context.WithTimeout(h.requestContext(context.Background(), h.talkRound), time.Duration(config.TimeoutMs)*time.Millisecond)
+	defer cancel()
+
+	responses, err := h.llmProvider().Response(ctx, h.sessionID+"-title", []types.Message{
+		{Role: "user", Content: prompt},
+	})
+	if err != nil {
+		h.LogError(fmt.Sprintf("生成会话标题调用LLM失败: %v", err))
+		return ""
+	}
+
+	var title strings.Builder
+	for {
+		select {
+		case content, ok := <-responses:
+			if !ok {
+				result := title.String()
+				if strings.Contains(result, "服务响应异常") {
+					h.LogError(fmt.Sprintf("生成会话标题失败: %s", result))
+					return ""
+				}
+				return database.CleanSessionTitle(result, config.MaxLength)
+			}
+			title.WriteString(content)
+		case <-ctx.Done():
+			h.LogError(fmt.Sprintf("生成会话标题超时(%dms)，使用第一条用户消息", config.TimeoutMs))
+			return ""
+		}
+	}
+}
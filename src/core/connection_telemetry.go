@@ -0,0 +1,91 @@
+package core
+
+import (
+	"ai-server-go/src/database"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+/*
+* 设备遥测/错误上报：设备通过 {"type":"telemetry", ...} 消息上报本地故障
+* （音频硬件、解码错误、网络等），服务端记录日志并关联到当前会话/设备，
+* 达到持久化级别的事件写入 device_events 表，供管理员接口查询。
+ */
+
+// telemetryLevels 事件级别排序，用于判断是否需要持久化
+var telemetryLevels = map[string]int{
+	"debug": 0,
+	"info":  1,
+	"warn":  2,
+	"error": 3,
+}
+
+// normalizeTelemetryLevel 规范化事件级别，未知级别按info处理
+func normalizeTelemetryLevel(level string) string {
+	level = strings.ToLower(strings.TrimSpace(level))
+	if level == "warning" {
+		level = "warn"
+	}
+	if _, ok := telemetryLevels[level]; !ok {
+		return "info"
+	}
+	return level
+}
+
+// handleTelemetryMessage 处理设备上报的遥测/错误消息
+func (h *ConnectionHandler) handleTelemetryMessage(msgMap map[string]interface{}) error {
+	event := &database.DeviceEvent{
+		DeviceID:  parseUint(h.deviceID),
+		DeviceKey: h.deviceID,
+		SessionID: h.sessionID,
+		Level:     normalizeTelemetryLevel(getStringFromConfig(msgMap, "level")),
+		Category:  getStringFromConfig(msgMap, "category"),
+		Code:      getStringFromConfig(msgMap, "code"),
+		Message:   getStringFromConfig(msgMap, "message"),
+	}
+	if details, ok := msgMap["details"]; ok && details != nil {
+		if data, err := json.Marshal(details); err == nil {
+			event.Details = string(data)
+		}
+	}
+
+	// 设备上报的内容只作为参数传入，不作为格式串
+	const logFormat = "设备上报事件 [%s] category=%s, code=%s, message=%s, details=%s, 设备: %s, 会话: %s, 轮次: %d"
+	logArgs := []interface{}{event.Level, event.Category, event.Code, event.Message, event.Details,
+		h.deviceID, h.sessionID, h.talkRound}
+	switch event.Level {
+	case "error":
+		h.logger.Error(logFormat, logArgs...)
+	case "warn":
+		h.logger.Warn(logFormat, logArgs...)
+	default:
+		h.logger.Info(logFormat, logArgs...)
+	}
+
+	if !h.shouldPersistTelemetry(event.Level) {
+		return nil
+	}
+	go func() {
+		if err := h.deviceService.SaveDeviceEvent(event); err != nil {
+			h.LogError(fmt.Sprintf("保存设备事件失败: %v", err))
+		}
+	}()
+	return nil
+}
+
+// shouldPersistTelemetry 根据系统配置 telemetry 分类判断事件是否需要持久化
+func (h *ConnectionHandler) shouldPersistTelemetry(level string) bool {
+	if h.deviceService == nil || h.configService == nil {
+		return false
+	}
+	persist, err := h.configService.GetSystemConfigBool("telemetry", "persist")
+	if err == nil && !persist {
+		return false
+	}
+	minLevel := "warn"
+	if value, err := h.configService.GetSystemConfigValue("telemetry", "persist_level"); err == nil && value != "" {
+		minLevel = normalizeTelemetryLevel(value)
+	}
+	return telemetryLevels[level] >= telemetryLevels[minLevel]
+}
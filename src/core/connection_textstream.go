@@ -0,0 +1,163 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+/*
+* 流式文本：设备在 hello 的 features 中声明 "text_stream": true，且系统/设备 text_stream 配置启用时生效，
+* 生效后LLM生成回复的同时下发 llm_stream 消息（start → delta... → end），供有屏幕的设备逐字显示。
+* 每条消息带 round（对话轮次）和 index（该文本所在的TTS分段序号，与 tts 消息的 index 一致），设备据此对齐音频。
+* 开启内容审核拦截时只下发审核通过的分段，避免被拦截的内容先显示在屏幕上；工具调用内容不下发。
+* 未声明或未启用的设备（纯音频设备）不会收到文本帧。
+ */
+
+const toolCallPrefix = "<tool_call>"
+
+// TextStreamConfig 流式文本配置
+type TextStreamConfig struct {
+	Enabled  bool `json:"enabled"`   // 是否对声明支持text_stream的设备下发流式文本
+	MinChars int  `json:"min_chars"` // 累计达到该字数再下发一条delta，减少消息数量
+}
+
+// DefaultTextStreamConfig 默认流式文本配置
+func DefaultTextStreamConfig() TextStreamConfig {
+	return TextStreamConfig{
+		Enabled:  true,
+		MinChars: 1,
+	}
+}
+
+// applyMap 使用配置map覆盖流式文本配置
+func (c *TextStreamConfig) applyMap(config map[string]interface{}) {
+	if config == nil {
+		return
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, c)
+}
+
+// loadTextStreamConfig 加载流式文本配置：系统配置 text_stream 分类 < 设备 text_stream 能力配置
+func (h *ConnectionHandler) loadTextStreamConfig(layered *layeredConfigSource) TextStreamConfig {
+	config := DefaultTextStreamConfig()
+	layered.load("text_stream", "text_stream", "", config.applyMap)
+	config.MinChars = max(config.MinChars, 1)
+	return config
+}
+
+// negotiateTextStream 根据客户端hello声明的能力和配置决定是否下发流式文本
+func (h *ConnectionHandler) negotiateTextStream(msgMap map[string]interface{}) {
+	h.textStreamEnabled = false
+	features, _ := msgMap["features"].(map[string]interface{})
+	if supported, _ := features["text_stream"].(bool); !supported {
+		return
+	}
+	if !h.textStreamConfig.Enabled {
+		h.LogInfo("客户端支持流式文本，但text_stream配置未启用，不下发文本帧")
+		return
+	}
+	h.textStreamEnabled = true
+	h.LogInfo(fmt.Sprintf("启用流式文本: min_chars=%d", h.textStreamConfig.MinChars))
+}
+
+// textStream 单次LLM生成的流式文本状态
+type textStream struct {
+	h        *ConnectionHandler
+	round    int
+	started  bool
+	seq      int // 已下发的delta数
+	streamed int // 已下发的字节数（相对完整回复）
+	segments bool
+}
+
+// newTextStream 创建本次生成的流式文本，未启用时返回nil（nil上的方法均为空操作）。
+// 开启内容审核拦截时按分段下发（segments），否则按LLM增量下发
+func (h *ConnectionHandler) newTextStream(round int) *textStream {
+	if !h.textStreamEnabled {
+		return nil
+	}
+	return &textStream{
+		h:        h,
+		round:    round,
+		segments: h.moderator != nil && h.moderationConfig.Block,
+	}
+}
+
+// delta 下发完整回复中尚未下发的部分；final为false时不足min_chars的部分暂存，
+// 回复可能是工具调用（以<tool_call>开头）时暂不下发
+func (s *textStream) delta(fullText string, index int, final bool) {
+	if s == nil || s.segments || len(fullText) <= s.streamed {
+		return
+	}
+	if strings.HasPrefix(toolCallPrefix, fullText) || strings.HasPrefix(fullText, toolCallPrefix) {
+		return
+	}
+	pending := fullText[s.streamed:]
+	if !final && len([]rune(pending)) < s.h.textStreamConfig.MinChars {
+		return
+	}
+	s.send(pending, index)
+	s.streamed = len(fullText)
+}
+
+// segment 审核拦截模式下下发审核通过的分段
+func (s *textStream) segment(text string, index int) {
+	if s == nil || !s.segments || text == "" {
+		return
+	}
+	s.send(text, index)
+}
+
+// send 下发一条delta，首条之前先下发start
+func (s *textStream) send(text string, index int) {
+	if s == nil {
+		return
+	}
+	if !s.started {
+		s.started = true
+		s.write(map[string]interface{}{"state": "start"})
+	}
+	s.seq++
+	s.write(map[string]interface{}{
+		"state": "delta",
+		"text":  text,
+		"seq":   s.seq,
+		"index": index,
+	})
+}
+
+// end 下发end消息，text为最终写入对话历史的回复（被拦截时为提示语）；未下发过文本时不发送
+func (s *textStream) end(content string, blocked bool) {
+	if s == nil || !s.started {
+		return
+	}
+	message := map[string]interface{}{
+		"state": "end",
+		"text":  content,
+		"count": s.seq,
+	}
+	if blocked {
+		message["blocked"] = true
+	}
+	s.write(message)
+}
+
+// write 补充公共字段并发送llm_stream消息
+func (s *textStream) write(message map[string]interface{}) {
+	message["type"] = "llm_stream"
+	message["session_id"] = s.h.sessionID
+	message["round"] = s.round
+	data, err := json.Marshal(message)
+	if err != nil {
+		s.h.logger.Error("序列化流式文本消息失败: %v", err)
+		return
+	}
+	if err := s.h.conn.WriteMessage(1, data); err != nil {
+		s.h.logger.Error("发送流式文本消息失败: %v", err)
+	}
+}
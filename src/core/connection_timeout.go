@@ -0,0 +1,299 @@
+package core
+
+import (
+	"ai-server-go/src/core/pool"
+	"ai-server-go/src/core/types"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+* 对话流水线超时：ASR（说话结束到识别结果）、LLM首个token、TTS首句合成各有独立的超时时间。
+* 超时后取消该阶段的provider请求，向设备下发 {"type":"timeout","stage":...} 消息并播报简短的致歉语，
+* 然后开始新的轮次，旧轮次迟到的回复和音频被丢弃。
+* 配置来自系统配置 pipeline_timeout 分类，设备 pipeline_timeout 能力配置可以覆盖；超时时间为0表示不限制。
+ */
+
+// 流水线阶段
+const (
+	pipelineStageASR = "asr"
+	pipelineStageLLM = "llm"
+	pipelineStageTTS = "tts"
+)
+
+// errStageTimeout 阶段超时，已由 handleStageTimeout 处理
+var errStageTimeout = errors.New("流水线阶段超时")
+
+// PipelineTimeoutConfig 流水线超时配置
+type PipelineTimeoutConfig struct {
+	ASRMs           int    `json:"asr_ms"`             // 说话结束（或手动模式停止收音）后等待识别结果的最长时间（毫秒）
+	LLMFirstTokenMs int    `json:"llm_first_token_ms"` // 等待LLM首个输出的最长时间（毫秒）
+	TTSFirstByteMs  int    `json:"tts_first_byte_ms"`  // 等待首句语音合成的最长时间（毫秒）
+	Apology         string `json:"apology"`            // 超时后播报的致歉语
+}
+
+// DefaultPipelineTimeoutConfig 默认流水线超时配置
+func DefaultPipelineTimeoutConfig() PipelineTimeoutConfig {
+	return PipelineTimeoutConfig{
+		ASRMs:           8000,
+		LLMFirstTokenMs: 15000,
+		TTSFirstByteMs:  10000,
+		Apology:         "抱歉，我这边反应有点慢，请再说一遍吧",
+	}
+}
+
+// applyMap 使用配置map覆盖流水线超时配置
+func (c *PipelineTimeoutConfig) applyMap(config map[string]interface{}) {
+	if config == nil {
+		return
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, c)
+}
+
+// timeout 阶段的超时时间，0表示不限制
+func (c PipelineTimeoutConfig) timeout(stage string) time.Duration {
+	var ms int
+	switch stage {
+	case pipelineStageASR:
+		ms = c.ASRMs
+	case pipelineStageLLM:
+		ms = c.LLMFirstTokenMs
+	case pipelineStageTTS:
+		ms = c.TTSFirstByteMs
+	}
+	if ms <= 0 {
+		return 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// loadPipelineTimeoutConfig 加载流水线超时配置：系统配置 pipeline_timeout 分类 < 设备 pipeline_timeout 能力配置
+func (h *ConnectionHandler) loadPipelineTimeoutConfig(layered *layeredConfigSource) PipelineTimeoutConfig {
+	config := DefaultPipelineTimeoutConfig()
+	layered.load("pipeline_timeout", "pipeline_timeout", "", config.applyMap)
+	return config
+}
+
+// stageDeadline 单个阶段的超时计时，超时回调最多触发一次；nil表示不限制
+type stageDeadline struct {
+	timer   *time.Timer
+	expired atomic.Bool
+	fired   chan struct{} // 超时后关闭
+}
+
+// startStageDeadline 开始阶段计时，超时后调用cancel（可为nil）并按超时处理；阶段不限制时返回nil
+func (h *ConnectionHandler) startStageDeadline(stage string, round int, cancel context.CancelFunc) *stageDeadline {
+	timeout := h.pipelineTimeoutConfig.timeout(stage)
+	if timeout <= 0 {
+		return nil
+	}
+	deadline := &stageDeadline{fired: make(chan struct{})}
+	deadline.timer = time.AfterFunc(timeout, func() {
+		if !deadline.expired.CompareAndSwap(false, true) {
+			return
+		}
+		if cancel != nil {
+			cancel()
+		}
+		close(deadline.fired)
+		h.handleStageTimeout(stage, timeout, round)
+	})
+	return deadline
+}
+
+// stop 阶段按时完成，停止计时；返回false表示已经超时
+func (d *stageDeadline) stop() bool {
+	if d == nil {
+		return true
+	}
+	if d.timer.Stop() {
+		return true
+	}
+	return !d.expired.Load()
+}
+
+// done 超时后关闭的channel，不限制时返回nil（永不关闭）
+func (d *stageDeadline) done() <-chan struct{} {
+	if d == nil {
+		return nil
+	}
+	return d.fired
+}
+
+// hasExpired 阶段是否已经超时
+func (d *stageDeadline) hasExpired() bool {
+	return d != nil && d.expired.Load()
+}
+
+// asrDeadlineState 等待识别结果的超时状态
+type asrDeadlineState struct {
+	mu       sync.Mutex
+	deadline *stageDeadline
+	armed    bool      // 本次收听是否已开始计时，每次收听只计时一次
+	armedAt  time.Time // 开始计时的时间，用于统计识别耗时
+}
+
+// armASRDeadline 说话结束或手动停止收音后开始等待识别结果的计时
+func (h *ConnectionHandler) armASRDeadline() {
+	h.asrDeadline.mu.Lock()
+	defer h.asrDeadline.mu.Unlock()
+	if h.asrDeadline.armed {
+		return
+	}
+	h.asrDeadline.armed = true
+	h.asrDeadline.armedAt = time.Now()
+	h.asrDeadline.deadline = h.startStageDeadline(pipelineStageASR, h.talkRound, nil)
+}
+
+// armASRDeadlineOnSpeechEnd 自动拾音时，检测到说话结束后开始计时；仍在等待语音起点（尚未向ASR转发音频）时不计时
+func (h *ConnectionHandler) armASRDeadlineOnSpeechEnd() {
+	if h.listenMode() == "manual" || h.lastTextIndex() != -1 || h.preRollWaiting() {
+		return
+	}
+	detector, ok := h.asrProvider().(interface{ IsSpeechEnded() bool })
+	if !ok || !detector.IsSpeechEnded() {
+		return
+	}
+	h.armASRDeadline()
+}
+
+// stopASRDeadline 收到识别结果，停止计时；返回false表示已经超时
+func (h *ConnectionHandler) stopASRDeadline() bool {
+	h.asrDeadline.mu.Lock()
+	defer h.asrDeadline.mu.Unlock()
+	deadline := h.asrDeadline.deadline
+	h.asrDeadline.deadline = nil
+	ok := deadline.stop()
+	if ok && !h.asrDeadline.armedAt.IsZero() {
+		h.recordStageLatency(pipelineStageASR, time.Since(h.asrDeadline.armedAt))
+	}
+	h.asrDeadline.armedAt = time.Time{}
+	return ok
+}
+
+// resetASRDeadline 开始新的收听，允许再次计时
+func (h *ConnectionHandler) resetASRDeadline() {
+	h.asrDeadline.mu.Lock()
+	defer h.asrDeadline.mu.Unlock()
+	h.asrDeadline.deadline.stop()
+	h.asrDeadline.deadline = nil
+	h.asrDeadline.armed = false
+	h.asrDeadline.armedAt = time.Time{}
+}
+
+// handleStageTimeout 阶段超时：丢弃本轮未播放的内容，通知设备并播报致歉语，之后开始新的轮次
+func (h *ConnectionHandler) handleStageTimeout(stage string, timeout time.Duration, round int) {
+	if h.conn != nil && h.conn.IsClosed() {
+		return
+	}
+	if round != h.talkRound {
+		return
+	}
+	h.LogError(fmt.Sprintf("%s阶段超时(%s)，轮次: %d", stage, timeout, round))
+	h.recordStageError(stage)
+
+	h.stopServerSpeak()
+	if stage == pipelineStageASR {
+		h.client_asr_text = ""
+		if err := h.asrProvider().Reset(); err != nil {
+			h.logger.Error("超时后重置ASR失败: %v", err)
+		}
+		h.rearmPreRoll()
+	} else {
+		// 旧轮次迟到的LLM分段和合成结果按过期轮次丢弃
+		h.talkRound++
+		h.roundStartTime = time.Now()
+	}
+
+	apology := h.pipelineTimeoutConfig.Apology
+	if err := h.sendTimeoutMessage(stage, timeout, apology); err != nil {
+		h.LogError(fmt.Sprintf("发送超时消息失败: %v", err))
+	}
+
+	if apology == "" {
+		h.sendTTSMessage("stop", "", 0)
+		h.clearSpeakStatus()
+		return
+	}
+	// 致歉语本身不再计算TTS超时，避免合成缓慢时反复超时
+	h.timeoutApologyRound = h.talkRound
+	atomic.StoreInt32(&h.serverVoiceStop, 0)
+	if stage == pipelineStageASR {
+		h.sendTTSMessage("start", "", 0)
+	}
+	h.SystemSpeak(apology)
+}
+
+// sendTimeoutMessage 通知设备流水线阶段超时
+func (h *ConnectionHandler) sendTimeoutMessage(stage string, timeout time.Duration, text string) error {
+	message := map[string]interface{}{
+		"type":       "timeout",
+		"stage":      stage,
+		"timeout_ms": timeout.Milliseconds(),
+		"session_id": h.sessionID,
+		"text":       text,
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("序列化超时消息失败: %v", err)
+	}
+	return h.conn.WriteMessage(1, data)
+}
+
+// synthesizeWithDeadline 合成语音，返回音频文件和实际合成的备用TTS名称（主TTS合成时为空）；
+// 本轮首句受TTS首字节超时限制，超时后放弃等待，迟到的音频文件被删除
+func (h *ConnectionHandler) synthesizeWithDeadline(ctx context.Context, text string, textIndex int, round int) (string, string, error) {
+	if textIndex != 1 || round == h.timeoutApologyRound || h.pipelineTimeoutConfig.timeout(pipelineStageTTS) <= 0 {
+		return pool.SynthesizeTTS(ctx, h.ttsFor(text, textIndex), text)
+	}
+
+	provider := h.ttsFor(text, textIndex)
+	ctx, cancel := context.WithCancel(ctx)
+	deadline := h.startStageDeadline(pipelineStageTTS, round, cancel)
+	type ttsResult struct {
+		filepath string
+		source   string
+		err      error
+	}
+	done := make(chan ttsResult, 1)
+	go func() {
+		filepath, source, err := pool.SynthesizeTTS(ctx, provider, text)
+		done <- ttsResult{filepath, source, err}
+	}()
+
+	select {
+	case result := <-done:
+		deadline.stop()
+		cancel()
+		return result.filepath, result.source, result.err
+	case <-deadline.done():
+		go func() {
+			if result := <-done; result.err == nil {
+				h.deleteAudioFileIfNeeded(result.filepath, "TTS超时后")
+			}
+		}()
+		return "", "", errStageTimeout
+	}
+}
+
+// nextLLMResponse 读取下一个LLM输出，收到首个输出即停止首token计时；输出结束或已超时返回false
+func nextLLMResponse(responses <-chan types.Response, deadline *stageDeadline) (types.Response, bool) {
+	select {
+	case response, ok := <-responses:
+		if !ok || !deadline.stop() {
+			return types.Response{}, false
+		}
+		return response, true
+	case <-deadline.done():
+		return types.Response{}, false
+	}
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"ai-server-go/src/core/function"
+	"ai-server-go/src/core/types"
+	"encoding/json"
+	"fmt"
+)
+
+/*
+* 工具目录：每个会话的注册表包含内置工具（时间、天气等，见 function 包）和绑定连接后注册的MCP工具，
+* 调用LLM时按过滤规则组装本轮提供给模型的工具列表。过滤规则来自系统配置 tools 分类，
+* 设备的 tools 能力配置（allow/deny）可以覆盖。
+ */
+
+// initTools 注册内置工具并加载工具过滤规则
+func (h *ConnectionHandler) initTools(layered *layeredConfigSource) {
+	if err := function.RegisterBuiltins(h.functionRegister); err != nil {
+		h.logger.Error("注册内置工具失败: %v", err)
+	}
+	h.initInfoTools(layered)
+	h.toolFilter = h.loadToolFilter()
+	if len(h.toolFilter.Allow) > 0 || len(h.toolFilter.Deny) > 0 {
+		h.LogInfo(fmt.Sprintf("工具过滤规则: allow=%v, deny=%v", h.toolFilter.Allow, h.toolFilter.Deny))
+	}
+}
+
+// loadToolFilter 加载工具过滤规则：系统配置 tools 分类 < 设备 tools 能力配置
+func (h *ConnectionHandler) loadToolFilter() function.ToolFilter {
+	filter := function.ToolFilter{}
+	if h.configService == nil {
+		return filter
+	}
+
+	if allow, err := h.configService.GetSystemConfigArray("tools", "allow"); err == nil {
+		filter.Allow = allow
+	}
+	if deny, err := h.configService.GetSystemConfigArray("tools", "deny"); err == nil {
+		filter.Deny = deny
+	}
+
+	if h.deviceID != "" {
+		deviceConfig, err := h.configService.GetDeviceCapabilityConfigWithFallback(parseUint(h.deviceID), h.userID)
+		if err == nil && deviceConfig != nil {
+			for _, capability := range deviceConfig.Capabilities {
+				if capability.CapabilityName != "tools" {
+					continue
+				}
+				data, err := json.Marshal(capability.Config)
+				if err != nil {
+					continue
+				}
+				_ = json.Unmarshal(data, &filter)
+			}
+		}
+	}
+	return filter
+}
+
+// handleToolResult 统一处理工具调用结果，非 ActionResponse 结果交给LLM继续回复
+func (h *ConnectionHandler) handleToolResult(result interface{}, functionCallData map[string]interface{}, textIndex int) {
+	if actionResult, ok := result.(types.ActionResponse); ok {
+		h.handleFunctionResult(actionResult, functionCallData, textIndex)
+		return
+	}
+	h.LogInfo(fmt.Sprintf("函数调用结果: %v", result))
+	h.handleFunctionResult(types.ActionResponse{
+		Action: types.ActionTypeReqLLM, // 动作类型
+		Result: result,                 // 动作产生的结果
+	}, functionCallData, textIndex)
+}
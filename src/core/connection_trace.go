@@ -0,0 +1,42 @@
+package core
+
+import (
+	"ai-server-go/src/core/providers"
+	"ai-server-go/src/core/utils"
+	"context"
+)
+
+/*
+* 请求标识传递：调用 LLM/TTS/ASR 提供者时，通过 context 携带会话ID、设备ID和链路追踪ID，
+* 提供者在日志和错误信息中附带这些标识。每轮对话生成一个链路追踪ID，
+* 同一轮中的ASR纠错、LLM、工具调用和TTS共用该ID，便于把上游失败定位到具体的对话轮次。
+ */
+
+// roundTraceID 获取对话轮次的链路追踪ID，轮次变化时重新生成
+func (h *ConnectionHandler) roundTraceID(round int) string {
+	h.traceMu.Lock()
+	defer h.traceMu.Unlock()
+	if h.traceID == "" || h.traceRound != round {
+		h.traceRound = round
+		h.traceID = utils.NewTraceID()
+	}
+	return h.traceID
+}
+
+// requestContext 返回携带本连接会话/设备标识和指定轮次链路追踪ID的context
+func (h *ConnectionHandler) requestContext(ctx context.Context, round int) context.Context {
+	return utils.WithRequestInfo(ctx, utils.RequestInfo{
+		SessionID: h.sessionID,
+		DeviceID:  h.deviceID,
+		TraceID:   h.roundTraceID(round),
+	})
+}
+
+// refreshASRRequestContext 流式识别不经由参数传递context，开始收听时把下一轮的请求标识设置给ASR提供者
+func (h *ConnectionHandler) refreshASRRequestContext() {
+	setter, ok := h.asrProvider().(providers.RequestContextSetter)
+	if !ok {
+		return
+	}
+	setter.SetRequestContext(h.requestContext(h.ctx, h.talkRound+1))
+}
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+/*
+* TTS不可用时降级为纯文本：全部TTS提供者（含备用链）都合成失败时，对能显示文字的设备改为下发文本消息
+* {"type":"tts","state":"text_only","text":...,"index":...,"round":...}，由设备显示回复，本轮对话照常结束而不是没有任何反馈。
+* 是否降级由设备 tts_text_fallback 能力配置决定（系统配置 tts_text_fallback 分类提供默认值，默认关闭），纯音频设备不应开启。
+* 本轮某一句合成失败后，其余分段不再尝试合成，直接以文本下发；notice 开启时本轮额外播放一次预备的
+* “语音暂不可用”提示音频（failure_speech 的 tts 提示语，只使用预录或预合成的音频）。
+ */
+
+// TTSTextFallbackConfig TTS不可用时降级为纯文本的配置
+type TTSTextFallbackConfig struct {
+	Enabled bool `json:"enabled"` // 是否在TTS全部失败时以文本下发回复
+	Notice  bool `json:"notice"`  // 降级时是否播放一次预备的语音不可用提示音频
+}
+
+// DefaultTTSTextFallbackConfig 默认配置：关闭
+func DefaultTTSTextFallbackConfig() TTSTextFallbackConfig {
+	return TTSTextFallbackConfig{
+		Enabled: false,
+		Notice:  true,
+	}
+}
+
+// applyMap 使用配置map覆盖降级配置
+func (c *TTSTextFallbackConfig) applyMap(config map[string]interface{}) {
+	if config == nil {
+		return
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, c)
+}
+
+// loadTTSTextFallbackConfig 加载降级配置：系统配置 tts_text_fallback 分类 < 设备 tts_text_fallback 能力配置
+func (h *ConnectionHandler) loadTTSTextFallbackConfig(layered *layeredConfigSource) TTSTextFallbackConfig {
+	config := DefaultTTSTextFallbackConfig()
+	layered.load("tts_text_fallback", "tts_text_fallback", "", config.applyMap)
+	return config
+}
+
+// ttsTextOnly 本轮是否已降级为纯文本，降级后其余分段不再合成
+func (h *ConnectionHandler) ttsTextOnly(round int) bool {
+	return h.ttsTextFallbackConfig.Enabled && h.ttsTextOnlyRound == round
+}
+
+// fallbackToText TTS全部失败时以文本下发该分段，返回替代播放的提示音频（文本和路径）；未启用降级时返回false
+func (h *ConnectionHandler) fallbackToText(text string, textIndex int, round int) (string, string, bool) {
+	if !h.ttsTextFallbackConfig.Enabled {
+		return "", "", false
+	}
+	if h.ttsTextOnlyRound != round {
+		h.ttsTextOnlyRound = round
+		h.LogInfo(fmt.Sprintf("TTS不可用，本轮回复降级为文本下发, 轮次: %d", round))
+	}
+	if round == h.talkRound {
+		if err := h.sendTextOnlyMessage(text, textIndex, round); err != nil {
+			h.LogError(err.Error())
+		}
+	}
+	if !h.ttsTextFallbackConfig.Notice {
+		return "", "", true
+	}
+	noticeText, clip := h.failureClip(failureTTS)
+	if clip == "" || !h.failureSpeech.take(failureTTS, round) {
+		return "", "", true
+	}
+	h.LogInfo(fmt.Sprintf("TTS不可用，播放预备的提示语: %s", noticeText))
+	return noticeText, clip, true
+}
+
+// sendTextOnlyMessage 下发无音频的回复文本，index 与正常合成时的分段序号一致
+func (h *ConnectionHandler) sendTextOnlyMessage(text string, textIndex int, round int) error {
+	data, err := json.Marshal(map[string]interface{}{
+		"type":       "tts",
+		"state":      "text_only",
+		"session_id": h.sessionID,
+		"text":       text,
+		"index":      textIndex,
+		"round":      round,
+	})
+	if err != nil {
+		return fmt.Errorf("序列化纯文本回复失败: %v", err)
+	}
+	if err := h.conn.WriteMessage(1, data); err != nil {
+		return fmt.Errorf("发送纯文本回复失败: %v", err)
+	}
+	return nil
+}
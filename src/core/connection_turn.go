@@ -0,0 +1,120 @@
+package core
+
+import (
+	"ai-server-go/src/core/chat"
+	"ai-server-go/src/core/types"
+	"ai-server-go/src/database"
+	"fmt"
+	"sync"
+	"time"
+)
+
+/*
+* 对话轮次持久化：一轮对话中的用户消息、助手回复和用量先在连接上累积，
+* 下一轮开始或连接关闭结算时通过 RecordTurn 在同一个事务中写入消息、会话消息计数和使用统计，
+* 提交成功后再生成记忆。审核评分是异步的，结算时等待本轮的评分完成后再提交。
+ */
+
+// turnMessage 本轮待保存的消息，附件在提交时写入图片存储
+type turnMessage struct {
+	message     database.TurnMessage
+	attachments []types.Attachment
+}
+
+// pendingTurn 尚未提交的一轮对话
+type pendingTurn struct {
+	mu       sync.Mutex
+	messages []turnMessage
+	inflight sync.WaitGroup // 进行中的审核评分
+}
+
+// currentTurn 获取当前轮次，不存在时创建
+func (h *ConnectionHandler) currentTurn() *pendingTurn {
+	h.turnMu.Lock()
+	defer h.turnMu.Unlock()
+	if h.turn == nil {
+		h.turn = &pendingTurn{}
+	}
+	return h.turn
+}
+
+// add 追加一条待保存的消息
+func (t *pendingTurn) add(msg turnMessage) {
+	t.mu.Lock()
+	t.messages = append(t.messages, msg)
+	t.mu.Unlock()
+}
+
+// addTurnMessage 将消息加入当前轮次，结算时统一保存
+func (h *ConnectionHandler) addTurnMessage(msg chat.Message, messageType string) {
+	h.currentTurn().add(turnMessage{
+		message: database.TurnMessage{
+			Role:        msg.Role,
+			Content:     msg.Content,
+			MessageType: messageType,
+			Timestamp:   time.Now(),
+		},
+		attachments: msg.Attachments,
+	})
+}
+
+// finishTurn 结算本轮：估算用量费用，并在一个事务中保存本轮消息和使用统计
+func (h *ConnectionHandler) finishTurn() {
+	usage := h.flushUsage()
+
+	h.turnMu.Lock()
+	turn := h.turn
+	h.turn = nil
+	h.turnMu.Unlock()
+
+	if h.memoryService == nil {
+		h.recordUsageStats(usage)
+		return
+	}
+	if turn == nil && len(usage) == 0 {
+		return
+	}
+
+	// 对话历史在提交前取快照，下一轮的消息不计入本轮记忆
+	var dialogue []chat.Message
+	if turn != nil && h.dialogueManager != nil && h.dialogueManager.MemoryEnabled() {
+		dialogue = append([]chat.Message(nil), h.dialogueManager.GetLLMDialogue()...)
+	}
+
+	go func() {
+		record := database.ConversationTurn{
+			SessionID: h.sessionID,
+			UserID:    h.userID,
+			DeviceID:  parseUint(h.deviceID),
+			Usage:     usage,
+			Dialogue:  dialogue,
+		}
+		if turn != nil {
+			turn.inflight.Wait()
+			turn.mu.Lock()
+			messages := turn.messages
+			turn.mu.Unlock()
+			for _, msg := range messages {
+				// 内嵌图片先写入图片存储，消息只保存引用
+				msg.message.Attachments = h.storeHistoryAttachments(msg.attachments)
+				record.Messages = append(record.Messages, msg.message)
+			}
+		}
+		if err := h.memoryService.RecordTurn(record); err != nil {
+			h.LogError(fmt.Sprintf("保存对话轮次失败: %v", err))
+		}
+	}()
+}
+
+// recordUsageStats 没有聊天记忆服务时单独写入使用统计
+func (h *ConnectionHandler) recordUsageStats(usage []database.TurnUsage) {
+	deviceID := parseUint(h.deviceID)
+	if h.deviceService == nil || deviceID == 0 {
+		return
+	}
+	for _, item := range usage {
+		if err := h.deviceService.RecordUsage(h.userID, deviceID, item.Capability, item.Usage, item.Cost, true, 0); err != nil {
+			h.LogError(fmt.Sprintf("记录使用统计失败: %v", err))
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package core
+
+import (
+	"ai-server-go/src/core/utils"
+	"ai-server-go/src/database"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+/*
+* 费用估算：按 LLM token、TTS 字符、ASR 音频时长累计每轮用量，
+* 使用当前生效的 provider 配置中的单价估算费用，随本轮对话一起写入 usage_stats（见 connection_turn.go）。
+* 单价由管理员在 provider 配置中维护，未定价时费用为0。TTS在合成成功后计费，由备用TTS合成时按备用provider的单价估算。
+ */
+
+// usageCapabilities 参与费用估算的能力及对应的provider类别
+var usageCapabilities = map[string]string{
+	"llm": "LLM",
+	"tts": "TTS",
+	"asr": "ASR",
+}
+
+// usageMeter 连接级用量累计
+type usageMeter struct {
+	mu      sync.Mutex
+	pending map[string]*database.UsageAmount // 尚未写入统计的用量，按能力划分
+	costs   map[string]float64               // 尚未写入统计的估算费用，按能力划分
+	prices  map[string]*database.ProviderConfig
+	named   map[string]*database.ProviderConfig // 按名称查询的provider单价（如备用TTS），键为 类别/名称
+	total   float64                             // 本连接累计估算费用
+}
+
+// initUsageMeter 解析各能力当前生效的provider配置，用于读取单价
+func (h *ConnectionHandler) initUsageMeter() {
+	h.usage = &usageMeter{
+		pending: make(map[string]*database.UsageAmount),
+		costs:   make(map[string]float64),
+		prices:  make(map[string]*database.ProviderConfig),
+		named:   make(map[string]*database.ProviderConfig),
+	}
+	if h.configService == nil {
+		return
+	}
+
+	var deviceID *uint
+	if id := parseUint(h.deviceID); id > 0 {
+		deviceID = &id
+	}
+	for capability, category := range usageCapabilities {
+		provider, err := h.configService.GetEffectiveProvider(category, deviceID, h.userID)
+		if err != nil || provider == nil {
+			continue
+		}
+		h.usage.prices[capability] = provider
+	}
+}
+
+// addUsage 累加指定能力的用量，按该能力当前生效provider的单价估算费用；回环测试不计用量
+func (h *ConnectionHandler) addUsage(capability string, usage database.UsageAmount) {
+	h.addProviderUsage(capability, "", usage)
+}
+
+// addProviderUsage 累加指定能力的用量，provider 不为空时按该provider的单价估算费用（如备用TTS）
+func (h *ConnectionHandler) addProviderUsage(capability, provider string, usage database.UsageAmount) {
+	if h.usage == nil || usage.IsZero() || h.loopbackMode != "" {
+		return
+	}
+	price := h.usagePrice(capability, provider)
+	h.usage.mu.Lock()
+	defer h.usage.mu.Unlock()
+	amount, ok := h.usage.pending[capability]
+	if !ok {
+		amount = &database.UsageAmount{}
+		h.usage.pending[capability] = amount
+	}
+	amount.Add(usage)
+	h.usage.costs[capability] += database.EstimateCost(price, usage)
+}
+
+// usagePrice 能力的计费单价：provider 为空时为当前生效的provider，否则按名称查询并缓存
+func (h *ConnectionHandler) usagePrice(capability, provider string) *database.ProviderConfig {
+	h.usage.mu.Lock()
+	if provider == "" {
+		defer h.usage.mu.Unlock()
+		return h.usage.prices[capability]
+	}
+	key := usageCapabilities[capability] + "/" + provider
+	price, ok := h.usage.named[key]
+	h.usage.mu.Unlock()
+	if ok || h.configService == nil {
+		return price
+	}
+
+	price, err := h.configService.GetProviderConfigByCategoryAndName(usageCapabilities[capability], provider)
+	if err != nil {
+		h.logger.Warn("查询provider %s 的单价失败，按未定价计费: %v", key, err)
+		price = nil
+	}
+	h.usage.mu.Lock()
+	h.usage.named[key] = price
+	h.usage.mu.Unlock()
+	return price
+}
+
+// flushUsage 估算累计用量的费用，返回各能力的用量供本轮结算写入使用统计
+func (h *ConnectionHandler) flushUsage() []database.TurnUsage {
+	if h.usage == nil {
+		return nil
+	}
+	h.usage.mu.Lock()
+	pending, costs := h.usage.pending, h.usage.costs
+	h.usage.pending = make(map[string]*database.UsageAmount)
+	h.usage.costs = make(map[string]float64)
+	h.usage.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	var cost float64
+	var parts []string
+	usage := make([]database.TurnUsage, 0, len(pending))
+	for capability, amount := range pending {
+		capabilityCost := costs[capability]
+		cost += capabilityCost
+		parts = append(parts, fmt.Sprintf("%s=%s", capability, database.FormatCost(capabilityCost)))
+		usage = append(usage, database.TurnUsage{Capability: capability, Usage: *amount, Cost: capabilityCost})
+	}
+
+	h.usage.mu.Lock()
+	h.usage.total += cost
+	total := h.usage.total
+	h.usage.mu.Unlock()
+
+	h.logger.Debug("本轮估算费用 %s (%s)，连接累计 %s",
+		database.FormatCost(cost), strings.Join(parts, ", "), database.FormatCost(total))
+	return usage
+}
+
+// recordLLMUsage 按输入消息和输出内容估算LLM用量
+func (h *ConnectionHandler) recordLLMUsage(messages []string, output string) {
+	input := 0
+	for _, msg := range messages {
+		input += utils.EstimateTokens(msg)
+	}
+	h.addUsage("llm", database.UsageAmount{
+		InputTokens:  input,
+		OutputTokens: utils.EstimateTokens(output),
+	})
+}
+
+// recordTTSUsage 合成成功后累计TTS字符数，source 为实际合成的备用TTS名称，为空时按当前生效的TTS计费
+func (h *ConnectionHandler) recordTTSUsage(chars int, source string) {
+	h.addProviderUsage("tts", source, database.UsageAmount{TTSChars: chars})
+}
+
+// recordASRUsage 按PCM数据长度累计ASR音频时长
+func (h *ConnectionHandler) recordASRUsage(pcm []byte) {
+	sampleRate := h.clientAudioSampleRate
+	if sampleRate <= 0 {
+		sampleRate = 16000
+	}
+	channels := h.clientAudioChannels
+	if channels <= 0 {
+		channels = 1
+	}
+	h.addUsage("asr", database.UsageAmount{
+		ASRSeconds: float64(len(pcm)) / float64(sampleRate*2*channels),
+	})
+}
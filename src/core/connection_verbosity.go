@@ -0,0 +1,202 @@
+package core
+
+import (
+	"ai-server-go/src/core/providers/llm"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+/*
+* 回复详略程度：按设备选择 terse（简短）、normal（默认）或 detailed（详细）档位，
+* 儿童设备可以使用 terse 只回答一两句，研究助手类设备使用 detailed。
+* 每个档位映射为具体参数：追加到系统提示词的说明、单次请求的 max_tokens，
+* 以及生成后的硬性限制（句数、字数），超出限制的部分不播放也不写入对话历史，并取消剩余的生成。
+* 配置来自系统配置 verbosity 分类，设备 verbosity 能力配置可以覆盖；levels 中的档位按名称合并覆盖默认映射。
+ */
+
+// 回复详略档位
+const (
+	verbosityTerse    = "terse"
+	verbosityNormal   = "normal"
+	verbosityDetailed = "detailed"
+)
+
+// VerbosityLevel 一个详略档位对应的参数
+type VerbosityLevel struct {
+	Prompt       string `json:"prompt"`        // 追加到系统提示词的说明，为空时不追加
+	MaxTokens    int    `json:"max_tokens"`    // 单次LLM请求的输出token上限，0表示使用provider配置
+	MaxSentences int    `json:"max_sentences"` // 生成后的句数上限，0表示不限制
+	MaxChars     int    `json:"max_chars"`     // 生成后的字数上限，0表示不限制
+}
+
+// VerbosityConfig 回复详略配置
+type VerbosityConfig struct {
+	Level  string                    `json:"level"`  // 使用的档位
+	Levels map[string]VerbosityLevel `json:"levels"` // 档位到参数的映射
+}
+
+// DefaultVerbosityConfig 默认回复详略配置，normal 档位不改变原有行为
+func DefaultVerbosityConfig() VerbosityConfig {
+	return VerbosityConfig{
+		Level: verbosityNormal,
+		Levels: map[string]VerbosityLevel{
+			verbosityTerse: {
+				Prompt:       "请用一到两句话简短回答，不要展开。",
+				MaxTokens:    150,
+				MaxSentences: 2,
+			},
+			verbosityNormal: {},
+			verbosityDetailed: {
+				Prompt: "请尽量详细、完整地回答，必要时分点说明。",
+			},
+		},
+	}
+}
+
+// applyMap 使用配置map覆盖回复详略配置，levels 按档位名称合并
+func (c *VerbosityConfig) applyMap(config map[string]interface{}) {
+	if config == nil {
+		return
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return
+	}
+	var override VerbosityConfig
+	if err := json.Unmarshal(data, &override); err != nil {
+		return
+	}
+	if override.Level != "" {
+		c.Level = override.Level
+	}
+	if c.Levels == nil {
+		c.Levels = make(map[string]VerbosityLevel)
+	}
+	for name, level := range override.Levels {
+		c.Levels[name] = level
+	}
+}
+
+// level 当前档位的参数，未知档位时使用 normal
+func (c VerbosityConfig) level() (VerbosityLevel, bool) {
+	level, ok := c.Levels[c.Level]
+	if !ok {
+		return c.Levels[verbosityNormal], false
+	}
+	return level, true
+}
+
+// loadVerbosityConfig 加载回复详略配置：系统配置 verbosity 分类 < 设备 verbosity 能力配置
+func (h *ConnectionHandler) loadVerbosityConfig(layered *layeredConfigSource) VerbosityConfig {
+	config := DefaultVerbosityConfig()
+	layered.load("verbosity", "verbosity", "", config.applyMap)
+	return config
+}
+
+// initVerbosity 解析本连接使用的详略档位
+func (h *ConnectionHandler) initVerbosity() {
+	level, ok := h.verbosityConfig.level()
+	if !ok {
+		h.LogError(fmt.Sprintf("未知的回复详略档位 %q，使用 %s", h.verbosityConfig.Level, verbosityNormal))
+	}
+	h.verbosity = level
+	if level != (VerbosityLevel{}) {
+		h.LogInfo(fmt.Sprintf("回复详略档位: %s，max_tokens %d，句数上限 %d，字数上限 %d",
+			h.verbosityConfig.Level, level.MaxTokens, level.MaxSentences, level.MaxChars))
+	}
+}
+
+// applyVerbosityPrompt 将详略说明追加到系统提示词，需在人设提示词之后调用
+func (h *ConnectionHandler) applyVerbosityPrompt() {
+	prompt := strings.TrimSpace(h.verbosity.Prompt)
+	if prompt == "" {
+		return
+	}
+	dialogue := h.dialogueManager.GetLLMDialogue()
+	if len(dialogue) == 0 || dialogue[0].Role != "system" {
+		h.dialogueManager.SetSystemMessage(prompt)
+		return
+	}
+	h.dialogueManager.SetSystemMessage(dialogue[0].Content + "\n" + prompt)
+}
+
+// verbosityContext 为LLM请求附加当前档位的输出token上限
+func (h *ConnectionHandler) verbosityContext(ctx context.Context) context.Context {
+	return llm.WithMaxTokens(ctx, h.verbosity.MaxTokens)
+}
+
+// replyLimiter 一次回复的句数和字数限制，按播放的分段逐段累计
+type replyLimiter struct {
+	maxSentences int
+	maxChars     int
+	sentences    int
+	chars        int
+	done         bool
+}
+
+// newReplyLimiter 按当前档位创建回复限制，未配置限制时返回nil
+func (h *ConnectionHandler) newReplyLimiter() *replyLimiter {
+	if h.verbosity.MaxSentences <= 0 && h.verbosity.MaxChars <= 0 {
+		return nil
+	}
+	return &replyLimiter{
+		maxSentences: h.verbosity.MaxSentences,
+		maxChars:     h.verbosity.MaxChars,
+	}
+}
+
+// take 截取分段中未超出限制的部分，第二个返回值表示已达到限制、后续文本应丢弃
+func (l *replyLimiter) take(segment string) (string, bool) {
+	if l == nil {
+		return segment, false
+	}
+	if l.done {
+		return "", true
+	}
+	runes := []rune(segment)
+	end := len(runes)
+	for i, r := range runes {
+		if l.maxChars > 0 && l.chars >= l.maxChars {
+			end = i
+			l.done = true
+			break
+		}
+		if !unicode.IsSpace(r) {
+			l.chars++
+		}
+		if isSentenceEnd(runes, i) {
+			l.sentences++
+			if l.maxSentences > 0 && l.sentences >= l.maxSentences {
+				end = i + 1
+				l.done = true
+				break
+			}
+		}
+	}
+	if l.maxChars > 0 && l.chars >= l.maxChars {
+		l.done = true
+	}
+	return string(runes[:end]), l.done
+}
+
+// isSentenceEnd 第i个字符是否结束一个句子，连续的结束标点只计一次，英文句点需后接空白或位于末尾
+func isSentenceEnd(runes []rune, i int) bool {
+	if !isSentenceTerminator(runes, i) {
+		return false
+	}
+	return i+1 >= len(runes) || !isSentenceTerminator(runes, i+1)
+}
+
+// isSentenceTerminator 第i个字符是否为句末标点
+func isSentenceTerminator(runes []rune, i int) bool {
+	switch runes[i] {
+	case '。', '！', '？', '!', '?', '；', ';', '…', '\n':
+		return true
+	case '.':
+		return i+1 >= len(runes) || unicode.IsSpace(runes[i+1])
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package function
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"ai-server-go/src/core/types"
+)
+
+// TimeToolName 时间工具名称
+const TimeToolName = "get_time"
+
+var weekdayNames = []string{"星期日", "星期一", "星期二", "星期三", "星期四", "星期五", "星期六"}
+
+func init() {
+	RegisterBuiltin(Tool{
+		Name:        TimeToolName,
+		Description: "获取今天日期或者当前时间信息时调用",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"timezone": map[string]interface{}{
+					"type":        "string",
+					"description": "IANA时区名称，如Asia/Shanghai，不传时使用服务器时区",
+				},
+			},
+		},
+		Handler: handleGetTime,
+	})
+}
+
+// handleGetTime 返回当前日期、时间和星期
+func handleGetTime(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	now := time.Now()
+	if name, ok := args["timezone"].(string); ok && name != "" {
+		location, err := time.LoadLocation(name)
+		if err != nil {
+			return types.ActionResponse{Action: types.ActionTypeReqLLM, Result: fmt.Sprintf("未知时区: %s", name)}, err
+		}
+		now = now.In(location)
+	}
+	result := fmt.Sprintf("当前时间是 %s，今天是%s。", now.Format("2006-01-02 15:04:05"), weekdayNames[now.Weekday()])
+	return types.ActionResponse{Action: types.ActionTypeReqLLM, Result: result}, nil
+}
@@ -0,0 +1,60 @@
+package function
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"ai-server-go/src/core/providers/weather"
+	"ai-server-go/src/core/types"
+)
+
+// WeatherToolName 天气工具名称
+const WeatherToolName = "get_weather"
+
+// NewWeatherTool 创建天气工具：provider为连接解析出的天气提供者，defaultCity在用户未说明城市时使用，
+// fallback为天气服务失败时直接播报的提示语
+func NewWeatherTool(provider weather.Provider, defaultCity, fallback string) Tool {
+	description := "查询指定城市当前天气时调用"
+	if defaultCity != "" {
+		description = fmt.Sprintf("查询城市当前天气时调用，用户没有说明城市时查询%s", defaultCity)
+	}
+	return Tool{
+		Name:        WeatherToolName,
+		Description: description,
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"city": map[string]interface{}{
+					"type":        "string",
+					"description": "城市名称，如北京、上海",
+				},
+			},
+		},
+		Handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+			return handleGetWeather(ctx, provider, defaultCity, fallback, args)
+		},
+	}
+}
+
+// handleGetWeather 查询城市当前天气，结果交给LLM组织回复；天气服务失败时直接播报提示语
+func handleGetWeather(ctx context.Context, provider weather.Provider, defaultCity, fallback string, args map[string]interface{}) (interface{}, error) {
+	city, _ := args["city"].(string)
+	city = strings.TrimSpace(city)
+	if city == "" {
+		city = defaultCity
+	}
+	if city == "" {
+		return types.ActionResponse{Action: types.ActionTypeReqLLM, Result: "请告诉我要查询哪个城市的天气"}, nil
+	}
+
+	report, err := provider.Current(ctx, city)
+	if err != nil {
+		err = fmt.Errorf("查询%s天气失败: %v", city, err)
+		if fallback == "" {
+			return types.ActionResponse{Action: types.ActionTypeReqLLM, Result: "天气服务暂时不可用"}, err
+		}
+		return types.ActionResponse{Action: types.ActionTypeResponse, Response: fallback}, err
+	}
+	return types.ActionResponse{Action: types.ActionTypeReqLLM, Result: report.String()}, nil
+}
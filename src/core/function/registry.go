@@ -1,22 +1,32 @@
 package function
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"sync"
+
+	"ai-server-go/src/core/types"
 
 	"github.com/sashabaranov/go-openai"
 )
 
 type FunctionRegistry struct {
+	mu        sync.RWMutex
 	functions map[string]openai.Tool
+	handlers  map[string]ToolHandler
 }
 
 func NewFunctionRegistry() *FunctionRegistry {
 	return &FunctionRegistry{
 		functions: make(map[string]openai.Tool),
+		handlers:  make(map[string]ToolHandler),
 	}
 }
 
 func (fr *FunctionRegistry) RegisterFunction(name string, function openai.Tool) error {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
 	if _, exists := fr.functions[name]; exists {
 		return fmt.Errorf("function already registered: %s", name)
 	}
@@ -24,33 +34,97 @@ func (fr *FunctionRegistry) RegisterFunction(name string, function openai.Tool)
 	return nil
 }
 
+// RegisterTool 注册带处理函数的工具，工具定义由名称、描述和参数schema生成
+func (fr *FunctionRegistry) RegisterTool(tool Tool) error {
+	if tool.Name == "" || tool.Handler == nil {
+		return fmt.Errorf("工具名称和处理函数不能为空")
+	}
+	if err := fr.RegisterFunction(tool.Name, tool.Definition()); err != nil {
+		return err
+	}
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	fr.handlers[tool.Name] = tool.Handler
+	return nil
+}
+
 func (fr *FunctionRegistry) GetFunction(name string) (openai.Tool, error) {
+	fr.mu.RLock()
+	defer fr.mu.RUnlock()
 	if function, exists := fr.functions[name]; exists {
 		return function, nil
 	}
 	return openai.Tool{}, fmt.Errorf("function not found: %s", name)
 }
 
+// GetAllFunctions 获取所有已注册的工具定义（按名称排序）
 func (fr *FunctionRegistry) GetAllFunctions() []openai.Tool {
-	functions := make([]openai.Tool, 0, len(fr.functions))
-	for _, function := range fr.functions {
-		functions = append(functions, function)
+	return fr.SessionTools(ToolFilter{})
+}
+
+// SessionTools 获取经过过滤的工具定义（按名称排序），即本轮对话提供给模型的工具目录
+func (fr *FunctionRegistry) SessionTools(filter ToolFilter) []openai.Tool {
+	fr.mu.RLock()
+	defer fr.mu.RUnlock()
+	names := make([]string, 0, len(fr.functions))
+	for name := range fr.functions {
+		if filter.Allowed(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	functions := make([]openai.Tool, 0, len(names))
+	for _, name := range names {
+		functions = append(functions, fr.functions[name])
 	}
 	return functions
 }
 
+// ResponseWithTools 组装过滤后的工具目录并调用LLM
+func (fr *FunctionRegistry) ResponseWithTools(ctx context.Context, llm types.LLMProvider, sessionID string, messages []types.Message, filter ToolFilter) (<-chan types.Response, error) {
+	return llm.ResponseWithFunctions(ctx, sessionID, messages, fr.SessionTools(filter))
+}
+
+// HasHandler 检查工具是否由注册表直接处理（内置工具）
+func (fr *FunctionRegistry) HasHandler(name string) bool {
+	fr.mu.RLock()
+	defer fr.mu.RUnlock()
+	_, exists := fr.handlers[name]
+	return exists
+}
+
+// CallFunction 调用已注册工具的处理函数
+func (fr *FunctionRegistry) CallFunction(ctx context.Context, name string, args map[string]interface{}) (interface{}, error) {
+	fr.mu.RLock()
+	handler, exists := fr.handlers[name]
+	fr.mu.RUnlock()
+	if !exists {
+		return types.ActionResponse{Action: types.ActionTypeNotFound, Result: name}, fmt.Errorf("function not found: %s", name)
+	}
+	return handler(ctx, args)
+}
+
 func (fr *FunctionRegistry) UnregisterAllFunctions() error {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
 	// Unregister all functions
 	for name := range fr.functions {
 		delete(fr.functions, name)
 	}
+	for name := range fr.handlers {
+		delete(fr.handlers, name)
+	}
 	return nil
 }
 
 func (fr *FunctionRegistry) UnregisterFunction(name string) error {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
 	// Unregister a specific function
 	if _, exists := fr.functions[name]; exists {
 		delete(fr.functions, name)
+		delete(fr.handlers, name)
 	} else {
 		return fmt.Errorf("function not found: %s", name)
 	}
@@ -58,6 +132,8 @@ func (fr *FunctionRegistry) UnregisterFunction(name string) error {
 }
 
 func (fr *FunctionRegistry) FunctionExists(name string) bool {
+	fr.mu.RLock()
+	defer fr.mu.RUnlock()
 	_, exists := fr.functions[name]
 	return exists
 }
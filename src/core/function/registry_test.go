@@ -0,0 +1,135 @@
+package function
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"ai-server-go/src/core/types"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// captureLLM 记录ResponseWithFunctions收到的工具列表
+type captureLLM struct {
+	tools []openai.Tool
+}
+
+func (p *captureLLM) Initialize() error { return nil }
+func (p *captureLLM) Cleanup() error    { return nil }
+
+func (p *captureLLM) Response(ctx context.Context, sessionID string, messages []types.Message) (<-chan string, error) {
+	ch := make(chan string)
+	close(ch)
+	return ch, nil
+}
+
+func (p *captureLLM) ResponseWithFunctions(ctx context.Context, sessionID string, messages []types.Message, tools []openai.Tool) (<-chan types.Response, error) {
+	p.tools = tools
+	ch := make(chan types.Response)
+	close(ch)
+	return ch, nil
+}
+
+func newTestTool(name string) Tool {
+	return Tool{
+		Name:        name,
+		Description: "测试工具",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"query": map[string]interface{}{"type": "string"},
+			},
+			"required": []string{"query"},
+		},
+		Handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+			return args["query"], nil
+		},
+	}
+}
+
+func TestRegisteredToolSchemaReachesProvider(t *testing.T) {
+	registry := NewFunctionRegistry()
+	tool := newTestTool("lookup")
+	if err := registry.RegisterTool(tool); err != nil {
+		t.Fatalf("RegisterTool() error = %v", err)
+	}
+
+	llm := &captureLLM{}
+	if _, err := registry.ResponseWithTools(context.Background(), llm, "session", nil, ToolFilter{}); err != nil {
+		t.Fatalf("ResponseWithTools() error = %v", err)
+	}
+
+	if len(llm.tools) != 1 {
+		t.Fatalf("provider收到 %d 个工具, want 1", len(llm.tools))
+	}
+	got := llm.tools[0]
+	if got.Type != openai.ToolTypeFunction || got.Function == nil || got.Function.Name != "lookup" {
+		t.Fatalf("provider收到的工具 = %+v", got)
+	}
+	gotSchema, _ := json.Marshal(got.Function.Parameters)
+	wantSchema, _ := json.Marshal(tool.Parameters)
+	if string(gotSchema) != string(wantSchema) {
+		t.Errorf("工具schema = %s, want %s", gotSchema, wantSchema)
+	}
+}
+
+func TestResponseWithToolsAppliesFilter(t *testing.T) {
+	registry := NewFunctionRegistry()
+	for _, name := range []string{"a", "b", "c"} {
+		if err := registry.RegisterTool(newTestTool(name)); err != nil {
+			t.Fatalf("RegisterTool() error = %v", err)
+		}
+	}
+	// MCP工具只注册定义，同样参与过滤
+	if err := registry.RegisterFunction("mcp_tool", newTestTool("mcp_tool").Definition()); err != nil {
+		t.Fatalf("RegisterFunction() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		filter ToolFilter
+		want   []string
+	}{
+		{name: "不过滤", filter: ToolFilter{}, want: []string{"a", "b", "c", "mcp_tool"}},
+		{name: "白名单", filter: ToolFilter{Allow: []string{"c", "mcp_tool"}}, want: []string{"c", "mcp_tool"}},
+		{name: "黑名单", filter: ToolFilter{Deny: []string{"b"}}, want: []string{"a", "c", "mcp_tool"}},
+		{name: "黑名单优先", filter: ToolFilter{Allow: []string{"a", "b"}, Deny: []string{"b"}}, want: []string{"a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llm := &captureLLM{}
+			if _, err := registry.ResponseWithTools(context.Background(), llm, "session", nil, tt.filter); err != nil {
+				t.Fatalf("ResponseWithTools() error = %v", err)
+			}
+			if len(llm.tools) != len(tt.want) {
+				t.Fatalf("provider收到 %d 个工具, want %v", len(llm.tools), tt.want)
+			}
+			for i, name := range tt.want {
+				if llm.tools[i].Function.Name != name {
+					t.Errorf("第%d个工具 = %s, want %s", i, llm.tools[i].Function.Name, name)
+				}
+			}
+		})
+	}
+}
+
+func TestCallFunction(t *testing.T) {
+	registry := NewFunctionRegistry()
+	if err := registry.RegisterTool(newTestTool("lookup")); err != nil {
+		t.Fatalf("RegisterTool() error = %v", err)
+	}
+
+	result, err := registry.CallFunction(context.Background(), "lookup", map[string]interface{}{"query": "天气"})
+	if err != nil {
+		t.Fatalf("CallFunction() error = %v", err)
+	}
+	if result != "天气" {
+		t.Errorf("CallFunction() = %v, want 天气", result)
+	}
+
+	if _, err := registry.CallFunction(context.Background(), "missing", nil); err == nil {
+		t.Error("CallFunction() 未注册的工具应返回错误")
+	}
+}
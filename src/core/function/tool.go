@@ -0,0 +1,86 @@
+package function
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ToolHandler 工具处理函数，返回 types.ActionResponse 或普通结果
+type ToolHandler func(ctx context.Context, args map[string]interface{}) (interface{}, error)
+
+// Tool 内置工具定义：名称、描述、参数schema和处理函数
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  map[string]interface{} // JSON Schema，为空时视为无参数
+	Handler     ToolHandler
+}
+
+// Definition 转换为提供给LLM的工具定义
+func (t Tool) Definition() openai.Tool {
+	parameters := t.Parameters
+	if parameters == nil {
+		parameters = map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{},
+		}
+	}
+	return openai.Tool{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        t.Name,
+			Description: t.Description,
+			Parameters:  parameters,
+		},
+	}
+}
+
+// ToolFilter 工具过滤规则：Allow 不为空时只保留列出的工具，Deny 中的工具总是排除
+type ToolFilter struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// Allowed 检查工具是否通过过滤
+func (f ToolFilter) Allowed(name string) bool {
+	for _, denied := range f.Deny {
+		if denied == name {
+			return false
+		}
+	}
+	if len(f.Allow) == 0 {
+		return true
+	}
+	for _, allowed := range f.Allow {
+		if allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	builtinMu sync.RWMutex
+	builtins  []Tool
+)
+
+// RegisterBuiltin 注册内置工具，每个会话的注册表创建时都会加载
+func RegisterBuiltin(tool Tool) {
+	builtinMu.Lock()
+	defer builtinMu.Unlock()
+	builtins = append(builtins, tool)
+}
+
+// RegisterBuiltins 将所有内置工具注册到会话注册表
+func RegisterBuiltins(fr *FunctionRegistry) error {
+	builtinMu.RLock()
+	defer builtinMu.RUnlock()
+	for _, tool := range builtins {
+		if err := fr.RegisterTool(tool); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package image
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -139,6 +140,18 @@ func (p *ImageProcessor) ProcessImage(ctx context.Context, imageData ImageData)
 		return "", fmt.Errorf("图片验证失败: %v", validationResult.Error)
 	}
 
+	// 内容审核（由调用方通过context附带，未附带时跳过）
+	if screener := screenerFrom(ctx); screener != nil {
+		screened, err := screener.Screen(ctx, finalImageData)
+		if err != nil {
+			if errors.Is(err, ErrImageRejected) {
+				atomic.AddInt64(&p.metrics.SecurityIncidents, 1)
+			}
+			return "", fmt.Errorf("图片审核未通过: %w", err)
+		}
+		finalImageData = screened
+	}
+
 	p.logger.Debug("图片处理完成 %v", map[string]interface{}{
 		"format":    validationResult.Format,
 		"width":     validationResult.Width,
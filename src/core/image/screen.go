@@ -0,0 +1,31 @@
+package image
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrImageRejected 图片未通过内容审核
+var ErrImageRejected = errors.New("图片未通过内容审核")
+
+// Screener 图片内容审核钩子：在安全验证通过后调用，可返回 ErrImageRejected 拒绝图片，
+// 或返回处理后（如马赛克）的图片数据继续发送给视觉模型
+type Screener interface {
+	Screen(ctx context.Context, imageData ImageData) (ImageData, error)
+}
+
+type screenerKey struct{}
+
+// WithScreener 在context中附带本次请求使用的图片审核钩子（审核配置按设备/用户区分）
+func WithScreener(ctx context.Context, screener Screener) context.Context {
+	if screener == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, screenerKey{}, screener)
+}
+
+// screenerFrom 获取context中的图片审核钩子
+func screenerFrom(ctx context.Context) Screener {
+	screener, _ := ctx.Value(screenerKey{}).(Screener)
+	return screener
+}
@@ -0,0 +1,195 @@
+package llmcache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ai-server-go/src/core/utils"
+)
+
+/*
+* LLM回复缓存：FAQ类设备上相同的问题直接返回缓存的回复，不再调用LLM。
+* 缓存键为（归一化后的完整对话 + 模型 + 温度等参数）的SHA256；按TTL过期，超过容量时淘汰最久未使用的条目。
+* 用户问题命中绕过规则（时间、天气等易变内容）或注入了记忆时不使用缓存。
+ */
+
+// Config LLM回复缓存配置
+type Config struct {
+	Enabled        bool     `json:"enabled"`         // 是否启用（默认关闭，按设备开启）
+	TTLSeconds     int      `json:"ttl_seconds"`     // 缓存有效期（秒）
+	MaxEntries     int      `json:"max_entries"`     // 最大缓存条数（进程内共享，取首次使用时的配置）
+	BypassPatterns []string `json:"bypass_patterns"` // 用户问题匹配任一正则时不使用缓存
+}
+
+// DefaultConfig 默认LLM回复缓存配置
+func DefaultConfig() Config {
+	return Config{
+		Enabled:        false,
+		TTLSeconds:     3600,
+		MaxEntries:     1000,
+		BypassPatterns: []string{"几点|时间|今天|明天|昨天|几号|日期|星期|周几|天气|气温|最新|新闻|记得|上次|刚才"},
+	}
+}
+
+// ApplyMap 使用配置map覆盖缓存配置
+func (c *Config) ApplyMap(config map[string]interface{}) {
+	if config == nil {
+		return
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, c)
+}
+
+// TTL 缓存有效期
+func (c Config) TTL() time.Duration {
+	if c.TTLSeconds <= 0 {
+		return time.Duration(DefaultConfig().TTLSeconds) * time.Second
+	}
+	return time.Duration(c.TTLSeconds) * time.Second
+}
+
+// CompileBypass 编译绕过规则，无效的正则通过invalid返回
+func (c Config) CompileBypass() (patterns []*regexp.Regexp, invalid []string) {
+	for _, pattern := range c.BypassPatterns {
+		if strings.TrimSpace(pattern) == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			invalid = append(invalid, pattern)
+			continue
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns, invalid
+}
+
+// Normalize 归一化文本：去掉标点和空白并转为小写，使仅标点或大小写不同的问题命中同一缓存
+func Normalize(text string) string {
+	text = utils.RemoveAllPunctuation(text)
+	return strings.ToLower(strings.Join(strings.Fields(text), ""))
+}
+
+// Key 由各组成部分计算缓存键
+func Key(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Entry 缓存的回复
+type Entry struct {
+	Content  string   `json:"content"`  // 完整回复
+	Segments []string `json:"segments"` // 按播放顺序的分段，命中时逐段合成语音
+}
+
+// Stats 缓存统计
+type Stats struct {
+	Hits     int64 `json:"hits"`     // 命中次数
+	Misses   int64 `json:"misses"`   // 未命中次数
+	Bypassed int64 `json:"bypassed"` // 因绕过规则或记忆未使用缓存的次数
+	Stores   int64 `json:"stores"`   // 写入次数
+	Entries  int   `json:"entries"`  // 当前条数
+}
+
+// cacheItem 缓存条目
+type cacheItem struct {
+	key       string
+	entry     Entry
+	expiresAt time.Time
+}
+
+// Cache 进程内LRU缓存
+type Cache struct {
+	mu         sync.Mutex
+	maxEntries int
+	items      map[string]*list.Element
+	order      *list.List // 队首为最近使用
+
+	hits     int64
+	misses   int64
+	bypassed int64
+	stores   int64
+}
+
+// New 创建缓存，maxEntries<=0时使用默认容量
+func New(maxEntries int) *Cache {
+	if maxEntries <= 0 {
+		maxEntries = DefaultConfig().MaxEntries
+	}
+	return &Cache{
+		maxEntries: maxEntries,
+		items:      make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// Get 查询未过期的缓存并计入命中/未命中统计
+func (c *Cache) Get(key string) (Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.items[key]
+	if ok {
+		item := element.Value.(*cacheItem)
+		if time.Now().Before(item.expiresAt) {
+			c.order.MoveToFront(element)
+			atomic.AddInt64(&c.hits, 1)
+			return item.entry, true
+		}
+		c.order.Remove(element)
+		delete(c.items, key)
+	}
+	atomic.AddInt64(&c.misses, 1)
+	return Entry{}, false
+}
+
+// Set 写入缓存，超过容量时淘汰最久未使用的条目
+func (c *Cache) Set(key string, entry Entry, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	atomic.AddInt64(&c.stores, 1)
+	expiresAt := time.Now().Add(ttl)
+	if element, ok := c.items[key]; ok {
+		item := element.Value.(*cacheItem)
+		item.entry = entry
+		item.expiresAt = expiresAt
+		c.order.MoveToFront(element)
+		return
+	}
+	c.items[key] = c.order.PushFront(&cacheItem{key: key, entry: entry, expiresAt: expiresAt})
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheItem).key)
+	}
+}
+
+// RecordBypass 记录一次因绕过规则未使用缓存
+func (c *Cache) RecordBypass() {
+	atomic.AddInt64(&c.bypassed, 1)
+}
+
+// Stats 获取缓存统计
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	entries := c.order.Len()
+	c.mu.Unlock()
+	return Stats{
+		Hits:     atomic.LoadInt64(&c.hits),
+		Misses:   atomic.LoadInt64(&c.misses),
+		Bypassed: atomic.LoadInt64(&c.bypassed),
+		Stores:   atomic.LoadInt64(&c.stores),
+		Entries:  entries,
+	}
+}
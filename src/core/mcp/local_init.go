@@ -2,5 +2,4 @@ package mcp
 
 func (c *LocalClient) RegisterTools() {
 	c.AddToolExit()
-	c.AddToolTime()
 }
@@ -0,0 +1,278 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+	"strings"
+	"time"
+
+	"ai-server-go/src/database"
+
+	_ "image/gif" // 注册GIF解码器
+	_ "image/png" // 注册PNG解码器
+
+	_ "golang.org/x/image/webp" // 注册WEBP解码器
+)
+
+/*
+* 图片内容审核：设备摄像头图片发送给视觉模型（以及保存）之前的安全筛查，默认关闭。
+* rules 按图片SHA256黑名单判定，http 调用外部分类服务评分；超过阈值时按 action 拒绝(reject)或马赛克处理(blur)。
+* 审核服务失败时记录日志并放行，严格模式(strict)下视为拒绝。
+ */
+
+// 图片审核超过阈值后的处理方式
+const (
+	ImageActionAllow  = "allow"  // 放行
+	ImageActionReject = "reject" // 拒绝图片
+	ImageActionBlur   = "blur"   // 马赛克处理后继续
+)
+
+// ImageConfig 图片内容审核配置
+type ImageConfig struct {
+	Enabled         bool     `json:"enabled"`          // 是否启用图片审核（默认关闭）
+	Provider        string   `json:"provider"`         // 审核提供者: rules, http
+	Threshold       float64  `json:"threshold"`        // 判定阈值（0-1）
+	Action          string   `json:"action"`           // 超过阈值时的处理: reject, blur
+	Strict          bool     `json:"strict"`           // 严格模式：审核服务失败时视为拒绝
+	RejectedMessage string   `json:"rejected_message"` // 拒绝后播报的提示语
+	BlockedHashes   []string `json:"blocked_hashes"`   // rules审核使用的图片SHA256黑名单
+	Endpoint        string   `json:"endpoint"`         // http分类服务地址
+	APIKey          string   `json:"api_key"`          // http分类服务的API Key
+	TimeoutMs       int      `json:"timeout_ms"`       // http分类服务超时（毫秒）
+}
+
+// DefaultImageConfig 默认图片审核配置
+func DefaultImageConfig() ImageConfig {
+	return ImageConfig{
+		Enabled:         false,
+		Provider:        "rules",
+		Threshold:       0.8,
+		Action:          ImageActionReject,
+		Strict:          false,
+		RejectedMessage: "抱歉，这张图片不适合分析，请换一张试试",
+		TimeoutMs:       3000,
+	}
+}
+
+// ApplyMap 使用配置map覆盖图片审核配置
+func (c *ImageConfig) ApplyMap(config map[string]interface{}) {
+	if config == nil {
+		return
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, c)
+}
+
+// LoadImageConfig 加载图片审核配置：系统配置 image_moderation 分类 < 用户/设备的 image_moderation 能力配置
+func LoadImageConfig(configService *database.ConfigService, deviceID uint, userID *uint) ImageConfig {
+	config := DefaultImageConfig()
+	if configService == nil {
+		return config
+	}
+	if systemConfig, err := configService.GetSystemConfigCategory("image_moderation"); err == nil {
+		config.ApplyMap(systemConfig)
+	}
+	if deviceID != 0 {
+		deviceConfig, err := configService.GetDeviceCapabilityConfigWithFallback(deviceID, userID)
+		if err == nil && deviceConfig != nil {
+			for _, capability := range deviceConfig.Capabilities {
+				if capability.CapabilityName == "image_moderation" {
+					config.ApplyMap(capability.Config)
+				}
+			}
+		}
+	}
+	return config
+}
+
+// ImageModerator 图片内容审核接口
+type ImageModerator interface {
+	ModerateImage(ctx context.Context, data []byte, format string) (*Result, error)
+}
+
+// NewImageModerator 根据配置创建图片审核器
+func NewImageModerator(config ImageConfig) (ImageModerator, error) {
+	switch strings.ToLower(config.Provider) {
+	case "", "rules":
+		hashes := make(map[string]bool, len(config.BlockedHashes))
+		for _, hash := range config.BlockedHashes {
+			if hash = strings.ToLower(strings.TrimSpace(hash)); hash != "" {
+				hashes[hash] = true
+			}
+		}
+		return &HashImageModerator{blocked: hashes}, nil
+	case "http":
+		if config.Endpoint == "" {
+			return nil, fmt.Errorf("http图片审核需要配置endpoint")
+		}
+		timeout := time.Duration(config.TimeoutMs) * time.Millisecond
+		if timeout <= 0 {
+			timeout = 3 * time.Second
+		}
+		return &HTTPImageModerator{
+			endpoint: config.Endpoint,
+			apiKey:   config.APIKey,
+			client:   &http.Client{Timeout: timeout},
+		}, nil
+	default:
+		return nil, fmt.Errorf("不支持的图片审核提供者: %s", config.Provider)
+	}
+}
+
+// ImageDecision 图片审核结论
+type ImageDecision struct {
+	Action string  // allow, reject, blur
+	Result *Result // 审核结果，审核失败且放行时为nil
+	Data   []byte  // blur时为处理后的图片数据
+	Format string  // blur时为处理后的图片格式
+}
+
+// CheckImage 执行图片审核并根据阈值、处理方式和严格模式给出结论
+// 审核服务失败时默认放行（fail open），严格模式下拒绝；马赛克处理失败时拒绝
+func CheckImage(ctx context.Context, moderator ImageModerator, config ImageConfig, data []byte, format string) (*ImageDecision, error) {
+	result, err := moderator.ModerateImage(ctx, data, format)
+	if err != nil {
+		if config.Strict {
+			return &ImageDecision{
+				Action: ImageActionReject,
+				Result: &Result{Score: 1, Flags: []string{"moderation_error"}, Blocked: true},
+			}, err
+		}
+		return &ImageDecision{Action: ImageActionAllow}, err
+	}
+
+	if result.Score < config.Threshold {
+		return &ImageDecision{Action: ImageActionAllow, Result: result}, nil
+	}
+	result.Blocked = true
+	if config.Action == ImageActionBlur {
+		blurred, err := Pixelate(data)
+		if err != nil {
+			return &ImageDecision{Action: ImageActionReject, Result: result}, fmt.Errorf("图片马赛克处理失败: %v", err)
+		}
+		return &ImageDecision{Action: ImageActionBlur, Result: result, Data: blurred, Format: "jpeg"}, nil
+	}
+	return &ImageDecision{Action: ImageActionReject, Result: result}, nil
+}
+
+// Pixelate 对图片做马赛克处理（按约16x16的色块取平均色），输出JPEG
+func Pixelate(data []byte) ([]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("解码图片失败: %v", err)
+	}
+	bounds := src.Bounds()
+	block := bounds.Dx()
+	if bounds.Dy() > block {
+		block = bounds.Dy()
+	}
+	block /= 16
+	if block < 1 {
+		block = 1
+	}
+
+	dst := image.NewRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += block {
+		for x := bounds.Min.X; x < bounds.Max.X; x += block {
+			cell := image.Rect(x, y, x+block, y+block).Intersect(bounds)
+			var r, g, b, count uint64
+			for py := cell.Min.Y; py < cell.Max.Y; py++ {
+				for px := cell.Min.X; px < cell.Max.X; px++ {
+					cr, cg, cb, _ := src.At(px, py).RGBA()
+					r, g, b = r+uint64(cr), g+uint64(cg), b+uint64(cb)
+					count++
+				}
+			}
+			avg := color.RGBA64{R: uint16(r / count), G: uint16(g / count), B: uint16(b / count), A: 0xffff}
+			for py := cell.Min.Y; py < cell.Max.Y; py++ {
+				for px := cell.Min.X; px < cell.Max.X; px++ {
+					dst.Set(px, py, avg)
+				}
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, dst, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, fmt.Errorf("编码图片失败: %v", err)
+	}
+	return out.Bytes(), nil
+}
+
+// HashImageModerator 基于图片SHA256黑名单的审核器
+type HashImageModerator struct {
+	blocked map[string]bool
+}
+
+// ModerateImage 命中黑名单评分为1
+func (m *HashImageModerator) ModerateImage(ctx context.Context, data []byte, format string) (*Result, error) {
+	result := &Result{Flags: []string{}}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	if m.blocked[hash] {
+		result.Score = 1
+		result.Flags = append(result.Flags, "blocked_hash:"+hash)
+	}
+	return result, nil
+}
+
+// HTTPImageModerator 调用外部图片分类服务的审核器
+// 请求: POST {"image": base64, "format": "jpeg"}；响应: {"score": 0.95, "labels": ["nsfw"]}
+type HTTPImageModerator struct {
+	endpoint string
+	apiKey   string
+	client   *http.Client
+}
+
+// ModerateImage 调用分类服务获取风险评分
+func (m *HTTPImageModerator) ModerateImage(ctx context.Context, data []byte, format string) (*Result, error) {
+	body, err := json.Marshal(map[string]string{
+		"image":  base64.StdEncoding.EncodeToString(data),
+		"format": format,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("构造图片审核请求失败: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("构造图片审核请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+m.apiKey)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("调用图片审核服务失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("图片审核服务返回状态码: %d", resp.StatusCode)
+	}
+
+	var classification struct {
+		Score  float64  `json:"score"`
+		Labels []string `json:"labels"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&classification); err != nil {
+		return nil, fmt.Errorf("解析图片审核结果失败: %v", err)
+	}
+	result := &Result{Score: classification.Score, Flags: classification.Labels}
+	if result.Flags == nil {
+		result.Flags = []string{}
+	}
+	return result, nil
+}
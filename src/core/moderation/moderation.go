@@ -0,0 +1,155 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Config 内容审核配置
+type Config struct {
+	Enabled        bool     `json:"enabled"`         // 是否启用审核（默认关闭）
+	Provider       string   `json:"provider"`        // 审核提供者: rules, openai
+	Threshold      float64  `json:"threshold"`       // 拦截阈值（0-1）
+	Block          bool     `json:"block"`           // 超过阈值时是否拦截下发
+	Strict         bool     `json:"strict"`          // 严格模式：审核服务失败时视为拦截
+	BlockedMessage string   `json:"blocked_message"` // 拦截后播报的提示语
+	Keywords       []string `json:"keywords"`        // rules审核使用的敏感词
+	APIKey         string   `json:"api_key"`         // openai审核的API Key
+	BaseURL        string   `json:"base_url"`        // openai审核的服务地址
+	Model          string   `json:"model"`           // openai审核模型
+}
+
+// DefaultConfig 默认审核配置
+func DefaultConfig() Config {
+	return Config{
+		Enabled:        false,
+		Provider:       "rules",
+		Threshold:      0.8,
+		Block:          false,
+		Strict:         false,
+		BlockedMessage: "抱歉，这个问题我不方便回答，我们聊点别的吧",
+	}
+}
+
+// ApplyMap 使用配置map覆盖审核配置
+func (c *Config) ApplyMap(config map[string]interface{}) {
+	if config == nil {
+		return
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, c)
+}
+
+// Result 审核结果
+type Result struct {
+	Score   float64  `json:"score"`   // 风险评分（0-1）
+	Flags   []string `json:"flags"`   // 命中的类别或敏感词
+	Blocked bool     `json:"blocked"` // 是否被拦截
+}
+
+// Moderator 内容审核接口
+type Moderator interface {
+	Moderate(ctx context.Context, text string) (*Result, error)
+}
+
+// New 根据配置创建审核器
+func New(config Config) (Moderator, error) {
+	switch strings.ToLower(config.Provider) {
+	case "", "rules":
+		return &RuleModerator{keywords: config.Keywords}, nil
+	case "openai":
+		if config.APIKey == "" {
+			return nil, fmt.Errorf("openai审核需要配置api_key")
+		}
+		clientConfig := openai.DefaultConfig(config.APIKey)
+		if config.BaseURL != "" {
+			clientConfig.BaseURL = config.BaseURL
+		}
+		return &OpenAIModerator{
+			client: openai.NewClientWithConfig(clientConfig),
+			model:  config.Model,
+		}, nil
+	default:
+		return nil, fmt.Errorf("不支持的审核提供者: %s", config.Provider)
+	}
+}
+
+// Check 执行审核并根据阈值/严格模式判定是否拦截
+// 审核服务失败时默认放行（fail open），严格模式下拦截
+func Check(ctx context.Context, moderator Moderator, config Config, text string) (*Result, error) {
+	result, err := moderator.Moderate(ctx, text)
+	if err != nil {
+		if config.Strict {
+			return &Result{Score: 1, Flags: []string{"moderation_error"}, Blocked: true}, err
+		}
+		return nil, err
+	}
+	result.Blocked = config.Block && result.Score >= config.Threshold
+	return result, nil
+}
+
+// RuleModerator 基于敏感词规则的审核器
+type RuleModerator struct {
+	keywords []string
+}
+
+// Moderate 命中任一敏感词评分为1
+func (m *RuleModerator) Moderate(ctx context.Context, text string) (*Result, error) {
+	result := &Result{Flags: []string{}}
+	lower := strings.ToLower(text)
+	for _, keyword := range m.keywords {
+		if keyword != "" && strings.Contains(lower, strings.ToLower(keyword)) {
+			result.Flags = append(result.Flags, keyword)
+		}
+	}
+	if len(result.Flags) > 0 {
+		result.Score = 1
+	}
+	return result, nil
+}
+
+// OpenAIModerator 基于OpenAI Moderation API的审核器
+type OpenAIModerator struct {
+	client *openai.Client
+	model  string
+}
+
+// Moderate 调用审核接口，评分取各类别的最高分
+func (m *OpenAIModerator) Moderate(ctx context.Context, text string) (*Result, error) {
+	resp, err := m.client.Moderations(ctx, openai.ModerationRequest{
+		Input: text,
+		Model: m.model,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("调用审核服务失败: %v", err)
+	}
+
+	result := &Result{Flags: []string{}}
+	for _, r := range resp.Results {
+		// 通过JSON将类别评分转为map，便于统一处理
+		data, err := json.Marshal(r.CategoryScores)
+		if err != nil {
+			continue
+		}
+		var scores map[string]float64
+		if err := json.Unmarshal(data, &scores); err != nil {
+			continue
+		}
+		for category, score := range scores {
+			if score > result.Score {
+				result.Score = score
+			}
+			if score >= 0.5 {
+				result.Flags = append(result.Flags, category)
+			}
+		}
+	}
+	return result, nil
+}
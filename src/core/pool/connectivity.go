@@ -380,7 +380,7 @@ func (hc *HealthChecker) checkTTSProvider(ctx context.Context, ttsType string, m
 
 		// 执行实际的TTS测试
 		testText := hc.testGenerator.GetTestTTSText()
-		audioPath, err := ttsProvider.ToTTS(testText)
+		audioPath, err := ttsProvider.ToTTS(context.Background(), testText)
 		if err != nil {
 			result.Success = false
 			result.Error = fmt.Errorf("TTS合成测试失败: %v", err)
@@ -0,0 +1,64 @@
+package pool
+
+import (
+	"ai-server-go/src/core/utils"
+	"ai-server-go/src/database"
+	"fmt"
+	"strings"
+)
+
+// requiredCategories 对话必需的提供者类别（VLLLM可选，缺少时回退到普通LLM）
+var requiredCategories = []string{"ASR", "LLM", "TTS"}
+
+// 缺少默认提供者时的处理方式（配置 providers.default_fallback）
+const (
+	DefaultFallbackFail = "fail" // 启动失败，列出缺少默认值的类别
+	DefaultFallbackAuto = "auto" // 自动选用该类别权重最高的启用provider
+)
+
+// resolveDefaultModules 检查必需类别是否都有默认提供者，缺少时按fallback处理：
+// auto 模式选用权重最高的启用provider，fail 模式（默认）返回说明缺少哪些类别的错误
+func resolveDefaultModules(defaultModules map[string]string, fallback string, configService *database.ConfigService, logger *utils.Logger) (map[string]string, error) {
+	modules := make(map[string]string, len(defaultModules))
+	for category, name := range defaultModules {
+		modules[category] = name
+	}
+
+	var missing []string
+	for _, category := range requiredCategories {
+		if modules[category] == "" {
+			missing = append(missing, category)
+		}
+	}
+	if len(missing) == 0 {
+		return modules, nil
+	}
+	logger.Warn("以下类别没有默认Provider（is_default=true 且已启用）: %s", strings.Join(missing, ", "))
+
+	if fallback != DefaultFallbackAuto {
+		return nil, fmt.Errorf("缺少默认Provider: %s；请为这些类别的一个启用配置设置 is_default=true（PUT /api/configs/provider/:category/:name），"+
+			"或在配置文件中设置 providers.default_fallback: auto 自动选用权重最高的Provider", strings.Join(missing, ", "))
+	}
+
+	var unresolved []string
+	for _, category := range missing {
+		var provider *database.ProviderConfig
+		var err error
+		if configService != nil {
+			provider, err = configService.GetHighestWeightProvider(category)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if provider == nil {
+			unresolved = append(unresolved, category)
+			continue
+		}
+		modules[category] = provider.Name
+		logger.Warn("类别 %s 没有默认Provider，自动选用权重最高的 %s（权重 %d）", category, provider.Name, provider.Weight)
+	}
+	if len(unresolved) > 0 {
+		return nil, fmt.Errorf("缺少默认Provider且没有可自动选用的启用配置: %s；请先为这些类别创建并启用Provider配置", strings.Join(unresolved, ", "))
+	}
+	return modules, nil
+}
@@ -0,0 +1,135 @@
+package pool
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+/*
+* 手动驱逐provider实例：provider异常（连接卡死、密钥轮换后仍使用旧凭证的客户端）时，管理员无需重启即可丢弃池中缓存的实例。
+* 平台资源池用同一工厂重建，旧池关闭时销毁空闲实例（调用 Cleanup）；正在使用的实例不受影响，
+* 会话结束归还到旧池时直接销毁。该provider的租户资源池一并关闭，下次使用时按需重建。
+* 驱逐次数和最近一次驱逐时间记录在资源池状态中。
+ */
+
+// EvictionResult 一次驱逐的结果
+type EvictionResult struct {
+	Category    string `json:"category"`
+	Name        string `json:"name"`
+	Version     string `json:"version"`      // 被重建的平台资源池使用的版本，只驱逐了租户资源池时为空
+	Idle        int    `json:"idle"`         // 立即销毁的空闲实例数
+	TenantPools int    `json:"tenant_pools"` // 关闭的租户资源池数
+}
+
+// evictionStats 某类别资源池的驱逐统计
+type evictionStats struct {
+	count int
+	last  time.Time
+}
+
+// EvictProvider 丢弃指定provider在资源池中的实例，version为空时不限版本；进行中的请求继续使用原实例，归还时销毁
+func (pm *PoolManager) EvictProvider(category, name, version string) (*EvictionResult, error) {
+	category = strings.ToUpper(category)
+	switch category {
+	case "ASR", "LLM", "TTS", "VLLLM":
+	default:
+		return nil, fmt.Errorf("不支持的provider类别: %s", category)
+	}
+
+	pm.evictMu.Lock()
+	defer pm.evictMu.Unlock()
+
+	result := &EvictionResult{Category: category, Name: name}
+	if factory := pm.poolFactory(category); factory != nil && factory.name == name && (version == "" || factory.version == version) {
+		old := pm.platformPool(category)
+		fresh, err := NewResourcePool(old.factory, old.config, pm.logger)
+		if err != nil {
+			return nil, fmt.Errorf("重建 %s/%s 资源池失败，保留原资源池: %v", category, name, err)
+		}
+		idle, _ := old.GetStats()
+		pm.setPlatformPool(category, fresh)
+		old.Close()
+		result.Version = factory.version
+		result.Idle += idle
+	}
+
+	pm.tenantMu.Lock()
+	for key, pool := range pm.tenantPools {
+		if key.Category != category || key.Name != name {
+			continue
+		}
+		if factory, ok := pool.factory.(*ProviderFactory); ok && version != "" && factory.version != version {
+			continue
+		}
+		idle, _ := pool.GetStats()
+		pool.Close()
+		delete(pm.tenantPools, key)
+		result.Idle += idle
+		result.TenantPools++
+	}
+	pm.tenantMu.Unlock()
+
+	if result.Version == "" && result.TenantPools == 0 {
+		if version != "" {
+			return nil, fmt.Errorf("资源池中没有 %s/%s@%s 的实例", category, name, version)
+		}
+		return nil, fmt.Errorf("资源池中没有 %s/%s 的实例", category, name)
+	}
+
+	pm.evictionsMu.Lock()
+	if pm.evictions == nil {
+		pm.evictions = make(map[string]evictionStats)
+	}
+	stats := pm.evictions[category]
+	stats.count++
+	stats.last = time.Now()
+	pm.evictions[category] = stats
+	pm.evictionsMu.Unlock()
+	pm.logger.Info("驱逐 %s/%s 的资源池实例: 版本 %s，销毁空闲实例 %d 个，关闭租户资源池 %d 个，使用中的实例归还时销毁",
+		category, name, result.Version, result.Idle, result.TenantPools)
+	return result, nil
+}
+
+// platformPool 类别对应的平台资源池
+func (pm *PoolManager) platformPool(category string) *ResourcePool {
+	switch category {
+	case "ASR":
+		return pm.asrPool
+	case "LLM":
+		return pm.llmPool
+	case "TTS":
+		return pm.ttsPool
+	case "VLLLM":
+		return pm.vlllmPool
+	}
+	return nil
+}
+
+// setPlatformPool 替换类别对应的平台资源池
+func (pm *PoolManager) setPlatformPool(category string, pool *ResourcePool) {
+	switch category {
+	case "ASR":
+		pm.asrPool = pool
+	case "LLM":
+		pm.llmPool = pool
+	case "TTS":
+		pm.ttsPool = pool
+	case "VLLLM":
+		pm.vlllmPool = pool
+	}
+}
+
+// mergeEvictionStats 将驱逐次数和最近一次驱逐时间（Unix秒）合并到池统计中
+func (pm *PoolManager) mergeEvictionStats(stats map[string]map[string]int) {
+	pm.evictionsMu.Lock()
+	defer pm.evictionsMu.Unlock()
+	for category, eviction := range pm.evictions {
+		key := strings.ToLower(category)
+		if stats[key] == nil {
+			continue
+		}
+		stats[key]["evictions"] = eviction.count
+		stats[key]["last_evicted_at"] = int(eviction.last.Unix())
+	}
+}
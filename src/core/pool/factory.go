@@ -10,8 +10,11 @@ import (
 	"ai-server-go/src/core/providers/vlllm"
 	"ai-server-go/src/core/utils"
 	"ai-server-go/src/database"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+
+	"golang.org/x/sync/singleflight"
 )
 
 /*
@@ -29,15 +32,26 @@ type ProviderFactory struct {
 	params           map[string]interface{}  // 可选参数
 	configService    *database.ConfigService // 数据库配置服务
 	grayscaleManager *GrayscaleManager       // 灰度发布管理器
+	name             string                  // provider名称
+	version          string                  // 创建工厂时灰度选中的版本
+}
+
+// providerInits 合并同一provider并发的初始化。冷启动时大量设备同时连接，
+// 每个会话都会为同一provider新建实例（如gosherpa各自建立websocket连接），后端不可用时会形成连接风暴
+var providerInits singleflight.Group
+
+// initKey 并发初始化的合并键，包含配置摘要，使用不同凭证的租户工厂互不影响
+func (f *ProviderFactory) initKey() string {
+	data, _ := json.Marshal(f.config)
+	return fmt.Sprintf("%s/%s@%s#%x", f.providerType, f.name, f.version, sha256.Sum256(data))
 }
 
 func (f *ProviderFactory) Create() (interface{}, error) {
 	// provider初始化前输出配置
 	if f.logger != nil {
-		configJson, _ := json.MarshalIndent(f.config, "", "  ")
-		f.logger.Debug("[ProviderFactory] 初始化provider，类型: %s，配置: %s", f.providerType, string(configJson))
+		f.logger.Debug("[ProviderFactory] 初始化provider，类型: %s，配置: %s", f.providerType, redactedConfig(f.config))
 	}
-	provider, err := f.createProvider()
+	provider, err := f.createShared()
 	// provider初始化后输出结果
 	if f.logger != nil {
 		if err != nil {
@@ -49,6 +63,30 @@ func (f *ProviderFactory) Create() (interface{}, error) {
 	return provider, err
 }
 
+// createShared 同一键同时只进行一次初始化，其余调用等待其结果：初始化失败时共享同一错误，
+// 失败不缓存，下一次调用会重新尝试；成功时等待者各自创建实例，
+// 因为资源池中的实例带有会话状态（连接、识别流），不能在会话间共用
+func (f *ProviderFactory) createShared() (interface{}, error) {
+	var provider interface{}
+	leader := false
+	_, err, _ := providerInits.Do(f.initKey(), func() (interface{}, error) {
+		leader = true
+		var err error
+		provider, err = f.createProvider()
+		return nil, err
+	})
+	if leader || err != nil {
+		return provider, err
+	}
+	// 本次调用等待的是其他调用的初始化，后端已确认可用，创建自己的实例
+	return f.createProvider()
+}
+
+// VersionKey 工厂对应的provider版本，用于按版本统计请求结果
+func (f *ProviderFactory) VersionKey(category string) VersionKey {
+	return VersionKey{Category: category, Name: f.name, Version: f.version}
+}
+
 func (f *ProviderFactory) Destroy(resource interface{}) error {
 	if provider, ok := resource.(providers.Provider); ok {
 		return provider.Cleanup()
@@ -91,7 +129,7 @@ func (f *ProviderFactory) createProvider() (interface{}, error) {
 		cfg := f.config.(*tts.Config)
 		params := f.params
 		delete_audio, _ := params["delete_audio"].(bool)
-		return tts.Create(cfg.Type, cfg, delete_audio)
+		return tts.Create(cfg.Type, cfg, delete_audio, f.logger)
 	case "vlllm":
 		cfg := f.config.(*vlllm.VLLLMConfig)
 		return vlllm.Create(cfg.Type, cfg, f.logger)
@@ -125,6 +163,7 @@ func NewASRFactory(asrType string, configService *database.ConfigService, logger
 		providerType: "asr",
 		config: &asr.Config{
 			Type: providerConfig.Type,
+			Data: providerProps(providerConfig, logger),
 		},
 		logger: logger,
 		params: map[string]interface{}{
@@ -133,6 +172,8 @@ func NewASRFactory(asrType string, configService *database.ConfigService, logger
 		},
 		configService:    configService,
 		grayscaleManager: grayscaleManager,
+		name:             asrType,
+		version:          providerConfig.Version,
 	}
 }
 
@@ -151,16 +192,7 @@ func NewLLMFactory(llmType string, configService *database.ConfigService, logger
 		return nil
 	}
 
-	var props map[string]interface{}
-	if len(providerConfig.Props) > 0 {
-		err := json.Unmarshal(providerConfig.Props, &props)
-		if err != nil {
-			logger.Error("解析LLM Props失败: %v", err)
-			props = map[string]interface{}{}
-		}
-	} else {
-		props = map[string]interface{}{}
-	}
+	props := providerProps(providerConfig, logger)
 
 	return &ProviderFactory{
 		providerType: "llm",
@@ -171,6 +203,8 @@ func NewLLMFactory(llmType string, configService *database.ConfigService, logger
 		logger:           logger,
 		configService:    configService,
 		grayscaleManager: grayscaleManager,
+		name:             llmType,
+		version:          providerConfig.Version,
 	}
 }
 
@@ -190,17 +224,7 @@ func NewTTSFactory(ttsType string, configService *database.ConfigService, logger
 		return nil
 	}
 
-	// 反序列化Props
-	var props map[string]interface{}
-	if len(providerConfig.Props) > 0 {
-		err := json.Unmarshal(providerConfig.Props, &props)
-		if err != nil {
-			logger.Error("解析TTS Props失败: %v", err)
-			props = map[string]interface{}{}
-		}
-	} else {
-		props = map[string]interface{}{}
-	}
+	props := providerProps(providerConfig, logger)
 
 	return &ProviderFactory{
 		providerType: "tts",
@@ -215,6 +239,8 @@ func NewTTSFactory(ttsType string, configService *database.ConfigService, logger
 		},
 		configService:    configService,
 		grayscaleManager: grayscaleManager,
+		name:             ttsType,
+		version:          providerConfig.Version,
 	}
 }
 
@@ -233,33 +259,30 @@ func NewVLLLMFactory(vlllmType string, configService *database.ConfigService, lo
 		return nil
 	}
 
-	var props map[string]interface{}
-	if len(providerConfig.Props) > 0 {
-		err := json.Unmarshal(providerConfig.Props, &props)
-		if err != nil {
-			logger.Error("解析VLLLM Props失败: %v", err)
-			props = map[string]interface{}{}
-		}
-	} else {
-		props = map[string]interface{}{}
-	}
-
-	// 补充type字段
-	if _, ok := props["type"]; !ok || props["type"] == "" {
-		props["type"] = providerConfig.Type
-	}
-	typeVal, _ := props["type"].(string)
+	props := providerProps(providerConfig, logger)
 
 	return &ProviderFactory{
 		providerType: "vlllm",
 		config: &vlllm.VLLLMConfig{
-			Type:  typeVal,
+			Type:  providerConfig.Type,
 			Extra: props,
 		},
 		logger:           logger,
 		configService:    configService,
 		grayscaleManager: grayscaleManager,
+		name:             vlllmType,
+		version:          providerConfig.Version,
+	}
+}
+
+// providerProps 解析provider的Props，type 参数统一取自 ProviderConfig.Type，解析失败时使用空参数
+func providerProps(providerConfig *database.ProviderConfig, logger *utils.Logger) map[string]interface{} {
+	props, err := providerConfig.PropsMap()
+	if err != nil {
+		logger.Error("%v", err)
+		return map[string]interface{}{"type": providerConfig.Type}
 	}
+	return props
 }
 
 func NewMCPFactory(config *configs.Config, logger *utils.Logger) ResourceFactory {
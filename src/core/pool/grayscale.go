@@ -1,14 +1,32 @@
 package pool
 
 import (
+	"ai-server-go/src/core/scheduler"
 	"ai-server-go/src/core/utils"
 	"ai-server-go/src/database"
+	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"sync"
 	"time"
 )
 
+const (
+	// defaultHealthCheckInterval 灰度版本健康检查默认间隔，可通过系统配置 grayscale/health_check_interval_seconds 调整
+	defaultHealthCheckInterval = 30 * time.Second
+	// defaultHealthCheckConcurrency 健康检查默认并发数，可通过系统配置 grayscale/health_check_concurrency 调整
+	defaultHealthCheckConcurrency = 4
+	// healthCheckJobName 健康检查在调度器中的任务名称
+	healthCheckJobName = "grayscale-health-check"
+	// defaultSelectionWindow cost/latency 策略统计耗时的默认窗口，可通过系统配置 grayscale/selection_window_seconds 调整
+	defaultSelectionWindow = 10 * time.Minute
+	// defaultSelectionMinSamples latency 策略每个版本至少需要的耗时样本数，可通过系统配置 grayscale/selection_min_samples 调整
+	defaultSelectionMinSamples = 5
+	// defaultMaxGrayscaleWeight 版本权重默认上限，可通过系统配置 grayscale/max_weight 调整；加载时权重被限制在[0,上限]
+	defaultMaxGrayscaleWeight = 100
+)
+
 // GrayscaleManager 灰度发布管理器
 type GrayscaleManager struct {
 	configService *database.ConfigService
@@ -16,6 +34,63 @@ type GrayscaleManager struct {
 	mu            sync.RWMutex
 	cache         map[string]*GrayscaleConfig // key: category/name
 	healthChecker *HealthChecker
+	selector      Selector             // 版本选择使用的随机数/轮询计数来源
+	jobs          *scheduler.Scheduler // 健康检查等周期任务，Stop时停止
+	metrics       *RequestMetrics      // 各版本的请求统计，latency 策略使用，为空时按权重选择
+	selection     selectionSettings    // cost/latency 策略的统计窗口和样本要求
+}
+
+// 版本选择策略
+const (
+	StrategyWeight     = "weight"      // 按权重随机
+	StrategyHealth     = "health"      // 选择第一个启用的版本
+	StrategyRoundRobin = "round_robin" // 轮询
+	StrategyCost       = "cost"        // 选择单价最低的版本
+	StrategyLatency    = "latency"     // 选择平均耗时最短的版本
+)
+
+// selectionSettings cost/latency 策略的参数
+type selectionSettings struct {
+	window     time.Duration // 统计耗时的窗口
+	minSamples int           // 每个候选版本至少需要的耗时样本数，不足时按权重选择
+}
+
+// Selector 灰度版本选择器，提供权重随机数和轮询计数
+// 测试中可注入固定种子或确定性实现，以断言具体的版本选择结果
+type Selector interface {
+	Intn(n int) int                  // 返回[0,n)区间的随机数，用于权重选择
+	NextIndex(key string, n int) int // 返回指定配置下一次轮询的下标（[0,n)）
+}
+
+// randomSelector 基于独立随机源的默认选择器
+type randomSelector struct {
+	mu       sync.Mutex
+	rng      *rand.Rand
+	counters map[string]uint64
+}
+
+// NewRandomSelector 使用指定种子创建选择器，相同种子产生相同的选择序列
+func NewRandomSelector(seed int64) Selector {
+	return &randomSelector{
+		rng:      rand.New(rand.NewSource(seed)),
+		counters: make(map[string]uint64),
+	}
+}
+
+// Intn 返回[0,n)区间的随机数
+func (s *randomSelector) Intn(n int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rng.Intn(n)
+}
+
+// NextIndex 按配置维度递增轮询计数
+func (s *randomSelector) NextIndex(key string, n int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index := s.counters[key] % uint64(n)
+	s.counters[key]++
+	return int(index)
 }
 
 // GrayscaleConfig 灰度发布配置
@@ -23,7 +98,7 @@ type GrayscaleConfig struct {
 	Category string              `json:"category"`
 	Name     string              `json:"name"`
 	Versions []*GrayscaleVersion `json:"versions"`
-	Strategy string              `json:"strategy"` // "weight", "health", "round_robin"
+	Strategy string              `json:"strategy"` // "weight", "health", "round_robin", "cost", "latency"
 	mu       sync.RWMutex
 }
 
@@ -42,14 +117,48 @@ func NewGrayscaleManager(configService *database.ConfigService, logger *utils.Lo
 		configService: configService,
 		logger:        logger,
 		cache:         make(map[string]*GrayscaleConfig),
+		selector:      NewRandomSelector(time.Now().UnixNano()),
+		jobs:          scheduler.New(context.Background(), logger),
+	}
+	gm.selection = gm.selectionSettings()
+
+	// 注册健康检查任务，Stop时退出
+	interval, concurrency := gm.healthCheckSettings()
+	if err := gm.jobs.Register(scheduler.Job{
+		Name:     healthCheckJobName,
+		Interval: interval,
+		Run: func(ctx context.Context) error {
+			gm.performHealthCheck(ctx, concurrency)
+			return nil
+		},
+	}); err != nil && logger != nil {
+		logger.Error("注册灰度健康检查任务失败: %v", err)
 	}
-
-	// 启动健康检查协程
-	go gm.startHealthCheck()
 
 	return gm
 }
 
+// SetSelector 替换版本选择器（主要用于测试注入确定性选择）
+func (gm *GrayscaleManager) SetSelector(selector Selector) {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	gm.selector = selector
+}
+
+// SetMetrics 设置各版本的请求统计，latency 策略按其中的耗时选择版本
+func (gm *GrayscaleManager) SetMetrics(metrics *RequestMetrics) {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	gm.metrics = metrics
+}
+
+// getSelector 获取当前版本选择器
+func (gm *GrayscaleManager) getSelector() Selector {
+	gm.mu.RLock()
+	defer gm.mu.RUnlock()
+	return gm.selector
+}
+
 // GetProviderConfig 根据灰度策略获取provider配置
 func (gm *GrayscaleManager) GetProviderConfig(category, name string) (*database.ProviderConfig, error) {
 	gm.mu.RLock()
@@ -73,12 +182,16 @@ func (gm *GrayscaleManager) GetProviderConfig(category, name string) (*database.
 	// 根据策略选择版本
 	var selectedVersion *GrayscaleVersion
 	switch config.Strategy {
-	case "weight":
+	case StrategyWeight:
 		selectedVersion = gm.selectByWeight(config)
-	case "health":
+	case StrategyHealth:
 		selectedVersion = gm.selectByHealth(config)
-	case "round_robin":
+	case StrategyRoundRobin:
 		selectedVersion = gm.selectByRoundRobin(config)
+	case StrategyCost:
+		selectedVersion = gm.selectByCost(config)
+	case StrategyLatency:
+		selectedVersion = gm.selectByLatency(config)
 	default:
 		selectedVersion = gm.selectByWeight(config) // 默认使用权重策略
 	}
@@ -101,22 +214,24 @@ func (gm *GrayscaleManager) selectByWeight(config *GrayscaleConfig) *GrayscaleVe
 
 	for _, version := range config.Versions {
 		if version.IsActive {
-			totalWeight += version.Weight
+			totalWeight += max(version.Weight, 0)
 			activeVersions = append(activeVersions, version)
 		}
 	}
 
-	if totalWeight == 0 || len(activeVersions) == 0 {
+	if len(activeVersions) == 0 {
 		return nil
 	}
+	if totalWeight <= 0 {
+		return gm.selectWithoutWeight(config, activeVersions)
+	}
 
 	// 随机选择
-	rand.Seed(time.Now().UnixNano())
-	r := rand.Intn(totalWeight)
+	r := gm.getSelector().Intn(totalWeight)
 
 	currentWeight := 0
 	for _, version := range activeVersions {
-		currentWeight += version.Weight
+		currentWeight += max(version.Weight, 0)
 		if r < currentWeight {
 			return version
 		}
@@ -126,6 +241,17 @@ func (gm *GrayscaleManager) selectByWeight(config *GrayscaleConfig) *GrayscaleVe
 	return activeVersions[0]
 }
 
+// selectWithoutWeight 启用的版本权重全为0时的选择：优先使用默认版本，没有默认版本时轮询，调用方持有config读锁
+func (gm *GrayscaleManager) selectWithoutWeight(config *GrayscaleConfig, activeVersions []*GrayscaleVersion) *GrayscaleVersion {
+	for _, version := range activeVersions {
+		if version.IsDefault {
+			return version
+		}
+	}
+	key := fmt.Sprintf("%s/%s", config.Category, config.Name)
+	return activeVersions[gm.getSelector().NextIndex(key, len(activeVersions))]
+}
+
 // selectByHealth 根据健康评分选择版本
 func (gm *GrayscaleManager) selectByHealth(config *GrayscaleConfig) *GrayscaleVersion {
 	config.mu.RLock()
@@ -155,41 +281,187 @@ func (gm *GrayscaleManager) selectByRoundRobin(config *GrayscaleConfig) *Graysca
 		return nil
 	}
 
-	// 简单的轮询实现
-	// 这里可以使用更复杂的轮询算法
-	return activeVersions[time.Now().Unix()%int64(len(activeVersions))]
+	// 按配置维度轮询
+	key := fmt.Sprintf("%s/%s", config.Category, config.Name)
+	return activeVersions[gm.getSelector().NextIndex(key, len(activeVersions))]
+}
+
+// selectByCost 选择单价最低的版本，单价相同时选择权重大的；启用的版本都未定价时按权重选择
+func (gm *GrayscaleManager) selectByCost(config *GrayscaleConfig) *GrayscaleVersion {
+	config.mu.RLock()
+	priced := false
+	for _, version := range config.Versions {
+		if version.IsActive && unitPrice(version.Config) > 0 {
+			priced = true
+			break
+		}
+	}
+	config.mu.RUnlock()
+	if !priced {
+		return gm.selectByWeight(config)
+	}
+	return gm.selectByRank(config, func(version *GrayscaleVersion) (float64, bool) {
+		return unitPrice(version.Config), true
+	})
+}
+
+// selectByLatency 选择统计窗口内平均耗时最短的版本，耗时相同（毫秒）时选择权重大的；
+// 任一候选版本的样本不足时按权重选择，让各版本都能积累样本
+func (gm *GrayscaleManager) selectByLatency(config *GrayscaleConfig) *GrayscaleVersion {
+	gm.mu.RLock()
+	metrics := gm.metrics
+	gm.mu.RUnlock()
+	if metrics == nil {
+		return gm.selectByWeight(config)
+	}
+	return gm.selectByRank(config, func(version *GrayscaleVersion) (float64, bool) {
+		key := VersionKey{Category: config.Category, Name: config.Name, Version: version.Version}
+		latency, samples := metrics.AverageLatency(key, gm.selection.window)
+		if samples < gm.selection.minSamples {
+			return 0, false
+		}
+		return float64(latency.Milliseconds()), true
+	})
+}
+
+// selectByRank 在启用且权重大于0的版本中选择指标最小的版本，指标相同时选择权重大的；
+// 任一候选版本没有指标或没有候选版本时按权重选择
+func (gm *GrayscaleManager) selectByRank(config *GrayscaleConfig, metric func(*GrayscaleVersion) (float64, bool)) *GrayscaleVersion {
+	config.mu.RLock()
+	candidates := make([]*GrayscaleVersion, 0, len(config.Versions))
+	for _, version := range config.Versions {
+		if version.IsActive && version.Weight > 0 {
+			candidates = append(candidates, version)
+		}
+	}
+	config.mu.RUnlock()
+
+	var best *GrayscaleVersion
+	var bestScore float64
+	for _, version := range candidates {
+		score, ok := metric(version)
+		if !ok {
+			return gm.selectByWeight(config)
+		}
+		if best == nil || score < bestScore || (score == bestScore && version.Weight > best.Weight) {
+			best, bestScore = version, score
+		}
+	}
+	if best == nil {
+		return gm.selectByWeight(config)
+	}
+	return best
+}
+
+// unitPrice 版本配置的单价之和，同一类别的版本只会配置该类别对应的单价
+func unitPrice(config *database.ProviderConfig) float64 {
+	if config == nil {
+		return 0
+	}
+	return config.InputTokenPrice + config.OutputTokenPrice + config.TTSCharPrice + config.ASRMinutePrice
 }
 
 // loadGrayscaleConfig 从数据库加载灰度配置
 func (gm *GrayscaleManager) loadGrayscaleConfig(category, name string) error {
+	grayscaleConfig, err := gm.buildGrayscaleConfig(category, name)
+	if err != nil {
+		return err
+	}
+
+	gm.mu.Lock()
+	gm.cache[fmt.Sprintf("%s/%s", category, name)] = grayscaleConfig
+	gm.mu.Unlock()
+
+	return nil
+}
+
+// buildGrayscaleConfig 从数据库读取provider的启用版本，构建新的灰度配置（不写入缓存）
+func (gm *GrayscaleManager) buildGrayscaleConfig(category, name string) (*GrayscaleConfig, error) {
 	configs, err := gm.configService.GetActiveProviderConfigs(category, name)
 	if err != nil {
-		return fmt.Errorf("加载灰度配置失败: %v", err)
+		return nil, fmt.Errorf("加载灰度配置失败: %v", err)
 	}
+	grayscaleConfig := gm.newGrayscaleConfig(category, name, configs, gm.maxGrayscaleWeight())
+	grayscaleConfig.Strategy = gm.strategyFor(category, name)
+	return grayscaleConfig, nil
+}
 
+// newGrayscaleConfig 由provider的启用版本构建灰度配置，权重限制在[0,maxWeight]，被调整的权重输出日志
+func (gm *GrayscaleManager) newGrayscaleConfig(category, name string, configs []*database.ProviderConfig, maxWeight int) *GrayscaleConfig {
 	grayscaleConfig := &GrayscaleConfig{
 		Category: category,
 		Name:     name,
-		Strategy: "weight",
+		Strategy: StrategyWeight,
 		Versions: make([]*GrayscaleVersion, 0),
 	}
 
 	for _, config := range configs {
+		weight := min(max(config.Weight, 0), maxWeight)
+		if weight != config.Weight && gm.logger != nil {
+			gm.logger.Warn("灰度版本 %s/%s@%s 的权重 %d 超出范围[0,%d]，按 %d 处理", category, name, config.Version, config.Weight, maxWeight, weight)
+		}
 		version := &GrayscaleVersion{
 			Version:   config.Version,
-			Weight:    config.Weight,
+			Weight:    weight,
 			IsActive:  config.IsActive,
 			IsDefault: config.IsDefault,
 			Config:    config,
 		}
 		grayscaleConfig.Versions = append(grayscaleConfig.Versions, version)
 	}
+	return grayscaleConfig
+}
 
-	gm.mu.Lock()
-	gm.cache[fmt.Sprintf("%s/%s", category, name)] = grayscaleConfig
-	gm.mu.Unlock()
+// strategyFor 读取provider的版本选择策略：系统配置 grayscale/strategies 中 "类别/名称" 优先于 "类别"，未配置时按权重
+func (gm *GrayscaleManager) strategyFor(category, name string) string {
+	if gm.configService == nil {
+		return StrategyWeight
+	}
+	strategies, err := gm.configService.GetSystemConfigJSON("grayscale", "strategies")
+	if err != nil {
+		return StrategyWeight
+	}
+	for _, key := range []string{category + "/" + name, category} {
+		value, ok := strategies[key].(string)
+		if !ok {
+			continue
+		}
+		switch value {
+		case StrategyWeight, StrategyHealth, StrategyRoundRobin, StrategyCost, StrategyLatency:
+			return value
+		}
+		if gm.logger != nil {
+			gm.logger.Warn("灰度配置 %s 的选择策略无效: %s，按权重选择", key, value)
+		}
+		return StrategyWeight
+	}
+	return StrategyWeight
+}
 
-	return nil
+// selectionSettings 读取 cost/latency 策略的统计窗口和样本要求
+func (gm *GrayscaleManager) selectionSettings() selectionSettings {
+	settings := selectionSettings{window: defaultSelectionWindow, minSamples: defaultSelectionMinSamples}
+	if gm.configService == nil {
+		return settings
+	}
+	if value, err := gm.configService.GetSystemConfigInt("grayscale", "selection_window_seconds"); err == nil && value > 0 {
+		settings.window = time.Duration(value) * time.Second
+	}
+	if value, err := gm.configService.GetSystemConfigInt("grayscale", "selection_min_samples"); err == nil && value > 0 {
+		settings.minSamples = value
+	}
+	return settings
+}
+
+// maxGrayscaleWeight 读取版本权重上限
+func (gm *GrayscaleManager) maxGrayscaleWeight() int {
+	if gm.configService == nil {
+		return defaultMaxGrayscaleWeight
+	}
+	if value, err := gm.configService.GetSystemConfigInt("grayscale", "max_weight"); err == nil && value > 0 {
+		return value
+	}
+	return defaultMaxGrayscaleWeight
 }
 
 // RefreshConfig 刷新指定provider的灰度配置
@@ -201,6 +473,45 @@ func (gm *GrayscaleManager) RefreshConfig(category, name string) error {
 	return gm.loadGrayscaleConfig(category, name)
 }
 
+// RefreshAll 重新加载缓存中所有provider的灰度配置，返回刷新的provider数量。
+// 新配置全部构建完成后在一次加锁中整体替换，选择版本的请求只会看到完整的旧配置或新配置；
+// 加载失败的provider从缓存中移除，下次使用时重新加载
+func (gm *GrayscaleManager) RefreshAll() (int, error) {
+	gm.mu.RLock()
+	snapshot := make(map[string]*GrayscaleConfig, len(gm.cache))
+	for key, config := range gm.cache {
+		snapshot[key] = config
+	}
+	gm.mu.RUnlock()
+
+	refreshed := make(map[string]*GrayscaleConfig, len(snapshot))
+	var errs []error
+	for key, config := range snapshot {
+		fresh, err := gm.buildGrayscaleConfig(config.Category, config.Name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", key, err))
+			continue
+		}
+		refreshed[key] = fresh
+	}
+
+	gm.mu.Lock()
+	cache := make(map[string]*GrayscaleConfig, len(gm.cache))
+	for key, config := range gm.cache {
+		// 刷新期间新加载的provider保留
+		if _, ok := snapshot[key]; !ok {
+			cache[key] = config
+		}
+	}
+	for key, config := range refreshed {
+		cache[key] = config
+	}
+	gm.cache = cache
+	gm.mu.Unlock()
+
+	return len(refreshed), errors.Join(errs...)
+}
+
 // UpdateWeight 更新版本权重
 func (gm *GrayscaleManager) UpdateWeight(category, name, version string, weight int) error {
 	err := gm.configService.UpdateProviderWeight(category, name, version, weight)
@@ -212,24 +523,49 @@ func (gm *GrayscaleManager) UpdateWeight(category, name, version string, weight
 	return gm.RefreshConfig(category, name)
 }
 
+// RampVersion 将目标版本的流量调整为percent%，其余版本按比例分配剩余流量，并刷新缓存
+func (gm *GrayscaleManager) RampVersion(category, name, version string, percent int) (*database.ProviderRampResult, error) {
+	result, err := gm.configService.RampProviderVersion(category, name, version, percent)
+	if err != nil {
+		return nil, err
+	}
+	if err := gm.RefreshConfig(category, name); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
 // UpdateHealthScore 更新健康评分
 func (gm *GrayscaleManager) UpdateHealthScore(category, name, version string, healthScore float64) error {
 	// 仅刷新缓存，不再有健康分持久化
 	return gm.RefreshConfig(category, name)
 }
 
-// startHealthCheck 启动健康检查协程
-func (gm *GrayscaleManager) startHealthCheck() {
-	ticker := time.NewTicker(30 * time.Second) // 每30秒检查一次
-	defer ticker.Stop()
+// Stop 停止健康检查任务并等待进行中的检查结束，可重复调用
+func (gm *GrayscaleManager) Stop() {
+	if gm.jobs != nil {
+		gm.jobs.Stop()
+	}
+}
 
-	for range ticker.C {
-		gm.performHealthCheck()
+// healthCheckSettings 读取健康检查间隔和并发数
+func (gm *GrayscaleManager) healthCheckSettings() (time.Duration, int) {
+	interval := defaultHealthCheckInterval
+	concurrency := defaultHealthCheckConcurrency
+	if gm.configService == nil {
+		return interval, concurrency
 	}
+	if value, err := gm.configService.GetSystemConfigInt("grayscale", "health_check_interval_seconds"); err == nil && value > 0 {
+		interval = time.Duration(value) * time.Second
+	}
+	if value, err := gm.configService.GetSystemConfigInt("grayscale", "health_check_concurrency"); err == nil && value > 0 {
+		concurrency = value
+	}
+	return interval, concurrency
 }
 
-// performHealthCheck 执行健康检查
-func (gm *GrayscaleManager) performHealthCheck() {
+// performHealthCheck 使用有限并发对所有启用的版本执行健康检查，ctx取消时不再发起新的探测
+func (gm *GrayscaleManager) performHealthCheck(ctx context.Context, concurrency int) {
 	gm.mu.RLock()
 	configs := make([]*GrayscaleConfig, 0, len(gm.cache))
 	for _, config := range gm.cache {
@@ -237,13 +573,41 @@ func (gm *GrayscaleManager) performHealthCheck() {
 	}
 	gm.mu.RUnlock()
 
+	var versions []*GrayscaleVersion
 	for _, config := range configs {
+		config.mu.RLock()
 		for _, version := range config.Versions {
 			if version.IsActive {
-				_ = gm.simulateHealthCheck(version.Config)
+				versions = append(versions, version)
 			}
 		}
+		config.mu.RUnlock()
+	}
+	if len(versions) == 0 {
+		return
+	}
+
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, version := range versions {
+		select {
+		case <-ctx.Done():
+			// 关闭期间不再发起新的探测
+			wg.Wait()
+			return
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(config *database.ProviderConfig) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			_ = gm.simulateHealthCheck(config)
+		}(version.Config)
 	}
+	wg.Wait()
 }
 
 // simulateHealthCheck 模拟健康检查（实际项目中应调用真实的健康检查）
@@ -0,0 +1,391 @@
+package pool
+
+import (
+	"math"
+	"runtime"
+	"testing"
+	"time"
+
+	"ai-server-go/src/database"
+)
+
+// fixedSelector 返回固定随机数的确定性选择器
+type fixedSelector struct {
+	value int
+	index int
+}
+
+func (s *fixedSelector) Intn(n int) int {
+	return s.value % n
+}
+
+func (s *fixedSelector) NextIndex(key string, n int) int {
+	index := s.index % n
+	s.index++
+	return index
+}
+
+func newTestGrayscaleManager(selector Selector, versions ...*GrayscaleVersion) *GrayscaleManager {
+	gm := &GrayscaleManager{
+		cache:    make(map[string]*GrayscaleConfig),
+		selector: selector,
+	}
+	gm.cache["LLM/TestLLM"] = &GrayscaleConfig{
+		Category: "LLM",
+		Name:     "TestLLM",
+		Strategy: "weight",
+		Versions: versions,
+	}
+	return gm
+}
+
+func newTestVersion(version string, weight int, active bool) *GrayscaleVersion {
+	return &GrayscaleVersion{
+		Version:  version,
+		Weight:   weight,
+		IsActive: active,
+		Config: &database.ProviderConfig{
+			Category: "LLM",
+			Name:     "TestLLM",
+			Version:  version,
+			Weight:   weight,
+			IsActive: active,
+		},
+	}
+}
+
+func TestSelectByWeightExactVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    int
+		expected string
+	}{
+		{name: "命中第一个版本下界", value: 0, expected: "v1"},
+		{name: "命中第一个版本上界", value: 69, expected: "v1"},
+		{name: "命中第二个版本下界", value: 70, expected: "v2"},
+		{name: "命中第二个版本上界", value: 99, expected: "v2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gm := newTestGrayscaleManager(&fixedSelector{value: tt.value},
+				newTestVersion("v1", 70, true),
+				newTestVersion("v2", 30, true),
+			)
+			config, err := gm.GetProviderConfig("LLM", "TestLLM")
+			if err != nil {
+				t.Fatalf("GetProviderConfig() error = %v", err)
+			}
+			if config.Version != tt.expected {
+				t.Errorf("GetProviderConfig() version = %s, want %s", config.Version, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSelectByWeightSkipsInactive(t *testing.T) {
+	gm := newTestGrayscaleManager(&fixedSelector{value: 0},
+		newTestVersion("v1", 70, false),
+		newTestVersion("v2", 30, true),
+	)
+	config, err := gm.GetProviderConfig("LLM", "TestLLM")
+	if err != nil {
+		t.Fatalf("GetProviderConfig() error = %v", err)
+	}
+	if config.Version != "v2" {
+		t.Errorf("GetProviderConfig() version = %s, want v2", config.Version)
+	}
+}
+
+func TestSelectByWeightSameSeedSameSequence(t *testing.T) {
+	versions := func() []*GrayscaleVersion {
+		return []*GrayscaleVersion{
+			newTestVersion("v1", 50, true),
+			newTestVersion("v2", 30, true),
+			newTestVersion("v3", 20, true),
+		}
+	}
+	first := newTestGrayscaleManager(NewRandomSelector(42), versions()...)
+	second := newTestGrayscaleManager(NewRandomSelector(42), versions()...)
+
+	for i := 0; i < 100; i++ {
+		a, err := first.GetProviderConfig("LLM", "TestLLM")
+		if err != nil {
+			t.Fatalf("GetProviderConfig() error = %v", err)
+		}
+		b, err := second.GetProviderConfig("LLM", "TestLLM")
+		if err != nil {
+			t.Fatalf("GetProviderConfig() error = %v", err)
+		}
+		if a.Version != b.Version {
+			t.Fatalf("第%d次选择不一致: %s != %s", i, a.Version, b.Version)
+		}
+	}
+}
+
+func TestSelectByWeightDistribution(t *testing.T) {
+	weights := map[string]int{"v1": 60, "v2": 30, "v3": 10}
+	gm := newTestGrayscaleManager(NewRandomSelector(1),
+		newTestVersion("v1", weights["v1"], true),
+		newTestVersion("v2", weights["v2"], true),
+		newTestVersion("v3", weights["v3"], true),
+	)
+
+	const iterations = 20000
+	const tolerance = 0.02
+	counts := make(map[string]int)
+	for i := 0; i < iterations; i++ {
+		config, err := gm.GetProviderConfig("LLM", "TestLLM")
+		if err != nil {
+			t.Fatalf("GetProviderConfig() error = %v", err)
+		}
+		counts[config.Version]++
+	}
+
+	for version, weight := range weights {
+		expected := float64(weight) / 100
+		actual := float64(counts[version]) / iterations
+		if math.Abs(actual-expected) > tolerance {
+			t.Errorf("版本 %s 选择比例 = %.4f, 期望 %.2f±%.2f", version, actual, expected, tolerance)
+		}
+	}
+}
+
+func TestSelectByRoundRobin(t *testing.T) {
+	gm := newTestGrayscaleManager(NewRandomSelector(1),
+		newTestVersion("v1", 10, true),
+		newTestVersion("v2", 10, false),
+		newTestVersion("v3", 10, true),
+	)
+	gm.cache["LLM/TestLLM"].Strategy = "round_robin"
+
+	expected := []string{"v1", "v3", "v1", "v3", "v1"}
+	for i, want := range expected {
+		config, err := gm.GetProviderConfig("LLM", "TestLLM")
+		if err != nil {
+			t.Fatalf("GetProviderConfig() error = %v", err)
+		}
+		if config.Version != want {
+			t.Errorf("第%d次轮询 version = %s, want %s", i, config.Version, want)
+		}
+	}
+}
+
+func TestGrayscaleManagerStopNoLeak(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	managers := make([]*GrayscaleManager, 0, 10)
+	for i := 0; i < 10; i++ {
+		managers = append(managers, NewGrayscaleManager(nil, nil))
+	}
+	if runtime.NumGoroutine() < before+len(managers) {
+		t.Fatalf("启动后goroutine数 = %d, 期望至少 %d", runtime.NumGoroutine(), before+len(managers))
+	}
+
+	for _, gm := range managers {
+		gm.Stop()
+		// 重复调用不应panic或阻塞
+		gm.Stop()
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("Stop后goroutine数 = %d, 期望不超过 %d", after, before)
+	}
+}
+
+func TestGrayscaleManagerStopWithoutHealthCheck(t *testing.T) {
+	// 未通过NewGrayscaleManager创建（没有健康检查协程）时Stop直接返回
+	gm := newTestGrayscaleManager(NewRandomSelector(1))
+	gm.Stop()
+}
+
+func TestSelectByWeightAllZeroUsesDefault(t *testing.T) {
+	fallback := newTestVersion("v2", 0, true)
+	fallback.IsDefault = true
+	gm := newTestGrayscaleManager(&fixedSelector{value: 0},
+		newTestVersion("v1", 0, true),
+		fallback,
+	)
+	for i := 0; i < 3; i++ {
+		config, err := gm.GetProviderConfig("LLM", "TestLLM")
+		if err != nil {
+			t.Fatalf("GetProviderConfig() error = %v", err)
+		}
+		if config.Version != "v2" {
+			t.Errorf("第%d次选择 version = %s, want v2", i, config.Version)
+		}
+	}
+}
+
+func TestSelectByWeightAllZeroRoundRobin(t *testing.T) {
+	gm := newTestGrayscaleManager(&fixedSelector{value: 0},
+		newTestVersion("v1", 0, true),
+		newTestVersion("v2", 0, false),
+		newTestVersion("v3", 0, true),
+	)
+	expected := []string{"v1", "v3", "v1"}
+	for i, want := range expected {
+		config, err := gm.GetProviderConfig("LLM", "TestLLM")
+		if err != nil {
+			t.Fatalf("GetProviderConfig() error = %v", err)
+		}
+		if config.Version != want {
+			t.Errorf("第%d次选择 version = %s, want %s", i, config.Version, want)
+		}
+	}
+}
+
+func TestNewGrayscaleConfigClampsWeights(t *testing.T) {
+	gm := newTestGrayscaleManager(&fixedSelector{value: 0})
+	configs := []*database.ProviderConfig{
+		{Category: "LLM", Name: "TestLLM", Version: "v1", Weight: -50, IsActive: true},
+		{Category: "LLM", Name: "TestLLM", Version: "v2", Weight: 100000, IsActive: true},
+		{Category: "LLM", Name: "TestLLM", Version: "v3", Weight: 30, IsActive: true},
+	}
+	config := gm.newGrayscaleConfig("LLM", "TestLLM", configs, defaultMaxGrayscaleWeight)
+
+	expected := map[string]int{"v1": 0, "v2": 100, "v3": 30}
+	for _, version := range config.Versions {
+		if version.Weight != expected[version.Version] {
+			t.Errorf("版本 %s 权重 = %d, want %d", version.Version, version.Weight, expected[version.Version])
+		}
+	}
+}
+
+func TestSelectByWeightNegativeWeight(t *testing.T) {
+	// 负权重的版本不参与分配，也不会让总权重变为负数
+	for value := 0; value < 30; value += 7 {
+		gm := newTestGrayscaleManager(&fixedSelector{value: value},
+			newTestVersion("v1", -50, true),
+			newTestVersion("v2", 30, true),
+		)
+		config, err := gm.GetProviderConfig("LLM", "TestLLM")
+		if err != nil {
+			t.Fatalf("GetProviderConfig() error = %v", err)
+		}
+		if config.Version != "v2" {
+			t.Errorf("随机数 %d 选择 version = %s, want v2", value, config.Version)
+		}
+	}
+
+	gm := newTestGrayscaleManager(&fixedSelector{value: 0},
+		newTestVersion("v1", -50, true),
+		newTestVersion("v2", -10, true),
+	)
+	config, err := gm.GetProviderConfig("LLM", "TestLLM")
+	if err != nil {
+		t.Fatalf("全部为负权重时 GetProviderConfig() error = %v", err)
+	}
+	if config.Version != "v1" {
+		t.Errorf("全部为负权重时 version = %s, want v1（轮询）", config.Version)
+	}
+}
+
+func newPricedVersion(version string, weight int, price float64) *GrayscaleVersion {
+	v := newTestVersion(version, weight, true)
+	v.Config.InputTokenPrice = price
+	return v
+}
+
+func TestSelectByCost(t *testing.T) {
+	tests := []struct {
+		name     string
+		versions []*GrayscaleVersion
+		expected string
+	}{
+		{
+			name:     "选择单价最低的版本",
+			versions: []*GrayscaleVersion{newPricedVersion("v1", 90, 0.02), newPricedVersion("v2", 10, 0.01)},
+			expected: "v2",
+		},
+		{
+			name:     "单价相同时选择权重大的",
+			versions: []*GrayscaleVersion{newPricedVersion("v1", 20, 0.01), newPricedVersion("v2", 80, 0.01), newPricedVersion("v3", 50, 0.03)},
+			expected: "v2",
+		},
+		{
+			name:     "权重为0的版本不参与",
+			versions: []*GrayscaleVersion{newPricedVersion("v1", 0, 0.001), newPricedVersion("v2", 10, 0.01)},
+			expected: "v2",
+		},
+		{
+			// 固定随机数70落在第二个版本的权重区间
+			name:     "都未定价时按权重选择",
+			versions: []*GrayscaleVersion{newPricedVersion("v1", 70, 0), newPricedVersion("v2", 30, 0)},
+			expected: "v2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gm := newTestGrayscaleManager(&fixedSelector{value: 70}, tt.versions...)
+			gm.cache["LLM/TestLLM"].Strategy = StrategyCost
+			config, err := gm.GetProviderConfig("LLM", "TestLLM")
+			if err != nil {
+				t.Fatalf("GetProviderConfig() error = %v", err)
+			}
+			if config.Version != tt.expected {
+				t.Errorf("GetProviderConfig() version = %s, want %s", config.Version, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSelectByLatency(t *testing.T) {
+	key := func(version string) VersionKey {
+		return VersionKey{Category: "LLM", Name: "TestLLM", Version: version}
+	}
+	record := func(metrics *RequestMetrics, version string, latency time.Duration, samples int) {
+		for i := 0; i < samples; i++ {
+			metrics.RecordLatency(key(version), latency)
+		}
+	}
+	newManager := func(metrics *RequestMetrics) *GrayscaleManager {
+		gm := newTestGrayscaleManager(&fixedSelector{value: 0},
+			newTestVersion("v1", 60, true),
+			newTestVersion("v2", 40, true),
+		)
+		gm.cache["LLM/TestLLM"].Strategy = StrategyLatency
+		gm.selection = selectionSettings{window: time.Minute, minSamples: 3}
+		gm.SetMetrics(metrics)
+		return gm
+	}
+	selected := func(gm *GrayscaleManager) string {
+		config, err := gm.GetProviderConfig("LLM", "TestLLM")
+		if err != nil {
+			t.Fatalf("GetProviderConfig() error = %v", err)
+		}
+		return config.Version
+	}
+
+	metrics := NewRequestMetrics()
+	record(metrics, "v1", 800*time.Millisecond, 3)
+	record(metrics, "v2", 200*time.Millisecond, 3)
+	if got := selected(newManager(metrics)); got != "v2" {
+		t.Errorf("耗时最短 version = %s, want v2", got)
+	}
+
+	// 耗时相同时选择权重大的
+	metrics = NewRequestMetrics()
+	record(metrics, "v1", 300*time.Millisecond, 3)
+	record(metrics, "v2", 300*time.Millisecond, 3)
+	if got := selected(newManager(metrics)); got != "v1" {
+		t.Errorf("耗时相同 version = %s, want v1", got)
+	}
+
+	// v1 样本不足时按权重选择（固定随机数0落在v1）
+	metrics = NewRequestMetrics()
+	record(metrics, "v1", 800*time.Millisecond, 2)
+	record(metrics, "v2", 200*time.Millisecond, 3)
+	if got := selected(newManager(metrics)); got != "v1" {
+		t.Errorf("样本不足 version = %s, want v1（按权重）", got)
+	}
+
+	// 没有请求统计时按权重选择
+	if got := selected(newManager(nil)); got != "v1" {
+		t.Errorf("没有请求统计 version = %s, want v1（按权重）", got)
+	}
+}
@@ -0,0 +1,332 @@
+package pool
+
+import (
+	"ai-server-go/src/core/providers"
+	"ai-server-go/src/core/providers/llm"
+	"ai-server-go/src/core/providers/tts"
+	"ai-server-go/src/core/types"
+	"ai-server-go/src/core/utils"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+/*
+* 并发限制器，按provider配置限制同时发往上游的请求数。
+* 超过限制的请求排队等待（带超时），避免瞬间打满上游的QPS/并发配额。
+* 上游返回429时临时将限制减半，之后每个恢复周期逐步恢复到配置值。
+* 限制器按provider配置（类别+名称）创建并在资源池重建后继续共用，热更新配置时原地调整上限，正在进行的请求仍计入名额。
+ */
+
+const (
+	defaultQueueTimeout   = 10 * time.Second
+	limiterRecoveryPeriod = 30 * time.Second
+)
+
+// ConcurrencyLimiter provider并发限制器
+type ConcurrencyLimiter struct {
+	name         string
+	maxInFlight  int           // 配置的最大并发数，0表示不限制
+	limit        int           // 当前生效的并发数（429后会临时降低）
+	inFlight     int           // 正在进行的请求数
+	queued       int           // 正在排队的请求数
+	queueTimeout time.Duration // 排队超时时间
+	recoverAt    time.Time     // 下一次恢复限制的时间
+	notify       chan struct{} // 有请求释放时关闭，用于唤醒排队者
+	mu           sync.Mutex
+	logger       *utils.Logger
+}
+
+// NewConcurrencyLimiter 创建并发限制器
+func NewConcurrencyLimiter(name string, maxInFlight int, queueTimeout time.Duration, logger *utils.Logger) *ConcurrencyLimiter {
+	if queueTimeout <= 0 {
+		queueTimeout = defaultQueueTimeout
+	}
+	return &ConcurrencyLimiter{
+		name:         name,
+		maxInFlight:  maxInFlight,
+		limit:        maxInFlight,
+		queueTimeout: queueTimeout,
+		notify:       make(chan struct{}),
+		logger:       logger,
+	}
+}
+
+// Acquire 获取一个并发名额，超过限制时排队等待直到超时
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context) error {
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+
+	waiting := false
+	defer func() {
+		if waiting {
+			l.mu.Lock()
+			l.queued--
+			l.mu.Unlock()
+		}
+	}()
+
+	for {
+		l.mu.Lock()
+		if l.maxInFlight <= 0 || l.inFlight < l.currentLimit() {
+			l.inFlight++
+			l.mu.Unlock()
+			return nil
+		}
+		if !waiting {
+			waiting = true
+			l.queued++
+		}
+		notify := l.notify
+		l.mu.Unlock()
+
+		select {
+		case <-notify:
+		case <-timer.C:
+			return fmt.Errorf("%s 并发排队超时(%v)", l.name, l.queueTimeout)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Release 释放并发名额
+func (l *ConcurrencyLimiter) Release() {
+	l.mu.Lock()
+	if l.inFlight > 0 {
+		l.inFlight--
+	}
+	close(l.notify)
+	l.notify = make(chan struct{})
+	l.mu.Unlock()
+}
+
+// OnRateLimited 上游返回429时临时降低并发限制
+func (l *ConcurrencyLimiter) OnRateLimited() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.maxInFlight <= 0 {
+		l.logger.Warn("%s 上游限流(429)，但未配置并发限制", l.name)
+		return
+	}
+	newLimit := l.limit / 2
+	if newLimit < 1 {
+		newLimit = 1
+	}
+	if newLimit != l.limit {
+		l.logger.Warn("%s 上游限流(429)，并发限制临时由 %d 降至 %d", l.name, l.limit, newLimit)
+	}
+	l.limit = newLimit
+	l.recoverAt = time.Now().Add(limiterRecoveryPeriod)
+}
+
+// currentLimit 获取当前生效的并发限制，到达恢复时间后逐步恢复（需持有锁）
+func (l *ConcurrencyLimiter) currentLimit() int {
+	if l.limit < l.maxInFlight && time.Now().After(l.recoverAt) {
+		l.limit++
+		l.recoverAt = time.Now().Add(limiterRecoveryPeriod)
+	}
+	return l.limit
+}
+
+// SetMaxInFlight 调整最大并发数和排队超时，正在进行和排队的请求保留；429降低的限制不超过新的上限
+func (l *ConcurrencyLimiter) SetMaxInFlight(maxInFlight int, queueTimeout time.Duration) {
+	if queueTimeout <= 0 {
+		queueTimeout = defaultQueueTimeout
+	}
+	l.mu.Lock()
+	if l.limit == l.maxInFlight || l.limit > maxInFlight {
+		l.limit = maxInFlight
+	}
+	l.maxInFlight = maxInFlight
+	l.queueTimeout = queueTimeout
+	// 上限提高时唤醒排队者重新检查
+	close(l.notify)
+	l.notify = make(chan struct{})
+	l.mu.Unlock()
+}
+
+// GetStats 获取限制器状态
+func (l *ConcurrencyLimiter) GetStats() map[string]int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return map[string]int{
+		"max_concurrency": l.maxInFlight,
+		"current_limit":   l.limit,
+		"in_flight":       l.inFlight,
+		"queued":          l.queued,
+	}
+}
+
+// limiterKey 并发限制器所属的provider配置
+type limiterKey struct {
+	Category string
+	Name     string
+}
+
+// providerLimiter 获取类别当前平台资源池所用provider配置的并发限制器，未配置并发上限时返回nil
+func (pm *PoolManager) providerLimiter(category string) *ConcurrencyLimiter {
+	factory := pm.poolFactory(category)
+	if factory == nil {
+		return nil
+	}
+	key := limiterKey{Category: category, Name: factory.name}
+
+	pm.limitersMu.Lock()
+	defer pm.limitersMu.Unlock()
+	if limiter, ok := pm.limiters[key]; ok {
+		return limiter
+	}
+	if pm.limiters == nil {
+		pm.limiters = make(map[limiterKey]*ConcurrencyLimiter)
+	}
+	limiter := pm.newProviderLimiter(category, factory.name)
+	pm.limiters[key] = limiter
+	return limiter
+}
+
+// reloadProviderLimiter provider配置热更新后按新配置调整并发限制，已有限制器原地调整以保留正在进行的请求数
+func (pm *PoolManager) reloadProviderLimiter(category, name string) {
+	key := limiterKey{Category: category, Name: name}
+	fresh := pm.newProviderLimiter(category, name)
+
+	pm.limitersMu.Lock()
+	defer pm.limitersMu.Unlock()
+	current, ok := pm.limiters[key]
+	if !ok {
+		return // 尚未使用过的配置在首次获取时创建
+	}
+	if current == nil || fresh == nil {
+		pm.limiters[key] = fresh
+		return
+	}
+	current.SetMaxInFlight(fresh.maxInFlight, fresh.queueTimeout)
+}
+
+// isRateLimitError 判断是否为上游限流错误
+func isRateLimitError(errMsg string) bool {
+	if errMsg == "" {
+		return false
+	}
+	lower := strings.ToLower(errMsg)
+	return strings.Contains(lower, "429") ||
+		strings.Contains(lower, "too many requests") ||
+		strings.Contains(lower, "rate limit")
+}
+
+// drainChannel 排空通道，避免上游协程阻塞
+func drainChannel[T any](ch <-chan T) {
+	for range ch {
+	}
+}
+
+// limitedLLMProvider 带并发限制的LLM提供者
+type limitedLLMProvider struct {
+	providers.LLMProvider
+	limiter *ConcurrencyLimiter
+}
+
+// Response 在并发名额内调用LLM，流结束后释放名额
+func (p *limitedLLMProvider) Response(ctx context.Context, sessionID string, messages []types.Message) (<-chan string, error) {
+	if err := p.limiter.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	inner, err := p.LLMProvider.Response(ctx, sessionID, messages)
+	if err != nil {
+		p.limiter.Release()
+		if isRateLimitError(err.Error()) {
+			p.limiter.OnRateLimited()
+		}
+		return nil, err
+	}
+
+	out := make(chan string, 10)
+	go func() {
+		defer close(out)
+		defer p.limiter.Release()
+		for content := range inner {
+			select {
+			case out <- content:
+			case <-ctx.Done():
+				// 调用方已放弃读取，排空上游流后退出
+				go drainChannel(inner)
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// ResponseWithFunctions 在并发名额内调用LLM，流结束后释放名额
+func (p *limitedLLMProvider) ResponseWithFunctions(ctx context.Context, sessionID string, messages []types.Message, tools []openai.Tool) (<-chan types.Response, error) {
+	if err := p.limiter.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	inner, err := p.LLMProvider.ResponseWithFunctions(ctx, sessionID, messages, tools)
+	if err != nil {
+		p.limiter.Release()
+		if isRateLimitError(err.Error()) {
+			p.limiter.OnRateLimited()
+		}
+		return nil, err
+	}
+
+	out := make(chan types.Response, 10)
+	go func() {
+		defer close(out)
+		defer p.limiter.Release()
+		for response := range inner {
+			if isRateLimitError(response.Error) {
+				p.limiter.OnRateLimited()
+			}
+			select {
+			case out <- response:
+			case <-ctx.Done():
+				go drainChannel(inner)
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Config 透传LLM配置，保持与未包装提供者一致的配置读取方式
+func (p *limitedLLMProvider) Config() *llm.Config {
+	if getter, ok := p.LLMProvider.(interface{ Config() *llm.Config }); ok {
+		return getter.Config()
+	}
+	return nil
+}
+
+// limitedTTSProvider 带并发限制的TTS提供者
+type limitedTTSProvider struct {
+	providers.TTSProvider
+	limiter *ConcurrencyLimiter
+}
+
+// ToTTS 在并发名额内合成语音
+func (p *limitedTTSProvider) ToTTS(ctx context.Context, text string) (string, error) {
+	if err := p.limiter.Acquire(ctx); err != nil {
+		return "", err
+	}
+	defer p.limiter.Release()
+
+	filepath, err := p.TTSProvider.ToTTS(ctx, text)
+	if err != nil && isRateLimitError(err.Error()) {
+		p.limiter.OnRateLimited()
+	}
+	return filepath, err
+}
+
+// Config 透传TTS配置，保持与未包装提供者一致的配置读取方式
+func (p *limitedTTSProvider) Config() *tts.Config {
+	if getter, ok := p.TTSProvider.(interface{ Config() *tts.Config }); ok {
+		return getter.Config()
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package pool
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// acquireWithin 在超时内尝试获取并发名额
+func acquireWithin(limiter *ConcurrencyLimiter, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return limiter.Acquire(ctx)
+}
+
+func TestSetMaxInFlightKeepsInFlightRequests(t *testing.T) {
+	limiter := NewConcurrencyLimiter("TTS/test", 2, time.Second, newTestLogger(t))
+	for i := 0; i < 2; i++ {
+		if err := acquireWithin(limiter, 50*time.Millisecond); err != nil {
+			t.Fatalf("第%d个请求获取名额失败: %v", i+1, err)
+		}
+	}
+
+	// 上限降到1后，正在进行的2个请求仍占用名额
+	limiter.SetMaxInFlight(1, time.Second)
+	limiter.Release()
+	if err := acquireWithin(limiter, 50*time.Millisecond); err == nil {
+		t.Fatal("仍有1个请求进行中，上限为1时不应获取到名额")
+	}
+	limiter.Release()
+	if err := acquireWithin(limiter, 50*time.Millisecond); err != nil {
+		t.Fatalf("请求全部释放后获取名额失败: %v", err)
+	}
+
+	stats := limiter.GetStats()
+	if stats["max_concurrency"] != 1 || stats["current_limit"] != 1 || stats["in_flight"] != 1 {
+		t.Fatalf("限制器状态不符合预期: %v", stats)
+	}
+}
+
+func TestSetMaxInFlightWakesQueuedRequests(t *testing.T) {
+	limiter := NewConcurrencyLimiter("LLM/test", 1, time.Second, newTestLogger(t))
+	if err := acquireWithin(limiter, 50*time.Millisecond); err != nil {
+		t.Fatalf("获取名额失败: %v", err)
+	}
+
+	acquired := make(chan error, 1)
+	go func() { acquired <- acquireWithin(limiter, time.Second) }()
+	time.Sleep(20 * time.Millisecond)
+
+	// 提高上限后排队的请求无需等待释放即可获取名额
+	limiter.SetMaxInFlight(2, time.Second)
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatalf("提高上限后排队请求获取名额失败: %v", err)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("提高上限后排队请求未被唤醒")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"ai-server-go/src/database"
 	"context"
 	"fmt"
+	"sync"
 	"time"
 )
 
@@ -22,6 +23,15 @@ type PoolManager struct {
 	logger        *utils.Logger
 	configService *database.ConfigService
 	grayscaleManager *GrayscaleManager
+	limiters      map[limiterKey]*ConcurrencyLimiter // 按provider配置的上游并发限制，nil表示该配置不限制
+	limitersMu    sync.Mutex
+	ttsFallback   *TTSFallback        // TTS降级链
+	metrics       *RequestMetrics     // 按版本统计的请求结果，用于灰度自动回滚和 latency 选择策略
+	tenantPools   map[tenantPoolKey]*ResourcePool // 用户自带凭证的资源池
+	tenantMu      sync.Mutex
+	evictMu       sync.Mutex               // 串行执行手动驱逐
+	evictions     map[string]evictionStats // 按类别记录的手动驱逐统计
+	evictionsMu   sync.Mutex
 }
 
 // ProviderSet 提供者集合
@@ -31,6 +41,8 @@ type ProviderSet struct {
 	TTS   providers.TTSProvider
 	VLLLM *vlllm.Provider
 	MCP   *mcp.Manager
+
+	pools map[string]*ResourcePool // 按类别记录提供者取自的资源池，归还时放回该池（资源池被重建后旧实例随旧池销毁）
 }
 
 // NewPoolManager 创建资源池管理器
@@ -38,10 +50,12 @@ func NewPoolManager(config *configs.Config, logger *utils.Logger, defaultModules
 	pm := &PoolManager{
 		logger:        logger,
 		configService: configService,
+		metrics:       NewRequestMetrics(),
 	}
 
 	// 创建灰度发布管理器
 	pm.grayscaleManager = NewGrayscaleManager(configService, logger)
+	pm.grayscaleManager.SetMetrics(pm.metrics)
 
 	poolConfig := PoolConfig{
 		MinSize:       5,
@@ -50,8 +64,11 @@ func NewPoolManager(config *configs.Config, logger *utils.Logger, defaultModules
 		CheckInterval: 30 * time.Second,
 	}
 
-	// 检查配置是否包含所需的模块
-	selectedModule := defaultModules
+	// 检查配置是否包含所需的模块，缺少默认provider时按 providers.default_fallback 处理
+	selectedModule, err := resolveDefaultModules(defaultModules, config.Providers.DefaultFallback, configService, logger)
+	if err != nil {
+		return nil, err
+	}
 
 	// 初始化ASR池
 	if asrType, ok := selectedModule["ASR"]; ok && asrType != "" {
@@ -94,6 +111,7 @@ func NewPoolManager(config *configs.Config, logger *utils.Logger, defaultModules
 			return nil, fmt.Errorf("初始化TTS资源池失败: %v", err)
 		}
 		pm.ttsPool = ttsPool
+		pm.ttsFallback = NewTTSFallback(ttsType, configService, pm.grayscaleManager, logger, deleteAudio)
 		_, cnt := ttsPool.GetStats()
 		logger.Info("TTS资源池初始化成功，类型: %s, 数量：%d", ttsType, cnt)
 	}
@@ -146,42 +164,102 @@ func NewPoolManager(config *configs.Config, logger *utils.Logger, defaultModules
 		logger.Warn("创建MCP工厂失败，MCP功能将不可用")
 	}
 
+	// 启动灰度自动回滚检查（默认关闭，由系统配置 grayscale/auto_rollback_enabled 控制）
+	if err := pm.grayscaleManager.jobs.Register(pm.autoRollbackJob()); err != nil {
+		logger.Error("注册灰度自动回滚任务失败: %v", err)
+	}
+
+	// 启动默认LLM预热（默认关闭，由系统配置 llm_warmup/enabled 控制）
+	if pm.llmPool != nil {
+		if err := pm.grayscaleManager.jobs.Register(pm.warmupJob()); err != nil {
+			logger.Error("注册LLM预热任务失败: %v", err)
+		}
+	}
+
 	return pm, nil
 }
 
-// GetProviderSet 获取一套提供者
+// GetProviderSet 获取一套使用平台凭证的提供者
 func (pm *PoolManager) GetProviderSet() (*ProviderSet, error) {
-	set := &ProviderSet{}
+	return pm.GetProviderSetForTenant(nil)
+}
+
+// GetProviderSetForTenant 获取一套提供者，用户为当前provider配置了自带凭证时从该用户的资源池获取
+func (pm *PoolManager) GetProviderSetForTenant(userID *uint) (*ProviderSet, error) {
+	set := &ProviderSet{pools: make(map[string]*ResourcePool)}
 
 	if pm.asrPool != nil {
-		asr, err := pm.asrPool.Get()
+		asrPool := pm.asrPool
+		asr, err := asrPool.Get()
 		if err != nil {
 			return nil, fmt.Errorf("获取ASR提供者失败: %v", err)
 		}
 		set.ASR = asr.(providers.ASRProvider)
+		set.pools["ASR"] = asrPool
 	}
 
-	if pm.llmPool != nil {
-		llm, err := pm.llmPool.Get()
+	if tenantPool := pm.tenantPool("LLM", userID); tenantPool != nil {
+		llm, err := tenantPool.Get()
 		if err != nil {
 			return nil, fmt.Errorf("获取LLM提供者失败: %v", err)
 		}
 		set.LLM = llm.(providers.LLMProvider)
+		set.pools["LLM"] = tenantPool
+	} else if llmPool := pm.llmPool; llmPool != nil {
+		llm, err := llmPool.Get()
+		if err != nil {
+			return nil, fmt.Errorf("获取LLM提供者失败: %v", err)
+		}
+		set.LLM = llm.(providers.LLMProvider)
+		set.pools["LLM"] = llmPool
+		if factory := pm.poolFactory("LLM"); factory != nil && pm.metrics != nil {
+			set.LLM = &meteredLLMProvider{LLMProvider: set.LLM, metrics: pm.metrics, key: factory.VersionKey("LLM")}
+		}
+		if limiter := pm.providerLimiter("LLM"); limiter != nil {
+			set.LLM = &limitedLLMProvider{LLMProvider: set.LLM, limiter: limiter}
+		}
 	}
 
-	if pm.ttsPool != nil {
-		tts, err := pm.ttsPool.Get()
+	if tenantPool := pm.tenantPool("TTS", userID); tenantPool != nil {
+		tts, err := tenantPool.Get()
 		if err != nil {
 			return nil, fmt.Errorf("获取TTS提供者失败: %v", err)
 		}
-		set.TTS = tts.(providers.TTSProvider)
+		set.TTS = &validatedTTSProvider{TTSProvider: tts.(providers.TTSProvider)}
+		set.pools["TTS"] = tenantPool
+		if pm.ttsFallback != nil {
+			set.TTS = &fallbackTTSProvider{TTSProvider: set.TTS, fallback: pm.ttsFallback}
+		}
+	} else if ttsPool := pm.ttsPool; ttsPool != nil {
+		tts, err := ttsPool.Get()
+		if err != nil {
+			return nil, fmt.Errorf("获取TTS提供者失败: %v", err)
+		}
+		set.TTS = &validatedTTSProvider{TTSProvider: tts.(providers.TTSProvider)}
+		set.pools["TTS"] = ttsPool
+		if factory := pm.poolFactory("TTS"); factory != nil && pm.metrics != nil {
+			set.TTS = &meteredTTSProvider{TTSProvider: set.TTS, metrics: pm.metrics, key: factory.VersionKey("TTS")}
+		}
+		if limiter := pm.providerLimiter("TTS"); limiter != nil {
+			set.TTS = &limitedTTSProvider{TTSProvider: set.TTS, limiter: limiter}
+		}
+		if pm.ttsFallback != nil {
+			set.TTS = &fallbackTTSProvider{TTSProvider: set.TTS, fallback: pm.ttsFallback}
+		}
 	}
 
-	if pm.vlllmPool != nil {
-		vlllmProvider, err := pm.vlllmPool.Get()
+	if tenantPool := pm.tenantPool("VLLLM", userID); tenantPool != nil {
+		vlllmProvider, err := tenantPool.Get()
+		if err == nil {
+			set.VLLLM = vlllmProvider.(*vlllm.Provider)
+			set.pools["VLLLM"] = tenantPool
+		}
+	} else if vlllmPool := pm.vlllmPool; vlllmPool != nil {
+		vlllmProvider, err := vlllmPool.Get()
 		if err == nil {
 			// 直接转换，因为我们知道这是从 vlllm 工厂创建的
 			set.VLLLM = vlllmProvider.(*vlllm.Provider)
+			set.pools["VLLLM"] = vlllmPool
 		}
 	}
 
@@ -198,6 +276,10 @@ func (pm *PoolManager) GetProviderSet() (*ProviderSet, error) {
 
 // Close 关闭所有资源池
 func (pm *PoolManager) Close() {
+	// 先停止健康检查、自动回滚等周期任务，再关闭资源池
+	if pm.grayscaleManager != nil {
+		pm.grayscaleManager.Stop()
+	}
 	if pm.asrPool != nil {
 		pm.asrPool.Close()
 	}
@@ -213,6 +295,7 @@ func (pm *PoolManager) Close() {
 	if pm.mcpPool != nil {
 		pm.mcpPool.Close()
 	}
+	pm.closeTenantPools(func(tenantPoolKey) bool { return true })
 }
 
 // ReturnProviderSet 归还提供者集合到池中
@@ -223,14 +306,38 @@ func (pm *PoolManager) ReturnProviderSet(set *ProviderSet) error {
 
 	var errs []error
 
+	// 去掉并发限制、统计和校验包装，池中只保存原始提供者
+	if limited, ok := set.LLM.(*limitedLLMProvider); ok {
+		set.LLM = limited.LLMProvider
+	}
+	if metered, ok := set.LLM.(*meteredLLMProvider); ok {
+		set.LLM = metered.LLMProvider
+	}
+	if fallback, ok := set.TTS.(*fallbackTTSProvider); ok {
+		set.TTS = fallback.TTSProvider
+	}
+	if limited, ok := set.TTS.(*limitedTTSProvider); ok {
+		set.TTS = limited.TTSProvider
+	}
+	if metered, ok := set.TTS.(*meteredTTSProvider); ok {
+		set.TTS = metered.TTSProvider
+	}
+	if validated, ok := set.TTS.(*validatedTTSProvider); ok {
+		set.TTS = validated.TTSProvider
+	}
+
 	// 归还ASR提供者
-	if set.ASR != nil && pm.asrPool != nil {
+	if asrPool := set.returnPool("ASR", pm.asrPool); set.ASR != nil && asrPool != nil {
+		// 热词按会话设置（可能含有用户记忆中的词），归还前清空，避免下一个会话继承
+		if setter, ok := set.ASR.(providers.HotwordSetter); ok {
+			setter.SetHotwords(nil)
+		}
 		// 重置资源状态
-		if err := pm.asrPool.Reset(set.ASR); err != nil {
+		if err := asrPool.Reset(set.ASR); err != nil {
 			pm.logger.Warn("重置ASR资源状态失败: %v", err)
 		}
 		// 归还到池中
-		if err := pm.asrPool.Put(set.ASR); err != nil {
+		if err := asrPool.Put(set.ASR); err != nil {
 			errs = append(errs, fmt.Errorf("归还ASR提供者失败: %v", err))
 			pm.logger.Error("归还ASR提供者失败: %v", err)
 		} else {
@@ -239,11 +346,11 @@ func (pm *PoolManager) ReturnProviderSet(set *ProviderSet) error {
 	}
 
 	// 归还LLM提供者
-	if set.LLM != nil && pm.llmPool != nil {
-		if err := pm.llmPool.Reset(set.LLM); err != nil {
+	if llmPool := set.returnPool("LLM", pm.llmPool); set.LLM != nil && llmPool != nil {
+		if err := llmPool.Reset(set.LLM); err != nil {
 			pm.logger.Warn("重置LLM资源状态失败: %v", err)
 		}
-		if err := pm.llmPool.Put(set.LLM); err != nil {
+		if err := llmPool.Put(set.LLM); err != nil {
 			errs = append(errs, fmt.Errorf("归还LLM提供者失败: %v", err))
 			pm.logger.Error("归还LLM提供者失败: %v", err)
 		} else {
@@ -252,11 +359,11 @@ func (pm *PoolManager) ReturnProviderSet(set *ProviderSet) error {
 	}
 
 	// 归还TTS提供者
-	if set.TTS != nil && pm.ttsPool != nil {
-		if err := pm.ttsPool.Reset(set.TTS); err != nil {
+	if ttsPool := set.returnPool("TTS", pm.ttsPool); set.TTS != nil && ttsPool != nil {
+		if err := ttsPool.Reset(set.TTS); err != nil {
 			pm.logger.Warn("重置TTS资源状态失败: %v", err)
 		}
-		if err := pm.ttsPool.Put(set.TTS); err != nil {
+		if err := ttsPool.Put(set.TTS); err != nil {
 			errs = append(errs, fmt.Errorf("归还TTS提供者失败: %v", err))
 			pm.logger.Error("归还TTS提供者失败: %v", err)
 		} else {
@@ -265,11 +372,11 @@ func (pm *PoolManager) ReturnProviderSet(set *ProviderSet) error {
 	}
 
 	// 归还VLLLM提供者
-	if set.VLLLM != nil && pm.vlllmPool != nil {
-		if err := pm.vlllmPool.Reset(set.VLLLM); err != nil {
+	if vlllmPool := set.returnPool("VLLLM", pm.vlllmPool); set.VLLLM != nil && vlllmPool != nil {
+		if err := vlllmPool.Reset(set.VLLLM); err != nil {
 			pm.logger.Warn("重置VLLLM资源状态失败: %v", err)
 		}
-		if err := pm.vlllmPool.Put(set.VLLLM); err != nil {
+		if err := vlllmPool.Put(set.VLLLM); err != nil {
 			errs = append(errs, fmt.Errorf("归还VLLLM提供者失败: %v", err))
 			pm.logger.Error("归还VLLLM提供者失败: %v", err)
 		} else {
@@ -298,6 +405,14 @@ func (pm *PoolManager) ReturnProviderSet(set *ProviderSet) error {
 	return nil
 }
 
+// returnPool 提供者应归还的资源池：归还到取出时的资源池（租户资源池或当时的平台资源池），没有记录时归还到当前平台资源池
+func (set *ProviderSet) returnPool(category string, platform *ResourcePool) *ResourcePool {
+	if pool := set.pools[category]; pool != nil {
+		return pool
+	}
+	return platform
+}
+
 // GetStats 获取所有池的统计信息
 func (pm *PoolManager) GetStats() map[string]map[string]int {
 	stats := make(map[string]map[string]int)
@@ -310,11 +425,18 @@ func (pm *PoolManager) GetStats() map[string]map[string]int {
 	if pm.llmPool != nil {
 		available, total := pm.llmPool.GetStats()
 		stats["llm"] = map[string]int{"available": available, "total": total}
+		mergeLimiterStats(stats["llm"], pm.providerLimiter("LLM"))
 	}
 
 	if pm.ttsPool != nil {
 		available, total := pm.ttsPool.GetStats()
 		stats["tts"] = map[string]int{"available": available, "total": total}
+		mergeLimiterStats(stats["tts"], pm.providerLimiter("TTS"))
+		if pm.ttsFallback != nil {
+			for key, value := range pm.ttsFallback.GetStats() {
+				stats["tts"][key] = value
+			}
+		}
 	}
 
 	if pm.vlllmPool != nil {
@@ -327,6 +449,7 @@ func (pm *PoolManager) GetStats() map[string]map[string]int {
 		stats["mcp"] = map[string]int{"available": available, "total": total}
 	}
 
+	pm.mergeEvictionStats(stats)
 	return stats
 }
 
@@ -363,10 +486,12 @@ func (pm *PoolManager) GetDetailedStats() map[string]map[string]int {
 
 	if pm.llmPool != nil {
 		stats["llm"] = pm.llmPool.GetDetailedStats()
+		mergeLimiterStats(stats["llm"], pm.providerLimiter("LLM"))
 	}
 
 	if pm.ttsPool != nil {
 		stats["tts"] = pm.ttsPool.GetDetailedStats()
+		mergeLimiterStats(stats["tts"], pm.providerLimiter("TTS"))
 	}
 
 	if pm.vlllmPool != nil {
@@ -377,9 +502,37 @@ func (pm *PoolManager) GetDetailedStats() map[string]map[string]int {
 		stats["mcp"] = pm.mcpPool.GetDetailedStats()
 	}
 
+	pm.mergeEvictionStats(stats)
 	return stats
 }
 
+// newProviderLimiter 根据provider配置创建并发限制器，未配置并发上限时返回nil
+func (pm *PoolManager) newProviderLimiter(category, name string) *ConcurrencyLimiter {
+	if pm.configService == nil {
+		return nil
+	}
+	providerConfig, err := pm.configService.GetProviderConfigByCategoryAndName(category, name)
+	if err != nil || providerConfig == nil {
+		return nil
+	}
+	if providerConfig.MaxConcurrency <= 0 {
+		return nil
+	}
+	pm.logger.Info("%s/%s 启用并发限制: %d, 排队超时: %ds", category, name, providerConfig.MaxConcurrency, providerConfig.QueueTimeout)
+	return NewConcurrencyLimiter(fmt.Sprintf("%s/%s", category, name), providerConfig.MaxConcurrency,
+		time.Duration(providerConfig.QueueTimeout)*time.Second, pm.logger)
+}
+
+// mergeLimiterStats 将并发限制器的状态合并到池统计中
+func mergeLimiterStats(stats map[string]int, limiter *ConcurrencyLimiter) {
+	if limiter == nil {
+		return
+	}
+	for key, value := range limiter.GetStats() {
+		stats[key] = value
+	}
+}
+
 // GetGrayscaleManager 获取灰度发布管理器
 func (pm *PoolManager) GetGrayscaleManager() *GrayscaleManager {
 	return pm.grayscaleManager
@@ -393,6 +546,9 @@ func (pm *PoolManager) ReloadProviderConfig(category, name string) error {
 	if pm.grayscaleManager != nil {
 		_ = pm.grayscaleManager.RefreshConfig(category, name)
 	}
+
+	// 租户资源池基于平台配置创建，随平台资源池一起重建
+	pm.closeTenantPools(func(key tenantPoolKey) bool { return key.Category == category })
 	
 	switch category {
 	case "ASR":
@@ -423,6 +579,7 @@ func (pm *PoolManager) ReloadProviderConfig(category, name string) error {
 			return err
 		}
 		pm.ttsPool = pool
+		pm.reloadProviderLimiter("TTS", name)
 	case "LLM":
 		if pm.llmPool != nil {
 			pm.llmPool.Close()
@@ -437,6 +594,7 @@ func (pm *PoolManager) ReloadProviderConfig(category, name string) error {
 			return err
 		}
 		pm.llmPool = pool
+		pm.reloadProviderLimiter("LLM", name)
 	case "VLLLM":
 		if pm.vlllmPool != nil {
 			pm.vlllmPool.Close()
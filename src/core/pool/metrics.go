@@ -0,0 +1,278 @@
+package pool
+
+import (
+	"ai-server-go/src/core/providers"
+	"ai-server-go/src/core/providers/llm"
+	"ai-server-go/src/core/providers/tts"
+	"ai-server-go/src/core/types"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+/*
+* 按provider版本统计请求结果，供灰度自动回滚判断错误率，以及灰度 latency 策略比较各版本的响应耗时。
+* 以分钟为桶在内存中保留最近一小时的请求数、失败数和成功请求的耗时；LLM/TTS提供者从池中取出时包装统计。
+* 耗时：LLM为收到首个回复片段的时间，TTS为完成合成的时间。
+ */
+
+const metricsRetention = time.Hour
+
+// VersionKey provider版本标识
+type VersionKey struct {
+	Category string `json:"category"`
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+}
+
+// metricsBucket 一分钟内的请求统计
+type metricsBucket struct {
+	minute  int64
+	total   int
+	errors  int
+	latency time.Duration // 有耗时记录的请求的总耗时
+	timed   int           // 有耗时记录的请求数
+}
+
+// RequestMetrics 按版本统计的请求结果
+type RequestMetrics struct {
+	mu      sync.Mutex
+	buckets map[VersionKey][]metricsBucket
+}
+
+// NewRequestMetrics 创建请求统计
+func NewRequestMetrics() *RequestMetrics {
+	return &RequestMetrics{buckets: make(map[VersionKey][]metricsBucket)}
+}
+
+// Record 记录一次请求结果
+func (m *RequestMetrics) Record(key VersionKey, failed bool) {
+	m.record(key, failed, time.Now())
+}
+
+// record 按指定时间记录请求结果
+func (m *RequestMetrics) record(key VersionKey, failed bool, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	bucket := m.bucket(key, now)
+	bucket.total++
+	if failed {
+		bucket.errors++
+	}
+}
+
+// RecordLatency 记录一次成功请求的耗时
+func (m *RequestMetrics) RecordLatency(key VersionKey, latency time.Duration) {
+	m.recordLatency(key, latency, time.Now())
+}
+
+// recordLatency 按指定时间记录请求耗时
+func (m *RequestMetrics) recordLatency(key VersionKey, latency time.Duration, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	bucket := m.bucket(key, now)
+	bucket.latency += latency
+	bucket.timed++
+}
+
+// bucket 返回指定时间所在分钟的桶，并清理超过保留时长的桶，调用方持有锁
+func (m *RequestMetrics) bucket(key VersionKey, now time.Time) *metricsBucket {
+	minute := now.Unix() / 60
+	buckets := m.buckets[key]
+	oldest := now.Add(-metricsRetention).Unix() / 60
+	for len(buckets) > 0 && buckets[0].minute < oldest {
+		buckets = buckets[1:]
+	}
+	if len(buckets) == 0 || buckets[len(buckets)-1].minute != minute {
+		buckets = append(buckets, metricsBucket{minute: minute})
+	}
+	m.buckets[key] = buckets
+	return &buckets[len(buckets)-1]
+}
+
+// ErrorRate 统计窗口内的请求数和错误率
+func (m *RequestMetrics) ErrorRate(key VersionKey, window time.Duration) (float64, int) {
+	return m.errorRate(key, window, time.Now())
+}
+
+// errorRate 按指定时间统计窗口内的请求数和错误率
+func (m *RequestMetrics) errorRate(key VersionKey, window time.Duration, now time.Time) (float64, int) {
+	since := now.Add(-window).Unix() / 60
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	total, errors := 0, 0
+	for _, bucket := range m.buckets[key] {
+		if bucket.minute >= since {
+			total += bucket.total
+			errors += bucket.errors
+		}
+	}
+	if total == 0 {
+		return 0, 0
+	}
+	return float64(errors) / float64(total), total
+}
+
+// AverageLatency 统计窗口内成功请求的平均耗时和样本数
+func (m *RequestMetrics) AverageLatency(key VersionKey, window time.Duration) (time.Duration, int) {
+	return m.averageLatency(key, window, time.Now())
+}
+
+// averageLatency 按指定时间统计窗口内的平均耗时
+func (m *RequestMetrics) averageLatency(key VersionKey, window time.Duration, now time.Time) (time.Duration, int) {
+	since := now.Add(-window).Unix() / 60
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var total time.Duration
+	samples := 0
+	for _, bucket := range m.buckets[key] {
+		if bucket.minute >= since {
+			total += bucket.latency
+			samples += bucket.timed
+		}
+	}
+	if samples == 0 {
+		return 0, 0
+	}
+	return total / time.Duration(samples), samples
+}
+
+// LastRequest 指定类别最近一次请求所在分钟的开始时间，没有请求时返回零值
+func (m *RequestMetrics) LastRequest(category string) time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var minute int64
+	for key, buckets := range m.buckets {
+		if key.Category == category && len(buckets) > 0 && buckets[len(buckets)-1].minute > minute {
+			minute = buckets[len(buckets)-1].minute
+		}
+	}
+	if minute == 0 {
+		return time.Time{}
+	}
+	return time.Unix(minute*60, 0)
+}
+
+// Keys 返回有统计数据的版本
+func (m *RequestMetrics) Keys() []VersionKey {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]VersionKey, 0, len(m.buckets))
+	for key := range m.buckets {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Reset 清除指定版本的统计（重新启用回滚版本时调用，避免旧错误再次触发回滚）
+func (m *RequestMetrics) Reset(key VersionKey) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.buckets, key)
+}
+
+// meteredLLMProvider 统计请求结果的LLM提供者
+type meteredLLMProvider struct {
+	providers.LLMProvider
+	metrics *RequestMetrics
+	key     VersionKey
+}
+
+// Response 调用LLM并记录调用是否失败，以及收到首个回复片段的耗时
+func (p *meteredLLMProvider) Response(ctx context.Context, sessionID string, messages []types.Message) (<-chan string, error) {
+	start := time.Now()
+	inner, err := p.LLMProvider.Response(ctx, sessionID, messages)
+	p.metrics.Record(p.key, err != nil)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan string, 10)
+	go func() {
+		defer close(out)
+		first := true
+		for chunk := range inner {
+			if first {
+				first = false
+				p.metrics.RecordLatency(p.key, time.Since(start))
+			}
+			select {
+			case out <- chunk:
+			case <-ctx.Done():
+				go drainChannel(inner)
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// ResponseWithFunctions 调用LLM，流结束后按是否出现错误记录结果
+func (p *meteredLLMProvider) ResponseWithFunctions(ctx context.Context, sessionID string, messages []types.Message, tools []openai.Tool) (<-chan types.Response, error) {
+	start := time.Now()
+	inner, err := p.LLMProvider.ResponseWithFunctions(ctx, sessionID, messages, tools)
+	if err != nil {
+		p.metrics.Record(p.key, true)
+		return nil, err
+	}
+
+	out := make(chan types.Response, 10)
+	go func() {
+		defer close(out)
+		failed, first := false, true
+		defer func() { p.metrics.Record(p.key, failed) }()
+		for response := range inner {
+			if response.Error != "" {
+				failed = true
+			} else if first {
+				first = false
+				p.metrics.RecordLatency(p.key, time.Since(start))
+			}
+			select {
+			case out <- response:
+			case <-ctx.Done():
+				go drainChannel(inner)
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Config 透传LLM配置，保持与未包装提供者一致的配置读取方式
+func (p *meteredLLMProvider) Config() *llm.Config {
+	if getter, ok := p.LLMProvider.(interface{ Config() *llm.Config }); ok {
+		return getter.Config()
+	}
+	return nil
+}
+
+// meteredTTSProvider 统计请求结果的TTS提供者
+type meteredTTSProvider struct {
+	providers.TTSProvider
+	metrics *RequestMetrics
+	key     VersionKey
+}
+
+// ToTTS 合成语音并记录是否失败和成功合成的耗时
+func (p *meteredTTSProvider) ToTTS(ctx context.Context, text string) (string, error) {
+	start := time.Now()
+	filepath, err := p.TTSProvider.ToTTS(ctx, text)
+	p.metrics.Record(p.key, err != nil)
+	if err == nil {
+		p.metrics.RecordLatency(p.key, time.Since(start))
+	}
+	return filepath, err
+}
+
+// Config 透传TTS配置，保持与未包装提供者一致的配置读取方式
+func (p *meteredTTSProvider) Config() *tts.Config {
+	if getter, ok := p.TTSProvider.(interface{ Config() *tts.Config }); ok {
+		return getter.Config()
+	}
+	return nil
+}
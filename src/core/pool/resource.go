@@ -34,6 +34,9 @@ type ResourcePool struct {
 	logger      *utils.Logger
 	ctx         context.Context
 	cancel      context.CancelFunc
+	config      PoolConfig   // 创建时的配置，重建资源池时沿用
+	closeMu     sync.RWMutex // 保护 closed，避免关闭后仍向通道写入（驱逐时资源池在运行中关闭）
+	closed      bool
 }
 
 // PoolConfig 资源池配置
@@ -56,6 +59,7 @@ func NewResourcePool(factory ResourceFactory, config PoolConfig, logger *utils.L
 		logger:  logger,
 		ctx:     ctx,
 		cancel:  cancel,
+		config:  config,
 	}
 
 	// 预创建最小数量的资源
@@ -134,7 +138,10 @@ func (p *ResourcePool) refillPool(refillSize int) {
 				continue
 			}
 
+			p.closeMu.RLock()
 			select {
+			case <-p.ctx.Done():
+				p.factory.Destroy(resource)
 			case p.pool <- resource:
 				p.mutex.Lock()
 				p.currentSize++
@@ -143,14 +150,22 @@ func (p *ResourcePool) refillPool(refillSize int) {
 				// 池满了，销毁资源
 				p.factory.Destroy(resource)
 			}
+			p.closeMu.RUnlock()
 		}
 	}
 }
 
 // Close 关闭资源池
 func (p *ResourcePool) Close() {
+	p.closeMu.Lock()
+	if p.closed {
+		p.closeMu.Unlock()
+		return
+	}
+	p.closed = true
 	p.cancel()
 	close(p.pool)
+	p.closeMu.Unlock()
 
 	// 销毁剩余资源
 	for resource := range p.pool {
@@ -164,11 +179,11 @@ func (p *ResourcePool) Put(resource interface{}) error {
 		return fmt.Errorf("不能将nil资源归还到池中")
 	}
 
-	// 检查池是否已关闭
-	select {
-	case <-p.ctx.Done():
+	// 检查池是否已关闭，持有读锁直到写入通道完成
+	p.closeMu.RLock()
+	defer p.closeMu.RUnlock()
+	if p.closed {
 		return p.factory.Destroy(resource)
-	default:
 	}
 
 	// 设置归还超时
@@ -0,0 +1,239 @@
+package pool
+
+import (
+	"ai-server-go/src/core/scheduler"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+/*
+* 灰度自动回滚：定期检查非默认版本在统计窗口内的错误率，超过阈值时将其权重置为0并把流量转回默认版本，
+* 重建对应资源池、记录审计日志并发送告警webhook。回滚后的版本需管理员通过 reenable 接口重新启用后
+* 才能再次分配流量，避免反复回滚。配置来自系统配置 grayscale 分类（检查间隔修改后重启生效）。
+ */
+
+const (
+	defaultAutoRollbackInterval = 30 * time.Second
+	alertWebhookTimeout         = 5 * time.Second
+)
+
+// AutoRollbackSettings 自动回滚配置
+type AutoRollbackSettings struct {
+	Enabled       bool          // 是否启用自动回滚
+	ErrorRate     float64       // 错误率阈值（0-1）
+	Window        time.Duration // 错误率统计窗口
+	MinRequests   int           // 窗口内最少请求数，样本不足时不判断
+	CheckInterval time.Duration // 检查间隔
+	WebhookURL    string        // 回滚告警webhook地址，为空时不发送
+}
+
+// autoRollbackSettings 读取系统配置 grayscale 分类中的自动回滚配置
+func (pm *PoolManager) autoRollbackSettings() AutoRollbackSettings {
+	settings := AutoRollbackSettings{
+		ErrorRate:     0.2,
+		Window:        5 * time.Minute,
+		MinRequests:   20,
+		CheckInterval: defaultAutoRollbackInterval,
+	}
+	if pm.configService == nil {
+		return settings
+	}
+	if value, err := pm.configService.GetSystemConfigBool("grayscale", "auto_rollback_enabled"); err == nil {
+		settings.Enabled = value
+	}
+	if value, err := pm.configService.GetSystemConfigFloat("grayscale", "auto_rollback_error_rate"); err == nil && value > 0 {
+		settings.ErrorRate = value
+	}
+	if value, err := pm.configService.GetSystemConfigInt("grayscale", "auto_rollback_window_seconds"); err == nil && value > 0 {
+		settings.Window = time.Duration(value) * time.Second
+	}
+	if value, err := pm.configService.GetSystemConfigInt("grayscale", "auto_rollback_min_requests"); err == nil && value > 0 {
+		settings.MinRequests = value
+	}
+	if value, err := pm.configService.GetSystemConfigInt("grayscale", "auto_rollback_check_seconds"); err == nil && value > 0 {
+		settings.CheckInterval = time.Duration(value) * time.Second
+	}
+	if value, err := pm.configService.GetSystemConfigValue("grayscale", "alert_webhook_url"); err == nil {
+		settings.WebhookURL = value
+	}
+	return settings
+}
+
+// autoRollbackJob 自动回滚检查任务，注册到灰度管理器的调度器，Close时随之停止
+func (pm *PoolManager) autoRollbackJob() scheduler.Job {
+	return scheduler.Job{
+		Name:     "grayscale-auto-rollback",
+		Interval: pm.autoRollbackSettings().CheckInterval,
+		Run: func(ctx context.Context) error {
+			if settings := pm.autoRollbackSettings(); settings.Enabled {
+				pm.checkAutoRollback(settings)
+			}
+			return nil
+		},
+	}
+}
+
+// checkAutoRollback 检查所有有统计数据的非默认版本，错误率超过阈值时回滚
+func (pm *PoolManager) checkAutoRollback(settings AutoRollbackSettings) {
+	if pm.metrics == nil || pm.grayscaleManager == nil {
+		return
+	}
+	for _, key := range pm.metrics.Keys() {
+		rate, total := pm.metrics.ErrorRate(key, settings.Window)
+		if total < settings.MinRequests || rate <= settings.ErrorRate {
+			continue
+		}
+		if !pm.isCanaryVersion(key) {
+			continue
+		}
+		pm.rollbackVersion(key, rate, total, settings)
+	}
+}
+
+// ProviderHealth provider版本在自动回滚统计窗口内的请求情况
+type ProviderHealth struct {
+	VersionKey
+	Requests  int     `json:"requests"`   // 窗口内的请求数
+	ErrorRate float64 `json:"error_rate"` // 窗口内的错误率（0-1）
+	Healthy   bool    `json:"healthy"`    // 错误率未超过自动回滚阈值，或样本不足无法判断
+}
+
+// ProviderHealth 按自动回滚的统计窗口和阈值汇总各provider版本的健康状况，供管理端展示
+func (pm *PoolManager) ProviderHealth() []ProviderHealth {
+	if pm.metrics == nil {
+		return nil
+	}
+	settings := pm.autoRollbackSettings()
+	keys := pm.metrics.Keys()
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Category != keys[j].Category {
+			return keys[i].Category < keys[j].Category
+		}
+		if keys[i].Name != keys[j].Name {
+			return keys[i].Name < keys[j].Name
+		}
+		return keys[i].Version < keys[j].Version
+	})
+	health := make([]ProviderHealth, 0, len(keys))
+	for _, key := range keys {
+		rate, total := pm.metrics.ErrorRate(key, settings.Window)
+		if total == 0 {
+			continue
+		}
+		health = append(health, ProviderHealth{
+			VersionKey: key,
+			Requests:   total,
+			ErrorRate:  rate,
+			Healthy:    total < settings.MinRequests || rate <= settings.ErrorRate,
+		})
+	}
+	return health
+}
+
+// isCanaryVersion 版本是否为仍有流量、未被回滚的非默认版本
+func (pm *PoolManager) isCanaryVersion(key VersionKey) bool {
+	status, err := pm.grayscaleManager.GetGrayscaleStatus(key.Category, key.Name)
+	if err != nil || status == nil {
+		return false
+	}
+	status.mu.RLock()
+	defer status.mu.RUnlock()
+	for _, version := range status.Versions {
+		if version.Version != key.Version {
+			continue
+		}
+		return version.IsActive && !version.IsDefault && version.Weight > 0 &&
+			(version.Config == nil || version.Config.RolledBackAt == nil)
+	}
+	return false
+}
+
+// rollbackVersion 回滚版本：权重置0转回默认版本，刷新灰度缓存并重建资源池，记录审计并发送告警
+func (pm *PoolManager) rollbackVersion(key VersionKey, rate float64, total int, settings AutoRollbackSettings) {
+	result, err := pm.configService.RollbackProviderVersion(key.Category, key.Name, key.Version)
+	if err != nil {
+		pm.logger.Error("灰度版本 %s/%s@%s 错误率 %.2f 超过阈值，自动回滚失败: %v", key.Category, key.Name, key.Version, rate, err)
+		return
+	}
+	pm.logger.Warn("灰度版本 %s/%s@%s 在 %s 内错误率 %.2f（%d 次请求）超过阈值 %.2f，已自动回滚: %v -> %v",
+		key.Category, key.Name, key.Version, settings.Window, rate, total, settings.ErrorRate, result.Before, result.After)
+
+	if err := pm.grayscaleManager.RefreshConfig(key.Category, key.Name); err != nil {
+		pm.logger.Error("回滚后刷新灰度配置失败: %v", err)
+	}
+	// 当前资源池使用的是该provider时重建，按新权重重新选择版本
+	if factory := pm.poolFactory(key.Category); factory != nil && factory.name == key.Name && factory.version == key.Version {
+		if err := pm.ReloadProviderConfig(key.Category, key.Name); err != nil {
+			pm.logger.Error("回滚后重建资源池失败: %v", err)
+		}
+	}
+
+	detail := map[string]interface{}{
+		"error_rate":     rate,
+		"requests":       total,
+		"threshold":      settings.ErrorRate,
+		"window_seconds": int(settings.Window.Seconds()),
+		"before":         result.Before,
+		"after":          result.After,
+	}
+	if err := pm.configService.RecordProviderAudit(key.Category, key.Name, key.Version, "rollback", nil, detail); err != nil {
+		pm.logger.Error("记录自动回滚审计失败: %v", err)
+	}
+	if settings.WebhookURL != "" {
+		detail["event"] = "provider_auto_rollback"
+		detail["category"] = key.Category
+		detail["name"] = key.Name
+		detail["version"] = key.Version
+		detail["time"] = time.Now().Format(time.RFC3339)
+		if err := sendAlertWebhook(settings.WebhookURL, detail); err != nil {
+			pm.logger.Error("发送自动回滚告警失败: %v", err)
+		}
+	}
+}
+
+// ReenableProviderVersion 重新启用被自动回滚的版本：清除回滚标记和错误统计，权重保持为0，由管理员重新放量
+func (pm *PoolManager) ReenableProviderVersion(category, name, version string) error {
+	if err := pm.configService.ReenableProviderVersion(category, name, version); err != nil {
+		return err
+	}
+	if pm.metrics != nil {
+		pm.metrics.Reset(VersionKey{Category: category, Name: name, Version: version})
+	}
+	if pm.grayscaleManager != nil {
+		return pm.grayscaleManager.RefreshConfig(category, name)
+	}
+	return nil
+}
+
+// poolFactory 获取类别当前资源池的工厂
+func (pm *PoolManager) poolFactory(category string) *ProviderFactory {
+	pool := pm.platformPool(category)
+	if pool == nil {
+		return nil
+	}
+	factory, _ := pool.factory.(*ProviderFactory)
+	return factory
+}
+
+// sendAlertWebhook 以JSON POST发送告警
+func sendAlertWebhook(url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("序列化告警内容失败: %v", err)
+	}
+	client := &http.Client{Timeout: alertWebhookTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("请求告警webhook失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("告警webhook返回状态码: %d", resp.StatusCode)
+	}
+	return nil
+}
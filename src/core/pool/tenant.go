@@ -0,0 +1,143 @@
+package pool
+
+import (
+	"ai-server-go/src/core/providers/llm"
+	"ai-server-go/src/core/providers/tts"
+	"ai-server-go/src/core/providers/vlllm"
+	"ai-server-go/src/database"
+	"encoding/json"
+	"time"
+)
+
+/*
+* 租户自带凭证：设备所有者为当前provider配置了自己的凭证（ProviderCredential）时，
+* 按 (类别, provider, 用户) 单独建池，用平台配置合并用户凭证后的参数创建实例，实例只归还到该用户的池，
+* 不会被其他用户取到。租户实例不参与平台的并发限制和灰度错误率统计。
+* 平台provider重建或用户凭证变更时关闭对应的租户池，之后按新配置重新创建。
+ */
+
+// tenantPoolKey 租户资源池的键
+type tenantPoolKey struct {
+	Category string
+	Name     string
+	UserID   uint
+}
+
+// tenantPoolConfig 租户资源池按需创建实例，不预创建
+var tenantPoolConfig = PoolConfig{
+	MinSize:       0,
+	MaxSize:       20,
+	RefillSize:    0,
+	CheckInterval: time.Minute,
+}
+
+// tenantPool 获取用户在该类别当前provider上的资源池，用户未配置凭证时返回nil
+func (pm *PoolManager) tenantPool(category string, userID *uint) *ResourcePool {
+	if userID == nil || pm.configService == nil {
+		return nil
+	}
+	factory := pm.poolFactory(category)
+	if factory == nil {
+		return nil
+	}
+	credential, err := pm.configService.GetProviderCredential(*userID, category, factory.name)
+	if err != nil {
+		pm.logger.Error("查询用户 %d 的provider凭证失败，使用平台凭证: %v", *userID, err)
+		return nil
+	}
+	if credential == nil {
+		return nil
+	}
+
+	key := tenantPoolKey{Category: category, Name: factory.name, UserID: *userID}
+	pm.tenantMu.Lock()
+	defer pm.tenantMu.Unlock()
+	if pool, ok := pm.tenantPools[key]; ok {
+		return pool
+	}
+	tenantFactory, rejected := factory.withCredential(credential)
+	if len(rejected) > 0 {
+		pm.logger.Warn("用户 %d 的 %s/%s 凭证包含不允许覆盖的参数，已忽略: %v", *userID, category, factory.name, rejected)
+	}
+	pool, err := NewResourcePool(tenantFactory, tenantPoolConfig, pm.logger)
+	if err != nil {
+		pm.logger.Error("创建用户 %d 的 %s/%s 资源池失败，使用平台凭证: %v", *userID, category, factory.name, err)
+		return nil
+	}
+	if pm.tenantPools == nil {
+		pm.tenantPools = make(map[tenantPoolKey]*ResourcePool)
+	}
+	pm.tenantPools[key] = pool
+	pm.logger.Info("为用户 %d 创建 %s/%s 自带凭证资源池", *userID, category, factory.name)
+	return pool
+}
+
+// closeTenantPools 关闭满足条件的租户资源池，已取出的实例归还时直接销毁
+func (pm *PoolManager) closeTenantPools(match func(key tenantPoolKey) bool) {
+	pm.tenantMu.Lock()
+	defer pm.tenantMu.Unlock()
+	for key, pool := range pm.tenantPools {
+		if match(key) {
+			pool.Close()
+			delete(pm.tenantPools, key)
+		}
+	}
+}
+
+// InvalidateTenantPools 用户凭证变更后关闭该用户的资源池
+func (pm *PoolManager) InvalidateTenantPools(userID uint) {
+	pm.closeTenantPools(func(key tenantPoolKey) bool { return key.UserID == userID })
+}
+
+// withCredential 复制工厂并用凭证参数覆盖平台配置，只应用允许覆盖的参数，返回被忽略的参数名
+func (f *ProviderFactory) withCredential(credential map[string]interface{}) (*ProviderFactory, []string) {
+	copied := *f
+	var rejected []string
+	switch cfg := f.config.(type) {
+	case *llm.Config:
+		config := *cfg
+		var allowed map[string]interface{}
+		allowed, rejected = database.SanitizeCredentialProps(cfg.Extra, credential)
+		config.Extra = mergeProps(cfg.Extra, allowed)
+		copied.config = &config
+	case *tts.Config:
+		config := *cfg
+		var allowed map[string]interface{}
+		allowed, rejected = database.SanitizeCredentialProps(cfg.Props, credential)
+		config.Props = mergeProps(cfg.Props, allowed)
+		copied.config = &config
+	case *vlllm.VLLLMConfig:
+		config := *cfg
+		var allowed map[string]interface{}
+		allowed, rejected = database.SanitizeCredentialProps(cfg.Extra, credential)
+		config.Extra = mergeProps(cfg.Extra, allowed)
+		copied.config = &config
+	}
+	return &copied, rejected
+}
+
+// mergeProps 合并参数，override中的同名参数优先
+func mergeProps(base, override map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base)+len(override))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range override {
+		merged[key] = value
+	}
+	return merged
+}
+
+// redactedConfig 序列化工厂配置用于日志，密钥脱敏
+func redactedConfig(config interface{}) string {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return ""
+	}
+	var props map[string]interface{}
+	if err := json.Unmarshal(data, &props); err != nil {
+		return ""
+	}
+	data, _ = json.MarshalIndent(database.RedactSecrets(props), "", "  ")
+	return string(data)
+}
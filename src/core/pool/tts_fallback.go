@@ -0,0 +1,286 @@
+package pool
+
+import (
+	"ai-server-go/src/core/providers"
+	"ai-server-go/src/core/providers/tts"
+	"ai-server-go/src/core/utils"
+	"ai-server-go/src/database"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultTTSFallbackCooldown 主TTS失败后直接使用备用提供者的时长，避免主备之间来回切换
+const defaultTTSFallbackCooldown = 60 * time.Second
+
+// ttsFallbackEntry 备用TTS提供者（懒创建，跨连接共享）
+type ttsFallbackEntry struct {
+	name     string
+	mu       sync.Mutex // 备用提供者在连接间共享，串行合成
+	provider providers.TTSProvider
+}
+
+// TTSFallback TTS降级链：主TTS合成失败时按顺序尝试同类别的其他TTS提供者
+type TTSFallback struct {
+	primary          string
+	configService    *database.ConfigService
+	grayscaleManager *GrayscaleManager
+	logger           *utils.Logger
+	deleteAudio      bool
+
+	mu            sync.Mutex
+	chain         []*ttsFallbackEntry
+	cooldown      time.Duration
+	degradedUntil time.Time // 在此之前主TTS视为不可用
+
+	primaryFailures int64 // 主TTS失败次数
+	fallbackCount   int64 // 使用备用TTS成功合成的次数
+	fallbackErrors  int64 // 备用TTS全部失败的次数
+}
+
+// NewTTSFallback 创建TTS降级链，系统配置 tts_fallback/enabled 为false或没有可用的备用提供者时返回nil
+func NewTTSFallback(primary string, configService *database.ConfigService, grayscaleManager *GrayscaleManager, logger *utils.Logger, deleteAudio bool) *TTSFallback {
+	if configService == nil {
+		return nil
+	}
+	if enabled, err := configService.GetSystemConfigBool("tts_fallback", "enabled"); err == nil && !enabled {
+		return nil
+	}
+
+	fallback := &TTSFallback{
+		primary:          primary,
+		configService:    configService,
+		grayscaleManager: grayscaleManager,
+		logger:           logger,
+		deleteAudio:      deleteAudio,
+		cooldown:         defaultTTSFallbackCooldown,
+	}
+	if seconds, err := configService.GetSystemConfigInt("tts_fallback", "cooldown_seconds"); err == nil && seconds >= 0 {
+		fallback.cooldown = time.Duration(seconds) * time.Second
+	}
+
+	names, err := fallback.resolveChain()
+	if err != nil {
+		logger.Warn("解析TTS降级链失败: %v", err)
+		return nil
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	for _, name := range names {
+		fallback.chain = append(fallback.chain, &ttsFallbackEntry{name: name})
+	}
+	logger.Info("TTS降级链: %s -> %v, 冷却时间: %v", primary, names, fallback.cooldown)
+	return fallback
+}
+
+// resolveChain 确定备用提供者顺序：优先使用 tts_fallback/providers 配置，否则按权重从高到低取其他启用的TTS
+func (f *TTSFallback) resolveChain() ([]string, error) {
+	if names, err := f.configService.GetSystemConfigArray("tts_fallback", "providers"); err == nil && len(names) > 0 {
+		chain := make([]string, 0, len(names))
+		for _, name := range names {
+			if name != "" && name != f.primary {
+				chain = append(chain, name)
+			}
+		}
+		return chain, nil
+	}
+
+	configs, err := f.configService.ListProviderConfigs("TTS")
+	if err != nil {
+		return nil, err
+	}
+	weights := make(map[string]int)
+	for _, config := range configs {
+		if !config.IsActive || config.Name == f.primary {
+			continue
+		}
+		weight := config.Weight
+		if config.IsDefault {
+			weight += 1000 // 默认版本优先
+		}
+		if current, ok := weights[config.Name]; !ok || weight > current {
+			weights[config.Name] = weight
+		}
+	}
+	names := make([]string, 0, len(weights))
+	for name := range weights {
+		names = append(names, name)
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		if weights[names[i]] != weights[names[j]] {
+			return weights[names[i]] > weights[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	return names, nil
+}
+
+// isDegraded 主TTS是否处于降级冷却期
+func (f *TTSFallback) isDegraded() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return time.Now().Before(f.degradedUntil)
+}
+
+// markDegraded 记录主TTS失败并进入冷却期
+func (f *TTSFallback) markDegraded(err error) {
+	atomic.AddInt64(&f.primaryFailures, 1)
+	f.mu.Lock()
+	f.degradedUntil = time.Now().Add(f.cooldown)
+	f.mu.Unlock()
+	f.logger.Warn("主TTS %s 合成失败，%v 内使用备用TTS: %v", f.primary, f.cooldown, err)
+}
+
+// clearDegraded 主TTS恢复后退出降级
+func (f *TTSFallback) clearDegraded() {
+	f.mu.Lock()
+	f.degradedUntil = time.Time{}
+	f.mu.Unlock()
+}
+
+// getProvider 获取（必要时创建）备用提供者，版本选择复用灰度权重
+func (f *TTSFallback) getProvider(entry *ttsFallbackEntry) (providers.TTSProvider, error) {
+	if entry.provider != nil {
+		return entry.provider, nil
+	}
+
+	var providerConfig *database.ProviderConfig
+	var err error
+	if f.grayscaleManager != nil {
+		providerConfig, err = f.grayscaleManager.GetProviderConfig("TTS", entry.name)
+	} else {
+		providerConfig, err = f.configService.GetProviderConfigByCategoryAndName("TTS", entry.name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if providerConfig == nil {
+		return nil, fmt.Errorf("找不到TTS配置: %s", entry.name)
+	}
+
+	props, err := providerConfig.PropsMap()
+	if err != nil {
+		return nil, err
+	}
+	provider, err := tts.Create(providerConfig.Type, &tts.Config{
+		Type:  providerConfig.Type,
+		Props: props,
+	}, f.deleteAudio, f.logger)
+	if err != nil {
+		return nil, err
+	}
+	entry.provider = provider
+	return provider, nil
+}
+
+// synthesizeWithFallback 按降级链依次尝试合成，返回音频文件和合成所用的备用提供者名称
+func (f *TTSFallback) synthesizeWithFallback(ctx context.Context, text string) (string, string, error) {
+	var lastErr error
+	for _, entry := range f.chain {
+		entry.mu.Lock()
+		provider, err := f.getProvider(entry)
+		if err == nil {
+			var filepath string
+			filepath, err = provider.ToTTS(ctx, text)
+			if err == nil {
+				err = checkTTSOutput(filepath)
+			}
+			if err == nil {
+				entry.mu.Unlock()
+				atomic.AddInt64(&f.fallbackCount, 1)
+				f.logger.Warn("%sTTS降级: 使用备用提供者 %s 合成（主提供者 %s）", utils.RequestTag(ctx), entry.name, f.primary)
+				return filepath, entry.name, nil
+			}
+		}
+		entry.mu.Unlock()
+		f.logger.Error("%s备用TTS %s 合成失败: %v", utils.RequestTag(ctx), entry.name, err)
+		lastErr = err
+	}
+	atomic.AddInt64(&f.fallbackErrors, 1)
+	return "", "", fmt.Errorf("所有备用TTS均合成失败: %v", lastErr)
+}
+
+// GetStats 获取降级统计，合并到TTS池状态中
+func (f *TTSFallback) GetStats() map[string]int {
+	degraded := 0
+	if f.isDegraded() {
+		degraded = 1
+	}
+	return map[string]int{
+		"fallback_count":        int(atomic.LoadInt64(&f.fallbackCount)),
+		"fallback_errors":       int(atomic.LoadInt64(&f.fallbackErrors)),
+		"fallback_primary_fail": int(atomic.LoadInt64(&f.primaryFailures)),
+		"fallback_degraded":     degraded,
+	}
+}
+
+// fallbackTTSProvider 带降级链的TTS提供者
+type fallbackTTSProvider struct {
+	providers.TTSProvider
+	fallback *TTSFallback
+}
+
+// ToTTS 主TTS失败时切换到备用提供者；冷却期内直接使用备用提供者，全部失败时再尝试主TTS
+func (p *fallbackTTSProvider) ToTTS(ctx context.Context, text string) (string, error) {
+	filepath, _, err := p.synthesize(ctx, text)
+	return filepath, err
+}
+
+// synthesize 按降级规则合成，返回音频文件和合成所用的备用提供者名称，主TTS合成时名称为空
+func (p *fallbackTTSProvider) synthesize(ctx context.Context, text string) (string, string, error) {
+	if p.fallback.isDegraded() {
+		if filepath, source, err := p.fallback.synthesizeWithFallback(ctx, text); err == nil {
+			return filepath, source, nil
+		}
+		filepath, err := p.TTSProvider.ToTTS(ctx, text)
+		if err == nil {
+			p.fallback.clearDegraded()
+		}
+		return filepath, "", err
+	}
+
+	filepath, err := p.TTSProvider.ToTTS(ctx, text)
+	if err == nil {
+		return filepath, "", nil
+	}
+	p.fallback.markDegraded(err)
+	if fallbackPath, source, fallbackErr := p.fallback.synthesizeWithFallback(ctx, text); fallbackErr == nil {
+		return fallbackPath, source, nil
+	}
+	return "", "", err
+}
+
+// SynthesizeTTS 使用TTS提供者合成语音，返回音频文件和实际合成的备用提供者名称；
+// 由主TTS合成或提供者未接入降级链时名称为空
+func SynthesizeTTS(ctx context.Context, provider providers.TTSProvider, text string) (string, string, error) {
+	if fallback, ok := provider.(*fallbackTTSProvider); ok {
+		return fallback.synthesize(ctx, text)
+	}
+	filepath, err := provider.ToTTS(ctx, text)
+	return filepath, "", err
+}
+
+// Config 透传TTS配置，保持与未包装提供者一致的配置读取方式
+func (p *fallbackTTSProvider) Config() *tts.Config {
+	if getter, ok := p.TTSProvider.(interface{ Config() *tts.Config }); ok {
+		return getter.Config()
+	}
+	return nil
+}
+
+// WrapTTS 按资源池的方式包装集合之外创建的TTS提供者（如会话级覆盖）：校验合成结果，
+// 集合的TTS启用了降级链时同样接入降级链；set为nil时只做校验包装
+func (set *ProviderSet) WrapTTS(provider providers.TTSProvider) providers.TTSProvider {
+	wrapped := providers.TTSProvider(&validatedTTSProvider{TTSProvider: provider})
+	if set == nil {
+		return wrapped
+	}
+	if fallback, ok := set.TTS.(*fallbackTTSProvider); ok {
+		wrapped = &fallbackTTSProvider{TTSProvider: wrapped, fallback: fallback.fallback}
+	}
+	return wrapped
+}
@@ -0,0 +1,45 @@
+package pool
+
+import (
+	"ai-server-go/src/core/providers"
+	"ai-server-go/src/core/providers/tts"
+	"context"
+	"os"
+)
+
+// validatedTTSProvider 校验合成结果的TTS提供者：返回空文件或文件不存在时视为合成失败，
+// 失败会计入版本指标并触发降级链，而不是把空音频下发给设备
+type validatedTTSProvider struct {
+	providers.TTSProvider
+}
+
+// ToTTS 合成后校验音频文件，无效的文件被删除
+func (p *validatedTTSProvider) ToTTS(ctx context.Context, text string) (string, error) {
+	filepath, err := p.TTSProvider.ToTTS(ctx, text)
+	if err != nil {
+		return filepath, err
+	}
+	if err := checkTTSOutput(filepath); err != nil {
+		return "", err
+	}
+	return filepath, nil
+}
+
+// Config 透传TTS配置，保持与未包装提供者一致的配置读取方式
+func (p *validatedTTSProvider) Config() *tts.Config {
+	if getter, ok := p.TTSProvider.(interface{ Config() *tts.Config }); ok {
+		return getter.Config()
+	}
+	return nil
+}
+
+// checkTTSOutput 校验合成的音频文件，无效时删除文件并返回错误
+func checkTTSOutput(filepath string) error {
+	if err := tts.ValidateAudioFile(filepath); err != nil {
+		if filepath != "" {
+			os.Remove(filepath)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package pool
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ai-server-go/src/configs"
+	"ai-server-go/src/core/utils"
+)
+
+// fileTTSProvider 把固定内容写入临时文件的TTS提供者
+type fileTTSProvider struct {
+	dir     string
+	name    string
+	content []byte
+}
+
+func (p *fileTTSProvider) Initialize() error { return nil }
+func (p *fileTTSProvider) Cleanup() error    { return nil }
+
+func (p *fileTTSProvider) ToTTS(ctx context.Context, text string) (string, error) {
+	path := filepath.Join(p.dir, p.name)
+	if err := os.WriteFile(path, p.content, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// testWAV 生成指定时长的16kHz单声道16位WAV数据
+func testWAV(ms int) []byte {
+	const byteRate = 16000 * 2
+	dataSize := byteRate * ms / 1000
+	data := make([]byte, 44+dataSize)
+	copy(data[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(data[4:8], uint32(36+dataSize))
+	copy(data[8:12], "WAVE")
+	copy(data[12:16], "fmt ")
+	binary.LittleEndian.PutUint32(data[16:20], 16)
+	binary.LittleEndian.PutUint16(data[20:22], 1)
+	binary.LittleEndian.PutUint16(data[22:24], 1)
+	binary.LittleEndian.PutUint32(data[24:28], 16000)
+	binary.LittleEndian.PutUint32(data[28:32], byteRate)
+	binary.LittleEndian.PutUint16(data[32:34], 2)
+	binary.LittleEndian.PutUint16(data[34:36], 16)
+	copy(data[36:40], "data")
+	binary.LittleEndian.PutUint32(data[40:44], uint32(dataSize))
+	return data
+}
+
+func newTestLogger(t *testing.T) *utils.Logger {
+	t.Helper()
+	config := &configs.Config{}
+	config.Log.LogDir = t.TempDir()
+	config.Log.LogFile = "test.log"
+	config.Log.LogLevel = "ERROR"
+	logger, err := utils.NewLogger(config)
+	if err != nil {
+		t.Fatalf("创建日志失败: %v", err)
+	}
+	return logger
+}
+
+func TestValidatedTTSProviderRejectsEmptyOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content []byte
+		wantErr bool
+	}{
+		{name: "空mp3", file: "empty.mp3", content: nil, wantErr: true},
+		{name: "过小的mp3", file: "tiny.mp3", content: make([]byte, 16), wantErr: true},
+		{name: "只有文件头的wav", file: "header.wav", content: testWAV(0), wantErr: true},
+		{name: "时长过短的wav", file: "short.wav", content: testWAV(10), wantErr: true},
+		{name: "正常wav", file: "ok.wav", content: testWAV(500), wantErr: false},
+		{name: "正常mp3", file: "ok.mp3", content: make([]byte, 4096), wantErr: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			provider := &validatedTTSProvider{TTSProvider: &fileTTSProvider{dir: dir, name: tt.file, content: tt.content}}
+			path, err := provider.ToTTS(context.Background(), "你好")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("期望合成失败，实际返回 %s", path)
+				}
+				if path != "" {
+					t.Fatalf("合成失败时不应返回文件路径，实际为 %s", path)
+				}
+				if _, statErr := os.Stat(filepath.Join(dir, tt.file)); !os.IsNotExist(statErr) {
+					t.Fatalf("无效的音频文件应被删除")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("正常音频不应报错: %v", err)
+			}
+			if _, err := os.Stat(path); err != nil {
+				t.Fatalf("正常音频文件不应被删除: %v", err)
+			}
+		})
+	}
+}
+
+func TestFallbackOnEmptyTTSOutput(t *testing.T) {
+	dir := t.TempDir()
+	primary := &fileTTSProvider{dir: dir, name: "primary.mp3"}
+	backup := &fileTTSProvider{dir: dir, name: "backup.wav", content: testWAV(500)}
+	fallback := &TTSFallback{
+		primary: "primary",
+		logger:  newTestLogger(t),
+		chain:   []*ttsFallbackEntry{{name: "backup", provider: backup}},
+	}
+	provider := &fallbackTTSProvider{
+		TTSProvider: &validatedTTSProvider{TTSProvider: primary},
+		fallback:    fallback,
+	}
+
+	path, source, err := SynthesizeTTS(context.Background(), provider, "你好")
+	if err != nil {
+		t.Fatalf("主TTS返回空文件时应使用备用TTS: %v", err)
+	}
+	if path != filepath.Join(dir, "backup.wav") || source != "backup" {
+		t.Fatalf("期望使用备用TTS backup 的音频，实际为 %s (%q)", path, source)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "primary.mp3")); !os.IsNotExist(err) {
+		t.Fatalf("主TTS的空文件应被删除")
+	}
+	if stats := fallback.GetStats(); stats["fallback_primary_fail"] != 1 || stats["fallback_count"] != 1 {
+		t.Fatalf("降级统计不正确: %v", stats)
+	}
+
+	// 备用TTS同样返回空文件时整体合成失败，由调用方播报失败提示
+	backup.content = nil
+	fallback.clearDegraded()
+	if path, err := provider.ToTTS(context.Background(), "你好"); err == nil {
+		t.Fatalf("主备TTS都返回空文件时应合成失败，实际返回 %s", path)
+	}
+
+	// 主TTS正常合成时不记录备用TTS名称
+	primary.content = testWAV(500)
+	if _, source, err := SynthesizeTTS(context.Background(), provider, "你好"); err != nil || source != "" {
+		t.Fatalf("主TTS合成时备用名称应为空，实际 %q: %v", source, err)
+	}
+}
+
+func TestProviderSetWrapTTSUsesFallback(t *testing.T) {
+	dir := t.TempDir()
+	fallback := &TTSFallback{
+		primary: "primary",
+		logger:  newTestLogger(t),
+		chain:   []*ttsFallbackEntry{{name: "backup", provider: &fileTTSProvider{dir: dir, name: "backup.wav", content: testWAV(500)}}},
+	}
+	set := &ProviderSet{TTS: &fallbackTTSProvider{TTSProvider: &fileTTSProvider{dir: dir, name: "pool.wav", content: testWAV(500)}, fallback: fallback}}
+
+	// 会话覆盖的TTS返回空文件时，同样切换到资源池的备用TTS
+	override := set.WrapTTS(&fileTTSProvider{dir: dir, name: "override.mp3"})
+	path, err := override.ToTTS(context.Background(), "你好")
+	if err != nil {
+		t.Fatalf("覆盖的TTS失败时应使用备用TTS: %v", err)
+	}
+	if path != filepath.Join(dir, "backup.wav") {
+		t.Fatalf("期望使用备用TTS的音频，实际为 %s", path)
+	}
+
+	// 没有集合时只校验合成结果
+	var empty *ProviderSet
+	if path, err := empty.WrapTTS(&fileTTSProvider{dir: dir, name: "override.mp3"}).ToTTS(context.Background(), "你好"); err == nil {
+		t.Fatalf("空文件应合成失败，实际返回 %s", path)
+	}
+}
@@ -0,0 +1,124 @@
+package pool
+
+import (
+	"ai-server-go/src/core/providers"
+	"ai-server-go/src/core/scheduler"
+	"ai-server-go/src/core/types"
+	"context"
+	"fmt"
+	"time"
+)
+
+/*
+* LLM预热：自部署的LLM（如Ollama）空闲一段时间后会卸载模型，下一次请求的首token延迟很高。
+* 启用后定期向默认LLM发送一个极短的请求，收到首个输出即取消，使模型保持常驻；
+* 最近已有真实请求时跳过本次预热。预热请求不计入灰度统计，但遵守LLM并发限制。
+* 配置来自系统配置 llm_warmup 分类，启用开关和提示词每次执行时读取，间隔修改后重启生效。
+ */
+
+const (
+	defaultWarmupInterval = 4 * time.Minute
+	defaultWarmupTimeout  = 30 * time.Second
+	warmupSessionID       = "llm-warmup"
+)
+
+// WarmupSettings LLM预热配置
+type WarmupSettings struct {
+	Enabled  bool          // 是否启用预热
+	Interval time.Duration // 预热间隔
+	Idle     time.Duration // 最近这段时间内有真实请求时跳过预热
+	Prompt   string        // 预热请求的提示词
+	Timeout  time.Duration // 单次预热请求超时
+}
+
+// warmupSettings 读取系统配置 llm_warmup 分类中的预热配置
+func (pm *PoolManager) warmupSettings() WarmupSettings {
+	settings := WarmupSettings{
+		Interval: defaultWarmupInterval,
+		Prompt:   "你好",
+		Timeout:  defaultWarmupTimeout,
+	}
+	if pm.configService != nil {
+		if value, err := pm.configService.GetSystemConfigBool("llm_warmup", "enabled"); err == nil {
+			settings.Enabled = value
+		}
+		if value, err := pm.configService.GetSystemConfigInt("llm_warmup", "interval_seconds"); err == nil && value > 0 {
+			settings.Interval = time.Duration(value) * time.Second
+		}
+		if value, err := pm.configService.GetSystemConfigInt("llm_warmup", "idle_seconds"); err == nil && value > 0 {
+			settings.Idle = time.Duration(value) * time.Second
+		}
+		if value, err := pm.configService.GetSystemConfigValue("llm_warmup", "prompt"); err == nil && value != "" {
+			settings.Prompt = value
+		}
+		if value, err := pm.configService.GetSystemConfigInt("llm_warmup", "timeout_seconds"); err == nil && value > 0 {
+			settings.Timeout = time.Duration(value) * time.Second
+		}
+	}
+	if settings.Idle <= 0 {
+		settings.Idle = settings.Interval
+	}
+	return settings
+}
+
+// warmupJob LLM预热任务，注册到灰度管理器的调度器，Close时随之停止
+func (pm *PoolManager) warmupJob() scheduler.Job {
+	return scheduler.Job{
+		Name:     "llm-warmup",
+		Interval: pm.warmupSettings().Interval,
+		Run: func(ctx context.Context) error {
+			settings := pm.warmupSettings()
+			if !settings.Enabled {
+				return nil
+			}
+			if last := pm.metrics.LastRequest("LLM"); !last.IsZero() && time.Since(last) < settings.Idle {
+				pm.logger.Debug("LLM最近 %v 内有请求，跳过预热", settings.Idle)
+				return nil
+			}
+			return pm.warmupLLM(ctx, settings)
+		},
+	}
+}
+
+// warmupLLM 从默认LLM资源池取出一个实例发送预热请求，收到首个输出后取消
+func (pm *PoolManager) warmupLLM(ctx context.Context, settings WarmupSettings) error {
+	if pm.llmPool == nil {
+		return nil
+	}
+	resource, err := pm.llmPool.Get()
+	if err != nil {
+		return fmt.Errorf("获取LLM提供者失败: %v", err)
+	}
+	defer pm.llmPool.Put(resource)
+
+	provider, ok := resource.(providers.LLMProvider)
+	if !ok {
+		return fmt.Errorf("资源池中的LLM提供者类型无效: %T", resource)
+	}
+	if limiter := pm.providerLimiter("LLM"); limiter != nil {
+		provider = &limitedLLMProvider{LLMProvider: provider, limiter: limiter}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, settings.Timeout)
+	defer cancel()
+	start := time.Now()
+	responses, err := provider.Response(ctx, warmupSessionID, []types.Message{
+		{Role: "user", Content: settings.Prompt},
+	})
+	if err != nil {
+		return fmt.Errorf("LLM预热请求失败: %v", err)
+	}
+	// 收到首个输出说明模型已加载，取消剩余的生成并等待输出结束后再归还实例
+	_, ok = <-responses
+	timedOut := ctx.Err() == context.DeadlineExceeded
+	cancel()
+	drainChannel(responses)
+	if !ok {
+		if timedOut {
+			return fmt.Errorf("LLM预热请求超时: %v", settings.Timeout)
+		}
+		return fmt.Errorf("LLM预热请求没有输出")
+	}
+	pm.logger.Debug("LLM预热完成，首个输出耗时 %v", time.Since(start))
+	return nil
+}
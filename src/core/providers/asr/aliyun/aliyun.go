@@ -2,27 +2,37 @@ package aliyun
 
 import (
 	"ai-server-go/src/core/providers/asr"
+	"ai-server-go/src/core/providers/schema"
+	"ai-server-go/src/core/utils"
 	"context"
 	"encoding/json"
-	
+	"fmt"
+	"sync"
 	"time"
+
 	"github.com/aliyun/alibabacloud-nls-go-sdk"
 )
 
 type AliyunASRConfig struct {
-	AppKey    string `json:"app_key"`
-	AccessKey string `json:"access_key"`
-	Secret    string `json:"secret"`
-	Region    string `json:"region"`
-	Mode      string `json:"mode"`      // rest/ws
-	Language  string `json:"language"`
-	Model     string `json:"model"`
+	AppKey        string `json:"app_key" schema:"required"`
+	AccessKey     string `json:"access_key"`
+	Secret        string `json:"secret" schema:"secret"`
+	Token         string `json:"token" schema:"secret"`                                                 // 直接使用的访问令牌，为空时用 access_key/secret 获取
+	URL           string `json:"url" schema:"default=wss://nls-gateway.cn-shanghai.aliyuncs.com/ws/v1"` // 网关地址，默认上海节点
+	Region        string `json:"region"`
+	Mode          string `json:"mode"` // rest/ws
+	Language      string `json:"language"`
+	Model         string `json:"model"`
+	SampleRate    int    `json:"sample_rate" schema:"default=16000"`
+	MaxEndSilence int    `json:"max_end_silence" schema:"default=800"` // 服务端断句的静音时长(ms)
 }
 
-type asrEventListener interface {
-	OnAsrPartialResult(result string)
-	OnAsrFinalResult(result string)
-}
+const (
+	defaultSampleRate    = 16000
+	defaultMaxEndSilence = 800
+	// startTimeout 等待识别任务启动的最长时间
+	startTimeout = 10 * time.Second
+)
 
 func parseProps(props map[string]interface{}, out interface{}) error {
 	b, err := json.Marshal(props)
@@ -32,88 +42,236 @@ func parseProps(props map[string]interface{}, out interface{}) error {
 	return json.Unmarshal(b, out)
 }
 
+// Provider 阿里云一句话识别：AddAudio 边收边发，中间结果和最终结果经监听器实时回调
 type Provider struct {
 	*asr.BaseProvider
-	config   AliyunASRConfig
-	listener asrEventListener
+	config AliyunASRConfig
+	logger *utils.Logger
+
+	mu sync.Mutex
+	sr *nls.SpeechRecognition // 当前流式识别任务，一句话结束后置空，下次AddAudio重新建立
 }
 
-func NewProvider(config *asr.Config, deleteFile bool, logger interface{}) (*Provider, error) {
+func NewProvider(config *asr.Config, deleteFile bool, logger *utils.Logger) (*Provider, error) {
 	var cfg AliyunASRConfig
 	if err := parseProps(config.Data, &cfg); err != nil {
 		return nil, err
 	}
-	return &Provider{
+	if cfg.AppKey == "" {
+		return nil, fmt.Errorf("缺少app_key配置")
+	}
+	if cfg.URL == "" {
+		cfg.URL = nls.DEFAULT_URL
+	}
+	if cfg.SampleRate <= 0 {
+		cfg.SampleRate = defaultSampleRate
+	}
+	if cfg.MaxEndSilence <= 0 {
+		cfg.MaxEndSilence = defaultMaxEndSilence
+	}
+	provider := &Provider{
 		BaseProvider: asr.NewBaseProvider(config, deleteFile),
 		config:       cfg,
-	}, nil
+		logger:       logger,
+	}
+	provider.InitAudioProcessing()
+	return provider, nil
 }
 
-func (p *Provider) SetListener(listener asrEventListener) {
-	p.listener = listener
+// connectionConfig 构造NLS连接配置，未配置token时用AccessKey获取
+func (p *Provider) connectionConfig() (*nls.ConnectionConfig, error) {
+	if p.config.Token != "" {
+		return nls.NewConnectionConfigWithToken(p.config.URL, p.config.AppKey, p.config.Token), nil
+	}
+	config, err := nls.NewConnectionConfigWithAKInfoDefault(p.config.URL, p.config.AppKey, p.config.AccessKey, p.config.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("获取阿里云访问令牌失败: %v", err)
+	}
+	return config, nil
 }
 
-func (p *Provider) Transcribe(ctx context.Context, audioData []byte) (string, error) {
-	return p.transcribeSDK(ctx, audioData)
+// startParam 识别参数，开启中间结果和服务端断句
+func (p *Provider) startParam() (nls.SpeechRecognitionStartParam, map[string]interface{}) {
+	param := nls.DefaultSpeechRecognitionParam()
+	param.SampleRate = p.config.SampleRate
+	extra := map[string]interface{}{
+		"enable_voice_detection": true,
+		"max_end_silence":        p.config.MaxEndSilence,
+	}
+	return param, extra
 }
 
-func (p *Provider) transcribeSDK(ctx context.Context, audioData []byte) (string, error) {
-	config := nls.NewConnectionConfigWithAKInfoDefault(
-		nls.DEFAULT_URL,
-		p.config.AppKey,
-		p.config.AccessKey,
-		p.config.Secret,
-	)
-	logger := nls.DefaultNlsLog()
+// parseResult 从SDK回调的消息中取出识别文本
+func parseResult(text string) string {
+	var message struct {
+		Payload struct {
+			Result string `json:"result"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal([]byte(text), &message); err != nil {
+		return ""
+	}
+	return message.Payload.Result
+}
+
+// Transcribe 一次性识别整段音频，不回调监听器
+func (p *Provider) Transcribe(ctx context.Context, audioData []byte) (string, error) {
+	config, err := p.connectionConfig()
+	if err != nil {
+		return "", utils.RequestErrorf(ctx, "%v", err)
+	}
 	var finalResult string
 	sr, err := nls.NewSpeechRecognition(
-		config, logger,
+		config, nls.DefaultNlsLog(),
 		func(text string, param interface{}) {}, // onTaskFailed
 		func(text string, param interface{}) {}, // onStarted
-		func(text string, param interface{}) { // onResultChanged
-			finalResult = text
-			if p.listener != nil {
-				p.listener.OnAsrPartialResult(text)
-			}
-		},
+		func(text string, param interface{}) {}, // onResultChanged
 		func(text string, param interface{}) { // onCompleted
-			finalResult = text
-			if p.listener != nil {
-				p.listener.OnAsrFinalResult(text)
-			}
+			finalResult = parseResult(text)
 		},
 		func(param interface{}) {}, // onClose
 		nil,
 	)
 	if err != nil {
-		return "", err
+		return "", utils.RequestErrorf(ctx, "创建识别任务失败: %v", err)
 	}
-	param := nls.DefaultSpeechRecognitionParam()
+	defer sr.Shutdown()
+	param, _ := p.startParam()
 	ready, err := sr.Start(param, nil)
 	if err != nil {
-		return "", err
+		return "", utils.RequestErrorf(ctx, "启动识别任务失败: %v", err)
+	}
+	if ok := <-ready; !ok {
+		return "", utils.RequestErrorf(ctx, "启动识别任务失败")
 	}
-	<-ready
 	frameSize := 3200
 	for i := 0; i < len(audioData); i += frameSize {
-		end := i + frameSize
-		if end > len(audioData) {
-			end = len(audioData)
+		end := min(i+frameSize, len(audioData))
+		if err := sr.SendAudioData(audioData[i:end]); err != nil {
+			return "", utils.RequestErrorf(ctx, "发送音频数据失败: %v", err)
 		}
-		sr.SendAudioData(audioData[i:end])
 		time.Sleep(10 * time.Millisecond)
 	}
 	ready, err = sr.Stop()
 	if err != nil {
-		return "", err
+		return "", utils.RequestErrorf(ctx, "结束识别任务失败: %v", err)
 	}
 	<-ready
-	sr.Shutdown()
 	return finalResult, nil
 }
 
+// AddAudio 将音频送入当前识别任务，没有进行中的任务时新建一个
+func (p *Provider) AddAudio(data []byte) error {
+	sr, err := p.ensureStreaming()
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	if err := sr.SendAudioData(data); err != nil {
+		p.detach(sr)
+		go sr.Shutdown()
+		return utils.RequestErrorf(p.RequestContext(), "发送音频数据失败: %v", err)
+	}
+	return nil
+}
+
+// ensureStreaming 返回进行中的识别任务，没有时建立新任务并等待服务端就绪
+func (p *Provider) ensureStreaming() (*nls.SpeechRecognition, error) {
+	p.mu.Lock()
+	sr := p.sr
+	p.mu.Unlock()
+	if sr != nil {
+		return sr, nil
+	}
+
+	ctx := p.RequestContext()
+	p.logger.Info("%s----阿里云开始流式识别----", utils.RequestTag(ctx))
+	p.ResetStartListenTime()
+	config, err := p.connectionConfig()
+	if err != nil {
+		return nil, utils.RequestErrorf(ctx, "%v", err)
+	}
+	sr, err = nls.NewSpeechRecognition(
+		config, nls.DefaultNlsLog(),
+		func(text string, param interface{}) { // onTaskFailed
+			p.logger.Error("%s阿里云识别任务失败: %s", utils.RequestTag(ctx), text)
+			p.detach(sr)
+		},
+		func(text string, param interface{}) {}, // onStarted
+		func(text string, param interface{}) { // onResultChanged
+			p.NotifyPartialResult(parseResult(text))
+		},
+		func(text string, param interface{}) { // onCompleted
+			// 服务端断句后本次任务结束，后续音频进入新任务
+			p.detach(sr)
+			go sr.Shutdown()
+			if listener := p.GetListener(); listener != nil {
+				listener.OnAsrResult(parseResult(text))
+			}
+		},
+		func(param interface{}) { // onClose
+			p.detach(sr)
+		},
+		nil,
+	)
+	if err != nil {
+		return nil, utils.RequestErrorf(ctx, "创建识别任务失败: %v", err)
+	}
+
+	param, extra := p.startParam()
+	ready, err := sr.Start(param, extra)
+	if err != nil {
+		return nil, utils.RequestErrorf(ctx, "启动识别任务失败: %v", err)
+	}
+	select {
+	case ok := <-ready:
+		if !ok {
+			sr.Shutdown()
+			return nil, utils.RequestErrorf(ctx, "启动识别任务失败")
+		}
+	case <-time.After(startTimeout):
+		sr.Shutdown()
+		return nil, utils.RequestErrorf(ctx, "等待识别任务启动超时")
+	}
+
+	p.mu.Lock()
+	p.sr = sr
+	p.mu.Unlock()
+	return sr, nil
+}
+
+// detach 识别任务结束时解除关联，仅当它仍是当前任务
+func (p *Provider) detach(sr *nls.SpeechRecognition) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sr == sr {
+		p.sr = nil
+	}
+}
+
+// Reset 结束当前识别任务
+func (p *Provider) Reset() error {
+	p.mu.Lock()
+	sr := p.sr
+	p.sr = nil
+	p.mu.Unlock()
+	if sr != nil {
+		sr.Shutdown()
+	}
+	p.InitAudioProcessing()
+	return nil
+}
+
+// Cleanup 释放识别连接
+func (p *Provider) Cleanup() error {
+	return p.Reset()
+}
+
 func init() {
-	asr.Register("aliyun", func(config *asr.Config, deleteFile bool, logger interface{}) (asr.Provider, error) {
+	asr.Register("aliyun", func(config *asr.Config, deleteFile bool, logger *utils.Logger) (asr.Provider, error) {
 		return NewProvider(config, deleteFile, logger)
 	})
+	schema.Register("ASR", "aliyun", AliyunASRConfig{})
 }
@@ -3,7 +3,10 @@ package asr
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"fmt"
+	"math"
+	"sync"
 	"time"
 
 	"ai-server-go/src/core/providers"
@@ -21,6 +24,14 @@ type Provider interface {
 	providers.ASRProvider
 }
 
+// 静音检测默认值，可通过provider配置 silence_threshold、silence_duration_ms、idle_timeout_ms 覆盖
+const (
+	defaultSilenceThreshold = 0.01             // 归一化RMS能量阈值
+	defaultSilenceDuration  = 800              // 说话后静音多久视为一句话结束(ms)
+	defaultIdleTimeout      = 30 * time.Second // 开始收听后多久没有语音视为一次静音
+	defaultSampleRate       = 16000            // 识别所需的默认输入采样率
+)
+
 // BaseProvider ASR基础实现
 type BaseProvider struct {
 	config     *Config
@@ -31,30 +42,127 @@ type BaseProvider struct {
 	audioBuffer   *bytes.Buffer
 
 	// 静音检测配置
-	silenceThreshold float64 // 能量阈值
-	silenceDuration  int     // 静音持续时间(ms)
+	silenceThreshold float64       // 能量阈值
+	silenceDuration  int           // 静音持续时间(ms)
+	idleTimeout      time.Duration // 无语音超时
 
+	silenceMu       sync.Mutex
 	StartListenTime time.Time // 最后一次ASR处理时间
 	SilenceCount    int       // 连续静音计数
+	lastVoiceTime   time.Time // 本次收听中最后一次检测到语音的时间
+	confidence      float64   // 本次收听识别结果的置信度
+	hasConfidence   bool      // 服务端是否返回了置信度
 
 	listener providers.AsrEventListener
+
+	requestMu  sync.Mutex
+	requestCtx context.Context // 流式识别使用的context，携带会话/设备/链路标识
 }
 
+// ResetStartListenTime 开始新一次收听，重置静音计时
 func (p *BaseProvider) ResetStartListenTime() {
+	p.silenceMu.Lock()
+	defer p.silenceMu.Unlock()
 	p.StartListenTime = time.Now()
+	p.lastVoiceTime = time.Time{}
+	p.hasConfidence = false
+}
+
+// SetConfidence 记录本次识别结果的置信度，由解析到置信度的提供者调用
+func (p *BaseProvider) SetConfidence(confidence float64) {
+	p.silenceMu.Lock()
+	defer p.silenceMu.Unlock()
+	p.confidence = confidence
+	p.hasConfidence = true
 }
 
+// LastConfidence 最近一次识别结果的置信度，实现 providers.ConfidenceReporter
+func (p *BaseProvider) LastConfidence() (float64, bool) {
+	p.silenceMu.Lock()
+	defer p.silenceMu.Unlock()
+	return p.confidence, p.hasConfidence
+}
+
+// SilenceTime 距离开始收听或最后一次检测到语音的时长
 func (p *BaseProvider) SilenceTime() time.Duration {
-	if p.StartListenTime.IsZero() {
+	p.silenceMu.Lock()
+	defer p.silenceMu.Unlock()
+	return p.silenceTime()
+}
+
+// silenceTime 静音时长（需持有锁）
+func (p *BaseProvider) silenceTime() time.Duration {
+	since := p.StartListenTime
+	if p.lastVoiceTime.After(since) {
+		since = p.lastVoiceTime
+	}
+	if since.IsZero() {
 		return 0
 	}
-	return time.Since(p.StartListenTime)
+	return time.Since(since)
 }
 
+// GetSilenceCount 获取连续静音计数
 func (p *BaseProvider) GetSilenceCount() int {
+	p.silenceMu.Lock()
+	defer p.silenceMu.Unlock()
 	return p.SilenceCount
 }
 
+// ResetSilenceCount 识别到有效语音后清零静音计数
+func (p *BaseProvider) ResetSilenceCount() {
+	p.silenceMu.Lock()
+	defer p.silenceMu.Unlock()
+	p.SilenceCount = 0
+}
+
+// ObserveAudio 根据PCM(16bit小端)能量更新语音活动状态
+func (p *BaseProvider) ObserveAudio(pcm []byte) {
+	if len(pcm) < 2 {
+		return
+	}
+	var sum float64
+	samples := len(pcm) / 2
+	for i := 0; i < samples; i++ {
+		sample := float64(int16(binary.LittleEndian.Uint16(pcm[i*2:]))) / 32768.0
+		sum += sample * sample
+	}
+	p.ObserveVAD(math.Sqrt(sum/float64(samples)) >= p.silenceThreshold)
+}
+
+// ObserveVAD 使用VAD判定结果更新语音活动状态
+func (p *BaseProvider) ObserveVAD(isSpeech bool) {
+	if !isSpeech {
+		return
+	}
+	p.silenceMu.Lock()
+	defer p.silenceMu.Unlock()
+	p.lastVoiceTime = time.Now()
+}
+
+// IsSpeechEnded 本次收听中检测到过语音，且之后的静音超过静音持续时间
+func (p *BaseProvider) IsSpeechEnded() bool {
+	p.silenceMu.Lock()
+	defer p.silenceMu.Unlock()
+	if p.lastVoiceTime.IsZero() || p.lastVoiceTime.Before(p.StartListenTime) {
+		return false
+	}
+	return time.Since(p.lastVoiceTime) >= time.Duration(p.silenceDuration)*time.Millisecond
+}
+
+// CheckIdle 检查是否无语音超时，超时则增加静音计数并重新计时，返回是否发生超时
+func (p *BaseProvider) CheckIdle() bool {
+	p.silenceMu.Lock()
+	defer p.silenceMu.Unlock()
+	if p.StartListenTime.IsZero() || p.silenceTime() < p.idleTimeout {
+		return false
+	}
+	p.SilenceCount++
+	p.StartListenTime = time.Now()
+	p.lastVoiceTime = time.Time{}
+	return true
+}
+
 // SetListener 设置事件监听器
 func (p *BaseProvider) SetListener(listener providers.AsrEventListener) {
 	p.listener = listener
@@ -65,6 +173,40 @@ func (p *BaseProvider) GetListener() providers.AsrEventListener {
 	return p.listener
 }
 
+// NotifyPartialResult 将流式识别的中间结果通知给实现了 providers.AsrPartialListener 的监听器
+func (p *BaseProvider) NotifyPartialResult(result string) {
+	if listener, ok := p.listener.(providers.AsrPartialListener); ok && result != "" {
+		listener.OnAsrPartialResult(result)
+	}
+}
+
+// SetRequestContext 设置后续流式识别使用的context，实现 providers.RequestContextSetter
+func (p *BaseProvider) SetRequestContext(ctx context.Context) {
+	p.requestMu.Lock()
+	defer p.requestMu.Unlock()
+	p.requestCtx = ctx
+}
+
+// RequestContext 获取流式识别使用的context，未设置时返回 context.Background()
+func (p *BaseProvider) RequestContext() context.Context {
+	p.requestMu.Lock()
+	defer p.requestMu.Unlock()
+	if p.requestCtx == nil {
+		return context.Background()
+	}
+	return p.requestCtx
+}
+
+// InputSampleRate 识别所需的输入采样率，可通过provider配置 sample_rate 覆盖，默认16kHz
+func (p *BaseProvider) InputSampleRate() int {
+	if p.config != nil && p.config.Data != nil {
+		if v, ok := p.config.Data["sample_rate"].(float64); ok && v > 0 {
+			return int(v)
+		}
+	}
+	return defaultSampleRate
+}
+
 // Config 获取配置
 func (p *BaseProvider) Config() *Config {
 	return p.config
@@ -92,10 +234,25 @@ func (p *BaseProvider) DeleteFile() bool {
 
 // NewBaseProvider 创建ASR基础提供者
 func NewBaseProvider(config *Config, deleteFile bool) *BaseProvider {
-	return &BaseProvider{
-		config:     config,
-		deleteFile: deleteFile,
+	p := &BaseProvider{
+		config:           config,
+		deleteFile:       deleteFile,
+		silenceThreshold: defaultSilenceThreshold,
+		silenceDuration:  defaultSilenceDuration,
+		idleTimeout:      defaultIdleTimeout,
+	}
+	if config != nil && config.Data != nil {
+		if v, ok := config.Data["silence_threshold"].(float64); ok && v > 0 {
+			p.silenceThreshold = v
+		}
+		if v, ok := config.Data["silence_duration_ms"].(float64); ok && v > 0 {
+			p.silenceDuration = int(v)
+		}
+		if v, ok := config.Data["idle_timeout_ms"].(float64); ok && v > 0 {
+			p.idleTimeout = time.Duration(v) * time.Millisecond
+		}
 	}
+	return p
 }
 
 // Initialize 初始化提供者
@@ -138,8 +295,12 @@ func Create(name string, config *Config, deleteFile bool, logger *utils.Logger)
 // 初始化音频处理
 func (p *BaseProvider) InitAudioProcessing() {
 	p.audioBuffer = new(bytes.Buffer)
-	p.silenceThreshold = 0.01 // 默认能量阈值
-	p.silenceDuration = 800   // 默认静音判断时长(ms)
+	if p.silenceThreshold <= 0 {
+		p.silenceThreshold = defaultSilenceThreshold
+	}
+	if p.silenceDuration <= 0 {
+		p.silenceDuration = defaultSilenceDuration
+	}
 }
 
 // Transcribe 直接识别音频数据（基础实现）
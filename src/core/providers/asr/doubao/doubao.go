@@ -10,11 +10,13 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"ai-server-go/src/core/providers/asr"
+	"ai-server-go/src/core/providers/schema"
 	"ai-server-go/src/core/utils"
 
 	"github.com/gorilla/websocket"
@@ -42,9 +44,6 @@ const (
 	thriftFormat      = 0x3
 	gzipCompression   = 0x1
 	customCompression = 0xF
-
-	// 超时设置
-	idleTimeout = 30 * time.Second // 没有新数据就结束识别
 )
 
 // Ensure Provider implements asr.Provider interface
@@ -52,17 +51,50 @@ var _ asr.Provider = (*Provider)(nil)
 
 // 配置结构体
 type DoubaoASRConfig struct {
-	AppID         string `json:"appid"`
-	AccessToken   string `json:"access_token"`
+	AppID         string `json:"appid" schema:"required"`
+	AccessToken   string `json:"access_token" schema:"required,secret"`
 	OutputDir     string `json:"output_dir"`
-	Host          string `json:"host"`
+	Host          string `json:"host" schema:"default=openspeech.bytedance.com"`
 	WSURL         string `json:"ws_url"`
-	ModelName     string `json:"model_name"`
-	ChunkDuration int    `json:"chunk_duration"`
-	EndWindowSize int    `json:"end_window_size"`
+	ModelName     string `json:"model_name" schema:"default=bigmodel"`
+	Language      string `json:"language" schema:"default=zh-CN"` // 识别语言，设备asr能力的 language_engines 可按语言覆盖
+	ChunkDuration int    `json:"chunk_duration" schema:"default=200"`
+	EndWindowSize int    `json:"end_window_size" schema:"default=800"`
 	EnablePunc    bool   `json:"enable_punc"`
 	EnableITN     bool   `json:"enable_itn"`
 	EnableDDC     bool   `json:"enable_ddc"`
+	MaxHotwords   int    `json:"max_hotwords" schema:"default=100"` // 单次识别最多下发的热词数
+	Streaming     bool   `json:"streaming"`                         // 未配置ws_url时使用流式接口(bigmodel)，实时返回中间结果
+}
+
+// defaultMaxHotwords 默认最多下发的热词数
+const defaultMaxHotwords = 100
+
+// supportedModels 支持的识别模型
+var supportedModels = []string{"bigmodel"}
+
+// supportedLanguages 大模型识别支持的语言，简写（如 en）按前缀匹配第一项
+var supportedLanguages = []string{
+	"zh-CN", "yue-CN", "en-US", "ja-JP", "ko-KR", "id-ID", "es-MX", "pt-BR", "de-DE", "fr-FR",
+	"fil-PH", "ms-MY", "th-TH", "ar-SA", "it-IT", "bn-BD", "el-GR", "nl-NL", "ru-RU", "tr-TR",
+	"vi-VN", "pl-PL", "ro-RO", "ne-NP", "uk-UA",
+}
+
+// normalizeLanguage 将语言转换为支持的语言代码，不支持时返回空
+func normalizeLanguage(language string) string {
+	language = strings.TrimSpace(language)
+	for _, supported := range supportedLanguages {
+		if strings.EqualFold(supported, language) {
+			return supported
+		}
+	}
+	prefix, _, _ := strings.Cut(language, "-")
+	for _, supported := range supportedLanguages {
+		if base, _, _ := strings.Cut(supported, "-"); strings.EqualFold(base, prefix) {
+			return supported
+		}
+	}
+	return ""
 }
 
 // 通用配置解析
@@ -87,11 +119,15 @@ type Provider struct {
 	logger        *utils.Logger // 添加日志记录器
 
 	// 配置
-	modelName     string
-	endWindowSize int
-	enablePunc    bool
-	enableITN     bool
-	enableDDC     bool
+	modelName       string
+	language        string
+	defaultModel    string     // 提供者配置的模型，SelectEngine 未指定时使用
+	defaultLanguage string     // 提供者配置的语言
+	engineMutex     sync.Mutex // 保护按语言选择的模型和语言
+	endWindowSize   int
+	enablePunc      bool
+	enableITN       bool
+	enableDDC       bool
 
 	// 流式识别相关字段
 	conn        *websocket.Conn
@@ -102,6 +138,10 @@ type Provider struct {
 	connMutex   sync.Mutex // 添加互斥锁保护连接状态
 
 	sendDataCnt int // 计数器，用于跟踪发送的音频数据包数量
+
+	hotwords      []string   // 上下文热词，建立识别连接时随首包下发
+	hotwordsMutex sync.Mutex // 保护热词，避免与连接建立互相阻塞
+	maxHotwords   int        // 最多下发的热词数
 }
 
 // NewProvider 创建豆包ASR提供者实例
@@ -131,34 +171,47 @@ func NewProvider(config *asr.Config, deleteFile bool, logger *utils.Logger) (*Pr
 	if cfg.Host == "" {
 		cfg.Host = "openspeech.bytedance.com"
 	}
+	if cfg.WSURL == "" && cfg.Streaming {
+		cfg.WSURL = "wss://openspeech.bytedance.com/api/v3/sauc/bigmodel"
+	}
 	if cfg.WSURL == "" {
 		cfg.WSURL = "wss://openspeech.bytedance.com/api/v3/sauc/bigmodel_nostream"
 	}
 	if cfg.ModelName == "" {
 		cfg.ModelName = "bigmodel"
 	}
+	if cfg.Language == "" {
+		cfg.Language = "zh-CN"
+	}
 	if cfg.ChunkDuration == 0 {
 		cfg.ChunkDuration = 200
 	}
 	if cfg.EndWindowSize == 0 {
 		cfg.EndWindowSize = 800
 	}
+	if cfg.MaxHotwords <= 0 {
+		cfg.MaxHotwords = defaultMaxHotwords
+	}
 
 	provider := &Provider{
-		BaseProvider:  asr.NewBaseProvider(config, deleteFile),
-		appID:         cfg.AppID,
-		accessToken:   cfg.AccessToken,
-		outputDir:     cfg.OutputDir,
-		host:          cfg.Host,
-		wsURL:         cfg.WSURL,
-		chunkDuration: cfg.ChunkDuration,
-		connectID:     fmt.Sprintf("%d", time.Now().UnixNano()),
-		logger:        logger,
-		modelName:     cfg.ModelName,
-		endWindowSize: cfg.EndWindowSize,
-		enablePunc:    cfg.EnablePunc,
-		enableITN:     cfg.EnableITN,
-		enableDDC:     cfg.EnableDDC,
+		BaseProvider:    asr.NewBaseProvider(config, deleteFile),
+		appID:           cfg.AppID,
+		accessToken:     cfg.AccessToken,
+		outputDir:       cfg.OutputDir,
+		host:            cfg.Host,
+		wsURL:           cfg.WSURL,
+		chunkDuration:   cfg.ChunkDuration,
+		connectID:       fmt.Sprintf("%d", time.Now().UnixNano()),
+		logger:          logger,
+		modelName:       cfg.ModelName,
+		language:        cfg.Language,
+		defaultModel:    cfg.ModelName,
+		defaultLanguage: cfg.Language,
+		endWindowSize:   cfg.EndWindowSize,
+		enablePunc:      cfg.EnablePunc,
+		enableITN:       cfg.EnableITN,
+		enableDDC:       cfg.EnableDDC,
+		maxHotwords:     cfg.MaxHotwords,
 	}
 
 	provider.InitAudioProcessing()
@@ -184,7 +237,7 @@ func (p *Provider) TestTranscribe() (string, error) {
 		fmt.Println("没有PCM数据可提取")
 	}
 
-	result, err := p.Transcribe(context.Background(), monoPcmDataBytes)
+	result, err := p.Transcribe(p.RequestContext(), monoPcmDataBytes)
 	if err != nil {
 		fmt.Println("转录失败: ", err.Error())
 	} else {
@@ -197,7 +250,7 @@ func (p *Provider) TestTranscribe() (string, error) {
 // Transcribe 实现asr.Provider接口的转录方法
 func (p *Provider) Transcribe(ctx context.Context, audioData []byte) (string, error) {
 	if p.isStreaming {
-		return "", fmt.Errorf("正在进行流式识别, 请先调用Reset")
+		return "", utils.RequestErrorf(ctx, "正在进行流式识别, 请先调用Reset")
 	}
 
 	// 自动获取采样率（仅支持WAV头部，MP3建议用文件方式）
@@ -210,7 +263,7 @@ func (p *Provider) Transcribe(ctx context.Context, audioData []byte) (string, er
 	// 创建临时文件
 	tempFile := filepath.Join(p.outputDir, fmt.Sprintf("temp_%d.wav", time.Now().UnixNano()))
 	if err := utils.SaveAudioToWavFile(audioData, tempFile, sampleRate, 1, 16); err != nil {
-		return "", fmt.Errorf("保存临时WAV文件失败: %v", err)
+		return "", utils.RequestErrorf(ctx, "保存临时WAV文件失败: %v", err)
 	}
 	defer func() {
 		if p.DeleteFile() {
@@ -242,30 +295,100 @@ func (p *Provider) generateHeader(messageType uint8, flags uint8, serializationM
 	return header
 }
 
+// SetHotwords 设置上下文热词，下一次建立识别连接时生效
+func (p *Provider) SetHotwords(words []string) {
+	p.hotwordsMutex.Lock()
+	defer p.hotwordsMutex.Unlock()
+	p.hotwords = append([]string(nil), words...)
+}
+
+// MaxHotwords 单次识别最多下发的热词数
+func (p *Provider) MaxHotwords() int {
+	return p.maxHotwords
+}
+
+// SupportedEngines 支持的识别模型
+func (p *Provider) SupportedEngines() []string {
+	return append([]string(nil), supportedModels...)
+}
+
+// SelectEngine 设置后续识别使用的语言和模型，为空的一项使用提供者配置的默认值，下一次建立识别连接时生效
+func (p *Provider) SelectEngine(language, engine string) error {
+	model := p.defaultModel
+	if engine != "" {
+		if !slices.Contains(supportedModels, engine) {
+			return fmt.Errorf("豆包ASR不支持的模型: %s", engine)
+		}
+		model = engine
+	}
+	lang := p.defaultLanguage
+	if language != "" {
+		if lang = normalizeLanguage(language); lang == "" {
+			return fmt.Errorf("豆包ASR不支持的语言: %s", language)
+		}
+	}
+
+	p.engineMutex.Lock()
+	defer p.engineMutex.Unlock()
+	p.modelName = model
+	p.language = lang
+	return nil
+}
+
+// hotwordsContext 构造热词上下文（corpus.context 为JSON字符串）
+func (p *Provider) hotwordsContext() string {
+	p.hotwordsMutex.Lock()
+	defer p.hotwordsMutex.Unlock()
+	if len(p.hotwords) == 0 {
+		return ""
+	}
+
+	hotwords := make([]map[string]string, 0, len(p.hotwords))
+	for _, word := range p.hotwords {
+		hotwords = append(hotwords, map[string]string{"word": word})
+	}
+	data, err := json.Marshal(map[string]interface{}{"hotwords": hotwords})
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
 // constructRequest 构造请求数据
 func (p *Provider) constructRequest() map[string]interface{} {
-	return map[string]interface{}{
+	p.engineMutex.Lock()
+	modelName, language := p.modelName, p.language
+	p.engineMutex.Unlock()
+
+	request := map[string]interface{}{
 		"user": map[string]interface{}{
 			"uid": p.reqID,
 		},
 		"audio": map[string]interface{}{
 			"format": "pcm",
 			//"codec":    "opus", // 默认raw音频格式
-			"rate":     16000,
+			"rate":     p.InputSampleRate(),
 			"bits":     16,
 			"channel":  1,
-			"language": "zh-CN", // Added language as per doc example
+			"language": language,
 		},
 		"request": map[string]interface{}{
-			"model_name":      p.modelName,
+			"model_name":      modelName,
 			"end_window_size": p.endWindowSize,
 			"enable_punc":     p.enablePunc,
 			"enable_itn":      p.enableITN,
 			"enable_ddc":      p.enableDDC,
 			"result_type":     "single",
-			"show_utterances": false, // Added show_utterances, default to false
+			"show_utterances": true, // 分句带 definite 标记，用于区分中间结果和最终结果
 		},
 	}
+
+	if corpusContext := p.hotwordsContext(); corpusContext != "" {
+		request["request"].(map[string]interface{})["corpus"] = map[string]interface{}{
+			"context": corpusContext,
+		}
+	}
+	return request
 }
 
 // GetAudioBuffer 获取基类的audioBuffer
@@ -365,7 +488,7 @@ func (p *Provider) parseResponse(data []byte) (map[string]interface{}, error) {
 
 // AddAudio 添加音频数据到缓冲区
 func (p *Provider) AddAudio(data []byte) error {
-	return p.AddAudioWithContext(context.Background(), data)
+	return p.AddAudioWithContext(p.RequestContext(), data)
 }
 
 // AddAudioWithContext 带上下文的音频数据添加
@@ -399,7 +522,7 @@ func (p *Provider) AddAudioWithContext(ctx context.Context, data []byte) error {
 }
 
 func (p *Provider) StartStreaming(ctx context.Context) error {
-	p.logger.Info("----开始流式识别----")
+	p.logger.Info("%s----开始流式识别----", utils.RequestTag(ctx))
 	p.ResetStartListenTime()
 	// 加锁保护连接初始化
 	p.connMutex.Lock()
@@ -445,8 +568,8 @@ func (p *Provider) StartStreaming(ctx context.Context) error {
 
 		if i < maxRetries {
 			backoffTime := time.Duration(500*(i+1)) * time.Millisecond
-			fmt.Printf("WebSocket连接失败(尝试%d/%d): %v, 将在%v后重试\n",
-				i+1, maxRetries+1, err, backoffTime)
+			p.logger.Warn("%sWebSocket连接失败(尝试%d/%d): %v, 将在%v后重试",
+				utils.RequestTag(ctx), i+1, maxRetries+1, err, backoffTime)
 			time.Sleep(backoffTime)
 		}
 	}
@@ -456,7 +579,7 @@ func (p *Provider) StartStreaming(ctx context.Context) error {
 		if resp != nil {
 			statusCode = resp.StatusCode
 		}
-		return fmt.Errorf("WebSocket连接失败(状态码:%d): %v", statusCode, err)
+		return utils.RequestErrorf(ctx, "WebSocket连接失败(状态码:%d): %v", statusCode, err)
 	}
 
 	p.conn = conn
@@ -487,13 +610,13 @@ func (p *Provider) StartStreaming(ctx context.Context) error {
 
 	// 发送请求
 	if err := p.conn.WriteMessage(websocket.BinaryMessage, fullRequest); err != nil {
-		return fmt.Errorf("发送请求失败: %v", err)
+		return utils.RequestErrorf(ctx, "发送请求失败: %v", err)
 	}
 
 	// 读取响应
 	_, response, err := p.conn.ReadMessage()
 	if err != nil {
-		return fmt.Errorf("读取响应失败: %v", err)
+		return utils.RequestErrorf(ctx, "读取响应失败: %v", err)
 	} else {
 		p.logger.Debug("[DEBUG] 流式识别: 收到WebSocket消息长度=%d", len(response))
 	}
@@ -507,7 +630,7 @@ func (p *Provider) StartStreaming(ctx context.Context) error {
 	if msg, ok := initialResult["payload_msg"].(map[string]interface{}); ok {
 		// Doubao ASR v3 uses 20000000 for success code in initial response
 		if code, ok := msg["code"].(float64); ok && int(code) != 20000000 {
-			return fmt.Errorf("ASR初始化错误: %v", msg)
+			return utils.RequestErrorf(ctx, "ASR初始化错误: %v", msg)
 		}
 	}
 
@@ -524,7 +647,7 @@ func (p *Provider) ReadMessage() {
 	p.logger.Info("doubao流式识别协程已启动")
 	defer func() {
 		if r := recover(); r != nil {
-			p.logger.Error("流式识别协程发生错误: %v", r)
+			p.logger.Error("%s流式识别协程发生错误: %v", utils.RequestTag(p.RequestContext()), r)
 		}
 		p.connMutex.Lock()
 		p.isStreaming = false // 标记流式识别结束
@@ -578,6 +701,15 @@ func (p *Provider) ReadMessage() {
 				if textData, hasText := resultData["text"].(string); hasText {
 					text = textData
 				}
+				if confidence, ok := parseConfidence(resultData); ok {
+					p.SetConfidence(confidence)
+				}
+
+				// 流式接口(bigmodel)在一句话确定前会持续返回中间结果，只通知给监听器用于展示
+				if !isDefinite(resultData) {
+					p.NotifyPartialResult(text)
+					continue
+				}
 
 				p.logger.Debug("[DEBUG] 流式识别: 识别成功, 文本='%s'", text)
 
@@ -586,12 +718,7 @@ func (p *Provider) ReadMessage() {
 				p.connMutex.Unlock()
 
 				if listener := p.BaseProvider.GetListener(); listener != nil {
-					if text == "" && p.SilenceTime() > idleTimeout {
-						p.BaseProvider.SilenceCount += 1
-						text = "你没有听清我说话"
-					} else if text != "" {
-						p.BaseProvider.SilenceCount = 0 // 重置静音计数
-					}
+					// 静音计数由连接层统一通过 CheckIdle 维护
 					if finished := listener.OnAsrResult(text); finished {
 						return
 					}
@@ -605,6 +732,44 @@ func (p *Provider) ReadMessage() {
 
 	}
 }
+
+// isDefinite 识别结果是否为确定的一句话：分句均带 definite=true，
+// 未返回分句或 definite 标记（如非流式接口 bigmodel_nostream）时视为确定
+func isDefinite(resultData map[string]interface{}) bool {
+	utterances, _ := resultData["utterances"].([]interface{})
+	if len(utterances) == 0 {
+		return true
+	}
+	for _, item := range utterances {
+		utterance, _ := item.(map[string]interface{})
+		if definite, ok := utterance["definite"].(bool); ok && !definite {
+			return false
+		}
+	}
+	return true
+}
+
+// parseConfidence 解析识别结果中的置信度：优先取 result.confidence，
+// 否则取各分句 confidence 的平均值，服务端未返回时ok为false
+func parseConfidence(resultData map[string]interface{}) (float64, bool) {
+	if confidence, ok := resultData["confidence"].(float64); ok {
+		return confidence, true
+	}
+	utterances, _ := resultData["utterances"].([]interface{})
+	total, count := 0.0, 0
+	for _, item := range utterances {
+		utterance, _ := item.(map[string]interface{})
+		if confidence, ok := utterance["confidence"].(float64); ok {
+			total += confidence
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, false
+	}
+	return total / float64(count), true
+}
+
 func (p *Provider) setErrorAndStop(err error) {
 	p.connMutex.Lock()
 	defer p.connMutex.Unlock()
@@ -612,9 +777,9 @@ func (p *Provider) setErrorAndStop(err error) {
 	p.isStreaming = false
 	errMsg := err.Error()
 	if strings.Contains(errMsg, "use of closed network connection") {
-		p.logger.Debug("setErrorAndStop: %v, sendDataCnt=%d", err, p.sendDataCnt)
+		p.logger.Debug("%ssetErrorAndStop: %v, sendDataCnt=%d", utils.RequestTag(p.RequestContext()), err, p.sendDataCnt)
 	} else {
-		p.logger.Error("setErrorAndStop: %v, sendDataCnt=%d", err, p.sendDataCnt)
+		p.logger.Error("%ssetErrorAndStop: %v, sendDataCnt=%d", utils.RequestTag(p.RequestContext()), err, p.sendDataCnt)
 	}
 
 	if p.conn != nil {
@@ -732,4 +897,5 @@ func init() {
 	asr.Register("doubao", func(config *asr.Config, deleteFile bool, logger *utils.Logger) (asr.Provider, error) {
 		return NewProvider(config, deleteFile, logger)
 	})
+	schema.Register("ASR", "doubao", DoubaoASRConfig{})
 }
@@ -2,6 +2,7 @@ package gosherpa
 
 import (
 	"ai-server-go/src/core/providers/asr"
+	"ai-server-go/src/core/providers/schema"
 	"ai-server-go/src/core/utils"
 	"context"
 	"encoding/json"
@@ -18,7 +19,7 @@ type Provider struct {
 
 // 配置结构体
 type GoSherpaASRConfig struct {
-	Addr      string `json:"addr"`
+	Addr      string `json:"addr" schema:"required"`
 	OutputDir string `json:"output_dir"`
 }
 
@@ -98,4 +99,5 @@ func init() {
 	asr.Register("gosherpa", func(config *asr.Config, deleteFile bool, logger *utils.Logger) (asr.Provider, error) {
 		return NewProvider(config, deleteFile, logger)
 	})
+	schema.Register("ASR", "gosherpa", GoSherpaASRConfig{})
 }
@@ -2,11 +2,16 @@ package tencent
 
 import (
 	"ai-server-go/src/core/providers/asr"
+	"ai-server-go/src/core/providers/schema"
 	"ai-server-go/src/core/utils"
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"os"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
 	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/profile"
@@ -17,10 +22,25 @@ import (
 type TencentASRConfig struct {
 	AppID     string `json:"app_id"`
 	SecretID  string `json:"secret_id"`
-	SecretKey string `json:"secret_key"`
+	SecretKey string `json:"secret_key" schema:"secret"`
 	Region    string `json:"region"`
 	Mode      string `json:"mode"`      // rest/ws
 	Engine    string `json:"engine"`    // 16k_zh, 16k_en, etc.
+	MaxHotwords int  `json:"max_hotwords" schema:"default=128"` // 临时热词最大数量，默认128
+}
+
+// defaultMaxHotwords 腾讯云临时热词表默认最大词数
+const defaultMaxHotwords = 128
+
+// defaultEngine 未配置 engine 时使用的引擎
+const defaultEngine = "16k_zh"
+
+// supportedEngines 支持的引擎模型类型（engine_model_type）
+var supportedEngines = []string{
+	"16k_zh", "16k_zh-PY", "16k_zh_medical", "16k_zh_dialect", "16k_zh_large", "16k_multi_lang",
+	"16k_yue", "16k_en", "16k_ja", "16k_ko", "16k_vi", "16k_ms", "16k_id", "16k_fil", "16k_th",
+	"16k_pt", "16k_tr", "16k_ar", "16k_es", "16k_hi", "16k_fr", "16k_de",
+	"8k_zh", "8k_en",
 }
 
 type asrEventListener interface {
@@ -40,6 +60,64 @@ type Provider struct {
 	*asr.BaseProvider
 	config   TencentASRConfig
 	listener asrEventListener
+	hotwords []string // 临时热词，按 hotword_list 参数下发
+
+	engineMu sync.Mutex
+	engine   string // 按语言选择的引擎，为空时使用配置的 engine
+}
+
+// SupportedEngines 支持的引擎模型类型
+func (p *Provider) SupportedEngines() []string {
+	return append([]string(nil), supportedEngines...)
+}
+
+// SelectEngine 设置后续识别使用的引擎，引擎已包含语言，language 仅用于日志；engine为空时恢复配置的引擎
+func (p *Provider) SelectEngine(language, engine string) error {
+	if engine != "" && !slices.Contains(supportedEngines, engine) {
+		return fmt.Errorf("腾讯ASR不支持的引擎: %s", engine)
+	}
+	p.engineMu.Lock()
+	defer p.engineMu.Unlock()
+	p.engine = engine
+	return nil
+}
+
+// currentEngine 本次识别使用的引擎
+func (p *Provider) currentEngine() string {
+	p.engineMu.Lock()
+	defer p.engineMu.Unlock()
+	if p.engine != "" {
+		return p.engine
+	}
+	if p.config.Engine != "" {
+		return p.config.Engine
+	}
+	return defaultEngine
+}
+
+// SetHotwords 设置临时热词，下一次识别时生效
+func (p *Provider) SetHotwords(words []string) {
+	p.hotwords = append([]string(nil), words...)
+}
+
+// MaxHotwords 临时热词最大数量
+func (p *Provider) MaxHotwords() int {
+	if p.config.MaxHotwords > 0 {
+		return p.config.MaxHotwords
+	}
+	return defaultMaxHotwords
+}
+
+// hotwordList 构造腾讯云 hotword_list 参数（词|权重，逗号分隔）
+func (p *Provider) hotwordList() string {
+	items := make([]string, 0, len(p.hotwords))
+	for _, word := range p.hotwords {
+		word = strings.NewReplacer("|", "", ",", "").Replace(word)
+		if word != "" {
+			items = append(items, word+"|10")
+		}
+	}
+	return strings.Join(items, ",")
 }
 
 func NewProvider(config *asr.Config, deleteFile bool, logger *utils.Logger) (*Provider, error) {
@@ -79,7 +157,7 @@ func (p *Provider) transcribeSDK(ctx context.Context, audioData []byte) (string,
 	request := asr.NewSentenceRecognitionRequest()
 	request.ProjectId = common.Uint64Ptr(0)
 	request.SubServiceType = common.Uint64Ptr(2) // 2: 一句话识别
-	request.EngSerViceType = common.StringPtr(p.config.Engine)
+	request.EngSerViceType = common.StringPtr(p.currentEngine())
 	request.SourceType = common.Uint64Ptr(1) // 1: 语音数据
 	request.Data = common.StringPtr(utils.Base64EncodeFile(tmpFile))
 	request.VoiceFormat = common.StringPtr("wav")
@@ -92,7 +170,10 @@ func (p *Provider) transcribeSDK(ctx context.Context, audioData []byte) (string,
 
 func (p *Provider) transcribeWS(ctx context.Context, audioData []byte) (string, error) {
 	// 伪代码，需根据腾讯云WebSocket协议实现分包、鉴权、异步接收
-	wsURL := fmt.Sprintf("wss://asr.cloud.tencent.com/asr/v1/%s?engine_model_type=%s", p.config.AppID, p.config.Engine)
+	wsURL := fmt.Sprintf("wss://asr.cloud.tencent.com/asr/v1/%s?engine_model_type=%s", p.config.AppID, p.currentEngine())
+	if hotwords := p.hotwordList(); hotwords != "" {
+		wsURL += "&hotword_list=" + url.QueryEscape(hotwords)
+	}
 	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
 	if err != nil {
 		return "", err
@@ -155,4 +236,5 @@ func init() {
 	asr.Register("tencent", func(config *asr.Config, deleteFile bool, logger *utils.Logger) (asr.Provider, error) {
 		return NewProvider(config, deleteFile, logger)
 	})
+	schema.Register("ASR", "tencent", TencentASRConfig{})
 }
@@ -2,6 +2,7 @@ package xunfei
 
 import (
 	"ai-server-go/src/core/providers/asr"
+	"ai-server-go/src/core/providers/schema"
 	"ai-server-go/src/core/utils"
 	"context"
 	"crypto/hmac"
@@ -10,20 +11,25 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
 type XunfeiASRConfig struct {
-	AppID     string `json:"app_id"`
-	APIKey    string `json:"api_key"`
-	APISecret string `json:"api_secret"`
-	Engine    string `json:"engine"`
-	Language  string `json:"language"`
-	Mode      string `json:"mode"` // ws
+	AppID       string `json:"app_id"`
+	APIKey      string `json:"api_key" schema:"secret"`
+	APISecret   string `json:"api_secret" schema:"secret"`
+	Engine      string `json:"engine"`
+	Language    string `json:"language"`
+	Mode        string `json:"mode"`                              // ws
+	MaxHotwords int    `json:"max_hotwords" schema:"default=100"` // 会话热词最大数量，默认100
 }
 
+// defaultMaxHotwords 会话热词默认最大数量
+const defaultMaxHotwords = 100
+
 type asrEventListener interface {
 	OnAsrPartialResult(result string)
 	OnAsrFinalResult(result string)
@@ -41,6 +47,7 @@ type Provider struct {
 	*asr.BaseProvider
 	config   XunfeiASRConfig
 	listener asrEventListener
+	hotwords []string // 会话热词，按 dhw 参数下发
 }
 
 func NewProvider(config *asr.Config, deleteFile bool, logger *utils.Logger) (*Provider, error) {
@@ -58,6 +65,34 @@ func (p *Provider) SetListener(listener asrEventListener) {
 	p.listener = listener
 }
 
+// SetHotwords 设置会话热词，下一次识别时生效
+func (p *Provider) SetHotwords(words []string) {
+	p.hotwords = append([]string(nil), words...)
+}
+
+// MaxHotwords 会话热词最大数量
+func (p *Provider) MaxHotwords() int {
+	if p.config.MaxHotwords > 0 {
+		return p.config.MaxHotwords
+	}
+	return defaultMaxHotwords
+}
+
+// hotwordParam 构造 dhw 参数（utf-8;词1|词2）
+func (p *Provider) hotwordParam() string {
+	items := make([]string, 0, len(p.hotwords))
+	for _, word := range p.hotwords {
+		word = strings.NewReplacer("|", "", ";", "").Replace(word)
+		if word != "" {
+			items = append(items, word)
+		}
+	}
+	if len(items) == 0 {
+		return ""
+	}
+	return "utf-8;" + strings.Join(items, "|")
+}
+
 func (p *Provider) Transcribe(ctx context.Context, audioData []byte) (string, error) {
 	return p.transcribeWS(ctx, audioData)
 }
@@ -95,6 +130,9 @@ func (p *Provider) transcribeWS(ctx context.Context, audioData []byte) (string,
 			"audio":    base64.StdEncoding.EncodeToString(firstFrame),
 		},
 	}
+	if dhw := p.hotwordParam(); dhw != "" {
+		param["business"].(map[string]interface{})["dhw"] = dhw
+	}
 	if err := conn.WriteJSON(param); err != nil {
 		return "", err
 	}
@@ -185,4 +223,5 @@ func init() {
 	asr.Register("xunfei", func(config *asr.Config, deleteFile bool, logger *utils.Logger) (asr.Provider, error) {
 		return NewProvider(config, deleteFile, logger)
 	})
+	schema.Register("ASR", "xunfei", XunfeiASRConfig{})
 }
@@ -15,6 +15,12 @@ type AsrEventListener interface {
 	OnAsrResult(result string) bool
 }
 
+// AsrPartialListener 监听器可选实现的接口，接收流式识别过程中尚未确定的中间结果；
+// 中间结果只用于展示和活动检测，一句话的最终结果仍通过 OnAsrResult 回调
+type AsrPartialListener interface {
+	OnAsrPartialResult(result string)
+}
+
 // ASRProvider 语音识别能力接口
 // 兼容现有ASR实现，便于统一管理和能力回退
 // 典型方法：Transcribe、Reset、SetListener等
@@ -31,16 +37,62 @@ type ASRProvider interface {
 
 	// 获取当前静音计数
 	GetSilenceCount() int
+	// 识别到有效语音后清零静音计数
+	ResetSilenceCount()
 
+	// 开始新一次收听，重置静音计时
 	ResetStartListenTime()
+	// 根据PCM能量更新语音活动状态
+	ObserveAudio(pcm []byte)
+	// 检查是否无语音超时，超时则增加静音计数
+	CheckIdle() bool
+}
+
+// HotwordSetter 支持热词/上下文提示的ASR提供者可选实现的接口
+type HotwordSetter interface {
+	// 设置后续识别使用的热词，传入空列表表示清除
+	SetHotwords(words []string)
+}
+
+// HotwordLimiter 限制热词数量的ASR提供者可选实现的接口
+type HotwordLimiter interface {
+	// 单次识别可使用的最大热词数
+	MaxHotwords() int
+}
+
+// EngineSelector 可按语言切换识别引擎/模型的ASR提供者可选实现的接口
+type EngineSelector interface {
+	// SupportedEngines 支持的引擎（模型）列表
+	SupportedEngines() []string
+	// SelectEngine 设置后续识别使用的语言和引擎，均为空时恢复提供者配置的默认值；
+	// 引擎不在支持列表中时返回错误，设置保持不变
+	SelectEngine(language, engine string) error
+}
+
+// RequestContextSetter 流式识别等不经由参数传递context的提供者可选实现的接口，
+// 设置后续调用使用的context，提供者在日志和错误中附带其中的请求标识
+type RequestContextSetter interface {
+	SetRequestContext(ctx context.Context)
+}
+
+// InputSampleRateReporter 声明所需输入采样率的ASR提供者可选实现的接口，
+// 连接层将客户端音频重采样到该采样率后再送入识别，未实现时按16kHz处理
+type InputSampleRateReporter interface {
+	InputSampleRate() int
+}
+
+// ConfidenceReporter 可返回识别置信度的ASR提供者可选实现的接口
+type ConfidenceReporter interface {
+	// LastConfidence 最近一次识别结果的置信度(0-1)，服务端未返回时ok为false
+	LastConfidence() (confidence float64, ok bool)
 }
 
 // TTSProvider 语音合成提供者接口
 type TTSProvider interface {
 	Provider
 
-	// 合成音频并返回文件路径
-	ToTTS(text string) (string, error)
+	// 合成音频并返回文件路径，ctx 携带会话/设备/链路标识（见 utils.WithRequestInfo）
+	ToTTS(ctx context.Context, text string) (string, error)
 }
 
 // LLMProvider 大语言模型提供者接口
@@ -0,0 +1,44 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+)
+
+// Config 向量化提供者配置
+type Config struct {
+	Type  string                 // provider类型（如 openai、ollama）
+	Extra map[string]interface{} // ProviderConfig.Props 中的扩展参数
+}
+
+// Provider 向量化提供者接口，独立于对话LLM，便于使用低成本的专用embedding模型
+type Provider interface {
+	// 将多段文本转换为向量，返回顺序与输入一致
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// Factory 向量化提供者工厂函数类型
+type Factory func(config *Config) (Provider, error)
+
+var (
+	factories = make(map[string]Factory)
+)
+
+// Register 注册向量化提供者工厂
+func Register(name string, factory Factory) {
+	factories[name] = factory
+}
+
+// Create 创建向量化提供者实例
+func Create(name string, config *Config) (Provider, error) {
+	factory, ok := factories[name]
+	if !ok {
+		return nil, fmt.Errorf("未知的Embedding提供者: %s", name)
+	}
+
+	provider, err := factory(config)
+	if err != nil {
+		return nil, fmt.Errorf("创建Embedding提供者失败: %v", err)
+	}
+	return provider, nil
+}
@@ -0,0 +1,84 @@
+package openai
+
+import (
+	"ai-server-go/src/core/providers/embedding"
+	"ai-server-go/src/core/providers/schema"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Provider OpenAI兼容接口的向量化提供者（Ollama等兼容 /v1/embeddings 的服务同样适用）
+type Provider struct {
+	client *openai.Client
+	model  string
+}
+
+// 配置结构体
+type OpenAIEmbeddingConfig struct {
+	APIKey    string `json:"api_key" schema:"secret"`
+	BaseURL   string `json:"base_url"`
+	ModelName string `json:"model_name" schema:"required"`
+}
+
+// 注册提供者
+func init() {
+	embedding.Register("openai", NewProvider)
+	embedding.Register("ollama", NewProvider)
+	schema.Register("EMBEDDING", "openai", OpenAIEmbeddingConfig{}, "api_key")
+	schema.Register("EMBEDDING", "ollama", OpenAIEmbeddingConfig{})
+}
+
+// NewProvider 创建OpenAI兼容的向量化提供者
+func NewProvider(config *embedding.Config) (embedding.Provider, error) {
+	var cfg OpenAIEmbeddingConfig
+	b, err := json.Marshal(config.Extra)
+	if err != nil {
+		return nil, fmt.Errorf("配置解析失败: %v", err)
+	}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("配置解析失败: %v", err)
+	}
+	if cfg.ModelName == "" {
+		return nil, fmt.Errorf("缺少model_name配置")
+	}
+	if cfg.APIKey == "" {
+		if config.Type != "ollama" {
+			return nil, fmt.Errorf("缺少api_key配置")
+		}
+		cfg.APIKey = "ollama" // Ollama不校验Key，但客户端要求非空
+	}
+
+	clientConfig := openai.DefaultConfig(cfg.APIKey)
+	if cfg.BaseURL != "" {
+		clientConfig.BaseURL = cfg.BaseURL
+	}
+	return &Provider{
+		client: openai.NewClientWithConfig(clientConfig),
+		model:  cfg.ModelName,
+	}, nil
+}
+
+// Embed 调用embeddings接口
+func (p *Provider) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	resp, err := p.client.CreateEmbeddings(ctx, openai.EmbeddingRequestStrings{
+		Input: texts,
+		Model: openai.EmbeddingModel(p.model),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("调用Embedding接口失败: %v", err)
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, item := range resp.Data {
+		if item.Index >= 0 && item.Index < len(vectors) {
+			vectors[item.Index] = item.Embedding
+		}
+	}
+	return vectors, nil
+}
@@ -0,0 +1,116 @@
+package fake
+
+import (
+	"ai-server-go/src/core/providers/asr"
+	"ai-server-go/src/core/providers/schema"
+	"ai-server-go/src/core/utils"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultTranscript 未配置识别结果时假ASR的识别结果
+const DefaultTranscript = "你好"
+
+// ASRConfig 假ASR的配置
+type ASRConfig struct {
+	ID           string   `json:"id"`
+	LatencyMs    int      `json:"latency_ms"`     // 一句话结束后到返回识别结果的延迟（毫秒）
+	Error        string   `json:"error"`          // 非空时不返回识别结果（模拟识别失败）
+	Transcripts  []string `json:"transcripts"`    // 按句子顺序循环使用的识别结果，为空时使用默认结果
+	EndSilenceMs int      `json:"end_silence_ms"` // 多久没有收到音频视为一句话结束（毫秒），默认200
+}
+
+// ASR 返回固定识别结果的假ASR：收到音频后，音频中断 end_silence_ms 即视为一句话结束，
+// 等待 latency_ms 后把下一条识别结果交给监听者
+type ASR struct {
+	*asr.BaseProvider
+	cfg         ASRConfig
+	transcripts cycle
+	logger      *utils.Logger
+
+	mu       sync.Mutex
+	timer    *time.Timer
+	received int // 本句收到的音频字节数
+}
+
+// NewASR 创建假ASR
+func NewASR(config *asr.Config, deleteFile bool, logger *utils.Logger) (*ASR, error) {
+	cfg := ASRConfig{EndSilenceMs: 200}
+	parseProps(config.Data, &cfg)
+	transcripts := cfg.Transcripts
+	if len(transcripts) == 0 {
+		transcripts = []string{DefaultTranscript}
+	}
+	base := asr.NewBaseProvider(config, deleteFile)
+	base.InitAudioProcessing()
+	return &ASR{BaseProvider: base, cfg: cfg, transcripts: cycle{items: transcripts}, logger: logger}, nil
+}
+
+func (p *ASR) options() options {
+	return options{ID: p.cfg.ID, LatencyMs: p.cfg.LatencyMs, Error: p.cfg.Error}
+}
+
+// Transcribe 直接返回下一条识别结果
+func (p *ASR) Transcribe(ctx context.Context, audioData []byte) (string, error) {
+	if err := p.options().begin(ctx, "ASR"); err != nil {
+		return "", fmt.Errorf("假ASR识别失败: %w", err)
+	}
+	return p.transcripts.pick(), nil
+}
+
+// AddAudio 记录收到的音频，音频中断后结束本句
+func (p *ASR) AddAudio(data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.received += len(data)
+	endSilence := msDuration(max(p.cfg.EndSilenceMs, 1))
+	if p.timer == nil {
+		p.timer = time.AfterFunc(endSilence, p.finish)
+	} else {
+		p.timer.Reset(endSilence)
+	}
+	return nil
+}
+
+// finish 一句话结束，返回识别结果
+func (p *ASR) finish() {
+	p.mu.Lock()
+	received := p.received
+	p.received = 0
+	p.timer = nil
+	p.mu.Unlock()
+	if received == 0 {
+		return
+	}
+
+	if err := p.options().begin(p.RequestContext(), "ASR"); err != nil {
+		if p.logger != nil {
+			p.logger.Warn("假ASR识别失败，不返回识别结果: %v", err)
+		}
+		return
+	}
+	if listener := p.GetListener(); listener != nil {
+		listener.OnAsrResult(p.transcripts.pick())
+	}
+}
+
+// Reset 丢弃当前句子
+func (p *ASR) Reset() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	p.received = 0
+	return nil
+}
+
+func init() {
+	asr.Register(ProviderType, func(config *asr.Config, deleteFile bool, logger *utils.Logger) (asr.Provider, error) {
+		return NewASR(config, deleteFile, logger)
+	})
+	schema.Register("ASR", ProviderType, ASRConfig{})
+}
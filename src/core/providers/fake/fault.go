@@ -0,0 +1,168 @@
+// Package fake 假的ASR/LLM/TTS提供者（type 为 fake），不依赖任何云服务，返回确定的固定内容，
+// 用于在CI中跑通 WebSocket→ASR→LLM→TTS 的完整对话流程。
+//
+// 服务端使用 -tags fake 构建时注册（见 main_fake.go），测试中直接导入本包即可。
+// 各提供者的延迟和错误可以通过provider配置的props设置，也可以在测试中用 Inject 按次注入，
+// 以测试故障切换、阶段超时和打断。
+package fake
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ProviderType 假提供者的类型名称，即 ProviderConfig.Type
+const ProviderType = "fake"
+
+// Fault 注入的故障
+type Fault struct {
+	Err   error         // 调用返回的错误，为nil时只增加延迟
+	Delay time.Duration // 调用前额外等待的时间
+	Times int           // 生效次数，0表示一直生效直到 Clear/Reset
+}
+
+var (
+	faultMu sync.Mutex
+	faults  = make(map[string]*Fault)
+	calls   = make(map[string]int)
+)
+
+// Target 故障注入的目标：category 为 ASR、LLM 或 TTS；id 为provider配置props中的 id，
+// 为空时对该类别的所有假提供者生效。同时存在时按id注入的故障优先
+func Target(category, id string) string {
+	if id == "" {
+		return category
+	}
+	return category + "/" + id
+}
+
+// Inject 向目标注入故障，覆盖之前注入的故障
+func Inject(target string, fault Fault) {
+	faultMu.Lock()
+	defer faultMu.Unlock()
+	f := fault
+	faults[target] = &f
+}
+
+// Clear 清除目标的故障
+func Clear(target string) {
+	faultMu.Lock()
+	defer faultMu.Unlock()
+	delete(faults, target)
+}
+
+// Reset 清除全部故障和调用计数，测试开始时调用
+func Reset() {
+	faultMu.Lock()
+	defer faultMu.Unlock()
+	faults = make(map[string]*Fault)
+	calls = make(map[string]int)
+}
+
+// Calls 目标被调用的次数（按类别和按id分别计数）
+func Calls(target string) int {
+	faultMu.Lock()
+	defer faultMu.Unlock()
+	return calls[target]
+}
+
+// take 记录一次调用并取出本次生效的故障
+func take(category, id string) Fault {
+	faultMu.Lock()
+	defer faultMu.Unlock()
+	calls[category]++
+	targets := []string{category}
+	if id != "" {
+		calls[Target(category, id)]++
+		targets = []string{Target(category, id), category}
+	}
+	for _, target := range targets {
+		fault, ok := faults[target]
+		if !ok {
+			continue
+		}
+		if fault.Times > 0 {
+			fault.Times--
+			if fault.Times == 0 {
+				delete(faults, target)
+			}
+		}
+		return *fault
+	}
+	return Fault{}
+}
+
+// options 三类假提供者共用的props
+type options struct {
+	ID        string `json:"id"`         // 故障注入时区分同类别的多个假提供者
+	LatencyMs int    `json:"latency_ms"` // 每次调用的固定延迟（毫秒）
+	Error     string `json:"error"`      // 非空时每次调用都返回该错误
+}
+
+// parseProps 将props解析到配置结构体，解析失败时保留默认值
+func parseProps(props map[string]interface{}, out interface{}) {
+	if props == nil {
+		return
+	}
+	data, err := json.Marshal(props)
+	if err != nil {
+		return
+	}
+	_ = json.Unmarshal(data, out)
+}
+
+// wait 等待指定时间，ctx结束时提前返回ctx的错误
+func wait(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// cycle 按调用顺序循环选取固定内容
+type cycle struct {
+	mu    sync.Mutex
+	items []string
+	next  int
+}
+
+func (c *cycle) pick() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.items) == 0 {
+		return ""
+	}
+	item := c.items[c.next%len(c.items)]
+	c.next++
+	return item
+}
+
+// begin 每次调用前执行：等待固定延迟和注入的延迟，返回注入的错误或props配置的错误
+func (o options) begin(ctx context.Context, category string) error {
+	fault := take(category, o.ID)
+	if err := wait(ctx, msDuration(o.LatencyMs)+fault.Delay); err != nil {
+		return err
+	}
+	if fault.Err != nil {
+		return fault.Err
+	}
+	if o.Error != "" {
+		return errors.New(o.Error)
+	}
+	return nil
+}
+
+// msDuration 毫秒数转换为时长
+func msDuration(ms int) time.Duration {
+	return time.Duration(ms) * time.Millisecond
+}
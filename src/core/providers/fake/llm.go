@@ -0,0 +1,136 @@
+package fake
+
+import (
+	"ai-server-go/src/core/providers/llm"
+	"ai-server-go/src/core/providers/schema"
+	"ai-server-go/src/core/types"
+	"context"
+	"fmt"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// DefaultReply 未配置回复时假LLM的回复
+const DefaultReply = "你好，我是测试助手。"
+
+// LLMConfig 假LLM的配置
+type LLMConfig struct {
+	ID           string   `json:"id"`
+	LatencyMs    int      `json:"latency_ms"`     // 首个分段前的延迟（毫秒）
+	Error        string   `json:"error"`          // 非空时每次调用都返回该错误
+	Replies      []string `json:"replies"`        // 按调用顺序循环使用的回复，为空时使用默认回复
+	Echo         bool     `json:"echo"`           // 回复最后一条用户消息（前缀“你说的是：”），优先于 replies
+	ChunkRunes   int      `json:"chunk_runes"`    // 按字数分段流式返回，0表示整段返回
+	ChunkDelayMs int      `json:"chunk_delay_ms"` // 分段之间的延迟（毫秒），用于测试打断
+}
+
+// LLM 返回固定回复的假LLM
+type LLM struct {
+	*llm.BaseProvider
+	cfg     LLMConfig
+	replies cycle
+}
+
+// NewLLM 创建假LLM
+func NewLLM(config *llm.Config) (*LLM, error) {
+	var cfg LLMConfig
+	parseProps(config.Extra, &cfg)
+	replies := cfg.Replies
+	if len(replies) == 0 {
+		replies = []string{DefaultReply}
+	}
+	return &LLM{BaseProvider: llm.NewBaseProvider(config), cfg: cfg, replies: cycle{items: replies}}, nil
+}
+
+func (p *LLM) options() options {
+	return options{ID: p.cfg.ID, LatencyMs: p.cfg.LatencyMs, Error: p.cfg.Error}
+}
+
+// reply 本次调用的回复
+func (p *LLM) reply(messages []types.Message) string {
+	if p.cfg.Echo {
+		for i := len(messages) - 1; i >= 0; i-- {
+			if messages[i].Role == "user" {
+				return "你说的是：" + messages[i].Content
+			}
+		}
+	}
+	return p.replies.pick()
+}
+
+// chunks 按配置的字数切分回复
+func (p *LLM) chunks(reply string) []string {
+	runes := []rune(reply)
+	size := p.cfg.ChunkRunes
+	if size <= 0 || size >= len(runes) {
+		return []string{reply}
+	}
+	var chunks []string
+	for start := 0; start < len(runes); start += size {
+		chunks = append(chunks, string(runes[start:min(start+size, len(runes))]))
+	}
+	return chunks
+}
+
+// stream 逐段发送回复，ctx结束（如被打断）时停止
+func (p *LLM) stream(ctx context.Context, reply string, send func(chunk string) bool) {
+	for i, chunk := range p.chunks(reply) {
+		if i > 0 {
+			if err := wait(ctx, msDuration(p.cfg.ChunkDelayMs)); err != nil {
+				return
+			}
+		}
+		if !send(chunk) {
+			return
+		}
+	}
+}
+
+// Response 流式返回固定回复
+func (p *LLM) Response(ctx context.Context, sessionID string, messages []types.Message) (<-chan string, error) {
+	if err := p.options().begin(ctx, "LLM"); err != nil {
+		return nil, fmt.Errorf("假LLM调用失败: %w", err)
+	}
+	reply := p.reply(messages)
+	ch := make(chan string, 1)
+	go func() {
+		defer close(ch)
+		p.stream(ctx, reply, func(chunk string) bool {
+			select {
+			case ch <- chunk:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}()
+	return ch, nil
+}
+
+// ResponseWithFunctions 流式返回固定回复，不调用工具
+func (p *LLM) ResponseWithFunctions(ctx context.Context, sessionID string, messages []types.Message, tools []openai.Tool) (<-chan types.Response, error) {
+	if err := p.options().begin(ctx, "LLM"); err != nil {
+		return nil, fmt.Errorf("假LLM调用失败: %w", err)
+	}
+	reply := p.reply(messages)
+	ch := make(chan types.Response, 1)
+	go func() {
+		defer close(ch)
+		p.stream(ctx, reply, func(chunk string) bool {
+			select {
+			case ch <- types.Response{Content: chunk}:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}()
+	return ch, nil
+}
+
+func init() {
+	llm.Register(ProviderType, func(config *llm.Config) (llm.Provider, error) {
+		return NewLLM(config)
+	})
+	schema.Register("LLM", ProviderType, LLMConfig{})
+}
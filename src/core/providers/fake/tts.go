@@ -0,0 +1,79 @@
+package fake
+
+import (
+	"ai-server-go/src/core/providers/schema"
+	"ai-server-go/src/core/providers/tts"
+	"ai-server-go/src/core/utils"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// TTSConfig 假TTS的配置
+type TTSConfig struct {
+	ID        string `json:"id"`
+	LatencyMs int    `json:"latency_ms"` // 每次合成的延迟（毫秒）
+	Error     string `json:"error"`      // 非空时每次合成都返回该错误
+	Frames    int    `json:"frames"`     // 每句合成的静音mp3帧数（每帧24ms），默认10
+	OutputDir string `json:"output_dir"` // 音频输出目录，为空时使用系统临时目录
+}
+
+// TTS 合成静音mp3的假TTS
+type TTS struct {
+	*tts.BaseProvider
+	cfg TTSConfig
+}
+
+// ttsSeq 输出文件序号，保证文件名唯一
+var ttsSeq atomic.Int64
+
+// NewTTS 创建假TTS
+func NewTTS(config *tts.Config, deleteFile bool) (*TTS, error) {
+	cfg := TTSConfig{Frames: 10}
+	parseProps(config.Props, &cfg)
+	if cfg.OutputDir == "" {
+		cfg.OutputDir = config.OutputDir
+	}
+	if cfg.OutputDir == "" {
+		cfg.OutputDir = filepath.Join(os.TempDir(), "fake-tts")
+	}
+	if err := os.MkdirAll(cfg.OutputDir, 0755); err != nil {
+		return nil, fmt.Errorf("创建输出目录失败: %v", err)
+	}
+	config.OutputDir = cfg.OutputDir
+	return &TTS{BaseProvider: tts.NewBaseProvider(config, deleteFile), cfg: cfg}, nil
+}
+
+// ToTTS 合成一段静音mp3，返回文件路径
+func (p *TTS) ToTTS(ctx context.Context, text string) (string, error) {
+	opts := options{ID: p.cfg.ID, LatencyMs: p.cfg.LatencyMs, Error: p.cfg.Error}
+	if err := opts.begin(ctx, "TTS"); err != nil {
+		return "", fmt.Errorf("假TTS合成失败: %w", err)
+	}
+	path := filepath.Join(p.cfg.OutputDir, fmt.Sprintf("fake_tts_%d_%d.mp3", os.Getpid(), ttsSeq.Add(1)))
+	if err := WriteSilentMP3(path, max(p.cfg.Frames, 1)); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// WriteSilentMP3 写入若干帧静音的 MPEG-1 Layer III 音频（48kHz、128kbps、单声道）
+func WriteSilentMP3(path string, frames int) error {
+	const frameSize = 144 * 128000 / 48000
+	data := make([]byte, 0, frameSize*frames)
+	for i := 0; i < frames; i++ {
+		frame := make([]byte, frameSize)
+		copy(frame, []byte{0xFF, 0xFB, 0x94, 0xC0})
+		data = append(data, frame...)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func init() {
+	tts.Register(ProviderType, func(config *tts.Config, deleteFile bool, logger *utils.Logger) (tts.Provider, error) {
+		return NewTTS(config, deleteFile)
+	})
+	schema.Register("TTS", ProviderType, TTSConfig{})
+}
@@ -2,7 +2,9 @@ package ollama
 
 import (
 	"ai-server-go/src/core/providers/llm"
+	"ai-server-go/src/core/providers/schema"
 	"ai-server-go/src/core/types"
+	"ai-server-go/src/core/utils"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -17,12 +19,16 @@ type Provider struct {
 	client    *openai.Client
 	modelName string
 	isQwen3   bool
+	prompt    llm.PromptOptions // 停止序列和系统提示词模板
 }
 
 // 配置结构体
 type OllamaLLMConfig struct {
-	BaseURL   string `json:"base_url"`
+	BaseURL   string `json:"base_url" schema:"required"`
 	ModelName string `json:"model_name"`
+
+	Stop                 []string `json:"stop"`                   // 停止序列
+	SystemPromptTemplate string   `json:"system_prompt_template"` // 系统提示词模板，{system_prompt} 为原系统提示词
 }
 
 // 通用配置解析
@@ -37,6 +43,7 @@ func parseProps(props map[string]interface{}, out interface{}) error {
 // 注册提供者
 func init() {
 	llm.Register("ollama", NewProvider)
+	schema.Register("LLM", "ollama", OllamaLLMConfig{})
 }
 
 // NewProvider 创建Ollama提供者
@@ -45,10 +52,16 @@ func NewProvider(config *llm.Config) (llm.Provider, error) {
 	if err := parseProps(config.Extra, &cfg); err != nil {
 		return nil, fmt.Errorf("配置解析失败: %v", err)
 	}
+	// Ollama不限制停止序列数量
+	prompt, err := llm.NewPromptOptions(cfg.Stop, cfg.SystemPromptTemplate, 0)
+	if err != nil {
+		return nil, fmt.Errorf("配置解析失败: %v", err)
+	}
 	base := llm.NewBaseProvider(config)
 	provider := &Provider{
 		BaseProvider: base,
 		modelName:    cfg.ModelName,
+		prompt:       prompt,
 	}
 	provider.isQwen3 = cfg.ModelName != "" && strings.HasPrefix(strings.ToLower(cfg.ModelName), "qwen3")
 	// 将解析到的配置写回 config 以兼容后续逻辑
@@ -96,6 +109,8 @@ func (p *Provider) Response(ctx context.Context, sessionID string, messages []ty
 	go func() {
 		defer close(responseChan)
 
+		messages = p.prompt.ApplySystemPrompt(messages)
+
 		// 如果是qwen3模型，在用户最后一条消息中添加/no_think指令
 		if p.isQwen3 {
 			messages = p.addNoThinkDirective(messages)
@@ -113,13 +128,15 @@ func (p *Provider) Response(ctx context.Context, sessionID string, messages []ty
 		stream, err := p.client.CreateChatCompletionStream(
 			ctx,
 			openai.ChatCompletionRequest{
-				Model:    p.modelName,
-				Messages: chatMessages,
-				Stream:   true,
+				Model:     p.modelName,
+				Messages:  chatMessages,
+				Stream:    true,
+				MaxTokens: llm.MaxTokens(ctx, 0),
+				Stop:      p.prompt.Stop,
 			},
 		)
 		if err != nil {
-			responseChan <- fmt.Sprintf("【Ollama服务响应异常: %v】", err)
+			responseChan <- fmt.Sprintf("【Ollama服务响应异常: %s%v】", utils.RequestTag(ctx), err)
 			return
 		}
 		defer stream.Close()
@@ -162,6 +179,8 @@ func (p *Provider) ResponseWithFunctions(ctx context.Context, sessionID string,
 	go func() {
 		defer close(responseChan)
 
+		messages = p.prompt.ApplySystemPrompt(messages)
+
 		// 如果是qwen3模型，在用户最后一条消息中添加/no_think指令
 		if p.isQwen3 {
 			messages = p.addNoThinkDirective(messages)
@@ -202,16 +221,18 @@ func (p *Provider) ResponseWithFunctions(ctx context.Context, sessionID string,
 		stream, err := p.client.CreateChatCompletionStream(
 			ctx,
 			openai.ChatCompletionRequest{
-				Model:    p.modelName,
-				Messages: chatMessages,
-				Tools:    tools,
-				Stream:   true,
+				Model:     p.modelName,
+				Messages:  chatMessages,
+				Tools:     tools,
+				Stream:    true,
+				MaxTokens: llm.MaxTokens(ctx, 0),
+				Stop:      p.prompt.Stop,
 			},
 		)
 		if err != nil {
 			responseChan <- types.Response{
-				Content: fmt.Sprintf("【Ollama服务响应异常: %v】", err),
-				Error:   err.Error(),
+				Content: fmt.Sprintf("【Ollama服务响应异常: %s%v】", utils.RequestTag(ctx), err),
+				Error:   utils.RequestTag(ctx) + err.Error(),
 			}
 			return
 		}
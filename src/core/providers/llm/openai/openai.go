@@ -2,7 +2,9 @@ package openai
 
 import (
 	"ai-server-go/src/core/providers/llm"
+	"ai-server-go/src/core/providers/schema"
 	"ai-server-go/src/core/types"
+	"ai-server-go/src/core/utils"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -15,18 +17,25 @@ type Provider struct {
 	*llm.BaseProvider
 	client    *openai.Client
 	maxTokens int
+	prompt    llm.PromptOptions // 停止序列和系统提示词模板
 }
 
 // 配置结构体
 type OpenAILLMConfig struct {
-	APIKey      string  `json:"api_key"`
+	APIKey      string  `json:"api_key" schema:"required,secret"`
 	BaseURL     string  `json:"base_url"`
 	ModelName   string  `json:"model_name"`
 	Temperature float64 `json:"temperature"`
-	MaxTokens   int     `json:"max_tokens"`
+	MaxTokens   int     `json:"max_tokens" schema:"default=500"`
 	TopP        float64 `json:"top_p"`
+
+	Stop                 []string `json:"stop"`                   // 停止序列，最多4项
+	SystemPromptTemplate string   `json:"system_prompt_template"` // 系统提示词模板，{system_prompt} 为原系统提示词
 }
 
+// maxStopSequences OpenAI接口支持的停止序列数量上限
+const maxStopSequences = 4
+
 // 通用配置解析
 func parseProps(props map[string]interface{}, out interface{}) error {
 	b, err := json.Marshal(props)
@@ -39,6 +48,7 @@ func parseProps(props map[string]interface{}, out interface{}) error {
 // 注册提供者
 func init() {
 	llm.Register("openai", NewProvider)
+	schema.Register("LLM", "openai", OpenAILLMConfig{})
 }
 
 // NewProvider 创建OpenAI提供者
@@ -47,10 +57,15 @@ func NewProvider(config *llm.Config) (llm.Provider, error) {
 	if err := parseProps(config.Extra, &cfg); err != nil {
 		return nil, fmt.Errorf("配置解析失败: %v", err)
 	}
+	prompt, err := llm.NewPromptOptions(cfg.Stop, cfg.SystemPromptTemplate, maxStopSequences)
+	if err != nil {
+		return nil, fmt.Errorf("配置解析失败: %v", err)
+	}
 	base := llm.NewBaseProvider(config)
 	provider := &Provider{
 		BaseProvider: base,
 		maxTokens:    cfg.MaxTokens,
+		prompt:       prompt,
 	}
 	if provider.maxTokens <= 0 {
 		provider.maxTokens = 500
@@ -92,6 +107,8 @@ func (p *Provider) Response(ctx context.Context, sessionID string, messages []ty
 	go func() {
 		defer close(responseChan)
 
+		messages = p.prompt.ApplySystemPrompt(messages)
+
 		// 转换消息格式
 		chatMessages := make([]openai.ChatCompletionMessage, len(messages))
 		for i, msg := range messages {
@@ -107,11 +124,12 @@ func (p *Provider) Response(ctx context.Context, sessionID string, messages []ty
 				Model:     p.Config().ModelName,
 				Messages:  chatMessages,
 				Stream:    true,
-				MaxTokens: p.maxTokens,
+				MaxTokens: llm.MaxTokens(ctx, p.maxTokens),
+				Stop:      p.prompt.Stop,
 			},
 		)
 		if err != nil {
-			responseChan <- fmt.Sprintf("【OpenAI服务响应异常: %v】", err)
+			responseChan <- fmt.Sprintf("【OpenAI服务响应异常: %s%v】", utils.RequestTag(ctx), err)
 			return
 		}
 		defer stream.Close()
@@ -145,6 +163,8 @@ func (p *Provider) ResponseWithFunctions(ctx context.Context, sessionID string,
 	go func() {
 		defer close(responseChan)
 
+		messages = p.prompt.ApplySystemPrompt(messages)
+
 		// 转换消息格式
 		chatMessages := make([]openai.ChatCompletionMessage, len(messages))
 		for i, msg := range messages {
@@ -180,16 +200,18 @@ func (p *Provider) ResponseWithFunctions(ctx context.Context, sessionID string,
 		stream, err := p.client.CreateChatCompletionStream(
 			ctx,
 			openai.ChatCompletionRequest{
-				Model:    p.Config().ModelName,
-				Messages: chatMessages,
-				Tools:    tools,
-				Stream:   true,
+				Model:     p.Config().ModelName,
+				Messages:  chatMessages,
+				Tools:     tools,
+				Stream:    true,
+				MaxTokens: llm.MaxTokens(ctx, 0),
+				Stop:      p.prompt.Stop,
 			},
 		)
 		if err != nil {
 			responseChan <- types.Response{
-				Content: fmt.Sprintf("【OpenAI服务响应异常: %v】", err),
-				Error:   err.Error(),
+				Content: fmt.Sprintf("【OpenAI服务响应异常: %s%v】", utils.RequestTag(ctx), err),
+				Error:   utils.RequestTag(ctx) + err.Error(),
 			}
 			return
 		}
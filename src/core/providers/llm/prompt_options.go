@@ -0,0 +1,63 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+
+	"ai-server-go/src/core/types"
+)
+
+/*
+* 模型相关的提示词约定：不同模型需要不同的停止序列和系统提示词格式，
+* provider Props 中的 stop 在每次请求时作为停止序列下发，system_prompt_template 包装对话的系统提示词，
+* 运维人员无需改代码即可为特定模型调整（如本地模型输出越过某个标记后仍继续生成）。
+ */
+
+// SystemPromptPlaceholder 系统提示词模板中代表原系统提示词的占位符
+const SystemPromptPlaceholder = "{system_prompt}"
+
+// PromptOptions 每次请求应用的停止序列和系统提示词模板
+type PromptOptions struct {
+	Stop                 []string // 停止序列
+	SystemPromptTemplate string   // 系统提示词模板，不含占位符时作为前缀加在原系统提示词之前
+}
+
+// NewPromptOptions 校验并创建提示词选项，maxStop 为provider支持的停止序列数量上限，0表示不限制
+func NewPromptOptions(stop []string, systemPromptTemplate string, maxStop int) (PromptOptions, error) {
+	for i, sequence := range stop {
+		if sequence == "" {
+			return PromptOptions{}, fmt.Errorf("stop 第%d项为空", i+1)
+		}
+	}
+	if maxStop > 0 && len(stop) > maxStop {
+		return PromptOptions{}, fmt.Errorf("stop 最多%d项，当前%d项", maxStop, len(stop))
+	}
+	return PromptOptions{Stop: stop, SystemPromptTemplate: systemPromptTemplate}, nil
+}
+
+// ApplySystemPrompt 用模板包装系统提示词，返回新的消息列表；没有系统消息时在开头插入按模板生成的系统消息
+func (o PromptOptions) ApplySystemPrompt(messages []types.Message) []types.Message {
+	if strings.TrimSpace(o.SystemPromptTemplate) == "" {
+		return messages
+	}
+	result := make([]types.Message, len(messages))
+	copy(result, messages)
+	for i := range result {
+		if result[i].Role == "system" {
+			result[i].Content = o.wrap(result[i].Content)
+			return result
+		}
+	}
+	return append([]types.Message{{Role: "system", Content: o.wrap("")}}, result...)
+}
+
+// wrap 将系统提示词代入模板
+func (o PromptOptions) wrap(prompt string) string {
+	if strings.Contains(o.SystemPromptTemplate, SystemPromptPlaceholder) {
+		return strings.ReplaceAll(o.SystemPromptTemplate, SystemPromptPlaceholder, prompt)
+	}
+	if prompt == "" {
+		return o.SystemPromptTemplate
+	}
+	return o.SystemPromptTemplate + "\n" + prompt
+}
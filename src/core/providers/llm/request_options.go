@@ -0,0 +1,24 @@
+package llm
+
+import "context"
+
+// maxTokensKey 单次请求输出token上限的context键
+type maxTokensKey struct{}
+
+// WithMaxTokens 返回携带单次请求输出token上限的context，优先于provider配置的max_tokens，n<=0时不设置
+func WithMaxTokens(ctx context.Context, n int) context.Context {
+	if n <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, maxTokensKey{}, n)
+}
+
+// MaxTokens 单次请求的输出token上限：context中设置了上限时使用该值，否则使用fallback
+func MaxTokens(ctx context.Context, fallback int) int {
+	if ctx != nil {
+		if n, ok := ctx.Value(maxTokensKey{}).(int); ok && n > 0 {
+			return n
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,175 @@
+package schema
+
+import (
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+* provider配置参数说明：各provider在注册时登记其配置结构体，由结构体的json标签和schema标签生成参数说明，
+* 供管理端按provider类型渲染Props表单。schema标签为逗号分隔的选项：
+*   required      必填
+*   secret        密钥，展示时需脱敏
+*   default=值    未填写时使用的默认值（必须放在最后，值中可以包含逗号）
+ */
+
+// Field 配置参数说明
+type Field struct {
+	Name     string      `json:"name"`              // Props中的参数名
+	Type     string      `json:"type"`              // string, integer, number, boolean, array, object
+	Required bool        `json:"required"`          // 是否必填
+	Secret   bool        `json:"secret"`            // 是否为密钥
+	Default  interface{} `json:"default,omitempty"` // 默认值
+	Fields   []Field     `json:"fields,omitempty"`  // 嵌套对象的参数
+}
+
+// Schema provider类型的配置参数说明
+type Schema struct {
+	Category string  `json:"category"` // provider类别，如 LLM、ASR
+	Type     string  `json:"type"`     // provider类型，即ProviderConfig.Type
+	Fields   []Field `json:"fields"`
+}
+
+var (
+	mu      sync.RWMutex
+	schemas = make(map[string]*Schema)
+)
+
+// key 注册表的键，类别不区分大小写
+func key(category, providerType string) string {
+	return strings.ToUpper(category) + "/" + providerType
+}
+
+// Register 登记provider类型的配置结构体，通常在provider的init中与工厂函数一起注册。
+// 多个类型共用同一配置结构体时，可通过required补充该类型额外的必填参数
+func Register(category, providerType string, config interface{}, required ...string) {
+	s := &Schema{
+		Category: strings.ToUpper(category),
+		Type:     providerType,
+		Fields:   fieldsOf(reflect.TypeOf(config)),
+	}
+	for i := range s.Fields {
+		if slices.Contains(required, s.Fields[i].Name) {
+			s.Fields[i].Required = true
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	schemas[key(category, providerType)] = s
+}
+
+// Get 获取provider类型的配置参数说明
+func Get(category, providerType string) (*Schema, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	s, ok := schemas[key(category, providerType)]
+	return s, ok
+}
+
+// Types 已登记的provider类型，category为空时返回全部类别
+func Types(category string) []Schema {
+	mu.RLock()
+	defer mu.RUnlock()
+	result := make([]Schema, 0, len(schemas))
+	for _, s := range schemas {
+		if category == "" || strings.EqualFold(s.Category, category) {
+			result = append(result, *s)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Category != result[j].Category {
+			return result[i].Category < result[j].Category
+		}
+		return result[i].Type < result[j].Type
+	})
+	return result
+}
+
+// fieldsOf 按结构体字段生成参数说明，忽略没有json标签或标签为"-"的字段
+func fieldsOf(t reflect.Type) []Field {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	fields := make([]Field, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := strings.SplitN(sf.Tag.Get("json"), ",", 2)[0]
+		if !sf.IsExported() || name == "" || name == "-" {
+			continue
+		}
+		field := Field{Name: name, Type: typeName(sf.Type)}
+		if field.Type == "object" && sf.Type.Kind() == reflect.Struct {
+			field.Fields = fieldsOf(sf.Type)
+		}
+		applyTag(&field, sf.Tag.Get("schema"), sf.Type)
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// applyTag 解析schema标签
+func applyTag(field *Field, tag string, t reflect.Type) {
+	for tag != "" {
+		option := tag
+		if strings.HasPrefix(option, "default=") {
+			field.Default = parseDefault(strings.TrimPrefix(option, "default="), t)
+			return
+		}
+		if comma := strings.Index(tag, ","); comma >= 0 {
+			option, tag = tag[:comma], tag[comma+1:]
+		} else {
+			tag = ""
+		}
+		switch strings.TrimSpace(option) {
+		case "required":
+			field.Required = true
+		case "secret":
+			field.Secret = true
+		}
+	}
+}
+
+// parseDefault 按字段类型解析默认值，解析失败时保留字符串
+func parseDefault(value string, t reflect.Type) interface{} {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return v
+		}
+	case reflect.Float32, reflect.Float64:
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			return v
+		}
+	case reflect.Bool:
+		if v, err := strconv.ParseBool(value); err == nil {
+			return v
+		}
+	}
+	return value
+}
+
+// typeName 字段类型对应的JSON类型
+func typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
@@ -3,6 +3,7 @@ package doubao
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
@@ -12,7 +13,9 @@ import (
 	"path/filepath"
 	"time"
 
+	"ai-server-go/src/core/providers/schema"
 	"ai-server-go/src/core/providers/tts"
+	"ai-server-go/src/core/utils"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
@@ -55,11 +58,11 @@ type Provider struct {
 
 // 配置结构体
 type DoubaoTTSConfig struct {
-	BaseURL   string `json:"base_url"`
+	BaseURL   string `json:"base_url" schema:"default=wss://openspeech.bytedance.com/api/v1/tts/ws_binary"`
 	Voice     string `json:"voice"`
 	OutputDir string `json:"output_dir"`
 	AppID     string `json:"appid"`
-	Token     string `json:"token"`
+	Token     string `json:"token" schema:"secret"`
 	Cluster   string `json:"cluster"`
 }
 
@@ -95,12 +98,12 @@ func NewProvider(config *tts.Config, deleteFile bool) (*Provider, error) {
 }
 
 // ToTTS 实现文本到语音的转换
-func (p *Provider) ToTTS(text string) (string, error) {
+func (p *Provider) ToTTS(ctx context.Context, text string) (string, error) {
 	// 创建WebSocket连接
 	header := http.Header{"Authorization": []string{fmt.Sprintf("Bearer;%s", p.Config().Token)}}
-	conn, _, err := websocket.DefaultDialer.Dial(p.baseURL, header)
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, p.baseURL, header)
 	if err != nil {
-		return "", fmt.Errorf("连接WebSocket服务器失败: %v", err)
+		return "", utils.RequestErrorf(ctx, "连接WebSocket服务器失败: %v", err)
 	}
 	defer conn.Close()
 
@@ -117,7 +120,7 @@ func (p *Provider) ToTTS(text string) (string, error) {
 		"audio": {
 			"voice_type":   p.Config().Voice,
 			"encoding":     "mp3",
-			"speed_ratio":  1.0,
+			"speed_ratio":  p.SpeechRate(),
 			"volume_ratio": 1.0,
 			"pitch_ratio":  1.0,
 		},
@@ -132,13 +135,13 @@ func (p *Provider) ToTTS(text string) (string, error) {
 	// 序列化并压缩请求参数
 	jsonData, err := json.Marshal(reqParams)
 	if err != nil {
-		return "", fmt.Errorf("序列化请求参数失败: %v", err)
+		return "", utils.RequestErrorf(ctx, "序列化请求参数失败: %v", err)
 	}
 
 	var b bytes.Buffer
 	w := gzip.NewWriter(&b)
 	if _, err := w.Write(jsonData); err != nil {
-		return "", fmt.Errorf("压缩请求数据失败: %v", err)
+		return "", utils.RequestErrorf(ctx, "压缩请求数据失败: %v", err)
 	}
 	w.Close()
 	compressed := b.Bytes()
@@ -153,7 +156,7 @@ func (p *Provider) ToTTS(text string) (string, error) {
 
 	// 发送请求
 	if err := conn.WriteMessage(websocket.BinaryMessage, request); err != nil {
-		return "", fmt.Errorf("发送请求失败: %v", err)
+		return "", utils.RequestErrorf(ctx, "发送请求失败: %v", err)
 	}
 
 	// 创建临时文件
@@ -162,7 +165,7 @@ func (p *Provider) ToTTS(text string) (string, error) {
 		outputDir = "tmp"
 	}
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return "", fmt.Errorf("创建输出目录失败: %v", err)
+		return "", utils.RequestErrorf(ctx, "创建输出目录失败: %v", err)
 	}
 
 	tempFile := filepath.Join(outputDir, fmt.Sprintf("doubao_tts_%d.mp3", time.Now().UnixNano()))
@@ -172,12 +175,12 @@ func (p *Provider) ToTTS(text string) (string, error) {
 	for {
 		_, message, err := conn.ReadMessage()
 		if err != nil {
-			return "", fmt.Errorf("接收响应失败: %v", err)
+			return "", utils.RequestErrorf(ctx, "接收响应失败: %v", err)
 		}
 
 		resp, err := p.parseResponse(message)
 		if err != nil {
-			return "", fmt.Errorf("解析响应失败: %v", err)
+			return "", utils.RequestErrorf(ctx, "解析响应失败: %v", err)
 		}
 
 		audioData = append(audioData, resp.Audio...)
@@ -188,7 +191,7 @@ func (p *Provider) ToTTS(text string) (string, error) {
 
 	// 写入音频文件
 	if err := os.WriteFile(tempFile, audioData, 0644); err != nil {
-		return "", fmt.Errorf("写入音频文件失败: %v", err)
+		return "", utils.RequestErrorf(ctx, "写入音频文件失败: %v", err)
 	}
 
 	return tempFile, nil
@@ -241,7 +244,8 @@ func (p *Provider) parseResponse(res []byte) (resp synResp, err error) {
 }
 
 func init() {
-	tts.Register("doubao", func(config *tts.Config, deleteFile bool) (tts.Provider, error) {
+	tts.Register("doubao", func(config *tts.Config, deleteFile bool, logger *utils.Logger) (tts.Provider, error) {
 		return NewProvider(config, deleteFile)
 	})
+	schema.Register("TTS", "doubao", DoubaoTTSConfig{})
 }
@@ -1,9 +1,13 @@
 package edge
 
 import (
+	"ai-server-go/src/core/providers/schema"
 	"ai-server-go/src/core/providers/tts"
+	"ai-server-go/src/core/utils"
+	"context"
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"time"
@@ -18,7 +22,7 @@ type Provider struct {
 
 // 配置结构体
 type EdgeTTSConfig struct {
-	Voice     string `json:"voice"`
+	Voice     string `json:"voice" schema:"default=zh-CN-XiaoxiaoNeural"`
 	OutputDir string `json:"output_dir"`
 }
 
@@ -51,7 +55,7 @@ func NewProvider(config *tts.Config, deleteFile bool) (*Provider, error) {
 
 // ToTTS 将文本转换为音频文件，并返回文件路径
 // 使用的edge库是github.com/wujunwei928/edge-tts-go，默认使用24k采样率
-func (p *Provider) ToTTS(text string) (string, error) {
+func (p *Provider) ToTTS(ctx context.Context, text string) (string, error) {
 	// 获取配置的声音，如果未配置则使用默认值
 	edgeTTSStartTime := time.Now()
 	voice := p.BaseProvider.Config().Voice
@@ -66,7 +70,7 @@ func (p *Provider) ToTTS(text string) (string, error) {
 	}
 	// Ensure output directory exists
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return "", fmt.Errorf("创建输出目录失败03 '%s': %v", outputDir, err)
+		return "", utils.RequestErrorf(ctx, "创建输出目录失败03 '%s': %v", outputDir, err)
 	}
 	// Use a unique filename
 	tempFile := filepath.Join(outputDir, fmt.Sprintf("edge_tts_go_%d.mp3", time.Now().UnixNano()))
@@ -75,17 +79,21 @@ func (p *Provider) ToTTS(text string) (string, error) {
 	connOptions := []edge_tts.CommunicateOption{
 		edge_tts.SetVoice(voice),
 	}
+	// 语速倍率换算为edge的百分比格式，如1.2 -> "+20%"
+	if rate := p.BaseProvider.SpeechRate(); rate != 1.0 {
+		connOptions = append(connOptions, edge_tts.SetRate(fmt.Sprintf("%+d%%", int(math.Round((rate-1.0)*100)))))
+	}
 
 	// 创建 Communicate 实例
 	conn, err := edge_tts.NewCommunicate(text, connOptions...)
 	if err != nil {
-		return "", fmt.Errorf("创建 edge-tts-go Communicate 失败: %v", err)
+		return "", utils.RequestErrorf(ctx, "创建 edge-tts-go Communicate 失败: %v", err)
 	}
 
 	// 获取音频流数据
 	audioData, err := conn.Stream()
 	if err != nil {
-		return "", fmt.Errorf("edge-tts-go 获取音频流失败: %v", err)
+		return "", utils.RequestErrorf(ctx, "edge-tts-go 获取音频流失败: %v", err)
 	}
 
 	ttsDuration := time.Since(edgeTTSStartTime)
@@ -95,12 +103,12 @@ func (p *Provider) ToTTS(text string) (string, error) {
 	// 将音频数据写入临时文件
 	err = os.WriteFile(tempFile, audioData, 0644)
 	if err != nil {
-		return "", fmt.Errorf("写入音频文件 '%s' 失败: %v", tempFile, err)
+		return "", utils.RequestErrorf(ctx, "写入音频文件 '%s' 失败: %v", tempFile, err)
 	}
 
 	// 检查文件是否成功创建
 	if _, err := os.Stat(tempFile); os.IsNotExist(err) {
-		return "", fmt.Errorf("edge-tts-go 未能创建音频文件: %s", tempFile)
+		return "", utils.RequestErrorf(ctx, "edge-tts-go 未能创建音频文件: %s", tempFile)
 	}
 	//fmt.Printf("音频文件已生成: %s\n", tempFile)
 
@@ -110,7 +118,8 @@ func (p *Provider) ToTTS(text string) (string, error) {
 
 func init() {
 	// 注册Edge TTS提供者
-	tts.Register("edge", func(config *tts.Config, deleteFile bool) (tts.Provider, error) {
+	tts.Register("edge", func(config *tts.Config, deleteFile bool, logger *utils.Logger) (tts.Provider, error) {
 		return NewProvider(config, deleteFile)
 	})
+	schema.Register("TTS", "edge", EdgeTTSConfig{})
 }
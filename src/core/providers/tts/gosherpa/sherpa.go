@@ -1,7 +1,9 @@
 package gosherpa
 
 import (
+	"ai-server-go/src/core/providers/schema"
 	"ai-server-go/src/core/providers/tts"
+	"ai-server-go/src/core/utils"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -15,12 +17,13 @@ import (
 // Provider Sherpa TTS提供者实现
 type Provider struct {
 	*tts.BaseProvider
-	conn *websocket.Conn
+	conn   *websocket.Conn
+	logger *utils.Logger
 }
 
 // 配置结构体
 type GoSherpaTTSConfig struct {
-	Cluster   string `json:"cluster"`
+	Cluster   string `json:"cluster" schema:"required"`
 	OutputDir string `json:"output_dir"`
 }
 
@@ -34,7 +37,7 @@ func parseProps(props map[string]interface{}, out interface{}) error {
 }
 
 // NewProvider 创建Sherpa TTS提供者
-func NewProvider(config *tts.Config, deleteFile bool) (*Provider, error) {
+func NewProvider(config *tts.Config, deleteFile bool, logger *utils.Logger) (*Provider, error) {
 	var cfg GoSherpaTTSConfig
 	if err := parseProps(config.Props, &cfg); err != nil {
 		return nil, fmt.Errorf("配置解析失败: %v", err)
@@ -53,11 +56,12 @@ func NewProvider(config *tts.Config, deleteFile bool) (*Provider, error) {
 	return &Provider{
 		BaseProvider: base,
 		conn:         conn,
+		logger:       logger,
 	}, nil
 }
 
 // ToTTS 将文本转换为音频文件，并返回文件路径
-func (p *Provider) ToTTS(text string) (string, error) {
+func (p *Provider) ToTTS(ctx context.Context, text string) (string, error) {
 	// 获取配置的声音，如果未配置则使用默认值
 	SherpaTTSStartTime := time.Now()
 
@@ -68,7 +72,7 @@ func (p *Provider) ToTTS(text string) (string, error) {
 	}
 	// Ensure output directory exists
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return "", fmt.Errorf("创建输出目录失败04 '%s': %v", outputDir, err)
+		return "", utils.RequestErrorf(ctx, "创建输出目录失败04 '%s': %v", outputDir, err)
 	}
 	// Use a unique filename
 	tempFile := filepath.Join(outputDir, fmt.Sprintf("go_sherpa_tts_%d.wav", time.Now().UnixNano()))
@@ -77,21 +81,21 @@ func (p *Provider) ToTTS(text string) (string, error) {
 	_, bytes, err := p.conn.ReadMessage()
 
 	if err != nil {
-		return "", fmt.Errorf("go-sherpa-tts 获取音频流失败: %v", err)
+		return "", utils.RequestErrorf(ctx, "go-sherpa-tts 获取音频流失败: %v", err)
 	}
 
 	ttsDuration := time.Since(SherpaTTSStartTime)
-	fmt.Println(fmt.Sprintf("go-sherpa-tts 语音合成完成，耗时: %s", ttsDuration))
+	p.logger.Debug("%sgo-sherpa-tts 语音合成完成，耗时: %s", utils.RequestTag(ctx), ttsDuration)
 
 	// 将音频数据写入临时文件
 	err = os.WriteFile(tempFile, bytes, 0644)
 	if err != nil {
-		return "", fmt.Errorf("写入音频文件 '%s' 失败: %v", tempFile, err)
+		return "", utils.RequestErrorf(ctx, "写入音频文件 '%s' 失败: %v", tempFile, err)
 	}
 
 	// 检查文件是否成功创建
 	if _, err := os.Stat(tempFile); os.IsNotExist(err) {
-		return "", fmt.Errorf("go-sherpa-tts 未能创建音频文件: %s", tempFile)
+		return "", utils.RequestErrorf(ctx, "go-sherpa-tts 未能创建音频文件: %s", tempFile)
 	}
 
 	// Return the path to the generated audio file
@@ -100,7 +104,8 @@ func (p *Provider) ToTTS(text string) (string, error) {
 
 func init() {
 	// 注册Sherpa TTS提供者
-	tts.Register("gosherpa", func(config *tts.Config, deleteFile bool) (tts.Provider, error) {
-		return NewProvider(config, deleteFile)
+	tts.Register("gosherpa", func(config *tts.Config, deleteFile bool, logger *utils.Logger) (tts.Provider, error) {
+		return NewProvider(config, deleteFile, logger)
 	})
+	schema.Register("TTS", "gosherpa", GoSherpaTTSConfig{})
 }
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 
 	"ai-server-go/src/core/providers"
+	"ai-server-go/src/core/utils"
 )
 
 // Config TTS配置结构
@@ -18,6 +19,7 @@ type Config struct {
 	AppID      string                 `yaml:"appid"`
 	Token      string                 `yaml:"token"`
 	Cluster    string                 `yaml:"cluster"`
+	SpeechRate float64                `yaml:"speech_rate,omitempty"` // 语速倍率，1.0为正常语速，0表示使用提供者配置
 	Props      map[string]interface{} `json:"props,omitempty"`
 }
 
@@ -37,6 +39,20 @@ func (p *BaseProvider) Config() *Config {
 	return p.config
 }
 
+// SpeechRate 语速倍率，优先使用 Config.SpeechRate，其次provider配置 speech_rate，默认1.0
+func (p *BaseProvider) SpeechRate() float64 {
+	if p.config == nil {
+		return 1.0
+	}
+	if p.config.SpeechRate > 0 {
+		return p.config.SpeechRate
+	}
+	if v, ok := p.config.Props["speech_rate"].(float64); ok && v > 0 {
+		return v
+	}
+	return 1.0
+}
+
 // DeleteFile 获取是否删除文件标志
 func (p *BaseProvider) DeleteFile() bool {
 	return p.deleteFile
@@ -75,7 +91,7 @@ func (p *BaseProvider) Cleanup() error {
 }
 
 // Factory TTS工厂函数类型
-type Factory func(config *Config, deleteFile bool) (Provider, error)
+type Factory func(config *Config, deleteFile bool, logger *utils.Logger) (Provider, error)
 
 var (
 	factories = make(map[string]Factory)
@@ -87,13 +103,13 @@ func Register(name string, factory Factory) {
 }
 
 // Create 创建TTS提供者实例
-func Create(name string, config *Config, deleteFile bool) (Provider, error) {
+func Create(name string, config *Config, deleteFile bool, logger *utils.Logger) (Provider, error) {
 	factory, ok := factories[name]
 	if !ok {
 		return nil, fmt.Errorf("未知的TTS提供者: %s", name)
 	}
 
-	provider, err := factory(config, deleteFile)
+	provider, err := factory(config, deleteFile, logger)
 	if err != nil {
 		return nil, fmt.Errorf("创建TTS提供者失败: %v", err)
 	}
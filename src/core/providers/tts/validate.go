@@ -0,0 +1,71 @@
+package tts
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// minAudioFileBytes 压缩格式（mp3、opus等）音频文件的最小合理大小，小于此值视为合成失败
+	minAudioFileBytes = 128
+	// minAudioDuration WAV音频的最短合理时长
+	minAudioDuration = 50 * time.Millisecond
+	// wavHeaderBytes 标准WAV文件头长度
+	wavHeaderBytes = 44
+)
+
+// ValidateAudioFile 检查合成结果：文件存在、非空，WAV文件按文件头计算的时长不短于 minAudioDuration；
+// 部分TTS服务出错时仍返回成功和空文件，设备收到后只会静音，需在下发前当作合成失败处理
+func ValidateAudioFile(path string) error {
+	if path == "" {
+		return fmt.Errorf("TTS未返回音频文件")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("TTS音频文件不存在: %v", err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("TTS音频路径不是文件: %s", path)
+	}
+	if info.Size() == 0 {
+		return fmt.Errorf("TTS音频文件为空: %s", path)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".wav") {
+		return validateWAV(path, info.Size())
+	}
+	if info.Size() < minAudioFileBytes {
+		return fmt.Errorf("TTS音频文件过小（%d字节）: %s", info.Size(), path)
+	}
+	return nil
+}
+
+// validateWAV 按WAV文件头的字节率估算时长
+func validateWAV(path string, size int64) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("打开TTS音频文件失败: %v", err)
+	}
+	defer file.Close()
+
+	header := make([]byte, wavHeaderBytes)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return fmt.Errorf("TTS音频文件不完整（%d字节）: %s", size, path)
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return fmt.Errorf("TTS音频文件不是有效的WAV: %s", path)
+	}
+	byteRate := binary.LittleEndian.Uint32(header[28:32])
+	if byteRate == 0 {
+		return fmt.Errorf("TTS音频文件头无效（字节率为0）: %s", path)
+	}
+	duration := time.Duration(size-wavHeaderBytes) * time.Second / time.Duration(byteRate)
+	if duration < minAudioDuration {
+		return fmt.Errorf("TTS音频时长过短（%v）: %s", duration, path)
+	}
+	return nil
+}
@@ -233,6 +233,12 @@ func (p *SileroProvider) Detect(ctx context.Context, audio []byte, sampleRate in
 // 工厂注册
 func init() {
 	vad.Register("silero", NewProvider)
+	vad.RegisterModel("silero", NewModel)
+}
+
+// NewModel 创建逐段返回语音概率的silero模型
+func NewModel(config *vad.Config, logger *utils.Logger) (vad.VadModel, error) {
+	return &SileroModel{config: config, logger: logger}, nil
 }
 
 func NewProvider(config *vad.Config, logger *utils.Logger) (vad.Provider, error) {
@@ -72,3 +72,31 @@ func Create(name string, config *Config, logger *utils.Logger) (Provider, error)
 	}
 	return factory(config, logger)
 }
+
+// ModelFactory VAD模型工厂函数类型，用于逐段获取语音概率（如播放期间的打断检测）
+type ModelFactory func(config *Config, logger *utils.Logger) (VadModel, error)
+
+var (
+	modelFactories = make(map[string]ModelFactory)
+)
+
+// RegisterModel 注册VAD模型工厂
+func RegisterModel(name string, factory ModelFactory) {
+	modelFactories[name] = factory
+}
+
+// CreateModel 创建并初始化VAD模型
+func CreateModel(name string, config *Config, logger *utils.Logger) (VadModel, error) {
+	factory, ok := modelFactories[name]
+	if !ok {
+		return nil, fmt.Errorf("未知的VAD模型类型: %s", name)
+	}
+	model, err := factory(config, logger)
+	if err != nil {
+		return nil, fmt.Errorf("创建VAD模型失败: %v", err)
+	}
+	if err := model.Initialize(); err != nil {
+		return nil, fmt.Errorf("初始化VAD模型失败: %v", err)
+	}
+	return model, nil
+}
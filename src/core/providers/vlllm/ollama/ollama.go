@@ -1,6 +1,7 @@
 package ollama
 
 import (
+	"ai-server-go/src/core/providers/schema"
 	"ai-server-go/src/core/providers/vlllm"
 	"ai-server-go/src/core/utils"
 )
@@ -30,4 +31,5 @@ func NewProvider(config *vlllm.Config, logger *utils.Logger) (*vlllm.Provider, e
 // init 注册Ollama VLLLM提供者
 func init() {
 	vlllm.Register("ollama", NewProvider)
+	schema.Register("VLLLM", "ollama", vlllm.VLLLMConfig{}, "model_name")
 }
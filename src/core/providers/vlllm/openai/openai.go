@@ -1,6 +1,7 @@
 package openai
 
 import (
+	"ai-server-go/src/core/providers/schema"
 	"ai-server-go/src/core/providers/vlllm"
 	"ai-server-go/src/core/utils"
 )
@@ -30,4 +31,5 @@ func NewProvider(config *vlllm.Config, logger *utils.Logger) (*vlllm.Provider, e
 // init 注册OpenAI VLLLM提供者
 func init() {
 	vlllm.Register("openai", NewProvider)
+	schema.Register("VLLLM", "openai", vlllm.VLLLMConfig{}, "model_name", "api_key")
 }
@@ -0,0 +1,128 @@
+package openweathermap
+
+import (
+	"ai-server-go/src/core/providers/schema"
+	"ai-server-go/src/core/providers/weather"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// defaultBaseURL OpenWeatherMap 当前天气接口地址
+const defaultBaseURL = "https://api.openweathermap.org/data/2.5"
+
+// Provider OpenWeatherMap 天气提供者
+type Provider struct {
+	client  *http.Client
+	baseURL string
+	apiKey  string
+	lang    string
+}
+
+// 配置结构体
+type OpenWeatherMapConfig struct {
+	APIKey  string `json:"api_key" schema:"required,secret"`
+	BaseURL string `json:"base_url" schema:"default=https://api.openweathermap.org/data/2.5"`
+	Lang    string `json:"lang" schema:"default=zh_cn"`
+	Timeout int    `json:"timeout" schema:"default=5"` // 请求超时（秒）
+}
+
+// 注册提供者
+func init() {
+	weather.Register("openweathermap", NewProvider)
+	schema.Register("WEATHER", "openweathermap", OpenWeatherMapConfig{})
+}
+
+// NewProvider 创建OpenWeatherMap天气提供者
+func NewProvider(config *weather.Config) (weather.Provider, error) {
+	var cfg OpenWeatherMapConfig
+	b, err := json.Marshal(config.Extra)
+	if err != nil {
+		return nil, fmt.Errorf("配置解析失败: %v", err)
+	}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("配置解析失败: %v", err)
+	}
+	if cfg.APIKey == "" {
+		return nil, fmt.Errorf("缺少api_key配置")
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = defaultBaseURL
+	}
+	if cfg.Lang == "" {
+		cfg.Lang = "zh_cn"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5
+	}
+	return &Provider{
+		client:  &http.Client{Timeout: time.Duration(cfg.Timeout) * time.Second},
+		baseURL: strings.TrimRight(cfg.BaseURL, "/"),
+		apiKey:  cfg.APIKey,
+		lang:    cfg.Lang,
+	}, nil
+}
+
+// currentResponse 当前天气接口中用到的字段
+type currentResponse struct {
+	Name    string `json:"name"`
+	Weather []struct {
+		Description string `json:"description"`
+	} `json:"weather"`
+	Main struct {
+		Temp      float64 `json:"temp"`
+		FeelsLike float64 `json:"feels_like"`
+		Humidity  int     `json:"humidity"`
+	} `json:"main"`
+	Wind struct {
+		Speed float64 `json:"speed"`
+	} `json:"wind"`
+	Message string `json:"message"`
+}
+
+// Current 查询城市当前天气
+func (p *Provider) Current(ctx context.Context, city string) (*weather.Report, error) {
+	query := url.Values{}
+	query.Set("q", city)
+	query.Set("appid", p.apiKey)
+	query.Set("units", "metric")
+	query.Set("lang", p.lang)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/weather?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建天气请求失败: %v", err)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("查询天气失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("读取天气响应失败: %v", err)
+	}
+	var data currentResponse
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("解析天气响应失败: status=%d, %v", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("查询天气失败: status=%d, %s", resp.StatusCode, data.Message)
+	}
+
+	report := &weather.Report{
+		City:        city,
+		Temperature: data.Main.Temp,
+		FeelsLike:   data.Main.FeelsLike,
+		Humidity:    data.Main.Humidity,
+		Wind:        fmt.Sprintf("风速%.1f米/秒", data.Wind.Speed),
+	}
+	if len(data.Weather) > 0 {
+		report.Condition = data.Weather[0].Description
+	}
+	return report, nil
+}
@@ -0,0 +1,70 @@
+package weather
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Config 天气提供者配置
+type Config struct {
+	Type  string                 // provider类型（如 wttr、openweathermap）
+	Extra map[string]interface{} // ProviderConfig.Props 中的扩展参数（api_key等）
+}
+
+// Report 城市当前天气
+type Report struct {
+	City        string  // 城市名称
+	Condition   string  // 天气状况描述，如“晴”“小雨”
+	Temperature float64 // 气温（摄氏度）
+	FeelsLike   float64 // 体感温度（摄氏度）
+	Humidity    int     // 相对湿度（%）
+	Wind        string  // 风向风速描述
+}
+
+// String 转换为提供给LLM的天气描述
+func (r Report) String() string {
+	parts := []string{fmt.Sprintf("%s当前%s，气温%.0f℃", r.City, r.Condition, r.Temperature)}
+	if r.FeelsLike != r.Temperature {
+		parts = append(parts, fmt.Sprintf("体感%.0f℃", r.FeelsLike))
+	}
+	if r.Humidity > 0 {
+		parts = append(parts, fmt.Sprintf("湿度%d%%", r.Humidity))
+	}
+	if r.Wind != "" {
+		parts = append(parts, r.Wind)
+	}
+	return strings.Join(parts, "，") + "。"
+}
+
+// Provider 天气提供者接口
+type Provider interface {
+	// 查询城市当前天气
+	Current(ctx context.Context, city string) (*Report, error)
+}
+
+// Factory 天气提供者工厂函数类型
+type Factory func(config *Config) (Provider, error)
+
+var (
+	factories = make(map[string]Factory)
+)
+
+// Register 注册天气提供者工厂
+func Register(name string, factory Factory) {
+	factories[name] = factory
+}
+
+// Create 创建天气提供者实例
+func Create(name string, config *Config) (Provider, error) {
+	factory, ok := factories[name]
+	if !ok {
+		return nil, fmt.Errorf("未知的天气提供者: %s", name)
+	}
+
+	provider, err := factory(config)
+	if err != nil {
+		return nil, fmt.Errorf("创建天气提供者失败: %v", err)
+	}
+	return provider, nil
+}
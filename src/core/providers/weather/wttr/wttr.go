@@ -0,0 +1,128 @@
+package wttr
+
+import (
+	"ai-server-go/src/core/providers/schema"
+	"ai-server-go/src/core/providers/weather"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultBaseURL wttr.in 服务地址，无需API Key
+const defaultBaseURL = "https://wttr.in"
+
+// Provider wttr.in 天气提供者，未配置天气提供者时作为默认实现
+type Provider struct {
+	client  *http.Client
+	baseURL string
+}
+
+// 配置结构体
+type WttrConfig struct {
+	BaseURL string `json:"base_url" schema:"default=https://wttr.in"`
+	Timeout int    `json:"timeout" schema:"default=5"` // 请求超时（秒）
+}
+
+// 注册提供者
+func init() {
+	weather.Register("wttr", NewProvider)
+	schema.Register("WEATHER", "wttr", WttrConfig{})
+}
+
+// NewProvider 创建wttr.in天气提供者
+func NewProvider(config *weather.Config) (weather.Provider, error) {
+	var cfg WttrConfig
+	if config != nil && config.Extra != nil {
+		b, err := json.Marshal(config.Extra)
+		if err != nil {
+			return nil, fmt.Errorf("配置解析失败: %v", err)
+		}
+		if err := json.Unmarshal(b, &cfg); err != nil {
+			return nil, fmt.Errorf("配置解析失败: %v", err)
+		}
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = defaultBaseURL
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5
+	}
+	return &Provider{
+		client:  &http.Client{Timeout: time.Duration(cfg.Timeout) * time.Second},
+		baseURL: strings.TrimRight(cfg.BaseURL, "/"),
+	}, nil
+}
+
+// wttrResponse wttr.in j1格式中用到的字段
+type wttrResponse struct {
+	CurrentCondition []struct {
+		TempC          string `json:"temp_C"`
+		FeelsLikeC     string `json:"FeelsLikeC"`
+		Humidity       string `json:"humidity"`
+		WindDir16Point string `json:"winddir16Point"`
+		WindSpeedKmph  string `json:"windspeedKmph"`
+		LangZh         []struct {
+			Value string `json:"value"`
+		} `json:"lang_zh"`
+		WeatherDesc []struct {
+			Value string `json:"value"`
+		} `json:"weatherDesc"`
+	} `json:"current_condition"`
+}
+
+// Current 查询城市当前天气
+func (p *Provider) Current(ctx context.Context, city string) (*weather.Report, error) {
+	requestURL := fmt.Sprintf("%s/%s?format=j1&lang=zh", p.baseURL, url.PathEscape(city))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建天气请求失败: %v", err)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("查询天气失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("读取天气响应失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("查询天气失败: status=%d", resp.StatusCode)
+	}
+
+	var data wttrResponse
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("解析天气响应失败: %v", err)
+	}
+	if len(data.CurrentCondition) == 0 {
+		return nil, fmt.Errorf("天气响应中没有当前天气")
+	}
+	current := data.CurrentCondition[0]
+
+	report := &weather.Report{
+		City:        city,
+		Temperature: parseFloat(current.TempC),
+		FeelsLike:   parseFloat(current.FeelsLikeC),
+		Wind:        fmt.Sprintf("%s风 %s公里/小时", current.WindDir16Point, current.WindSpeedKmph),
+	}
+	report.Humidity, _ = strconv.Atoi(current.Humidity)
+	if len(current.LangZh) > 0 {
+		report.Condition = strings.TrimSpace(current.LangZh[0].Value)
+	} else if len(current.WeatherDesc) > 0 {
+		report.Condition = strings.TrimSpace(current.WeatherDesc[0].Value)
+	}
+	return report, nil
+}
+
+// parseFloat 解析数值字段，无效时返回0
+func parseFloat(value string) float64 {
+	f, _ := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	return f
+}
@@ -0,0 +1,188 @@
+package scheduler
+
+import (
+	"ai-server-go/src/core/utils"
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+* 定时任务调度：后台维护任务（健康检查、过期数据清理等）统一注册为命名的周期任务，
+* 每个任务独立协程按间隔执行，上一次未结束时不会重叠执行；任务panic会被恢复并记录，不影响其他任务。
+* 调度器随传入的上下文取消而停止，Stop会等待进行中的任务结束，保证关闭时不遗留协程。
+ */
+
+// ErrStopped 调度器已停止，不能再注册任务
+var ErrStopped = errors.New("调度器已停止")
+
+// Job 周期任务
+type Job struct {
+	Name     string                          // 任务名称，调度器内唯一
+	Interval time.Duration                   // 执行间隔，首次执行在启动一个间隔之后
+	Run      func(ctx context.Context) error // 任务函数，调度器停止时ctx被取消
+}
+
+// JobStatus 任务运行状态
+type JobStatus struct {
+	Name         string        `json:"name"`
+	Interval     time.Duration `json:"interval"`
+	Runs         int64         `json:"runs"`
+	Failures     int64         `json:"failures"`
+	LastRun      time.Time     `json:"last_run"`
+	LastDuration time.Duration `json:"last_duration"`
+	LastError    string        `json:"last_error,omitempty"`
+}
+
+// jobState 任务及其运行统计
+type jobState struct {
+	job    Job
+	mu     sync.Mutex
+	status JobStatus
+}
+
+// Scheduler 定时任务调度器
+type Scheduler struct {
+	logger *utils.Logger
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	jobs    map[string]*jobState
+	stopped bool
+}
+
+// New 创建调度器，parent取消或调用Stop时所有任务停止
+func New(parent context.Context, logger *utils.Logger) *Scheduler {
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parent)
+	return &Scheduler{
+		logger: logger,
+		ctx:    ctx,
+		cancel: cancel,
+		jobs:   make(map[string]*jobState),
+	}
+}
+
+// Register 注册并立即启动周期任务，名称重复或调度器已停止时返回错误
+func (s *Scheduler) Register(job Job) error {
+	if job.Name == "" {
+		return fmt.Errorf("任务名称不能为空")
+	}
+	if job.Interval <= 0 {
+		return fmt.Errorf("任务 %s 的执行间隔无效: %v", job.Name, job.Interval)
+	}
+	if job.Run == nil {
+		return fmt.Errorf("任务 %s 未指定任务函数", job.Name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped || s.ctx.Err() != nil {
+		return ErrStopped
+	}
+	if _, exists := s.jobs[job.Name]; exists {
+		return fmt.Errorf("任务已存在: %s", job.Name)
+	}
+	state := &jobState{job: job, status: JobStatus{Name: job.Name, Interval: job.Interval}}
+	s.jobs[job.Name] = state
+
+	s.wg.Add(1)
+	go s.loop(state)
+	if s.logger != nil {
+		s.logger.Info("注册定时任务 %s，间隔 %v", job.Name, job.Interval)
+	}
+	return nil
+}
+
+// Stop 停止所有任务并等待进行中的任务结束，可重复调用
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+	s.cancel()
+	s.wg.Wait()
+}
+
+// Jobs 返回所有任务的运行状态，按名称排序
+func (s *Scheduler) Jobs() []JobStatus {
+	s.mu.Lock()
+	states := make([]*jobState, 0, len(s.jobs))
+	for _, state := range s.jobs {
+		states = append(states, state)
+	}
+	s.mu.Unlock()
+
+	statuses := make([]JobStatus, 0, len(states))
+	for _, state := range states {
+		state.mu.Lock()
+		statuses = append(statuses, state.status)
+		state.mu.Unlock()
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// loop 按间隔执行任务，任务在本协程内同步执行，因此不会重叠
+func (s *Scheduler) loop(state *jobState) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(state.job.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.runOnce(state)
+		}
+	}
+}
+
+// runOnce 执行一次任务，恢复panic并记录耗时和错误
+func (s *Scheduler) runOnce(state *jobState) {
+	start := time.Now()
+	err := s.safeRun(state.job)
+	duration := time.Since(start)
+
+	state.mu.Lock()
+	state.status.Runs++
+	state.status.LastRun = start
+	state.status.LastDuration = duration
+	state.status.LastError = ""
+	if err != nil {
+		state.status.Failures++
+		state.status.LastError = err.Error()
+	}
+	state.mu.Unlock()
+
+	if err != nil && s.ctx.Err() == nil {
+		if s.logger != nil {
+			s.logger.Warn("定时任务 %s 执行失败（耗时 %v）: %v", state.job.Name, duration, err)
+		}
+		return
+	}
+	if s.logger != nil {
+		s.logger.Debug("定时任务 %s 执行完成，耗时 %v", state.job.Name, duration)
+	}
+}
+
+// safeRun 执行任务函数，将panic转换为错误
+func (s *Scheduler) safeRun(job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("任务panic: %v", r)
+			if s.logger != nil {
+				s.logger.Error("定时任务 %s 发生panic: %v\n%s", job.Name, r, debug.Stack())
+			}
+		}
+	}()
+	return job.Run(s.ctx)
+}
@@ -67,6 +67,20 @@ type Message struct {
 	Content    string     `json:"content"`
 	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
 	ToolCallID string     `json:"tool_call_id,omitempty"`
+	// Attachments 多模态附件（图片等），用于在后续轮次中还原视觉对话历史
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// Attachment 消息附件结构
+type Attachment struct {
+	Type     string `json:"type"`      // 附件类型: image, audio
+	Ref      string `json:"ref"`       // 存储引用: URL 或 data URL
+	MimeType string `json:"mime_type"` // MIME类型，如 image/jpeg
+}
+
+// HasAttachments 判断消息是否包含附件
+func (m *Message) HasAttachments() bool {
+	return len(m.Attachments) > 0
 }
 
 func (m *Message) Print() {
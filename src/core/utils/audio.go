@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"os"
@@ -66,6 +68,10 @@ func (d *OpusDecoder) Decode(opusData []byte) ([]byte, error) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
+	if d.decoder == nil {
+		return nil, fmt.Errorf("Opus解码器已关闭")
+	}
+
 	// 使用预分配的缓冲区
 	n, err := d.decoder.Decode(opusData, d.outBuffer)
 	if err != nil {
@@ -220,7 +226,7 @@ func SaveAudioToWavFile(data []byte, fileName string, sampleRate int, channels i
 }
 
 // 写入WAV文件头
-func writeWavHeader(file *os.File, dataSize int, sampleRate, channels, bitsPerSample int) error {
+func writeWavHeader(file io.Writer, dataSize int, sampleRate, channels, bitsPerSample int) error {
 	// RIFF块
 	header := make([]byte, 44)
 	copy(header[0:4], []byte("RIFF"))
@@ -287,6 +293,15 @@ func writeWavHeader(file *os.File, dataSize int, sampleRate, channels, bitsPerSa
 	return err
 }
 
+// EncodeWav 将PCM数据封装为内存中的WAV文件
+func EncodeWav(data []byte, sampleRate, channels, bitsPerSample int) []byte {
+	var buf bytes.Buffer
+	buf.Grow(44 + len(data))
+	_ = writeWavHeader(&buf, len(data), sampleRate, channels, bitsPerSample)
+	buf.Write(data)
+	return buf.Bytes()
+}
+
 // 保留原来的函数，但使用新函数
 func SaveAudioToFile(data []byte) error {
 	// 默认使用16kHz, 单声道, 16位
@@ -385,6 +400,17 @@ func AudioToPCMData(audioFile string) ([][]byte, float64, error) {
 
 // AudioToOpusData 将音频文件转换为Opus数据块
 func AudioToOpusData(audioFile string) ([][]byte, float64, error) {
+	return AudioToOpusDataWithOptions(audioFile, OpusEncodeOptions{})
+}
+
+// OpusEncodeOptions Opus编码参数，零值表示使用编码器默认值
+type OpusEncodeOptions struct {
+	Bitrate    int // 码率（bps），有效范围6000-510000
+	Complexity int // 编码复杂度，1-10，越高音质越好、CPU占用越高
+}
+
+// AudioToOpusDataWithOptions 按指定的码率和复杂度将音频文件转换为Opus数据块
+func AudioToOpusDataWithOptions(audioFile string, options OpusEncodeOptions) ([][]byte, float64, error) {
 
 	var pcmData [][]byte
 	var err error
@@ -425,7 +451,7 @@ func AudioToOpusData(audioFile string) ([][]byte, float64, error) {
 	}
 
 	// 将PCM转换为Opus
-	opusData, err := PCMSlicesToOpusData(pcmData, opusSampleRate, channels, 0)
+	opusData, err := PCMSlicesToOpusDataWithOptions(pcmData, opusSampleRate, channels, options)
 	if err != nil {
 		return nil, 0, fmt.Errorf("PCM转Opus失败: %v", err)
 	}
@@ -471,6 +497,25 @@ func SaveAudioFile(data []byte, filename string) error {
 	return nil
 }
 
+// BytesToFloat32 将16bit小端PCM转换为[-1,1]的浮点采样
+func BytesToFloat32(pcm []byte) []float32 {
+	samples := make([]float32, len(pcm)/2)
+	for i := range samples {
+		samples[i] = float32(int16(binary.LittleEndian.Uint16(pcm[i*2:]))) / 32768.0
+	}
+	return samples
+}
+
+// SaveFloat32PCM 将[-1,1]的浮点采样保存为16kHz单声道16bit WAV文件
+func SaveFloat32PCM(samples []float32, filename string) error {
+	data := make([]byte, len(samples)*2)
+	for i, sample := range samples {
+		sample = max(-1, min(1, sample))
+		binary.LittleEndian.PutUint16(data[i*2:], uint16(int16(sample*32767)))
+	}
+	return SaveAudioFile(EncodeWav(data, 16000, 1, 16), filename)
+}
+
 // PCMToOpusData 将PCM数据编码为Opus格式
 func PCMToOpusData(pcmData []byte, sampleRate int, channels int) ([]byte, error) {
 	if len(pcmData) == 0 {
@@ -649,6 +694,11 @@ func MP3ToOpusFile(inputFile, outputFile string, bitrate int) error {
 
 // PCMSlicesToOpusData 将PCM数据切片批量编码为Opus格式
 func PCMSlicesToOpusData(pcmSlices [][]byte, sampleRate int, channels int, bitrate int) ([][]byte, error) {
+	return PCMSlicesToOpusDataWithOptions(pcmSlices, sampleRate, channels, OpusEncodeOptions{Bitrate: bitrate})
+}
+
+// PCMSlicesToOpusDataWithOptions 按指定的编码参数将PCM数据切片批量编码为Opus格式
+func PCMSlicesToOpusDataWithOptions(pcmSlices [][]byte, sampleRate int, channels int, options OpusEncodeOptions) ([][]byte, error) {
 	if len(pcmSlices) == 0 {
 		return nil, fmt.Errorf("PCM数据切片为空")
 	}
@@ -665,6 +715,8 @@ func PCMSlicesToOpusData(pcmSlices [][]byte, sampleRate int, channels int, bitra
 		MaxChannels:   channels,
 		Application:   opus.AppVoIP,
 		FrameDuration: opus.Framesize60Ms, // 使用60ms帧长
+		Bitrate:       options.Bitrate,
+		Complexity:    options.Complexity,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("创建Opus编码器失败: %v", err)
@@ -0,0 +1,215 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hajimehoshi/go-mp3"
+)
+
+// 上传音频允许的采样率范围，头部声明的采样率超出范围时拒绝，避免按异常采样率换算出超大的输出
+const (
+	minAudioSampleRate = 8000
+	maxAudioSampleRate = 192000
+)
+
+// DetectAudioFormat 根据文件头判断音频格式（wav/mp3），无法识别时按扩展名判断，默认视为原始PCM
+func DetectAudioFormat(data []byte, filename string) string {
+	if len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WAVE" {
+		return "wav"
+	}
+	if len(data) >= 3 && (string(data[0:3]) == "ID3" || (data[0] == 0xFF && data[1]&0xE0 == 0xE0)) {
+		return "mp3"
+	}
+	switch strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), ".")) {
+	case "wav", "wave":
+		return "wav"
+	case "mp3":
+		return "mp3"
+	}
+	return "pcm"
+}
+
+// DecodeAudioToPCM 将wav/mp3/原始PCM音频转换为指定采样率的16位单声道PCM，返回PCM数据和时长（秒）
+// 原始PCM按16位单声道、目标采样率处理；maxDuration 大于0时，解码前按头部信息估算时长，超出则拒绝
+func DecodeAudioToPCM(data []byte, format string, targetRate int, maxDuration time.Duration) ([]byte, float64, error) {
+	var (
+		samples    []int16
+		sampleRate int
+		err        error
+	)
+
+	switch format {
+	case "wav":
+		samples, sampleRate, err = decodeWavSamples(data, maxDuration)
+	case "mp3":
+		samples, sampleRate, err = decodeMP3Samples(data, maxDuration)
+	case "pcm":
+		if err = checkAudioDuration(len(data)/2, targetRate, maxDuration); err == nil {
+			samples, sampleRate = bytesToSamples(data), targetRate
+		}
+	default:
+		return nil, 0, fmt.Errorf("不支持的音频格式: %s", format)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(samples) == 0 {
+		return nil, 0, fmt.Errorf("音频数据为空")
+	}
+
+	pcm := samplesToBytes(samples)
+	if sampleRate != targetRate {
+		resampler := NewResampler(sampleRate, targetRate, ResampleQualityMedium)
+		expected := int(int64(len(samples))*int64(targetRate)/int64(sampleRate)) * 2
+		pcm = append(resampler.Process(pcm), resampler.Flush()...)
+		if len(pcm) > expected {
+			pcm = pcm[:expected]
+		}
+	}
+	duration := float64(len(pcm)/2) / float64(targetRate)
+	return pcm, duration, nil
+}
+
+// checkSampleRate 校验头部声明的采样率
+func checkSampleRate(sampleRate int) error {
+	if sampleRate < minAudioSampleRate || sampleRate > maxAudioSampleRate {
+		return fmt.Errorf("不支持的采样率: %dHz，允许范围 %d-%dHz", sampleRate, minAudioSampleRate, maxAudioSampleRate)
+	}
+	return nil
+}
+
+// checkAudioDuration 按单声道采样数估算时长，超过 maxDuration 时返回错误；maxDuration 为0时不限制
+func checkAudioDuration(frames, sampleRate int, maxDuration time.Duration) error {
+	if maxDuration <= 0 || sampleRate <= 0 {
+		return nil
+	}
+	duration := time.Duration(int64(frames) * int64(time.Second) / int64(sampleRate))
+	if duration > maxDuration {
+		return fmt.Errorf("音频时长 %.1f 秒超过限制 %.0f 秒", duration.Seconds(), maxDuration.Seconds())
+	}
+	return nil
+}
+
+// decodeWavSamples 解析16位PCM WAV，多声道时混合为单声道
+func decodeWavSamples(data []byte, maxDuration time.Duration) ([]int16, int, error) {
+	if len(data) < 12 {
+		return nil, 0, fmt.Errorf("WAV头部数据不足")
+	}
+
+	var (
+		channels      int
+		sampleRate    int
+		bitsPerSample int
+		audioFormat   uint16
+	)
+	offset := 12
+	for offset+8 <= len(data) {
+		chunkID := string(data[offset : offset+4])
+		chunkSize := int(binary.LittleEndian.Uint32(data[offset+4 : offset+8]))
+		body := offset + 8
+		end := body + chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		switch chunkID {
+		case "fmt ":
+			if end-body < 16 {
+				return nil, 0, fmt.Errorf("WAV fmt块数据不足")
+			}
+			audioFormat = binary.LittleEndian.Uint16(data[body:])
+			channels = int(binary.LittleEndian.Uint16(data[body+2:]))
+			sampleRate = int(binary.LittleEndian.Uint32(data[body+4:]))
+			bitsPerSample = int(binary.LittleEndian.Uint16(data[body+14:]))
+		case "data":
+			if channels == 0 {
+				return nil, 0, fmt.Errorf("WAV缺少fmt块")
+			}
+			// 1为PCM，0xFFFE为WAVE_FORMAT_EXTENSIBLE
+			if (audioFormat != 1 && audioFormat != 0xFFFE) || bitsPerSample != 16 {
+				return nil, 0, fmt.Errorf("仅支持16位PCM编码的WAV(format=%d, bits=%d)", audioFormat, bitsPerSample)
+			}
+			if err := checkSampleRate(sampleRate); err != nil {
+				return nil, 0, err
+			}
+			if err := checkAudioDuration((end-body)/2/channels, sampleRate, maxDuration); err != nil {
+				return nil, 0, err
+			}
+			return mixToMono(bytesToSamples(data[body:end]), channels), sampleRate, nil
+		}
+		// 块按偶数字节对齐
+		offset = body + chunkSize + chunkSize%2
+	}
+	return nil, 0, fmt.Errorf("WAV缺少data块")
+}
+
+// decodeMP3Samples 解码MP3（go-mp3输出16位立体声）并混合为单声道
+func decodeMP3Samples(data []byte, maxDuration time.Duration) ([]int16, int, error) {
+	decoder, err := mp3.NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, fmt.Errorf("创建MP3解码器失败: %v", err)
+	}
+	if err := checkSampleRate(decoder.SampleRate()); err != nil {
+		return nil, 0, err
+	}
+	if length := decoder.Length(); length > 0 {
+		if err := checkAudioDuration(int(length/4), decoder.SampleRate(), maxDuration); err != nil {
+			return nil, 0, err
+		}
+	}
+	var reader io.Reader = decoder
+	limit := int64(-1)
+	if maxDuration > 0 {
+		// 无法预知长度时按时长上限截断读取，超出即拒绝
+		limit = int64(maxDuration/time.Second+1) * int64(decoder.SampleRate()) * 4
+		reader = io.LimitReader(decoder, limit+1)
+	}
+	pcmBytes, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, 0, fmt.Errorf("解码MP3失败: %v", err)
+	}
+	if limit >= 0 && int64(len(pcmBytes)) > limit {
+		return nil, 0, fmt.Errorf("音频时长超过限制 %.0f 秒", maxDuration.Seconds())
+	}
+	return mixToMono(bytesToSamples(pcmBytes), 2), decoder.SampleRate(), nil
+}
+
+// bytesToSamples 16位小端字节转换为样本
+func bytesToSamples(data []byte) []int16 {
+	samples := make([]int16, len(data)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(data[i*2:]))
+	}
+	return samples
+}
+
+// samplesToBytes 样本转换为16位小端字节
+func samplesToBytes(samples []int16) []byte {
+	data := make([]byte, len(samples)*2)
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint16(data[i*2:], uint16(sample))
+	}
+	return data
+}
+
+// mixToMono 交错多声道样本取平均混合为单声道
+func mixToMono(samples []int16, channels int) []int16 {
+	if channels <= 1 {
+		return samples
+	}
+	mono := make([]int16, len(samples)/channels)
+	for i := range mono {
+		var sum int32
+		for c := 0; c < channels; c++ {
+			sum += int32(samples[i*channels+c])
+		}
+		mono[i] = int16(sum / int32(channels))
+	}
+	return mono
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// buildWav 构造16位单声道PCM WAV
+func buildWav(sampleRate int, samples int) []byte {
+	data := make([]byte, 44+samples*2)
+	copy(data[0:], "RIFF")
+	binary.LittleEndian.PutUint32(data[4:], uint32(36+samples*2))
+	copy(data[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(data[16:], 16)
+	binary.LittleEndian.PutUint16(data[20:], 1)
+	binary.LittleEndian.PutUint16(data[22:], 1)
+	binary.LittleEndian.PutUint32(data[24:], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(data[28:], uint32(sampleRate*2))
+	binary.LittleEndian.PutUint16(data[32:], 2)
+	binary.LittleEndian.PutUint16(data[34:], 16)
+	copy(data[36:], "data")
+	binary.LittleEndian.PutUint32(data[40:], uint32(samples*2))
+	return data
+}
+
+func TestDecodeAudioToPCMRejectsInvalidSampleRate(t *testing.T) {
+	if _, _, err := DecodeAudioToPCM(buildWav(1, 2048), "wav", 16000, time.Minute); err == nil {
+		t.Fatal("声明1Hz采样率的WAV应被拒绝")
+	}
+	if _, _, err := DecodeAudioToPCM(buildWav(400000, 2048), "wav", 16000, time.Minute); err == nil {
+		t.Fatal("超出上限的采样率应被拒绝")
+	}
+}
+
+func TestDecodeAudioToPCMRejectsTooLong(t *testing.T) {
+	if _, _, err := DecodeAudioToPCM(buildWav(8000, 8000*3), "wav", 16000, 2*time.Second); err == nil {
+		t.Fatal("超过时长上限的音频应被拒绝")
+	}
+	if _, _, err := DecodeAudioToPCM(make([]byte, 16000*2*3), "pcm", 16000, 2*time.Second); err == nil {
+		t.Fatal("超过时长上限的PCM应被拒绝")
+	}
+}
+
+func TestDecodeAudioToPCMResamples(t *testing.T) {
+	pcm, duration, err := DecodeAudioToPCM(buildWav(8000, 8000), "wav", 16000, time.Minute)
+	if err != nil {
+		t.Fatalf("解码失败: %v", err)
+	}
+	if len(pcm) != 16000*2 {
+		t.Fatalf("重采样后长度为 %d 字节，期望 %d", len(pcm), 16000*2)
+	}
+	if duration != 1 {
+		t.Fatalf("时长为 %v，期望1秒", duration)
+	}
+}
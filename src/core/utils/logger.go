@@ -33,10 +33,11 @@ type Logger struct {
 	jsonLogger  *slog.Logger // 文件JSON输出
 	textLogger  *slog.Logger // 控制台文本输出
 	logFile     *os.File
-	currentDate string        // 当前日期 YYYY-MM-DD
-	mu          sync.RWMutex  // 读写锁保护
-	ticker      *time.Ticker  // 定时器
-	stopCh      chan struct{} // 停止信号
+	currentDate string         // 当前日期 YYYY-MM-DD
+	mu          sync.RWMutex   // 读写锁保护
+	ticker      *time.Ticker   // 定时器
+	stopCh      chan struct{}  // 停止信号
+	subscribers logSubscribers // 日志订阅者，用于按设备/会话实时推送日志
 }
 
 // configLogLevelToSlogLevel 将配置中的日志级别转换为slog.Level
@@ -248,9 +249,11 @@ func (l *Logger) log(level slog.Level, msg string, fields ...interface{}) {
 
 	// 构建slog属性
 	var attrs []slog.Attr
+	var fieldsMap map[string]interface{}
 	if len(fields) > 0 && fields[0] != nil {
 		// 处理fields参数
-		if fieldsMap, ok := fields[0].(map[string]interface{}); ok {
+		if m, ok := fields[0].(map[string]interface{}); ok {
+			fieldsMap = m
 			for k, v := range fieldsMap {
 				attrs = append(attrs, slog.Any(k, v))
 			}
@@ -264,6 +267,7 @@ func (l *Logger) log(level slog.Level, msg string, fields ...interface{}) {
 	ctx := context.Background()
 	l.jsonLogger.LogAttrs(ctx, level, msg, attrs...)
 	l.textLogger.LogAttrs(ctx, level, msg, attrs...)
+	l.publish(level, msg, fieldsMap)
 }
 
 // Debug 记录调试级别日志
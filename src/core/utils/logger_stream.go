@@ -0,0 +1,164 @@
+package utils
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+* 日志订阅：远程排查设备问题时，管理员接口按设备/会话实时推送相关日志。
+* 日志的设备、会话和链路追踪标识取自结构化字段（device/session/trace）
+* 或消息中的请求标识前缀（见 RequestTag），没有标识的日志不会推送给按设备或会话过滤的订阅者。
+* 订阅者的缓冲区满时丢弃新日志并计数，不阻塞日志写入。
+ */
+
+// LogEntry 推送给订阅者的一条日志
+type LogEntry struct {
+	Time      time.Time `json:"time"`
+	Level     string    `json:"level"`
+	Message   string    `json:"message"`
+	DeviceID  string    `json:"device_id,omitempty"`
+	SessionID string    `json:"session_id,omitempty"`
+	TraceID   string    `json:"trace_id,omitempty"`
+}
+
+// LogFilter 日志订阅的过滤条件，设备和会话需完全匹配
+type LogFilter struct {
+	DeviceID  string     // 只推送该设备的日志，为空表示不限制
+	SessionID string     // 只推送该会话的日志，为空表示不限制
+	MinLevel  slog.Level // 最低日志级别
+}
+
+// match 日志是否满足过滤条件
+func (f LogFilter) match(level slog.Level, entry LogEntry) bool {
+	if level < f.MinLevel {
+		return false
+	}
+	if f.DeviceID != "" && entry.DeviceID != f.DeviceID {
+		return false
+	}
+	if f.SessionID != "" && entry.SessionID != f.SessionID {
+		return false
+	}
+	return true
+}
+
+// LogSubscription 一个日志订阅
+type LogSubscription struct {
+	C       chan LogEntry
+	filter  LogFilter
+	dropped atomic.Int64
+}
+
+// Dropped 因缓冲区满而丢弃的日志条数
+func (s *LogSubscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// logSubscribers 日志订阅者集合
+type logSubscribers struct {
+	mu    sync.RWMutex
+	subs  map[*LogSubscription]struct{}
+	count atomic.Int32
+}
+
+// Subscribe 订阅满足过滤条件的日志，使用完毕后需调用 Unsubscribe
+func (l *Logger) Subscribe(filter LogFilter, buffer int) *LogSubscription {
+	sub := &LogSubscription{C: make(chan LogEntry, max(buffer, 1)), filter: filter}
+	l.subscribers.mu.Lock()
+	if l.subscribers.subs == nil {
+		l.subscribers.subs = make(map[*LogSubscription]struct{})
+	}
+	l.subscribers.subs[sub] = struct{}{}
+	l.subscribers.count.Store(int32(len(l.subscribers.subs)))
+	l.subscribers.mu.Unlock()
+	return sub
+}
+
+// Unsubscribe 取消日志订阅
+func (l *Logger) Unsubscribe(sub *LogSubscription) {
+	l.subscribers.mu.Lock()
+	delete(l.subscribers.subs, sub)
+	l.subscribers.count.Store(int32(len(l.subscribers.subs)))
+	l.subscribers.mu.Unlock()
+}
+
+// LogSubscriberCount 当前日志订阅数
+func (l *Logger) LogSubscriberCount() int {
+	return int(l.subscribers.count.Load())
+}
+
+// publish 将日志推送给满足条件的订阅者，没有订阅者时直接返回
+func (l *Logger) publish(level slog.Level, msg string, fields map[string]interface{}) {
+	if l.subscribers.count.Load() == 0 {
+		return
+	}
+	entry := LogEntry{
+		Time:    time.Now(),
+		Level:   strings.ToLower(level.String()),
+		Message: msg,
+	}
+	entry.DeviceID, entry.SessionID, entry.TraceID = logTags(msg, fields)
+
+	l.subscribers.mu.RLock()
+	defer l.subscribers.mu.RUnlock()
+	for sub := range l.subscribers.subs {
+		if !sub.filter.match(level, entry) {
+			continue
+		}
+		select {
+		case sub.C <- entry:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// requestTagPattern 消息中的请求标识前缀，如 [session=... device=... trace=...]
+var requestTagPattern = regexp.MustCompile(`\[((?:session|device|trace)=[^\s\]]+(?: (?:session|device|trace)=[^\s\]]+)*)\]`)
+
+// logTags 从结构化字段或消息中的请求标识提取设备、会话和链路追踪ID，结构化字段优先
+func logTags(msg string, fields map[string]interface{}) (device, session, trace string) {
+	if match := requestTagPattern.FindStringSubmatch(msg); match != nil {
+		for _, part := range strings.Fields(match[1]) {
+			key, value, _ := strings.Cut(part, "=")
+			switch key {
+			case "session":
+				session = value
+			case "device":
+				device = value
+			case "trace":
+				trace = value
+			}
+		}
+	}
+	if value, ok := fields["device"].(string); ok && value != "" {
+		device = value
+	}
+	if value, ok := fields["session"].(string); ok && value != "" {
+		session = value
+	}
+	if value, ok := fields["trace"].(string); ok && value != "" {
+		trace = value
+	}
+	return device, session, trace
+}
+
+// ParseLogLevel 解析日志级别名称（debug/info/warn/error，不区分大小写）
+func ParseLogLevel(name string) (slog.Level, bool) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return slog.LevelDebug, true
+	case "", "info":
+		return slog.LevelInfo, true
+	case "warn", "warning":
+		return slog.LevelWarn, true
+	case "error":
+		return slog.LevelError, true
+	}
+	return slog.LevelInfo, false
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+/*
+* 请求标识：把会话ID、设备ID和链路追踪ID放入 context.Context 传给各提供者，
+* 提供者在日志和错误信息中附带这些标识，便于把上游服务的失败定位到具体的设备和对话轮次。
+ */
+
+// RequestInfo 随context传递的请求标识
+type RequestInfo struct {
+	SessionID string // 会话ID
+	DeviceID  string // 设备ID
+	TraceID   string // 链路追踪ID（每轮对话或每个HTTP请求一个）
+}
+
+type requestInfoKey struct{}
+
+// WithRequestInfo 返回携带请求标识的context，未填写的字段沿用父context中的值
+func WithRequestInfo(ctx context.Context, info RequestInfo) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if parent, ok := RequestInfoFrom(ctx); ok {
+		if info.SessionID == "" {
+			info.SessionID = parent.SessionID
+		}
+		if info.DeviceID == "" {
+			info.DeviceID = parent.DeviceID
+		}
+		if info.TraceID == "" {
+			info.TraceID = parent.TraceID
+		}
+	}
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// RequestInfoFrom 从context中取出请求标识
+func RequestInfoFrom(ctx context.Context) (RequestInfo, bool) {
+	if ctx == nil {
+		return RequestInfo{}, false
+	}
+	info, ok := ctx.Value(requestInfoKey{}).(RequestInfo)
+	return info, ok
+}
+
+// NewTraceID 生成链路追踪ID（16位十六进制）
+func NewTraceID() string {
+	id, err := GenerateRandomString(8)
+	if err != nil {
+		return ""
+	}
+	return id
+}
+
+// String 格式化为 session=... device=... trace=...，省略空字段
+func (i RequestInfo) String() string {
+	parts := make([]string, 0, 3)
+	if i.SessionID != "" {
+		parts = append(parts, "session="+i.SessionID)
+	}
+	if i.DeviceID != "" {
+		parts = append(parts, "device="+i.DeviceID)
+	}
+	if i.TraceID != "" {
+		parts = append(parts, "trace="+i.TraceID)
+	}
+	return strings.Join(parts, " ")
+}
+
+// RequestTag 日志/错误前缀，如 "[session=... device=... trace=...] "，context中没有标识时返回空字符串
+func RequestTag(ctx context.Context) string {
+	info, ok := RequestInfoFrom(ctx)
+	if !ok {
+		return ""
+	}
+	if s := info.String(); s != "" {
+		return "[" + s + "] "
+	}
+	return ""
+}
+
+// RequestErrorf 创建带请求标识前缀的错误
+func RequestErrorf(ctx context.Context, format string, args ...interface{}) error {
+	return fmt.Errorf(RequestTag(ctx)+format, args...)
+}
@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"encoding/binary"
+	"math"
+	"strings"
+)
+
+// 重采样质量：fast 线性插值；medium、high 为加窗sinc插值，零点数越多过渡带越窄，计算量越大
+const (
+	ResampleQualityFast   = "fast"
+	ResampleQualityMedium = "medium"
+	ResampleQualityHigh   = "high"
+)
+
+// resampleZeroCrossings 各质量等级sinc核单侧的零点数
+var resampleZeroCrossings = map[string]int{
+	ResampleQualityMedium: 8,
+	ResampleQualityHigh:   32,
+}
+
+// resampleTableResolution sinc核查找表每个输入采样间隔的取样数
+const resampleTableResolution = 64
+
+// Resampler 流式重采样器，输入输出均为16位小端单声道PCM。
+// 分块输入时保留块尾的历史采样，块与块之间连续无断点；非并发安全
+type Resampler struct {
+	fromRate  int
+	toRate    int
+	step      float64   // 每个输出采样前进的输入采样数
+	halfWidth int       // 插值核单侧覆盖的输入采样数
+	table     []float64 // 插值核查找表，按 |x|*resampleTableResolution 取值
+	history   []float64 // 尚未处理完的输入采样（含左侧上下文）
+	pos       float64   // 下一个输出采样在 history 中的位置
+}
+
+// NewResampler 创建从 fromRate 到 toRate 的重采样器，quality 为 fast/medium/high，未知值按 medium 处理
+func NewResampler(fromRate, toRate int, quality string) *Resampler {
+	r := &Resampler{fromRate: fromRate, toRate: toRate}
+	if fromRate <= 0 || toRate <= 0 || fromRate == toRate {
+		return r
+	}
+	r.step = float64(fromRate) / float64(toRate)
+
+	quality = strings.ToLower(quality)
+	if quality == ResampleQualityFast {
+		// 线性插值：三角形核
+		r.halfWidth = 1
+		r.table = make([]float64, resampleTableResolution+2)
+		for i := range r.table {
+			r.table[i] = math.Max(0, 1-float64(i)/resampleTableResolution)
+		}
+	} else {
+		zeroCrossings, ok := resampleZeroCrossings[quality]
+		if !ok {
+			zeroCrossings = resampleZeroCrossings[ResampleQualityMedium]
+		}
+		// 降采样时截止频率降到目标采样率的奈奎斯特频率，防止混叠
+		cutoff := math.Min(1, float64(toRate)/float64(fromRate))
+		width := float64(zeroCrossings) / cutoff
+		r.halfWidth = int(math.Ceil(width))
+		r.table = make([]float64, r.halfWidth*resampleTableResolution+2)
+		for i := range r.table {
+			r.table[i] = windowedSinc(float64(i)/resampleTableResolution, cutoff, width)
+		}
+	}
+	r.history = make([]float64, r.halfWidth)
+	r.pos = float64(r.halfWidth)
+	return r
+}
+
+// windowedSinc Blackman窗sinc核
+func windowedSinc(x, cutoff, width float64) float64 {
+	if x >= width {
+		return 0
+	}
+	window := 0.42 + 0.5*math.Cos(math.Pi*x/width) + 0.08*math.Cos(2*math.Pi*x/width)
+	if x == 0 {
+		return cutoff
+	}
+	arg := math.Pi * cutoff * x
+	return cutoff * math.Sin(arg) / arg * window
+}
+
+// Passthrough 采样率相同，不做处理
+func (r *Resampler) Passthrough() bool {
+	return r == nil || r.step == 0
+}
+
+// Process 重采样一块PCM，返回已能确定的输出；插值核右侧尚未到达的部分留到下一块输出
+func (r *Resampler) Process(pcm []byte) []byte {
+	if r.Passthrough() {
+		return pcm
+	}
+	for i := 0; i+1 < len(pcm); i += 2 {
+		r.history = append(r.history, float64(int16(binary.LittleEndian.Uint16(pcm[i:]))))
+	}
+
+	out := make([]byte, 0, int(float64(len(pcm))/r.step)+4)
+	for {
+		center := int(r.pos)
+		if center+r.halfWidth >= len(r.history) {
+			break
+		}
+		sample := int16(math.Max(math.MinInt16, math.Min(math.MaxInt16, math.Round(r.interpolate(center)))))
+		out = binary.LittleEndian.AppendUint16(out, uint16(sample))
+		r.pos += r.step
+	}
+
+	// 只保留后续插值还需要的历史采样
+	if drop := int(r.pos) - r.halfWidth; drop > 0 {
+		drop = min(drop, len(r.history))
+		r.history = append(r.history[:0], r.history[drop:]...)
+		r.pos -= float64(drop)
+	}
+	return out
+}
+
+// Flush 在末尾补零输出剩余的采样，用于整段音频的最后一块；之后不应再调用 Process
+func (r *Resampler) Flush() []byte {
+	if r.Passthrough() {
+		return nil
+	}
+	return r.Process(make([]byte, (r.halfWidth+1)*2*2))
+}
+
+// interpolate 计算 r.pos 处的插值，权重归一化保证直流增益为1
+func (r *Resampler) interpolate(center int) float64 {
+	var sum, weights float64
+	for j := center - r.halfWidth + 1; j <= center+r.halfWidth; j++ {
+		if j < 0 {
+			continue
+		}
+		weight := r.kernel(math.Abs(r.pos - float64(j)))
+		sum += weight * r.history[j]
+		weights += weight
+	}
+	if weights == 0 {
+		return 0
+	}
+	return sum / weights
+}
+
+// kernel 查表取插值核的值，表项之间线性插值
+func (r *Resampler) kernel(x float64) float64 {
+	position := x * resampleTableResolution
+	index := int(position)
+	if index+1 >= len(r.table) {
+		return 0
+	}
+	frac := position - float64(index)
+	return r.table[index]*(1-frac) + r.table[index+1]*frac
+}
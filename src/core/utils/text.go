@@ -5,6 +5,7 @@ import (
 	"math/rand"
 	"regexp"
 	"strings"
+	"unicode"
 )
 
 var (
@@ -124,3 +125,17 @@ func GenerateSecurePassword(length int) string {
 	}
 	return string(password)
 }
+
+// EstimateTokens 粗略估算文本的token数：中日韩字符每字按1个token，其余字符每4个按1个token
+func EstimateTokens(text string) int {
+	cjk, other := 0, 0
+	for _, r := range text {
+		if unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+			unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r) {
+			cjk++
+		} else if !unicode.IsSpace(r) {
+			other++
+		}
+	}
+	return cjk + (other+3)/4
+}
@@ -20,6 +20,7 @@ type websocketConn struct {
 	writeMu    sync.Mutex // 写操作互斥锁
 	closed     int32      // 原子操作标记连接状态 (0=open, 1=closed)
 	lastActive int64      // 最后活跃时间戳（原子操作）
+	buffer     *writeBuffer // 下行写缓冲，为nil时直接同步写
 }
 
 func (w *websocketConn) ReadMessage() (messageType int, p []byte, err error) {
@@ -63,6 +64,15 @@ func (w *websocketConn) WriteMessage(messageType int, data []byte) error {
 		return ErrConnectionClosed
 	}
 
+	// 有写缓冲时交给写协程发送
+	if w.buffer != nil {
+		return w.enqueue(messageType, data)
+	}
+	return w.writeFrame(messageType, data)
+}
+
+// writeFrame 同步写入一帧
+func (w *websocketConn) writeFrame(messageType int, data []byte) error {
 	// 使用写锁确保写操作的串行化
 	w.writeMu.Lock()
 	defer w.writeMu.Unlock()
@@ -89,6 +99,15 @@ func (w *websocketConn) WriteMessage(messageType int, data []byte) error {
 }
 
 func (w *websocketConn) Close() error {
+	// 先发送写缓冲中剩余的帧；连接已因读写错误关闭时只需停止写协程
+	if w.buffer != nil {
+		if atomic.LoadInt32(&w.closed) == 1 {
+			w.buffer.stop()
+		} else {
+			w.stopWriter()
+		}
+	}
+
 	// 使用原子操作避免重复关闭
 	if !atomic.CompareAndSwapInt32(&w.closed, 0, 1) {
 		return nil // 已经关闭过了
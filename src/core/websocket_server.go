@@ -2,10 +2,11 @@ package core
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"sync"
-	"time"
+	"sync/atomic"
 
 	"ai-server-go/src/configs"
 	"ai-server-go/src/core/pool"
@@ -23,8 +24,22 @@ type WebSocketServer struct {
 	upgrader          Upgrader
 	logger            *utils.Logger
 	taskMgr           *task.TaskManager
-	poolManager       *pool.PoolManager // 替换providers
-	activeConnections sync.Map          // 存储 clientID -> *ConnectionContext
+	poolManager       *pool.PoolManager       // 替换providers
+	configService     *database.ConfigService // 读取维护模式等系统配置
+	activeConnections sync.Map                // 存储 clientID -> *ConnectionContext
+	handlers          sync.WaitGroup          // 尚未退出的连接处理协程
+	activeSessions    int64                   // 当前会话数（原子操作）
+	rejectedSessions  int64                   // 因达到上限被拒绝的连接数（原子操作）
+}
+
+// SessionStats 会话容量统计
+type SessionStats struct {
+	Active   int64 `json:"active"`   // 当前会话数
+	Max      int   `json:"max"`      // 最大并发会话数，0表示不限制
+	Rejected int64 `json:"rejected"` // 因达到上限被拒绝的连接数
+
+	DroppedFrames           int64 `json:"dropped_frames"`            // 因设备消费过慢丢弃的低优先级帧数
+	SlowConsumerDisconnects int64 `json:"slow_consumer_disconnects"` // 因设备消费过慢断开的连接数
 }
 
 // Upgrader WebSocket升级器接口
@@ -35,9 +50,10 @@ type Upgrader interface {
 // NewWebSocketServer 创建新的WebSocket服务器
 func NewWebSocketServer(config *configs.Config, logger *utils.Logger, configService *database.ConfigService) (*WebSocketServer, error) {
 	ws := &WebSocketServer{
-		config:   config,
-		logger:   logger,
-		upgrader: NewDefaultUpgrader(),
+		config:        config,
+		logger:        logger,
+		configService: configService,
+		upgrader:      NewDefaultUpgrader(config.Server.WriteBuffer, logger),
 		taskMgr: func() *task.TaskManager {
 			tm := task.NewTaskManager(task.ResourceConfig{
 				MaxWorkers:        12,
@@ -102,17 +118,21 @@ func (ws *WebSocketServer) Start(ctx context.Context) error {
 
 // defaultUpgrader 默认的WebSocket升级器实现
 type defaultUpgrader struct {
-	wsUpgrader *websocket.Upgrader
+	wsUpgrader  *websocket.Upgrader
+	writeBuffer configs.WriteBufferConfig
+	logger      *utils.Logger
 }
 
-// NewDefaultUpgrader 创建默认的WebSocket升级器
-func NewDefaultUpgrader() *defaultUpgrader {
+// NewDefaultUpgrader 创建默认的WebSocket升级器，升级后的连接带下行写缓冲
+func NewDefaultUpgrader(writeBuffer configs.WriteBufferConfig, logger *utils.Logger) *defaultUpgrader {
 	return &defaultUpgrader{
 		wsUpgrader: &websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
 				return true // 允许所有来源的连接
 			},
 		},
+		writeBuffer: writeBuffer,
+		logger:      logger,
 	}
 }
 
@@ -123,41 +143,37 @@ func (u *defaultUpgrader) Upgrade(w http.ResponseWriter, r *http.Request) (Conne
 		return nil, err
 	}
 
-	now := time.Now().Unix()
-	wsConn := &websocketConn{
-		conn:       conn,
-		closed:     0,
-		lastActive: now,
-	}
-
-	return wsConn, nil
+	return newBufferedWebsocketConn(conn, u.writeBuffer, extractDeviceID(r), extractClientID(r), u.logger), nil
 }
 
 // Stop 停止WebSocket服务器
 func (ws *WebSocketServer) Stop() error {
-	if ws.server != nil {
-		ws.logger.Info("正在关闭WebSocket服务器...")
-
-		// 关闭所有活动连接并归还资源
-		ws.activeConnections.Range(func(key, value interface{}) bool {
-			if ctx, ok := value.(*ConnectionContext); ok {
-				if err := ctx.Close(); err != nil {
-					ws.logger.Error(fmt.Sprintf("关闭连接上下文失败: %v", err))
-				}
-			} else if conn, ok := value.(Connection); ok {
-				// 向后兼容：直接关闭连接（如果存储的是旧格式）
-				conn.Close()
-			}
-			ws.activeConnections.Delete(key)
-			return true
-		})
+	ws.logger.Info("正在关闭WebSocket服务器...")
 
-		// 关闭资源池
-		if ws.poolManager != nil {
-			ws.poolManager.Close()
+	// 关闭所有活动连接并归还资源
+	ws.activeConnections.Range(func(key, value interface{}) bool {
+		if ctx, ok := value.(*ConnectionContext); ok {
+			if err := ctx.Close(); err != nil {
+				ws.logger.Error(fmt.Sprintf("关闭连接上下文失败: %v", err))
+			}
+		} else if conn, ok := value.(Connection); ok {
+			// 向后兼容：直接关闭连接（如果存储的是旧格式）
+			conn.Close()
 		}
+		ws.activeConnections.Delete(key)
+		return true
+	})
+
+	// 等待连接处理协程及其消息处理协程退出，避免关闭资源池时仍在使用
+	ws.handlers.Wait()
 
-		// 关闭服务器
+	// 关闭资源池
+	if ws.poolManager != nil {
+		ws.poolManager.Close()
+	}
+
+	// 关闭服务器（通过ServeHTTP挂载到外部HTTP服务时由调用方关闭）
+	if ws.server != nil {
 		if err := ws.server.Close(); err != nil {
 			return fmt.Errorf("服务器关闭失败: %v", err)
 		}
@@ -165,6 +181,11 @@ func (ws *WebSocketServer) Stop() error {
 	return nil
 }
 
+// ServeHTTP 实现http.Handler，便于挂载到其他HTTP服务（如测试中的httptest.Server）
+func (ws *WebSocketServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ws.handleWebSocket(w, r)
+}
+
 // handleWebSocket 处理WebSocket连接
 func (ws *WebSocketServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	conn, err := ws.upgrader.Upgrade(w, r)
@@ -175,10 +196,39 @@ func (ws *WebSocketServer) handleWebSocket(w http.ResponseWriter, r *http.Reques
 
 	clientID := fmt.Sprintf("%p", conn)
 
-	// 从资源池获取提供者集合
-	providerSet, err := ws.poolManager.GetProviderSet()
+	// 维护模式下拒绝新连接，已建立的连接不受影响
+	if ws.configService != nil {
+		if status := ws.configService.GetMaintenanceStatus(); status.Enabled {
+			ws.logger.Info(fmt.Sprintf("系统维护中，拒绝客户端 %s 的新连接", clientID))
+			if err := writeMaintenanceNotice(conn, "", status.Message); err != nil {
+				ws.logger.Error(fmt.Sprintf("发送维护提示失败: %v", err))
+			}
+			conn.Close()
+			return
+		}
+	}
+
+	// 达到最大并发会话数时拒绝新连接，设备收到 1013 (Try Again Later) 后可稍后重连或切换实例
+	if !ws.acquireSession() {
+		atomic.AddInt64(&ws.rejectedSessions, 1)
+		ws.logger.Warn("会话数已达上限 %d，拒绝客户端 %s 的新连接", ws.config.Server.MaxSessions, clientID)
+		closeMsg := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "server full")
+		if err := conn.WriteMessage(websocket.CloseMessage, closeMsg); err != nil {
+			ws.logger.Error(fmt.Sprintf("发送关闭帧失败: %v", err))
+		}
+		conn.Close()
+		return
+	}
+
+	// 从资源池获取提供者集合，设备所有者配置了自带凭证时使用其专属实例
+	var tenantID *uint
+	if ws.configService != nil {
+		tenantID = ws.configService.DeviceOwnerID(parseUint(extractDeviceID(r)))
+	}
+	providerSet, err := ws.poolManager.GetProviderSetForTenant(tenantID)
 	if err != nil {
 		ws.logger.Error(fmt.Sprintf("获取提供者集合失败: %v", err))
+		ws.releaseSession()
 		conn.Close()
 		return
 	}
@@ -199,10 +249,17 @@ func (ws *WebSocketServer) handleWebSocket(w http.ResponseWriter, r *http.Reques
 	ws.logger.Info(fmt.Sprintf("客户端 %s 连接已建立，资源已分配", clientID))
 
 	// 启动连接处理，并在结束时清理资源
+	ws.handlers.Add(1)
 	go func() {
+		defer func() {
+			// 上下文取消后等待消息处理协程退出
+			handler.WaitCoroutines()
+			ws.handlers.Done()
+		}()
 		defer func() {
 			// 连接结束时清理
 			ws.activeConnections.Delete(clientID)
+			ws.releaseSession()
 			// 注意：不要在这里调用connContext.Close()，因为handler.Handle()的defer会处理资源清理
 			// 只需要取消上下文即可
 			connCancel()
@@ -212,6 +269,58 @@ func (ws *WebSocketServer) handleWebSocket(w http.ResponseWriter, r *http.Reques
 	}()
 }
 
+// acquireSession 占用一个会话名额，达到上限时返回false
+func (ws *WebSocketServer) acquireSession() bool {
+	limit := int64(ws.config.Server.MaxSessions)
+	for {
+		current := atomic.LoadInt64(&ws.activeSessions)
+		if limit > 0 && current >= limit {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&ws.activeSessions, current, current+1) {
+			return true
+		}
+	}
+}
+
+// releaseSession 释放会话名额
+func (ws *WebSocketServer) releaseSession() {
+	atomic.AddInt64(&ws.activeSessions, -1)
+}
+
+// GetSessionStats 获取会话容量统计（用于 /metrics 和 /health/ready）
+func (ws *WebSocketServer) GetSessionStats() SessionStats {
+	return SessionStats{
+		Active:   atomic.LoadInt64(&ws.activeSessions),
+		Max:      ws.config.Server.MaxSessions,
+		Rejected: atomic.LoadInt64(&ws.rejectedSessions),
+
+		DroppedFrames:           atomic.LoadInt64(&droppedFrames),
+		SlowConsumerDisconnects: atomic.LoadInt64(&slowConsumerDisconnects),
+	}
+}
+
+// IsSaturated 是否已达到最大并发会话数
+func (ws *WebSocketServer) IsSaturated() bool {
+	stats := ws.GetSessionStats()
+	return stats.Max > 0 && stats.Active >= int64(stats.Max)
+}
+
+// writeMaintenanceNotice 向客户端发送维护模式提示
+func writeMaintenanceNotice(conn Connection, sessionID string, message string) error {
+	notice := map[string]interface{}{
+		"type":       "maintenance",
+		"state":      "enabled",
+		"session_id": sessionID,
+		"message":    message,
+	}
+	data, err := json.Marshal(notice)
+	if err != nil {
+		return fmt.Errorf("序列化维护提示失败: %v", err)
+	}
+	return conn.WriteMessage(1, data)
+}
+
 // GetPoolStats 获取资源池统计信息（用于监控）
 func (ws *WebSocketServer) GetPoolStats() map[string]map[string]int {
 	if ws.poolManager == nil {
@@ -229,3 +338,44 @@ func (ws *WebSocketServer) GetActiveConnectionsCount() int {
 	})
 	return count
 }
+
+// findSession 查找本实例上会话ID对应的连接处理器
+func (ws *WebSocketServer) findSession(sessionID string) *ConnectionHandler {
+	var handler *ConnectionHandler
+	ws.activeConnections.Range(func(key, value interface{}) bool {
+		if connCtx, ok := value.(*ConnectionContext); ok && connCtx.handler != nil && connCtx.handler.sessionID == sessionID {
+			handler = connCtx.handler
+			return false
+		}
+		return true
+	})
+	return handler
+}
+
+// SetSessionProviderOverride 为活跃会话设置会话级provider覆盖
+func (ws *WebSocketServer) SetSessionProviderOverride(sessionID, category, name string) error {
+	handler := ws.findSession(sessionID)
+	if handler == nil {
+		return ErrSessionNotFound
+	}
+	return handler.SetProviderOverride(category, name)
+}
+
+// ClearSessionProviderOverride 清除活跃会话的provider覆盖，category为空时清除全部
+func (ws *WebSocketServer) ClearSessionProviderOverride(sessionID, category string) error {
+	handler := ws.findSession(sessionID)
+	if handler == nil {
+		return ErrSessionNotFound
+	}
+	handler.ClearProviderOverride(category)
+	return nil
+}
+
+// GetSessionProviderOverrides 获取活跃会话当前的provider覆盖
+func (ws *WebSocketServer) GetSessionProviderOverrides(sessionID string) (map[string]string, error) {
+	handler := ws.findSession(sessionID)
+	if handler == nil {
+		return nil, ErrSessionNotFound
+	}
+	return handler.ProviderOverrides(), nil
+}
@@ -0,0 +1,248 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ai-server-go/src/configs"
+	"ai-server-go/src/core/utils"
+
+	"github.com/gorilla/websocket"
+)
+
+/*
+* 下行写缓冲：每个连接由一个写协程负责网络写，WriteMessage 只把帧放入有界队列，不会因设备网络慢而长时间阻塞。
+* 积压达到 high_watermark 后丢弃低优先级文本帧（如流式文本的增量，仅用于显示）；音频和其他消息不丢弃。
+* 队列已满时最多等待 stall_timeout，仍放不进去则以关闭码 1008 (slow consumer) 断开连接，让对话尽快结束而不是卡住。
+* 慢消费事件按设备记录日志；丢帧数和断开次数汇总到 /metrics。
+ */
+
+const (
+	defaultWriteBufferSize   = 256
+	defaultWriteStallTimeout = 10 * time.Second
+	// writeBufferDrainTimeout 正常关闭时发送剩余缓冲帧的最长时间
+	writeBufferDrainTimeout = 5 * time.Second
+	slowConsumerCloseReason = "slow consumer"
+)
+
+// ErrSlowConsumer 设备消费过慢，连接已断开
+var ErrSlowConsumer = errors.New("websocket slow consumer, connection closed")
+
+// defaultLowPriorityFrames 默认的低优先级消息
+var defaultLowPriorityFrames = []string{"llm_stream:delta", "tts:sentence_start"}
+
+var (
+	droppedFrames           int64 // 因积压丢弃的低优先级帧数（原子操作）
+	slowConsumerDisconnects int64 // 因消费过慢断开的连接数（原子操作）
+)
+
+// writeBufferSettings 生效的写缓冲参数
+type writeBufferSettings struct {
+	size          int
+	highWatermark int
+	stallTimeout  time.Duration
+	lowPriority   map[string]bool
+}
+
+// newWriteBufferSettings 补全写缓冲配置的默认值
+func newWriteBufferSettings(config configs.WriteBufferConfig) writeBufferSettings {
+	settings := writeBufferSettings{
+		size:          config.Size,
+		highWatermark: config.HighWatermark,
+		stallTimeout:  time.Duration(config.StallTimeout) * time.Second,
+		lowPriority:   make(map[string]bool),
+	}
+	if settings.size <= 0 {
+		settings.size = defaultWriteBufferSize
+	}
+	if settings.highWatermark <= 0 || settings.highWatermark > settings.size {
+		settings.highWatermark = settings.size * 3 / 4
+	}
+	if settings.stallTimeout <= 0 {
+		settings.stallTimeout = defaultWriteStallTimeout
+	}
+	lowPriority := config.LowPriority
+	if lowPriority == nil {
+		lowPriority = defaultLowPriorityFrames
+	}
+	for _, name := range lowPriority {
+		settings.lowPriority[name] = true
+	}
+	return settings
+}
+
+// isLowPriority 文本帧的 type 或 type:state 在低优先级列表中
+func (s writeBufferSettings) isLowPriority(messageType int, data []byte) bool {
+	if messageType != websocket.TextMessage || len(s.lowPriority) == 0 {
+		return false
+	}
+	var header struct {
+		Type  string `json:"type"`
+		State string `json:"state"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return false
+	}
+	return s.lowPriority[header.Type] || s.lowPriority[header.Type+":"+header.State]
+}
+
+// outboundFrame 待发送的帧
+type outboundFrame struct {
+	messageType int
+	data        []byte
+}
+
+// writeBuffer 连接的下行写缓冲
+type writeBuffer struct {
+	settings writeBufferSettings
+	queue    chan outboundFrame
+	quit     chan struct{} // 关闭时关闭，写协程发送剩余帧后退出
+	done     chan struct{} // 写协程已退出
+	stopOnce sync.Once
+	stopping int32 // 已开始关闭，不再接受新帧（原子操作）
+	dropping int32 // 当前是否处于丢帧状态，用于日志去重（原子操作）
+	dropped  int64 // 本连接丢弃的帧数（原子操作）
+	deviceID string
+	clientID string
+	logger   *utils.Logger
+}
+
+// newBufferedWebsocketConn 创建带写缓冲的连接并启动写协程
+func newBufferedWebsocketConn(conn *websocket.Conn, config configs.WriteBufferConfig, deviceID, clientID string, logger *utils.Logger) *websocketConn {
+	settings := newWriteBufferSettings(config)
+	w := &websocketConn{
+		conn:       conn,
+		lastActive: time.Now().Unix(),
+		buffer: &writeBuffer{
+			settings: settings,
+			queue:    make(chan outboundFrame, settings.size),
+			quit:     make(chan struct{}),
+			done:     make(chan struct{}),
+			deviceID: deviceID,
+			clientID: clientID,
+			logger:   logger,
+		},
+	}
+	go w.runWriter()
+	return w
+}
+
+// enqueue 放入写缓冲：积压过多时丢弃低优先级帧，缓冲已满且超时仍放不进去时断开连接
+func (w *websocketConn) enqueue(messageType int, data []byte) error {
+	b := w.buffer
+	if atomic.LoadInt32(&b.stopping) == 1 {
+		return ErrConnectionClosed
+	}
+	backlog := len(b.queue)
+	if backlog >= b.settings.highWatermark && b.settings.isLowPriority(messageType, data) {
+		atomic.AddInt64(&b.dropped, 1)
+		atomic.AddInt64(&droppedFrames, 1)
+		if atomic.CompareAndSwapInt32(&b.dropping, 0, 1) {
+			b.logger.Warn("设备 %s (client %s) 消费过慢，下行积压 %d 帧，开始丢弃低优先级消息",
+				b.deviceID, b.clientID, backlog)
+		}
+		return nil
+	}
+
+	frame := outboundFrame{messageType: messageType, data: data}
+	select {
+	case b.queue <- frame:
+		return nil
+	default:
+	}
+
+	b.logger.Warn("设备 %s (client %s) 下行缓冲已满（%d 帧），最多等待 %v",
+		b.deviceID, b.clientID, b.settings.size, b.settings.stallTimeout)
+	timer := time.NewTimer(b.settings.stallTimeout)
+	defer timer.Stop()
+	select {
+	case b.queue <- frame:
+		return nil
+	case <-b.done:
+		return ErrConnectionClosed
+	case <-timer.C:
+		w.closeSlowConsumer()
+		return ErrSlowConsumer
+	}
+}
+
+// runWriter 写协程：按顺序发送缓冲中的帧，关闭时先发送剩余帧
+func (w *websocketConn) runWriter() {
+	b := w.buffer
+	defer close(b.done)
+	for {
+		select {
+		case frame := <-b.queue:
+			if !w.writeBuffered(frame) {
+				return
+			}
+		case <-b.quit:
+			for {
+				select {
+				case frame := <-b.queue:
+					if !w.writeBuffered(frame) {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// writeBuffered 发送一帧，积压回落到高水位一半以下时结束丢帧状态；返回false表示连接已不可写
+func (w *websocketConn) writeBuffered(frame outboundFrame) bool {
+	b := w.buffer
+	if err := w.writeFrame(frame.messageType, frame.data); err != nil {
+		if atomic.LoadInt32(&b.stopping) == 0 {
+			b.logger.Warn("设备 %s (client %s) 下行写入失败: %v", b.deviceID, b.clientID, err)
+		}
+		return false
+	}
+	if atomic.LoadInt32(&b.dropping) == 1 && len(b.queue) < b.settings.highWatermark/2 &&
+		atomic.CompareAndSwapInt32(&b.dropping, 1, 0) {
+		b.logger.Info("设备 %s (client %s) 下行积压已恢复，累计丢弃低优先级消息 %d 条",
+			b.deviceID, b.clientID, atomic.LoadInt64(&b.dropped))
+	}
+	return true
+}
+
+// stop 停止接受新帧并通知写协程退出
+func (b *writeBuffer) stop() {
+	b.stopOnce.Do(func() {
+		atomic.StoreInt32(&b.stopping, 1)
+		close(b.quit)
+	})
+}
+
+// stopWriter 停止接受新帧，等待写协程发送剩余帧；超时则直接关闭底层连接
+func (w *websocketConn) stopWriter() {
+	b := w.buffer
+	b.stop()
+	select {
+	case <-b.done:
+	case <-time.After(writeBufferDrainTimeout):
+		b.logger.Warn("设备 %s (client %s) 关闭时剩余 %d 帧未能发送", b.deviceID, b.clientID, len(b.queue))
+		w.conn.Close()
+	}
+}
+
+// closeSlowConsumer 以 1008 (slow consumer) 断开消费过慢的连接。
+// 写协程可能正阻塞在网络写上，关闭帧用可并发调用的WriteControl发送
+func (w *websocketConn) closeSlowConsumer() {
+	if !atomic.CompareAndSwapInt32(&w.closed, 0, 1) {
+		return
+	}
+	b := w.buffer
+	atomic.AddInt64(&slowConsumerDisconnects, 1)
+	b.logger.Error("设备 %s (client %s) 消费过慢，下行缓冲 %d 帧已满超过 %v，断开连接（已丢弃低优先级消息 %d 条）",
+		b.deviceID, b.clientID, b.settings.size, b.settings.stallTimeout, atomic.LoadInt64(&b.dropped))
+	b.stop()
+	closeMsg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, slowConsumerCloseReason)
+	w.conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second))
+	w.conn.Close()
+}
@@ -0,0 +1,7 @@
+// Package wsharness 设备WebSocket协议的端到端测试：使用内存数据库和假的提供者（见 core/providers/fake）启动
+// core.WebSocketServer，由模拟设备校验握手（版本、音频格式协商、认证、能力声明）、语音和文本的完整对话，
+// 以及注入故障后的恢复。
+//
+// 握手流程变更时请同步更新这里的测试。测试同时覆盖连接处理的多个协程，需开启竞态检测运行：
+// go test -race ./src/core/wsharness/（或 make test）
+package wsharness
@@ -0,0 +1,317 @@
+package wsharness
+
+import (
+	"ai-server-go/src/configs"
+	"ai-server-go/src/core"
+	"ai-server-go/src/core/auth"
+	"ai-server-go/src/core/providers/fake"
+	"ai-server-go/src/core/utils"
+	"ai-server-go/src/database"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	harnessDeviceID   = "1"
+	harnessToken      = "harness-token"
+	harnessAuthKey    = "harness-key"
+	harnessAuthSecret = "harness-secret"
+	harnessReply      = fake.DefaultReply
+)
+
+// newHarnessServer 启动使用内存数据库和测试提供者的WebSocket服务，返回ws地址
+func newHarnessServer(t *testing.T, challenge string) string {
+	t.Helper()
+	fake.Reset()
+
+	config := &configs.Config{}
+	config.Log.LogDir = t.TempDir()
+	config.Log.LogFile = "harness.log"
+	config.Log.LogLevel = "ERROR"
+	config.Database.Type = "sqlite"
+	// 每个连接会单独打开数据库，使用共享缓存的命名内存库，名称唯一以隔离重复运行
+	config.Database.Name = fmt.Sprintf("file:%s_%d?mode=memory&cache=shared", t.Name(), time.Now().UnixNano())
+	config.Server.Auth.Enabled = true
+	config.Server.Auth.Challenge = challenge
+	config.Server.Auth.Tokens = []configs.TokenConfig{{Token: harnessToken}}
+
+	logger, err := utils.NewLogger(config)
+	if err != nil {
+		t.Fatalf("创建日志失败: %v", err)
+	}
+
+	// 测试期间保持一个连接，内存数据库在所有连接关闭后才会释放
+	db, err := database.NewDatabase(&config.Database, logger)
+	if err != nil {
+		t.Fatalf("初始化内存数据库失败: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	seedHarnessDatabase(t, db, t.TempDir())
+
+	ws, err := core.NewWebSocketServer(config, logger, database.NewConfigService(db, logger))
+	if err != nil {
+		t.Fatalf("创建WebSocket服务失败: %v", err)
+	}
+	server := httptest.NewServer(ws)
+	t.Cleanup(func() {
+		server.Close()
+		ws.Stop()
+	})
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+// seedHarnessDatabase 写入测试设备、设备认证和假provider配置（沿用服务默认的provider名称），
+// TTS音频写入audioDir
+func seedHarnessDatabase(t *testing.T, db *database.Database, audioDir string) {
+	t.Helper()
+	device := &database.Device{DeviceUUID: "harness-device", OUI: "000000", SN: "harness", DeviceName: "harness"}
+	if err := db.DB.Create(device).Error; err != nil {
+		t.Fatalf("创建测试设备失败: %v", err)
+	}
+	deviceAuth := &database.DeviceAuth{
+		DeviceID:   device.ID,
+		AuthType:   "hmac",
+		AuthKey:    harnessAuthKey,
+		AuthSecret: harnessAuthSecret,
+		IsActive:   true,
+	}
+	if err := db.DB.Create(deviceAuth).Error; err != nil {
+		t.Fatalf("创建设备认证失败: %v", err)
+	}
+	for category, name := range map[string]string{"ASR": "DoubaoASR", "LLM": "OllamaLLM", "TTS": "EdgeTTS"} {
+		provider := &database.ProviderConfig{
+			Category:  category,
+			Name:      name,
+			Type:      fake.ProviderType,
+			Version:   "v1",
+			Weight:    100,
+			IsActive:  true,
+			IsDefault: true,
+			Props:     json.RawMessage(`{}`),
+		}
+		if category == "TTS" {
+			props, _ := json.Marshal(map[string]interface{}{"output_dir": audioDir})
+			provider.Props = props
+		}
+		if err := db.DB.Create(provider).Error; err != nil {
+			t.Fatalf("创建%s配置失败: %v", category, err)
+		}
+	}
+	// 不预合成失败提示语，避免在工作目录写入缓存音频
+	prewarm := &database.SystemConfig{ConfigCategory: "failure_speech", ConfigKey: "prewarm", ConfigValue: "false", ConfigType: "bool"}
+	if err := db.DB.Create(prewarm).Error; err != nil {
+		t.Fatalf("创建系统配置失败: %v", err)
+	}
+}
+
+// harnessDevice 模拟设备端
+type harnessDevice struct {
+	t    *testing.T
+	conn *websocket.Conn
+}
+
+// dialHarnessDevice 以设备身份连接服务，token为空时不携带Authorization头
+func dialHarnessDevice(t *testing.T, url string, token string) *harnessDevice {
+	t.Helper()
+	header := http.Header{}
+	header.Set("Device-Id", harnessDeviceID)
+	header.Set("Client-Id", "harness-client")
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		t.Fatalf("连接WebSocket失败: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &harnessDevice{t: t, conn: conn}
+}
+
+// send 发送JSON文本消息
+func (d *harnessDevice) send(msg map[string]interface{}) {
+	d.t.Helper()
+	if err := d.conn.WriteJSON(msg); err != nil {
+		d.t.Fatalf("发送消息失败: %v", err)
+	}
+}
+
+// hello 发送hello并返回服务端的hello回复
+func (d *harnessDevice) hello(format string) map[string]interface{} {
+	d.t.Helper()
+	d.send(map[string]interface{}{
+		"type":      "hello",
+		"version":   1,
+		"transport": "websocket",
+		"audio_params": map[string]interface{}{
+			"format":         format,
+			"sample_rate":    16000,
+			"channels":       1,
+			"frame_duration": 60,
+		},
+	})
+	return d.expect("hello", "")
+}
+
+// expect 读取消息直到收到指定type（和state）的文本消息，跳过途中的其他消息
+func (d *harnessDevice) expect(msgType string, state string) map[string]interface{} {
+	d.t.Helper()
+	msg, _ := d.expectWithAudio(msgType, state)
+	return msg
+}
+
+// expectWithAudio 同expect，额外返回途中收到的二进制音频帧数
+func (d *harnessDevice) expectWithAudio(msgType string, state string) (map[string]interface{}, int) {
+	d.t.Helper()
+	audioFrames := 0
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		d.conn.SetReadDeadline(deadline)
+		messageType, data, err := d.conn.ReadMessage()
+		if err != nil {
+			d.t.Fatalf("等待 %s/%s 消息失败: %v", msgType, state, err)
+		}
+		if messageType == websocket.BinaryMessage {
+			audioFrames++
+			continue
+		}
+		var msg map[string]interface{}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			d.t.Fatalf("解析服务端消息失败: %v, 内容: %s", err, data)
+		}
+		if msg["type"] == msgType && (state == "" || msg["state"] == state) {
+			return msg, audioFrames
+		}
+	}
+}
+
+// roundTrip 发送一句文本并校验完整的一轮回复
+func (d *harnessDevice) roundTrip(text string) {
+	d.t.Helper()
+	d.send(map[string]interface{}{"type": "listen", "state": "detect", "text": text})
+
+	if stt := d.expect("stt", ""); stt["text"] != text {
+		d.t.Fatalf("stt文本 = %v, 期望 %s", stt["text"], text)
+	}
+	d.expect("tts", "start")
+	if emotion := d.expect("llm", ""); emotion["emotion"] != "thinking" {
+		d.t.Fatalf("llm情绪 = %v, 期望 thinking", emotion["emotion"])
+	}
+	if sentence := d.expect("tts", "sentence_start"); sentence["text"] != harnessReply {
+		d.t.Fatalf("sentence_start文本 = %v, 期望 %s", sentence["text"], harnessReply)
+	}
+	if _, frames := d.expectWithAudio("tts", "sentence_end"); frames == 0 {
+		d.t.Fatalf("sentence_start和sentence_end之间没有收到音频帧")
+	}
+	d.expect("tts", "stop")
+}
+
+func TestWebSocketHandshakeWithStaticToken(t *testing.T) {
+	url := newHarnessServer(t, "optional")
+	device := dialHarnessDevice(t, url, harnessToken)
+
+	// 连接建立后服务端先通过MCP初始化消息声明自身能力
+	mcpMessage := device.expect("mcp", "")
+	payload, _ := mcpMessage["payload"].(map[string]interface{})
+	params, _ := payload["params"].(map[string]interface{})
+	if payload["method"] != "initialize" || params["capabilities"] == nil {
+		t.Fatalf("MCP初始化消息不符: %v", mcpMessage)
+	}
+
+	hello := device.hello("pcm")
+	if hello["version"] != float64(1) || hello["transport"] != "websocket" {
+		t.Fatalf("hello版本/传输方式不符: %v", hello)
+	}
+	if hello["session_id"] == "" {
+		t.Fatalf("hello缺少session_id: %v", hello)
+	}
+	audioParams, _ := hello["audio_params"].(map[string]interface{})
+	if audioParams["format"] != "pcm" {
+		t.Fatalf("设备声明pcm时服务端音频格式 = %v, 期望 pcm", audioParams["format"])
+	}
+	// 静态token已认证，不再下发挑战
+	if _, ok := hello["auth"]; ok {
+		t.Fatalf("静态token认证后hello不应包含auth挑战: %v", hello)
+	}
+
+	device.roundTrip("今天天气怎么样")
+}
+
+func TestWebSocketHandshakeOpusDefaults(t *testing.T) {
+	url := newHarnessServer(t, "off")
+	device := dialHarnessDevice(t, url, harnessToken)
+
+	hello := device.hello("opus")
+	audioParams, _ := hello["audio_params"].(map[string]interface{})
+	expected := map[string]interface{}{
+		"format":         "opus",
+		"sample_rate":    float64(24000),
+		"channels":       float64(1),
+		"frame_duration": float64(60),
+	}
+	for key, value := range expected {
+		if audioParams[key] != value {
+			t.Fatalf("服务端audio_params.%s = %v, 期望 %v", key, audioParams[key], value)
+		}
+	}
+}
+
+func TestWebSocketHandshakeChallengeResponse(t *testing.T) {
+	url := newHarnessServer(t, "required")
+	device := dialHarnessDevice(t, url, "")
+
+	hello := device.hello("pcm")
+	challenge, ok := hello["auth"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("required模式下hello应包含auth挑战: %v", hello)
+	}
+	nonce, _ := challenge["nonce"].(string)
+	if nonce == "" || challenge["algorithm"] != "hmac-sha256" {
+		t.Fatalf("auth挑战不符: %v", challenge)
+	}
+
+	device.send(map[string]interface{}{
+		"type":      "auth",
+		"auth_key":  harnessAuthKey,
+		"nonce":     nonce,
+		"signature": auth.SignNonce(harnessAuthSecret, nonce, harnessDeviceID),
+	})
+	if result := device.expect("auth", ""); result["state"] != "success" {
+		t.Fatalf("挑战-应答认证失败: %v", result)
+	}
+
+	device.roundTrip("今天天气怎么样")
+}
+
+func TestWebSocketHandshakeRejectsBadSignature(t *testing.T) {
+	url := newHarnessServer(t, "required")
+	device := dialHarnessDevice(t, url, "")
+
+	hello := device.hello("pcm")
+	challenge, _ := hello["auth"].(map[string]interface{})
+	nonce, _ := challenge["nonce"].(string)
+
+	device.send(map[string]interface{}{
+		"type":      "auth",
+		"auth_key":  harnessAuthKey,
+		"nonce":     nonce,
+		"signature": auth.SignNonce("wrong-secret", nonce, harnessDeviceID),
+	})
+	if result := device.expect("auth", ""); result["state"] != "failed" {
+		t.Fatalf("错误签名应认证失败: %v", result)
+	}
+
+	// 认证失败后服务端关闭连接
+	device.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err := device.conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+}
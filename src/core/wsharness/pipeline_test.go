@@ -0,0 +1,54 @@
+package wsharness
+
+import (
+	"ai-server-go/src/core/providers/fake"
+	"errors"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestVoiceRoundTripWithFakeProviders(t *testing.T) {
+	url := newHarnessServer(t, "off")
+	device := dialHarnessDevice(t, url, harnessToken)
+	device.hello("pcm")
+
+	device.send(map[string]interface{}{"type": "listen", "state": "start", "mode": "manual"})
+	frame := make([]byte, 1920) // 60ms 16kHz 单声道静音PCM
+	for i := 0; i < 5; i++ {
+		if err := device.conn.WriteMessage(websocket.BinaryMessage, frame); err != nil {
+			t.Fatalf("发送音频失败: %v", err)
+		}
+	}
+	device.send(map[string]interface{}{"type": "listen", "state": "stop"})
+
+	if stt := device.expect("stt", ""); stt["text"] != fake.DefaultTranscript {
+		t.Fatalf("stt文本 = %v, 期望 %s", stt["text"], fake.DefaultTranscript)
+	}
+	if sentence := device.expect("tts", "sentence_start"); sentence["text"] != harnessReply {
+		t.Fatalf("sentence_start文本 = %v, 期望 %s", sentence["text"], harnessReply)
+	}
+	device.expect("tts", "stop")
+	if calls := fake.Calls("ASR"); calls != 1 {
+		t.Fatalf("ASR调用次数 = %d, 期望 1", calls)
+	}
+}
+
+func TestInjectedLLMFailureRecovers(t *testing.T) {
+	url := newHarnessServer(t, "off")
+	device := dialHarnessDevice(t, url, harnessToken)
+	device.hello("pcm")
+
+	// 只让下一次LLM调用失败：本轮播报失败提示语，下一轮恢复正常
+	fake.Inject(fake.Target("LLM", ""), fake.Fault{Err: errors.New("注入的LLM错误"), Times: 1})
+	device.send(map[string]interface{}{"type": "listen", "state": "detect", "text": "你好"})
+	if sentence := device.expect("tts", "sentence_start"); sentence["text"] == harnessReply {
+		t.Fatalf("LLM失败时不应播报正常回复: %v", sentence)
+	}
+	device.expect("tts", "stop")
+
+	device.roundTrip("今天天气怎么样")
+	if calls := fake.Calls("LLM"); calls != 2 {
+		t.Fatalf("LLM调用次数 = %d, 期望 2", calls)
+	}
+}
@@ -0,0 +1,175 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"ai-server-go/src/configs"
+	"ai-server-go/src/core/scheduler"
+	"ai-server-go/src/core/utils"
+
+	"gorm.io/gorm"
+)
+
+/*
+* 调试用的设备音频采集：管理员在设备的 audio_capture 能力中同时设置 enabled 和 consent 后，
+* 该设备每段识别语音的音频（WAV）写入 BlobStore，只保留很短的时间，供技术支持排查识别问题。
+* 系统配置 privacy.disable_audio_retention 为全局隐私开关，开启后不再采集，后台任务同时删除已采集的全部音频。
+ */
+
+// audioCaptureCleanupInterval 后台清理过期音频的间隔，采集的音频保留时间短，清理也更频繁
+const audioCaptureCleanupInterval = time.Minute
+
+// AudioCapture 采集的设备音频元数据，内容保存在 BlobStore 中
+type AudioCapture struct {
+	gorm.Model
+	Key        string    `json:"key" gorm:"size:64;uniqueIndex;not null"`
+	DeviceID   uint      `json:"device_id" gorm:"index"`
+	UserID     *uint     `json:"user_id" gorm:"index"`
+	SessionID  string    `json:"session_id" gorm:"size:100;index"`
+	Text       string    `json:"text" gorm:"type:text"` // 该段音频的识别结果
+	SampleRate int       `json:"sample_rate"`
+	DurationMs int       `json:"duration_ms"`
+	Size       int       `json:"size"`
+	ExpiresAt  time.Time `json:"expires_at" gorm:"index"`
+}
+
+// AudioCaptureStore 设备音频采集存储服务
+type AudioCaptureStore struct {
+	db     *gorm.DB
+	blobs  BlobStore
+	logger *utils.Logger
+}
+
+// NewAudioCaptureStore 创建设备音频采集存储服务
+func NewAudioCaptureStore(db *gorm.DB, blobs BlobStore, logger *utils.Logger) *AudioCaptureStore {
+	return &AudioCaptureStore{db: db, blobs: blobs, logger: logger}
+}
+
+// NewAudioCaptureStoreWithConfig 按配置文件 blob_store 创建设备音频采集存储服务
+func NewAudioCaptureStoreWithConfig(db *gorm.DB, config configs.BlobStoreConfig, logger *utils.Logger) (*AudioCaptureStore, error) {
+	blobs, err := NewBlobStore(config, logger)
+	if err != nil {
+		return nil, err
+	}
+	return NewAudioCaptureStore(db, blobs, logger), nil
+}
+
+// AudioRetentionDisabled 全局隐私开关是否禁止保留音频
+func (s *ConfigService) AudioRetentionDisabled() bool {
+	disabled, err := s.GetSystemConfigBool("privacy", "disable_audio_retention")
+	return err == nil && disabled
+}
+
+// SaveCapture 保存一段WAV音频，capture 的 Key、Size 和 ExpiresAt 由此处填写
+func (s *AudioCaptureStore) SaveCapture(capture *AudioCapture, wav []byte, retention time.Duration) error {
+	keyBytes := make([]byte, 16)
+	if _, err := rand.Read(keyBytes); err != nil {
+		return fmt.Errorf("生成音频key失败: %v", err)
+	}
+	capture.Key = hex.EncodeToString(keyBytes)
+	capture.Size = len(wav)
+	capture.ExpiresAt = time.Now().Add(retention)
+
+	if err := s.blobs.Put(capture.Key, wav); err != nil {
+		return fmt.Errorf("保存音频失败: %v", err)
+	}
+	if err := s.db.Create(capture).Error; err != nil {
+		_ = s.blobs.Delete(capture.Key)
+		return fmt.Errorf("保存音频记录失败: %v", err)
+	}
+	return nil
+}
+
+// GetCapture 读取设备未过期的音频元数据和内容
+func (s *AudioCaptureStore) GetCapture(deviceID uint, key string) (*AudioCapture, []byte, error) {
+	var capture AudioCapture
+	if err := s.db.Where(&AudioCapture{Key: key, DeviceID: deviceID}).First(&capture).Error; err != nil {
+		return nil, nil, fmt.Errorf("音频不存在: %v", err)
+	}
+	if capture.ExpiresAt.Before(time.Now()) {
+		return nil, nil, errors.New("音频已过期")
+	}
+	data, err := s.blobs.Get(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &capture, data, nil
+}
+
+// ListDeviceCaptures 列出设备未过期的音频元数据（不含内容）
+func (s *AudioCaptureStore) ListDeviceCaptures(deviceID uint, limit int) ([]AudioCapture, error) {
+	var captures []AudioCapture
+	query := s.db.Where("device_id = ? AND expires_at >= ?", deviceID, time.Now()).Order("created_at DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Find(&captures).Error; err != nil {
+		return nil, fmt.Errorf("获取音频列表失败: %v", err)
+	}
+	return captures, nil
+}
+
+// PurgeDeviceCaptures 删除设备采集的全部音频，返回删除数量
+func (s *AudioCaptureStore) PurgeDeviceCaptures(deviceID uint) (int, error) {
+	var captures []AudioCapture
+	if err := s.db.Where("device_id = ?", deviceID).Find(&captures).Error; err != nil {
+		return 0, fmt.Errorf("查询设备音频失败: %v", err)
+	}
+	return s.deleteCaptures(context.Background(), captures)
+}
+
+// DeleteExpiredCaptures 删除已过期的音频；all 为true时删除全部音频（全局隐私开关开启时）
+func (s *AudioCaptureStore) DeleteExpiredCaptures(ctx context.Context, all bool) (int, error) {
+	var captures []AudioCapture
+	query := s.db.WithContext(ctx)
+	if !all {
+		query = query.Where("expires_at < ?", time.Now())
+	}
+	if err := query.Find(&captures).Error; err != nil {
+		return 0, fmt.Errorf("查询过期音频失败: %v", err)
+	}
+	return s.deleteCaptures(ctx, captures)
+}
+
+// deleteCaptures 删除音频内容和记录，内容删除失败的记录保留到下次清理
+func (s *AudioCaptureStore) deleteCaptures(ctx context.Context, captures []AudioCapture) (int, error) {
+	ids := make([]uint, 0, len(captures))
+	for _, capture := range captures {
+		if err := s.blobs.Delete(capture.Key); err != nil {
+			s.logger.Warn("删除音频 %s 失败: %v", capture.Key, err)
+			continue
+		}
+		ids = append(ids, capture.ID)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	if err := s.db.WithContext(ctx).Unscoped().Delete(&AudioCapture{}, ids).Error; err != nil {
+		return 0, fmt.Errorf("删除音频记录失败: %v", err)
+	}
+	return len(ids), nil
+}
+
+// AudioCaptureRetentionJob 定期删除过期音频的任务，由调度器执行；全局隐私开关开启时删除全部音频
+func (s *AudioCaptureStore) AudioCaptureRetentionJob(configService *ConfigService) scheduler.Job {
+	return scheduler.Job{
+		Name:     "audio-capture-retention",
+		Interval: audioCaptureCleanupInterval,
+		Run: func(ctx context.Context) error {
+			all := configService != nil && configService.AudioRetentionDisabled()
+			count, err := s.DeleteExpiredCaptures(ctx, all)
+			if err != nil {
+				return fmt.Errorf("清理采集音频失败: %v", err)
+			}
+			if count > 0 {
+				s.logger.Info("删除%d段采集音频", count)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,148 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"ai-server-go/src/configs"
+	"ai-server-go/src/core/utils"
+)
+
+// ErrBlobNotFound 对象不存在
+var ErrBlobNotFound = errors.New("对象不存在")
+
+// BlobStore 二进制对象存储接口，默认实现为本地文件系统，可替换为对象存储等后端
+type BlobStore interface {
+	// Put 写入对象，同名对象被覆盖
+	Put(key string, data []byte) error
+	// Get 读取对象，不存在时返回 ErrBlobNotFound
+	Get(key string) ([]byte, error)
+	// Delete 删除对象，不存在时不报错
+	Delete(key string) error
+}
+
+// BlobStoreFactory 对象存储工厂函数，options 为配置文件 blob_store.options 中的参数
+type BlobStoreFactory func(options map[string]interface{}, logger *utils.Logger) (BlobStore, error)
+
+var (
+	blobStoreMu        sync.RWMutex
+	blobStoreFactories = map[string]BlobStoreFactory{
+		"local": newLocalBlobStoreFromOptions,
+	}
+)
+
+// RegisterBlobStore 注册对象存储后端，通常在实现包的init中调用
+func RegisterBlobStore(name string, factory BlobStoreFactory) {
+	blobStoreMu.Lock()
+	defer blobStoreMu.Unlock()
+	blobStoreFactories[name] = factory
+}
+
+// NewBlobStore 按配置创建对象存储，未配置类型时使用本地文件系统
+func NewBlobStore(config configs.BlobStoreConfig, logger *utils.Logger) (BlobStore, error) {
+	name := config.Type
+	if name == "" {
+		name = "local"
+	}
+	blobStoreMu.RLock()
+	factory, ok := blobStoreFactories[name]
+	blobStoreMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("未知的对象存储类型: %s (可用: %v)", name, BlobStoreNames())
+	}
+	store, err := factory(config.Options, logger)
+	if err != nil {
+		return nil, fmt.Errorf("创建对象存储 %s 失败: %v", name, err)
+	}
+	return store, nil
+}
+
+// BlobStoreNames 已注册的对象存储名称
+func BlobStoreNames() []string {
+	blobStoreMu.RLock()
+	defer blobStoreMu.RUnlock()
+	names := make([]string, 0, len(blobStoreFactories))
+	for name := range blobStoreFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// defaultLocalBlobDir 本地对象存储的默认目录
+const defaultLocalBlobDir = "data/blobs"
+
+// LocalBlobStore 本地文件系统对象存储，每个对象一个文件
+type LocalBlobStore struct {
+	dir string
+}
+
+// NewLocalBlobStore 创建本地文件系统对象存储，目录不存在时自动创建
+func NewLocalBlobStore(dir string) (*LocalBlobStore, error) {
+	if dir == "" {
+		dir = defaultLocalBlobDir
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("创建对象存储目录失败: %v", err)
+	}
+	return &LocalBlobStore{dir: dir}, nil
+}
+
+// newLocalBlobStoreFromOptions 按 options.dir 创建本地对象存储
+func newLocalBlobStoreFromOptions(options map[string]interface{}, _ *utils.Logger) (BlobStore, error) {
+	dir, _ := options["dir"].(string)
+	return NewLocalBlobStore(dir)
+}
+
+// path 对象对应的文件路径，key 不允许包含路径分隔符
+func (s *LocalBlobStore) path(key string) (string, error) {
+	if key == "" || key == "." || key == ".." || strings.ContainsAny(key, `/\`) {
+		return "", fmt.Errorf("无效的对象键: %q", key)
+	}
+	return filepath.Join(s.dir, key), nil
+}
+
+// Put 写入对象
+func (s *LocalBlobStore) Put(key string, data []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("写入对象失败: %v", err)
+	}
+	return nil
+}
+
+// Get 读取对象
+func (s *LocalBlobStore) Get(key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取对象失败: %v", err)
+	}
+	return data, nil
+}
+
+// Delete 删除对象
+func (s *LocalBlobStore) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除对象失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package database
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+* 设备生效能力配置缓存：GetDeviceCapabilityConfigWithFallback 需要查询设备能力、用户能力、
+* 系统默认能力、兼容性规则和全局配置，对话中每轮都会调用。结果按 (设备ID, 用户ID) 在进程内缓存 TTL 时长；
+* 设备/用户能力、AI能力、兼容性规则、全局配置或设备信息变更时立即失效相关条目。
+* 每次失效递增代数，查询开始后发生失效的结果不会写回缓存，避免并发下缓存旧数据。
+ */
+
+const (
+	capabilityCacheTTL        = 30 * time.Second // 缓存有效期，作为遗漏失效路径时的兜底
+	capabilityCacheMaxEntries = 4096             // 缓存条目上限，超过时清理过期条目
+)
+
+// capabilityCacheKey 缓存键
+type capabilityCacheKey struct {
+	deviceID uint
+	userID   uint
+	hasUser  bool
+}
+
+// capabilityCacheEntry 缓存条目
+type capabilityCacheEntry struct {
+	config   *DeviceCapabilityConfig
+	loadedAt time.Time
+}
+
+// capabilityCache 进程内共享的能力配置缓存（各连接使用独立的ConfigService实例）
+var capabilityCache = struct {
+	sync.RWMutex
+	entries    map[capabilityCacheKey]capabilityCacheEntry
+	generation uint64
+}{entries: make(map[capabilityCacheKey]capabilityCacheEntry)}
+
+// newCapabilityCacheKey 生成缓存键
+func newCapabilityCacheKey(deviceID uint, userID *uint) capabilityCacheKey {
+	key := capabilityCacheKey{deviceID: deviceID}
+	if userID != nil {
+		key.userID = *userID
+		key.hasUser = true
+	}
+	return key
+}
+
+// cachedCapabilityConfig 读取未过期的缓存，返回副本和当前代数
+func cachedCapabilityConfig(key capabilityCacheKey) (*DeviceCapabilityConfig, uint64) {
+	capabilityCache.RLock()
+	defer capabilityCache.RUnlock()
+	entry, ok := capabilityCache.entries[key]
+	if ok && time.Since(entry.loadedAt) < capabilityCacheTTL {
+		return cloneDeviceCapabilityConfig(entry.config), capabilityCache.generation
+	}
+	return nil, capabilityCache.generation
+}
+
+// staleCapabilityConfig 读取缓存，不检查是否过期，用于数据库不可用时降级
+func staleCapabilityConfig(key capabilityCacheKey) *DeviceCapabilityConfig {
+	capabilityCache.RLock()
+	defer capabilityCache.RUnlock()
+	if entry, ok := capabilityCache.entries[key]; ok {
+		return cloneDeviceCapabilityConfig(entry.config)
+	}
+	return nil
+}
+
+// storeCapabilityConfig 写入缓存，查询期间发生过失效（代数变化）时放弃写入
+func storeCapabilityConfig(key capabilityCacheKey, generation uint64, config *DeviceCapabilityConfig) {
+	capabilityCache.Lock()
+	defer capabilityCache.Unlock()
+	if capabilityCache.generation != generation {
+		return
+	}
+	if len(capabilityCache.entries) >= capabilityCacheMaxEntries {
+		for k, entry := range capabilityCache.entries {
+			if time.Since(entry.loadedAt) >= capabilityCacheTTL {
+				delete(capabilityCache.entries, k)
+			}
+		}
+		if len(capabilityCache.entries) >= capabilityCacheMaxEntries {
+			capabilityCache.entries = make(map[capabilityCacheKey]capabilityCacheEntry)
+		}
+	}
+	capabilityCache.entries[key] = capabilityCacheEntry{
+		config:   cloneDeviceCapabilityConfig(config),
+		loadedAt: time.Now(),
+	}
+}
+
+// invalidateCapabilityCache 删除满足条件的缓存条目并递增代数
+func invalidateCapabilityCache(match func(key capabilityCacheKey) bool) {
+	capabilityCache.Lock()
+	defer capabilityCache.Unlock()
+	capabilityCache.generation++
+	for key := range capabilityCache.entries {
+		if match(key) {
+			delete(capabilityCache.entries, key)
+		}
+	}
+}
+
+// InvalidateDeviceCapabilityCache 设备能力或设备信息变更后失效该设备的缓存
+func InvalidateDeviceCapabilityCache(deviceIDs ...uint) {
+	invalidateCapabilityCache(func(key capabilityCacheKey) bool {
+		for _, id := range deviceIDs {
+			if key.deviceID == id {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// InvalidateUserCapabilityCache 用户能力变更后失效该用户相关的缓存
+func InvalidateUserCapabilityCache(userID uint) {
+	invalidateCapabilityCache(func(key capabilityCacheKey) bool {
+		return key.hasUser && key.userID == userID
+	})
+}
+
+// InvalidateAllCapabilityCache AI能力、兼容性规则或全局配置变更后清空缓存
+func InvalidateAllCapabilityCache() {
+	invalidateCapabilityCache(func(capabilityCacheKey) bool { return true })
+}
+
+// cloneDeviceCapabilityConfig 深拷贝能力配置，调用方修改返回值不会影响缓存
+func cloneDeviceCapabilityConfig(config *DeviceCapabilityConfig) *DeviceCapabilityConfig {
+	if config == nil {
+		return nil
+	}
+	clone := &DeviceCapabilityConfig{
+		DeviceID:      config.DeviceID,
+		Capabilities:  make([]CapabilityConfig, len(config.Capabilities)),
+		GlobalConfigs: make(map[string]string, len(config.GlobalConfigs)),
+	}
+	for i, capability := range config.Capabilities {
+		capability.Config, _ = cloneConfigValue(capability.Config).(map[string]interface{})
+		clone.Capabilities[i] = capability
+	}
+	for key, value := range config.GlobalConfigs {
+		clone.GlobalConfigs[key] = value
+	}
+	if config.Excluded != nil {
+		clone.Excluded = append([]ExcludedCapability(nil), config.Excluded...)
+	}
+	return clone
+}
+
+// cloneConfigValue 深拷贝JSON解析出的配置值
+func cloneConfigValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if v == nil {
+			return v
+		}
+		clone := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			clone[key] = cloneConfigValue(item)
+		}
+		return clone
+	case []interface{}:
+		if v == nil {
+			return v
+		}
+		clone := make([]interface{}, len(v))
+		for i, item := range v {
+			clone[i] = cloneConfigValue(item)
+		}
+		return clone
+	default:
+		return v
+	}
+}
@@ -0,0 +1,178 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// CapabilityCompatibility 能力兼容性规则：设备需满足型号/固件/硬件条件才会下发该能力
+type CapabilityCompatibility struct {
+	gorm.Model
+	CapabilityName     string `json:"capability_name" gorm:"size:50;not null;index"` // 能力名称（如 vision）
+	CapabilityType     string `json:"capability_type" gorm:"size:20"`                // 能力类型，为空表示该能力的所有类型
+	DeviceModels       string `json:"device_models" gorm:"size:500"`                 // 支持的设备型号，逗号分隔，为空表示不限制
+	MinFirmwareVersion string `json:"min_firmware_version" gorm:"size:20"`           // 最低固件版本，为空表示不限制
+	MinHardwareVersion string `json:"min_hardware_version" gorm:"size:20"`           // 最低硬件版本，为空表示不限制
+	Description        string `json:"description" gorm:"size:255"`
+	IsActive           bool   `json:"is_active" gorm:"default:true"`
+}
+
+// ExcludedCapability 因设备不兼容被过滤掉的能力
+type ExcludedCapability struct {
+	CapabilityName string `json:"capability_name"`
+	CapabilityType string `json:"capability_type"`
+	Source         string `json:"source"` // 原配置来源：device, user, system
+	Reason         string `json:"reason"`
+}
+
+// ListCapabilityCompatibility 获取兼容性规则列表
+func (s *ConfigService) ListCapabilityCompatibility() ([]*CapabilityCompatibility, error) {
+	var rules []*CapabilityCompatibility
+	if err := s.db.DB.Order("capability_name, id").Find(&rules).Error; err != nil {
+		return nil, fmt.Errorf("查询能力兼容性规则失败: %v", err)
+	}
+	return rules, nil
+}
+
+// SaveCapabilityCompatibility 创建或更新兼容性规则
+func (s *ConfigService) SaveCapabilityCompatibility(rule *CapabilityCompatibility) error {
+	if rule.CapabilityName == "" {
+		return fmt.Errorf("能力名称不能为空")
+	}
+	for _, version := range []string{rule.MinFirmwareVersion, rule.MinHardwareVersion} {
+		if version != "" && parseVersion(version) == nil {
+			return fmt.Errorf("无效的版本号: %s", version)
+		}
+	}
+	if err := s.db.DB.Save(rule).Error; err != nil {
+		return fmt.Errorf("保存能力兼容性规则失败: %v", err)
+	}
+	InvalidateAllCapabilityCache()
+	s.logger.Info("能力兼容性规则已保存: %s/%s", rule.CapabilityName, rule.CapabilityType)
+	return nil
+}
+
+// DeleteCapabilityCompatibility 删除兼容性规则
+func (s *ConfigService) DeleteCapabilityCompatibility(id uint) error {
+	result := s.db.DB.Delete(&CapabilityCompatibility{}, id)
+	if result.Error != nil {
+		return fmt.Errorf("删除能力兼容性规则失败: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("能力兼容性规则不存在")
+	}
+	InvalidateAllCapabilityCache()
+	return nil
+}
+
+// filterIncompatibleCapabilities 按兼容性规则过滤设备不支持的能力
+func (s *ConfigService) filterIncompatibleCapabilities(deviceConfig *DeviceCapabilityConfig) {
+	var rules []*CapabilityCompatibility
+	if err := s.db.DB.Where("is_active = ?", true).Find(&rules).Error; err != nil || len(rules) == 0 {
+		return
+	}
+	var device Device
+	if err := s.db.DB.First(&device, deviceConfig.DeviceID).Error; err != nil {
+		// 未注册的设备没有型号/版本信息，不做过滤
+		return
+	}
+
+	kept := deviceConfig.Capabilities[:0]
+	for _, capability := range deviceConfig.Capabilities {
+		if reason := checkCapabilityCompatibility(&device, capability, rules); reason != "" {
+			source, _ := capability.Config["priority_source"].(string)
+			deviceConfig.Excluded = append(deviceConfig.Excluded, ExcludedCapability{
+				CapabilityName: capability.CapabilityName,
+				CapabilityType: capability.CapabilityType,
+				Source:         source,
+				Reason:         reason,
+			})
+			continue
+		}
+		kept = append(kept, capability)
+	}
+	deviceConfig.Capabilities = kept
+}
+
+// checkCapabilityCompatibility 检查设备是否满足能力的所有兼容性规则，不满足时返回原因
+func checkCapabilityCompatibility(device *Device, capability CapabilityConfig, rules []*CapabilityCompatibility) string {
+	for _, rule := range rules {
+		if rule.CapabilityName != capability.CapabilityName {
+			continue
+		}
+		if rule.CapabilityType != "" && rule.CapabilityType != capability.CapabilityType {
+			continue
+		}
+
+		if rule.DeviceModels != "" {
+			supported := false
+			for _, model := range strings.Split(rule.DeviceModels, ",") {
+				if strings.EqualFold(strings.TrimSpace(model), device.DeviceModel) {
+					supported = true
+					break
+				}
+			}
+			if !supported {
+				return fmt.Sprintf("设备型号 %q 不在支持列表 [%s] 中", device.DeviceModel, rule.DeviceModels)
+			}
+		}
+		if rule.MinFirmwareVersion != "" && compareVersions(device.FirmwareVersion, rule.MinFirmwareVersion) < 0 {
+			return fmt.Sprintf("固件版本 %q 低于最低要求 %s", device.FirmwareVersion, rule.MinFirmwareVersion)
+		}
+		if rule.MinHardwareVersion != "" && compareVersions(device.HardwareVersion, rule.MinHardwareVersion) < 0 {
+			return fmt.Sprintf("硬件版本 %q 低于最低要求 %s", device.HardwareVersion, rule.MinHardwareVersion)
+		}
+	}
+	return ""
+}
+
+// parseVersion 解析点分版本号（允许 v 前缀），格式错误时返回nil
+func parseVersion(version string) []int {
+	version = strings.TrimPrefix(strings.TrimSpace(strings.ToLower(version)), "v")
+	if version == "" {
+		return nil
+	}
+	parts := strings.Split(version, ".")
+	numbers := make([]int, len(parts))
+	for i, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 {
+			return nil
+		}
+		numbers[i] = number
+	}
+	return numbers
+}
+
+// compareVersions 比较两个版本号，无法解析的版本视为最低版本
+func compareVersions(a, b string) int {
+	va, vb := parseVersion(a), parseVersion(b)
+	if va == nil && vb == nil {
+		return 0
+	}
+	if va == nil {
+		return -1
+	}
+	if vb == nil {
+		return 1
+	}
+	for i := 0; i < len(va) || i < len(vb); i++ {
+		var x, y int
+		if i < len(va) {
+			x = va[i]
+		}
+		if i < len(vb) {
+			y = vb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
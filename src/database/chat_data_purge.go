@@ -0,0 +1,291 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"ai-server-go/src/core/scheduler"
+	"ai-server-go/src/core/utils"
+
+	"gorm.io/gorm"
+)
+
+/*
+* 聊天数据清除：用户本人或管理员可一次清除用户的全部聊天数据（会话、消息、记忆、待重试记忆、存储的图片和采集的音频），
+* 数据库记录在同一事务中删除，图片和音频内容在事务提交后从 BlobStore 删除。
+* anonymize 模式保留会话和消息的行（时间、数量等统计仍可用），但清空其中的用户ID和内容；记忆、图片和音频总是删除。
+* 系统配置 chat_retention 开启后，后台任务定期按同样的方式清除超过保留天数的数据。每次清除都写入审计记录。
+ */
+
+// chatRetentionInterval 后台按保留期清除聊天数据的间隔
+const chatRetentionInterval = time.Hour
+
+// 清除模式
+const (
+	ChatPurgeModeDelete    = "delete"    // 删除记录
+	ChatPurgeModeAnonymize = "anonymize" // 保留会话和消息的行，清空用户ID和内容
+)
+
+// ChatDataPurgeAudit 聊天数据清除审计记录
+type ChatDataPurgeAudit struct {
+	gorm.Model
+	UserID     *uint      `json:"user_id" gorm:"index"`           // 被清除数据的用户，保留期清除时为空
+	OperatorID *uint      `json:"operator_id"`                    // 操作人，系统自动清除时为空
+	Reason     string     `json:"reason" gorm:"size:20;not null"` // request（用户或管理员请求）, retention（保留期自动清除）
+	Mode       string     `json:"mode" gorm:"size:20;not null"`   // delete, anonymize
+	Before     *time.Time `json:"before"`                         // 保留期清除的截止时间
+	Detail     string     `json:"detail" gorm:"type:text"`        // 各类数据的清除数量（JSON）
+}
+
+// ChatDataPurgeResult 各类数据的清除数量
+type ChatDataPurgeResult struct {
+	Sessions        int64 `json:"sessions"`
+	Messages        int64 `json:"messages"`
+	Memories        int64 `json:"memories"`
+	PendingMemories int64 `json:"pending_memories"`
+	Images          int64 `json:"images"`
+	AudioCaptures   int64 `json:"audio_captures"`
+}
+
+// Total 清除的记录总数
+func (r *ChatDataPurgeResult) Total() int64 {
+	return r.Sessions + r.Messages + r.Memories + r.PendingMemories + r.Images + r.AudioCaptures
+}
+
+// chatPurgeScope 清除范围：指定用户的全部数据，或全部用户早于截止时间的数据
+type chatPurgeScope struct {
+	UserID *uint
+	Before *time.Time
+}
+
+// where 按范围过滤，timeColumn 为判断数据新旧的时间字段
+func (scope chatPurgeScope) where(db *gorm.DB, timeColumn string) *gorm.DB {
+	if scope.UserID != nil {
+		db = db.Where("user_id = ?", *scope.UserID)
+	}
+	if scope.Before != nil {
+		db = db.Where(timeColumn+" < ?", *scope.Before)
+	}
+	return db
+}
+
+// ChatDataPurger 聊天数据清除服务
+type ChatDataPurger struct {
+	db     *Database
+	images *ImageStore        // 为空时不清除图片
+	audio  *AudioCaptureStore // 为空时不清除采集的音频
+	logger *utils.Logger
+}
+
+// NewChatDataPurger 创建聊天数据清除服务，图片或音频存储未启用时传nil
+func NewChatDataPurger(db *Database, images *ImageStore, audio *AudioCaptureStore, logger *utils.Logger) *ChatDataPurger {
+	return &ChatDataPurger{db: db, images: images, audio: audio, logger: logger}
+}
+
+// PurgeUserChatData 清除用户的全部聊天数据，operatorID 为发起请求的用户
+func (p *ChatDataPurger) PurgeUserChatData(ctx context.Context, userID uint, operatorID *uint, mode string) (*ChatDataPurgeResult, error) {
+	result, err := p.purge(ctx, chatPurgeScope{UserID: &userID}, operatorID, "request", mode)
+	if err != nil {
+		return nil, err
+	}
+	p.logger.Info("清除用户%d的聊天数据（%s，操作人%s）: %+v", userID, mode, formatOperator(operatorID), *result)
+	return result, nil
+}
+
+// PurgeChatDataBefore 清除全部用户早于截止时间的聊天数据
+func (p *ChatDataPurger) PurgeChatDataBefore(ctx context.Context, before time.Time, mode string) (*ChatDataPurgeResult, error) {
+	return p.purge(ctx, chatPurgeScope{Before: &before}, nil, "retention", mode)
+}
+
+// purge 在一个事务中清除范围内的数据库记录并写入审计记录，提交后删除图片和音频内容
+func (p *ChatDataPurger) purge(ctx context.Context, scope chatPurgeScope, operatorID *uint, reason, mode string) (*ChatDataPurgeResult, error) {
+	if mode == "" {
+		mode = ChatPurgeModeDelete
+	}
+	if mode != ChatPurgeModeDelete && mode != ChatPurgeModeAnonymize {
+		return nil, fmt.Errorf("不支持的清除模式: %s", mode)
+	}
+
+	var result ChatDataPurgeResult
+	var imageKeys, audioKeys []string
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		// 事务重试时重新统计
+		result = ChatDataPurgeResult{}
+		imageKeys, audioKeys = nil, nil
+		tx = tx.WithContext(ctx)
+
+		// 范围内会话的全部消息，以及范围内不属于这些会话的消息
+		sessionIDs := scope.where(tx.Unscoped().Model(&ChatSession{}).Select("session_id"), "updated_at")
+		messages := scope.where(tx.Unscoped().Model(&ChatMessage{}), "timestamp")
+		messages = tx.Unscoped().Model(&ChatMessage{}).Where(messages).Or("session_id IN (?)", sessionIDs)
+		sessions := scope.where(tx.Unscoped().Model(&ChatSession{}), "updated_at")
+
+		if mode == ChatPurgeModeAnonymize {
+			res := messages.Updates(map[string]interface{}{"user_id": nil, "content": "", "metadata": "", "attachments": ""})
+			if res.Error != nil {
+				return fmt.Errorf("匿名化聊天消息失败: %v", res.Error)
+			}
+			result.Messages = res.RowsAffected
+			res = sessions.Updates(map[string]interface{}{"user_id": nil, "title": "", "summary": "", "tags": ""})
+			if res.Error != nil {
+				return fmt.Errorf("匿名化聊天会话失败: %v", res.Error)
+			}
+			result.Sessions = res.RowsAffected
+		} else {
+			res := messages.Delete(&ChatMessage{})
+			if res.Error != nil {
+				return fmt.Errorf("删除聊天消息失败: %v", res.Error)
+			}
+			result.Messages = res.RowsAffected
+			res = sessions.Delete(&ChatSession{})
+			if res.Error != nil {
+				return fmt.Errorf("删除聊天会话失败: %v", res.Error)
+			}
+			result.Sessions = res.RowsAffected
+		}
+
+		// 记忆按最近使用时间判断新旧，仍在使用的记忆不因创建时间早而被清除
+		memories := scope.where(tx.Unscoped(), "updated_at")
+		if scope.Before != nil {
+			memories = memories.Where("last_used IS NULL OR last_used < ?", *scope.Before)
+		}
+		res := memories.Delete(&ChatMemory{})
+		if res.Error != nil {
+			return fmt.Errorf("删除聊天记忆失败: %v", res.Error)
+		}
+		result.Memories = res.RowsAffected
+
+		res = scope.where(tx.Unscoped(), "created_at").Delete(&PendingMemory{})
+		if res.Error != nil {
+			return fmt.Errorf("删除待重试记忆失败: %v", res.Error)
+		}
+		result.PendingMemories = res.RowsAffected
+
+		if p.images != nil {
+			var images []StoredImage
+			if err := scope.where(tx.Unscoped().Select("id", "key"), "created_at").Find(&images).Error; err != nil {
+				return fmt.Errorf("查询图片失败: %v", err)
+			}
+			if len(images) > 0 {
+				ids := make([]uint, 0, len(images))
+				for _, image := range images {
+					ids = append(ids, image.ID)
+					imageKeys = append(imageKeys, image.Key)
+				}
+				res = tx.Unscoped().Delete(&StoredImage{}, ids)
+				if res.Error != nil {
+					return fmt.Errorf("删除图片记录失败: %v", res.Error)
+				}
+				result.Images = res.RowsAffected
+			}
+		}
+		if p.audio != nil {
+			var captures []AudioCapture
+			if err := scope.where(tx.Unscoped().Select("id", "key"), "created_at").Find(&captures).Error; err != nil {
+				return fmt.Errorf("查询采集音频失败: %v", err)
+			}
+			if len(captures) > 0 {
+				ids := make([]uint, 0, len(captures))
+				for _, capture := range captures {
+					ids = append(ids, capture.ID)
+					audioKeys = append(audioKeys, capture.Key)
+				}
+				res = tx.Unscoped().Delete(&AudioCapture{}, ids)
+				if res.Error != nil {
+					return fmt.Errorf("删除音频记录失败: %v", res.Error)
+				}
+				result.AudioCaptures = res.RowsAffected
+			}
+		}
+
+		if scope.Before != nil && result.Total() == 0 {
+			return nil
+		}
+		detail, _ := json.Marshal(result)
+		audit := &ChatDataPurgeAudit{
+			UserID:     scope.UserID,
+			OperatorID: operatorID,
+			Reason:     reason,
+			Mode:       mode,
+			Before:     scope.Before,
+			Detail:     string(detail),
+		}
+		if err := tx.Create(audit).Error; err != nil {
+			return fmt.Errorf("保存清除审计记录失败: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 记录已删除，内容删除失败只会留下无法再访问的孤立内容
+	for _, key := range imageKeys {
+		if err := p.images.blobs.Delete(key); err != nil {
+			p.logger.Warn("删除图片 %s 失败: %v", key, err)
+		}
+	}
+	for _, key := range audioKeys {
+		if err := p.audio.blobs.Delete(key); err != nil {
+			p.logger.Warn("删除音频 %s 失败: %v", key, err)
+		}
+	}
+	return &result, nil
+}
+
+// ListChatDataPurgeAudits 按时间倒序查询聊天数据清除审计记录，userID为0时查询全部
+func (p *ChatDataPurger) ListChatDataPurgeAudits(userID uint, offset, limit int) ([]*ChatDataPurgeAudit, int64, error) {
+	query := p.db.DB.Model(&ChatDataPurgeAudit{})
+	if userID > 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("统计清除审计记录失败: %v", err)
+	}
+	var audits []*ChatDataPurgeAudit
+	if err := query.Order("id DESC").Offset(offset).Limit(limit).Find(&audits).Error; err != nil {
+		return nil, 0, fmt.Errorf("查询清除审计记录失败: %v", err)
+	}
+	return audits, total, nil
+}
+
+// ChatRetentionJob 按 chat_retention 系统配置定期清除超过保留天数的聊天数据，未开启时不执行
+func (p *ChatDataPurger) ChatRetentionJob(configService *ConfigService) scheduler.Job {
+	return scheduler.Job{
+		Name:     "chat-retention",
+		Interval: chatRetentionInterval,
+		Run: func(ctx context.Context) error {
+			enabled, err := configService.GetSystemConfigBool("chat_retention", "enabled")
+			if err != nil || !enabled {
+				return nil
+			}
+			days, err := configService.GetSystemConfigInt("chat_retention", "retention_days")
+			if err != nil || days <= 0 {
+				return nil
+			}
+			mode, _ := configService.GetSystemConfigValue("chat_retention", "mode")
+
+			before := time.Now().AddDate(0, 0, -days)
+			result, err := p.PurgeChatDataBefore(ctx, before, mode)
+			if err != nil {
+				return fmt.Errorf("按保留期清除聊天数据失败: %v", err)
+			}
+			if result.Total() > 0 {
+				p.logger.Info("按保留期（%d天，%s）清除聊天数据: %+v", days, mode, *result)
+			}
+			return nil
+		},
+	}
+}
+
+// formatOperator 日志中的操作人
+func formatOperator(operatorID *uint) string {
+	if operatorID == nil {
+		return "系统"
+	}
+	return fmt.Sprintf("%d", *operatorID)
+}
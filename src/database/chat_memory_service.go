@@ -4,27 +4,68 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"strings"
 	"time"
 
+	"ai-server-go/src/configs"
 	"ai-server-go/src/core/chat"
+	"ai-server-go/src/core/types"
 	"ai-server-go/src/core/utils"
 
 	"gorm.io/gorm"
 )
 
-// ChatMemoryService 聊天记忆服务
+// ChatMemoryService 聊天记忆服务：会话和消息保存在数据库，长期记忆委托给可替换的 MemoryStore
 type ChatMemoryService struct {
 	db     *gorm.DB
 	logger *utils.Logger
+	store  MemoryStore       // 记忆存储后端，默认为SQL实现
+	retry  memoryRetryPolicy // 记忆生成失败的重试策略
+
+	capacity memoryCapPolicy // 每台设备的记忆数量上限
+}
+
+// Embedder 记忆向量化接口，由独立的EMBEDDING提供者实现，不复用对话LLM
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
 }
 
-// NewChatMemoryService 创建聊天记忆服务实例
+// semanticCandidateLimit 向量检索时参与相似度排序的候选记忆数量上限
+const semanticCandidateLimit = 200
+
+// embeddingTimeout 单次向量化调用超时
+const embeddingTimeout = 5 * time.Second
+
+// NewChatMemoryService 创建聊天记忆服务实例，使用默认的SQL记忆存储
 func NewChatMemoryService(db *gorm.DB, logger *utils.Logger) *ChatMemoryService {
 	return &ChatMemoryService{
 		db:     db,
 		logger: logger,
+		store:  NewSQLMemoryStore(db, logger),
+		retry:  newMemoryRetryPolicy(configs.MemoryRetryConfig{}),
+
+		capacity: newMemoryCapPolicy(configs.MemoryCapConfig{}),
+	}
+}
+
+// NewChatMemoryServiceWithConfig 按配置选择记忆存储后端创建聊天记忆服务，未配置时使用SQL存储
+func NewChatMemoryServiceWithConfig(db *gorm.DB, config configs.MemoryConfig, logger *utils.Logger) (*ChatMemoryService, error) {
+	service := NewChatMemoryService(db, logger)
+	service.retry = newMemoryRetryPolicy(config.Retry)
+	service.capacity = newMemoryCapPolicy(config.Cap)
+	if config.Store == "" || config.Store == "sql" {
+		return service, nil
 	}
+	store, err := NewMemoryStore(config.Store, db, config.Options, logger)
+	if err != nil {
+		return nil, err
+	}
+	service.store = store
+	return service, nil
+}
+
+// Store 获取当前使用的记忆存储
+func (s *ChatMemoryService) Store() MemoryStore {
+	return s.store
 }
 
 // CreateSession 创建聊天会话
@@ -91,14 +132,13 @@ func (s *ChatMemoryService) SaveMessage(sessionID string, userID *uint, deviceID
 		IsProcessed: false,
 	}
 
-	if err := s.db.Create(message).Error; err != nil {
-		return fmt.Errorf("保存消息失败: %v", err)
-	}
-
-	// 更新会话消息计数
-	s.db.Model(&ChatSession{}).Where("session_id = ?", sessionID).UpdateColumn("message_count", gorm.Expr("message_count + 1"))
-
-	return nil
+	// 消息和会话消息计数在同一事务中写入
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(message).Error; err != nil {
+			return fmt.Errorf("保存消息失败: %v", err)
+		}
+		return incrementMessageCount(tx, sessionID, 1)
+	})
 }
 
 // GetSessionMessages 获取会话消息历史
@@ -117,260 +157,98 @@ func (s *ChatMemoryService) GetSessionMessages(sessionID string, limit int) ([]C
 	return messages, nil
 }
 
-// SaveMemory 保存聊天记忆
-func (s *ChatMemoryService) SaveMemory(userID *uint, deviceID uint, sessionID, memoryType, content string, importance int, tags []string) error {
-	memory := &ChatMemory{
-		UserID:     userID,
-		DeviceID:   deviceID,
-		SessionID:  sessionID,
-		MemoryType: memoryType,
-		Content:    content,
-		Importance: importance,
-		Tags:       strings.Join(tags, ","),
-		LastUsed:   &[]time.Time{time.Now()}[0],
-		UseCount:   0,
-		IsActive:   true,
-	}
-
-	if err := s.db.Create(memory).Error; err != nil {
-		return fmt.Errorf("保存记忆失败: %v", err)
+// ToDialogueMessages 将数据库消息转换为对话消息，保留多模态附件
+func ToDialogueMessages(messages []ChatMessage) []chat.Message {
+	dialogue := make([]chat.Message, 0, len(messages))
+	for i := range messages {
+		msg := chat.Message{
+			Role:    messages[i].Role,
+			Content: messages[i].Content,
+		}
+		for _, att := range messages[i].GetAttachments() {
+			msg.Attachments = append(msg.Attachments, types.Attachment{
+				Type:     att.Type,
+				Ref:      att.Ref,
+				MimeType: att.MimeType,
+			})
+		}
+		dialogue = append(dialogue, msg)
 	}
+	return dialogue
+}
 
-	s.logger.Info("保存聊天记忆成功 %v", map[string]interface{}{
-		"session_id":  sessionID,
-		"memory_type": memoryType,
-		"importance":  importance,
-		"tags":        tags,
-	})
-
-	return nil
+// SaveMemory 保存聊天记忆
+func (s *ChatMemoryService) SaveMemory(userID *uint, deviceID uint, sessionID, memoryType, content string, importance int, tags []string) error {
+	return s.store.SaveMemory(userID, deviceID, sessionID, memoryType, content, importance, tags)
 }
 
 // QueryMemory 查询相关记忆
 func (s *ChatMemoryService) QueryMemory(userID *uint, deviceID uint, query string, limit int) (string, error) {
-	if limit <= 0 {
-		limit = 5 // 默认返回5条最相关的记忆
-	}
-
-	// 构建查询条件
-	var memories []ChatMemory
-	dbQuery := s.db.Where("is_active = ?", true)
-
-	// 按用户和设备过滤
-	if userID != nil {
-		dbQuery = dbQuery.Where("(user_id = ? OR user_id IS NULL) AND device_id = ?", *userID, deviceID)
-	} else {
-		dbQuery = dbQuery.Where("device_id = ?", deviceID)
-	}
-
-	// 按重要性排序，优先返回重要的记忆
-	dbQuery = dbQuery.Order("importance DESC, last_used DESC, use_count DESC").Limit(limit)
-
-	if err := dbQuery.Find(&memories).Error; err != nil {
-		return "", fmt.Errorf("查询记忆失败: %v", err)
-	}
-
-	if len(memories) == 0 {
-		return "", nil
-	}
-
-	// 构建记忆摘要
-	var memoryParts []string
-	for _, memory := range memories {
-		memoryParts = append(memoryParts, fmt.Sprintf("[%s] %s", memory.MemoryType, memory.Content))
-
-		// 更新使用统计
-		s.db.Model(&memory).Updates(map[string]interface{}{
-			"use_count": gorm.Expr("use_count + 1"),
-			"last_used": time.Now(),
-		})
-	}
-
-	memorySummary := strings.Join(memoryParts, "\n")
-
-	s.logger.Debug("查询到相关记忆 %v", map[string]interface{}{
-		"query":        query,
-		"memory_count": len(memories),
-		"user_id":      userID,
-		"device_id":    deviceID,
-	})
-
-	return memorySummary, nil
+	return s.store.QueryMemory(userID, deviceID, query, limit)
 }
 
-// GenerateMemoryFromDialogue 从对话历史生成记忆
-func (s *ChatMemoryService) GenerateMemoryFromDialogue(ctx context.Context, userID *uint, deviceID uint, sessionID string, dialogue []chat.Message) error {
-	if len(dialogue) == 0 {
-		return nil
-	}
-
-	// 生成会话摘要
-	summary := s.generateSummary(dialogue)
-	if summary != "" {
-		if err := s.SaveMemory(userID, deviceID, sessionID, "summary", summary, 8, []string{"auto_generated"}); err != nil {
-			s.logger.Warn("保存会话摘要失败: %v", err)
-		}
-	}
-
-	// 提取关键信息
-	keyPoints := s.extractKeyPoints(dialogue)
-	if len(keyPoints) > 0 {
-		for _, point := range keyPoints {
-			if err := s.SaveMemory(userID, deviceID, sessionID, "key_points", point, 6, []string{"auto_generated"}); err != nil {
-				s.logger.Warn("保存关键信息失败: %v", err)
-			}
-		}
-	}
-
-	// 保存重要对话片段
-	importantConversations := s.extractImportantConversations(dialogue)
-	for _, conv := range importantConversations {
-		if err := s.SaveMemory(userID, deviceID, sessionID, "conversation", conv, 5, []string{"auto_generated"}); err != nil {
-			s.logger.Warn("保存重要对话失败: %v", err)
-		}
-	}
-
-	return nil
+// ListActiveMemories 按重要性列出用户/设备的有效记忆（不更新使用统计）
+func (s *ChatMemoryService) ListActiveMemories(userID *uint, deviceID uint, limit int) ([]ChatMemory, error) {
+	return s.store.ListActiveMemories(userID, deviceID, limit)
 }
 
-// generateSummary 生成对话摘要
-func (s *ChatMemoryService) generateSummary(dialogue []chat.Message) string {
-	if len(dialogue) < 4 {
-		return ""
-	}
-
-	// 简单的摘要生成逻辑
-	var userMessages []string
-	var assistantMessages []string
-
-	for _, msg := range dialogue {
-		if msg.Role == "user" {
-			userMessages = append(userMessages, msg.Content)
-		} else if msg.Role == "assistant" {
-			assistantMessages = append(assistantMessages, msg.Content)
-		}
-	}
-
-	if len(userMessages) == 0 || len(assistantMessages) == 0 {
-		return ""
-	}
-
-	// 提取用户的主要问题或需求
-	mainTopic := s.extractMainTopic(userMessages)
-	if mainTopic == "" {
-		return ""
-	}
-
-	return fmt.Sprintf("用户询问了关于%s的问题，进行了%d轮对话", mainTopic, len(userMessages))
+// ClearMemory 清空指定会话的记忆
+func (s *ChatMemoryService) ClearMemory(sessionID string) error {
+	return s.store.ClearMemory(sessionID)
 }
 
-// extractMainTopic 提取主要话题
-func (s *ChatMemoryService) extractMainTopic(messages []string) string {
-	if len(messages) == 0 {
-		return ""
-	}
-
-	// 简单的关键词提取
-	keywords := []string{"天气", "时间", "计算", "翻译", "编程", "代码", "文件", "图片", "音乐", "新闻"}
-
-	for _, msg := range messages {
-		for _, keyword := range keywords {
-			if strings.Contains(msg, keyword) {
-				return keyword
+// ForgetMemories 删除设备的全部记忆和待重试记忆，userID不为空时同时删除该用户在其他设备上的记忆，返回删除的记忆数。
+// 直接删除 chat_memories 表中的记录（不可恢复），用于用户要求助手忘记自己
+func (s *ChatMemoryService) ForgetMemories(userID *uint, deviceID uint) (int64, error) {
+	var forgotten int64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		scope := func() *gorm.DB {
+			if userID != nil {
+				return tx.Unscoped().Where("device_id = ? OR user_id = ?", deviceID, *userID)
 			}
+			return tx.Unscoped().Where("device_id = ?", deviceID)
 		}
-	}
-
-	// 如果没有找到预定义关键词，返回第一个消息的前20个字符
-	if len(messages[0]) > 20 {
-		return messages[0][:20] + "..."
-	}
-	return messages[0]
-}
-
-// extractKeyPoints 提取关键信息
-func (s *ChatMemoryService) extractKeyPoints(dialogue []chat.Message) []string {
-	var keyPoints []string
-
-	for _, msg := range dialogue {
-		if msg.Role == "user" {
-			// 提取用户的重要信息
-			if strings.Contains(msg.Content, "我叫") || strings.Contains(msg.Content, "我的名字是") {
-				keyPoints = append(keyPoints, "用户姓名信息: "+msg.Content)
-			}
-			if strings.Contains(msg.Content, "我喜欢") || strings.Contains(msg.Content, "我讨厌") {
-				keyPoints = append(keyPoints, "用户偏好: "+msg.Content)
-			}
+		res := scope().Delete(&ChatMemory{})
+		if res.Error != nil {
+			return fmt.Errorf("删除记忆失败: %v", res.Error)
 		}
-	}
-
-	return keyPoints
-}
-
-// extractImportantConversations 提取重要对话片段
-func (s *ChatMemoryService) extractImportantConversations(dialogue []chat.Message) []string {
-	var conversations []string
-
-	// 提取包含重要信息的对话片段
-	for i := 0; i < len(dialogue)-1; i++ {
-		if dialogue[i].Role == "user" && i+1 < len(dialogue) && dialogue[i+1].Role == "assistant" {
-			userMsg := dialogue[i].Content
-			assistantMsg := dialogue[i+1].Content
-
-			// 判断是否为重要对话
-			if len(userMsg) > 20 && len(assistantMsg) > 30 {
-				conversation := fmt.Sprintf("用户: %s\n助手: %s", userMsg, assistantMsg)
-				conversations = append(conversations, conversation)
-			}
+		forgotten = res.RowsAffected
+		if err := scope().Delete(&PendingMemory{}).Error; err != nil {
+			return fmt.Errorf("删除待重试记忆失败: %v", err)
 		}
-	}
-
-	return conversations
-}
-
-// ClearMemory 清空指定会话的记忆
-func (s *ChatMemoryService) ClearMemory(sessionID string) error {
-	if err := s.db.Where("session_id = ?", sessionID).Delete(&ChatMemory{}).Error; err != nil {
-		return fmt.Errorf("清空记忆失败: %v", err)
-	}
-
-	s.logger.Info("清空会话记忆成功 %v", map[string]interface{}{
-		"session_id": sessionID,
+		return nil
 	})
-
-	return nil
+	if err != nil {
+		return 0, err
+	}
+	return forgotten, nil
 }
 
-// GetMemoryStats 获取记忆统计信息
+// GetMemoryStats 获取记忆统计信息，附带待重试和已放弃重试的记忆数量，以及设备记忆数与上限
 func (s *ChatMemoryService) GetMemoryStats(userID *uint, deviceID uint) (map[string]interface{}, error) {
-	var stats map[string]interface{}
-
-	// 统计不同类型的记忆数量
-	var typeStats []struct {
-		MemoryType string `json:"memory_type"`
-		Count      int    `json:"count"`
-	}
-
-	query := s.db.Model(&ChatMemory{}).Where("is_active = ?", true)
-	if userID != nil {
-		query = query.Where("(user_id = ? OR user_id IS NULL) AND device_id = ?", *userID, deviceID)
-	} else {
-		query = query.Where("device_id = ?", deviceID)
+	stats, err := s.store.GetMemoryStats(userID, deviceID)
+	if err != nil {
+		return nil, err
 	}
-
-	if err := query.Select("memory_type, count(*) as count").Group("memory_type").Find(&typeStats).Error; err != nil {
-		return nil, fmt.Errorf("获取记忆统计失败: %v", err)
+	if stats == nil {
+		stats = make(map[string]interface{})
 	}
+	stats["pending_count"], stats["failed_count"] = s.pendingMemoryCounts(userID, deviceID)
+	stats["device_count"] = s.deviceMemoryCount(deviceID)
+	stats["memory_cap"] = s.capacity.maxPerDevice
+	stats["pin_importance"] = s.capacity.pinImportance
+	return stats, nil
+}
 
-	stats = make(map[string]interface{})
-	stats["type_stats"] = typeStats
-
-	// 统计总记忆数
-	var totalCount int64
-	if err := query.Count(&totalCount).Error; err != nil {
-		return nil, fmt.Errorf("统计总记忆数失败: %v", err)
+// SetEmbedder 设置记忆向量化提供者，当前存储不支持向量检索时忽略
+func (s *ChatMemoryService) SetEmbedder(embedder Embedder) {
+	if store, ok := s.store.(EmbeddingMemoryStore); ok {
+		store.SetEmbedder(embedder)
 	}
-	stats["total_count"] = totalCount
+}
 
-	return stats, nil
+// HasEmbedder 当前存储是否已配置向量化提供者
+func (s *ChatMemoryService) HasEmbedder() bool {
+	store, ok := s.store.(EmbeddingMemoryStore)
+	return ok && store.HasEmbedder()
 }
@@ -68,6 +68,7 @@ func (s *ConfigService) SetGlobalConfig(key, value, configType, description stri
 		}
 	}
 
+	InvalidateAllCapabilityCache()
 	s.logger.Info("全局配置设置成功: %s", key)
 	return nil
 }
@@ -117,6 +118,7 @@ func (s *ConfigService) DeleteGlobalConfig(key string) error {
 		return fmt.Errorf("删除全局配置失败: %v", err)
 	}
 
+	InvalidateAllCapabilityCache()
 	s.logger.Info("全局配置删除成功: %s", key)
 	return nil
 }
@@ -139,6 +141,7 @@ func (s *ConfigService) CreateAICapability(capability *AICapability) error {
 		return fmt.Errorf("创建AI能力失败: %v", err)
 	}
 
+	InvalidateAllCapabilityCache()
 	s.logger.Info("AI能力创建成功: %s/%s", capability.CapabilityName, capability.CapabilityType)
 	return nil
 }
@@ -149,6 +152,7 @@ func (s *ConfigService) UpdateAICapability(capability *AICapability) error {
 		return fmt.Errorf("更新AI能力失败: %v", err)
 	}
 
+	InvalidateAllCapabilityCache()
 	s.logger.Info("AI能力更新成功: %s/%s", capability.CapabilityName, capability.CapabilityType)
 	return nil
 }
@@ -159,6 +163,7 @@ func (s *ConfigService) DeleteAICapability(id uint) error {
 		return fmt.Errorf("删除AI能力失败: %v", err)
 	}
 
+	InvalidateAllCapabilityCache()
 	s.logger.Info("AI能力删除成功: ID %d", id)
 	return nil
 }
@@ -190,7 +195,16 @@ func (s *ConfigService) GetProviderConfig(id uint) (*ProviderConfig, error) {
 
 // CreateProviderConfig 创建提供商配置
 func (s *ConfigService) CreateProviderConfig(config *ProviderConfig) error {
-	if err := s.db.DB.Create(config).Error; err != nil {
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(config).Error; err != nil {
+			return err
+		}
+		if !config.IsDefault {
+			return nil
+		}
+		_, err := clearOtherDefaults(tx, config.Category, config.ID)
+		return err
+	}); err != nil {
 		return fmt.Errorf("创建提供商配置失败: %v", err)
 	}
 
@@ -200,7 +214,9 @@ func (s *ConfigService) CreateProviderConfig(config *ProviderConfig) error {
 
 // UpdateProviderConfig 更新提供商配置
 func (s *ConfigService) UpdateProviderConfig(config *ProviderConfig) error {
-	if err := s.db.DB.Save(config).Error; err != nil {
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		return saveProviderConfig(tx, config)
+	}); err != nil {
 		return fmt.Errorf("更新提供商配置失败: %v", err)
 	}
 
@@ -242,16 +258,24 @@ func (s *ConfigService) GetProviderConfigsByCategory(category string) ([]*Provid
 	return configs, nil
 }
 
-// GetDefaultProviderConfig 获取默认提供商配置
+// GetDefaultProviderConfig 获取默认提供商配置（存在多个默认配置时取权重最高的）
 func (s *ConfigService) GetDefaultProviderConfig(category string) (*ProviderConfig, error) {
 	var config ProviderConfig
-	if err := s.db.DB.Where("category = ? AND is_default = ? AND is_active = ?", category, true, true).
-		First(&config).Error; err != nil {
+	if err := s.db.WithRetry(func() error {
+		return s.db.DB.Where("category = ? AND is_default = ? AND is_active = ?", category, true, true).
+			Order(defaultProviderOrder).
+			First(&config).Error
+	}); err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, nil
 		}
+		if cached, ok := lastKnownProvider(category, ""); ok && IsUnavailableError(err) {
+			s.logger.Debug("数据库不可用，使用最近一次读取的默认提供商配置: %s", category)
+			return cached, nil
+		}
 		return nil, fmt.Errorf("查询默认提供商配置失败: %v", err)
 	}
+	rememberProvider(category, "", &config)
 	return &config, nil
 }
 
@@ -282,33 +306,72 @@ func (s *ConfigService) GetProviderVersions(category, name string) ([]*ProviderV
 	return versions, nil
 }
 
-// GetDefaultProviderModules 获取默认提供商模块
+// GetDefaultProviderModules 获取默认提供商模块。默认provider仍是占位符配置时，
+// 改用该类别中权重最高的已配置provider；没有可替代的provider时保留默认并输出警告
 func (s *ConfigService) GetDefaultProviderModules() (map[string]string, error) {
 	var configs []*ProviderConfig
 	if err := s.db.DB.Where("is_default = ? AND is_active = ?", true, true).
-		Select("category, name").
+		Order(defaultProviderOrder).
 		Find(&configs).Error; err != nil {
 		return nil, fmt.Errorf("查询默认提供商模块失败: %v", err)
 	}
 
 	modules := make(map[string]string)
 	for _, config := range configs {
+		// 同类别存在多个默认配置时只取权重最高的一个
+		if _, exists := modules[config.Category]; exists {
+			continue
+		}
 		modules[config.Category] = config.Name
+		if IsProviderConfigured(config) {
+			continue
+		}
+		fallback, err := s.GetHighestWeightProvider(config.Category)
+		if err != nil || fallback == nil {
+			s.logger.Warn("默认%s provider %s 尚未配置，且没有其他已配置的%s provider，该类别服务将不可用",
+				config.Category, config.Name, config.Category)
+			continue
+		}
+		s.logger.Warn("默认%s provider %s 尚未配置，改用 %s", config.Category, config.Name, fallback.Name)
+		modules[config.Category] = fallback.Name
 	}
 
 	return modules, nil
 }
 
+// GetHighestWeightProvider 获取类别中权重最高的已配置启用提供商配置（权重相同时取最早创建的），没有时返回nil
+func (s *ConfigService) GetHighestWeightProvider(category string) (*ProviderConfig, error) {
+	var configs []*ProviderConfig
+	if err := s.db.DB.Where("category = ? AND is_active = ?", category, true).
+		Order("weight DESC, id ASC").
+		Find(&configs).Error; err != nil {
+		return nil, fmt.Errorf("查询提供商配置失败: %v", err)
+	}
+	for _, config := range configs {
+		if IsProviderConfigured(config) {
+			return config, nil
+		}
+	}
+	return nil, nil
+}
+
 // GetProviderConfigByCategoryAndName 根据类别和名称获取提供商配置
 func (s *ConfigService) GetProviderConfigByCategoryAndName(category, name string) (*ProviderConfig, error) {
 	var config ProviderConfig
-	if err := s.db.DB.Where("category = ? AND name = ? AND is_active = ?", category, name, true).
-		First(&config).Error; err != nil {
+	if err := s.db.WithRetry(func() error {
+		return s.db.DB.Where("category = ? AND name = ? AND is_active = ?", category, name, true).
+			First(&config).Error
+	}); err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, nil
 		}
+		if cached, ok := lastKnownProvider(category, name); ok && IsUnavailableError(err) {
+			s.logger.Debug("数据库不可用，使用最近一次读取的提供商配置: %s/%s", category, name)
+			return cached, nil
+		}
 		return nil, fmt.Errorf("查询提供商配置失败: %v", err)
 	}
+	rememberProvider(category, name, &config)
 	return &config, nil
 }
 
@@ -328,10 +391,16 @@ func (s *ConfigService) GetProviderConfigByCategoryAndType(category, providerTyp
 // GetSystemConfig 获取系统配置
 func (s *ConfigService) GetSystemConfig(category, key string) (*SystemConfig, error) {
 	var config SystemConfig
-	if err := s.db.DB.Where("config_category = ? AND config_key = ?", category, key).First(&config).Error; err != nil {
+	if err := s.db.WithRetry(func() error {
+		return s.db.DB.Where("config_category = ? AND config_key = ?", category, key).First(&config).Error
+	}); err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, nil
 		}
+		if cached, ok := lastKnownSystemConfig(category, key); ok && IsUnavailableError(err) {
+			s.logger.Debug("数据库不可用，使用最近一次读取的系统配置: %s/%s", category, key)
+			return cached, nil
+		}
 		return nil, fmt.Errorf("查询系统配置失败: %v", err)
 	}
 	return &config, nil
@@ -368,19 +437,28 @@ func (s *ConfigService) SetSystemConfig(category, key, value, configType, descri
 	}
 
 	s.logger.Info("系统配置设置成功: %s/%s", category, key)
+	s.onSystemConfigChanged(category)
 	return nil
 }
 
 // ListSystemConfigs 获取系统配置列表
 func (s *ConfigService) ListSystemConfigs(category string) ([]*SystemConfig, error) {
 	var configs []*SystemConfig
-	query := s.db.DB
-	if category != "" {
-		query = query.Where("config_category = ?", category)
-	}
-	if err := query.Find(&configs).Error; err != nil {
+	if err := s.db.WithRetry(func() error {
+		query := s.db.DB
+		if category != "" {
+			query = query.Where("config_category = ?", category)
+		}
+		configs = nil
+		return query.Find(&configs).Error
+	}); err != nil {
+		if cached, ok := lastKnownSystemConfigs(category); ok && IsUnavailableError(err) {
+			s.logger.Debug("数据库不可用，使用最近一次读取的系统配置: %s", category)
+			return cached, nil
+		}
 		return nil, fmt.Errorf("查询系统配置列表失败: %v", err)
 	}
+	rememberSystemConfigs(configs)
 	return configs, nil
 }
 
@@ -391,11 +469,15 @@ func (s *ConfigService) DeleteSystemConfig(category, key string) error {
 	}
 
 	s.logger.Info("系统配置删除成功: %s/%s", category, key)
+	s.onSystemConfigChanged(category)
 	return nil
 }
 
-// GetSystemConfigValue 获取系统配置值
+// GetSystemConfigValue 获取系统配置值，设置了对应的环境变量时优先使用环境变量
 func (s *ConfigService) GetSystemConfigValue(category, key string) (string, error) {
+	if value, ok := lookupSystemConfigEnv(category, key); ok {
+		return value, nil
+	}
 	config, err := s.GetSystemConfig(category, key)
 	if err != nil {
 		return "", err
@@ -479,6 +561,7 @@ func (s *ConfigService) InitializeDefaultSystemConfigs() error {
 		{"audio", "delete_audio", "true", "bool", "是否删除音频文件"},
 		{"audio", "quick_reply", "true", "bool", "是否启用快速回复"},
 		{"audio", "quick_reply_words", "[\"我在\", \"在呢\", \"来了\", \"啥事啊\"]", "array", "快速回复词汇"},
+		{"audio", "resample_quality", "medium", "string", "上行音频重采样质量：fast（线性插值）、medium、high（加窗sinc）"},
 
 		// AI提供商默认配置
 		{"ai_providers", "default_asr", "DoubaoASR", "string", "默认ASR提供商"},
@@ -494,6 +577,292 @@ func (s *ConfigService) InitializeDefaultSystemConfigs() error {
 		{"connectivity", "asr_test_audio", "", "string", "ASR测试音频文件"},
 		{"connectivity", "llm_test_prompt", "Hello", "string", "LLM测试提示词"},
 		{"connectivity", "tts_test_text", "测试", "string", "TTS测试文本"},
+
+		// 播放期间打断检测配置（设备可在vad能力配置的barge_in字段中覆盖）
+		{"barge_in", "enabled", "false", "bool", "是否启用播放期间语音打断"},
+		{"barge_in", "energy_threshold", "0.05", "float", "打断能量阈值（归一化RMS，0-1）"},
+		{"barge_in", "probability_threshold", "0.6", "float", "打断VAD语音概率阈值（0-1）"},
+		{"barge_in", "min_speech_ms", "300", "int", "触发打断的最短连续语音时长（毫秒）"},
+		{"barge_in", "echo_guard_ms", "300", "int", "播放开始后的回声保护期（毫秒）"},
+		{"barge_in", "echo_margin", "2.0", "float", "语音能量需高于回声基线的倍数"},
+
+		// 功能开关（值为JSON：enabled、rollout_percent、allow_devices）
+		{"feature_flags", "barge_in", `{"enabled":true,"rollout_percent":100,"allow_devices":[]}`, "json", "播放期间语音打断的灰度开关，与barge_in.enabled同时开启才生效"},
+
+		// LLM回复内容审核配置（设备/用户可通过moderation能力配置覆盖）
+		{"moderation", "enabled", "false", "bool", "是否启用LLM回复内容审核"},
+		{"moderation", "provider", "rules", "string", "审核提供者（rules/openai）"},
+		{"moderation", "threshold", "0.8", "float", "拦截阈值（0-1）"},
+		{"moderation", "block", "false", "bool", "超过阈值时是否拦截下发"},
+		{"moderation", "strict", "false", "bool", "严格模式：审核服务失败时拦截"},
+		{"moderation", "blocked_message", "抱歉，这个问题我不方便回答，我们聊点别的吧", "string", "拦截后播报的提示语"},
+		{"moderation", "keywords", "[]", "array", "rules审核使用的敏感词"},
+
+		// 图片内容审核配置（用户/设备可通过image_moderation能力覆盖）
+		{"image_moderation", "enabled", "false", "bool", "是否在图片发送给视觉模型和保存之前进行内容审核"},
+		{"image_moderation", "provider", "rules", "string", "审核提供者（rules/http）"},
+		{"image_moderation", "threshold", "0.8", "float", "判定阈值（0-1）"},
+		{"image_moderation", "action", "reject", "string", "超过阈值时的处理（reject/blur）"},
+		{"image_moderation", "strict", "false", "bool", "严格模式：审核服务失败时拒绝图片"},
+		{"image_moderation", "rejected_message", "抱歉，这张图片不适合分析，请换一张试试", "string", "图片被拒绝后播报的提示语"},
+		{"image_moderation", "blocked_hashes", "[]", "array", "rules审核使用的图片SHA256黑名单"},
+		{"image_moderation", "endpoint", "", "string", "http分类服务地址"},
+		{"image_moderation", "timeout_ms", "3000", "int", "http分类服务超时（毫秒）"},
+
+		// LLM回复缓存配置（用户/设备可通过llm_cache能力开启和覆盖）
+		{"llm_cache", "enabled", "false", "bool", "是否启用LLM回复缓存"},
+		{"llm_cache", "ttl_seconds", "3600", "int", "缓存有效期（秒）"},
+		{"llm_cache", "max_entries", "1000", "int", "最大缓存条数（所有连接共享）"},
+		{"llm_cache", "bypass_patterns", "[\"几点|时间|今天|明天|昨天|几号|日期|星期|周几|天气|气温|最新|新闻|记得|上次|刚才\"]", "array", "用户问题匹配任一正则时不使用缓存"},
+
+		// ASR纠错配置（设备可在asr能力配置的correction字段中覆盖）
+		{"asr_correction", "enabled", "false", "bool", "是否启用ASR上下文纠错"},
+		{"asr_correction", "mode", "hotwords", "string", "纠错方式（hotwords/llm/both）"},
+		{"asr_correction", "sources", "[\"memory\", \"device\", \"recent_turns\", \"custom\"]", "array", "词表来源"},
+		{"asr_correction", "terms", "[]", "array", "自定义词表（custom来源）"},
+		{"asr_correction", "max_terms", "50", "int", "词表最大词数"},
+		{"asr_correction", "recent_turns", "6", "int", "参考的最近对话消息数"},
+		{"asr_correction", "timeout_ms", "1500", "int", "LLM纠错超时（毫秒）"},
+
+		// ASR置信度检查配置（设备可在asr能力配置的confidence字段中覆盖）
+		{"asr_confidence", "enabled", "false", "bool", "是否启用ASR置信度检查，低置信度时要求用户重说"},
+		{"asr_confidence", "threshold", "0.5", "float", "置信度阈值（0-1），仅对返回置信度的ASR生效"},
+		{"asr_confidence", "min_chars", "1", "int", "ASR不返回置信度时，识别结果的最少有效字数"},
+		{"asr_confidence", "reprompt_text", "抱歉，我没有听清，请再说一遍", "string", "低置信度时播报的重说提示"},
+
+		// ASR热词配置（设备可在asr能力配置的hotwords/hotwords_from_memory字段中补充）
+		{"asr_hotwords", "words", "[]", "array", "下发给ASR的静态热词（产品名、联系人等）"},
+		{"asr_hotwords", "from_memory", "false", "bool", "是否加入用户记忆中的词汇"},
+
+		// 设备遥测/错误上报配置
+		{"telemetry", "persist", "true", "bool", "是否持久化设备上报的事件"},
+		{"telemetry", "persist_level", "warn", "string", "持久化的最低事件级别（info/warn/error）"},
+
+		// 列表接口分页配置
+		{"pagination", "default_limit", "20", "int", "列表接口默认每页条数"},
+		{"pagination", "max_limit", "100", "int", "列表接口每页最大条数"},
+
+		// TTS降级配置（修改后重启生效）
+		{"tts_fallback", "enabled", "true", "bool", "主TTS合成失败时是否切换到其他TTS提供者"},
+		{"tts_fallback", "providers", "[]", "array", "备用TTS提供者名称（按顺序），为空时按权重使用其他启用的TTS"},
+		{"tts_fallback", "cooldown_seconds", "60", "int", "主TTS失败后直接使用备用TTS的时长（秒）"},
+
+		// 批量音频转写配置
+		{"asr_transcribe", "max_file_mb", "10", "int", "转写接口上传文件大小上限（MB）"},
+		{"asr_transcribe", "timeout_seconds", "60", "int", "单次转写超时（秒）"},
+		{"asr_transcribe", "max_duration_seconds", "600", "int", "上传音频的时长上限（秒），解码前按文件头检查"},
+
+		// 灰度版本健康检查配置（修改后重启生效）
+		{"grayscale", "health_check_interval_seconds", "30", "int", "灰度版本健康检查间隔（秒）"},
+		{"grayscale", "health_check_concurrency", "4", "int", "健康检查并发探测数"},
+		{"grayscale", "auto_rollback_enabled", "false", "bool", "非默认版本错误率过高时是否自动回滚"},
+		{"grayscale", "auto_rollback_error_rate", "0.2", "float", "触发自动回滚的错误率阈值（0-1）"},
+		{"grayscale", "auto_rollback_window_seconds", "300", "int", "错误率统计窗口（秒）"},
+		{"grayscale", "auto_rollback_min_requests", "20", "int", "窗口内最少请求数，样本不足时不回滚"},
+		{"grayscale", "auto_rollback_check_seconds", "30", "int", "自动回滚检查间隔（秒）"},
+		{"grayscale", "alert_webhook_url", "", "string", "自动回滚告警webhook地址，为空时不发送"},
+		{"grayscale", "max_weight", "100", "int", "版本权重上限，加载时权重限制在[0,上限]"},
+		{"grayscale", "strategies", "{}", "json", "按provider选择版本的策略（键为 类别/名称 或 类别，值为 weight、round_robin、health、cost、latency）"},
+		{"grayscale", "selection_window_seconds", "600", "int", "latency策略统计耗时的窗口（秒）"},
+		{"grayscale", "selection_min_samples", "5", "int", "latency策略每个版本至少需要的耗时样本数，不足时按权重选择"},
+
+		// 会话恢复配置
+		{"session_resume", "enabled", "true", "bool", "设备重连时是否恢复原会话的对话上下文"},
+		{"session_resume", "window_seconds", "300", "int", "未指定会话ID时，自动恢复多久内有消息的会话（秒）"},
+		{"session_resume", "max_messages", "40", "int", "直接恢复的原始消息最大条数，超过时恢复摘要"},
+		{"session_resume", "recent_messages", "6", "int", "恢复摘要时附带的最近原始消息条数"},
+
+		// LLM工具过滤配置（设备可在tools能力中覆盖）
+		{"tools", "allow", "[]", "array", "提供给LLM的工具白名单，为空表示全部"},
+		{"tools", "deny", "[]", "array", "禁止提供给LLM的工具"},
+
+		// 语音合成接口配置
+		{"tts_synthesize", "max_text_length", "500", "int", "语音合成接口单次最大文本长度（字符）"},
+
+		// 主动对话配置（设备可在proactive能力中覆盖）
+		{"proactive", "enabled", "false", "bool", "是否在设备空闲时主动发起对话"},
+		{"proactive", "idle_seconds", "600", "int", "空闲多久后主动发起（秒）"},
+		{"proactive", "max_per_session", "3", "int", "单个会话最多主动发起次数（0表示不限制）"},
+		{"proactive", "quiet_hours_start", "22:00", "string", "免打扰开始时间（HH:MM，设备时区）"},
+		{"proactive", "quiet_hours_end", "08:00", "string", "免打扰结束时间（HH:MM，设备时区）"},
+		{"proactive", "timezone", "Asia/Shanghai", "string", "默认设备时区（IANA名称）"},
+
+		// 播放提示配置（设备可在playback能力中覆盖）
+		{"playback", "enabled", "false", "bool", "是否在tts消息中下发播放提示（音量、淡入淡出）"},
+		{"playback", "volume", "80", "int", "正常播放音量（0-100）"},
+		{"playback", "fade_in_ms", "0", "int", "淡入时长（毫秒）"},
+		{"playback", "fade_out_ms", "0", "int", "淡出时长（毫秒）"},
+		{"playback", "quiet_hours_start", "22:00", "string", "降低音量的开始时间（HH:MM，设备时区）"},
+		{"playback", "quiet_hours_end", "07:00", "string", "降低音量的结束时间（HH:MM，设备时区）"},
+		{"playback", "quiet_volume", "30", "int", "免打扰时段的播放音量（0-100）"},
+		{"playback", "timezone", "Asia/Shanghai", "string", "默认设备时区（IANA名称）"},
+
+		// 提示音配置（设备可在earcon能力中覆盖）
+		{"earcon", "enabled", "false", "bool", "助手开口前是否播放提示音"},
+		{"earcon", "mode", "audio", "string", "提示音方式：audio（服务端拼接音频）或 message（设备播放内置提示音）"},
+		{"earcon", "file", "", "string", "audio 模式的提示音文件路径（wav/mp3）"},
+		{"earcon", "name", "default", "string", "message 模式下发给设备的提示音名称"},
+
+		// 音频确认配置（设备可在audio_ack能力中覆盖，设备hello声明支持ack后生效）
+		{"audio_ack", "enabled", "false", "bool", "是否对声明支持ack的设备启用音频帧序号和确认"},
+		{"audio_ack", "window", "20", "int", "最多允许未确认的音频帧数"},
+		{"audio_ack", "timeout_ms", "1000", "int", "窗口已满时等待确认的超时时间（毫秒）"},
+		{"audio_ack", "on_timeout", "resend", "string", "确认超时的处理方式：resend（重发未确认帧）或 abort（中止本轮播放）"},
+		{"audio_ack", "max_resends", "2", "int", "每次等待最多重发的次数，超过后中止播放"},
+
+		// 流式文本配置（设备可在text_stream能力中覆盖，设备hello声明支持text_stream后生效）
+		{"text_stream", "enabled", "true", "bool", "是否对声明支持的设备下发LLM流式文本"},
+		{"text_stream", "min_chars", "1", "int", "累计达到该字数再下发一条delta"},
+
+		// 回环测试配置（设备可在loopback能力中覆盖，enabled=true时该设备连接直接进入回环模式）
+		{"loopback", "allow_handshake", "true", "bool", "是否允许设备在hello中声明进入回环测试模式"},
+		{"loopback", "mode", "echo", "string", "默认回环模式：echo（原样回放）或 tts（识别后朗读）"},
+		{"loopback", "max_seconds", "10", "int", "echo 模式单次录音的最长秒数"},
+		{"loopback", "silence_ms", "800", "int", "echo 模式自动拾音时，说话后静音多久结束录音（毫秒）"},
+		{"loopback", "energy_threshold", "0.02", "float", "判断为说话的归一化RMS能量阈值（0-1）"},
+
+		// 流水线超时配置（设备可在pipeline_timeout能力中覆盖，0表示不限制）
+		{"pipeline_timeout", "asr_ms", "8000", "int", "说话结束后等待识别结果的最长时间（毫秒）"},
+		{"pipeline_timeout", "llm_first_token_ms", "15000", "int", "等待LLM首个输出的最长时间（毫秒）"},
+		{"pipeline_timeout", "tts_first_byte_ms", "10000", "int", "等待首句语音合成的最长时间（毫秒）"},
+		{"pipeline_timeout", "apology", "抱歉，我这边反应有点慢，请再说一遍吧", "string", "阶段超时后播报的致歉语"},
+
+		// 上传图片存储配置（设备可在image_storage能力中设置enabled=false关闭）
+		{"image_storage", "enabled", "true", "bool", "是否保存设备上传的图片并在对话历史中引用，关闭后图片只用于当前对话"},
+		{"image_storage", "retention_hours", "168", "int", "图片保留时长（小时），过期后由后台任务删除，0表示不过期"},
+
+		// 对话模式配置（设备可在conversation_mode能力中覆盖可用模式）
+		{"conversation_mode", "default", "assistant", "string", "新会话的默认对话模式：assistant/translator/dictation"},
+		{"conversation_mode", "available", `["assistant","translator","dictation"]`, "array", "设备可切换的对话模式，assistant始终可用"},
+		{"conversation_mode", "source_language", "中文", "string", "翻译模式的源语言"},
+		{"conversation_mode", "target_language", "英文", "string", "翻译模式的目标语言"},
+		{"conversation_mode", "translator_prompt", "你是一名同声传译。用户说{source}时翻译成{target}，说{target}时翻译成{source}。只输出译文，不要解释，不要回答问题内容。", "string", "翻译模式的提示词，{source}/{target}替换为源语言和目标语言"},
+
+		// 安全配置
+		{"security", "bcrypt_cost", "10", "int", "新密码哈希使用的bcrypt cost（4-31），已有的低cost哈希在用户下次登录成功时自动升级"},
+
+		// 调试音频采集配置（开关只取设备专属的audio_capture能力配置）
+		{"audio_capture", "retention_minutes", "30", "int", "采集音频的保留时长（分钟），最长1440"},
+		{"audio_capture", "max_seconds", "30", "int", "单段采集音频的最长秒数，超出时只保留末尾"},
+
+		// 隐私配置
+		{"privacy", "disable_audio_retention", "false", "bool", "全局禁止保留设备音频：开启后不再采集调试音频，并删除已采集的音频"},
+
+		// provider失败提示语配置（设备可在failure_speech能力中覆盖）
+		{"failure_speech", "enabled", "true", "bool", "ASR/LLM/TTS失败时是否向设备播报提示语"},
+		{"failure_speech", "prewarm", "true", "bool", "连接建立时是否用当前TTS预先合成提示语并缓存"},
+		{"failure_speech", "asr", "抱歉，我没有听清，请再说一遍", "string", "语音识别失败时的提示语"},
+		{"failure_speech", "llm", "抱歉，我现在无法回答", "string", "生成回复失败时的提示语"},
+		{"failure_speech", "tts", "抱歉，我现在无法回答", "string", "语音合成失败时的提示语"},
+		{"failure_speech", "asr_file", "", "string", "语音识别失败提示语的预录音频路径（wav/mp3），为空时使用预合成缓存"},
+		{"failure_speech", "llm_file", "", "string", "生成回复失败提示语的预录音频路径"},
+		{"failure_speech", "tts_file", "", "string", "语音合成失败提示语的预录音频路径"},
+
+		// 设备指令路由配置（设备可在intent_routing能力中替换指令表）
+		{"intent_routing", "enabled", "false", "bool", "是否在调用LLM之前按关键词/正则把识别结果路由为设备指令"},
+		{"intent_routing", "max_chars", "20", "int", "超过该字数的句子不做指令匹配，0表示不限制"},
+		{"intent_routing", "intents", "[]", "json", "设备指令规则列表（name/keywords/patterns/device/method/parameters/reply）"},
+
+		// 输出音频质量配置（设备可在audio_quality能力中覆盖）
+		{"audio_quality", "profile", "standard", "string", "下发音频的质量档位：low（节省流量）、standard、high"},
+		{"audio_quality", "opus_bitrate", "0", "int", "Opus码率（bps，6000-510000），0表示使用档位默认值"},
+		{"audio_quality", "opus_complexity", "0", "int", "Opus编码复杂度（1-10），0表示使用档位默认值"},
+
+		// 能力路由配置（设备可在capability_routing能力中替换规则）
+		{"capability_routing", "enabled", "false", "bool", "是否在同一类别启用多个能力时按规则逐轮选择LLM/TTS"},
+		{"capability_routing", "rules", "[]", "json", "能力路由规则列表（name/capability/capability_type/min_chars/max_chars/first_segment）"},
+
+		// LLM预热配置（自部署模型空闲后卸载时使用）
+		{"llm_warmup", "enabled", "false", "bool", "是否定期向默认LLM发送预热请求，保持模型常驻"},
+		{"llm_warmup", "interval_seconds", "240", "int", "预热间隔（秒），修改后重启生效"},
+		{"llm_warmup", "idle_seconds", "0", "int", "最近这段时间内有真实请求时跳过预热（秒），0表示与预热间隔相同"},
+		{"llm_warmup", "prompt", "你好", "string", "预热请求的提示词"},
+		{"llm_warmup", "timeout_seconds", "30", "int", "单次预热请求超时（秒）"},
+
+		// 时间和天气工具配置（设备可在info_tools能力中覆盖默认城市等）
+		{"info_tools", "time_enabled", "true", "bool", "是否向LLM提供get_time时间工具"},
+		{"info_tools", "weather_enabled", "true", "bool", "是否向LLM提供get_weather天气工具"},
+		{"info_tools", "default_city", "", "string", "用户没有说明城市时查询天气的城市"},
+		{"info_tools", "weather_fallback", "抱歉，暂时查不到天气信息，请稍后再试", "string", "天气服务失败时直接播报的提示语，为空时交给LLM回复"},
+
+		// 回复详略配置（设备可在verbosity能力中选择档位）
+		{"verbosity", "level", "normal", "string", "回复详略档位：terse、normal、detailed"},
+		{"verbosity", "levels", `{"terse":{"prompt":"请用一到两句话简短回答，不要展开。","max_tokens":150,"max_sentences":2},"normal":{},"detailed":{"prompt":"请尽量详细、完整地回答，必要时分点说明。"}}`, "json", "各档位的提示词、max_tokens、句数和字数上限"},
+
+		// 首次部署引导（通过 /api/setup 接口完成）
+		{"setup", "completed", "false", "bool", "是否已完成首次部署引导"},
+		{"setup", "completed_at", "", "string", "首次部署引导完成时间"},
+		{"setup", "block_conversations", "false", "bool", "引导完成前是否拒绝设备对话"},
+		{"setup", "pending_message", "设备服务尚未完成初始化配置，请联系管理员", "string", "引导完成前拒绝对话时播报的提示语"},
+
+		// 提示词采样配置（调试回复质量，默认关闭）
+		{"prompt_sampling", "rate", "0", "float", "对话轮次的采样率（0-1），被抽中的轮次将完整提示词和回复写入调试文件，0表示关闭"},
+		{"prompt_sampling", "provider_rates", `{}`, "json", "按LLM provider类型覆盖采样率，如 {\"openai\":0.01}"},
+		{"prompt_sampling", "redact_pii", "true", "bool", "是否脱敏手机号、邮箱、身份证号和银行卡号（密钥总是脱敏）"},
+		{"prompt_sampling", "max_chars", "4000", "int", "单条消息记录的最大字数，0表示不截断"},
+
+		// 开场问候配置（设备可在greeting能力中覆盖，默认关闭）
+		{"greeting", "enabled", "false", "bool", "是否在会话开始时主动问候，恢复的会话不问候"},
+		{"greeting", "mode", "static", "string", "问候方式：static 使用配置的问候语，llm 由LLM按人设生成"},
+		{"greeting", "texts", `["你好呀，我在呢，想聊点什么？"]`, "json", "static 模式的问候语，随机选择一句"},
+		{"greeting", "prompt", "用户刚刚打开设备，还没有说话。请按照你的人设，用一句简短、自然、友好的话和用户打招呼。", "string", "llm 模式发给LLM的问候指令"},
+		{"greeting", "delay_ms", "500", "int", "收到hello后等待多久再问候（毫秒）"},
+		{"greeting", "quiet_hours_start", "22:00", "string", "免打扰开始时间（HH:MM，设备时区）"},
+		{"greeting", "quiet_hours_end", "08:00", "string", "免打扰结束时间（HH:MM，设备时区）"},
+		{"greeting", "timezone", "Asia/Shanghai", "string", "默认设备时区（IANA名称）"},
+
+		// 远程调试日志推送配置（GET /api/debug/logs/stream）
+		{"log_stream", "max_seconds", "600", "int", "单次日志推送的最长时长（秒），到达后服务端结束推送"},
+		{"log_stream", "max_streams", "5", "int", "同时进行的日志推送连接数上限"},
+
+		// 绑定设备数量上限（管理员可通过 PUT /api/users/:id/device-limit 为单个用户调整）
+		{"device_binding", "max_devices_per_user", "10", "int", "每个用户可绑定的设备数上限（只统计启用中的绑定），0表示不限制"},
+		{"device_binding", "role_limits", `{"admin":0}`, "json", "按用户角色覆盖绑定设备上限，0表示不限制"},
+
+		// 关键词触发配置（设备可在keyword_trigger能力中替换触发规则）
+		{"keyword_trigger", "enabled", "false", "bool", "是否在进入对话流程之前按关键词触发特殊处理"},
+		{"keyword_trigger", "webhook_url", "", "string", "webhook动作的默认通知地址"},
+		{"keyword_trigger", "triggers", "[]", "json", "触发规则列表（name/keywords/action/reply/mode/webhook_url），action可选 end_session、webhook、switch_mode、reply"},
+
+		// 聊天数据保留期配置（开启后后台定期清除超过保留天数的会话、消息、记忆、图片和采集的音频）
+		{"chat_retention", "enabled", "false", "bool", "是否按保留期自动清除聊天数据"},
+		{"chat_retention", "retention_days", "365", "int", "聊天数据保留天数"},
+		{"chat_retention", "mode", "delete", "string", "清除方式：delete（删除）或 anonymize（保留会话和消息的行，清空用户ID和内容）"},
+
+		// 管理端实时状态推送配置（/api/admin/status/stream）
+		{"status_stream", "interval_seconds", "5", "int", "状态快照的推送间隔（秒），最小1秒"},
+		{"status_stream", "event_limit", "20", "int", "每次推送的设备事件上限，0表示不推送设备事件"},
+
+		// TTS不可用时降级为纯文本配置（只对能显示文字的设备在tts_text_fallback能力中开启）
+		{"tts_text_fallback", "enabled", "false", "bool", "全部TTS合成失败时是否以文本消息下发回复"},
+		{"tts_text_fallback", "notice", "true", "bool", "降级时是否播放一次预备的语音不可用提示音频（failure_speech的tts提示语）"},
+
+		// 遗忘指令配置（说出遗忘短语时清空对话上下文和长期记忆）
+		{"forget_command", "enabled", "false", "bool", "是否启用语音遗忘指令"},
+		{"forget_command", "phrases", `["忘记所有事情","忘掉所有事情","忘记关于我的一切"]`, "json", "触发短语，去掉标点空格后需与识别结果完全一致"},
+		{"forget_command", "confirm", "true", "bool", "是否需要用户说出确认短语后才清除"},
+		{"forget_command", "confirm_prompt", "确定要让我忘记关于你的所有记忆吗？请说“确定”或“取消”。", "string", "确认提问"},
+		{"forget_command", "confirm_phrases", `["确定","确认","是的"]`, "json", "确认短语"},
+		{"forget_command", "cancel_phrases", `["取消","不要","算了"]`, "json", "取消短语"},
+		{"forget_command", "confirm_seconds", "30", "int", "等待确认的时长（秒）"},
+		{"forget_command", "reply", "好的，我已经忘记了之前的所有内容。", "string", "清除完成后的回复语"},
+		{"forget_command", "cancel_reply", "好的，已取消。", "string", "取消后的回复语"},
+
+		// 语音起点前置缓冲配置（设备可在vad能力配置的pre_roll字段中覆盖）
+		{"audio_preroll", "enabled", "false", "bool", "是否在语音起点前缓冲音频，检测到语音后连同缓冲一起送入ASR"},
+		{"audio_preroll", "pre_roll_ms", "300", "int", "语音起点前保留的音频时长（毫秒，最长2000）"},
+		{"audio_preroll", "energy_threshold", "0.01", "float", "语音起点的能量阈值（归一化RMS，0-1）"},
+
+		// 会话自动命名配置
+		{"session_title", "enabled", "true", "bool", "是否在对话满指定轮数后自动生成会话标题"},
+		{"session_title", "after_turns", "3", "int", "对话满多少轮后生成会话标题"},
+		{"session_title", "max_length", "20", "int", "会话标题最大字符数"},
+		{"session_title", "use_llm", "true", "bool", "是否使用LLM生成标题，关闭或失败时取第一条用户消息"},
+		{"session_title", "timeout_ms", "5000", "int", "LLM生成标题的超时时间（毫秒）"},
+
+		// 维护模式配置（修改后立即生效）
+		{"maintenance", "enabled", "false", "bool", "是否启用维护模式（拒绝新连接/新对话，非管理员写操作返回503）"},
+		{"maintenance", "message", "系统正在维护中，请稍后再试", "string", "维护模式下返回给设备和接口调用方的提示语"},
 	}
 
 	for _, config := range defaultConfigs {
@@ -563,6 +932,17 @@ func (s *ConfigService) InitializeDefaultProviderConfigs() error {
 			IsDefault: true,
 			Props:     []byte(`{"host":"openspeech.bytedance.com","ws_url":"wss://openspeech.bytedance.com/api/v3/sauc/bigmodel_nostream","model_name":"bigmodel","chunk_duration":200,"end_window_size":800,"appid": "你的appid"}`),
 		},
+		// AliyunASR
+		{
+			Category:  "ASR",
+			Name:      "AliyunASR",
+			Type:      "aliyun",
+			Version:   "v1",
+			Weight:    90,
+			IsActive:  false,
+			IsDefault: false,
+			Props:     []byte(`{"app_key": "你的app_key", "access_key": "你的access_key", "secret": "你的secret", "sample_rate": 16000, "max_end_silence": 800}`),
+		},
 		// ChatGLM LLM
 		{
 			Category:  "LLM",
@@ -614,6 +994,12 @@ func (s *ConfigService) InitializeDefaultProviderConfigs() error {
 		err := s.db.DB.Where("category = ? AND name = ? AND version = ?", provider.Category, provider.Name, provider.Version).First(&existing).Error
 		if err != nil {
 			if err == gorm.ErrRecordNotFound {
+				// 类别中已有其他默认配置时，补建的内置配置不再设为默认
+				if provider.IsDefault {
+					if exists, err := hasDefaultProvider(s.db.DB, provider.Category); err == nil && exists {
+						provider.IsDefault = false
+					}
+				}
 				if err := s.db.DB.Create(&provider).Error; err != nil {
 					s.logger.Error("创建默认Provider配置失败: %v", err)
 					return err
@@ -629,7 +1015,7 @@ func (s *ConfigService) InitializeDefaultProviderConfigs() error {
 	return nil
 }
 
-// GetSystemConfigCategory 获取指定分类的所有系统配置
+// GetSystemConfigCategory 获取指定分类的所有系统配置，已存在的配置项设置了对应的环境变量时优先使用环境变量
 func (s *ConfigService) GetSystemConfigCategory(category string) (map[string]interface{}, error) {
 	configs, err := s.ListSystemConfigs(category)
 	if err != nil {
@@ -638,47 +1024,63 @@ func (s *ConfigService) GetSystemConfigCategory(category string) (map[string]int
 
 	result := make(map[string]interface{})
 	for _, config := range configs {
-		switch config.ConfigType {
-		case "int":
-			if val, err := strconv.Atoi(config.ConfigValue); err == nil {
-				result[config.ConfigKey] = val
-			} else {
-				result[config.ConfigKey] = config.ConfigValue
-			}
-		case "float":
-			if val, err := strconv.ParseFloat(config.ConfigValue, 64); err == nil {
-				result[config.ConfigKey] = val
-			} else {
-				result[config.ConfigKey] = config.ConfigValue
-			}
-		case "bool":
-			if val, err := strconv.ParseBool(config.ConfigValue); err == nil {
-				result[config.ConfigKey] = val
-			} else {
-				result[config.ConfigKey] = config.ConfigValue
-			}
-		case "json":
-			var val interface{}
-			if err := json.Unmarshal([]byte(config.ConfigValue), &val); err == nil {
-				result[config.ConfigKey] = val
-			} else {
-				result[config.ConfigKey] = config.ConfigValue
-			}
-		case "array":
-			var val []string
-			if err := json.Unmarshal([]byte(config.ConfigValue), &val); err == nil {
-				result[config.ConfigKey] = val
-			} else {
-				result[config.ConfigKey] = config.ConfigValue
-			}
-		default:
-			result[config.ConfigKey] = config.ConfigValue
-		}
+		result[config.ConfigKey] = systemConfigValue(config)
 	}
+	return result, nil
+}
 
+// GetSystemConfigCategories 一次读取全部系统配置，按分类返回，取值规则与 GetSystemConfigCategory 相同
+func (s *ConfigService) GetSystemConfigCategories() (map[string]map[string]interface{}, error) {
+	configs, err := s.ListSystemConfigs("")
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]map[string]interface{})
+	for _, config := range configs {
+		category, ok := result[config.ConfigCategory]
+		if !ok {
+			category = make(map[string]interface{})
+			result[config.ConfigCategory] = category
+		}
+		category[config.ConfigKey] = systemConfigValue(config)
+	}
 	return result, nil
 }
 
+// systemConfigValue 按配置类型解析配置值，设置了对应的环境变量时优先使用环境变量，解析失败时返回原始字符串
+func systemConfigValue(config *SystemConfig) interface{} {
+	value := config.ConfigValue
+	if override, ok := lookupSystemConfigEnv(config.ConfigCategory, config.ConfigKey); ok {
+		value = override
+	}
+	switch config.ConfigType {
+	case "int":
+		if val, err := strconv.Atoi(value); err == nil {
+			return val
+		}
+	case "float":
+		if val, err := strconv.ParseFloat(value, 64); err == nil {
+			return val
+		}
+	case "bool":
+		if val, err := strconv.ParseBool(value); err == nil {
+			return val
+		}
+	case "json":
+		var val interface{}
+		if err := json.Unmarshal([]byte(value), &val); err == nil {
+			return val
+		}
+	case "array":
+		var val []string
+		if err := json.Unmarshal([]byte(value), &val); err == nil {
+			return val
+		}
+	}
+	return value
+}
+
 // GetActiveProviderConfigs 获取指定category和name下所有激活的ProviderConfig
 func (s *ConfigService) GetActiveProviderConfigs(category, name string) ([]*ProviderConfig, error) {
 	var configs []*ProviderConfig
@@ -692,6 +1094,11 @@ func (s *ConfigService) GetActiveProviderConfigs(category, name string) ([]*Prov
 
 // UpdateProviderWeight 更新提供商权重
 func (s *ConfigService) UpdateProviderWeight(category, name, version string, weight int) error {
+	if weight > 0 {
+		if err := s.checkNotRolledBack(s.db.DB, category, name, version); err != nil {
+			return err
+		}
+	}
 	if err := s.db.DB.Model(&ProviderConfig{}).
 		Where("category = ? AND name = ? AND version = ?", category, name, version).
 		Update("weight", weight).Error; err != nil {
@@ -700,8 +1107,33 @@ func (s *ConfigService) UpdateProviderWeight(category, name, version string, wei
 	return nil
 }
 
-// GetDeviceCapabilityConfigWithFallback 获取设备AI能力配置（带回退）
+// GetDeviceCapabilityConfigWithFallback 获取设备AI能力配置（带回退），结果按设备和用户短时缓存
 func (s *ConfigService) GetDeviceCapabilityConfigWithFallback(deviceID uint, userID *uint) (*DeviceCapabilityConfig, error) {
+	key := newCapabilityCacheKey(deviceID, userID)
+	cached, generation := cachedCapabilityConfig(key)
+	if cached != nil {
+		return cached, nil
+	}
+	var deviceConfig *DeviceCapabilityConfig
+	err := s.db.WithRetry(func() error {
+		var err error
+		deviceConfig, err = s.loadDeviceCapabilityConfig(deviceID, userID)
+		return err
+	})
+	if err != nil {
+		// 数据库不可用时使用已过期的缓存，对话按上次的能力配置继续
+		if stale := staleCapabilityConfig(key); stale != nil && IsUnavailableError(err) {
+			s.logger.Debug("数据库不可用，使用最近一次读取的设备能力配置: %d", deviceID)
+			return stale, nil
+		}
+		return nil, err
+	}
+	storeCapabilityConfig(key, generation, deviceConfig)
+	return deviceConfig, nil
+}
+
+// loadDeviceCapabilityConfig 从数据库解析设备AI能力配置：设备专属 > 用户 > 系统默认
+func (s *ConfigService) loadDeviceCapabilityConfig(deviceID uint, userID *uint) (*DeviceCapabilityConfig, error) {
 	deviceConfig := &DeviceCapabilityConfig{
 		DeviceID:      deviceID,
 		Capabilities:  []CapabilityConfig{},
@@ -781,6 +1213,9 @@ func (s *ConfigService) GetDeviceCapabilityConfigWithFallback(deviceID uint, use
 		used[key] = true
 	}
 
+	// 按兼容性规则过滤设备型号/固件/硬件不支持的能力
+	s.filterIncompatibleCapabilities(deviceConfig)
+
 	// 4. 全局配置
 	globalConfigs, _ := s.ListGlobalConfigs()
 	for _, gc := range globalConfigs {
@@ -802,8 +1237,24 @@ func (s *ConfigService) GetDefaultCapabilities() ([]*AICapability, error) {
 	return defaults, nil
 }
 
-// GetEffectiveProvider 获取设备/用户/系统默认 Provider
+// GetEffectiveProvider 获取设备/用户/系统默认 Provider，LLM类别按模型策略替换不允许的模型
 func (s *ConfigService) GetEffectiveProvider(category string, deviceID *uint, userID *uint) (*ProviderConfig, error) {
+	provider, err := s.resolveEffectiveProvider(category, deviceID, userID)
+	if err != nil || provider == nil || category != "LLM" {
+		return provider, err
+	}
+	fallback, err := s.CheckModelPolicy(ProviderModelName(provider), deviceID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if fallback != nil {
+		return fallback, nil
+	}
+	return provider, nil
+}
+
+// resolveEffectiveProvider 按 设备 > 用户 > 系统默认 解析 Provider
+func (s *ConfigService) resolveEffectiveProvider(category string, deviceID *uint, userID *uint) (*ProviderConfig, error) {
 	// 1. 设备专属
 	if deviceID != nil {
 		var dp DeviceProvider
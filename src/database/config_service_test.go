@@ -0,0 +1,39 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetSystemConfigCategoriesMatchesCategory(t *testing.T) {
+	db, logger := newUserServiceTestDB(t)
+	configService := NewConfigService(db, logger)
+
+	for _, c := range []struct{ category, key, value, configType string }{
+		{"barge_in", "enabled", "true", "bool"},
+		{"barge_in", "min_speech_ms", "300", "int"},
+		{"verbosity", "level", "brief", "string"},
+		{"tools", "allow", `["time"]`, "array"},
+	} {
+		if err := configService.SetSystemConfig(c.category, c.key, c.value, c.configType, "", false, nil, nil); err != nil {
+			t.Fatalf("设置系统配置失败: %v", err)
+		}
+	}
+
+	all, err := configService.GetSystemConfigCategories()
+	if err != nil {
+		t.Fatalf("读取全部系统配置失败: %v", err)
+	}
+	for _, category := range []string{"barge_in", "verbosity", "tools"} {
+		single, err := configService.GetSystemConfigCategory(category)
+		if err != nil {
+			t.Fatalf("读取 %s 分类失败: %v", category, err)
+		}
+		if !reflect.DeepEqual(all[category], single) {
+			t.Fatalf("%s 分类不一致: 全部读取 %v, 单独读取 %v", category, all[category], single)
+		}
+	}
+	if all["barge_in"]["enabled"] != true || all["barge_in"]["min_speech_ms"] != 300 {
+		t.Fatalf("配置值未按类型解析: %v", all["barge_in"])
+	}
+}
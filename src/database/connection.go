@@ -19,6 +19,9 @@ import (
 // Database 数据库管理器
 type Database struct {
 	DB *gorm.DB
+
+	retry   dbRetryPolicy // 临时错误重试策略
+	breaker *dbBreaker    // 熔断器，连续临时错误后拒绝执行语句
 }
 
 // NewDatabase 创建数据库连接
@@ -100,6 +103,10 @@ func NewDatabase(config *configs.DatabaseConfig, logger *utils.Logger) (*Databas
 
 	// 自动迁移（自动建表）
 	dbObj := &Database{DB: db}
+	dbObj.retry, dbObj.breaker = newDBResilience(config.Retry, logger)
+	if err := dbObj.registerBreakerCallbacks(); err != nil {
+		return nil, fmt.Errorf("注册数据库熔断回调失败: %v", err)
+	}
 	if err := dbObj.AutoMigrate(); err != nil {
 		return nil, fmt.Errorf("数据库自动迁移失败: %v", err)
 	}
@@ -131,6 +138,19 @@ func (d *Database) AutoMigrate() error {
 		&ChatSession{},
 		&ChatMessage{},
 		&ChatMemory{},
+		&PendingMemory{},
+		&DeviceEvent{},
+		&SessionSummary{},
+		&CapabilityCompatibility{},
+		&ModelPolicy{},
+		&ImpersonationAudit{},
+		&ProviderAudit{},
+		&ProviderCredential{},
+		&Persona{},
+		&PersonaAssignment{},
+		&StoredImage{},
+		&AudioCapture{},
+		&ChatDataPurgeAudit{},
 	}
 
 	// 执行自动迁移
@@ -156,9 +176,11 @@ func (d *Database) GetDB() *gorm.DB {
 	return d.DB
 }
 
-// Transaction 执行数据库事务
+// Transaction 执行数据库事务，遇到临时错误（如死锁）时整体重试
 func (d *Database) Transaction(fc func(tx *gorm.DB) error) error {
-	return d.DB.Transaction(fc)
+	return d.WithRetry(func() error {
+		return d.DB.Transaction(fc)
+	})
 }
 
 // Begin 开始事务
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EstimatedCostHeader 返回估算费用的HTTP响应头
+const EstimatedCostHeader = "X-Estimated-Cost"
+
+// UsageAmount 一次请求（或一轮对话）的用量
+type UsageAmount struct {
+	InputTokens  int
+	OutputTokens int
+	TTSChars     int
+	ASRSeconds   float64
+}
+
+// Add 累加用量
+func (u *UsageAmount) Add(other UsageAmount) {
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.TTSChars += other.TTSChars
+	u.ASRSeconds += other.ASRSeconds
+}
+
+// IsZero 是否没有任何用量
+func (u UsageAmount) IsZero() bool {
+	return u.InputTokens == 0 && u.OutputTokens == 0 && u.TTSChars == 0 && u.ASRSeconds == 0
+}
+
+// EstimateCost 按提供商配置的单价估算费用，provider为空或未定价时返回0
+func EstimateCost(provider *ProviderConfig, usage UsageAmount) float64 {
+	if provider == nil {
+		return 0
+	}
+	cost := float64(usage.InputTokens) / 1000 * provider.InputTokenPrice
+	cost += float64(usage.OutputTokens) / 1000 * provider.OutputTokenPrice
+	cost += float64(usage.TTSChars) / 1000 * provider.TTSCharPrice
+	cost += usage.ASRSeconds / 60 * provider.ASRMinutePrice
+	return cost
+}
+
+// FormatCost 格式化费用，用于响应头和日志
+func FormatCost(cost float64) string {
+	return strconv.FormatFloat(cost, 'f', 6, 64)
+}
+
+// RecordUsage 按设备、能力和日期累加使用统计（含估算费用）
+func (s *DeviceService) RecordUsage(userID *uint, deviceID uint, capabilityName string, usage UsageAmount, cost float64, success bool, duration time.Duration) error {
+	return recordUsage(s.db.DB, userID, deviceID, capabilityName, usage, cost, success, duration)
+}
+
+// recordUsage 在给定的数据库连接（或事务）上累加使用统计
+func recordUsage(db *gorm.DB, userID *uint, deviceID uint, capabilityName string, usage UsageAmount, cost float64, success bool, duration time.Duration) error {
+	usageDate := time.Now().Truncate(24 * time.Hour)
+
+	var stats UsageStats
+	err := db.Where("device_id = ? AND capability_name = ? AND usage_date = ?", deviceID, capabilityName, usageDate).
+		First(&stats).Error
+	if err == gorm.ErrRecordNotFound {
+		stats = UsageStats{
+			UserID:         userID,
+			DeviceID:       deviceID,
+			CapabilityName: capabilityName,
+			UsageDate:      usageDate,
+		}
+		if err := db.Create(&stats).Error; err != nil {
+			return fmt.Errorf("创建使用统计失败: %v", err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("查询使用统计失败: %v", err)
+	}
+
+	successCount, errorCount := 0, 0
+	if success {
+		successCount = 1
+	} else {
+		errorCount = 1
+	}
+	if err := db.Model(&stats).Updates(map[string]interface{}{
+		"request_count":  gorm.Expr("request_count + 1"),
+		"success_count":  gorm.Expr("success_count + ?", successCount),
+		"error_count":    gorm.Expr("error_count + ?", errorCount),
+		"total_duration": gorm.Expr("total_duration + ?", int(duration.Milliseconds())),
+		"input_tokens":   gorm.Expr("input_tokens + ?", usage.InputTokens),
+		"output_tokens":  gorm.Expr("output_tokens + ?", usage.OutputTokens),
+		"tts_chars":      gorm.Expr("tts_chars + ?", usage.TTSChars),
+		"asr_seconds":    gorm.Expr("asr_seconds + ?", usage.ASRSeconds),
+		"estimated_cost": gorm.Expr("estimated_cost + ?", cost),
+	}).Error; err != nil {
+		return fmt.Errorf("更新使用统计失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+/*
+* 绑定设备数量上限：面向消费者的部署中限制单个用户可绑定的设备数，防止配额滥用。
+* 上限依次取用户单独设置的 max_devices（管理员设置）、系统配置 device_binding.role_limits 中该角色的上限、
+* device_binding.max_devices_per_user 默认上限；0 表示不限制。只统计启用中的绑定。
+ */
+
+// defaultMaxDevicesPerUser 未配置时每个用户的绑定设备上限
+const defaultMaxDevicesPerUser = 10
+
+// DeviceLimitError 绑定设备数量已达上限
+type DeviceLimitError struct {
+	Limit int // 该用户的绑定上限
+	Bound int // 已启用的绑定数
+}
+
+func (e *DeviceLimitError) Error() string {
+	return fmt.Sprintf("已绑定 %d 台设备，达到上限 %d 台，请先解绑不用的设备或联系管理员提高上限", e.Bound, e.Limit)
+}
+
+// DeviceLimit 用户的绑定设备上限，0表示不限制
+func (s *UserService) DeviceLimit(user *User) int {
+	if user.MaxDevices != nil {
+		return max(*user.MaxDevices, 0)
+	}
+	configService := NewConfigService(s.db, s.logger)
+	if limits, err := configService.GetSystemConfigJSON("device_binding", "role_limits"); err == nil {
+		if value, ok := limits[user.Role]; ok {
+			if limit, ok := value.(float64); ok && limit >= 0 {
+				return int(limit)
+			}
+		}
+	}
+	if limit, err := configService.GetSystemConfigInt("device_binding", "max_devices_per_user"); err == nil && limit >= 0 {
+		return limit
+	}
+	return defaultMaxDevicesPerUser
+}
+
+// CountActiveUserDevices 统计用户启用中的设备绑定数
+func (s *UserService) CountActiveUserDevices(userID uint) (int64, error) {
+	return countActiveUserDevices(s.db.DB, userID)
+}
+
+func countActiveUserDevices(db *gorm.DB, userID uint) (int64, error) {
+	var count int64
+	if err := db.Model(&UserDevice{}).Where("user_id = ? AND is_active = ?", userID, true).Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("统计用户绑定设备失败: %v", err)
+	}
+	return count, nil
+}
+
+// SetUserDeviceLimit 管理员设置用户的绑定设备上限，limit 为nil时恢复按角色和系统配置
+func (s *UserService) SetUserDeviceLimit(userID uint, limit *int) error {
+	if limit != nil && *limit < 0 {
+		return fmt.Errorf("绑定设备上限不能为负数")
+	}
+	result := s.db.DB.Model(&User{}).Where("id = ?", userID).Update("max_devices", limit)
+	if result.Error != nil {
+		return fmt.Errorf("设置绑定设备上限失败: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("用户不存在")
+	}
+	value := "默认"
+	if limit != nil {
+		value = strconv.Itoa(*limit)
+	}
+	s.logger.Info("用户 %d 的绑定设备上限设置为 %s", userID, value)
+	return nil
+}
@@ -0,0 +1,145 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// MergeDevices 将源设备合并到目标设备：在一个事务中把源设备的用户绑定、能力配置、认证Key、会话、
+// 使用统计、设备事件和聊天记录改指向目标设备，然后软删除源设备。
+// 目标设备已有相同用户绑定或相同能力时，以目标设备为准，删除源设备的重复记录；
+// 目标设备已有同一能力同一天的使用统计时，源设备的统计累加到目标设备的记录中。
+func (s *DeviceService) MergeDevices(sourceID, targetID uint) (*DeviceMergeResult, error) {
+	if sourceID == targetID {
+		return nil, fmt.Errorf("源设备和目标设备不能相同")
+	}
+
+	result := &DeviceMergeResult{SourceID: sourceID, TargetID: targetID}
+	err := s.db.DB.Transaction(func(tx *gorm.DB) error {
+		// 用户绑定：同一用户已绑定目标设备时删除源设备上的绑定
+		var boundUsers []uint
+		if err := tx.Model(&UserDevice{}).Where("device_id = ?", targetID).Pluck("user_id", &boundUsers).Error; err != nil {
+			return fmt.Errorf("查询目标设备用户绑定失败: %v", err)
+		}
+		if len(boundUsers) > 0 {
+			dropped := tx.Where("device_id = ? AND user_id IN ?", sourceID, boundUsers).Delete(&UserDevice{})
+			if dropped.Error != nil {
+				return fmt.Errorf("合并用户绑定失败: %v", dropped.Error)
+			}
+			result.DroppedDuplicates += dropped.RowsAffected
+		}
+
+		moved := tx.Model(&UserDevice{}).Where("device_id = ?", sourceID).Update("device_id", targetID)
+		if moved.Error != nil {
+			return fmt.Errorf("合并用户绑定失败: %v", moved.Error)
+		}
+		result.UserDevices = moved.RowsAffected
+
+		// 能力配置：目标设备已配置的能力保留目标设备的配置
+		var configured []uint
+		if err := tx.Model(&DeviceCapability{}).Where("device_id = ?", targetID).Pluck("capability_id", &configured).Error; err != nil {
+			return fmt.Errorf("查询目标设备能力配置失败: %v", err)
+		}
+		if len(configured) > 0 {
+			dropped := tx.Where("device_id = ? AND capability_id IN ?", sourceID, configured).Delete(&DeviceCapability{})
+			if dropped.Error != nil {
+				return fmt.Errorf("合并能力配置失败: %v", dropped.Error)
+			}
+			result.DroppedDuplicates += dropped.RowsAffected
+		}
+
+		moved = tx.Model(&DeviceCapability{}).Where("device_id = ?", sourceID).Update("device_id", targetID)
+		if moved.Error != nil {
+			return fmt.Errorf("合并能力配置失败: %v", moved.Error)
+		}
+		result.DeviceCapabilities = moved.RowsAffected
+
+		// 使用统计：同一能力同一天只保留一条记录，源设备的计数累加到目标设备已有的记录
+		merged, err := mergeUsageStats(tx, sourceID, targetID)
+		if err != nil {
+			return err
+		}
+		result.MergedUsageStats = merged
+
+		// 认证Key、会话、剩余的统计、设备事件和聊天记录直接改指向目标设备
+		repoint := []struct {
+			model interface{}
+			name  string
+			count *int64
+		}{
+			{&DeviceAuth{}, "设备认证", &result.DeviceAuths},
+			{&Session{}, "会话", &result.Sessions},
+			{&UsageStats{}, "使用统计", &result.UsageStats},
+			{&DeviceEvent{}, "设备事件", &result.DeviceEvents},
+			{&ChatSession{}, "聊天会话", &result.ChatSessions},
+			{&ChatMessage{}, "聊天消息", &result.ChatMessages},
+			{&ChatMemory{}, "聊天记忆", &result.ChatMemories},
+			{&PendingMemory{}, "待重试记忆", &result.PendingMemories},
+		}
+		for _, item := range repoint {
+			moved := tx.Model(item.model).Where("device_id = ?", sourceID).Update("device_id", targetID)
+			if moved.Error != nil {
+				return fmt.Errorf("合并%s失败: %v", item.name, moved.Error)
+			}
+			*item.count = moved.RowsAffected
+		}
+
+		if err := tx.Delete(&Device{}, sourceID).Error; err != nil {
+			return fmt.Errorf("删除源设备失败: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	InvalidateDeviceCapabilityCache(sourceID, targetID)
+
+	s.logger.Info("设备合并成功: %d -> %d, 用户绑定 %d, 能力配置 %d, 认证Key %d, 会话 %d, 使用统计 %d（累加 %d）, 设备事件 %d, 删除重复记录 %d",
+		sourceID, targetID, result.UserDevices, result.DeviceCapabilities, result.DeviceAuths, result.Sessions,
+		result.UsageStats, result.MergedUsageStats, result.DeviceEvents, result.DroppedDuplicates)
+	return result, nil
+}
+
+// mergeUsageStats 将源设备的使用统计累加到目标设备同一能力同一天的记录并删除源记录，返回累加的记录数；
+// 目标设备没有对应记录的统计保留，由调用方改指向目标设备
+func mergeUsageStats(tx *gorm.DB, sourceID, targetID uint) (int64, error) {
+	var sourceStats []UsageStats
+	if err := tx.Where("device_id = ?", sourceID).Find(&sourceStats).Error; err != nil {
+		return 0, fmt.Errorf("查询源设备使用统计失败: %v", err)
+	}
+
+	var merged int64
+	for i := range sourceStats {
+		stats := &sourceStats[i]
+		var target UsageStats
+		err := tx.Where("device_id = ? AND capability_name = ? AND usage_date = ?", targetID, stats.CapabilityName, stats.UsageDate).
+			First(&target).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("查询目标设备使用统计失败: %v", err)
+		}
+
+		if err := tx.Model(&target).Updates(map[string]interface{}{
+			"request_count":  gorm.Expr("request_count + ?", stats.RequestCount),
+			"success_count":  gorm.Expr("success_count + ?", stats.SuccessCount),
+			"error_count":    gorm.Expr("error_count + ?", stats.ErrorCount),
+			"total_duration": gorm.Expr("total_duration + ?", stats.TotalDuration),
+			"input_tokens":   gorm.Expr("input_tokens + ?", stats.InputTokens),
+			"output_tokens":  gorm.Expr("output_tokens + ?", stats.OutputTokens),
+			"tts_chars":      gorm.Expr("tts_chars + ?", stats.TTSChars),
+			"asr_seconds":    gorm.Expr("asr_seconds + ?", stats.ASRSeconds),
+			"estimated_cost": gorm.Expr("estimated_cost + ?", stats.EstimatedCost),
+		}).Error; err != nil {
+			return 0, fmt.Errorf("合并使用统计失败: %v", err)
+		}
+		if err := tx.Delete(stats).Error; err != nil {
+			return 0, fmt.Errorf("删除已合并的使用统计失败: %v", err)
+		}
+		merged++
+	}
+	return merged, nil
+}
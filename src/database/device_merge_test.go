@@ -0,0 +1,70 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMergeDevicesMovesAuthEventsAndSumsUsage(t *testing.T) {
+	db, logger := newUserServiceTestDB(t)
+	deviceService := NewDeviceService(db, logger)
+
+	source := &Device{DeviceUUID: "source", OUI: "aa:bb:cc", SN: "sn-1", DeviceName: "重复设备"}
+	target := &Device{DeviceUUID: "target", OUI: "AA:BB:CC", SN: "SN-1", DeviceName: "保留设备"}
+	for _, device := range []*Device{source, target} {
+		if err := db.DB.Create(device).Error; err != nil {
+			t.Fatalf("创建设备失败: %v", err)
+		}
+	}
+
+	day := time.Now().Truncate(24 * time.Hour)
+	records := []interface{}{
+		&DeviceAuth{DeviceID: source.ID, AuthType: "key", AuthKey: "source-key"},
+		&DeviceEvent{DeviceID: source.ID, Level: "error", Message: "解码失败", ReportedAt: time.Now()},
+		&UsageStats{DeviceID: target.ID, CapabilityName: "llm", UsageDate: day, RequestCount: 2, InputTokens: 100, EstimatedCost: 0.5},
+		&UsageStats{DeviceID: source.ID, CapabilityName: "llm", UsageDate: day, RequestCount: 3, InputTokens: 50, EstimatedCost: 0.25},
+		&UsageStats{DeviceID: source.ID, CapabilityName: "tts", UsageDate: day, RequestCount: 1, TTSChars: 20},
+	}
+	for _, record := range records {
+		if err := db.DB.Create(record).Error; err != nil {
+			t.Fatalf("创建测试数据失败: %v", err)
+		}
+	}
+
+	result, err := deviceService.MergeDevices(source.ID, target.ID)
+	if err != nil {
+		t.Fatalf("合并设备失败: %v", err)
+	}
+	if result.DeviceAuths != 1 || result.DeviceEvents != 1 || result.MergedUsageStats != 1 || result.UsageStats != 1 {
+		t.Fatalf("合并结果不正确: %+v", result)
+	}
+
+	var auth DeviceAuth
+	if err := db.DB.Where("auth_key = ?", "source-key").First(&auth).Error; err != nil || auth.DeviceID != target.ID {
+		t.Fatalf("认证Key应改指向目标设备: device_id=%d, err=%v", auth.DeviceID, err)
+	}
+	var events int64
+	db.DB.Model(&DeviceEvent{}).Where("device_id = ?", target.ID).Count(&events)
+	if events != 1 {
+		t.Fatalf("设备事件应改指向目标设备，目标设备事件数 %d", events)
+	}
+
+	var stats []UsageStats
+	if err := db.DB.Where("device_id = ?", target.ID).Order("capability_name").Find(&stats).Error; err != nil {
+		t.Fatalf("查询使用统计失败: %v", err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("目标设备应有2条使用统计，实际 %d 条", len(stats))
+	}
+	if llm := stats[0]; llm.CapabilityName != "llm" || llm.RequestCount != 5 || llm.InputTokens != 150 || llm.EstimatedCost != 0.75 {
+		t.Fatalf("同一天的LLM统计应累加: %+v", llm)
+	}
+	if tts := stats[1]; tts.CapabilityName != "tts" || tts.RequestCount != 1 || tts.TTSChars != 20 {
+		t.Fatalf("目标设备没有的统计应直接改指向: %+v", tts)
+	}
+	var left int64
+	db.DB.Model(&UsageStats{}).Where("device_id = ?", source.ID).Count(&left)
+	if left != 0 {
+		t.Fatalf("源设备不应再有使用统计，剩余 %d 条", left)
+	}
+}
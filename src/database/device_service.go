@@ -3,6 +3,7 @@ package database
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"ai-server-go/src/core/utils"
@@ -52,10 +53,29 @@ func (s *DeviceService) GetDeviceByID(id uint) (*Device, error) {
 	return &device, nil
 }
 
+// GetActiveDeviceAuth 根据认证Key获取有效（启用且未过期）的设备认证记录
+func (s *DeviceService) GetActiveDeviceAuth(authKey string) (*DeviceAuth, error) {
+	var auth DeviceAuth
+	if err := s.db.WithRetry(func() error {
+		return s.db.DB.Where("auth_key = ? AND is_active = ?", authKey, true).First(&auth).Error
+	}); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("查询设备认证失败: %v", err)
+	}
+	if auth.ExpiresAt != nil && auth.ExpiresAt.Before(time.Now()) {
+		return nil, nil
+	}
+	return &auth, nil
+}
+
 // GetDeviceByUUID 根据UUID获取设备
 func (s *DeviceService) GetDeviceByUUID(deviceUUID string) (*Device, error) {
 	var device Device
-	if err := s.db.DB.Where("device_uuid = ?", deviceUUID).First(&device).Error; err != nil {
+	if err := s.db.WithRetry(func() error {
+		return s.db.DB.Where("device_uuid = ?", deviceUUID).First(&device).Error
+	}); err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, nil
 		}
@@ -70,6 +90,7 @@ func (s *DeviceService) UpdateDevice(device *Device) error {
 		return fmt.Errorf("更新设备失败: %v", err)
 	}
 
+	InvalidateDeviceCapabilityCache(device.ID)
 	s.logger.Info("设备更新成功: %s", device.DeviceName)
 	return nil
 }
@@ -80,6 +101,7 @@ func (s *DeviceService) DeleteDevice(id uint) error {
 		return fmt.Errorf("删除设备失败: %v", err)
 	}
 
+	InvalidateDeviceCapabilityCache(id)
 	s.logger.Info("设备删除成功: ID %d", id)
 	return nil
 }
@@ -196,6 +218,7 @@ func (s *DeviceService) SetDeviceCapability(deviceID uint, capabilityName, capab
 		}
 	}
 
+	InvalidateDeviceCapabilityCache(deviceID)
 	s.logger.Info("设备AI能力设置成功: 设备ID %d, 能力 %s", deviceID, capabilityName)
 	return nil
 }
@@ -293,3 +316,257 @@ func (s *DeviceService) GetUserDeviceBinding(userID, deviceID uint) (*UserDevice
 	}
 	return &userDevice, nil
 }
+
+// deviceBundleVersion 设备配置包格式版本
+const deviceBundleVersion = 1
+
+// isSecretConfigKey 判断配置项是否为密钥类字段（导出时需剔除）
+func isSecretConfigKey(key string) bool {
+	lower := strings.ToLower(key)
+	for _, word := range []string{"secret", "token", "password", "api_key", "apikey", "access_key", "private_key"} {
+		if strings.Contains(lower, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// stripSecrets 复制配置并剔除密钥类字段
+func stripSecrets(config map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(config))
+	for key, value := range config {
+		if isSecretConfigKey(key) {
+			continue
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			value = stripSecrets(nested)
+		}
+		result[key] = value
+	}
+	return result
+}
+
+// ExportDeviceConfig 导出设备的完整配置包（能力、provider绑定、元数据，不含密钥）
+func (s *DeviceService) ExportDeviceConfig(deviceUUID string) (*DeviceConfigBundle, error) {
+	device, err := s.GetDeviceByUUID(deviceUUID)
+	if err != nil {
+		return nil, err
+	}
+	if device == nil {
+		return nil, nil
+	}
+
+	bundle := &DeviceConfigBundle{
+		BundleVersion: deviceBundleVersion,
+		ExportedAt:    time.Now(),
+		Device: DeviceBundleMetadata{
+			DeviceName:      device.DeviceName,
+			DeviceType:      device.DeviceType,
+			DeviceModel:     device.DeviceModel,
+			FirmwareVersion: device.FirmwareVersion,
+			HardwareVersion: device.HardwareVersion,
+		},
+		Capabilities:     []DeviceBundleCapability{},
+		ProviderBindings: []DeviceBundleProviderRef{},
+	}
+
+	// 导出设备能力（包含已禁用的能力，保证克隆后状态一致）
+	var deviceCapabilities []DeviceCapability
+	if err := s.db.DB.Where("device_id = ?", device.ID).Preload("Capability").
+		Order("priority DESC").Find(&deviceCapabilities).Error; err != nil {
+		return nil, fmt.Errorf("查询设备AI能力失败: %v", err)
+	}
+	for _, dc := range deviceCapabilities {
+		if dc.Capability.CapabilityName == "" {
+			continue
+		}
+		config := make(map[string]interface{})
+		if len(dc.ConfigData) > 0 {
+			if err := json.Unmarshal(dc.ConfigData, &config); err != nil {
+				s.logger.Warn("解析设备能力配置失败: %v", err)
+			}
+		}
+		bundle.Capabilities = append(bundle.Capabilities, DeviceBundleCapability{
+			CapabilityName: dc.Capability.CapabilityName,
+			CapabilityType: dc.Capability.CapabilityType,
+			Priority:       dc.Priority,
+			Config:         stripSecrets(config),
+			IsEnabled:      dc.IsEnabled,
+		})
+	}
+
+	// 导出provider绑定，使用类别/名称/版本引用，便于跨环境导入
+	var bindings []DeviceProvider
+	if err := s.db.DB.Where("device_id = ? AND is_active = ?", device.ID, true).Find(&bindings).Error; err != nil {
+		return nil, fmt.Errorf("查询设备provider绑定失败: %v", err)
+	}
+	for _, binding := range bindings {
+		var providerConfig ProviderConfig
+		if err := s.db.DB.First(&providerConfig, binding.ProviderID).Error; err != nil {
+			s.logger.Warn("设备 %s 绑定的provider %d 不存在，跳过导出", deviceUUID, binding.ProviderID)
+			continue
+		}
+		bundle.ProviderBindings = append(bundle.ProviderBindings, DeviceBundleProviderRef{
+			Category: binding.Category,
+			Name:     providerConfig.Name,
+			Version:  providerConfig.Version,
+		})
+	}
+
+	return bundle, nil
+}
+
+// ImportDeviceConfig 在事务中将配置包应用到目标设备，不存在的能力/provider会被跳过并返回
+func (s *DeviceService) ImportDeviceConfig(deviceUUID string, bundle *DeviceConfigBundle) (*DeviceImportResult, error) {
+	device, err := s.GetDeviceByUUID(deviceUUID)
+	if err != nil {
+		return nil, err
+	}
+	if device == nil {
+		return nil, nil
+	}
+
+	result := &DeviceImportResult{Skipped: []string{}}
+	err = s.db.DB.Transaction(func(tx *gorm.DB) error {
+		for _, bc := range bundle.Capabilities {
+			var capability AICapability
+			if err := tx.Where("capability_name = ? AND capability_type = ?", bc.CapabilityName, bc.CapabilityType).
+				First(&capability).Error; err != nil {
+				if err == gorm.ErrRecordNotFound {
+					result.Skipped = append(result.Skipped, fmt.Sprintf("capability %s/%s 不存在", bc.CapabilityName, bc.CapabilityType))
+					continue
+				}
+				return fmt.Errorf("查询AI能力失败: %v", err)
+			}
+
+			config := bc.Config
+			if config == nil {
+				config = make(map[string]interface{})
+			}
+
+			var deviceCapability DeviceCapability
+			err := tx.Where("device_id = ? AND capability_id = ?", device.ID, capability.ID).First(&deviceCapability).Error
+			if err != nil && err != gorm.ErrRecordNotFound {
+				return fmt.Errorf("查询设备AI能力失败: %v", err)
+			}
+			exists := err == nil
+
+			// 配置包不含密钥，保留目标设备已有的密钥字段
+			if exists && len(deviceCapability.ConfigData) > 0 {
+				var existing map[string]interface{}
+				if err := json.Unmarshal(deviceCapability.ConfigData, &existing); err == nil {
+					for key, value := range existing {
+						if _, ok := config[key]; !ok && isSecretConfigKey(key) {
+							config[key] = value
+						}
+					}
+				}
+			}
+
+			configJSON, err := json.Marshal(config)
+			if err != nil {
+				return fmt.Errorf("序列化配置失败: %v", err)
+			}
+
+			if exists {
+				deviceCapability.Priority = bc.Priority
+				deviceCapability.ConfigData = configJSON
+				deviceCapability.IsEnabled = bc.IsEnabled
+				if err := tx.Save(&deviceCapability).Error; err != nil {
+					return fmt.Errorf("更新设备AI能力失败: %v", err)
+				}
+			} else {
+				deviceCapability = DeviceCapability{
+					DeviceID:     device.ID,
+					CapabilityID: capability.ID,
+					Priority:     bc.Priority,
+					ConfigData:   configJSON,
+					IsEnabled:    bc.IsEnabled,
+				}
+				if err := tx.Create(&deviceCapability).Error; err != nil {
+					return fmt.Errorf("创建设备AI能力失败: %v", err)
+				}
+			}
+			result.AppliedCapabilities++
+		}
+
+		for _, ref := range bundle.ProviderBindings {
+			query := tx.Where("category = ? AND name = ? AND is_active = ?", ref.Category, ref.Name, true)
+			if ref.Version != "" {
+				query = query.Where("version = ?", ref.Version)
+			}
+			var providerConfig ProviderConfig
+			if err := query.First(&providerConfig).Error; err != nil {
+				if err == gorm.ErrRecordNotFound {
+					result.Skipped = append(result.Skipped, fmt.Sprintf("provider %s/%s@%s 不存在", ref.Category, ref.Name, ref.Version))
+					continue
+				}
+				return fmt.Errorf("查询provider配置失败: %v", err)
+			}
+
+			var binding DeviceProvider
+			if err := tx.Where("device_id = ? AND category = ?", device.ID, ref.Category).
+				Assign(DeviceProvider{
+					ProviderID: providerConfig.ID,
+					IsActive:   true,
+				}).
+				FirstOrCreate(&binding).Error; err != nil {
+				return fmt.Errorf("绑定设备provider失败: %v", err)
+			}
+			result.AppliedProviders++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("设备配置导入完成: %s, 能力 %d 个, provider %d 个, 跳过 %d 项",
+		deviceUUID, result.AppliedCapabilities, result.AppliedProviders, len(result.Skipped))
+	return result, nil
+}
+
+// SaveDeviceEvent 保存设备上报的遥测/错误事件
+func (s *DeviceService) SaveDeviceEvent(event *DeviceEvent) error {
+	if event.ReportedAt.IsZero() {
+		event.ReportedAt = time.Now()
+	}
+	if err := s.db.DB.Create(event).Error; err != nil {
+		return fmt.Errorf("保存设备事件失败: %v", err)
+	}
+	return nil
+}
+
+// ListDeviceEvents 按条件查询最近的设备事件（按时间倒序）
+func (s *DeviceService) ListDeviceEvents(query DeviceEventQuery) ([]*DeviceEvent, error) {
+	if query.Limit <= 0 {
+		query.Limit = 50
+	}
+
+	db := s.db.DB.Model(&DeviceEvent{})
+	if query.DeviceID > 0 && query.DeviceKey != "" {
+		db = db.Where("device_id = ? OR device_key = ?", query.DeviceID, query.DeviceKey)
+	} else if query.DeviceID > 0 {
+		db = db.Where("device_id = ?", query.DeviceID)
+	} else if query.DeviceKey != "" {
+		db = db.Where("device_key = ?", query.DeviceKey)
+	}
+	if query.SessionID != "" {
+		db = db.Where("session_id = ?", query.SessionID)
+	}
+	if query.Level != "" {
+		db = db.Where("level = ?", query.Level)
+	}
+	if query.Category != "" {
+		db = db.Where("category = ?", query.Category)
+	}
+	if query.Since != nil {
+		db = db.Where("reported_at >= ?", *query.Since)
+	}
+
+	var events []*DeviceEvent
+	if err := db.Order("reported_at DESC").Limit(query.Limit).Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("查询设备事件失败: %v", err)
+	}
+	return events, nil
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ai-server-go/src/core/providers/schema"
+)
+
+/*
+* 环境变量覆盖：容器化部署时通过环境变量注入密钥和配置，不必写入数据库或配置文件。
+* 系统配置 <category>.<key> 对应 AISRV_CONFIG_<CATEGORY>_<KEY>，
+* provider参数 <name>.<field> 对应 AISRV_PROVIDER_<NAME>_<FIELD>（NAME为provider名称，对该名称的所有版本生效），
+* 名称转为大写，字母和数字以外的字符替换为下划线，例如 OpenAI 的 api_key 对应 AISRV_PROVIDER_OPENAI_API_KEY。
+* 覆盖只在读取时生效，环境变量的值不会写回数据库：系统配置列表和provider配置接口返回数据库中的值，
+* 按分类获取系统配置的接口返回实际生效的值。
+ */
+
+// EnvOverridePrefix 覆盖配置的环境变量前缀
+const EnvOverridePrefix = "AISRV_"
+
+// envName 将名称片段转换为环境变量名：大写，非字母数字替换为下划线
+func envName(parts ...string) string {
+	var b strings.Builder
+	b.WriteString(EnvOverridePrefix)
+	for i, part := range parts {
+		if i > 0 {
+			b.WriteByte('_')
+		}
+		for _, r := range strings.ToUpper(part) {
+			if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+				b.WriteRune(r)
+			} else {
+				b.WriteByte('_')
+			}
+		}
+	}
+	return b.String()
+}
+
+// SystemConfigEnvName 系统配置对应的环境变量名
+func SystemConfigEnvName(category, key string) string {
+	return envName("CONFIG", category, key)
+}
+
+// ProviderEnvPrefix provider参数对应的环境变量名前缀
+func ProviderEnvPrefix(name string) string {
+	return envName("PROVIDER", name) + "_"
+}
+
+// lookupSystemConfigEnv 读取系统配置的环境变量覆盖
+func lookupSystemConfigEnv(category, key string) (string, bool) {
+	return os.LookupEnv(SystemConfigEnvName(category, key))
+}
+
+// providerEnvOverrides 读取provider参数的环境变量覆盖，参数名与已知参数（props中已有的参数和类型说明中登记的参数）
+// 不区分大小写匹配，不认识的参数忽略，避免名称互为前缀的provider（如 OpenAI 与 OpenAI_Backup）相互干扰
+func providerEnvOverrides(name string, fields []string) map[string]string {
+	if strings.TrimSpace(name) == "" {
+		return nil
+	}
+	prefix := ProviderEnvPrefix(name)
+	overrides := make(map[string]string)
+	for _, entry := range os.Environ() {
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		for _, field := range fields {
+			if prefix+envName(field)[len(EnvOverridePrefix):] == key {
+				overrides[field] = value
+				break
+			}
+		}
+	}
+	return overrides
+}
+
+// envOverrideFields provider可被环境变量覆盖的参数
+func (c *ProviderConfig) envOverrideFields(props map[string]interface{}) []string {
+	fields := make([]string, 0, len(props))
+	for field := range props {
+		fields = append(fields, field)
+	}
+	if s, ok := schema.Get(c.Category, c.Type); ok {
+		for _, field := range s.Fields {
+			if _, exists := props[field.Name]; !exists {
+				fields = append(fields, field.Name)
+			}
+		}
+	}
+	return fields
+}
+
+// applyEnvOverrides 用环境变量覆盖props中的参数，已有参数为数字或布尔值时按原类型解析
+func (c *ProviderConfig) applyEnvOverrides(props map[string]interface{}) {
+	for field, value := range providerEnvOverrides(c.Name, c.envOverrideFields(props)) {
+		switch props[field].(type) {
+		case float64:
+			if v, err := strconv.ParseFloat(value, 64); err == nil {
+				props[field] = v
+				continue
+			}
+		case bool:
+			if v, err := strconv.ParseBool(value); err == nil {
+				props[field] = v
+				continue
+			}
+		}
+		props[field] = value
+	}
+}
+
+// EnvOverrideNames 列出当前生效的覆盖环境变量名（不含值），用于启动日志
+func EnvOverrideNames() []string {
+	var names []string
+	for _, entry := range os.Environ() {
+		key, _, _ := strings.Cut(entry, "=")
+		if strings.HasPrefix(key, EnvOverridePrefix+"CONFIG_") || strings.HasPrefix(key, EnvOverridePrefix+"PROVIDER_") {
+			names = append(names, key)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"slices"
+)
+
+// featureFlagCategory 功能开关在系统配置中的分类，配置键为开关名称，值为 FeatureFlag 的JSON
+const featureFlagCategory = "feature_flags"
+
+// FeatureFlag 功能开关：按设备ID哈希分桶灰度放量，白名单设备始终启用
+type FeatureFlag struct {
+	Name           string   `json:"name,omitempty"`
+	Enabled        bool     `json:"enabled"`         // 总开关，关闭时白名单设备也不启用
+	RolloutPercent int      `json:"rollout_percent"` // 放量比例（0-100）
+	AllowDevices   []string `json:"allow_devices"`   // 始终启用的设备ID
+}
+
+// GetFeatureFlag 获取功能开关，未配置时返回nil
+func (s *ConfigService) GetFeatureFlag(name string) (*FeatureFlag, error) {
+	config, err := s.GetSystemConfig(featureFlagCategory, name)
+	if err != nil || config == nil {
+		return nil, err
+	}
+	var flag FeatureFlag
+	if err := json.Unmarshal([]byte(config.ConfigValue), &flag); err != nil {
+		return nil, fmt.Errorf("解析功能开关 %s 失败: %v", name, err)
+	}
+	flag.Name = name
+	return &flag, nil
+}
+
+// ListFeatureFlags 获取所有功能开关
+func (s *ConfigService) ListFeatureFlags() ([]FeatureFlag, error) {
+	configs, err := s.ListSystemConfigs(featureFlagCategory)
+	if err != nil {
+		return nil, err
+	}
+	flags := make([]FeatureFlag, 0, len(configs))
+	for _, config := range configs {
+		var flag FeatureFlag
+		if err := json.Unmarshal([]byte(config.ConfigValue), &flag); err != nil {
+			s.logger.Warn("解析功能开关 %s 失败: %v", config.ConfigKey, err)
+			continue
+		}
+		flag.Name = config.ConfigKey
+		flags = append(flags, flag)
+	}
+	return flags, nil
+}
+
+// SetFeatureFlag 创建或更新功能开关
+func (s *ConfigService) SetFeatureFlag(flag FeatureFlag, updatedBy *uint) error {
+	if flag.Name == "" {
+		return fmt.Errorf("功能开关名称不能为空")
+	}
+	if flag.RolloutPercent < 0 || flag.RolloutPercent > 100 {
+		return fmt.Errorf("rollout_percent 必须在 0-100 之间")
+	}
+	if flag.AllowDevices == nil {
+		flag.AllowDevices = []string{}
+	}
+	name := flag.Name
+	flag.Name = ""
+	data, err := json.Marshal(flag)
+	if err != nil {
+		return fmt.Errorf("序列化功能开关失败: %v", err)
+	}
+	description := fmt.Sprintf("功能开关 %s", name)
+	if existing, err := s.GetSystemConfig(featureFlagCategory, name); err == nil && existing != nil && existing.Description != "" {
+		description = existing.Description
+	}
+	return s.SetSystemConfig(featureFlagCategory, name, string(data), "json", description, true, updatedBy, updatedBy)
+}
+
+// IsFeatureEnabled 判断功能开关对设备是否启用：白名单设备始终启用，其余设备按 flag+设备ID 的哈希稳定分桶，
+// 桶号小于放量比例时启用。未配置的开关视为关闭。
+func (s *ConfigService) IsFeatureEnabled(flag string, deviceUUID string) bool {
+	featureFlag, err := s.GetFeatureFlag(flag)
+	if err != nil {
+		s.logger.Warn("%v", err)
+		return false
+	}
+	return featureFlag.EnabledFor(deviceUUID)
+}
+
+// EnabledFor 判断开关对设备是否启用
+func (f *FeatureFlag) EnabledFor(deviceUUID string) bool {
+	if f == nil || !f.Enabled {
+		return false
+	}
+	if deviceUUID != "" && slices.Contains(f.AllowDevices, deviceUUID) {
+		return true
+	}
+	return featureBucket(f.Name, deviceUUID) < f.RolloutPercent
+}
+
+// featureBucket 计算设备在开关下的分桶（0-99），同一设备在同一开关下结果固定
+func featureBucket(flag string, deviceUUID string) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(flag + ":" + deviceUUID))
+	return int(hash.Sum32() % 100)
+}
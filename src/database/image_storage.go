@@ -0,0 +1,237 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"ai-server-go/src/configs"
+	"ai-server-go/src/core/scheduler"
+	"ai-server-go/src/core/utils"
+
+	"gorm.io/gorm"
+)
+
+/*
+* 设备上传的视觉图片存储：图片内容写入 BlobStore，数据库只保存元数据，聊天消息附件以 blob:<key> 引用。
+* 每张图片在写入时按 image_storage.retention_hours 计算过期时间，后台任务定期删除过期图片；
+* 用户可以一次清除自己的全部图片。图片内容只能通过鉴权的单张读取接口获取，列表接口只返回引用。
+ */
+
+// BlobRefPrefix 附件引用中存储图片的前缀
+const BlobRefPrefix = "blob:"
+
+// imageCleanupInterval 后台清理过期图片的间隔
+const imageCleanupInterval = 10 * time.Minute
+
+// imageFileExtensions 允许存储的图片类型及其文件扩展名，其他类型（如 text/html、image/svg+xml）拒绝存储
+var imageFileExtensions = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+}
+
+// ImageFileExtension 返回允许存储的图片类型的文件扩展名，不允许的类型返回false
+func ImageFileExtension(mimeType string) (string, bool) {
+	ext, ok := imageFileExtensions[mimeType]
+	return ext, ok
+}
+
+// StoredImage 存储的图片元数据，内容保存在 BlobStore 中
+type StoredImage struct {
+	gorm.Model
+	Key       string     `json:"key" gorm:"size:64;uniqueIndex;not null"`
+	UserID    *uint      `json:"user_id" gorm:"index"`
+	DeviceID  uint       `json:"device_id" gorm:"index"`
+	SessionID string     `json:"session_id" gorm:"size:100;index"`
+	MimeType  string     `json:"mime_type" gorm:"size:50"`
+	Size      int        `json:"size"`
+	ExpiresAt *time.Time `json:"expires_at" gorm:"index"` // 为空表示不过期，直到用户清除
+}
+
+// ImageStore 图片存储服务
+type ImageStore struct {
+	db     *gorm.DB
+	blobs  BlobStore
+	logger *utils.Logger
+}
+
+// NewImageStore 创建图片存储服务
+func NewImageStore(db *gorm.DB, blobs BlobStore, logger *utils.Logger) *ImageStore {
+	return &ImageStore{db: db, blobs: blobs, logger: logger}
+}
+
+// NewImageStoreWithConfig 按配置文件 blob_store 创建图片存储服务
+func NewImageStoreWithConfig(db *gorm.DB, config configs.BlobStoreConfig, logger *utils.Logger) (*ImageStore, error) {
+	blobs, err := NewBlobStore(config, logger)
+	if err != nil {
+		return nil, err
+	}
+	return NewImageStore(db, blobs, logger), nil
+}
+
+// BlobRefKey 从附件引用中取出存储图片的key，不是存储图片时返回false
+func BlobRefKey(ref string) (string, bool) {
+	if !strings.HasPrefix(ref, BlobRefPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(ref, BlobRefPrefix), true
+}
+
+// SaveDataURL 保存data URL形式的图片，返回附件引用 blob:<key>；retention 为0表示不过期
+func (s *ImageStore) SaveDataURL(userID *uint, deviceID uint, sessionID, dataURL string, retention time.Duration) (string, error) {
+	mimeType, data, err := decodeDataURL(dataURL)
+	if err != nil {
+		return "", err
+	}
+
+	keyBytes := make([]byte, 16)
+	if _, err := rand.Read(keyBytes); err != nil {
+		return "", fmt.Errorf("生成图片key失败: %v", err)
+	}
+	image := &StoredImage{
+		Key:       hex.EncodeToString(keyBytes),
+		UserID:    userID,
+		DeviceID:  deviceID,
+		SessionID: sessionID,
+		MimeType:  mimeType,
+		Size:      len(data),
+	}
+	if retention > 0 {
+		expiresAt := time.Now().Add(retention)
+		image.ExpiresAt = &expiresAt
+	}
+
+	if err := s.blobs.Put(image.Key, data); err != nil {
+		return "", fmt.Errorf("保存图片失败: %v", err)
+	}
+	if err := s.db.Create(image).Error; err != nil {
+		_ = s.blobs.Delete(image.Key)
+		return "", fmt.Errorf("保存图片记录失败: %v", err)
+	}
+	return BlobRefPrefix + image.Key, nil
+}
+
+// GetImage 读取未过期的图片元数据和内容
+func (s *ImageStore) GetImage(key string) (*StoredImage, []byte, error) {
+	var image StoredImage
+	if err := s.db.Where(&StoredImage{Key: key}).First(&image).Error; err != nil {
+		return nil, nil, fmt.Errorf("图片不存在: %v", err)
+	}
+	if image.ExpiresAt != nil && image.ExpiresAt.Before(time.Now()) {
+		return nil, nil, errors.New("图片已过期")
+	}
+	data, err := s.blobs.Get(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &image, data, nil
+}
+
+// DataURL 将存储图片还原为data URL，用于恢复会话时重新提供给视觉模型
+func (s *ImageStore) DataURL(key string) (string, error) {
+	image, data, err := s.GetImage(key)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("data:%s;base64,%s", image.MimeType, base64.StdEncoding.EncodeToString(data)), nil
+}
+
+// ListUserImages 列出用户的图片元数据（不含内容）
+func (s *ImageStore) ListUserImages(userID uint, limit int) ([]StoredImage, error) {
+	var images []StoredImage
+	query := s.db.Where("user_id = ?", userID).Order("created_at DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Find(&images).Error; err != nil {
+		return nil, fmt.Errorf("获取图片列表失败: %v", err)
+	}
+	return images, nil
+}
+
+// PurgeUserImages 删除用户的全部图片，返回删除数量
+func (s *ImageStore) PurgeUserImages(userID uint) (int, error) {
+	var images []StoredImage
+	if err := s.db.Where("user_id = ?", userID).Find(&images).Error; err != nil {
+		return 0, fmt.Errorf("查询用户图片失败: %v", err)
+	}
+	return s.deleteImages(context.Background(), images)
+}
+
+// DeleteExpiredImages 删除已过期的图片，返回删除数量
+func (s *ImageStore) DeleteExpiredImages(ctx context.Context) (int, error) {
+	var images []StoredImage
+	if err := s.db.WithContext(ctx).Where("expires_at IS NOT NULL AND expires_at < ?", time.Now()).
+		Find(&images).Error; err != nil {
+		return 0, fmt.Errorf("查询过期图片失败: %v", err)
+	}
+	return s.deleteImages(ctx, images)
+}
+
+// deleteImages 删除图片内容和记录，内容删除失败的记录保留到下次清理
+func (s *ImageStore) deleteImages(ctx context.Context, images []StoredImage) (int, error) {
+	ids := make([]uint, 0, len(images))
+	for _, image := range images {
+		if err := s.blobs.Delete(image.Key); err != nil {
+			s.logger.Warn("删除图片 %s 失败: %v", image.Key, err)
+			continue
+		}
+		ids = append(ids, image.ID)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	if err := s.db.WithContext(ctx).Unscoped().Delete(&StoredImage{}, ids).Error; err != nil {
+		return 0, fmt.Errorf("删除图片记录失败: %v", err)
+	}
+	return len(ids), nil
+}
+
+// ImageRetentionJob 定期删除过期图片的任务，由调度器执行
+func (s *ImageStore) ImageRetentionJob() scheduler.Job {
+	return scheduler.Job{
+		Name:     "image-retention",
+		Interval: imageCleanupInterval,
+		Run: func(ctx context.Context) error {
+			count, err := s.DeleteExpiredImages(ctx)
+			if err != nil {
+				return fmt.Errorf("清理过期图片失败: %v", err)
+			}
+			if count > 0 {
+				s.logger.Info("删除%d张过期图片", count)
+			}
+			return nil
+		},
+	}
+}
+
+// decodeDataURL 解析base64编码的data URL，只接受 jpeg、png、gif、webp 图片
+func decodeDataURL(dataURL string) (string, []byte, error) {
+	if !strings.HasPrefix(dataURL, "data:") {
+		return "", nil, errors.New("不是data URL")
+	}
+	comma := strings.Index(dataURL, ",")
+	if comma < 0 {
+		return "", nil, errors.New("data URL格式错误")
+	}
+	header := dataURL[len("data:"):comma]
+	if !strings.HasSuffix(header, ";base64") {
+		return "", nil, errors.New("data URL不是base64编码")
+	}
+	mimeType := strings.ToLower(strings.TrimSuffix(header, ";base64"))
+	if _, ok := imageFileExtensions[mimeType]; !ok {
+		return "", nil, fmt.Errorf("不支持的图片类型: %q", mimeType)
+	}
+	data, err := base64.StdEncoding.DecodeString(dataURL[comma+1:])
+	if err != nil {
+		return "", nil, fmt.Errorf("解码图片数据失败: %v", err)
+	}
+	return mimeType, data, nil
+}
@@ -0,0 +1,25 @@
+package database
+
+import "testing"
+
+func TestDecodeDataURLAcceptsImages(t *testing.T) {
+	mimeType, data, err := decodeDataURL("data:IMAGE/PNG;base64,iVBORw0KGgo=")
+	if err != nil {
+		t.Fatalf("PNG图片应被接受: %v", err)
+	}
+	if mimeType != "image/png" || len(data) != 8 {
+		t.Fatalf("解析结果为 %s（%d 字节），期望 image/png（8 字节）", mimeType, len(data))
+	}
+}
+
+func TestDecodeDataURLRejectsOtherTypes(t *testing.T) {
+	for _, dataURL := range []string{
+		"data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==",
+		"data:image/svg+xml;base64,PHN2Zy8+",
+		"data:;base64,AAAA",
+	} {
+		if _, _, err := decodeDataURL(dataURL); err == nil {
+			t.Fatalf("%s 不是允许的图片类型，应被拒绝", dataURL)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ImpersonationAudit 模拟登录审计记录：签发、退出以及模拟期间的每个请求
+type ImpersonationAudit struct {
+	gorm.Model
+	AdminID  uint   `json:"admin_id" gorm:"not null;index"` // 实际操作的管理员
+	UserID   uint   `json:"user_id" gorm:"not null;index"`  // 被模拟的用户
+	AuthID   uint   `json:"auth_id" gorm:"index"`           // 模拟登录令牌的认证记录ID
+	Action   string `json:"action" gorm:"size:20;not null"` // start（签发）, request（请求）, exit（退出）
+	Method   string `json:"method" gorm:"size:10"`
+	Path     string `json:"path" gorm:"size:255"`
+	Status   int    `json:"status"`
+	ClientIP string `json:"client_ip" gorm:"size:45"`
+}
+
+// CreateImpersonationAuth 为管理员签发模拟指定用户的短期令牌
+func (s *UserService) CreateImpersonationAuth(adminID, userID uint, ttl time.Duration) (*UserAuth, error) {
+	token, err := s.generateToken()
+	if err != nil {
+		return nil, fmt.Errorf("生成令牌失败: %v", err)
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	auth := &UserAuth{
+		UserID:         userID,
+		AuthType:       "impersonation",
+		AuthKey:        token,
+		IsActive:       true,
+		ExpiresAt:      &expiresAt,
+		ImpersonatorID: &adminID,
+	}
+	if err := s.db.DB.Create(auth).Error; err != nil {
+		return nil, fmt.Errorf("创建模拟登录令牌失败: %v", err)
+	}
+	return auth, nil
+}
+
+// RecordImpersonationAudit 保存模拟登录审计记录
+func (s *UserService) RecordImpersonationAudit(audit *ImpersonationAudit) error {
+	if err := s.db.DB.Create(audit).Error; err != nil {
+		return fmt.Errorf("保存模拟登录审计记录失败: %v", err)
+	}
+	return nil
+}
+
+// ListImpersonationAudits 按时间倒序查询模拟登录审计记录，adminID/userID为0时不过滤
+func (s *UserService) ListImpersonationAudits(adminID, userID uint, offset, limit int) ([]*ImpersonationAudit, int64, error) {
+	query := s.db.DB.Model(&ImpersonationAudit{})
+	if adminID > 0 {
+		query = query.Where("admin_id = ?", adminID)
+	}
+	if userID > 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("统计模拟登录审计记录失败: %v", err)
+	}
+	var audits []*ImpersonationAudit
+	if err := query.Order("id DESC").Offset(offset).Limit(limit).Find(&audits).Error; err != nil {
+		return nil, 0, fmt.Errorf("查询模拟登录审计记录失败: %v", err)
+	}
+	return audits, total, nil
+}
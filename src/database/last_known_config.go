@@ -0,0 +1,88 @@
+package database
+
+import (
+	"sync"
+)
+
+/*
+* 最近一次成功读取的配置：系统配置和provider配置每次读取成功后记录一份，
+* 数据库临时不可用（熔断或重试后仍失败）时对话流水线改用这份配置，而不是让连接失败；
+* 从未读取过的配置仍返回错误，由调用方使用默认值。
+ */
+
+// lastKnownConfigs 进程内共享的最近一次成功读取的配置
+var lastKnownConfigs = struct {
+	sync.RWMutex
+	systemConfigs map[string][]SystemConfig // 分类 -> 系统配置
+	providers     map[string]ProviderConfig // 类别/名称 -> provider配置，默认provider的名称为空
+}{
+	systemConfigs: make(map[string][]SystemConfig),
+	providers:     make(map[string]ProviderConfig),
+}
+
+// rememberSystemConfigs 记录读取成功的系统配置，按分类整体替换
+func rememberSystemConfigs(configs []*SystemConfig) {
+	byCategory := make(map[string][]SystemConfig)
+	for _, config := range configs {
+		byCategory[config.ConfigCategory] = append(byCategory[config.ConfigCategory], *config)
+	}
+	lastKnownConfigs.Lock()
+	defer lastKnownConfigs.Unlock()
+	for category, list := range byCategory {
+		lastKnownConfigs.systemConfigs[category] = list
+	}
+}
+
+// lastKnownSystemConfigs 最近一次读取的系统配置，category为空时返回全部分类
+func lastKnownSystemConfigs(category string) ([]*SystemConfig, bool) {
+	lastKnownConfigs.RLock()
+	defer lastKnownConfigs.RUnlock()
+	var result []*SystemConfig
+	found := false
+	for cat, list := range lastKnownConfigs.systemConfigs {
+		if category != "" && cat != category {
+			continue
+		}
+		found = true
+		for i := range list {
+			config := list[i]
+			result = append(result, &config)
+		}
+	}
+	return result, found
+}
+
+// lastKnownSystemConfig 最近一次读取的单项系统配置
+func lastKnownSystemConfig(category, key string) (*SystemConfig, bool) {
+	configs, ok := lastKnownSystemConfigs(category)
+	if !ok {
+		return nil, false
+	}
+	for _, config := range configs {
+		if config.ConfigKey == key {
+			return config, true
+		}
+	}
+	return nil, true
+}
+
+// rememberProvider 记录读取成功的provider配置
+func rememberProvider(category, name string, config *ProviderConfig) {
+	if config == nil {
+		return
+	}
+	lastKnownConfigs.Lock()
+	defer lastKnownConfigs.Unlock()
+	lastKnownConfigs.providers[category+"/"+name] = *config
+}
+
+// lastKnownProvider 最近一次读取的provider配置
+func lastKnownProvider(category, name string) (*ProviderConfig, bool) {
+	lastKnownConfigs.RLock()
+	defer lastKnownConfigs.RUnlock()
+	config, ok := lastKnownConfigs.providers[category+"/"+name]
+	if !ok {
+		return nil, false
+	}
+	return &config, true
+}
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"sync"
+	"time"
+)
+
+// 维护模式状态缓存TTL，通过接口修改配置时会立即刷新
+const maintenanceCacheTTL = 5 * time.Second
+
+const defaultMaintenanceMessage = "系统正在维护中，请稍后再试"
+
+// MaintenanceStatus 维护模式状态
+type MaintenanceStatus struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message"`
+}
+
+// maintenanceCache 进程内共享的维护模式状态（各连接使用独立的ConfigService实例）
+var maintenanceCache struct {
+	sync.RWMutex
+	status   MaintenanceStatus
+	loadedAt time.Time
+}
+
+// GetMaintenanceStatus 获取维护模式状态，缓存过期后从数据库重新加载
+func (s *ConfigService) GetMaintenanceStatus() MaintenanceStatus {
+	maintenanceCache.RLock()
+	status, loadedAt := maintenanceCache.status, maintenanceCache.loadedAt
+	maintenanceCache.RUnlock()
+
+	if !loadedAt.IsZero() && time.Since(loadedAt) < maintenanceCacheTTL {
+		return status
+	}
+	return s.ReloadMaintenanceStatus()
+}
+
+// ReloadMaintenanceStatus 从数据库重新加载维护模式状态
+func (s *ConfigService) ReloadMaintenanceStatus() MaintenanceStatus {
+	status := MaintenanceStatus{Message: defaultMaintenanceMessage}
+	if enabled, err := s.GetSystemConfigBool("maintenance", "enabled"); err == nil {
+		status.Enabled = enabled
+	}
+	if message, err := s.GetSystemConfigValue("maintenance", "message"); err == nil && message != "" {
+		status.Message = message
+	}
+
+	maintenanceCache.Lock()
+	previous := maintenanceCache.status
+	maintenanceCache.status = status
+	maintenanceCache.loadedAt = time.Now()
+	maintenanceCache.Unlock()
+
+	if previous.Enabled != status.Enabled {
+		s.logger.Info("维护模式状态变更: enabled=%t", status.Enabled)
+	}
+	return status
+}
+
+// onSystemConfigChanged 系统配置变更后刷新相关缓存
+func (s *ConfigService) onSystemConfigChanged(category string) {
+	if category == "maintenance" {
+		s.ReloadMaintenanceStatus()
+	}
+}
@@ -0,0 +1,138 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"ai-server-go/src/configs"
+)
+
+/*
+* 记忆数量上限：每台设备最多保留 max_per_device 条有效记忆，超出的部分由后台任务定期淘汰。
+* 淘汰顺序为重要性低、使用次数少、最久未使用（从未使用按创建时间）的记忆优先；重要性不低于 pin_importance 的记忆不淘汰。
+* 淘汰为软删除，不再参与查询和统计。只对SQL记忆存储生效。
+ */
+
+const (
+	defaultMemoryMaxPerDevice  = 500
+	defaultMemoryPinImportance = 8
+	defaultMemoryCapInterval   = 600 * time.Second
+)
+
+// memoryCapPolicy 记忆数量上限策略
+type memoryCapPolicy struct {
+	maxPerDevice  int // 小于0表示不限制
+	pinImportance int
+	interval      time.Duration
+}
+
+// newMemoryCapPolicy 根据配置创建上限策略，未配置的字段使用默认值
+func newMemoryCapPolicy(config configs.MemoryCapConfig) memoryCapPolicy {
+	policy := memoryCapPolicy{
+		maxPerDevice:  defaultMemoryMaxPerDevice,
+		pinImportance: defaultMemoryPinImportance,
+		interval:      defaultMemoryCapInterval,
+	}
+	if config.MaxPerDevice != 0 {
+		policy.maxPerDevice = config.MaxPerDevice
+	}
+	if config.PinImportance > 0 {
+		policy.pinImportance = config.PinImportance
+	}
+	if config.Interval > 0 {
+		policy.interval = time.Duration(config.Interval) * time.Second
+	}
+	return policy
+}
+
+// CompactMemories 淘汰超出上限的记忆，返回淘汰的数量
+func (s *ChatMemoryService) CompactMemories(ctx context.Context) (int, error) {
+	if s.capacity.maxPerDevice < 0 {
+		return 0, nil
+	}
+	if _, ok := s.store.(*SQLMemoryStore); !ok {
+		return 0, nil
+	}
+
+	var devices []struct {
+		DeviceID uint
+		Count    int
+	}
+	if err := s.db.WithContext(ctx).Model(&ChatMemory{}).
+		Select("device_id, count(*) as count").
+		Where("is_active = ?", true).
+		Group("device_id").
+		Having("count(*) > ?", s.capacity.maxPerDevice).
+		Scan(&devices).Error; err != nil {
+		return 0, fmt.Errorf("统计设备记忆数量失败: %v", err)
+	}
+
+	evicted := 0
+	for _, device := range devices {
+		if ctx.Err() != nil {
+			return evicted, ctx.Err()
+		}
+		count, err := s.evictDeviceMemories(ctx, device.DeviceID, device.Count-s.capacity.maxPerDevice)
+		if err != nil {
+			return evicted, err
+		}
+		if count < device.Count-s.capacity.maxPerDevice {
+			s.logger.Warn("设备 %d 的高重要性记忆超过上限，保留 %d 条", device.DeviceID, device.Count-count)
+		}
+		evicted += count
+	}
+	return evicted, nil
+}
+
+// evictDeviceMemories 淘汰设备最不重要的excess条记忆，固定的高重要性记忆不参与
+func (s *ChatMemoryService) evictDeviceMemories(ctx context.Context, deviceID uint, excess int) (int, error) {
+	var ids []uint
+	if err := s.db.WithContext(ctx).Model(&ChatMemory{}).
+		Where("device_id = ? AND is_active = ? AND importance < ?", deviceID, true, s.capacity.pinImportance).
+		Order("importance ASC, use_count ASC, COALESCE(last_used, created_at) ASC").
+		Limit(excess).
+		Pluck("id", &ids).Error; err != nil {
+		return 0, fmt.Errorf("查询设备 %d 待淘汰记忆失败: %v", deviceID, err)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	if err := s.db.WithContext(ctx).Delete(&ChatMemory{}, ids).Error; err != nil {
+		return 0, fmt.Errorf("淘汰设备 %d 的记忆失败: %v", deviceID, err)
+	}
+	return len(ids), nil
+}
+
+// StartMemoryCompactor 启动后台任务，按 interval 定期淘汰超出上限的记忆，ctx取消时退出
+func (s *ChatMemoryService) StartMemoryCompactor(ctx context.Context) {
+	if s.capacity.maxPerDevice < 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(s.capacity.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				count, err := s.CompactMemories(ctx)
+				if err != nil {
+					s.logger.Warn("整理记忆失败: %v", err)
+				} else if count > 0 {
+					s.logger.Info("淘汰%d条超出上限的记忆", count)
+				}
+			}
+		}
+	}()
+}
+
+// deviceMemoryCount 设备当前的有效记忆数（与上限比较，不区分用户）
+func (s *ChatMemoryService) deviceMemoryCount(deviceID uint) int64 {
+	var count int64
+	if err := s.db.Model(&ChatMemory{}).Where("device_id = ? AND is_active = ?", deviceID, true).Count(&count).Error; err != nil {
+		s.logger.Warn("统计设备 %d 的记忆数量失败: %v", deviceID, err)
+	}
+	return count
+}
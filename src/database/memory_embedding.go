@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// SetEmbedder 设置记忆向量化提供者，传入nil时恢复为关键词/重要性查询
+func (s *SQLMemoryStore) SetEmbedder(embedder Embedder) {
+	s.embedder = embedder
+}
+
+// HasEmbedder 是否已配置向量化提供者
+func (s *SQLMemoryStore) HasEmbedder() bool {
+	return s.embedder != nil
+}
+
+// embed 调用向量化提供者，校验返回数量
+func (s *SQLMemoryStore) embed(texts []string) ([][]float32, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), embeddingTimeout)
+	defer cancel()
+
+	vectors, err := s.embedder.Embed(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("向量数量不匹配: 期望 %d, 实际 %d", len(texts), len(vectors))
+	}
+	for i, vector := range vectors {
+		if len(vector) == 0 {
+			return nil, fmt.Errorf("第 %d 条文本向量为空", i)
+		}
+	}
+	return vectors, nil
+}
+
+// querySemanticMemories 按与查询文本的余弦相似度排序记忆；缺少向量的旧记忆会补算并回写
+func (s *SQLMemoryStore) querySemanticMemories(userID *uint, deviceID uint, query string, limit int) ([]ChatMemory, error) {
+	var candidates []ChatMemory
+	dbQuery := s.db.Where("is_active = ?", true)
+	if userID != nil {
+		dbQuery = dbQuery.Where("(user_id = ? OR user_id IS NULL) AND device_id = ?", *userID, deviceID)
+	} else {
+		dbQuery = dbQuery.Where("device_id = ?", deviceID)
+	}
+	if err := dbQuery.Order("importance DESC, updated_at DESC").Limit(semanticCandidateLimit).Find(&candidates).Error; err != nil {
+		return nil, fmt.Errorf("查询记忆失败: %v", err)
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	// 查询文本和缺少向量的记忆一起向量化
+	texts := []string{query}
+	var missing []int
+	for i := range candidates {
+		if decodeEmbedding(candidates[i].Embedding) == nil {
+			missing = append(missing, i)
+			texts = append(texts, candidates[i].Content)
+		}
+	}
+	vectors, err := s.embed(texts)
+	if err != nil {
+		return nil, err
+	}
+	queryVector := vectors[0]
+	for j, i := range missing {
+		candidates[i].Embedding = encodeEmbedding(vectors[j+1])
+		s.db.Model(&ChatMemory{}).Where("id = ?", candidates[i].ID).Update("embedding", candidates[i].Embedding)
+	}
+
+	type scoredMemory struct {
+		memory ChatMemory
+		score  float64
+	}
+	scored := make([]scoredMemory, 0, len(candidates))
+	for _, memory := range candidates {
+		scored = append(scored, scoredMemory{
+			memory: memory,
+			score:  cosineSimilarity(queryVector, decodeEmbedding(memory.Embedding)),
+		})
+	}
+	sort.SliceStable(scored, func(i, j int) bool {
+		return scored[i].score > scored[j].score
+	})
+
+	if len(scored) > limit {
+		scored = scored[:limit]
+	}
+	memories := make([]ChatMemory, 0, len(scored))
+	for _, item := range scored {
+		memories = append(memories, item.memory)
+	}
+	return memories, nil
+}
+
+// encodeEmbedding 向量序列化为JSON字符串
+func encodeEmbedding(vector []float32) string {
+	data, err := json.Marshal(vector)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// decodeEmbedding 解析JSON向量，为空或格式错误时返回nil
+func decodeEmbedding(value string) []float32 {
+	if value == "" {
+		return nil
+	}
+	var vector []float32
+	if err := json.Unmarshal([]byte(value), &vector); err != nil || len(vector) == 0 {
+		return nil
+	}
+	return vector
+}
+
+// cosineSimilarity 计算余弦相似度，维度不一致（更换过模型）时返回-1
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return -1
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return -1
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
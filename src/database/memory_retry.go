@@ -0,0 +1,228 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"ai-server-go/src/configs"
+	"ai-server-go/src/core/chat"
+
+	"gorm.io/gorm"
+)
+
+/*
+* 记忆生成重试：生成失败时按指数退避重试，仍失败则把对话写入 PendingMemory（死信），
+* 由后台任务定期重新处理；重新处理超过 dead_letter_retries 次后标记为 failed，不再重试。
+ */
+
+const (
+	defaultMemoryMaxAttempts       = 3
+	defaultMemoryBackoff           = 500 * time.Millisecond
+	defaultMemoryDeadLetterRetries = 5
+	defaultMemoryWorkerInterval    = 60 * time.Second
+	maxMemoryRetryBackoff          = 30 * time.Minute // 死信重试间隔上限
+	pendingMemoryBatchSize         = 20               // 后台任务每次处理的死信数量
+)
+
+// memoryRetryPolicy 记忆生成重试策略
+type memoryRetryPolicy struct {
+	maxAttempts       int
+	backoff           time.Duration
+	deadLetterRetries int
+	workerInterval    time.Duration
+}
+
+// newMemoryRetryPolicy 根据配置创建重试策略，未配置的字段使用默认值
+func newMemoryRetryPolicy(config configs.MemoryRetryConfig) memoryRetryPolicy {
+	policy := memoryRetryPolicy{
+		maxAttempts:       defaultMemoryMaxAttempts,
+		backoff:           defaultMemoryBackoff,
+		deadLetterRetries: defaultMemoryDeadLetterRetries,
+		workerInterval:    defaultMemoryWorkerInterval,
+	}
+	if config.MaxAttempts > 0 {
+		policy.maxAttempts = config.MaxAttempts
+	}
+	if config.BackoffMs > 0 {
+		policy.backoff = time.Duration(config.BackoffMs) * time.Millisecond
+	}
+	if config.DeadLetterRetries > 0 {
+		policy.deadLetterRetries = config.DeadLetterRetries
+	}
+	if config.WorkerInterval > 0 {
+		policy.workerInterval = time.Duration(config.WorkerInterval) * time.Second
+	}
+	return policy
+}
+
+// backoffDelay 第attempt次失败后的等待时间：base * 2^(attempt-1)，不超过上限
+func backoffDelay(base time.Duration, attempt int) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < maxMemoryRetryBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxMemoryRetryBackoff)
+}
+
+// GenerateMemoryFromDialogue 从对话历史生成记忆，失败时按退避重试，仍失败则写入待重试记录
+func (s *ChatMemoryService) GenerateMemoryFromDialogue(ctx context.Context, userID *uint, deviceID uint, sessionID string, dialogue []chat.Message) error {
+	if len(dialogue) == 0 {
+		return nil
+	}
+
+	var err error
+	for attempt := 1; attempt <= s.retry.maxAttempts; attempt++ {
+		if err = s.store.GenerateMemoryFromDialogue(ctx, userID, deviceID, sessionID, dialogue); err == nil {
+			return nil
+		}
+		if attempt == s.retry.maxAttempts {
+			break
+		}
+		delay := backoffDelay(s.retry.backoff, attempt)
+		s.logger.Warn("生成对话记忆失败（第%d次），%v后重试: %v", attempt, delay, err)
+		if !sleepContext(ctx, delay) {
+			break
+		}
+	}
+
+	if saveErr := s.savePendingMemory(userID, deviceID, sessionID, dialogue, err); saveErr != nil {
+		return fmt.Errorf("生成对话记忆失败: %v，保存待重试记录失败: %v", err, saveErr)
+	}
+	return fmt.Errorf("生成对话记忆失败，已保存待重试记录: %v", err)
+}
+
+// sleepContext 等待指定时间，ctx取消时提前返回false
+func sleepContext(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// savePendingMemory 把生成失败的对话写入待重试记录
+func (s *ChatMemoryService) savePendingMemory(userID *uint, deviceID uint, sessionID string, dialogue []chat.Message, cause error) error {
+	data, err := json.Marshal(dialogue)
+	if err != nil {
+		return fmt.Errorf("序列化对话失败: %v", err)
+	}
+	pending := &PendingMemory{
+		UserID:      userID,
+		DeviceID:    deviceID,
+		SessionID:   sessionID,
+		Dialogue:    string(data),
+		Status:      "pending",
+		LastError:   truncateError(cause),
+		NextRetryAt: time.Now().Add(s.retry.workerInterval),
+	}
+	if err := s.db.Create(pending).Error; err != nil {
+		return fmt.Errorf("保存待重试记忆失败: %v", err)
+	}
+	return nil
+}
+
+// truncateError 截断错误信息以适配 last_error 字段长度
+func truncateError(err error) string {
+	if err == nil {
+		return ""
+	}
+	message := []rune(err.Error())
+	if len(message) > 200 {
+		message = message[:200]
+	}
+	return string(message)
+}
+
+// ProcessPendingMemories 重新处理到期的待重试记忆，返回成功生成的数量
+func (s *ChatMemoryService) ProcessPendingMemories(ctx context.Context) (int, error) {
+	var pending []PendingMemory
+	if err := s.db.Where("status = ? AND next_retry_at <= ?", "pending", time.Now()).
+		Order("next_retry_at ASC").Limit(pendingMemoryBatchSize).Find(&pending).Error; err != nil {
+		return 0, fmt.Errorf("查询待重试记忆失败: %v", err)
+	}
+
+	succeeded := 0
+	for i := range pending {
+		if ctx.Err() != nil {
+			break
+		}
+		item := &pending[i]
+
+		var dialogue []chat.Message
+		err := json.Unmarshal([]byte(item.Dialogue), &dialogue)
+		if err != nil {
+			err = fmt.Errorf("解析对话失败: %v", err)
+		} else {
+			err = s.store.GenerateMemoryFromDialogue(ctx, item.UserID, item.DeviceID, item.SessionID, dialogue)
+		}
+
+		if err == nil {
+			if delErr := s.db.Unscoped().Delete(item).Error; delErr != nil {
+				s.logger.Warn("删除待重试记忆 %d 失败: %v", item.ID, delErr)
+			}
+			succeeded++
+			continue
+		}
+		s.markPendingMemoryFailed(item, err)
+	}
+	return succeeded, nil
+}
+
+// markPendingMemoryFailed 记录一次重新处理失败，超过最大次数时标记为failed
+func (s *ChatMemoryService) markPendingMemoryFailed(item *PendingMemory, cause error) {
+	attempts := item.Attempts + 1
+	updates := map[string]interface{}{
+		"attempts":      attempts,
+		"last_error":    truncateError(cause),
+		"next_retry_at": time.Now().Add(backoffDelay(s.retry.workerInterval, attempts+1)),
+	}
+	if attempts >= s.retry.deadLetterRetries {
+		updates["status"] = "failed"
+		s.logger.Error("待重试记忆 %d（会话 %s）已重试%d次仍失败，放弃重试: %v", item.ID, item.SessionID, attempts, cause)
+	} else {
+		s.logger.Warn("待重试记忆 %d（会话 %s）第%d次重新处理失败: %v", item.ID, item.SessionID, attempts, cause)
+	}
+	if err := s.db.Model(item).Updates(updates).Error; err != nil {
+		s.logger.Warn("更新待重试记忆 %d 失败: %v", item.ID, err)
+	}
+}
+
+// StartPendingMemoryWorker 启动后台任务，按 worker_interval 定期重新处理待重试记忆，ctx取消时退出
+func (s *ChatMemoryService) StartPendingMemoryWorker(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.retry.workerInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				count, err := s.ProcessPendingMemories(ctx)
+				if err != nil {
+					s.logger.Warn("处理待重试记忆失败: %v", err)
+				} else if count > 0 {
+					s.logger.Info("重新生成%d条待重试记忆", count)
+				}
+			}
+		}
+	}()
+}
+
+// pendingMemoryCounts 统计用户/设备待重试和已放弃的记忆数量
+func (s *ChatMemoryService) pendingMemoryCounts(userID *uint, deviceID uint) (int64, int64) {
+	query := s.db.Model(&PendingMemory{})
+	if userID != nil {
+		query = query.Where("(user_id = ? OR user_id IS NULL) AND device_id = ?", *userID, deviceID)
+	} else {
+		query = query.Where("device_id = ?", deviceID)
+	}
+	var pendingCount, failedCount int64
+	query.Session(&gorm.Session{}).Where("status = ?", "pending").Count(&pendingCount)
+	query.Session(&gorm.Session{}).Where("status = ?", "failed").Count(&failedCount)
+	return pendingCount, failedCount
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"ai-server-go/src/core/chat"
+	"ai-server-go/src/core/utils"
+
+	"gorm.io/gorm"
+)
+
+// MemoryStore 长期记忆存储接口，默认实现为SQL存储，可替换为Redis、向量数据库等后端
+type MemoryStore interface {
+	// SaveMemory 保存一条记忆
+	SaveMemory(userID *uint, deviceID uint, sessionID, memoryType, content string, importance int, tags []string) error
+	// QueryMemory 查询与query相关的记忆，返回拼接后的记忆摘要
+	QueryMemory(userID *uint, deviceID uint, query string, limit int) (string, error)
+	// ListActiveMemories 按重要性列出有效记忆
+	ListActiveMemories(userID *uint, deviceID uint, limit int) ([]ChatMemory, error)
+	// GenerateMemoryFromDialogue 从对话历史生成记忆
+	GenerateMemoryFromDialogue(ctx context.Context, userID *uint, deviceID uint, sessionID string, dialogue []chat.Message) error
+	// ClearMemory 清空指定会话的记忆
+	ClearMemory(sessionID string) error
+	// GetMemoryStats 获取记忆统计信息
+	GetMemoryStats(userID *uint, deviceID uint) (map[string]interface{}, error)
+}
+
+// EmbeddingMemoryStore 支持向量检索的记忆存储
+type EmbeddingMemoryStore interface {
+	SetEmbedder(embedder Embedder)
+	HasEmbedder() bool
+}
+
+// MemoryStoreFactory 记忆存储工厂函数，options 为配置文件 memory.options 中的参数
+type MemoryStoreFactory func(db *gorm.DB, options map[string]interface{}, logger *utils.Logger) (MemoryStore, error)
+
+var (
+	memoryStoreMu        sync.RWMutex
+	memoryStoreFactories = make(map[string]MemoryStoreFactory)
+)
+
+// RegisterMemoryStore 注册记忆存储后端，通常在实现包的init中调用
+func RegisterMemoryStore(name string, factory MemoryStoreFactory) {
+	memoryStoreMu.Lock()
+	defer memoryStoreMu.Unlock()
+	memoryStoreFactories[name] = factory
+}
+
+// NewMemoryStore 按名称创建记忆存储
+func NewMemoryStore(name string, db *gorm.DB, options map[string]interface{}, logger *utils.Logger) (MemoryStore, error) {
+	memoryStoreMu.RLock()
+	factory, ok := memoryStoreFactories[name]
+	memoryStoreMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("未知的记忆存储类型: %s (可用: %v)", name, MemoryStoreNames())
+	}
+	store, err := factory(db, options, logger)
+	if err != nil {
+		return nil, fmt.Errorf("创建记忆存储 %s 失败: %v", name, err)
+	}
+	return store, nil
+}
+
+// MemoryStoreNames 已注册的记忆存储名称
+func MemoryStoreNames() []string {
+	memoryStoreMu.RLock()
+	defer memoryStoreMu.RUnlock()
+	names := make([]string, 0, len(memoryStoreFactories))
+	for name := range memoryStoreFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
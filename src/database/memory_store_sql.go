@@ -0,0 +1,333 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"ai-server-go/src/core/chat"
+	"ai-server-go/src/core/utils"
+
+	"gorm.io/gorm"
+)
+
+func init() {
+	RegisterMemoryStore("sql", func(db *gorm.DB, options map[string]interface{}, logger *utils.Logger) (MemoryStore, error) {
+		return NewSQLMemoryStore(db, logger), nil
+	})
+}
+
+// SQLMemoryStore 基于GORM的记忆存储（默认实现），记忆保存在 chat_memories 表
+type SQLMemoryStore struct {
+	db       *gorm.DB
+	logger   *utils.Logger
+	embedder Embedder // 可选的向量化提供者，为空时使用关键词/重要性查询
+}
+
+// NewSQLMemoryStore 创建SQL记忆存储
+func NewSQLMemoryStore(db *gorm.DB, logger *utils.Logger) *SQLMemoryStore {
+	return &SQLMemoryStore{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// SaveMemory 保存聊天记忆
+func (s *SQLMemoryStore) SaveMemory(userID *uint, deviceID uint, sessionID, memoryType, content string, importance int, tags []string) error {
+	memory := &ChatMemory{
+		UserID:     userID,
+		DeviceID:   deviceID,
+		SessionID:  sessionID,
+		MemoryType: memoryType,
+		Content:    content,
+		Importance: importance,
+		Tags:       strings.Join(tags, ","),
+		LastUsed:   &[]time.Time{time.Now()}[0],
+		UseCount:   0,
+		IsActive:   true,
+	}
+
+	if s.embedder != nil {
+		if vectors, err := s.embed([]string{content}); err != nil {
+			s.logger.Warn("记忆向量化失败，仅保存文本: %v", err)
+		} else {
+			memory.Embedding = encodeEmbedding(vectors[0])
+		}
+	}
+
+	if err := s.db.Create(memory).Error; err != nil {
+		return fmt.Errorf("保存记忆失败: %v", err)
+	}
+
+	s.logger.Info("保存聊天记忆成功 %v", map[string]interface{}{
+		"session_id":  sessionID,
+		"memory_type": memoryType,
+		"importance":  importance,
+		"tags":        tags,
+	})
+
+	return nil
+}
+
+// QueryMemory 查询相关记忆
+func (s *SQLMemoryStore) QueryMemory(userID *uint, deviceID uint, query string, limit int) (string, error) {
+	if limit <= 0 {
+		limit = 5 // 默认返回5条最相关的记忆
+	}
+
+	if s.embedder != nil && strings.TrimSpace(query) != "" {
+		memories, err := s.querySemanticMemories(userID, deviceID, query, limit)
+		if err == nil {
+			return s.summarizeMemories(memories, query, userID, deviceID), nil
+		}
+		s.logger.Warn("向量检索记忆失败，回退到关键词查询: %v", err)
+	}
+
+	// 构建查询条件
+	var memories []ChatMemory
+	dbQuery := s.db.Where("is_active = ?", true)
+
+	// 按用户和设备过滤
+	if userID != nil {
+		dbQuery = dbQuery.Where("(user_id = ? OR user_id IS NULL) AND device_id = ?", *userID, deviceID)
+	} else {
+		dbQuery = dbQuery.Where("device_id = ?", deviceID)
+	}
+
+	// 按重要性排序，优先返回重要的记忆
+	dbQuery = dbQuery.Order("importance DESC, last_used DESC, use_count DESC").Limit(limit)
+
+	if err := dbQuery.Find(&memories).Error; err != nil {
+		return "", fmt.Errorf("查询记忆失败: %v", err)
+	}
+
+	return s.summarizeMemories(memories, query, userID, deviceID), nil
+}
+
+// summarizeMemories 拼接记忆摘要并更新使用统计
+func (s *SQLMemoryStore) summarizeMemories(memories []ChatMemory, query string, userID *uint, deviceID uint) string {
+	if len(memories) == 0 {
+		return ""
+	}
+
+	// 构建记忆摘要
+	var memoryParts []string
+	for _, memory := range memories {
+		memoryParts = append(memoryParts, fmt.Sprintf("[%s] %s", memory.MemoryType, memory.Content))
+
+		// 更新使用统计
+		s.db.Model(&memory).Updates(map[string]interface{}{
+			"use_count": gorm.Expr("use_count + 1"),
+			"last_used": time.Now(),
+		})
+	}
+
+	memorySummary := strings.Join(memoryParts, "\n")
+
+	s.logger.Debug("查询到相关记忆 %v", map[string]interface{}{
+		"query":        query,
+		"memory_count": len(memories),
+		"user_id":      userID,
+		"device_id":    deviceID,
+	})
+
+	return memorySummary
+}
+
+// ListActiveMemories 按重要性列出用户/设备的有效记忆（不更新使用统计）
+func (s *SQLMemoryStore) ListActiveMemories(userID *uint, deviceID uint, limit int) ([]ChatMemory, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+
+	var memories []ChatMemory
+	dbQuery := s.db.Where("is_active = ?", true)
+	if userID != nil {
+		dbQuery = dbQuery.Where("(user_id = ? OR user_id IS NULL) AND device_id = ?", *userID, deviceID)
+	} else {
+		dbQuery = dbQuery.Where("device_id = ?", deviceID)
+	}
+
+	if err := dbQuery.Order("importance DESC, updated_at DESC").Limit(limit).Find(&memories).Error; err != nil {
+		return nil, fmt.Errorf("查询记忆失败: %v", err)
+	}
+	return memories, nil
+}
+
+// GenerateMemoryFromDialogue 从对话历史生成记忆
+func (s *SQLMemoryStore) GenerateMemoryFromDialogue(ctx context.Context, userID *uint, deviceID uint, sessionID string, dialogue []chat.Message) error {
+	if len(dialogue) == 0 {
+		return nil
+	}
+
+	// 在同一事务内保存，任一条失败时整体回滚，避免重试时产生重复记忆
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		txStore := &SQLMemoryStore{db: tx, logger: s.logger, embedder: s.embedder}
+
+		// 生成会话摘要
+		summary := s.generateSummary(dialogue)
+		if summary != "" {
+			if err := txStore.SaveMemory(userID, deviceID, sessionID, "summary", summary, 8, []string{"auto_generated"}); err != nil {
+				return fmt.Errorf("保存会话摘要失败: %v", err)
+			}
+		}
+
+		// 提取关键信息
+		for _, point := range s.extractKeyPoints(dialogue) {
+			if err := txStore.SaveMemory(userID, deviceID, sessionID, "key_points", point, 6, []string{"auto_generated"}); err != nil {
+				return fmt.Errorf("保存关键信息失败: %v", err)
+			}
+		}
+
+		// 保存重要对话片段
+		for _, conv := range s.extractImportantConversations(dialogue) {
+			if err := txStore.SaveMemory(userID, deviceID, sessionID, "conversation", conv, 5, []string{"auto_generated"}); err != nil {
+				return fmt.Errorf("保存重要对话失败: %v", err)
+			}
+		}
+		return nil
+	})
+}
+
+// generateSummary 生成对话摘要
+func (s *SQLMemoryStore) generateSummary(dialogue []chat.Message) string {
+	if len(dialogue) < 4 {
+		return ""
+	}
+
+	// 简单的摘要生成逻辑
+	var userMessages []string
+	var assistantMessages []string
+
+	for _, msg := range dialogue {
+		if msg.Role == "user" {
+			userMessages = append(userMessages, msg.Content)
+		} else if msg.Role == "assistant" {
+			assistantMessages = append(assistantMessages, msg.Content)
+		}
+	}
+
+	if len(userMessages) == 0 || len(assistantMessages) == 0 {
+		return ""
+	}
+
+	// 提取用户的主要问题或需求
+	mainTopic := s.extractMainTopic(userMessages)
+	if mainTopic == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("用户询问了关于%s的问题，进行了%d轮对话", mainTopic, len(userMessages))
+}
+
+// extractMainTopic 提取主要话题
+func (s *SQLMemoryStore) extractMainTopic(messages []string) string {
+	if len(messages) == 0 {
+		return ""
+	}
+
+	// 简单的关键词提取
+	keywords := []string{"天气", "时间", "计算", "翻译", "编程", "代码", "文件", "图片", "音乐", "新闻"}
+
+	for _, msg := range messages {
+		for _, keyword := range keywords {
+			if strings.Contains(msg, keyword) {
+				return keyword
+			}
+		}
+	}
+
+	// 如果没有找到预定义关键词，返回第一个消息的前20个字符
+	if len(messages[0]) > 20 {
+		return messages[0][:20] + "..."
+	}
+	return messages[0]
+}
+
+// extractKeyPoints 提取关键信息
+func (s *SQLMemoryStore) extractKeyPoints(dialogue []chat.Message) []string {
+	var keyPoints []string
+
+	for _, msg := range dialogue {
+		if msg.Role == "user" {
+			// 提取用户的重要信息
+			if strings.Contains(msg.Content, "我叫") || strings.Contains(msg.Content, "我的名字是") {
+				keyPoints = append(keyPoints, "用户姓名信息: "+msg.Content)
+			}
+			if strings.Contains(msg.Content, "我喜欢") || strings.Contains(msg.Content, "我讨厌") {
+				keyPoints = append(keyPoints, "用户偏好: "+msg.Content)
+			}
+		}
+	}
+
+	return keyPoints
+}
+
+// extractImportantConversations 提取重要对话片段
+func (s *SQLMemoryStore) extractImportantConversations(dialogue []chat.Message) []string {
+	var conversations []string
+
+	// 提取包含重要信息的对话片段
+	for i := 0; i < len(dialogue)-1; i++ {
+		if dialogue[i].Role == "user" && i+1 < len(dialogue) && dialogue[i+1].Role == "assistant" {
+			userMsg := dialogue[i].Content
+			assistantMsg := dialogue[i+1].Content
+
+			// 判断是否为重要对话
+			if len(userMsg) > 20 && len(assistantMsg) > 30 {
+				conversation := fmt.Sprintf("用户: %s\n助手: %s", userMsg, assistantMsg)
+				conversations = append(conversations, conversation)
+			}
+		}
+	}
+
+	return conversations
+}
+
+// ClearMemory 清空指定会话的记忆
+func (s *SQLMemoryStore) ClearMemory(sessionID string) error {
+	if err := s.db.Where("session_id = ?", sessionID).Delete(&ChatMemory{}).Error; err != nil {
+		return fmt.Errorf("清空记忆失败: %v", err)
+	}
+
+	s.logger.Info("清空会话记忆成功 %v", map[string]interface{}{
+		"session_id": sessionID,
+	})
+
+	return nil
+}
+
+// GetMemoryStats 获取记忆统计信息
+func (s *SQLMemoryStore) GetMemoryStats(userID *uint, deviceID uint) (map[string]interface{}, error) {
+	var stats map[string]interface{}
+
+	// 统计不同类型的记忆数量
+	var typeStats []struct {
+		MemoryType string `json:"memory_type"`
+		Count      int    `json:"count"`
+	}
+
+	query := s.db.Model(&ChatMemory{}).Where("is_active = ?", true)
+	if userID != nil {
+		query = query.Where("(user_id = ? OR user_id IS NULL) AND device_id = ?", *userID, deviceID)
+	} else {
+		query = query.Where("device_id = ?", deviceID)
+	}
+
+	if err := query.Select("memory_type, count(*) as count").Group("memory_type").Find(&typeStats).Error; err != nil {
+		return nil, fmt.Errorf("获取记忆统计失败: %v", err)
+	}
+
+	stats = make(map[string]interface{})
+	stats["type_stats"] = typeStats
+
+	// 统计总记忆数
+	var totalCount int64
+	if err := query.Count(&totalCount).Error; err != nil {
+		return nil, fmt.Errorf("统计总记忆数失败: %v", err)
+	}
+	stats["total_count"] = totalCount
+
+	return stats, nil
+}
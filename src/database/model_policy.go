@@ -0,0 +1,206 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ModelPolicy LLM模型允许/禁止策略：系统级策略对所有用户生效，用户级策略覆盖系统级策略
+type ModelPolicy struct {
+	gorm.Model
+	UserID           *uint  `json:"user_id" gorm:"index"`             // 策略所属用户，为空表示系统级策略
+	Mode             string `json:"mode" gorm:"size:10;not null"`     // allow（只允许列出的模型）或 deny（禁止列出的模型）
+	Models           string `json:"models" gorm:"size:1000"`          // 模型名称，逗号分隔，以*结尾表示前缀匹配（如 gpt-4*）
+	FallbackProvider string `json:"fallback_provider" gorm:"size:50"` // 模型不允许时改用的LLM provider名称，为空时尝试系统默认及其他允许的provider
+	Description      string `json:"description" gorm:"size:255"`
+	IsActive         bool   `json:"is_active" gorm:"default:true"`
+}
+
+// Allows 判断模型是否被策略允许，模型名称不区分大小写
+func (p *ModelPolicy) Allows(modelName string) bool {
+	matched := false
+	name := strings.ToLower(strings.TrimSpace(modelName))
+	for _, pattern := range strings.Split(p.Models, ",") {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			matched = strings.HasPrefix(name, prefix)
+		} else {
+			matched = name == pattern
+		}
+		if matched {
+			break
+		}
+	}
+	if p.Mode == "deny" {
+		return !matched
+	}
+	return matched
+}
+
+// scope 策略作用范围描述，用于日志
+func (p *ModelPolicy) scope() string {
+	if p.UserID == nil {
+		return "系统"
+	}
+	return fmt.Sprintf("用户 %d", *p.UserID)
+}
+
+// ListModelPolicies 获取模型策略列表
+func (s *ConfigService) ListModelPolicies() ([]*ModelPolicy, error) {
+	var policies []*ModelPolicy
+	if err := s.db.DB.Order("user_id, id").Find(&policies).Error; err != nil {
+		return nil, fmt.Errorf("查询模型策略失败: %v", err)
+	}
+	return policies, nil
+}
+
+// SaveModelPolicy 创建或更新模型策略，系统和每个用户各只能有一条策略
+func (s *ConfigService) SaveModelPolicy(policy *ModelPolicy) error {
+	if policy.Mode != "allow" && policy.Mode != "deny" {
+		return fmt.Errorf("mode 必须为 allow 或 deny")
+	}
+	if policy.FallbackProvider != "" {
+		provider, err := s.GetProviderConfigByCategoryAndName("LLM", policy.FallbackProvider)
+		if err != nil {
+			return err
+		}
+		if provider == nil {
+			return fmt.Errorf("替代的LLM provider不存在: %s", policy.FallbackProvider)
+		}
+	}
+
+	query := s.db.DB.Model(&ModelPolicy{}).Where("id <> ?", policy.ID)
+	if policy.UserID == nil {
+		query = query.Where("user_id IS NULL")
+	} else {
+		query = query.Where("user_id = ?", *policy.UserID)
+	}
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return fmt.Errorf("检查模型策略失败: %v", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("%s级模型策略已存在", policy.scope())
+	}
+
+	if err := s.db.DB.Save(policy).Error; err != nil {
+		return fmt.Errorf("保存模型策略失败: %v", err)
+	}
+	s.logger.Info("模型策略已保存: %s %s [%s]", policy.scope(), policy.Mode, policy.Models)
+	return nil
+}
+
+// DeleteModelPolicy 删除模型策略
+func (s *ConfigService) DeleteModelPolicy(id uint) error {
+	result := s.db.DB.Delete(&ModelPolicy{}, id)
+	if result.Error != nil {
+		return fmt.Errorf("删除模型策略失败: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("模型策略不存在")
+	}
+	return nil
+}
+
+// GetEffectiveModelPolicy 获取生效的模型策略：用户（未指定时为设备所有者）策略优先，其次系统策略，都没有时返回nil
+func (s *ConfigService) GetEffectiveModelPolicy(deviceID *uint, userID *uint) (*ModelPolicy, error) {
+	ownerID := userID
+	if ownerID == nil && deviceID != nil {
+		ownerID = s.DeviceOwnerID(*deviceID)
+	}
+
+	var policy ModelPolicy
+	if ownerID != nil {
+		err := s.db.DB.Where("user_id = ? AND is_active = ?", *ownerID, true).First(&policy).Error
+		if err == nil {
+			return &policy, nil
+		}
+		if err != gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("查询模型策略失败: %v", err)
+		}
+	}
+	err := s.db.DB.Where("user_id IS NULL AND is_active = ?", true).First(&policy).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询模型策略失败: %v", err)
+	}
+	return &policy, nil
+}
+
+// ProviderModelName 获取provider配置中的模型名称（props.model_name）
+func ProviderModelName(provider *ProviderConfig) string {
+	if provider == nil || len(provider.Props) == 0 {
+		return ""
+	}
+	var props map[string]interface{}
+	if err := json.Unmarshal(provider.Props, &props); err != nil {
+		return ""
+	}
+	modelName, _ := props["model_name"].(string)
+	return modelName
+}
+
+// CheckModelPolicy 检查模型是否被策略允许：允许时返回nil；不允许时返回替代的LLM provider并记录覆盖日志，
+// 没有允许的替代provider时返回错误
+func (s *ConfigService) CheckModelPolicy(modelName string, deviceID *uint, userID *uint) (*ProviderConfig, error) {
+	policy, err := s.GetEffectiveModelPolicy(deviceID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil || policy.Allows(modelName) {
+		return nil, nil
+	}
+
+	fallback, err := s.findAllowedLLMProvider(policy)
+	if err != nil {
+		return nil, err
+	}
+	if fallback == nil {
+		s.logger.Warn("模型策略拒绝: %s策略不允许模型 %s，且没有可用的替代模型", policy.scope(), modelName)
+		return nil, fmt.Errorf("模型 %s 不在%s模型策略允许范围内，且没有可用的替代模型", modelName, policy.scope())
+	}
+	s.logger.Warn("模型策略覆盖: %s策略不允许模型 %s，改用 %s（模型 %s）",
+		policy.scope(), modelName, fallback.Name, ProviderModelName(fallback))
+	return fallback, nil
+}
+
+// findAllowedLLMProvider 按 策略指定的替代provider > 系统默认 > 其他启用的provider 查找策略允许的LLM provider
+func (s *ConfigService) findAllowedLLMProvider(policy *ModelPolicy) (*ProviderConfig, error) {
+	if policy.FallbackProvider != "" {
+		provider, err := s.GetProviderConfigByCategoryAndName("LLM", policy.FallbackProvider)
+		if err != nil {
+			return nil, err
+		}
+		if provider != nil && policy.Allows(ProviderModelName(provider)) {
+			return provider, nil
+		}
+	}
+
+	provider, err := s.GetDefaultProviderConfig("LLM")
+	if err != nil {
+		return nil, err
+	}
+	if provider != nil && policy.Allows(ProviderModelName(provider)) {
+		return provider, nil
+	}
+
+	var candidates []*ProviderConfig
+	if err := s.db.DB.Where("category = ? AND is_active = ?", "LLM", true).
+		Order("is_default DESC, weight DESC, id").Find(&candidates).Error; err != nil {
+		return nil, fmt.Errorf("查询LLM提供商配置失败: %v", err)
+	}
+	for _, candidate := range candidates {
+		if policy.Allows(ProviderModelName(candidate)) {
+			return candidate, nil
+		}
+	}
+	return nil, nil
+}
@@ -21,6 +21,7 @@ type User struct {
 	Role          string     `json:"role" gorm:"size:20;default:'user'"`
 	LastLoginTime *time.Time `json:"last_login_time"`
 	LastLoginIP   string     `json:"last_login_ip" gorm:"size:45"`
+	MaxDevices    *int       `json:"max_devices"` // 管理员为该用户单独设置的绑定设备上限，为空时按角色和系统配置，0表示不限制
 
 	// 关联关系
 	UserAuths        []UserAuth       `json:"user_auths,omitempty" gorm:"foreignKey:UserID"`
@@ -40,6 +41,8 @@ type UserAuth struct {
 	IsActive   bool       `json:"is_active" gorm:"default:true"`
 	ExpiresAt  *time.Time `json:"expires_at"`
 
+	ImpersonatorID *uint `json:"impersonator_id,omitempty" gorm:"index"` // 模拟登录令牌的签发管理员，普通令牌为空
+
 	// 关联关系
 	User User `json:"user,omitempty" gorm:"foreignKey:UserID"`
 }
@@ -194,12 +197,42 @@ type UsageStats struct {
 	SuccessCount   int       `json:"success_count" gorm:"default:0"`
 	ErrorCount     int       `json:"error_count" gorm:"default:0"`
 	TotalDuration  int       `json:"total_duration" gorm:"default:0"`
+	InputTokens    int       `json:"input_tokens" gorm:"default:0"`   // LLM输入token数（估算）
+	OutputTokens   int       `json:"output_tokens" gorm:"default:0"`  // LLM输出token数（估算）
+	TTSChars       int       `json:"tts_chars" gorm:"default:0"`      // TTS合成字符数
+	ASRSeconds     float64   `json:"asr_seconds" gorm:"default:0"`    // ASR识别音频时长（秒）
+	EstimatedCost  float64   `json:"estimated_cost" gorm:"default:0"` // 按提供商单价估算的费用
 
 	// 关联关系
 	User   *User  `json:"user,omitempty" gorm:"foreignKey:UserID"`
 	Device Device `json:"device,omitempty" gorm:"foreignKey:DeviceID"`
 }
 
+// DeviceEvent 设备上报的遥测/错误事件
+type DeviceEvent struct {
+	gorm.Model
+	DeviceID   uint      `json:"device_id" gorm:"index"`              // 设备ID（设备未注册时为0）
+	DeviceKey  string    `json:"device_key" gorm:"size:100;index"`    // 连接时上报的原始设备标识
+	SessionID  string    `json:"session_id" gorm:"size:100;index"`    // 会话ID，便于关联服务端对话日志
+	Level      string    `json:"level" gorm:"size:10;not null;index"` // 级别：info, warn, error
+	Category   string    `json:"category" gorm:"size:50;index"`       // 类别：audio, decode, network 等
+	Code       string    `json:"code" gorm:"size:50"`                 // 设备侧错误码
+	Message    string    `json:"message" gorm:"type:text"`            // 错误描述
+	Details    string    `json:"details" gorm:"type:text"`            // 附加信息（JSON）
+	ReportedAt time.Time `json:"reported_at" gorm:"not null;index"`   // 服务端接收时间
+}
+
+// DeviceEventQuery 设备事件查询条件
+type DeviceEventQuery struct {
+	DeviceID  uint
+	DeviceKey string
+	SessionID string
+	Level     string
+	Category  string
+	Since     *time.Time
+	Limit     int
+}
+
 // DeviceWithCapabilities 设备及其AI能力
 type DeviceWithCapabilities struct {
 	Device       *Device             `json:"device"`
@@ -229,9 +262,10 @@ type CapabilityConfig struct {
 
 // DeviceCapabilityConfig 设备AI能力配置
 type DeviceCapabilityConfig struct {
-	DeviceID      uint               `json:"device_id"`
-	Capabilities  []CapabilityConfig `json:"capabilities"`
-	GlobalConfigs map[string]string  `json:"global_configs"`
+	DeviceID      uint                 `json:"device_id"`
+	Capabilities  []CapabilityConfig   `json:"capabilities"`
+	GlobalConfigs map[string]string    `json:"global_configs"`
+	Excluded      []ExcludedCapability `json:"excluded,omitempty"` // 因设备不兼容被过滤的能力及原因
 }
 
 // UserCapabilityConfig 用户AI能力配置
@@ -307,6 +341,71 @@ type DeviceCapabilityRequest struct {
 	IsEnabled      bool                   `json:"is_enabled"`
 }
 
+// DeviceConfigBundle 设备配置包（用于导出/导入，克隆设备配置）
+type DeviceConfigBundle struct {
+	BundleVersion    int                       `json:"bundle_version"`
+	ExportedAt       time.Time                 `json:"exported_at"`
+	Device           DeviceBundleMetadata      `json:"device"`
+	Capabilities     []DeviceBundleCapability  `json:"capabilities"`
+	ProviderBindings []DeviceBundleProviderRef `json:"provider_bindings"`
+}
+
+// DeviceBundleMetadata 设备元数据（不含UUID/SN等身份信息和密钥）
+type DeviceBundleMetadata struct {
+	DeviceName      string `json:"device_name"`
+	DeviceType      string `json:"device_type"`
+	DeviceModel     string `json:"device_model"`
+	FirmwareVersion string `json:"firmware_version"`
+	HardwareVersion string `json:"hardware_version"`
+}
+
+// DeviceBundleCapability 配置包中的设备能力
+type DeviceBundleCapability struct {
+	CapabilityName string                 `json:"capability_name" binding:"required"`
+	CapabilityType string                 `json:"capability_type" binding:"required"`
+	Priority       int                    `json:"priority"`
+	Config         map[string]interface{} `json:"config"`
+	IsEnabled      bool                   `json:"is_enabled"`
+}
+
+// DeviceBundleProviderRef 配置包中的provider绑定（按类别/名称/版本引用）
+type DeviceBundleProviderRef struct {
+	Category string `json:"category" binding:"required"`
+	Name     string `json:"name" binding:"required"`
+	Version  string `json:"version"`
+}
+
+// DeviceImportResult 设备配置导入结果
+type DeviceImportResult struct {
+	AppliedCapabilities int      `json:"applied_capabilities"`
+	AppliedProviders    int      `json:"applied_providers"`
+	Skipped             []string `json:"skipped"`
+}
+
+// MergeDevicesRequest 合并重复设备请求
+type MergeDevicesRequest struct {
+	SourceUUID string `json:"source_uuid" binding:"required"` // 被合并的设备，合并后软删除
+	TargetUUID string `json:"target_uuid" binding:"required"` // 保留的设备
+}
+
+// DeviceMergeResult 设备合并结果，记录各表改指向目标设备的行数
+type DeviceMergeResult struct {
+	SourceID           uint  `json:"source_id"`
+	TargetID           uint  `json:"target_id"`
+	UserDevices        int64 `json:"user_devices"`
+	DeviceCapabilities int64 `json:"device_capabilities"`
+	DeviceAuths        int64 `json:"device_auths"`
+	Sessions           int64 `json:"sessions"`
+	UsageStats         int64 `json:"usage_stats"`
+	MergedUsageStats   int64 `json:"merged_usage_stats"` // 累加到目标设备同一能力同一天记录的源设备统计数
+	DeviceEvents       int64 `json:"device_events"`
+	ChatSessions       int64 `json:"chat_sessions"`
+	ChatMessages       int64 `json:"chat_messages"`
+	ChatMemories       int64 `json:"chat_memories"`
+	PendingMemories    int64 `json:"pending_memories"`
+	DroppedDuplicates  int64 `json:"dropped_duplicates"` // 目标设备已存在相同绑定/能力而删除的源设备记录数
+}
+
 // AICapabilityRequest AI能力请求
 type AICapabilityRequest struct {
 	Name        string                 `json:"name" binding:"required"`
@@ -328,6 +427,17 @@ type ProviderConfig struct {
 	IsActive  bool            `json:"is_active" gorm:"default:true"`          // 是否启用
 	IsDefault bool            `json:"is_default" gorm:"default:false"`        // 是否为默认版本
 	Props     json.RawMessage `json:"props" gorm:"type:json"`                 // 其他扩展参数
+
+	RolledBackAt *time.Time `json:"rolled_back_at"` // 错误率过高被自动回滚的时间，需手动重新启用后才能再分配流量
+
+	MaxConcurrency int `json:"max_concurrency" gorm:"default:0"` // 最大并发请求数（0表示不限制）
+	QueueTimeout   int `json:"queue_timeout" gorm:"default:10"`  // 并发排队超时时间（秒）
+
+	// 单价（用于费用估算，未定价时为0）
+	InputTokenPrice  float64 `json:"input_token_price" gorm:"default:0"`  // LLM输入单价（每千token）
+	OutputTokenPrice float64 `json:"output_token_price" gorm:"default:0"` // LLM输出单价（每千token）
+	TTSCharPrice     float64 `json:"tts_char_price" gorm:"default:0"`     // TTS单价（每千字符）
+	ASRMinutePrice   float64 `json:"asr_minute_price" gorm:"default:0"`   // ASR单价（每分钟音频）
 }
 
 // ProviderVersion 封装了ProviderConfig部分字段，用于接口返回
@@ -392,6 +502,7 @@ type ChatMemory struct {
 	Content    string     `json:"content" gorm:"type:text;not null"`         // 记忆内容
 	Importance int        `json:"importance" gorm:"default:1"`               // 重要性评分（1-10）
 	Tags       string     `json:"tags" gorm:"size:500"`                      // 标签，逗号分隔
+	Embedding  string     `json:"-" gorm:"type:text"`                        // 内容向量（JSON数组），配置EMBEDDING提供者时写入
 	LastUsed   *time.Time `json:"last_used"`                                 // 最后使用时间
 	UseCount   int        `json:"use_count" gorm:"default:0"`                // 使用次数
 	IsActive   bool       `json:"is_active" gorm:"default:true"`             // 是否激活
@@ -401,6 +512,19 @@ type ChatMemory struct {
 	Device Device `json:"device,omitempty" gorm:"foreignKey:DeviceID"`
 }
 
+// PendingMemory 生成失败待重试的记忆（死信），由后台任务重新处理
+type PendingMemory struct {
+	gorm.Model
+	UserID      *uint     `json:"user_id" gorm:"index"`                      // 用户ID
+	DeviceID    uint      `json:"device_id" gorm:"not null;index"`           // 设备ID
+	SessionID   string    `json:"session_id" gorm:"size:100;not null;index"` // 会话ID
+	Dialogue    string    `json:"dialogue" gorm:"type:text;not null"`        // 待生成记忆的对话（JSON）
+	Attempts    int       `json:"attempts" gorm:"default:0"`                 // 已尝试次数
+	Status      string    `json:"status" gorm:"size:20;default:'pending'"`   // 状态：pending（待重试）, failed（放弃重试）
+	LastError   string    `json:"last_error" gorm:"size:500"`                // 最近一次失败原因
+	NextRetryAt time.Time `json:"next_retry_at" gorm:"index"`                // 下次重试时间
+}
+
 // ChatSession 聊天会话模型
 type ChatSession struct {
 	gorm.Model
@@ -408,12 +532,14 @@ type ChatSession struct {
 	DeviceID     uint       `json:"device_id" gorm:"not null;index"`
 	SessionID    string     `json:"session_id" gorm:"size:100;not null;uniqueIndex"`
 	Title        string     `json:"title" gorm:"size:200"`                  // 会话标题
+	TitleSource  string     `json:"title_source" gorm:"size:20"`            // 标题来源：空（创建时的默认标题）, auto（自动生成）, manual（手动命名）
 	Summary      string     `json:"summary" gorm:"type:text"`               // 会话摘要
 	MessageCount int        `json:"message_count" gorm:"default:0"`         // 消息数量
 	StartTime    time.Time  `json:"start_time" gorm:"not null"`             // 开始时间
 	EndTime      *time.Time `json:"end_time"`                               // 结束时间
 	Status       string     `json:"status" gorm:"size:20;default:'active'"` // 状态：active, archived, deleted
 	Tags         string     `json:"tags" gorm:"size:500"`                   // 标签
+	Mode         string     `json:"mode" gorm:"size:20"`                    // 对话模式：assistant, translator, dictation（空表示assistant）
 
 	// 关联关系
 	User     *User        `json:"user,omitempty" gorm:"foreignKey:UserID"`
@@ -431,10 +557,42 @@ type ChatMessage struct {
 	Content     string    `json:"content" gorm:"type:text;not null"`          // 消息内容
 	MessageType string    `json:"message_type" gorm:"size:20;default:'text'"` // text, image, audio, function_call
 	Metadata    string    `json:"metadata" gorm:"type:text"`                  // 元数据（JSON格式）
+	Attachments string    `json:"attachments" gorm:"type:text"`               // 多模态附件（JSON格式，[]ChatAttachment）
 	Timestamp   time.Time `json:"timestamp" gorm:"not null"`                  // 消息时间戳
 	IsProcessed bool      `json:"is_processed" gorm:"default:false"`          // 是否已处理（用于记忆生成）
 
+	// 内容审核记录
+	ModerationScore   *float64 `json:"moderation_score,omitempty"`                 // 审核评分（未审核为空）
+	ModerationFlags   string   `json:"moderation_flags,omitempty" gorm:"size:255"` // 命中的审核类别（逗号分隔）
+	ModerationBlocked bool     `json:"moderation_blocked" gorm:"default:false"`    // 是否被审核拦截
+
 	// 关联关系
 	User   *User  `json:"user,omitempty" gorm:"foreignKey:UserID"`
 	Device Device `json:"device,omitempty" gorm:"foreignKey:DeviceID"`
 }
+
+// MessageModeration 消息审核结果
+type MessageModeration struct {
+	Score   float64
+	Flags   []string
+	Blocked bool
+}
+
+// ChatAttachment 聊天消息附件
+type ChatAttachment struct {
+	Type     string `json:"type"`      // 附件类型: image, audio
+	Ref      string `json:"ref"`       // 存储引用: URL、blob:<key>（存储的图片）或 data URL
+	MimeType string `json:"mime_type"` // MIME类型
+}
+
+// GetAttachments 解析消息附件
+func (m *ChatMessage) GetAttachments() []ChatAttachment {
+	if m.Attachments == "" {
+		return nil
+	}
+	var attachments []ChatAttachment
+	if err := json.Unmarshal([]byte(m.Attachments), &attachments); err != nil {
+		return nil
+	}
+	return attachments
+}
@@ -0,0 +1,226 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+/*
+* 人设包：将提示词、TTS音色、语速和快速回复词打包为一个人设，可分配给设备、用户或全局。
+* 会话开始时按 设备分配 > 用户（未指定时为设备所有者）分配 > 全局分配 解析生效的人设。
+* 在能力优先级中人设位于设备专属配置之后：设备专属的TTS能力配置优先于人设的音色和语速，
+* 人设优先于用户和系统默认配置。
+ */
+
+// 人设分配对象类型
+const (
+	PersonaTargetDevice = "device"
+	PersonaTargetUser   = "user"
+	PersonaTargetGlobal = "global"
+)
+
+// Persona 人设包
+type Persona struct {
+	gorm.Model
+	Name            string          `json:"name" gorm:"uniqueIndex;size:100;not null"`
+	Description     string          `json:"description" gorm:"size:255"`
+	Prompt          string          `json:"prompt" gorm:"type:text"`            // 系统提示词，为空时使用默认提示词
+	Voice           string          `json:"voice" gorm:"size:100"`              // TTS音色，为空时使用provider配置的音色
+	SpeechRate      float64         `json:"speech_rate"`                        // 语速倍率，1.0为正常语速，0表示使用provider配置
+	QuickReplyWords json.RawMessage `json:"quick_reply_words" gorm:"type:json"` // 快速回复词，为空时使用系统配置 audio.quick_reply_words
+	IsActive        bool            `json:"is_active" gorm:"default:true"`
+}
+
+// PersonaAssignment 人设分配，每个设备、用户各只能分配一个人设，全局分配的TargetID为0
+type PersonaAssignment struct {
+	gorm.Model
+	TargetType string  `json:"target_type" gorm:"size:20;not null;uniqueIndex:idx_persona_target"`
+	TargetID   uint    `json:"target_id" gorm:"not null;uniqueIndex:idx_persona_target"`
+	PersonaID  uint    `json:"persona_id" gorm:"not null;index"`
+	Persona    Persona `json:"persona" gorm:"foreignKey:PersonaID"`
+}
+
+// QuickReplies 解析人设的快速回复词
+func (p *Persona) QuickReplies() []string {
+	if len(p.QuickReplyWords) == 0 {
+		return nil
+	}
+	var words []string
+	if err := json.Unmarshal(p.QuickReplyWords, &words); err != nil {
+		return nil
+	}
+	return words
+}
+
+// validate 校验人设参数
+func (p *Persona) validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("人设名称不能为空")
+	}
+	if p.SpeechRate < 0 || p.SpeechRate > 3 {
+		return fmt.Errorf("speech_rate 必须在0到3之间")
+	}
+	if len(p.QuickReplyWords) > 0 && string(p.QuickReplyWords) != "null" {
+		var words []string
+		if err := json.Unmarshal(p.QuickReplyWords, &words); err != nil {
+			return fmt.Errorf("quick_reply_words 必须为字符串数组")
+		}
+	}
+	return nil
+}
+
+// ListPersonas 获取人设列表
+func (s *ConfigService) ListPersonas() ([]*Persona, error) {
+	var personas []*Persona
+	if err := s.db.DB.Order("id").Find(&personas).Error; err != nil {
+		return nil, fmt.Errorf("查询人设失败: %v", err)
+	}
+	return personas, nil
+}
+
+// GetPersona 获取人设
+func (s *ConfigService) GetPersona(id uint) (*Persona, error) {
+	var persona Persona
+	if err := s.db.DB.First(&persona, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("人设不存在")
+		}
+		return nil, fmt.Errorf("查询人设失败: %v", err)
+	}
+	return &persona, nil
+}
+
+// SavePersona 创建或更新人设
+func (s *ConfigService) SavePersona(persona *Persona) error {
+	if err := persona.validate(); err != nil {
+		return err
+	}
+	var count int64
+	if err := s.db.DB.Model(&Persona{}).Where("name = ? AND id <> ?", persona.Name, persona.ID).Count(&count).Error; err != nil {
+		return fmt.Errorf("检查人设名称失败: %v", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("人设名称已存在: %s", persona.Name)
+	}
+	if err := s.db.DB.Save(persona).Error; err != nil {
+		return fmt.Errorf("保存人设失败: %v", err)
+	}
+	s.logger.Info("人设已保存: %s (ID: %d)", persona.Name, persona.ID)
+	return nil
+}
+
+// DeletePersona 删除人设及其分配
+func (s *ConfigService) DeletePersona(id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&Persona{}, id)
+		if result.Error != nil {
+			return fmt.Errorf("删除人设失败: %v", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("人设不存在")
+		}
+		if err := tx.Unscoped().Where("persona_id = ?", id).Delete(&PersonaAssignment{}).Error; err != nil {
+			return fmt.Errorf("删除人设分配失败: %v", err)
+		}
+		return nil
+	})
+}
+
+// ListPersonaAssignments 获取人设分配列表，targetType为空时返回全部
+func (s *ConfigService) ListPersonaAssignments(targetType string) ([]*PersonaAssignment, error) {
+	var assignments []*PersonaAssignment
+	query := s.db.DB.Preload("Persona").Order("target_type, target_id")
+	if targetType != "" {
+		query = query.Where("target_type = ?", targetType)
+	}
+	if err := query.Find(&assignments).Error; err != nil {
+		return nil, fmt.Errorf("查询人设分配失败: %v", err)
+	}
+	return assignments, nil
+}
+
+// AssignPersona 将人设分配给设备、用户或全局，已有分配时替换
+func (s *ConfigService) AssignPersona(targetType string, targetID uint, personaID uint) (*PersonaAssignment, error) {
+	switch targetType {
+	case PersonaTargetDevice, PersonaTargetUser:
+		if targetID == 0 {
+			return nil, fmt.Errorf("target_id 不能为空")
+		}
+	case PersonaTargetGlobal:
+		targetID = 0
+	default:
+		return nil, fmt.Errorf("target_type 必须为 device、user 或 global")
+	}
+	persona, err := s.GetPersona(personaID)
+	if err != nil {
+		return nil, err
+	}
+
+	var assignment PersonaAssignment
+	err = s.db.DB.Where(PersonaAssignment{TargetType: targetType, TargetID: targetID}).
+		Assign(PersonaAssignment{PersonaID: personaID}).
+		FirstOrCreate(&assignment).Error
+	if err != nil {
+		return nil, fmt.Errorf("保存人设分配失败: %v", err)
+	}
+	assignment.Persona = *persona
+	s.logger.Info("人设已分配: %s %d -> %s", targetType, targetID, persona.Name)
+	return &assignment, nil
+}
+
+// UnassignPersona 取消人设分配
+func (s *ConfigService) UnassignPersona(targetType string, targetID uint) error {
+	if targetType == PersonaTargetGlobal {
+		targetID = 0
+	}
+	result := s.db.DB.Unscoped().Where("target_type = ? AND target_id = ?", targetType, targetID).
+		Delete(&PersonaAssignment{})
+	if result.Error != nil {
+		return fmt.Errorf("取消人设分配失败: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("人设分配不存在")
+	}
+	return nil
+}
+
+// ResolvePersona 解析设备会话生效的人设：设备分配优先，其次用户（未指定时为设备所有者）分配，最后全局分配；
+// 未分配或人设已停用时返回nil
+func (s *ConfigService) ResolvePersona(deviceID uint, userID *uint) (*Persona, error) {
+	ownerID := userID
+	if ownerID == nil {
+		ownerID = s.DeviceOwnerID(deviceID)
+	}
+
+	type personaTarget struct {
+		targetType string
+		targetID   uint
+	}
+	var targets []personaTarget
+	if deviceID > 0 {
+		targets = append(targets, personaTarget{PersonaTargetDevice, deviceID})
+	}
+	if ownerID != nil {
+		targets = append(targets, personaTarget{PersonaTargetUser, *ownerID})
+	}
+	targets = append(targets, personaTarget{PersonaTargetGlobal, 0})
+
+	for _, target := range targets {
+		var assignment PersonaAssignment
+		err := s.db.DB.Preload("Persona").Where("target_type = ? AND target_id = ?", target.targetType, target.targetID).
+			First(&assignment).Error
+		if err == gorm.ErrRecordNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("查询人设分配失败: %v", err)
+		}
+		if assignment.Persona.ID == 0 || !assignment.Persona.IsActive {
+			continue
+		}
+		return &assignment.Persona, nil
+	}
+	return nil, nil
+}
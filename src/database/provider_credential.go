@@ -0,0 +1,222 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ProviderCredential 用户（租户）自带的provider凭证，覆盖平台provider配置中的同名参数（如 api_key、token）。
+// 设备连接时按设备所有者查找，命中时资源池为该用户单独创建provider实例，不与其他用户共用
+type ProviderCredential struct {
+	gorm.Model
+	UserID   uint            `json:"user_id" gorm:"not null;uniqueIndex:idx_provider_credential"`
+	Category string          `json:"category" gorm:"size:20;not null;uniqueIndex:idx_provider_credential"` // 类别（LLM/TTS/VLLLM）
+	Name     string          `json:"name" gorm:"size:50;not null;uniqueIndex:idx_provider_credential"`     // 覆盖的平台provider名称
+	Props    json.RawMessage `json:"props" gorm:"type:json"`                                               // 覆盖的参数
+	IsActive bool            `json:"is_active" gorm:"default:true"`
+}
+
+// credentialCategories 支持自带凭证的类别（资源池按props创建实例的类别）
+var credentialCategories = map[string]bool{"LLM": true, "TTS": true, "VLLLM": true}
+
+// secretKeyParts 参数名包含这些片段时视为密钥，在接口返回和日志中脱敏
+var secretKeyParts = []string{"key", "token", "secret", "password"}
+
+// credentialEndpointKeys 允许随用户自有密钥一起覆盖的服务地址参数
+var credentialEndpointKeys = map[string]bool{"base_url": true, "api_url": true, "url": true}
+
+// SanitizeCredentialProps 过滤用户凭证中不允许覆盖的参数，返回保留的参数和被拒绝的参数名（已排序）。
+// 只允许覆盖密钥；服务地址只有在用户替换了平台配置中的全部密钥时才允许覆盖，避免平台密钥被发往用户指定的主机
+func SanitizeCredentialProps(base, props map[string]interface{}) (map[string]interface{}, []string) {
+	ownsAllSecrets := false
+	for key, value := range props {
+		if s, ok := value.(string); ok && s != "" && IsSecretKey(key) {
+			ownsAllSecrets = true
+			break
+		}
+	}
+	for key, value := range base {
+		if s, ok := value.(string); !ok || s == "" || !IsSecretKey(key) {
+			continue
+		}
+		if own, ok := props[key].(string); !ok || own == "" {
+			ownsAllSecrets = false
+			break
+		}
+	}
+
+	allowed := make(map[string]interface{}, len(props))
+	var rejected []string
+	for key, value := range props {
+		switch {
+		case IsSecretKey(key):
+			allowed[key] = value
+		case credentialEndpointKeys[key] && ownsAllSecrets:
+			allowed[key] = value
+		default:
+			rejected = append(rejected, key)
+		}
+	}
+	sort.Strings(rejected)
+	return allowed, rejected
+}
+
+// IsSecretKey 判断参数名是否为密钥
+func IsSecretKey(name string) bool {
+	name = strings.ToLower(name)
+	for _, part := range secretKeyParts {
+		if strings.Contains(name, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactSecrets 返回脱敏后的参数副本：密钥只保留末4位，嵌套的map同样处理
+func RedactSecrets(props map[string]interface{}) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(props))
+	for key, value := range props {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			redacted[key] = RedactSecrets(v)
+		case string:
+			if IsSecretKey(key) && v != "" {
+				redacted[key] = maskSecret(v)
+			} else {
+				redacted[key] = v
+			}
+		default:
+			redacted[key] = value
+		}
+	}
+	return redacted
+}
+
+// maskSecret 密钥脱敏，只保留末4位
+func maskSecret(secret string) string {
+	runes := []rune(secret)
+	if len(runes) <= 4 {
+		return "****"
+	}
+	return "****" + string(runes[len(runes)-4:])
+}
+
+// Redacted 返回props脱敏后的凭证副本，用于接口返回
+func (c *ProviderCredential) Redacted() *ProviderCredential {
+	copied := *c
+	var props map[string]interface{}
+	if err := json.Unmarshal(c.Props, &props); err != nil {
+		copied.Props = json.RawMessage("{}")
+		return &copied
+	}
+	data, _ := json.Marshal(RedactSecrets(props))
+	copied.Props = data
+	return &copied
+}
+
+// SaveProviderCredential 保存用户的provider凭证（存在时覆盖），provider必须是已启用的平台provider
+func (s *ConfigService) SaveProviderCredential(userID uint, category, name string, props map[string]interface{}) (*ProviderCredential, error) {
+	if !credentialCategories[category] {
+		return nil, fmt.Errorf("类别 %s 不支持自带凭证，仅支持 LLM、TTS、VLLLM", category)
+	}
+	if len(props) == 0 {
+		return nil, fmt.Errorf("凭证参数不能为空")
+	}
+	provider, err := s.GetProviderConfigByCategoryAndName(category, name)
+	if err != nil {
+		return nil, err
+	}
+	if provider == nil {
+		return nil, fmt.Errorf("provider不存在或未启用: %s/%s", category, name)
+	}
+	var base map[string]interface{}
+	if len(provider.Props) > 0 {
+		if err := json.Unmarshal(provider.Props, &base); err != nil {
+			return nil, fmt.Errorf("解析平台provider参数失败: %v", err)
+		}
+	}
+	if _, rejected := SanitizeCredentialProps(base, props); len(rejected) > 0 {
+		return nil, fmt.Errorf("凭证只能覆盖密钥参数，服务地址需与平台配置的全部密钥一起覆盖，不允许的参数: %s", strings.Join(rejected, ", "))
+	}
+
+	data, err := json.Marshal(props)
+	if err != nil {
+		return nil, fmt.Errorf("序列化凭证参数失败: %v", err)
+	}
+	credential := &ProviderCredential{UserID: userID, Category: category, Name: name}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// 唯一索引包含已软删除的记录，覆盖前硬删除旧凭证
+		if err := tx.Unscoped().Where("user_id = ? AND category = ? AND name = ?", userID, category, name).
+			Delete(&ProviderCredential{}).Error; err != nil {
+			return fmt.Errorf("删除旧凭证失败: %v", err)
+		}
+		credential.Props = data
+		credential.IsActive = true
+		if err := tx.Create(credential).Error; err != nil {
+			return fmt.Errorf("保存凭证失败: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Info("用户 %d 的provider凭证已保存: %s/%s", userID, category, name)
+	return credential, nil
+}
+
+// DeleteProviderCredential 删除用户的provider凭证
+func (s *ConfigService) DeleteProviderCredential(userID uint, category, name string) error {
+	result := s.db.DB.Unscoped().Where("user_id = ? AND category = ? AND name = ?", userID, category, name).
+		Delete(&ProviderCredential{})
+	if result.Error != nil {
+		return fmt.Errorf("删除凭证失败: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("凭证不存在")
+	}
+	return nil
+}
+
+// ListProviderCredentials 查询用户的provider凭证（未脱敏，接口返回前需调用Redacted）
+func (s *ConfigService) ListProviderCredentials(userID uint) ([]*ProviderCredential, error) {
+	var credentials []*ProviderCredential
+	if err := s.db.DB.Where("user_id = ?", userID).Order("category, name").Find(&credentials).Error; err != nil {
+		return nil, fmt.Errorf("查询凭证失败: %v", err)
+	}
+	return credentials, nil
+}
+
+// GetProviderCredential 获取用户对指定provider的凭证参数，没有启用的凭证时返回nil
+func (s *ConfigService) GetProviderCredential(userID uint, category, name string) (map[string]interface{}, error) {
+	var credential ProviderCredential
+	err := s.db.DB.Where("user_id = ? AND category = ? AND name = ? AND is_active = ?", userID, category, name, true).
+		First(&credential).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询凭证失败: %v", err)
+	}
+	var props map[string]interface{}
+	if err := json.Unmarshal(credential.Props, &props); err != nil {
+		return nil, fmt.Errorf("解析凭证参数失败: %v", err)
+	}
+	return props, nil
+}
+
+// DeviceOwnerID 获取设备所有者的用户ID，设备未绑定所有者时返回nil
+func (s *ConfigService) DeviceOwnerID(deviceID uint) *uint {
+	if deviceID == 0 {
+		return nil
+	}
+	var owner UserDevice
+	if err := s.db.DB.Where("device_id = ? AND is_owner = ? AND is_active = ?", deviceID, true, true).
+		First(&owner).Error; err != nil {
+		return nil
+	}
+	return &owner.UserID
+}
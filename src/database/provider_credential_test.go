@@ -0,0 +1,62 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSanitizeCredentialPropsKeepsSecrets(t *testing.T) {
+	base := map[string]interface{}{"api_key": "sk-platform", "base_url": "https://api.example.com", "model_name": "gpt-4o"}
+	allowed, rejected := SanitizeCredentialProps(base, map[string]interface{}{"api_key": "sk-user"})
+	if len(rejected) != 0 {
+		t.Fatalf("不应拒绝密钥参数: %v", rejected)
+	}
+	if !reflect.DeepEqual(allowed, map[string]interface{}{"api_key": "sk-user"}) {
+		t.Fatalf("保留的参数不正确: %v", allowed)
+	}
+}
+
+func TestSanitizeCredentialPropsRejectsEndpointWithoutSecret(t *testing.T) {
+	base := map[string]interface{}{"api_key": "sk-platform", "base_url": "https://api.example.com"}
+	allowed, rejected := SanitizeCredentialProps(base, map[string]interface{}{"base_url": "https://attacker.example"})
+	if !reflect.DeepEqual(rejected, []string{"base_url"}) {
+		t.Fatalf("未附带密钥的服务地址应被拒绝: %v", rejected)
+	}
+	if len(allowed) != 0 {
+		t.Fatalf("不应保留任何参数: %v", allowed)
+	}
+}
+
+func TestSanitizeCredentialPropsRejectsEndpointWithPartialSecrets(t *testing.T) {
+	// 只替换了部分密钥时，平台的其他密钥仍会发往用户指定的地址
+	base := map[string]interface{}{"api_key": "sk-platform", "secret_key": "platform-secret", "url": "https://api.example.com"}
+	props := map[string]interface{}{"api_key": "sk-user", "url": "https://attacker.example"}
+	allowed, rejected := SanitizeCredentialProps(base, props)
+	if !reflect.DeepEqual(rejected, []string{"url"}) {
+		t.Fatalf("未替换全部密钥时服务地址应被拒绝: %v", rejected)
+	}
+	if !reflect.DeepEqual(allowed, map[string]interface{}{"api_key": "sk-user"}) {
+		t.Fatalf("保留的参数不正确: %v", allowed)
+	}
+}
+
+func TestSanitizeCredentialPropsAllowsEndpointWithOwnSecrets(t *testing.T) {
+	base := map[string]interface{}{"api_key": "sk-platform", "base_url": "https://api.example.com"}
+	props := map[string]interface{}{"api_key": "sk-user", "base_url": "https://proxy.example"}
+	allowed, rejected := SanitizeCredentialProps(base, props)
+	if len(rejected) != 0 {
+		t.Fatalf("替换全部密钥后应允许覆盖服务地址: %v", rejected)
+	}
+	if !reflect.DeepEqual(allowed, props) {
+		t.Fatalf("保留的参数不正确: %v", allowed)
+	}
+}
+
+func TestSanitizeCredentialPropsRejectsOtherKeys(t *testing.T) {
+	base := map[string]interface{}{"api_key": "sk-platform", "model_name": "gpt-4o"}
+	props := map[string]interface{}{"api_key": "sk-user", "model_name": "gpt-4", "temperature": 2}
+	_, rejected := SanitizeCredentialProps(base, props)
+	if !reflect.DeepEqual(rejected, []string{"model_name", "temperature"}) {
+		t.Fatalf("非密钥参数应被拒绝: %v", rejected)
+	}
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+/*
+* 默认provider唯一性：每个类别最多只有一个默认provider配置，默认provider的解析不再依赖插入顺序。
+* 创建、更新、部分更新provider配置以及设置默认版本时，在同一事务中取消同类别其他配置的默认标记；
+* 启动时检查历史数据，同一类别存在多个默认配置时保留权重最高的一个（权重相同时优先启用中的，再取最早创建的），
+* 其余取消默认并输出警告。MySQL不支持部分唯一索引，因此在服务层保证而不是依赖数据库约束。
+ */
+
+// defaultProviderOrder 同类别存在多个默认配置时的保留顺序
+const defaultProviderOrder = "weight DESC, is_active DESC, id ASC"
+
+// clearOtherDefaults 取消同类别中除指定配置以外的默认标记
+func clearOtherDefaults(tx *gorm.DB, category string, keepID uint) (int64, error) {
+	result := tx.Model(&ProviderConfig{}).
+		Where("category = ? AND is_default = ? AND id <> ?", category, true, keepID).
+		Update("is_default", false)
+	if result.Error != nil {
+		return 0, fmt.Errorf("取消其他默认提供商配置失败: %v", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// saveProviderConfig 在事务中保存提供商配置，设为默认时取消同类别其他配置的默认标记
+func saveProviderConfig(tx *gorm.DB, config *ProviderConfig) error {
+	if err := tx.Save(config).Error; err != nil {
+		return err
+	}
+	if !config.IsDefault {
+		return nil
+	}
+	_, err := clearOtherDefaults(tx, config.Category, config.ID)
+	return err
+}
+
+// SetDefaultProviderVersion 将指定版本设为类别的默认provider配置，同类别其他配置取消默认。
+// 指定版本不存在时返回 (false, nil)
+func (s *ConfigService) SetDefaultProviderVersion(category, name, version string) (bool, error) {
+	found := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var config ProviderConfig
+		if err := tx.Where("category = ? AND name = ? AND version = ?", category, name, version).First(&config).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil
+			}
+			return fmt.Errorf("查询提供商配置失败: %v", err)
+		}
+		found = true
+		if err := tx.Model(&config).Update("is_default", true).Error; err != nil {
+			return fmt.Errorf("设置默认提供商配置失败: %v", err)
+		}
+		_, err := clearOtherDefaults(tx, category, config.ID)
+		return err
+	})
+	if err != nil || !found {
+		return found, err
+	}
+
+	s.logger.Info("默认%s provider设置为 %s/%s", category, name, version)
+	return true, nil
+}
+
+// RepairDuplicateDefaultProviders 修复同一类别存在多个默认配置的历史数据，保留权重最高的一个，
+// 返回每个被修复类别保留的provider名称
+func (s *ConfigService) RepairDuplicateDefaultProviders() (map[string]string, error) {
+	var categories []string
+	if err := s.db.DB.Model(&ProviderConfig{}).
+		Where("is_default = ?", true).
+		Group("category").
+		Having("COUNT(*) > 1").
+		Pluck("category", &categories).Error; err != nil {
+		return nil, fmt.Errorf("检查重复的默认提供商配置失败: %v", err)
+	}
+
+	repaired := make(map[string]string)
+	for _, category := range categories {
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			var keep ProviderConfig
+			if err := tx.Where("category = ? AND is_default = ?", category, true).
+				Order(defaultProviderOrder).
+				First(&keep).Error; err != nil {
+				return fmt.Errorf("查询默认提供商配置失败: %v", err)
+			}
+			cleared, err := clearOtherDefaults(tx, category, keep.ID)
+			if err != nil {
+				return err
+			}
+			s.logger.Warn("%s 类别存在 %d 个默认provider配置，保留权重最高的 %s/%s（权重 %d），其余已取消默认",
+				category, cleared+1, keep.Name, keep.Version, keep.Weight)
+			repaired[category] = keep.Name
+			return nil
+		})
+		if err != nil {
+			return repaired, fmt.Errorf("修复%s类别的默认提供商配置失败: %v", category, err)
+		}
+	}
+	return repaired, nil
+}
+
+// hasDefaultProvider 类别中是否已有默认provider配置
+func hasDefaultProvider(db *gorm.DB, category string) (bool, error) {
+	var count int64
+	if err := db.Model(&ProviderConfig{}).Where("category = ? AND is_default = ?", category, true).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ApplyProviderConfigPatch 按PATCH语义更新提供商配置：只更新请求中出现的顶层字段，
+// props 按 JSON Merge Patch（RFC 7386）深度合并，值为null的键会被删除，未出现的键保持不变
+func ApplyProviderConfigPatch(config *ProviderConfig, patch map[string]json.RawMessage) error {
+	fields := providerConfigPatchFields()
+	for key, raw := range patch {
+		if key == "props" {
+			merged, err := mergeJSONPatch(config.Props, raw)
+			if err != nil {
+				return fmt.Errorf("合并props失败: %v", err)
+			}
+			config.Props = merged
+			continue
+		}
+
+		index, ok := fields[key]
+		if !ok {
+			return fmt.Errorf("不支持更新的字段: %s", key)
+		}
+		if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+			return fmt.Errorf("字段 %s 不能为null", key)
+		}
+		field := reflect.ValueOf(config).Elem().Field(index)
+		value := reflect.New(field.Type())
+		if err := json.Unmarshal(raw, value.Interface()); err != nil {
+			return fmt.Errorf("字段 %s 格式错误: %v", key, err)
+		}
+		field.Set(value.Elem())
+	}
+	return nil
+}
+
+// providerConfigPatchFields 可通过PATCH更新的顶层字段（json名 -> 字段下标），不含ID等gorm.Model字段
+func providerConfigPatchFields() map[string]int {
+	fields := make(map[string]int)
+	configType := reflect.TypeOf(ProviderConfig{})
+	for i := 0; i < configType.NumField(); i++ {
+		field := configType.Field(i)
+		if field.Anonymous {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" || name == "props" {
+			continue
+		}
+		fields[name] = i
+	}
+	return fields
+}
+
+// mergeJSONPatch 将patch按JSON Merge Patch语义合并到original，original为空时视为空对象
+func mergeJSONPatch(original json.RawMessage, patch json.RawMessage) (json.RawMessage, error) {
+	var patchValue interface{}
+	if err := json.Unmarshal(patch, &patchValue); err != nil {
+		return nil, err
+	}
+
+	var originalValue interface{}
+	if len(bytes.TrimSpace(original)) > 0 {
+		if err := json.Unmarshal(original, &originalValue); err != nil {
+			return nil, fmt.Errorf("原props不是有效的JSON: %v", err)
+		}
+	}
+
+	merged := mergePatchValue(originalValue, patchValue)
+	if merged == nil {
+		merged = map[string]interface{}{}
+	}
+	return json.Marshal(merged)
+}
+
+// mergePatchValue 递归合并：patch为对象时逐键合并，否则直接替换
+func mergePatchValue(original, patch interface{}) interface{} {
+	patchMap, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	originalMap, ok := original.(map[string]interface{})
+	if !ok {
+		originalMap = make(map[string]interface{})
+	}
+	for key, value := range patchMap {
+		if value == nil {
+			delete(originalMap, key)
+			continue
+		}
+		originalMap[key] = mergePatchValue(originalMap[key], value)
+	}
+	return originalMap
+}
+
+// PatchProviderConfig 按PATCH语义部分更新提供商配置
+func (s *ConfigService) PatchProviderConfig(id uint, patch map[string]json.RawMessage) (*ProviderConfig, error) {
+	var config ProviderConfig
+	if err := s.db.DB.First(&config, id).Error; err != nil {
+		return nil, fmt.Errorf("提供商配置不存在: %v", err)
+	}
+	if err := ApplyProviderConfigPatch(&config, patch); err != nil {
+		return nil, err
+	}
+	_, categoryChanged := patch["category"]
+	_, typeChanged := patch["type"]
+	if categoryChanged || typeChanged {
+		if err := ValidateProviderType(config.Category, config.Type); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		return saveProviderConfig(tx, &config)
+	}); err != nil {
+		return nil, fmt.Errorf("更新提供商配置失败: %v", err)
+	}
+
+	s.logger.Info("提供商配置部分更新成功: %s/%s/%s", config.Category, config.Name, config.Version)
+	return &config, nil
+}
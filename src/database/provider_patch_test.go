@@ -0,0 +1,146 @@
+package database
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func newPatchTestConfig() *ProviderConfig {
+	return &ProviderConfig{
+		Category:       "LLM",
+		Name:           "OpenAILLM",
+		Type:           "openai",
+		Version:        "v1",
+		Weight:         100,
+		IsActive:       true,
+		MaxConcurrency: 5,
+		Props:          json.RawMessage(`{"api_key":"sk-xxx","model_name":"gpt-4o","temperature":0.7,"extra":{"a":1,"b":2}}`),
+	}
+}
+
+func decodePatch(t *testing.T, body string) map[string]json.RawMessage {
+	t.Helper()
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(body), &patch); err != nil {
+		t.Fatalf("解析patch失败: %v", err)
+	}
+	return patch
+}
+
+func decodeProps(t *testing.T, props json.RawMessage) map[string]interface{} {
+	t.Helper()
+	var value map[string]interface{}
+	if err := json.Unmarshal(props, &value); err != nil {
+		t.Fatalf("解析props失败: %v", err)
+	}
+	return value
+}
+
+func TestApplyProviderConfigPatchPartialProps(t *testing.T) {
+	tests := []struct {
+		name     string
+		patch    string
+		expected map[string]interface{}
+	}{
+		{
+			name:  "只修改一个键",
+			patch: `{"props":{"model_name":"gpt-4o-mini"}}`,
+			expected: map[string]interface{}{
+				"api_key": "sk-xxx", "model_name": "gpt-4o-mini", "temperature": 0.7,
+				"extra": map[string]interface{}{"a": float64(1), "b": float64(2)},
+			},
+		},
+		{
+			name:  "新增键",
+			patch: `{"props":{"max_tokens":500}}`,
+			expected: map[string]interface{}{
+				"api_key": "sk-xxx", "model_name": "gpt-4o", "temperature": 0.7, "max_tokens": float64(500),
+				"extra": map[string]interface{}{"a": float64(1), "b": float64(2)},
+			},
+		},
+		{
+			name:  "null删除键",
+			patch: `{"props":{"temperature":null}}`,
+			expected: map[string]interface{}{
+				"api_key": "sk-xxx", "model_name": "gpt-4o",
+				"extra": map[string]interface{}{"a": float64(1), "b": float64(2)},
+			},
+		},
+		{
+			name:  "嵌套对象深度合并",
+			patch: `{"props":{"extra":{"b":3,"c":4}}}`,
+			expected: map[string]interface{}{
+				"api_key": "sk-xxx", "model_name": "gpt-4o", "temperature": 0.7,
+				"extra": map[string]interface{}{"a": float64(1), "b": float64(3), "c": float64(4)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := newPatchTestConfig()
+			if err := ApplyProviderConfigPatch(config, decodePatch(t, tt.patch)); err != nil {
+				t.Fatalf("ApplyProviderConfigPatch() error = %v", err)
+			}
+			if got := decodeProps(t, config.Props); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("props = %v, want %v", got, tt.expected)
+			}
+			if config.Weight != 100 || config.MaxConcurrency != 5 || !config.IsActive {
+				t.Errorf("未出现在patch中的顶层字段被修改: %+v", config)
+			}
+		})
+	}
+}
+
+func TestApplyProviderConfigPatchWeightKeepsProps(t *testing.T) {
+	config := newPatchTestConfig()
+	original := decodeProps(t, config.Props)
+
+	if err := ApplyProviderConfigPatch(config, decodePatch(t, `{"weight":30,"is_active":false}`)); err != nil {
+		t.Fatalf("ApplyProviderConfigPatch() error = %v", err)
+	}
+	if config.Weight != 30 || config.IsActive {
+		t.Errorf("weight = %d, is_active = %t, want 30, false", config.Weight, config.IsActive)
+	}
+	if got := decodeProps(t, config.Props); !reflect.DeepEqual(got, original) {
+		t.Errorf("只更新权重时props被修改: %v", got)
+	}
+	if config.Name != "OpenAILLM" || config.Type != "openai" || config.MaxConcurrency != 5 {
+		t.Errorf("未出现在patch中的顶层字段被修改: %+v", config)
+	}
+}
+
+func TestApplyProviderConfigPatchEmptyProps(t *testing.T) {
+	config := newPatchTestConfig()
+	config.Props = nil
+
+	if err := ApplyProviderConfigPatch(config, decodePatch(t, `{"props":{"voice":"zh-CN"}}`)); err != nil {
+		t.Fatalf("ApplyProviderConfigPatch() error = %v", err)
+	}
+	expected := map[string]interface{}{"voice": "zh-CN"}
+	if got := decodeProps(t, config.Props); !reflect.DeepEqual(got, expected) {
+		t.Errorf("props = %v, want %v", got, expected)
+	}
+}
+
+func TestApplyProviderConfigPatchRejectsInvalidFields(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+	}{
+		{name: "未知字段", patch: `{"unknown":1}`},
+		{name: "不允许修改ID", patch: `{"ID":2}`},
+		{name: "类型错误", patch: `{"weight":"high"}`},
+		{name: "顶层字段为null", patch: `{"name":null}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := newPatchTestConfig()
+			if err := ApplyProviderConfigPatch(config, decodePatch(t, tt.patch)); err == nil {
+				t.Errorf("ApplyProviderConfigPatch(%s) 期望返回错误", tt.patch)
+			}
+		})
+	}
+}
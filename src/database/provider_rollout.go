@@ -0,0 +1,266 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ProviderAudit Provider灰度发布操作审计记录（放量等）
+type ProviderAudit struct {
+	gorm.Model
+	Category   string `json:"category" gorm:"size:50;not null;index"`
+	Name       string `json:"name" gorm:"size:100;not null;index"`
+	Version    string `json:"version" gorm:"size:50"`
+	Action     string `json:"action" gorm:"size:20;not null"` // ramp（放量）, rollback（自动回滚）, reenable（重新启用）
+	OperatorID *uint  `json:"operator_id"`                    // 操作人，系统自动操作时为空
+	Detail     string `json:"detail" gorm:"type:text"`        // 操作详情（JSON）
+}
+
+// ProviderRampResult 放量结果：各版本调整前后的权重
+type ProviderRampResult struct {
+	Category string         `json:"category"`
+	Name     string         `json:"name"`
+	Version  string         `json:"version"`
+	Percent  int            `json:"percent"`
+	Before   map[string]int `json:"before"`
+	After    map[string]int `json:"after"`
+}
+
+// RampProviderVersion 将目标版本的流量调整为percent%，并按其余启用版本的当前权重比例分配剩余流量，
+// 所有版本权重之和为100；在一个事务中更新，任一版本失败则全部回滚
+func (s *ConfigService) RampProviderVersion(category, name, version string, percent int) (*ProviderRampResult, error) {
+	if percent < 0 || percent > 100 {
+		return nil, fmt.Errorf("流量百分比必须在0-100之间")
+	}
+
+	result := &ProviderRampResult{Category: category, Name: name, Version: version, Percent: percent}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var configs []*ProviderConfig
+		if err := tx.Where("category = ? AND name = ? AND is_active = ?", category, name, true).
+			Order("version").Find(&configs).Error; err != nil {
+			return fmt.Errorf("查询激活的提供商配置失败: %v", err)
+		}
+
+		before := make(map[string]int, len(configs))
+		var target *ProviderConfig
+		for _, config := range configs {
+			before[config.Version] = config.Weight
+			if config.Version == version {
+				target = config
+			}
+		}
+		if target == nil {
+			return fmt.Errorf("版本不存在或未启用: %s/%s@%s", category, name, version)
+		}
+		if target.RolledBackAt != nil && percent > 0 {
+			return fmt.Errorf("版本 %s/%s@%s 已被自动回滚，请先重新启用", category, name, version)
+		}
+		after, err := rampWeights(configs, version, percent)
+		if err != nil {
+			return err
+		}
+
+		for _, config := range configs {
+			if after[config.Version] == config.Weight {
+				continue
+			}
+			if err := tx.Model(&ProviderConfig{}).Where("id = ?", config.ID).
+				Update("weight", after[config.Version]).Error; err != nil {
+				return fmt.Errorf("更新提供商权重失败: %v", err)
+			}
+		}
+		result.Before = before
+		result.After = after
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// RollbackProviderVersion 自动回滚：将版本权重置为0并把原权重转给默认版本，标记为已回滚，
+// 之后需通过 ReenableProviderVersion 重新启用才能再分配流量，避免回滚后又自动放量
+func (s *ConfigService) RollbackProviderVersion(category, name, version string) (*ProviderRampResult, error) {
+	result := &ProviderRampResult{Category: category, Name: name, Version: version}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var configs []*ProviderConfig
+		if err := tx.Where("category = ? AND name = ? AND is_active = ?", category, name, true).
+			Order("version").Find(&configs).Error; err != nil {
+			return fmt.Errorf("查询激活的提供商配置失败: %v", err)
+		}
+
+		before := make(map[string]int, len(configs))
+		var target, stable *ProviderConfig
+		for _, config := range configs {
+			before[config.Version] = config.Weight
+			if config.Version == version {
+				target = config
+			} else if config.IsDefault {
+				stable = config
+			}
+		}
+		if target == nil {
+			return fmt.Errorf("版本不存在或未启用: %s/%s@%s", category, name, version)
+		}
+		if target.IsDefault {
+			return fmt.Errorf("默认版本不能自动回滚: %s/%s@%s", category, name, version)
+		}
+		if stable == nil {
+			return fmt.Errorf("没有启用的默认版本承接回滚流量: %s/%s", category, name)
+		}
+
+		now := time.Now()
+		if err := tx.Model(&ProviderConfig{}).Where("id = ?", target.ID).
+			Updates(map[string]interface{}{"weight": 0, "rolled_back_at": &now}).Error; err != nil {
+			return fmt.Errorf("回滚提供商版本失败: %v", err)
+		}
+		if err := tx.Model(&ProviderConfig{}).Where("id = ?", stable.ID).
+			Update("weight", stable.Weight+target.Weight).Error; err != nil {
+			return fmt.Errorf("更新默认版本权重失败: %v", err)
+		}
+
+		after := make(map[string]int, len(before))
+		for v, weight := range before {
+			after[v] = weight
+		}
+		after[target.Version] = 0
+		after[stable.Version] = stable.Weight + target.Weight
+		result.Before = before
+		result.After = after
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ReenableProviderVersion 清除版本的自动回滚标记，权重保持为0，由管理员重新放量
+func (s *ConfigService) ReenableProviderVersion(category, name, version string) error {
+	res := s.db.DB.Model(&ProviderConfig{}).
+		Where("category = ? AND name = ? AND version = ? AND rolled_back_at IS NOT NULL", category, name, version).
+		Update("rolled_back_at", nil)
+	if res.Error != nil {
+		return fmt.Errorf("重新启用提供商版本失败: %v", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("版本不存在或未被回滚: %s/%s@%s", category, name, version)
+	}
+	return nil
+}
+
+// checkNotRolledBack 已被自动回滚的版本在重新启用前不允许分配流量
+func (s *ConfigService) checkNotRolledBack(db *gorm.DB, category, name, version string) error {
+	var count int64
+	if err := db.Model(&ProviderConfig{}).
+		Where("category = ? AND name = ? AND version = ? AND rolled_back_at IS NOT NULL", category, name, version).
+		Count(&count).Error; err != nil {
+		return fmt.Errorf("查询提供商版本失败: %v", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("版本 %s/%s@%s 已被自动回滚，请先重新启用", category, name, version)
+	}
+	return nil
+}
+
+// rampWeights 计算放量后的各版本权重：目标版本为percent，其余未回滚的版本按当前权重比例分配100-percent
+// （当前权重全为0时优先给默认版本，没有默认版本则平均分配），取整误差按余数从大到小补齐
+func rampWeights(configs []*ProviderConfig, version string, percent int) (map[string]int, error) {
+	after := map[string]int{version: percent}
+	var siblings []*ProviderConfig
+	for _, config := range configs {
+		if config.Version == version {
+			continue
+		}
+		// 已自动回滚的版本不参与分配
+		if config.RolledBackAt != nil {
+			after[config.Version] = 0
+			continue
+		}
+		siblings = append(siblings, config)
+	}
+	remaining := 100 - percent
+	if remaining > 0 && len(siblings) == 0 {
+		return nil, fmt.Errorf("没有其他启用的版本承接剩余%d%%的流量，请将目标版本设为100%%", remaining)
+	}
+
+	shares := make([]int, len(siblings))
+	total := 0
+	for i, sibling := range siblings {
+		shares[i] = sibling.Weight
+		total += sibling.Weight
+	}
+	if total == 0 {
+		for i, sibling := range siblings {
+			if sibling.IsDefault {
+				shares[i] = 1
+				total++
+			}
+		}
+	}
+	if total == 0 {
+		for i := range shares {
+			shares[i] = 1
+		}
+		total = len(shares)
+	}
+
+	type remainder struct {
+		version string
+		value   int
+	}
+	remainders := make([]remainder, 0, len(siblings))
+	assigned := 0
+	for i, sibling := range siblings {
+		weight := remaining * shares[i] / total
+		after[sibling.Version] = weight
+		assigned += weight
+		remainders = append(remainders, remainder{sibling.Version, remaining * shares[i] % total})
+	}
+	sort.SliceStable(remainders, func(i, j int) bool { return remainders[i].value > remainders[j].value })
+	for i := 0; assigned < remaining; i++ {
+		after[remainders[i%len(remainders)].version]++
+		assigned++
+	}
+	return after, nil
+}
+
+// RecordProviderAudit 保存Provider灰度发布审计记录，detail序列化为JSON
+func (s *ConfigService) RecordProviderAudit(category, name, version, action string, operatorID *uint, detail interface{}) error {
+	data, err := json.Marshal(detail)
+	if err != nil {
+		return fmt.Errorf("序列化审计详情失败: %v", err)
+	}
+	audit := &ProviderAudit{
+		Category:   category,
+		Name:       name,
+		Version:    version,
+		Action:     action,
+		OperatorID: operatorID,
+		Detail:     string(data),
+	}
+	if err := s.db.DB.Create(audit).Error; err != nil {
+		return fmt.Errorf("保存Provider审计记录失败: %v", err)
+	}
+	return nil
+}
+
+// ListProviderAudits 按时间倒序查询指定Provider的灰度发布审计记录
+func (s *ConfigService) ListProviderAudits(category, name string, offset, limit int) ([]*ProviderAudit, int64, error) {
+	query := s.db.DB.Model(&ProviderAudit{}).Where("category = ? AND name = ?", category, name)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("统计Provider审计记录失败: %v", err)
+	}
+	var audits []*ProviderAudit
+	if err := query.Order("id DESC").Offset(offset).Limit(limit).Find(&audits).Error; err != nil {
+		return nil, 0, fmt.Errorf("查询Provider审计记录失败: %v", err)
+	}
+	return audits, total, nil
+}
@@ -0,0 +1,180 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"ai-server-go/src/core/providers/schema"
+)
+
+// ProviderConfigIssue 需要配置的provider：props中仍是占位符或密钥为空
+type ProviderConfigIssue struct {
+	ID        uint     `json:"id"`
+	Category  string   `json:"category"`
+	Name      string   `json:"name"`
+	Version   string   `json:"version"`
+	Type      string   `json:"type"`
+	IsActive  bool     `json:"is_active"`
+	IsDefault bool     `json:"is_default"`
+	Fields    []string `json:"fields"` // 需要填写的参数
+}
+
+// placeholderMarkers 初始化配置和示例中常见的占位符片段（小写比较）
+var placeholderMarkers = []string{"你的", "your_", "your-", "changeme", "placeholder", "sk-xxx"}
+
+// isPlaceholder 判断参数值是否为占位符
+func isPlaceholder(value string) bool {
+	lower := strings.ToLower(strings.TrimSpace(value))
+	for _, marker := range placeholderMarkers {
+		if strings.Contains(lower, marker) {
+			return true
+		}
+	}
+	return strings.HasPrefix(lower, "<") && strings.HasSuffix(lower, ">")
+}
+
+// UnconfiguredFields 返回props中仍需配置的参数：值为占位符，或密钥参数为空；嵌套参数以 a.b 表示
+func UnconfiguredFields(props json.RawMessage) []string {
+	if len(props) == 0 {
+		return nil
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(props, &values); err != nil {
+		return nil
+	}
+	fields := collectUnconfigured("", values)
+	sort.Strings(fields)
+	return fields
+}
+
+// collectUnconfigured 递归收集需要配置的参数
+func collectUnconfigured(prefix string, values map[string]interface{}) []string {
+	var fields []string
+	for key, value := range values {
+		switch v := value.(type) {
+		case string:
+			if isPlaceholder(v) || (IsSecretKey(key) && strings.TrimSpace(v) == "") {
+				fields = append(fields, prefix+key)
+			}
+		case map[string]interface{}:
+			fields = append(fields, collectUnconfigured(prefix+key+".", v)...)
+		}
+	}
+	return fields
+}
+
+// UnconfiguredFields 返回provider仍需配置的参数，已由环境变量提供有效值的参数视为已配置
+func (c *ProviderConfig) UnconfiguredFields() []string {
+	fields := UnconfiguredFields(c.Props)
+	if len(fields) == 0 {
+		return fields
+	}
+	var props map[string]interface{}
+	_ = json.Unmarshal(c.Props, &props)
+	overrides := providerEnvOverrides(c.Name, c.envOverrideFields(props))
+	remaining := fields[:0]
+	for _, field := range fields {
+		if value, ok := overrides[field]; ok && strings.TrimSpace(value) != "" && !isPlaceholder(value) {
+			continue
+		}
+		remaining = append(remaining, field)
+	}
+	return remaining
+}
+
+// IsProviderConfigured provider的props中没有占位符和空密钥
+func IsProviderConfigured(config *ProviderConfig) bool {
+	return config != nil && len(config.UnconfiguredFields()) == 0
+}
+
+// ListUnconfiguredProviders 列出所有需要配置的provider（包括未启用的）
+func (s *ConfigService) ListUnconfiguredProviders() ([]ProviderConfigIssue, error) {
+	var configs []*ProviderConfig
+	if err := s.db.DB.Order("category, name, version").Find(&configs).Error; err != nil {
+		return nil, fmt.Errorf("查询提供商配置失败: %v", err)
+	}
+	issues := []ProviderConfigIssue{}
+	for _, config := range configs {
+		fields := config.UnconfiguredFields()
+		if len(fields) == 0 {
+			continue
+		}
+		issues = append(issues, ProviderConfigIssue{
+			ID:        config.ID,
+			Category:  config.Category,
+			Name:      config.Name,
+			Version:   config.Version,
+			Type:      config.Type,
+			IsActive:  config.IsActive,
+			IsDefault: config.IsDefault,
+			Fields:    fields,
+		})
+	}
+	return issues, nil
+}
+
+// ValidateProviderConfigs 启动时检查provider配置，对仍需配置的已启用provider输出醒目的警告
+func (s *ConfigService) ValidateProviderConfigs() ([]ProviderConfigIssue, error) {
+	issues, err := s.ListUnconfiguredProviders()
+	if err != nil {
+		return nil, err
+	}
+	for _, issue := range issues {
+		if !issue.IsActive {
+			continue
+		}
+		s.logger.Warn("!!! Provider %s/%s@%s 尚未配置（%s 仍为占位符或为空），不会被选为默认Provider，"+
+			"请通过 PUT /api/configs/provider/%s/%s 填写后使用",
+			issue.Category, issue.Name, issue.Version, strings.Join(issue.Fields, ", "), issue.Category, issue.Name)
+	}
+
+	// 类型没有已注册工厂的provider在创建时才会失败，启动时提前提示
+	var configs []*ProviderConfig
+	if err := s.db.DB.Where("is_active = ?", true).Order("category, name, version").Find(&configs).Error; err != nil {
+		return nil, fmt.Errorf("查询提供商配置失败: %v", err)
+	}
+	for _, config := range configs {
+		if err := ValidateProviderType(config.Category, config.Type); err != nil {
+			s.logger.Warn("!!! Provider %s/%s@%s 无法创建: %v", config.Category, config.Name, config.Version, err)
+		}
+	}
+	return issues, nil
+}
+
+// ValidateProviderType 检查provider类型是否有已注册的工厂：各provider在init中注册工厂时同时登记配置说明，
+// 以登记表作为可用类型列表；保存配置时拒绝未知类型，避免运行时才出现"未知的提供者类型"
+func ValidateProviderType(category, providerType string) error {
+	if strings.TrimSpace(category) == "" {
+		return fmt.Errorf("provider类别不能为空")
+	}
+	if strings.TrimSpace(providerType) == "" {
+		return fmt.Errorf("provider类型不能为空")
+	}
+	if _, ok := schema.Get(category, providerType); ok {
+		return nil
+	}
+	types := []string{}
+	for _, s := range schema.Types(category) {
+		types = append(types, s.Type)
+	}
+	return fmt.Errorf("%s 类别没有已注册的provider类型 %q，可用类型: %s", strings.ToUpper(category), providerType, strings.Join(types, ", "))
+}
+
+// PropsMap 解析Props为工厂使用的参数map，type 参数始终为 Type 列的值：
+// Type 列是provider类型的唯一来源，Props中填写的 type 会被覆盖；参数的环境变量覆盖在此应用
+func (c *ProviderConfig) PropsMap() (map[string]interface{}, error) {
+	props := make(map[string]interface{})
+	if len(c.Props) > 0 && string(c.Props) != "null" {
+		if err := json.Unmarshal(c.Props, &props); err != nil {
+			return nil, fmt.Errorf("解析%s Props失败: %v", c.Category, err)
+		}
+		if props == nil {
+			props = make(map[string]interface{})
+		}
+	}
+	c.applyEnvOverrides(props)
+	props["type"] = c.Type
+	return props, nil
+}
@@ -0,0 +1,194 @@
+package database
+
+import (
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"ai-server-go/src/configs"
+	"ai-server-go/src/core/utils"
+
+	"gorm.io/gorm"
+)
+
+/*
+* 数据库临时故障处理：服务层的关键读取和事务遇到临时错误（连接被拒绝、连接断开、死锁等）时按指数退避重试；
+* 连续多次临时错误后熔断，熔断期间所有语句立即返回 ErrDatabaseUnavailable 而不再等待连接超时，
+* API 返回503，对话流水线使用最近一次成功读取的配置。冷却时间过后放行语句，成功即恢复，失败则继续熔断。
+ */
+
+// ErrDatabaseUnavailable 数据库熔断期间返回的错误
+var ErrDatabaseUnavailable = errors.New("数据库暂时不可用")
+
+const (
+	defaultDBRetryAttempts    = 3
+	defaultDBRetryBackoff     = 100 * time.Millisecond
+	maxDBRetryBackoff         = 2 * time.Second // 单次重试等待上限
+	defaultDBBreakerThreshold = 5
+	defaultDBBreakerCooldown  = 10 * time.Second
+)
+
+// transientErrorPatterns 临时错误的特征文本（驱动错误多为字符串，统一按小写匹配）
+var transientErrorPatterns = []string{
+	"connection refused",
+	"connection reset",
+	"broken pipe",
+	"bad connection",
+	"invalid connection",
+	"i/o timeout",
+	"server has gone away",
+	"too many connections",
+	"deadlock",                   // MySQL 1213、PostgreSQL 40P01
+	"lock wait timeout",          // MySQL 1205
+	"could not serialize access", // PostgreSQL 40001
+	"database is locked",         // SQLite
+	"the database system is starting up",
+	"the database system is shutting down",
+}
+
+// IsTransientError 判断是否为重试可能成功的临时错误
+func IsTransientError(err error) bool {
+	if err == nil || errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, ErrDatabaseUnavailable) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	message := strings.ToLower(err.Error())
+	for _, pattern := range transientErrorPatterns {
+		if strings.Contains(message, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsUnavailableError 判断错误是否由数据库不可用（熔断或临时故障）引起
+func IsUnavailableError(err error) bool {
+	return errors.Is(err, ErrDatabaseUnavailable) || IsTransientError(err)
+}
+
+// dbRetryPolicy 临时错误重试策略
+type dbRetryPolicy struct {
+	maxAttempts int
+	backoff     time.Duration
+}
+
+// dbBreaker 数据库熔断器：连续临时错误达到阈值后熔断，冷却后放行语句试探
+type dbBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	logger    *utils.Logger
+
+	mu        sync.Mutex
+	failures  int       // 连续临时错误次数
+	openUntil time.Time // 熔断截止时间，零值表示未熔断
+}
+
+// newDBResilience 根据配置创建重试策略和熔断器，未配置的字段使用默认值
+func newDBResilience(config configs.DatabaseRetryConfig, logger *utils.Logger) (dbRetryPolicy, *dbBreaker) {
+	policy := dbRetryPolicy{maxAttempts: defaultDBRetryAttempts, backoff: defaultDBRetryBackoff}
+	if config.MaxAttempts > 0 {
+		policy.maxAttempts = config.MaxAttempts
+	}
+	if config.BackoffMs > 0 {
+		policy.backoff = time.Duration(config.BackoffMs) * time.Millisecond
+	}
+
+	breaker := &dbBreaker{threshold: defaultDBBreakerThreshold, cooldown: defaultDBBreakerCooldown, logger: logger}
+	if config.BreakerThreshold != 0 {
+		breaker.threshold = config.BreakerThreshold
+	}
+	if config.BreakerCooldown > 0 {
+		breaker.cooldown = time.Duration(config.BreakerCooldown) * time.Second
+	}
+	return policy, breaker
+}
+
+// allow 是否允许执行语句：未熔断或已过冷却时间
+func (b *dbBreaker) allow() bool {
+	if b == nil || b.threshold < 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.openUntil.IsZero() || !time.Now().Before(b.openUntil)
+}
+
+// record 记录语句结果：临时错误累计失败次数，其余结果（包括记录不存在等业务错误）视为数据库可用
+func (b *dbBreaker) record(err error) {
+	if b == nil || b.threshold < 0 || errors.Is(err, ErrDatabaseUnavailable) {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !IsTransientError(err) {
+		if !b.openUntil.IsZero() && b.logger != nil {
+			b.logger.Info("数据库已恢复，解除熔断")
+		}
+		b.failures = 0
+		b.openUntil = time.Time{}
+		return
+	}
+	b.failures++
+	if b.failures < b.threshold {
+		return
+	}
+	if b.openUntil.IsZero() && b.logger != nil {
+		b.logger.Error("数据库连续%d次临时错误，熔断%s: %v", b.failures, b.cooldown, err)
+	}
+	b.openUntil = time.Now().Add(b.cooldown)
+}
+
+// registerBreakerCallbacks 在所有语句前后挂载熔断检查：熔断期间语句不执行，直接返回 ErrDatabaseUnavailable
+func (d *Database) registerBreakerCallbacks() error {
+	before := func(db *gorm.DB) {
+		if !d.breaker.allow() {
+			db.AddError(ErrDatabaseUnavailable)
+		}
+	}
+	after := func(db *gorm.DB) {
+		d.breaker.record(db.Error)
+	}
+
+	callback := d.DB.Callback()
+	return errors.Join(
+		callback.Create().Before("*").Register("breaker:before_create", before),
+		callback.Create().After("*").Register("breaker:after_create", after),
+		callback.Query().Before("*").Register("breaker:before_query", before),
+		callback.Query().After("*").Register("breaker:after_query", after),
+		callback.Update().Before("*").Register("breaker:before_update", before),
+		callback.Update().After("*").Register("breaker:after_update", after),
+		callback.Delete().Before("*").Register("breaker:before_delete", before),
+		callback.Delete().After("*").Register("breaker:after_delete", after),
+		callback.Row().Before("*").Register("breaker:before_row", before),
+		callback.Row().After("*").Register("breaker:after_row", after),
+		callback.Raw().Before("*").Register("breaker:before_raw", before),
+		callback.Raw().After("*").Register("breaker:after_raw", after),
+	)
+}
+
+// Available 数据库是否可用（未熔断或已过冷却时间）
+func (d *Database) Available() bool {
+	return d.breaker.allow()
+}
+
+// WithRetry 执行数据库操作，遇到临时错误时按指数退避重试；熔断后不再重试
+func (d *Database) WithRetry(fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= d.retry.maxAttempts || !IsTransientError(err) || !d.Available() {
+			return err
+		}
+		delay := min(d.retry.backoff<<(attempt-1), maxDBRetryBackoff)
+		if d.breaker != nil && d.breaker.logger != nil {
+			d.breaker.logger.Warn("数据库临时错误（第%d次），%v后重试: %v", attempt, delay, err)
+		}
+		time.Sleep(delay)
+	}
+}
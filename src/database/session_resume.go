@@ -0,0 +1,64 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// GetRecentSessionMessages 获取会话最近的limit条消息（按时间正序）
+func (s *ChatMemoryService) GetRecentSessionMessages(sessionID string, limit int) ([]ChatMessage, error) {
+	var messages []ChatMessage
+	query := s.db.Where("session_id = ?", sessionID).Order("timestamp DESC, id DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Find(&messages).Error; err != nil {
+		return nil, fmt.Errorf("获取会话消息失败: %v", err)
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+// FindResumableSession 查找设备在window内仍有消息往来的活跃会话，没有时返回nil
+func (s *ChatMemoryService) FindResumableSession(deviceID uint, window time.Duration) (*ChatSession, error) {
+	var message ChatMessage
+	err := s.db.Where("device_id = ? AND timestamp >= ?", deviceID, time.Now().Add(-window)).
+		Order("timestamp DESC").First(&message).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询最近会话失败: %v", err)
+	}
+
+	var session ChatSession
+	err = s.db.Where("session_id = ? AND device_id = ? AND status = ?", message.SessionID, deviceID, "active").
+		First(&session).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询最近会话失败: %v", err)
+	}
+	return &session, nil
+}
+
+// GetSessionSummary 获取会话摘要：优先使用会话记录的摘要，其次使用自动生成的最新summary记忆
+func (s *ChatMemoryService) GetSessionSummary(session *ChatSession) string {
+	if session == nil {
+		return ""
+	}
+	if session.Summary != "" {
+		return session.Summary
+	}
+	var memory ChatMemory
+	if err := s.db.Where("session_id = ? AND memory_type = ? AND is_active = ?", session.SessionID, "summary", true).
+		Order("updated_at DESC").First(&memory).Error; err != nil {
+		return ""
+	}
+	return memory.Content
+}
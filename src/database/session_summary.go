@@ -0,0 +1,183 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*
+* 会话摘要：连接关闭时写入的会话级指标（轮次、各阶段耗时、provider、错误数、估算费用），
+* 每个会话一条，断线重连恢复的会话在同一条记录上累加，供会话分析直接查询。
+ */
+
+// SessionSummary 会话摘要
+type SessionSummary struct {
+	gorm.Model
+	SessionID     string          `json:"session_id" gorm:"size:100;not null;uniqueIndex"`
+	DeviceID      uint            `json:"device_id" gorm:"not null;index"`
+	UserID        *uint           `json:"user_id" gorm:"index"`
+	StartTime     time.Time       `json:"start_time" gorm:"not null"`
+	EndTime       time.Time       `json:"end_time" gorm:"not null;index"`
+	DurationMs    int64           `json:"duration_ms"`                  // 各次连接的时长之和（毫秒）
+	Connections   int             `json:"connections" gorm:"default:1"` // 会话包含的连接数，断线重连恢复时累加
+	Turns         int             `json:"turns"`                        // 对话轮次数
+	ASRCount      int             `json:"asr_count"`                    // 计入耗时的识别次数
+	ASRLatencyMs  int64           `json:"asr_latency_ms"`               // 说话结束到识别结果的累计耗时
+	LLMCount      int             `json:"llm_count"`                    // 计入耗时的LLM请求次数
+	LLMLatencyMs  int64           `json:"llm_latency_ms"`               // LLM请求到生成第一句的累计耗时
+	TTSCount      int             `json:"tts_count"`                    // 合成的句数
+	TTSLatencyMs  int64           `json:"tts_latency_ms"`               // 语音合成的累计耗时
+	ErrorCount    int             `json:"error_count"`                  // 各阶段失败和超时的总数
+	Errors        json.RawMessage `json:"errors" gorm:"type:json"`      // 各阶段的错误数，如 {"llm":1}
+	Providers     json.RawMessage `json:"providers" gorm:"type:json"`   // 各能力使用过的provider，如 {"llm":["OpenAI"]}
+	EstimatedCost float64         `json:"estimated_cost"`               // 估算费用
+}
+
+// SessionSummaryQuery 会话摘要查询条件
+type SessionSummaryQuery struct {
+	DeviceID uint
+	UserID   *uint
+	Since    *time.Time
+	Until    *time.Time
+	Limit    int
+	Offset   int
+}
+
+// ErrorsMap 解析各阶段的错误数
+func (s *SessionSummary) ErrorsMap() map[string]int {
+	errors := make(map[string]int)
+	if len(s.Errors) > 0 {
+		_ = json.Unmarshal(s.Errors, &errors)
+	}
+	return errors
+}
+
+// SetErrors 设置各阶段的错误数
+func (s *SessionSummary) SetErrors(errors map[string]int) {
+	data, _ := json.Marshal(errors)
+	s.Errors = data
+}
+
+// ProvidersMap 解析各能力使用过的provider
+func (s *SessionSummary) ProvidersMap() map[string][]string {
+	providers := make(map[string][]string)
+	if len(s.Providers) > 0 {
+		_ = json.Unmarshal(s.Providers, &providers)
+	}
+	return providers
+}
+
+// SetProviders 设置各能力使用过的provider
+func (s *SessionSummary) SetProviders(providers map[string][]string) {
+	data, _ := json.Marshal(providers)
+	s.Providers = data
+}
+
+// merge 将一次连接的摘要累加到已有摘要上
+func (s *SessionSummary) merge(other *SessionSummary) {
+	if other.StartTime.Before(s.StartTime) {
+		s.StartTime = other.StartTime
+	}
+	if other.EndTime.After(s.EndTime) {
+		s.EndTime = other.EndTime
+	}
+	if s.UserID == nil {
+		s.UserID = other.UserID
+	}
+	s.DurationMs += other.DurationMs
+	s.Connections += other.Connections
+	s.Turns += other.Turns
+	s.ASRCount += other.ASRCount
+	s.ASRLatencyMs += other.ASRLatencyMs
+	s.LLMCount += other.LLMCount
+	s.LLMLatencyMs += other.LLMLatencyMs
+	s.TTSCount += other.TTSCount
+	s.TTSLatencyMs += other.TTSLatencyMs
+	s.ErrorCount += other.ErrorCount
+	s.EstimatedCost += other.EstimatedCost
+
+	errors := s.ErrorsMap()
+	for stage, count := range other.ErrorsMap() {
+		errors[stage] += count
+	}
+	s.SetErrors(errors)
+
+	providers := s.ProvidersMap()
+	for capability, names := range other.ProvidersMap() {
+		for _, name := range names {
+			if !slices.Contains(providers[capability], name) {
+				providers[capability] = append(providers[capability], name)
+			}
+		}
+	}
+	s.SetProviders(providers)
+}
+
+// SaveSessionSummary 保存会话摘要，会话已有摘要时累加
+func (s *DeviceService) SaveSessionSummary(summary *SessionSummary) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var existing SessionSummary
+		err := tx.Where("session_id = ?", summary.SessionID).First(&existing).Error
+		if err == gorm.ErrRecordNotFound {
+			if err := tx.Create(summary).Error; err != nil {
+				return fmt.Errorf("保存会话摘要失败: %v", err)
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("查询会话摘要失败: %v", err)
+		}
+		existing.merge(summary)
+		if err := tx.Save(&existing).Error; err != nil {
+			return fmt.Errorf("更新会话摘要失败: %v", err)
+		}
+		return nil
+	})
+}
+
+// GetSessionSummary 获取会话摘要，不存在时返回nil
+func (s *DeviceService) GetSessionSummary(sessionID string) (*SessionSummary, error) {
+	var summary SessionSummary
+	if err := s.db.DB.Where("session_id = ?", sessionID).First(&summary).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("查询会话摘要失败: %v", err)
+	}
+	return &summary, nil
+}
+
+// ListSessionSummaries 按结束时间倒序查询会话摘要，返回本页记录和总数
+func (s *DeviceService) ListSessionSummaries(query SessionSummaryQuery) ([]*SessionSummary, int64, error) {
+	if query.Limit <= 0 {
+		query.Limit = 50
+	}
+
+	db := s.db.DB.Model(&SessionSummary{})
+	if query.DeviceID > 0 {
+		db = db.Where("device_id = ?", query.DeviceID)
+	}
+	if query.UserID != nil {
+		db = db.Where("user_id = ?", *query.UserID)
+	}
+	if query.Since != nil {
+		db = db.Where("end_time >= ?", *query.Since)
+	}
+	if query.Until != nil {
+		db = db.Where("end_time < ?", *query.Until)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("统计会话摘要失败: %v", err)
+	}
+	var summaries []*SessionSummary
+	if err := db.Order("end_time DESC").Limit(query.Limit).Offset(query.Offset).Find(&summaries).Error; err != nil {
+		return nil, 0, fmt.Errorf("查询会话摘要失败: %v", err)
+	}
+	return summaries, total, nil
+}
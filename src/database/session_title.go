@@ -0,0 +1,88 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// 会话标题来源
+const (
+	SessionTitleAuto   = "auto"   // 根据对话内容自动生成
+	SessionTitleManual = "manual" // 管理员手动命名，不再自动更新
+)
+
+// NeedsAutoTitle 会话是否还需要自动生成标题：已自动生成或手动命名过的会话不再生成
+func (s *ChatMemoryService) NeedsAutoTitle(sessionID string) (bool, error) {
+	session, err := s.GetSession(sessionID)
+	if err != nil {
+		return false, err
+	}
+	return session.TitleSource != SessionTitleAuto && session.TitleSource != SessionTitleManual, nil
+}
+
+// SetAutoSessionTitle 写入自动生成的标题，会话已被手动命名时不覆盖
+func (s *ChatMemoryService) SetAutoSessionTitle(sessionID, title string) (bool, error) {
+	session, err := s.GetSession(sessionID)
+	if err != nil {
+		return false, err
+	}
+	if session.TitleSource == SessionTitleManual {
+		return false, nil
+	}
+	if err := s.UpdateSession(sessionID, map[string]interface{}{
+		"title":        title,
+		"title_source": SessionTitleAuto,
+	}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RenameSession 手动命名会话，之后不再自动生成标题
+func (s *ChatMemoryService) RenameSession(sessionID, title string) error {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return fmt.Errorf("会话标题不能为空")
+	}
+	if len([]rune(title)) > 200 {
+		return fmt.Errorf("会话标题不能超过200个字符")
+	}
+	if _, err := s.GetSession(sessionID); err != nil {
+		return err
+	}
+	return s.UpdateSession(sessionID, map[string]interface{}{
+		"title":        title,
+		"title_source": SessionTitleManual,
+	})
+}
+
+// CleanSessionTitle 整理生成的标题：取第一行，去掉引号、"标题："前缀和首尾标点，按字符数截断
+func CleanSessionTitle(title string, maxLength int) string {
+	title = strings.TrimSpace(title)
+	if i := strings.IndexAny(title, "\r\n"); i >= 0 {
+		title = title[:i]
+	}
+	for _, prefix := range []string{"标题：", "标题:", "Title:"} {
+		title = strings.TrimPrefix(title, prefix)
+	}
+	title = strings.TrimFunc(title, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsPunct(r) || strings.ContainsRune("“”‘’《》「」『』", r)
+	})
+	if maxLength > 0 {
+		if runes := []rune(title); len(runes) > maxLength {
+			title = string(runes[:maxLength])
+		}
+	}
+	return title
+}
+
+// HeuristicSessionTitle 无法使用LLM时的标题：取第一条有内容的用户消息
+func HeuristicSessionTitle(userMessages []string, maxLength int) string {
+	for _, message := range userMessages {
+		if title := CleanSessionTitle(message, maxLength); title != "" {
+			return title
+		}
+	}
+	return ""
+}
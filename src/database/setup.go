@@ -0,0 +1,238 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"ai-server-go/src/core/providers/schema"
+
+	"gorm.io/gorm"
+)
+
+/*
+* 首次部署引导：默认provider配置中的密钥是占位符，新部署需要管理员填写后才能对话。
+* 引导状态检查 LLM、ASR、TTS 三个必需类别是否各有一个可用的provider（类型已注册、必填参数齐全、没有占位符），
+* 完成引导时校验并启用选中的provider、将其设为该类别的默认版本，并在系统配置 setup 分类中记录完成状态。
+* setup.block_conversations 开启时，引导完成前新连接的对话会被拒绝并播报提示。
+ */
+
+// SetupCategories 引导时需要可用provider的类别
+var SetupCategories = []string{"LLM", "ASR", "TTS"}
+
+const defaultSetupPendingMessage = "设备服务尚未完成初始化配置，请联系管理员"
+
+// SetupCategoryStatus 单个类别的引导状态
+type SetupCategoryStatus struct {
+	Category string                `json:"category"`
+	Ready    bool                  `json:"ready"`              // 是否有可用的provider
+	Provider string                `json:"provider,omitempty"` // 可用时将使用的provider名称
+	Version  string                `json:"version,omitempty"`  // 可用时将使用的provider版本
+	Problems []string              `json:"problems,omitempty"` // 不可用的原因
+	Issues   []ProviderConfigIssue `json:"issues,omitempty"`   // 该类别中仍需配置的provider
+}
+
+// SetupStatus 首次部署引导状态
+type SetupStatus struct {
+	Completed          bool                  `json:"completed"`              // 是否已完成引导
+	CompletedAt        string                `json:"completed_at,omitempty"` // 完成时间
+	Ready              bool                  `json:"ready"`                  // 必需类别是否都有可用的provider
+	BlockConversations bool                  `json:"block_conversations"`    // 引导完成前是否拒绝对话
+	Categories         []SetupCategoryStatus `json:"categories"`
+}
+
+// SetupCompleteRequest 完成引导的请求，Providers 为类别到provider名称的映射，未指定的类别自动选择
+type SetupCompleteRequest struct {
+	Providers map[string]string `json:"providers"`
+}
+
+// SetupError 完成引导时的校验失败，按类别列出原因
+type SetupError struct {
+	Categories []SetupCategoryStatus
+}
+
+func (e *SetupError) Error() string {
+	var parts []string
+	for _, category := range e.Categories {
+		if !category.Ready {
+			parts = append(parts, fmt.Sprintf("%s: %s", category.Category, strings.Join(category.Problems, "; ")))
+		}
+	}
+	return "初始化配置校验失败: " + strings.Join(parts, " | ")
+}
+
+// SetupProblems 检查provider的配置是否可以作为引导的最小可用配置，返回不可用的原因
+func SetupProblems(config *ProviderConfig) []string {
+	var problems []string
+	if err := ValidateProviderType(config.Category, config.Type); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if fields := config.UnconfiguredFields(); len(fields) > 0 {
+		problems = append(problems, fmt.Sprintf("%s 的参数仍为占位符或为空: %s", config.Name, strings.Join(fields, ", ")))
+	}
+	if s, ok := schema.Get(config.Category, config.Type); ok {
+		props, err := config.PropsMap()
+		if err != nil {
+			problems = append(problems, err.Error())
+			return problems
+		}
+		var missing []string
+		for _, field := range s.Fields {
+			if !field.Required || field.Default != nil {
+				continue
+			}
+			if value, exists := props[field.Name]; !exists || value == nil || value == "" {
+				missing = append(missing, field.Name)
+			}
+		}
+		if len(missing) > 0 {
+			sort.Strings(missing)
+			problems = append(problems, fmt.Sprintf("%s 缺少必填参数: %s", config.Name, strings.Join(missing, ", ")))
+		}
+	}
+	return problems
+}
+
+// GetSetupStatus 获取首次部署引导状态
+func (s *ConfigService) GetSetupStatus() (*SetupStatus, error) {
+	status := &SetupStatus{Ready: true, Categories: []SetupCategoryStatus{}}
+	if completed, err := s.GetSystemConfigBool("setup", "completed"); err == nil {
+		status.Completed = completed
+	}
+	if completedAt, err := s.GetSystemConfigValue("setup", "completed_at"); err == nil {
+		status.CompletedAt = completedAt
+	}
+	if block, err := s.GetSystemConfigBool("setup", "block_conversations"); err == nil {
+		status.BlockConversations = block
+	}
+
+	issues, err := s.ListUnconfiguredProviders()
+	if err != nil {
+		return nil, err
+	}
+	for _, category := range SetupCategories {
+		categoryStatus, _, err := s.setupCandidate(category, "")
+		if err != nil {
+			return nil, err
+		}
+		for _, issue := range issues {
+			if strings.EqualFold(issue.Category, category) {
+				categoryStatus.Issues = append(categoryStatus.Issues, issue)
+			}
+		}
+		status.Ready = status.Ready && categoryStatus.Ready
+		status.Categories = append(status.Categories, categoryStatus)
+	}
+	return status, nil
+}
+
+// setupCandidate 选择类别中用于引导的provider：指定名称时只检查该provider，
+// 否则依次尝试默认版本和按权重排序的其他已启用provider，返回第一个可用的
+func (s *ConfigService) setupCandidate(category, name string) (SetupCategoryStatus, *ProviderConfig, error) {
+	status := SetupCategoryStatus{Category: category}
+
+	var configs []*ProviderConfig
+	query := s.db.DB.Where("category = ?", category)
+	if name != "" {
+		// 指定名称时允许选中未启用的provider，完成引导时会启用
+		query = query.Where("name = ?", name)
+	} else {
+		query = query.Where("is_active = ?", true)
+	}
+	if err := query.Order("is_default DESC, is_active DESC, weight DESC, id ASC").Find(&configs).Error; err != nil {
+		return status, nil, fmt.Errorf("查询提供商配置失败: %v", err)
+	}
+	if len(configs) == 0 {
+		if name != "" {
+			status.Problems = []string{fmt.Sprintf("找不到 %s provider %s", category, name)}
+		} else {
+			status.Problems = []string{fmt.Sprintf("没有已启用的 %s provider", category)}
+		}
+		return status, nil, nil
+	}
+
+	for _, config := range configs {
+		problems := SetupProblems(config)
+		if len(problems) == 0 {
+			status.Ready = true
+			status.Provider = config.Name
+			status.Version = config.Version
+			status.Problems = nil
+			return status, config, nil
+		}
+		status.Problems = append(status.Problems, problems...)
+	}
+	return status, nil, nil
+}
+
+// CompleteSetup 校验并启用各必需类别的provider，设为默认版本并标记引导完成；任一类别不可用时不做任何修改
+func (s *ConfigService) CompleteSetup(req SetupCompleteRequest, updatedBy *uint) (*SetupStatus, error) {
+	requested := make(map[string]string)
+	for category, name := range req.Providers {
+		requested[strings.ToUpper(strings.TrimSpace(category))] = strings.TrimSpace(name)
+	}
+
+	var selected []*ProviderConfig
+	var categories []SetupCategoryStatus
+	ready := true
+	for _, category := range SetupCategories {
+		status, config, err := s.setupCandidate(category, requested[category])
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, status)
+		if config == nil {
+			ready = false
+			continue
+		}
+		selected = append(selected, config)
+	}
+	if !ready {
+		return nil, &SetupError{Categories: categories}
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for _, config := range selected {
+			if err := tx.Model(&ProviderConfig{}).Where("category = ? AND id <> ?", config.Category, config.ID).
+				Update("is_default", false).Error; err != nil {
+				return fmt.Errorf("重置默认%s provider失败: %v", config.Category, err)
+			}
+			if err := tx.Model(&ProviderConfig{}).Where("id = ?", config.ID).
+				Updates(map[string]interface{}{"is_active": true, "is_default": true}).Error; err != nil {
+				return fmt.Errorf("启用%s provider %s 失败: %v", config.Category, config.Name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.SetSystemConfig("setup", "completed", "true", "bool", "是否已完成首次部署引导", true, nil, updatedBy); err != nil {
+		return nil, err
+	}
+	completedAt := time.Now().Format(time.RFC3339)
+	if err := s.SetSystemConfig("setup", "completed_at", completedAt, "string", "首次部署引导完成时间", true, nil, updatedBy); err != nil {
+		return nil, err
+	}
+	for _, config := range selected {
+		s.logger.Info("首次部署引导: %s 使用 %s@%s", config.Category, config.Name, config.Version)
+	}
+	return s.GetSetupStatus()
+}
+
+// SetupPendingMessage 引导未完成且配置为拒绝对话时返回提示语，否则返回空
+func (s *ConfigService) SetupPendingMessage() string {
+	block, err := s.GetSystemConfigBool("setup", "block_conversations")
+	if err != nil || !block {
+		return ""
+	}
+	if completed, err := s.GetSystemConfigBool("setup", "completed"); err == nil && completed {
+		return ""
+	}
+	if message, err := s.GetSystemConfigValue("setup", "pending_message"); err == nil && message != "" {
+		return message
+	}
+	return defaultSetupPendingMessage
+}
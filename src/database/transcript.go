@@ -0,0 +1,83 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// transcriptBatchSize 导出对话记录时每批读取的消息数
+const transcriptBatchSize = 200
+
+// CanAccessSession 用户是否可以查看会话：会话属于该用户，或该用户绑定了会话所在的设备
+func (s *ChatMemoryService) CanAccessSession(session *ChatSession, userID uint) bool {
+	if session.UserID != nil && *session.UserID == userID {
+		return true
+	}
+	var count int64
+	if err := s.db.Model(&UserDevice{}).
+		Where("user_id = ? AND device_id = ? AND is_active = ?", userID, session.DeviceID, true).
+		Count(&count).Error; err != nil {
+		s.logger.Error("查询用户设备绑定失败: %v", err)
+		return false
+	}
+	return count > 0
+}
+
+// StreamSessionMessages 按时间顺序分批读取会话的全部消息，每批调用一次fn，fn返回错误时停止
+func (s *ChatMemoryService) StreamSessionMessages(sessionID string, fn func(messages []ChatMessage) error) error {
+	var batch []ChatMessage
+	result := s.db.Where("session_id = ?", sessionID).
+		FindInBatches(&batch, transcriptBatchSize, func(tx *gorm.DB, _ int) error {
+			return fn(batch)
+		})
+	if result.Error != nil {
+		return fmt.Errorf("读取会话消息失败: %v", result.Error)
+	}
+	return nil
+}
+
+// ListSessionMemories 获取会话生成的记忆（按生成时间排序），用于对话记录中的记忆标注
+func (s *ChatMemoryService) ListSessionMemories(sessionID string) ([]ChatMemory, error) {
+	var memories []ChatMemory
+	if err := s.db.Where("session_id = ? AND is_active = ?", sessionID, true).
+		Order("created_at ASC").Find(&memories).Error; err != nil {
+		return nil, fmt.Errorf("获取会话记忆失败: %v", err)
+	}
+	return memories, nil
+}
+
+// AttachmentReference 附件在对话记录中的引用：URL和存储图片引用（blob:<key>）原样保留，内嵌的data URL不输出内容，只保留类型和大小
+func AttachmentReference(attachment ChatAttachment) string {
+	if !strings.HasPrefix(attachment.Ref, "data:") {
+		return attachment.Ref
+	}
+	size := 0
+	if comma := strings.Index(attachment.Ref, ","); comma >= 0 {
+		size = len(attachment.Ref) - comma - 1
+		if strings.Contains(attachment.Ref[:comma], ";base64") {
+			size = size * 3 / 4
+		}
+	}
+	mimeType := attachment.MimeType
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	return fmt.Sprintf("inline:%s (%d bytes, 内容已省略)", mimeType, size)
+}
+
+// RedactAttachments 将消息附件替换为引用，用于列表接口，图片内容只能通过单张读取接口获取
+func (m *ChatMessage) RedactAttachments() {
+	attachments := m.GetAttachments()
+	if len(attachments) == 0 {
+		return
+	}
+	for i := range attachments {
+		attachments[i].Ref = AttachmentReference(attachments[i])
+	}
+	if data, err := json.Marshal(attachments); err == nil {
+		m.Attachments = string(data)
+	}
+}
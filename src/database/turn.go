@@ -0,0 +1,144 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"ai-server-go/src/core/chat"
+
+	"gorm.io/gorm"
+)
+
+/*
+* 对话轮次记录：一轮对话产生的用户消息、助手回复、会话消息计数和用量统计在同一个事务中写入，
+* 任一写入失败时整轮回滚，保证会话的 message_count 与实际保存的消息数一致。
+* 记忆生成耗时较长且可能调用LLM，在事务提交后异步执行，失败时按记忆重试策略处理。
+ */
+
+// TurnMessage 一轮对话中的一条消息
+type TurnMessage struct {
+	Role        string                 // user 或 assistant
+	Content     string                 // 消息内容
+	MessageType string                 // 消息类型，为空时为text
+	Metadata    map[string]interface{} // 元数据
+	Attachments []ChatAttachment       // 多模态附件（已写入存储的引用）
+	Moderation  *MessageModeration     // 内容审核结果，未审核为空
+	Timestamp   time.Time              // 消息时间，为空时使用写入时间
+}
+
+// TurnUsage 一轮对话中一项能力的用量及估算费用
+type TurnUsage struct {
+	Capability string
+	Usage      UsageAmount
+	Cost       float64
+}
+
+// ConversationTurn 一轮对话需要持久化的全部内容
+type ConversationTurn struct {
+	SessionID string
+	UserID    *uint
+	DeviceID  uint
+	Messages  []TurnMessage
+	Usage     []TurnUsage
+	Dialogue  []chat.Message // 提交后用于生成记忆的对话历史，为空时不生成记忆
+}
+
+// RecordTurn 在一个事务中保存本轮消息、更新会话消息计数并累加用量统计，提交成功后异步生成记忆
+func (s *ChatMemoryService) RecordTurn(turn ConversationTurn) error {
+	if len(turn.Messages) == 0 && len(turn.Usage) == 0 {
+		return nil
+	}
+
+	messages := make([]*ChatMessage, 0, len(turn.Messages))
+	for _, msg := range turn.Messages {
+		message, err := newTurnChatMessage(turn, msg)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, message)
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if len(messages) > 0 {
+			if err := tx.Create(&messages).Error; err != nil {
+				return fmt.Errorf("保存对话消息失败: %v", err)
+			}
+			if err := incrementMessageCount(tx, turn.SessionID, len(messages)); err != nil {
+				return err
+			}
+		}
+		// 设备未注册时没有可归属的使用统计
+		if turn.DeviceID == 0 {
+			return nil
+		}
+		for _, usage := range turn.Usage {
+			if err := recordUsage(tx, turn.UserID, turn.DeviceID, usage.Capability, usage.Usage, usage.Cost, true, 0); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("记录对话轮次失败: %v", err)
+	}
+
+	if len(turn.Dialogue) > 0 && len(messages) > 0 {
+		go func() {
+			if err := s.GenerateMemoryFromDialogue(context.Background(), turn.UserID, turn.DeviceID, turn.SessionID, turn.Dialogue); err != nil {
+				s.logger.Warn("生成对话记忆失败: %v", err)
+			}
+		}()
+	}
+	return nil
+}
+
+// newTurnChatMessage 将轮次消息转换为数据库消息记录
+func newTurnChatMessage(turn ConversationTurn, msg TurnMessage) (*ChatMessage, error) {
+	message := &ChatMessage{
+		SessionID:   turn.SessionID,
+		UserID:      turn.UserID,
+		DeviceID:    turn.DeviceID,
+		Role:        msg.Role,
+		Content:     msg.Content,
+		MessageType: msg.MessageType,
+		Timestamp:   msg.Timestamp,
+		IsProcessed: false,
+	}
+	if message.MessageType == "" {
+		message.MessageType = "text"
+	}
+	if message.Timestamp.IsZero() {
+		message.Timestamp = time.Now()
+	}
+	if msg.Metadata != nil {
+		if data, err := json.Marshal(msg.Metadata); err == nil {
+			message.Metadata = string(data)
+		}
+	}
+	if len(msg.Attachments) > 0 {
+		data, err := json.Marshal(msg.Attachments)
+		if err != nil {
+			return nil, fmt.Errorf("序列化消息附件失败: %v", err)
+		}
+		message.Attachments = string(data)
+	}
+	if msg.Moderation != nil {
+		score := msg.Moderation.Score
+		message.ModerationScore = &score
+		message.ModerationFlags = strings.Join(msg.Moderation.Flags, ",")
+		message.ModerationBlocked = msg.Moderation.Blocked
+	}
+	return message, nil
+}
+
+// incrementMessageCount 在事务中增加会话消息计数
+func incrementMessageCount(tx *gorm.DB, sessionID string, count int) error {
+	if err := tx.Model(&ChatSession{}).Where("session_id = ?", sessionID).
+		UpdateColumn("message_count", gorm.Expr("message_count + ?", count)).Error; err != nil {
+		return fmt.Errorf("更新会话消息计数失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// userProviderCategories 可以设置用户默认provider的类别
+var userProviderCategories = map[string]bool{"ASR": true, "TTS": true, "LLM": true, "VLLLM": true}
+
+// SetUserProviders 一次设置用户各类别的默认provider（类别 -> provider名称），
+// 每个provider须存在且已启用，全部校验通过后在同一事务中写入 UserProvider 绑定，任一失败则不做修改
+func (s *ConfigService) SetUserProviders(userID uint, providers map[string]string) ([]UserProvider, error) {
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("至少需要设置一个类别")
+	}
+	categories := make([]string, 0, len(providers))
+	normalized := make(map[string]string, len(providers))
+	for category, name := range providers {
+		category = strings.ToUpper(strings.TrimSpace(category))
+		if !userProviderCategories[category] {
+			return nil, fmt.Errorf("不支持的类别: %s", category)
+		}
+		if _, exists := normalized[category]; exists {
+			return nil, fmt.Errorf("类别重复: %s", category)
+		}
+		normalized[category] = strings.TrimSpace(name)
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	bindings := make([]UserProvider, 0, len(categories))
+	err := s.db.DB.Transaction(func(tx *gorm.DB) error {
+		for _, category := range categories {
+			var config ProviderConfig
+			err := tx.Where("category = ? AND name = ? AND is_active = ?", category, normalized[category], true).
+				Order("is_default DESC, weight DESC, id DESC").
+				First(&config).Error
+			if err == gorm.ErrRecordNotFound {
+				return fmt.Errorf("%s provider %s 不存在或未启用", category, normalized[category])
+			}
+			if err != nil {
+				return fmt.Errorf("查询提供商配置失败: %v", err)
+			}
+
+			var binding UserProvider
+			if err := tx.Where("user_id = ? AND category = ?", userID, category).
+				Assign(UserProvider{ProviderID: config.ID, IsActive: true}).
+				FirstOrCreate(&binding).Error; err != nil {
+				return fmt.Errorf("保存%s绑定失败: %v", category, err)
+			}
+			bindings = append(bindings, binding)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Info("用户 %d 的默认provider已更新: %v", userID, normalized)
+	return bindings, nil
+}
@@ -32,15 +32,33 @@ func (s *UserService) GetDB() *Database {
 	return s.db
 }
 
+// passwordCost 新密码哈希使用的bcrypt cost，来自系统配置 security.bcrypt_cost，未配置或超出范围时使用默认值
+func (s *UserService) passwordCost() int {
+	cost, err := NewConfigService(s.db, s.logger).GetSystemConfigInt("security", "bcrypt_cost")
+	if err != nil || cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return bcrypt.DefaultCost
+	}
+	return cost
+}
+
+// hashPassword 按当前配置的cost生成密码哈希
+func (s *UserService) hashPassword(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), s.passwordCost())
+	if err != nil {
+		return "", err
+	}
+	return string(hashedPassword), nil
+}
+
 // CreateUser 创建用户
 func (s *UserService) CreateUser(user *User, password string) error {
 	// 加密密码
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := s.hashPassword(password)
 	if err != nil {
 		return fmt.Errorf("密码加密失败: %v", err)
 	}
 
-	user.PasswordHash = string(hashedPassword)
+	user.PasswordHash = hashedPassword
 	user.Status = "active"
 	if user.Role == "" {
 		user.Role = "user"
@@ -69,7 +87,9 @@ func (s *UserService) GetUserByID(id uint) (*User, error) {
 // GetUserByUsername 根据用户名获取用户
 func (s *UserService) GetUserByUsername(username string) (*User, error) {
 	var user User
-	if err := s.db.DB.Where("username = ?", username).First(&user).Error; err != nil {
+	if err := s.db.WithRetry(func() error {
+		return s.db.DB.Where("username = ?", username).First(&user).Error
+	}); err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, nil
 		}
@@ -91,12 +111,12 @@ func (s *UserService) UpdateUser(user *User) error {
 // UpdatePassword 更新用户密码
 func (s *UserService) UpdatePassword(userID uint, newPassword string) error {
 	// 加密新密码
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	hashedPassword, err := s.hashPassword(newPassword)
 	if err != nil {
 		return fmt.Errorf("密码加密失败: %v", err)
 	}
 
-	if err := s.db.DB.Model(&User{}).Where("id = ?", userID).Update("password_hash", string(hashedPassword)).Error; err != nil {
+	if err := s.db.DB.Model(&User{}).Where("id = ?", userID).Update("password_hash", hashedPassword).Error; err != nil {
 		return fmt.Errorf("更新密码失败: %v", err)
 	}
 
@@ -179,9 +199,30 @@ func (s *UserService) AuthenticateUser(username, password string) (*User, error)
 		return nil, fmt.Errorf("用户状态异常")
 	}
 
+	s.rehashPasswordIfNeeded(user, password)
+
 	return user, nil
 }
 
+// rehashPasswordIfNeeded 登录成功后，若已有哈希的cost低于当前配置，按新cost重新哈希并保存；失败不影响登录
+func (s *UserService) rehashPasswordIfNeeded(user *User, password string) {
+	cost, err := bcrypt.Cost([]byte(user.PasswordHash))
+	if err != nil || cost >= s.passwordCost() {
+		return
+	}
+	hashedPassword, err := s.hashPassword(password)
+	if err != nil {
+		s.logger.Warn("重新哈希用户 %s 的密码失败: %v", user.Username, err)
+		return
+	}
+	if err := s.db.DB.Model(&User{}).Where("id = ?", user.ID).Update("password_hash", hashedPassword).Error; err != nil {
+		s.logger.Warn("保存用户 %s 的新密码哈希失败: %v", user.Username, err)
+		return
+	}
+	user.PasswordHash = hashedPassword
+	s.logger.Info("用户 %s 的密码哈希已从cost %d 升级", user.Username, cost)
+}
+
 // UpdateLoginInfo 更新登录信息
 func (s *UserService) UpdateLoginInfo(userID uint, ipAddress string) error {
 	now := time.Now()
@@ -318,6 +359,15 @@ func (s *UserService) BindUserDevice(userID uint, deviceUUID string, deviceAlias
 		return fmt.Errorf("序列化权限失败: %v", err)
 	}
 
+	var user User
+	if err := s.db.DB.First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return fmt.Errorf("用户不存在")
+		}
+		return fmt.Errorf("查询用户失败: %v", err)
+	}
+	limit := s.DeviceLimit(&user)
+
 	userDevice := &UserDevice{
 		UserID:      userID,
 		DeviceID:    device.ID,
@@ -327,8 +377,24 @@ func (s *UserService) BindUserDevice(userID uint, deviceUUID string, deviceAlias
 		IsActive:    true,
 	}
 
-	if err := s.db.DB.Create(userDevice).Error; err != nil {
-		return fmt.Errorf("绑定设备失败: %v", err)
+	// 统计和创建在同一事务中，避免并发绑定超出上限
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if limit > 0 {
+			bound, err := countActiveUserDevices(tx, userID)
+			if err != nil {
+				return err
+			}
+			if bound >= int64(limit) {
+				return &DeviceLimitError{Limit: limit, Bound: int(bound)}
+			}
+		}
+		if err := tx.Create(userDevice).Error; err != nil {
+			return fmt.Errorf("绑定设备失败: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
 	s.logger.Info("设备绑定成功: 用户ID %d, 设备UUID %s", userID, deviceUUID)
@@ -416,6 +482,7 @@ func (s *UserService) SetUserCapability(userID uint, capabilityName, capabilityT
 		}
 	}
 
+	InvalidateUserCapabilityCache(userID)
 	s.logger.Info("用户AI能力设置成功: 用户ID %d, 能力 %s", userID, capabilityName)
 	return nil
 }
@@ -489,7 +556,7 @@ func (s *UserService) GetUserStats() (map[string]interface{}, error) {
 
 // ResetPassword 重置用户密码
 func (s *UserService) ResetPassword(id int, newPassword string) error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	hashedPassword, err := s.hashPassword(newPassword)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,165 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"ai-server-go/src/configs"
+	"ai-server-go/src/core/utils"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newUserServiceTestDB 创建使用内存SQLite的数据库，已完成迁移
+func newUserServiceTestDB(t *testing.T) (*Database, *utils.Logger) {
+	t.Helper()
+	config := &configs.Config{}
+	config.Log.LogDir = t.TempDir()
+	config.Log.LogFile = "test.log"
+	config.Log.LogLevel = "ERROR"
+	config.Database.Type = "sqlite"
+	config.Database.Name = fmt.Sprintf("file:%s_%d?mode=memory&cache=shared", t.Name(), time.Now().UnixNano())
+
+	logger, err := utils.NewLogger(config)
+	if err != nil {
+		t.Fatalf("创建日志失败: %v", err)
+	}
+	db, err := NewDatabase(&config.Database, logger)
+	if err != nil {
+		t.Fatalf("初始化内存数据库失败: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.AutoMigrate(); err != nil {
+		t.Fatalf("数据库迁移失败: %v", err)
+	}
+	return db, logger
+}
+
+func TestAuthenticateUserRehashesLowerCost(t *testing.T) {
+	db, logger := newUserServiceTestDB(t)
+	configService := NewConfigService(db, logger)
+	userService := NewUserService(db, logger)
+
+	if err := configService.SetSystemConfig("security", "bcrypt_cost", "4", "int", "", false, nil, nil); err != nil {
+		t.Fatalf("设置bcrypt cost失败: %v", err)
+	}
+	user := &User{Username: "alice"}
+	if err := userService.CreateUser(user, "secret-password"); err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	if cost, _ := bcrypt.Cost([]byte(user.PasswordHash)); cost != 4 {
+		t.Fatalf("新建用户的哈希cost = %d, 期望 4", cost)
+	}
+
+	// 提高cost后，登录成功时按新cost重新哈希并保存
+	if err := configService.SetSystemConfig("security", "bcrypt_cost", "5", "int", "", false, nil, nil); err != nil {
+		t.Fatalf("设置bcrypt cost失败: %v", err)
+	}
+	if _, err := userService.AuthenticateUser("alice", "wrong-password"); err == nil {
+		t.Fatal("错误的密码不应认证成功")
+	}
+	stored, _ := userService.GetUserByID(user.ID)
+	if cost, _ := bcrypt.Cost([]byte(stored.PasswordHash)); cost != 4 {
+		t.Fatalf("认证失败后哈希cost = %d, 不应被升级", cost)
+	}
+
+	if _, err := userService.AuthenticateUser("alice", "secret-password"); err != nil {
+		t.Fatalf("认证失败: %v", err)
+	}
+	stored, _ = userService.GetUserByID(user.ID)
+	if cost, _ := bcrypt.Cost([]byte(stored.PasswordHash)); cost != 5 {
+		t.Fatalf("登录后哈希cost = %d, 期望升级为 5", cost)
+	}
+	if _, err := userService.AuthenticateUser("alice", "secret-password"); err != nil {
+		t.Fatalf("升级哈希后认证失败: %v", err)
+	}
+
+	// 降低cost不会把已有哈希降级
+	if err := configService.SetSystemConfig("security", "bcrypt_cost", "4", "int", "", false, nil, nil); err != nil {
+		t.Fatalf("设置bcrypt cost失败: %v", err)
+	}
+	if _, err := userService.AuthenticateUser("alice", "secret-password"); err != nil {
+		t.Fatalf("认证失败: %v", err)
+	}
+	stored, _ = userService.GetUserByID(user.ID)
+	if cost, _ := bcrypt.Cost([]byte(stored.PasswordHash)); cost != 5 {
+		t.Fatalf("降低配置后哈希cost = %d, 不应降级", cost)
+	}
+}
+
+func TestBindUserDeviceLimit(t *testing.T) {
+	db, logger := newUserServiceTestDB(t)
+	configService := NewConfigService(db, logger)
+	userService := NewUserService(db, logger)
+
+	if err := configService.SetSystemConfig("security", "bcrypt_cost", "4", "int", "", false, nil, nil); err != nil {
+		t.Fatalf("设置bcrypt cost失败: %v", err)
+	}
+	if err := configService.SetSystemConfig("device_binding", "max_devices_per_user", "2", "int", "", false, nil, nil); err != nil {
+		t.Fatalf("设置绑定上限失败: %v", err)
+	}
+	user := &User{Username: "bob", Email: "bob@example.com"}
+	if err := userService.CreateUser(user, "secret-password"); err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	for i := 1; i <= 4; i++ {
+		device := &Device{DeviceUUID: fmt.Sprintf("uuid-%d", i), OUI: "AABBCC", SN: fmt.Sprintf("sn-%d", i), DeviceName: fmt.Sprintf("设备%d", i)}
+		if err := db.DB.Create(device).Error; err != nil {
+			t.Fatalf("创建设备失败: %v", err)
+		}
+	}
+	bind := func(uuid string) error {
+		return userService.BindUserDevice(user.ID, uuid, "", true, nil)
+	}
+
+	for _, uuid := range []string{"uuid-1", "uuid-2"} {
+		if err := bind(uuid); err != nil {
+			t.Fatalf("未达上限时绑定 %s 失败: %v", uuid, err)
+		}
+	}
+
+	// 达到上限后拒绝绑定，返回上限和已绑定数
+	err := bind("uuid-3")
+	var limitErr *DeviceLimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("达到上限时应返回 DeviceLimitError，实际为 %v", err)
+	}
+	if limitErr.Limit != 2 || limitErr.Bound != 2 {
+		t.Fatalf("上限错误信息不正确: limit=%d bound=%d", limitErr.Limit, limitErr.Bound)
+	}
+	if count, _ := userService.CountActiveUserDevices(user.ID); count != 2 {
+		t.Fatalf("超出上限的绑定不应写入，当前绑定数 %d", count)
+	}
+
+	// 只统计启用中的绑定
+	binding, _ := userService.GetUserDeviceBinding(user.ID, 1)
+	if err := db.DB.Model(binding).Update("is_active", false).Error; err != nil {
+		t.Fatalf("停用绑定失败: %v", err)
+	}
+	if err := bind("uuid-3"); err != nil {
+		t.Fatalf("停用一个绑定后应允许绑定: %v", err)
+	}
+	if err := bind("uuid-4"); !errors.As(err, &limitErr) {
+		t.Fatalf("再次达到上限时应拒绝绑定，实际为 %v", err)
+	}
+
+	// 管理员为用户单独提高上限
+	limit := 3
+	if err := userService.SetUserDeviceLimit(user.ID, &limit); err != nil {
+		t.Fatalf("设置用户绑定上限失败: %v", err)
+	}
+	if err := bind("uuid-4"); err != nil {
+		t.Fatalf("提高上限后绑定失败: %v", err)
+	}
+
+	// 恢复默认后按系统配置计算
+	if err := userService.SetUserDeviceLimit(user.ID, nil); err != nil {
+		t.Fatalf("恢复默认上限失败: %v", err)
+	}
+	stored, _ := userService.GetUserByID(user.ID)
+	if stored.MaxDevices != nil || userService.DeviceLimit(stored) != 2 {
+		t.Fatalf("恢复默认后上限应为系统配置的 2，实际 max_devices=%v", stored.MaxDevices)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -15,21 +16,27 @@ import (
 	"ai-server-go/src/core"
 	"ai-server-go/src/core/auth"
 	"ai-server-go/src/core/pool"
+	"ai-server-go/src/core/scheduler"
 	"ai-server-go/src/core/utils"
 	"ai-server-go/src/database"
 	"ai-server-go/src/ota"
 	"ai-server-go/src/vision"
 
 	// 导入所有providers以确保init函数被调用
+	_ "ai-server-go/src/core/providers/asr/aliyun"
 	_ "ai-server-go/src/core/providers/asr/doubao"
 	_ "ai-server-go/src/core/providers/asr/gosherpa"
+	_ "ai-server-go/src/core/providers/embedding/openai"
 	_ "ai-server-go/src/core/providers/llm/ollama"
 	_ "ai-server-go/src/core/providers/llm/openai"
 	_ "ai-server-go/src/core/providers/tts/doubao"
 	_ "ai-server-go/src/core/providers/tts/edge"
 	_ "ai-server-go/src/core/providers/tts/gosherpa"
+	_ "ai-server-go/src/core/providers/vad/silero"
 	_ "ai-server-go/src/core/providers/vlllm/ollama"
 	_ "ai-server-go/src/core/providers/vlllm/openai"
+	_ "ai-server-go/src/core/providers/weather/openweathermap"
+	_ "ai-server-go/src/core/providers/weather/wttr"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/sync/errgroup"
@@ -88,7 +95,7 @@ func StartWSServer(config *configs.Config, logger *utils.Logger, g *errgroup.Gro
 	return wsServer, nil
 }
 
-func StartHttpServer(config *configs.Config, logger *utils.Logger, g *errgroup.Group, groupCtx context.Context, configService *database.ConfigService, db *database.Database) (*http.Server, error) {
+func StartHttpServer(config *configs.Config, logger *utils.Logger, g *errgroup.Group, groupCtx context.Context, configService *database.ConfigService, db *database.Database, wsServer *core.WebSocketServer, memoryService *database.ChatMemoryService) (*http.Server, error) {
 	// 初始化Gin引擎
 	if config.Log.LogLevel == "debug" {
 		gin.SetMode(gin.DebugMode)
@@ -97,6 +104,7 @@ func StartHttpServer(config *configs.Config, logger *utils.Logger, g *errgroup.G
 	}
 	router := gin.Default()
 	router.SetTrustedProxies([]string{"0.0.0.0"})
+	router.Use(api.TraceMiddleware())
 
 	// 添加根路径路由用于测试
 	router.GET("/", func(c *gin.Context) {
@@ -114,6 +122,58 @@ func StartHttpServer(config *configs.Config, logger *utils.Logger, g *errgroup.G
 		})
 	})
 
+	// 就绪检查：会话数达到上限或数据库熔断时返回503，便于负载均衡器将新连接路由到其他实例
+	router.GET("/health/ready", func(c *gin.Context) {
+		stats := wsServer.GetSessionStats()
+		status, code := "ready", http.StatusOK
+		if wsServer.IsSaturated() {
+			status, code = "saturated", http.StatusServiceUnavailable
+		} else if !db.Available() {
+			status, code = "database_unavailable", http.StatusServiceUnavailable
+		}
+		c.JSON(code, gin.H{
+			"status":   status,
+			"sessions": stats,
+			"database": db.Available(),
+			"time":     time.Now().Format(time.RFC3339),
+		})
+	})
+
+	// Prometheus文本格式的运行指标
+	router.GET("/metrics", func(c *gin.Context) {
+		stats := wsServer.GetSessionStats()
+		cacheStats := core.LLMCacheStats()
+		c.String(http.StatusOK, "# HELP ai_server_sessions_active 当前WebSocket会话数\n"+
+			"# TYPE ai_server_sessions_active gauge\n"+
+			"ai_server_sessions_active %d\n"+
+			"# HELP ai_server_sessions_max 最大并发会话数（0表示不限制）\n"+
+			"# TYPE ai_server_sessions_max gauge\n"+
+			"ai_server_sessions_max %d\n"+
+			"# HELP ai_server_sessions_rejected_total 因达到上限被拒绝的连接数\n"+
+			"# TYPE ai_server_sessions_rejected_total counter\n"+
+			"ai_server_sessions_rejected_total %d\n"+
+			"# HELP ai_server_ws_dropped_frames_total 因设备消费过慢丢弃的低优先级下行帧数\n"+
+			"# TYPE ai_server_ws_dropped_frames_total counter\n"+
+			"ai_server_ws_dropped_frames_total %d\n"+
+			"# HELP ai_server_ws_slow_consumer_disconnects_total 因设备消费过慢断开的连接数\n"+
+			"# TYPE ai_server_ws_slow_consumer_disconnects_total counter\n"+
+			"ai_server_ws_slow_consumer_disconnects_total %d\n"+
+			"# HELP ai_server_llm_cache_hits_total LLM回复缓存命中次数\n"+
+			"# TYPE ai_server_llm_cache_hits_total counter\n"+
+			"ai_server_llm_cache_hits_total %d\n"+
+			"# HELP ai_server_llm_cache_misses_total LLM回复缓存未命中次数\n"+
+			"# TYPE ai_server_llm_cache_misses_total counter\n"+
+			"ai_server_llm_cache_misses_total %d\n"+
+			"# HELP ai_server_llm_cache_bypassed_total 因绕过规则或记忆未使用LLM回复缓存的次数\n"+
+			"# TYPE ai_server_llm_cache_bypassed_total counter\n"+
+			"ai_server_llm_cache_bypassed_total %d\n"+
+			"# HELP ai_server_llm_cache_entries 当前LLM回复缓存条数\n"+
+			"# TYPE ai_server_llm_cache_entries gauge\n"+
+			"ai_server_llm_cache_entries %d\n",
+			stats.Active, stats.Max, stats.Rejected, stats.DroppedFrames, stats.SlowConsumerDisconnects,
+			cacheStats.Hits, cacheStats.Misses, cacheStats.Bypassed, cacheStats.Entries)
+	})
+
 	// 执行数据库自动迁移
 	if err := db.AutoMigrate(); err != nil {
 		logger.Error("数据库迁移失败: %v", err)
@@ -142,11 +202,59 @@ func StartHttpServer(config *configs.Config, logger *utils.Logger, g *errgroup.G
 	}
 	defer poolManager.Close()
 
-	// API路由全部挂载到/api前缀下
-	apiGroup := router.Group("/api")
-
 	// 创建用户管理API
 	userAPI := api.NewUserAPI(userService, deviceService, configService, authMiddleware, logger, poolManager)
+
+	// 后台维护任务统一由调度器执行，服务关闭时等待进行中的任务结束
+	jobs := scheduler.New(groupCtx, logger)
+	g.Go(func() error {
+		<-groupCtx.Done()
+		jobs.Stop()
+		logger.Info("定时任务已停止")
+		return nil
+	})
+
+	// 设备上传图片的存储，后台定期删除过期图片
+	imageStore, err := database.NewImageStoreWithConfig(db.GetDB(), config.BlobStore, logger)
+	if err != nil {
+		logger.Error("初始化图片存储失败，图片接口不可用: %v", err)
+	} else {
+		if err := jobs.Register(imageStore.ImageRetentionJob()); err != nil {
+			logger.Error("注册图片清理任务失败: %v", err)
+		}
+		userAPI.SetImageStore(imageStore)
+	}
+
+	// 调试音频采集的存储，后台定期删除过期音频，全局隐私开关开启时删除全部音频
+	audioCaptureStore, err := database.NewAudioCaptureStoreWithConfig(db.GetDB(), config.BlobStore, logger)
+	if err != nil {
+		logger.Error("初始化音频采集存储失败，音频采集接口不可用: %v", err)
+	} else {
+		if err := jobs.Register(audioCaptureStore.AudioCaptureRetentionJob(configService)); err != nil {
+			logger.Error("注册音频清理任务失败: %v", err)
+		}
+		userAPI.SetAudioCaptureStore(audioCaptureStore)
+	}
+
+	// 用户聊天数据清除，chat_retention 开启时后台按保留期自动清除
+	chatDataPurger := database.NewChatDataPurger(db, imageStore, audioCaptureStore, logger)
+	if err := jobs.Register(chatDataPurger.ChatRetentionJob(configService)); err != nil {
+		logger.Error("注册聊天数据保留期清除任务失败: %v", err)
+	}
+	userAPI.SetChatDataPurger(chatDataPurger)
+
+	// 会话导出和命名
+	userAPI.SetMemoryService(memoryService)
+
+	// 会话级provider覆盖作用于本实例的活跃连接
+	userAPI.SetSessionOverrider(wsServer)
+
+	// 管理端实时状态推送，服务关闭时结束推送连接
+	userAPI.SetStatusStream(groupCtx, wsServer)
+
+	// API路由全部挂载到/api前缀下，数据库熔断时返回503，维护模式下拦截非管理员写操作（/health不受影响）
+	apiGroup := router.Group("/api")
+	apiGroup.Use(api.DatabaseGuard(db), userAPI.MaintenanceGuard())
 	userAPI.RegisterRoutes(apiGroup)
 
 	// 启动OTA服务
@@ -288,16 +396,37 @@ func main() {
 		logger.Error("初始化默认provider配置失败: %v", err)
 		os.Exit(1)
 	}
+	// 修复同一类别存在多个默认provider的历史数据
+	if _, err := configService.RepairDuplicateDefaultProviders(); err != nil {
+		logger.Warn("修复重复的默认provider配置失败: %v", err)
+	}
+	// 输出生效的环境变量覆盖（只输出变量名，不输出值）
+	if names := database.EnvOverrideNames(); len(names) > 0 {
+		logger.Info("以下配置由环境变量覆盖: %s", strings.Join(names, ", "))
+	}
+	// 检查provider配置，仍为占位符的provider输出警告，不阻止启动
+	if _, err := configService.ValidateProviderConfigs(); err != nil {
+		logger.Warn("检查provider配置失败: %v", err)
+	}
+
+	// 启动待重试记忆的后台处理和记忆整理任务
+	memoryService, err := database.NewChatMemoryServiceWithConfig(db.GetDB(), config.Memory, logger)
+	if err != nil {
+		logger.Error("初始化记忆服务失败: %v", err)
+		os.Exit(1)
+	}
+	memoryService.StartPendingMemoryWorker(ctx)
+	memoryService.StartMemoryCompactor(ctx)
 
 	// 启动WebSocket服务
-	_, err = StartWSServer(config, logger, g, ctx, configService)
+	wsServer, err := StartWSServer(config, logger, g, ctx, configService)
 	if err != nil {
 		logger.Error("启动WebSocket服务失败", err)
 		os.Exit(1)
 	}
 
 	// 启动HTTP服务（内部完成所有服务注册和初始化）
-	_, err = StartHttpServer(config, logger, g, ctx, configService, db)
+	_, err = StartHttpServer(config, logger, g, ctx, configService, db, wsServer, memoryService)
 	if err != nil {
 		logger.Error("启动服务失败", err)
 		os.Exit(1)
@@ -0,0 +1,6 @@
+//go:build fake
+
+package main
+
+// 使用 -tags fake 构建时注册假的ASR/LLM/TTS提供者（type 为 fake），用于在CI中跑端到端测试
+import _ "ai-server-go/src/core/providers/fake"
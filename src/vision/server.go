@@ -3,17 +3,18 @@ package vision
 import (
 	"context"
 	"encoding/base64"
-	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"ai-server-go/src/configs"
 	"ai-server-go/src/core/auth"
 	"ai-server-go/src/core/image"
+	"ai-server-go/src/core/moderation"
 	"ai-server-go/src/core/providers"
 	"ai-server-go/src/core/providers/vlllm"
 	"ai-server-go/src/core/utils"
@@ -33,8 +34,9 @@ type DefaultVisionService struct {
 	logger        *utils.Logger
 	config        *configs.Config
 	configService *database.ConfigService
-	vlllmMap      map[string]*vlllm.Provider // 支持多个VLLLM provider
-	authToken     *auth.AuthToken            // 认证工具
+	vlllmMap      map[string]*vlllm.Provider          // 支持多个VLLLM provider
+	vlllmConfigs  map[string]*database.ProviderConfig // provider配置，用于读取单价估算费用
+	authToken     *auth.AuthToken                     // 认证工具
 }
 
 // NewDefaultVisionService 创建默认Vision服务
@@ -47,6 +49,7 @@ func NewDefaultVisionService(config *configs.Config, logger *utils.Logger, confi
 		config:        config,
 		configService: configService,
 		vlllmMap:      make(map[string]*vlllm.Provider),
+		vlllmConfigs:  make(map[string]*database.ProviderConfig),
 		authToken:     authToken,
 	}
 
@@ -79,9 +82,9 @@ func (s *DefaultVisionService) initVLLMProviders() error {
 		}
 
 		// 创建VLLLM provider配置
-		var props map[string]interface{}
-		if err := json.Unmarshal(vlllmConfig.Props, &props); err != nil {
-			s.logger.Error("解析VLLLM Props失败: %v", err)
+		props, err := vlllmConfig.PropsMap()
+		if err != nil {
+			s.logger.Error("%v", err)
 			continue
 		}
 		var vlllmProps vlllm.VLLLMConfig
@@ -114,6 +117,7 @@ func (s *DefaultVisionService) initVLLMProviders() error {
 		}
 
 		s.vlllmMap[vlllmConfig.Name] = provider
+		s.vlllmConfigs[vlllmConfig.Name] = vlllmConfig
 		s.logger.Info(fmt.Sprintf("VLLLM provider %s 初始化成功", vlllmConfig.Name))
 	}
 
@@ -196,7 +200,8 @@ func (s *DefaultVisionService) handlePost(c *gin.Context) {
 	})
 
 	// 处理图片分析
-	result, err := s.processVisionRequest(req)
+	result, cost, err := s.processVisionRequest(req)
+	c.Header(database.EstimatedCostHeader, database.FormatCost(cost))
 
 	// 返回成功响应
 	response := VisionResponse{
@@ -307,6 +312,12 @@ func (s *DefaultVisionService) parseMultipartRequest(c *gin.Context, deviceID st
 		return nil, fmt.Errorf("不支持的文件格式，请上传有效的图片文件（支持JPEG、PNG、GIF、BMP、TIFF、WEBP格式）")
 	}
 
+	// 图片内容审核（默认关闭），在保存和发送给视觉模型之前执行
+	imageData, err = s.screenImage(c.Request.Context(), deviceID, imageData)
+	if err != nil {
+		return nil, err
+	}
+
 	// 将图片保存在本地
 	saveImageToFile, err := s.saveImageToFile(imageData, deviceID)
 	if err != nil {
@@ -342,12 +353,40 @@ func (s *DefaultVisionService) saveImageToFile(imageData []byte, deviceID string
 	return filepath, nil
 }
 
+// screenImage 按设备的图片审核配置审核图片：拒绝时返回提示语错误，马赛克处理时返回处理后的图片
+func (s *DefaultVisionService) screenImage(ctx context.Context, deviceID string, imageData []byte) ([]byte, error) {
+	id, _ := strconv.ParseUint(deviceID, 10, 32)
+	config := moderation.LoadImageConfig(s.configService, uint(id), nil)
+	if !config.Enabled {
+		return imageData, nil
+	}
+	moderator, err := moderation.NewImageModerator(config)
+	if err != nil {
+		s.logger.Error("创建图片审核器失败，跳过图片审核: %v", err)
+		return imageData, nil
+	}
+
+	decision, err := moderation.CheckImage(ctx, moderator, config, imageData, s.detectImageFormat(imageData))
+	if err != nil {
+		s.logger.Error("图片内容审核失败(strict=%t): %v", config.Strict, err)
+	}
+	switch decision.Action {
+	case moderation.ImageActionReject:
+		s.logger.Warn("Vision图片被内容审核拒绝: device=%s, score=%.2f, flags=%v", deviceID, decision.Result.Score, decision.Result.Flags)
+		return nil, fmt.Errorf("%s", config.RejectedMessage)
+	case moderation.ImageActionBlur:
+		s.logger.Info("Vision图片经内容审核做马赛克处理: device=%s, score=%.2f, flags=%v", deviceID, decision.Result.Score, decision.Result.Flags)
+		return decision.Data, nil
+	}
+	return imageData, nil
+}
+
 // processVisionRequest 处理视觉分析请求
-func (s *DefaultVisionService) processVisionRequest(req *VisionRequest) (string, error) {
+func (s *DefaultVisionService) processVisionRequest(req *VisionRequest) (string, float64, error) {
 	// 选择VLLLM provider
-	provider := s.selectProvider("")
+	name, provider := s.selectProvider("")
 	if provider == nil {
-		return "", fmt.Errorf("没有可用的视觉分析模型")
+		return "", 0, fmt.Errorf("没有可用的视觉分析模型")
 	}
 
 	// 将图片转换为base64
@@ -363,7 +402,7 @@ func (s *DefaultVisionService) processVisionRequest(req *VisionRequest) (string,
 	messages := []providers.Message{} // 空的历史消息
 	responseChan, err := provider.ResponseWithImage(context.Background(), "", messages, imageData, req.Question)
 	if err != nil {
-		return "", fmt.Errorf("调用VLLLM失败: %v", err)
+		return "", 0, fmt.Errorf("调用VLLLM失败: %v", err)
 	}
 
 	// 收集所有响应内容
@@ -373,24 +412,29 @@ func (s *DefaultVisionService) processVisionRequest(req *VisionRequest) (string,
 	}
 	s.logger.Info(fmt.Sprintf("VLLLM分析结果: %s", result.String()))
 
-	return result.String(), nil
+	// 按问题和回答估算token费用（图片部分不计）
+	cost := database.EstimateCost(s.vlllmConfigs[name], database.UsageAmount{
+		InputTokens:  utils.EstimateTokens(req.Question),
+		OutputTokens: utils.EstimateTokens(result.String()),
+	})
+	return result.String(), cost, nil
 }
 
 // selectProvider 选择VLLLM provider
-func (s *DefaultVisionService) selectProvider(modelName string) *vlllm.Provider {
+func (s *DefaultVisionService) selectProvider(modelName string) (string, *vlllm.Provider) {
 	// 如果指定了模型名，尝试找到对应的provider
 	if modelName != "" {
 		if provider, exists := s.vlllmMap[modelName]; exists {
-			return provider
+			return modelName, provider
 		}
 	}
 
 	// 否则返回第一个可用的provider
-	for _, provider := range s.vlllmMap {
-		return provider
+	for name, provider := range s.vlllmMap {
+		return name, provider
 	}
 
-	return nil
+	return "", nil
 }
 
 // isValidImageFile 检查是否为有效的图片文件